@@ -37,6 +37,7 @@ import (
 	_ "github.com/aperturerobotics/cayley/graph/all"
 
 	// Load all supported quad formats.
+	_ "github.com/aperturerobotics/cayley/quad/csv"
 	_ "github.com/aperturerobotics/cayley/quad/dot"
 	_ "github.com/aperturerobotics/cayley/quad/gml"
 	_ "github.com/aperturerobotics/cayley/quad/graphml"
@@ -44,6 +45,9 @@ import (
 	_ "github.com/aperturerobotics/cayley/quad/jsonld"
 	_ "github.com/aperturerobotics/cayley/quad/nquads"
 	_ "github.com/aperturerobotics/cayley/quad/pquads"
+	_ "github.com/aperturerobotics/cayley/quad/rdfxml"
+	_ "github.com/aperturerobotics/cayley/quad/trig"
+	_ "github.com/aperturerobotics/cayley/quad/turtle"
 
 	// Load writer registry
 	_ "github.com/aperturerobotics/cayley/writer"
@@ -53,6 +57,7 @@ import (
 	_ "github.com/aperturerobotics/cayley/query/graphql"
 	_ "github.com/aperturerobotics/cayley/query/mql"
 	_ "github.com/aperturerobotics/cayley/query/sexp"
+	_ "github.com/aperturerobotics/cayley/query/sparql"
 )
 
 var (
@@ -127,6 +132,7 @@ func init() {
 		command.NewLoadDatabaseCmd(),
 		command.NewDumpDatabaseCmd(),
 		command.NewUpgradeCmd(),
+		command.NewDatabaseCmd(),
 		command.NewReplCmd(),
 		command.NewQueryCmd(),
 		command.NewHTTPCmd(),
@@ -0,0 +1,181 @@
+package command
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/kv"
+	hkv "github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/base"
+	"github.com/aperturerobotics/cayley/kv/flat"
+)
+
+// openRawKV opens the underlying key-value database without initializing a quad store on top of it.
+func openRawKV() (hkv.KV, error) {
+	name := viper.GetString(KeyBackend)
+	path := viper.GetString(KeyAddress)
+	r := hkv.ByName(name)
+	if r == nil {
+		r = hkv.ByName("flat" + base.RegistrySep + name)
+	}
+	if r == nil {
+		return nil, fmt.Errorf("database backend %q is not a key-value store", name)
+	} else if r.Volatile {
+		return nil, ErrNotPersistent
+	}
+	return r.OpenPath(path)
+}
+
+// rawFlatBackend returns the driver of the underlying flat key-value database.
+// It returns nil if the backend is not a flat key-value store.
+func rawFlatBackend() *flat.Registration {
+	name := viper.GetString(KeyBackend)
+	if hkv.ByName(name) != nil && !strings.HasPrefix(name, "flat"+base.RegistrySep) {
+		return nil
+	}
+	return flat.ByName(strings.TrimPrefix(name, "flat"+base.RegistrySep))
+}
+
+// openRawFlat is like openRawKV, but opens a flat key-value database without upgrading it.
+// Database wrappers, such as encryption, are applied to flat databases before the upgrade,
+// thus this is the raw data they operate on.
+func openRawFlat() (flat.KV, error) {
+	r := rawFlatBackend()
+	if r == nil {
+		return nil, fmt.Errorf("database backend %q is not a flat key-value store", viper.GetString(KeyBackend))
+	} else if r.Volatile {
+		return nil, ErrNotPersistent
+	}
+	return r.OpenPath(viper.GetString(KeyAddress))
+}
+
+// checkRawSnapshot checks if the raw database can be copied by a snapshot.
+// Encrypted keys of flat databases do not preserve the structure of hierarchical keys.
+func checkRawSnapshot() error {
+	if rawFlatBackend() == nil {
+		return nil
+	}
+	c, err := kv.CipherFromOptions(graph.Options(viper.GetStringMap(KeyOptions)))
+	if err != nil {
+		return err
+	} else if c != nil && c.EncryptsKeys() {
+		return errors.New("flat databases with encrypted keys cannot be backed up; use dump instead")
+	}
+	return nil
+}
+
+func NewBackupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup <file>",
+		Short: "Write a raw copy of the key-value database to a file.",
+		Long: `Write a raw copy of the key-value database to a file.
+
+Unlike dump, the backup preserves all internal data of the database, including
+indexes, node IDs and the history of changes. The file can be loaded by restore.
+Use "-" to write to stdout; files with ".gz" extension are compressed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			if err := checkRawSnapshot(); err != nil {
+				return err
+			}
+			db, err := openRawKV()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			var (
+				w  io.Writer = os.Stdout
+				f  *os.File
+				gz *gzip.Writer
+			)
+			if path := args[0]; path != "-" {
+				f, err = os.Create(path)
+				if err != nil {
+					return fmt.Errorf("could not create file %q: %v", path, err)
+				}
+				defer f.Close()
+				w = f
+				if strings.HasSuffix(path, ".gz") {
+					gz = gzip.NewWriter(f)
+					w = gz
+				}
+			}
+			start := time.Now()
+			st, err := hkv.WriteSnapshot(cmd.Context(), db, w)
+			if err != nil {
+				return err
+			}
+			if gz != nil {
+				if err = gz.Close(); err != nil {
+					return err
+				}
+			}
+			if f != nil {
+				if err = f.Close(); err != nil {
+					return err
+				}
+			}
+			clog.Infof("written %d pairs (%d bytes) in %v", st.Pairs, st.Bytes, time.Since(start))
+			return nil
+		},
+	}
+}
+
+func NewRestoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore the key-value database from a backup.",
+		Long: `Restore the key-value database from a backup.
+
+The database must be empty. The backup can be restored into a different
+key-value backend than the one it was made from.
+Use "-" to read from stdin; files with ".gz" extension are decompressed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			var r io.Reader = os.Stdin
+			if path := args[0]; path != "-" {
+				f, err := os.Open(path)
+				if err != nil {
+					return fmt.Errorf("could not open file %q: %v", path, err)
+				}
+				defer f.Close()
+				r = f
+				if strings.HasSuffix(path, ".gz") {
+					gz, err := gzip.NewReader(f)
+					if err != nil {
+						return err
+					}
+					defer gz.Close()
+					r = gz
+				}
+			}
+			if err := checkRawSnapshot(); err != nil {
+				return err
+			}
+			db, err := openRawKV()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			start := time.Now()
+			st, err := hkv.RestoreSnapshot(cmd.Context(), db, r)
+			if err != nil {
+				return err
+			}
+			clog.Infof("restored %d pairs (%d bytes) in %v", st.Pairs, st.Bytes, time.Since(start))
+			return db.Close()
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph/kv"
+)
+
+func NewCompactCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Remove deleted quads and unused nodes from the database.",
+		Long: `Remove deleted quads and unused nodes from the database.
+
+By default, all history of changes is removed. Use --keep_history to preserve
+changes made after a given log position, as reported by the command.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			keep, _ := cmd.Flags().GetInt64("keep_history")
+			ctx := cmd.Context()
+			qs, err := openKVDatabase(ctx)
+			if err != nil {
+				return err
+			}
+			defer qs.Close()
+			start := time.Now()
+			st, err := qs.Compact(ctx, kv.CompactOptions{KeepHistory: keep})
+			if err != nil {
+				return err
+			}
+			h, err := qs.Horizon(ctx)
+			if err != nil {
+				return err
+			}
+			clog.Infof("compacted in %v", time.Since(start))
+			fmt.Fprintf(cmd.OutOrStdout(), "removed %d log entries, %d nodes and %d index entries; reclaimed %d bytes\nlog position: %d\n",
+				st.Primitives, st.Nodes, st.Postings, st.Bytes, h)
+			return nil
+		},
+	}
+	cmd.Flags().Int64("keep_history", 0, "log position after which the history of changes is preserved")
+	return cmd
+}
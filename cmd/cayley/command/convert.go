@@ -9,7 +9,6 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/aperturerobotics/cayley/clog"
-	"github.com/aperturerobotics/cayley/internal"
 	"github.com/aperturerobotics/cayley/quad"
 )
 
@@ -103,7 +102,7 @@ func NewConvertCmd() *cobra.Command {
 					} else {
 						fmt.Printf("reading %q\n", path)
 					}
-					return internal.QuadReaderFor(path, loadf)
+					return quadReaderFor(cmd, path, loadf)
 				}))
 			}
 			// TODO: print additional stats
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"sort"
@@ -16,8 +18,10 @@ import (
 
 	"github.com/aperturerobotics/cayley/clog"
 	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/cache"
 	"github.com/aperturerobotics/cayley/internal"
 	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/csv"
 )
 
 const (
@@ -33,6 +37,7 @@ const (
 const (
 	flagLoad       = "load"
 	flagLoadFormat = "load_format"
+	flagMapping    = "mapping"
 	flagDump       = "dump"
 	flagDumpFormat = "dump_format"
 )
@@ -50,6 +55,55 @@ func registerLoadFlags(cmd *cobra.Command) {
 	}
 	sort.Strings(names)
 	cmd.Flags().String(flagLoadFormat, "", `quad file format to use for loading instead of auto-detection ("`+strings.Join(names, `", "`)+`")`)
+	cmd.Flags().String(flagMapping, "", `JSON file with a mapping of table columns to quads, for loading "csv" and "tsv" files`)
+}
+
+// newMappedReader returns a function to decode a table to load with a mapping set by flags.
+// It returns nil if no mapping is set.
+func newMappedReader(cmd *cobra.Command, path, typ string) (func(r io.Reader) quad.ReadCloser, error) {
+	mpath, _ := cmd.Flags().GetString(flagMapping)
+	if mpath == "" {
+		return nil, nil
+	}
+	if typ == "" {
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".bz2")
+		if f := quad.FormatByExt(filepath.Ext(name)); f != nil {
+			typ = f.Name
+		}
+	}
+	m, err := csv.LoadMapping(mpath)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case "csv":
+		return func(r io.Reader) quad.ReadCloser { return csv.NewReader(r, m) }, nil
+	case "tsv":
+		return func(r io.Reader) quad.ReadCloser { return csv.NewTSVReader(r, m) }, nil
+	}
+	return nil, fmt.Errorf("mapping is not supported for %q format", typ)
+}
+
+// quadReaderFor opens a quad file to load, as configured by flags.
+func quadReaderFor(cmd *cobra.Command, path, typ string) (quad.ReadCloser, error) {
+	fnc, err := newMappedReader(cmd, path, typ)
+	if err != nil {
+		return nil, err
+	} else if fnc != nil {
+		return internal.QuadReaderWith(path, fnc)
+	}
+	return internal.QuadReaderFor(path, typ)
+}
+
+// loadFile loads a quad file into the database, as configured by flags.
+func loadFile(ctx context.Context, cmd *cobra.Command, qw quad.WriteCloser, path, typ string) error {
+	fnc, err := newMappedReader(cmd, path, typ)
+	if err != nil {
+		return err
+	} else if fnc != nil {
+		return internal.LoadWith(ctx, qw, quad.DefaultBatch, path, fnc)
+	}
+	return internal.Load(ctx, qw, quad.DefaultBatch, path, typ)
 }
 
 func registerDumpFlags(cmd *cobra.Command) {
@@ -121,7 +175,7 @@ func NewLoadDatabaseCmd() *cobra.Command {
 
 			// TODO: check read-only flag in config before that?
 			typ, _ := cmd.Flags().GetString(flagLoadFormat)
-			if err = internal.Load(ctx, qw, quad.DefaultBatch, load, typ); err != nil {
+			if err = loadFile(ctx, cmd, qw, load, typ); err != nil {
 				return err
 			}
 
@@ -168,6 +222,22 @@ func NewDumpDatabaseCmd() *cobra.Command {
 	return cmd
 }
 
+// NewDatabaseCmd returns a group of database maintenance commands.
+func NewDatabaseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Database maintenance.",
+	}
+	cmd.AddCommand(
+		NewIndexCmd(),
+		NewCompactCmd(),
+		NewBackupCmd(),
+		NewRestoreCmd(),
+		NewReencryptCmd(),
+	)
+	return cmd
+}
+
 func NewUpgradeCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "upgrade",
@@ -211,6 +281,9 @@ func openDatabase(ctx context.Context) (*graph.Handle, error) {
 	if err != nil {
 		return nil, err
 	}
+	if size := viper.GetInt64(keyQueryCacheSize); size > 0 {
+		qs = cache.New(qs, size)
+	}
 	qw, err := graph.NewQuadWriter("single", qs, opts)
 	if err != nil {
 		return nil, err
@@ -260,7 +333,7 @@ func openForQueries(cmd *cobra.Command) (*graph.Handle, error) {
 		typ, _ := cmd.Flags().GetString(flagLoadFormat)
 		// TODO: check read-only flag in config before that?
 		start := time.Now()
-		if err = internal.Load(ctx, qw, quad.DefaultBatch, load, typ); err != nil {
+		if err = loadFile(ctx, cmd, qw, load, typ); err != nil {
 			h.Close()
 			return nil, err
 		}
@@ -29,6 +29,7 @@ func NewHTTPCmd() *cobra.Command {
 
 			err = chttp.SetupRoutes(h, &chttp.Config{
 				Timeout:  viper.GetDuration(keyQueryTimeout),
+				Parallel: viper.GetInt(keyQueryParallel),
 				ReadOnly: viper.GetBool(KeyReadOnly),
 			})
 			if err != nil {
@@ -46,7 +47,11 @@ func NewHTTPCmd() *cobra.Command {
 	cmd.Flags().String("host", "127.0.0.1:64210", "host:port to listen on")
 	cmd.Flags().Bool("init", false, "initialize the database before using it")
 	cmd.Flags().DurationP("timeout", "t", 30*time.Second, "elapsed time until an individual query times out")
+	cmd.Flags().Int("parallel", 0, "number of goroutines used by each query (0 to run queries sequentially)")
+	cmd.Flags().Int64("cache_size", 0, "size of the query result cache in bytes (0 to disable)")
 	registerLoadFlags(cmd)
 	viper.BindPFlag(keyQueryTimeout, cmd.Flags().Lookup("timeout"))
+	viper.BindPFlag(keyQueryParallel, cmd.Flags().Lookup("parallel"))
+	viper.BindPFlag(keyQueryCacheSize, cmd.Flags().Lookup("cache_size"))
 	return cmd
 }
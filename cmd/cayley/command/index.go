@@ -0,0 +1,140 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/kv"
+)
+
+// openKVDatabase opens a database for maintenance commands that are specific to KV backends.
+func openKVDatabase(ctx context.Context) (*kv.QuadStore, error) {
+	name := viper.GetString(KeyBackend)
+	path := viper.GetString(KeyAddress)
+	opts := graph.Options(viper.GetStringMap(KeyOptions))
+	qs, err := graph.NewQuadStore(ctx, name, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	kqs, ok := qs.(*kv.QuadStore)
+	if !ok {
+		qs.Close()
+		return nil, fmt.Errorf("database backend %q is not a key-value store", name)
+	}
+	return kqs, nil
+}
+
+func NewIndexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Manage quad indexes of the database.",
+		Long: `Manage quad indexes of the database.
+
+Indexes are defined by a list of quad directions: "s" - subject, "p" - predicate,
+"o" - object and "c" - label. For example, "po" is an index on predicate and object.`,
+	}
+	cmd.AddCommand(
+		newIndexListCmd(),
+		newIndexAddCmd(),
+		newIndexDropCmd(),
+	)
+	return cmd
+}
+
+func newIndexListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List quad indexes.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			ctx := cmd.Context()
+			qs, err := openKVDatabase(ctx)
+			if err != nil {
+				return err
+			}
+			defer qs.Close()
+			list, err := qs.Indexes(ctx)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			for _, ind := range list {
+				if ind.Building {
+					fmt.Fprintf(out, "%v\tbuilding (%d/%d)\n", ind.QuadIndex, ind.Done, ind.End)
+				} else {
+					fmt.Fprintf(out, "%v\tactive\n", ind.QuadIndex)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func parseIndexArg(args []string) (kv.QuadIndex, error) {
+	if len(args) != 1 {
+		return kv.QuadIndex{}, errors.New("one index must be specified")
+	}
+	return kv.ParseQuadIndex(args[0])
+}
+
+func newIndexAddCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <dirs>",
+		Short: "Add a new quad index and index all existing quads.",
+		Long: `Add a new quad index and index all existing quads.
+
+The backfill can be interrupted; running the command again resumes it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			ind, err := parseIndexArg(args)
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			qs, err := openKVDatabase(ctx)
+			if err != nil {
+				return err
+			}
+			defer qs.Close()
+			start := time.Now()
+			if err = qs.AddIndex(ctx, ind); err != nil {
+				return err
+			}
+			clog.Infof("index %v added in %v", ind, time.Since(start))
+			return nil
+		},
+	}
+}
+
+func newIndexDropCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "drop <dirs>",
+		Short: "Remove a quad index.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			ind, err := parseIndexArg(args)
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			qs, err := openKVDatabase(ctx)
+			if err != nil {
+				return err
+			}
+			defer qs.Close()
+			if err = qs.DropIndex(ctx, ind); err != nil {
+				return err
+			}
+			clog.Infof("index %v removed", ind)
+			return nil
+		},
+	}
+}
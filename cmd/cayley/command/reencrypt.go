@@ -0,0 +1,75 @@
+package command
+
+import (
+	"errors"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/kv"
+	"github.com/aperturerobotics/cayley/kv/crypt"
+)
+
+func NewReencryptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reencrypt",
+		Short: "Re-encrypt the database with a new key.",
+		Long: `Re-encrypt the database with a new key.
+
+The new key is taken from the "encryption_key" or "encryption_key_file"
+database option and the current one from the "encryption_old_key" or
+"encryption_old_key_file" option. After the command completes, the old key
+option can be removed. If the command is interrupted, running it again
+resumes the process.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			opts := graph.Options(viper.GetStringMap(KeyOptions))
+			to, err := kv.CipherFromOptions(opts)
+			if err != nil {
+				return err
+			} else if to == nil {
+				return errors.New("database is not encrypted")
+			}
+			from, err := kv.OldCipherFromOptions(opts)
+			if err != nil {
+				return err
+			} else if from == nil {
+				return errors.New("old encryption key must be specified")
+			}
+			start := time.Now()
+			var n int64
+			if rawFlatBackend() != nil {
+				db, err := openRawFlat()
+				if err != nil {
+					return err
+				}
+				n, err = crypt.ReencryptFlat(cmd.Context(), db, from, to)
+				if cerr := db.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					return err
+				}
+			} else {
+				db, err := openRawKV()
+				if err != nil {
+					return err
+				}
+				n, err = crypt.Reencrypt(cmd.Context(), db, from, to)
+				if cerr := db.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					return err
+				}
+			}
+			clog.Infof("re-encrypted %d pairs in %v", n, time.Since(start))
+			return nil
+		},
+	}
+	return cmd
+}
@@ -14,12 +14,15 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/internal/repl"
 	"github.com/aperturerobotics/cayley/query"
 )
 
 const (
-	keyQueryTimeout = "query.timeout"
+	keyQueryTimeout   = "query.timeout"
+	keyQueryParallel  = "query.parallel"
+	keyQueryCacheSize = "query.cache_size"
 )
 
 func getContext() (context.Context, func()) {
@@ -43,6 +46,10 @@ func registerQueryFlags(cmd *cobra.Command) {
 	cmd.Flags().String("lang", "gizmo", `query language to use ("`+strings.Join(langs, `", "`)+`")`)
 	cmd.Flags().DurationP("timeout", "t", 30*time.Second, "elapsed time until an individual query times out")
 	viper.BindPFlag(keyQueryTimeout, cmd.Flags().Lookup("timeout"))
+	cmd.Flags().Int("parallel", 0, "number of goroutines used by each query (0 to run queries sequentially)")
+	viper.BindPFlag(keyQueryParallel, cmd.Flags().Lookup("parallel"))
+	cmd.Flags().Int64("cache_size", 0, "size of the query result cache in bytes (0 to disable)")
+	viper.BindPFlag(keyQueryCacheSize, cmd.Flags().Lookup("cache_size"))
 	registerLoadFlags(cmd)
 }
 
@@ -63,6 +70,7 @@ func NewReplCmd() *cobra.Command {
 
 			ctx, cancel := getContext()
 			defer cancel()
+			ctx = iterator.WithParallel(ctx, viper.GetInt(keyQueryParallel))
 
 			timeout := viper.GetDuration("timeout")
 			lang, _ := cmd.Flags().GetString("lang")
@@ -104,6 +112,7 @@ func NewQueryCmd() *cobra.Command {
 
 			ctx, cancel := getContext()
 			defer cancel()
+			ctx = iterator.WithParallel(ctx, viper.GetInt(keyQueryParallel))
 
 			timeout := viper.GetDuration("timeout")
 			if timeout > 0 {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,8 +14,9 @@ import (
 
 	// Load all supported quad formats.
 	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/csv"
 	_ "github.com/aperturerobotics/cayley/quad/jsonld"
-	_ "github.com/aperturerobotics/cayley/quad/nquads"
+	"github.com/aperturerobotics/cayley/quad/nquads"
 
 	"github.com/spf13/cobra"
 )
@@ -24,7 +26,7 @@ const defaultFormat = "jsonld"
 // NewCmd creates the command
 func NewCmd() *cobra.Command {
 	var quiet bool
-	var uri, formatName string
+	var uri, formatName, mappingPath string
 
 	cmd := &cobra.Command{
 		Use:   "cayleyimport <file>",
@@ -63,6 +65,24 @@ func NewCmd() *cobra.Command {
 			if format == nil {
 				format = quad.FormatByName(defaultFormat)
 			}
+			if mappingPath != "" {
+				m, err := csv.LoadMapping(mappingPath)
+				if err != nil {
+					return err
+				}
+				var qr quad.ReadCloser
+				switch format.Name {
+				case "csv":
+					qr = csv.NewReader(reader, m)
+				case "tsv":
+					qr = csv.NewTSVReader(reader, m)
+				default:
+					return fmt.Errorf("mapping is not supported for %q format", format.Name)
+				}
+				// tables are converted to quads locally, since the server has no access to the mapping
+				reader = convert(cmd.Context(), qr)
+				format = quad.FormatByName("nquads")
+			}
 			r, err := http.Post(uri+"/api/v2/write", format.Mime[0], reader)
 			if err != nil {
 				return err
@@ -95,6 +115,7 @@ func NewCmd() *cobra.Command {
 
 	cmd.Flags().StringVarP(&uri, "uri", "", "http://127.0.0.1:64210", "Cayley URI connection string")
 	cmd.Flags().StringVarP(&formatName, "format", "", "", "format of the provided data (if can not be detected defaults to JSON-LD)")
+	cmd.Flags().StringVarP(&mappingPath, "mapping", "", "", "JSON file with a mapping of table columns to quads, for importing CSV and TSV files")
 	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "hide all log output")
 	return cmd
 }
@@ -118,3 +139,18 @@ func formatByFileName(fileName string) *quad.Format {
 	ext := filepath.Ext(fileName)
 	return quad.FormatByExt(ext)
 }
+
+// convert encodes quads in N-Quads format as they are read.
+func convert(ctx context.Context, qr quad.ReadCloser) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		defer qr.Close()
+		qw := nquads.NewWriter(pw)
+		_, err := quad.Copy(ctx, qw, qr)
+		if err == nil {
+			err = qw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"path"
+	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
@@ -15,6 +18,7 @@ import (
 	"github.com/aperturerobotics/cayley/graph/memstore"
 	chttp "github.com/aperturerobotics/cayley/internal/http"
 	"github.com/aperturerobotics/cayley/quad"
+	cayleyhttp "github.com/aperturerobotics/cayley/server/http"
 	"github.com/stretchr/testify/require"
 )
 
@@ -80,3 +84,42 @@ func TestCayleyImport(t *testing.T) {
 	})
 	require.Equal(t, expectData, allq)
 }
+
+func TestCayleyImportMapping(t *testing.T) {
+	qs := memstore.New()
+	qw, err := graph.NewQuadWriter("single", qs, graph.Options{})
+	require.NoError(t, err)
+	srv := httptest.NewServer(cayleyhttp.NewAPIv2(&graph.Handle{QuadStore: qs, QuadWriter: qw}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "people.tsv")
+	require.NoError(t, os.WriteFile(data, []byte("id\tname\tknows\nalice\tAlice\tbob\nbob\tBob\talice\n"), 0644))
+	mapping := filepath.Join(dir, "mapping.json")
+	require.NoError(t, os.WriteFile(mapping, []byte(`{
+		"prefixes": {"foaf": "http://xmlns.com/foaf/0.1/"},
+		"subject": "http://example.com/{id}",
+		"class": ["foaf:Person"],
+		"columns": [
+			{"template": "http://example.com/{knows}", "predicate": "foaf:knows"},
+			{"column": "name", "predicate": "foaf:name"}
+		]
+	}`), 0644))
+
+	cmd := NewCmd()
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{
+		data,
+		"--mapping", mapping,
+		"--uri", srv.URL,
+		"--quiet",
+	})
+	require.NoError(t, cmd.Execute())
+
+	allq := allQuads(t, qs)
+	slices.SortFunc(allq, func(a, b quad.Quad) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	require.Equal(t, expectData, allq)
+}
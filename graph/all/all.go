@@ -4,6 +4,7 @@ import (
 	// supported backends
 	_ "github.com/aperturerobotics/cayley/graph/kv/all"
 	_ "github.com/aperturerobotics/cayley/graph/memstore"
+	_ "github.com/aperturerobotics/cayley/graph/remote"
 	_ "github.com/aperturerobotics/cayley/graph/sql/cockroach"
 	_ "github.com/aperturerobotics/cayley/graph/sql/mysql"
 	_ "github.com/aperturerobotics/cayley/graph/sql/postgres"
@@ -0,0 +1,410 @@
+// Package cache implements a quad store wrapper that caches results of queries.
+package cache
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/internal/lru"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+// DefaultSize is the default size of the cache in bytes.
+const DefaultSize = 64 << 20
+
+var (
+	_ graph.Wrapper     = (*QuadStore)(nil)
+	_ shape.ResultCache = (*QuadStore)(nil)
+)
+
+// Metrics are counters of the result cache.
+type Metrics struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"` // number of writes that cleared the cache
+	Entries       int   `json:"entries"`
+	Bytes         int64 `json:"bytes"` // approximate size of cached results
+}
+
+// QuadStore wraps a quad store and caches results of queries executed on it.
+//
+// Results are keyed by the optimized query shape and are cached only if the query was read to the end.
+// The cache is cleared each time changes are written through the wrapper. Changes written to the
+// underlying quad store directly are not visible in cached results.
+//
+// Optional interfaces of the underlying quad store, such as graph.Watcher, are not implemented by the wrapper.
+// Callers that check for them should look them up through graph.UnwrapAll.
+type QuadStore struct {
+	graph.QuadStore
+
+	maxBytes int64
+	lru      *lru.Cache
+	version  atomic.Uint64 // incremented before and after each write
+
+	hits, misses, invalidations atomic.Int64
+}
+
+// New wraps a quad store with a cache that keeps at most maxBytes of results.
+// If maxBytes is not positive, DefaultSize is used.
+func New(qs graph.QuadStore, maxBytes int64) *QuadStore {
+	if maxBytes <= 0 {
+		maxBytes = DefaultSize
+	}
+	return &QuadStore{QuadStore: qs, maxBytes: maxBytes, lru: lru.NewSized(maxBytes)}
+}
+
+// Of returns a result cache in a chain of quad store wrappers, or nil if there is none.
+func Of(qs graph.QuadStore) *QuadStore {
+	for {
+		switch w := qs.(type) {
+		case *QuadStore:
+			return w
+		case *graph.Handle:
+			qs = w.QuadStore
+		case graph.Wrapper:
+			qs = w.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// Unwrap implements graph.Wrapper.
+func (qs *QuadStore) Unwrap() graph.QuadStore {
+	return qs.QuadStore
+}
+
+// Metrics returns current counters of the cache.
+func (qs *QuadStore) Metrics() Metrics {
+	return Metrics{
+		Hits:          qs.hits.Load(),
+		Misses:        qs.misses.Load(),
+		Invalidations: qs.invalidations.Load(),
+		Entries:       qs.lru.Len(),
+		Bytes:         qs.lru.Size(),
+	}
+}
+
+// write runs a function that changes the underlying quad store. Results that are read concurrently
+// with the write are not cached, since they may reflect only a part of the changes.
+func (qs *QuadStore) write(fnc func() error) error {
+	qs.version.Add(1)
+	defer func() {
+		qs.version.Add(1)
+		qs.lru.Purge()
+		qs.invalidations.Add(1)
+	}()
+	return fnc()
+}
+
+func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, opts graph.IgnoreOpts) error {
+	return qs.write(func() error {
+		return qs.QuadStore.ApplyDeltas(ctx, in, opts)
+	})
+}
+
+func (qs *QuadStore) NewQuadWriter(ctx context.Context) (quad.WriteCloser, error) {
+	w, err := qs.QuadStore.NewQuadWriter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &quadWriter{qs: qs, w: w}, nil
+}
+
+func (qs *QuadStore) Close() error {
+	qs.lru.Purge()
+	return qs.QuadStore.Close()
+}
+
+// CachedIterator implements shape.ResultCache.
+func (qs *QuadStore) CachedIterator(ctx context.Context, key string, build func() iterator.Shape) iterator.Shape {
+	return &cachedShape{qs: qs, key: key, build: build}
+}
+
+func cacheKey(ver uint64, key string) string {
+	return strconv.FormatUint(ver, 10) + ":" + key
+}
+
+func (qs *QuadStore) get(ver uint64, key string) ([]row, bool) {
+	v, ok := qs.lru.Get(cacheKey(ver, key))
+	if !ok {
+		qs.misses.Add(1)
+		return nil, false
+	}
+	qs.hits.Add(1)
+	return v.([]row), true
+}
+
+// peek checks if results are cached, without counting a hit or a miss.
+func (qs *QuadStore) peek(key string) ([]row, bool) {
+	v, ok := qs.lru.Get(cacheKey(qs.version.Load(), key))
+	if !ok {
+		return nil, false
+	}
+	return v.([]row), true
+}
+
+func (qs *QuadStore) put(ver uint64, key string, rows []row, size int64) {
+	if qs.version.Load() != ver {
+		return // the quad store was changed while reading results
+	}
+	qs.lru.PutSized(cacheKey(ver, key), rows, size)
+}
+
+type quadWriter struct {
+	qs *QuadStore
+	w  quad.WriteCloser
+}
+
+func (w *quadWriter) WriteQuad(ctx context.Context, q quad.Quad) error {
+	return w.qs.write(func() error {
+		return w.w.WriteQuad(ctx, q)
+	})
+}
+
+func (w *quadWriter) WriteQuads(ctx context.Context, buf []quad.Quad) (n int, err error) {
+	err = w.qs.write(func() error {
+		n, err = w.w.WriteQuads(ctx, buf)
+		return err
+	})
+	return n, err
+}
+
+func (w *quadWriter) Close() error {
+	// the writer may flush buffered quads on close
+	return w.qs.write(w.w.Close)
+}
+
+// row is a single cached result. Sub-paths of a result follow it with path set to true.
+type row struct {
+	ref  refs.Ref
+	tags map[string]refs.Ref
+	path bool
+}
+
+const (
+	rowSize = 64 // approximate memory overhead of a single result
+	tagSize = 48 // approximate memory overhead of a single tag
+)
+
+func sizeOf(r row) int64 {
+	size := int64(rowSize)
+	if v, ok := r.ref.(refs.PreFetchedValue); ok && v.NameOf() != nil {
+		size += int64(len(v.NameOf().String()))
+	}
+	for k := range r.tags {
+		size += tagSize + int64(len(k))
+	}
+	return size
+}
+
+// cachedShape is an iterator tree that reads results from the cache, or builds an iterator
+// on the underlying quad store and saves its results to the cache.
+type cachedShape struct {
+	qs    *QuadStore
+	key   string
+	build func() iterator.Shape
+	it    iterator.Shape
+
+	optimize bool // optimization was skipped, since results were cached
+}
+
+func (s *cachedShape) built() iterator.Shape {
+	if s.it == nil {
+		s.it = s.build()
+	}
+	return s.it
+}
+
+func (s *cachedShape) String() string {
+	return "Cached"
+}
+
+func (s *cachedShape) Iterate(ctx context.Context) iterator.Scanner {
+	ver := s.qs.version.Load()
+	if rows, ok := s.qs.get(ver, s.key); ok {
+		return &cachedNext{rows: rows, i: -1}
+	}
+	if s.optimize {
+		s.optimize = false
+		if optim, opt, err := s.built().Optimize(ctx); err == nil && opt {
+			s.it = optim
+		}
+	}
+	return &recordNext{qs: s.qs, key: s.key, ver: ver, sc: s.built().Iterate(ctx)}
+}
+
+func (s *cachedShape) Lookup(ctx context.Context) iterator.Index {
+	return s.built().Lookup(ctx)
+}
+
+func (s *cachedShape) Stats(ctx context.Context) (iterator.Costs, error) {
+	if rows, ok := s.qs.peek(s.key); ok && s.it == nil {
+		var n int64
+		for _, r := range rows {
+			if !r.path {
+				n++
+			}
+		}
+		return iterator.Costs{
+			NextCost:     1,
+			ContainsCost: n,
+			Size:         refs.Size{Value: n, Exact: true},
+		}, nil
+	}
+	return s.built().Stats(ctx)
+}
+
+func (s *cachedShape) Optimize(ctx context.Context) (iterator.Shape, bool, error) {
+	if _, ok := s.qs.peek(s.key); ok && s.it == nil {
+		// the iterator tree will be built and optimized only if results are evicted before the iteration
+		s.optimize = true
+		return s, false, nil
+	}
+	optim, opt, err := s.built().Optimize(ctx)
+	if err != nil {
+		return s, false, err
+	} else if opt {
+		s.it = optim
+	}
+	return s, false, nil
+}
+
+func (s *cachedShape) SubIterators() []iterator.Shape {
+	return []iterator.Shape{s.built()}
+}
+
+// cachedNext replays cached results.
+type cachedNext struct {
+	rows []row
+	i    int
+}
+
+func (it *cachedNext) Next(ctx context.Context) bool {
+	for it.i++; it.i < len(it.rows); it.i++ {
+		if !it.rows[it.i].path {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *cachedNext) NextPath(ctx context.Context) bool {
+	if it.i+1 < len(it.rows) && it.rows[it.i+1].path {
+		it.i++
+		return true
+	}
+	return false
+}
+
+func (it *cachedNext) Result(ctx context.Context) (refs.Ref, error) {
+	if it.i < 0 || it.i >= len(it.rows) {
+		return nil, nil
+	}
+	return it.rows[it.i].ref, nil
+}
+
+func (it *cachedNext) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	if it.i >= 0 && it.i < len(it.rows) {
+		maps.Copy(dst, it.rows[it.i].tags)
+	}
+	return nil
+}
+
+func (it *cachedNext) Err() error {
+	return nil
+}
+
+func (it *cachedNext) Close() error {
+	return nil
+}
+
+func (it *cachedNext) String() string {
+	return "CachedNext"
+}
+
+// recordNext reads results from the underlying iterator and saves them to the cache,
+// if the iterator is read to the end.
+type recordNext struct {
+	qs  *QuadStore
+	key string
+	ver uint64
+	sc  iterator.Scanner
+
+	rows []row
+	size int64
+	skip bool // results won't be cached
+	cur  bool // the current result may have more sub-paths
+	done bool
+}
+
+func (it *recordNext) record(ctx context.Context, path bool) {
+	if it.skip {
+		return
+	}
+	r := row{path: path, tags: make(map[string]refs.Ref)}
+	var err error
+	if r.ref, err = it.sc.Result(ctx); err == nil {
+		err = it.sc.TagResults(ctx, r.tags)
+	}
+	if it.size += sizeOf(r); err != nil || it.size > it.qs.maxBytes {
+		it.skip, it.rows = true, nil
+		return
+	}
+	it.rows = append(it.rows, r)
+}
+
+func (it *recordNext) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	// sub-paths are cached even if the caller doesn't read them
+	for it.cur && !it.skip && it.sc.NextPath(ctx) {
+		it.record(ctx, true)
+	}
+	it.cur = it.sc.Next(ctx)
+	if !it.cur {
+		it.done = true
+		if !it.skip && it.sc.Err() == nil {
+			it.qs.put(it.ver, it.key, it.rows, it.size)
+		}
+		return false
+	}
+	it.record(ctx, false)
+	return true
+}
+
+func (it *recordNext) NextPath(ctx context.Context) bool {
+	if !it.cur || !it.sc.NextPath(ctx) {
+		it.cur = false
+		return false
+	}
+	it.record(ctx, true)
+	return true
+}
+
+func (it *recordNext) Result(ctx context.Context) (refs.Ref, error) {
+	return it.sc.Result(ctx)
+}
+
+func (it *recordNext) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	return it.sc.TagResults(ctx, dst)
+}
+
+func (it *recordNext) Err() error {
+	return it.sc.Err()
+}
+
+func (it *recordNext) Close() error {
+	return it.sc.Close()
+}
+
+func (it *recordNext) String() string {
+	return "CachedRecord"
+}
@@ -0,0 +1,74 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/cache"
+	"github.com/aperturerobotics/cayley/graph/graphtest"
+	"github.com/aperturerobotics/cayley/graph/memstore"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/path"
+	"github.com/aperturerobotics/cayley/writer"
+)
+
+func TestCache(t *testing.T) {
+	graphtest.TestAll(t, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		return cache.New(memstore.New(), 0), nil, func() {}
+	}, &graphtest.Config{
+		AlwaysRunIntegration: true,
+	})
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	qs := cache.New(memstore.New(), 0)
+	qw, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("alice", "follows", "bob", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("bob", "follows", "charlie", "")))
+
+	follows := func() []quad.Value {
+		p := path.StartPath(qs, quad.IRI("alice"), quad.IRI("bob")).Out(quad.IRI("follows"))
+		vals, err := p.Iterate(ctx).AllValues(ctx, qs)
+		require.NoError(t, err)
+		return vals
+	}
+	exp := []quad.Value{quad.IRI("bob"), quad.IRI("charlie")}
+	require.ElementsMatch(t, exp, follows())
+	require.ElementsMatch(t, exp, follows())
+	m := qs.Metrics()
+	require.Equal(t, int64(1), m.Hits)
+	require.Equal(t, int64(1), m.Misses)
+	require.Equal(t, 1, m.Entries)
+	require.NotZero(t, m.Bytes)
+
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("alice", "follows", "dani", "")))
+	require.Zero(t, qs.Metrics().Entries)
+	require.ElementsMatch(t, append(exp, quad.IRI("dani")), follows())
+	m = qs.Metrics()
+	require.Equal(t, int64(1), m.Hits)
+	require.Equal(t, int64(2), m.Misses)
+	require.Equal(t, int64(3), m.Invalidations)
+
+	// partially read results are not cached
+	p := path.StartPath(qs, quad.IRI("alice")).Out(quad.IRI("follows"))
+	it := p.BuildIterator(ctx).Iterate(ctx)
+	require.True(t, it.Next(ctx))
+	require.NoError(t, it.Close())
+	require.Equal(t, 1, qs.Metrics().Entries)
+	_, err = p.Iterate(ctx).AllValues(ctx, qs)
+	require.NoError(t, err)
+	require.Equal(t, 2, qs.Metrics().Entries)
+
+	// equivalent queries share results
+	hits := qs.Metrics().Hits
+	p = path.StartPath(qs).Is(quad.IRI("alice")).Out(quad.IRI("follows"))
+	vals, err := p.Iterate(ctx).AllValues(ctx, qs)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []quad.Value{quad.IRI("bob"), quad.IRI("dani")}, vals)
+	require.Equal(t, hits+1, qs.Metrics().Hits)
+}
@@ -2,6 +2,7 @@ package graphtest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sort"
@@ -52,6 +53,7 @@ var graphTests = []struct {
 	{"set iterator", TestSetIterator},
 	{"deleted from iterator", TestDeletedFromIterator},
 	{"load typed quad", TestLoadTypedQuads},
+	{"load quoted quad", TestLoadQuotedQuads},
 	{"add and remove", TestAddRemove},
 	{"node delete", TestNodeDelete},
 	{"iterators and next result order", TestIteratorsAndNextResultOrderA},
@@ -59,6 +61,7 @@ var graphTests = []struct {
 	{"schema", TestSchema},
 	{"delete reinserted", TestDeleteReinserted},
 	{"delete reinserted dup", TestDeleteReinsertedDup},
+	{"watch", TestWatch},
 }
 
 func TestAll(t *testing.T, gen testutil.DatabaseFunc, conf *Config) {
@@ -909,6 +912,53 @@ func TestLoadTypedQuads(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
 	require.Equal(t, exp, st, "Unexpected quadstore size")
 }
 
+// TestLoadQuotedQuads checks that quoted triples are stored as values, and are not asserted.
+func TestLoadQuotedQuads(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
+	qs, opts, closer := gen(t)
+	defer closer()
+
+	w := testutil.MakeWriter(t, qs, opts)
+
+	claim := quad.Quoted{Subject: quad.IRI("bob"), Predicate: quad.IRI("age"), Object: quad.Int(23)}
+	nested := quad.Quoted{Subject: quad.BNode("x"), Predicate: quad.IRI("says"), Object: claim}
+	lang := quad.Quoted{Subject: quad.IRI("bob"), Predicate: quad.IRI("name"), Object: quad.LangString{Value: "Bob", Lang: "en"}}
+
+	ctx := context.Background()
+	err := w.AddQuadSet(ctx, []quad.Quad{
+		{claim, quad.IRI("source"), quad.IRI("census"), nil},
+		{claim, quad.IRI("certainty"), quad.Float(0.8), nil},
+		{quad.IRI("alice"), quad.IRI("doubts"), nested, nil},
+		{lang, quad.IRI("source"), quad.IRI("census"), quad.IRI("graph")},
+	})
+	require.NoError(t, err)
+	for _, pq := range []quad.Quoted{claim, nested, lang} {
+		qsv, err := qs.ValueOf(ctx, pq)
+		require.NoError(t, err)
+		require.NotNil(t, qsv, "Failed to find %v", pq)
+		got, err := qs.NameOf(ctx, qsv)
+		require.NoError(t, err)
+		if conf.UnTyped {
+			assert.Equal(t, quad.StringOf(pq), quad.StringOf(got), "Failed to roundtrip raw %q (%T)", pq, pq)
+			continue
+		}
+		assert.True(t, pq.Equal(got), "Failed to roundtrip %q, got %q (%T)", pq, got, got)
+		gotv, err := qs.ValueOf(ctx, got)
+		require.NoError(t, err)
+		got2, err := qs.NameOf(ctx, gotv)
+		require.NoError(t, err)
+		assert.Equal(t, got, got2, "Failed to use returned value to get it again")
+	}
+
+	// components of quoted triples are not stored as nodes
+	exp := graph.Stats{
+		Nodes: refs.Size{Value: 10, Exact: true},
+		Quads: refs.Size{Value: 4, Exact: true},
+	}
+	st, err := qs.Stats(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, exp, st, "Unexpected quadstore size")
+}
+
 // TestAddRemove tests add and remove
 // TODO(dennwc): add tests to verify that QS behaves in a right way with IgnoreOptions,
 // returns ErrQuadExists, ErrQuadNotExists is doing rollback.
@@ -1339,6 +1389,68 @@ func TestDeleteReinsertedDup(t testing.TB, gen testutil.DatabaseFunc, _ *Config)
 	}
 }
 
+func TestWatch(t testing.TB, gen testutil.DatabaseFunc, _ *Config) {
+	qs, _, closer := gen(t)
+	defer closer()
+
+	wr, ok := qs.(graph.Watcher)
+	if !ok {
+		t.SkipNow()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	feed, err := wr.Watch(ctx, "")
+	require.NoError(t, err)
+	defer feed.Close()
+
+	// reads changes until the expected number of deltas is received
+	read := func(feed graph.DeltaFeed, n int) ([]graph.Delta, string) {
+		var (
+			got    []graph.Delta
+			cursor string
+		)
+		for len(got) < n && feed.Next(ctx) {
+			b := feed.Batch()
+			require.NotEmpty(t, b.Deltas)
+			got = append(got, b.Deltas...)
+			cursor = b.Cursor
+		}
+		require.NoError(t, feed.Err())
+		return got, cursor
+	}
+
+	q1 := quad.MakeIRI("bob", "follows", "sally", "")
+	q2 := quad.MakeIRI("sally", "follows", "jim", "")
+	adds := []graph.Delta{
+		{Quad: q1, Action: graph.Add},
+		{Quad: q2, Action: graph.Add},
+	}
+	err = qs.ApplyDeltas(ctx, adds, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	got, cursor := read(feed, len(adds))
+	require.Equal(t, adds, got)
+
+	dels := []graph.Delta{
+		{Quad: q1, Action: graph.Delete},
+	}
+	err = qs.ApplyDeltas(ctx, dels, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	got, last := read(feed, len(dels))
+	require.Equal(t, dels, got)
+
+	// resume from the cursor of the first change
+	feed2, err := wr.Watch(ctx, cursor)
+	require.NoError(t, err)
+	defer feed2.Close()
+	got, cursor = read(feed2, len(dels))
+	require.Equal(t, dels, got)
+	require.Equal(t, last, cursor)
+
+	_, err = wr.Watch(ctx, "not a cursor")
+	require.True(t, errors.Is(err, graph.ErrInvalidCursor), "%v", err)
+}
+
 func irif(format string, args ...any) quad.IRI {
 	return quad.IRI(fmt.Sprintf(format, args...))
 }
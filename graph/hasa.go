@@ -63,11 +63,11 @@ func NewHasA(qs QuadIndexer, subIt iterator.Shape, d quad.Direction) *HasA {
 }
 
 func (it *HasA) Iterate(ctx context.Context) iterator.Scanner {
-	return newHasANext(it.qs, it.primary.Iterate(ctx), it.dir)
+	return newHasANext(it.qs, iterator.Scan(ctx, it.primary), it.dir)
 }
 
 func (it *HasA) Lookup(ctx context.Context) iterator.Index {
-	return newHasAContains(it.qs, it.primary.Lookup(ctx), it.dir)
+	return newHasAContains(it.qs, iterator.Lookup(ctx, it.primary), it.dir)
 }
 
 // SubIterators returns our sole subiterator.
@@ -112,16 +112,79 @@ func (it *HasA) Stats(ctx context.Context) (iterator.Costs, error) {
 	fanoutFactor := int64(30)
 	nextConstant := int64(2)
 	quadConstant := int64(1)
+	size := refs.Size{
+		Value: faninFactor * subitStats.Size.Value,
+		Exact: false,
+	}
+	if st, only, ok := it.predicateStats(ctx); ok {
+		// quads are limited to a few predicates with a known number of distinct values in our direction
+		nodes := st.Subjects
+		if it.dir == quad.Object {
+			nodes = st.Objects
+		}
+		if only {
+			// a node is returned for each quad, thus repeated nodes are counted
+			size = refs.Size{Value: st.Quads, Exact: true}
+		} else if nodes < size.Value {
+			size = refs.Size{Value: nodes, Exact: nodes == 0}
+		}
+		if nodes > 0 {
+			fanoutFactor = max(1, (st.Quads+nodes-1)/nodes)
+		}
+	} else if h := HistogramOf(ctx, it.qs, it.dir); h != nil {
+		// quads cannot reference more nodes than there are in this direction
+		if h.Distinct < size.Value {
+			size.Value = h.Distinct
+		}
+		fanoutFactor = h.Fanout()
+	}
 	return iterator.Costs{
 		NextCost:     quadConstant + subitStats.NextCost,
 		ContainsCost: (fanoutFactor * nextConstant) * subitStats.ContainsCost,
-		Size: refs.Size{
-			Value: faninFactor * subitStats.Size.Value,
-			Exact: false,
-		},
+		Size:         size,
 	}, err
 }
 
+// predicateStats returns statistics of predicates the quads are constrained to, if the quad store keeps them.
+// Only subjects and objects are counted, thus other directions are ignored.
+//
+// The only flag is set if the subiterator matches all quads with a single predicate, thus the statistics are exact.
+func (it *HasA) predicateStats(ctx context.Context) (_ PredicateStat, only bool, _ bool) {
+	if it.dir != quad.Subject && it.dir != quad.Object {
+		return PredicateStat{}, false, false
+	}
+	preds := fixedPredicates(it.primary)
+	if preds == nil {
+		if and, ok := it.primary.(*iterator.And); ok {
+			for _, sub := range and.Required() {
+				if preds = fixedPredicates(sub); preds != nil {
+					break
+				}
+			}
+		}
+	} else {
+		only = len(preds) == 1
+	}
+	if preds == nil {
+		return PredicateStat{}, false, false
+	}
+	st, ok := PredicateStatsOf(ctx, it.qs, preds)
+	return st, only && ok, ok
+}
+
+// fixedPredicates returns predicates if the iterator matches quads with a fixed set of predicates.
+func fixedPredicates(it iterator.Shape) []Ref {
+	lt, ok := it.(*LinksTo)
+	if !ok || lt.dir != quad.Predicate {
+		return nil
+	}
+	fixed, ok := lt.primary.(*iterator.Fixed)
+	if !ok {
+		return nil
+	}
+	return fixed.Values()
+}
+
 // A HasA consists of a reference back to the graph.QuadStore that it references,
 // a primary subiterator, a direction in which the quads for that subiterator point,
 // and a temporary holder for the iterator generated on Contains().
@@ -23,6 +23,8 @@ import (
 
 	"github.com/aperturerobotics/cayley/graph"
 	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/memstore"
+	"github.com/aperturerobotics/cayley/graph/refs"
 	"github.com/aperturerobotics/cayley/quad"
 )
 
@@ -37,3 +39,37 @@ func TestHasAIteratorErr(t *testing.T) {
 	require.False(t, hasa.Next(ctx), "HasA iterator did not pass through initial 'false'")
 	require.Equal(t, wantErr, hasa.Err(), "HasA iterator did not pass through underlying Err")
 }
+
+func TestHasACountWithPredicateStats(t *testing.T) {
+	ctx := context.Background()
+	follows := quad.IRI("follows")
+	qs := memstore.New(
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("c", "follows", "b", ""),
+		quad.MakeIRI("d", "follows", "b", ""),
+		quad.MakeIRI("b", "likes", "a", ""),
+	)
+	pred, err := qs.ValueOf(ctx, follows)
+	require.NoError(t, err)
+	newIt := func() iterator.Shape {
+		return graph.NewHasA(qs, graph.NewLinksTo(qs, iterator.NewFixed(pred), quad.Predicate), quad.Object)
+	}
+
+	// a node is returned for each quad, even if it repeats
+	st, err := newIt().Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, refs.Size{Value: 3, Exact: true}, st.Size)
+
+	n, err := iterator.Iterate(newIt()).Count(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+
+	sc := iterator.NewCount(newIt(), qs).Iterate(ctx)
+	defer sc.Close()
+	require.True(t, sc.Next(ctx))
+	ref, err := sc.Result(ctx)
+	require.NoError(t, err)
+	v, err := qs.NameOf(ctx, ref)
+	require.NoError(t, err)
+	require.Equal(t, quad.Int(3), v)
+}
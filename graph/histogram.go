@@ -0,0 +1,186 @@
+package graph
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// Frequency is the number of quads that reference a node in a specific direction.
+type Frequency struct {
+	Node  Ref
+	Quads int64
+}
+
+// Histogram describes a distribution of nodes in a single direction of quads.
+//
+// Histograms are usually built from a sample of quads, thus all the values are estimates.
+type Histogram struct {
+	Quads    int64       // number of quads with a node in this direction
+	Distinct int64       // number of distinct nodes
+	Top      []Frequency // the most frequent nodes, in descending order of frequency
+}
+
+// Fanout returns the average number of quads that reference the same node.
+func (h *Histogram) Fanout() int64 {
+	if h.Distinct <= 0 {
+		return 1
+	}
+	return max(1, (h.Quads+h.Distinct-1)/h.Distinct)
+}
+
+// Frequency returns the estimated number of quads that reference a node.
+func (h *Histogram) Frequency(ref Ref) int64 {
+	k := refs.ToKey(ref)
+	for _, f := range h.Top {
+		if refs.ToKey(f.Node) == k {
+			return f.Quads
+		}
+	}
+	return h.tailFrequency()
+}
+
+// tailFrequency returns the average frequency of nodes that are not in Top.
+func (h *Histogram) tailFrequency() int64 {
+	quads, distinct := h.Quads, h.Distinct-int64(len(h.Top))
+	for _, f := range h.Top {
+		quads -= f.Quads
+	}
+	if distinct <= 0 || quads <= 0 {
+		return 1
+	}
+	return max(1, (quads+distinct-1)/distinct)
+}
+
+// Histograms is an optional interface for quad stores that provide distributions of node frequencies.
+//
+// Query optimizer uses histograms to estimate sizes of iterators and to choose the order of joins.
+type Histograms interface {
+	// Histogram returns a histogram of nodes in a given direction.
+	// It returns nil if the histogram is not available.
+	Histogram(ctx context.Context, d quad.Direction) (*Histogram, error)
+}
+
+// HistogramOf returns a histogram of nodes in a given direction, or nil if the quad store doesn't provide it.
+func HistogramOf(ctx context.Context, qs QuadIndexer, d quad.Direction) *Histogram {
+	hs, ok := qs.(Histograms)
+	if !ok {
+		return nil
+	}
+	h, err := hs.Histogram(ctx, d)
+	if err != nil {
+		return nil
+	}
+	return h
+}
+
+// NewHistogram builds a histogram from a uniform sample of nodes referenced by quads in a single direction.
+// Quads is the total number of quads in the store; nil nodes in the sample are counted as quads without a node.
+// At most top of the most frequent nodes are kept in the histogram.
+//
+// The number of distinct nodes is estimated with GEE estimator (Charikar et al., 2000).
+func NewHistogram(quads int64, sample []Ref, top int) *Histogram {
+	type counter struct {
+		ref Ref
+		n   int64
+	}
+	var (
+		counts = make(map[any]*counter)
+		nodes  int64
+	)
+	for _, ref := range sample {
+		if ref == nil {
+			continue
+		}
+		nodes++
+		k := refs.ToKey(ref)
+		if c := counts[k]; c != nil {
+			c.n++
+		} else {
+			counts[k] = &counter{ref: ref, n: 1}
+		}
+	}
+	if len(sample) == 0 || nodes == 0 {
+		return &Histogram{}
+	}
+	scale := float64(quads) / float64(len(sample))
+	if scale < 1 {
+		scale = 1
+	}
+	h := &Histogram{Quads: int64(math.Round(float64(nodes) * scale))}
+	// number of nodes seen exactly once, and the number of other distinct nodes
+	var once, other int64
+	arr := make([]*counter, 0, len(counts))
+	for _, c := range counts {
+		if c.n == 1 {
+			once++
+		} else {
+			other++
+			// a single occurrence in the sample tells nothing about the frequency
+			arr = append(arr, c)
+		}
+	}
+	h.Distinct = int64(math.Round(math.Sqrt(scale)*float64(once))) + other
+	h.Distinct = min(max(h.Distinct, int64(len(counts))), h.Quads)
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].n > arr[j].n
+	})
+	if len(arr) > top {
+		arr = arr[:top]
+	}
+	for _, c := range arr {
+		h.Top = append(h.Top, Frequency{Node: c.ref, Quads: int64(math.Round(float64(c.n) * scale))})
+	}
+	return h
+}
+
+// HistogramCostModel estimates sizes of intersections of nodes in a single direction using the histogram of it.
+//
+// Unlike iterator.UniformCostModel, it accounts for the skew of the distribution: shapes are assumed to pick nodes
+// with a probability proportional to the number of quads that reference them. Thus, the most frequent nodes (Top)
+// are likely to be in the results of all shapes, and intersections are larger than with a uniform distribution.
+type HistogramCostModel struct {
+	Hist *Histogram
+}
+
+// JoinSize implements iterator.CostModel.
+func (m HistogramCostModel) JoinSize(ctx context.Context, costs []iterator.Costs) float64 {
+	h := m.Hist
+	if h == nil || h.Quads <= 0 || h.Distinct <= 0 {
+		return iterator.UniformCostModel{}.JoinSize(ctx, costs)
+	}
+	if len(costs) == 0 {
+		return 0
+	}
+	// probability of each of the most frequent nodes to be in results of all shapes
+	top := make([]float64, len(h.Top))
+	for i := range top {
+		top[i] = 1
+	}
+	tail := float64(h.Distinct - int64(len(h.Top)))
+	tailProb := 1.0
+	for _, c := range costs {
+		size := float64(min(c.Size.Value, h.Distinct))
+		picked := 0.0
+		for i, f := range h.Top {
+			p := min(1, size*float64(f.Quads)/float64(h.Quads))
+			top[i] *= p
+			picked += p
+		}
+		if tail > 0 {
+			tailProb *= min(1, max(0, size-picked)/tail)
+		}
+	}
+	size := 0.0
+	for _, p := range top {
+		size += p
+	}
+	if tail > 0 {
+		size += tail * tailProb
+	}
+	return size
+}
@@ -0,0 +1,69 @@
+package graph_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+func TestNewHistogram(t *testing.T) {
+	node := func(i int) graph.Ref {
+		return refs.PreFetched(quad.Int(i))
+	}
+	var sample []graph.Ref
+	for range 20 {
+		sample = append(sample, node(-1))
+	}
+	for range 10 {
+		sample = append(sample, node(-2))
+	}
+	for i := range 60 {
+		sample = append(sample, node(i))
+	}
+	// quads without a node in this direction
+	for range 10 {
+		sample = append(sample, nil)
+	}
+	h := graph.NewHistogram(1000, sample, 1)
+	require.Equal(t, &graph.Histogram{
+		Quads:    900,
+		Distinct: 192,
+		Top:      []graph.Frequency{{Node: node(-1), Quads: 200}},
+	}, h)
+	require.Equal(t, int64(5), h.Fanout())
+	require.Equal(t, int64(200), h.Frequency(node(-1)))
+	require.Equal(t, int64(4), h.Frequency(node(-2)))
+	require.Equal(t, int64(4), h.Frequency(node(1000)))
+
+	require.Equal(t, &graph.Histogram{}, graph.NewHistogram(10, nil, 1))
+}
+
+func TestHistogramCostModel(t *testing.T) {
+	ctx := context.Background()
+	// a single node is referenced by 90% of quads, the rest are referenced once
+	m := graph.HistogramCostModel{Hist: &graph.Histogram{
+		Quads: 1000, Distinct: 101,
+		Top: []graph.Frequency{{Node: refs.PreFetched(quad.Int(1)), Quads: 900}},
+	}}
+	size := func(n ...int64) []iterator.Costs {
+		out := make([]iterator.Costs, 0, len(n))
+		for _, v := range n {
+			out = append(out, iterator.Costs{Size: refs.Size{Value: v}})
+		}
+		return out
+	}
+	require.InDelta(t, 10, m.JoinSize(ctx, size(10)), 1e-9)
+	// the frequent node is almost certainly in both shapes
+	require.InDelta(t, 1.81, m.JoinSize(ctx, size(10, 10)), 1e-9)
+	require.InDelta(t, 0.99, iterator.UniformCostModel{Universe: 101}.JoinSize(ctx, size(10, 10)), 0.01)
+	require.InDelta(t, 101, m.JoinSize(ctx, size(1000, 1000)), 1e-9)
+
+	// falls back to the uniform model without a histogram
+	require.InDelta(t, 10, graph.HistogramCostModel{}.JoinSize(ctx, size(10, 50)), 1e-9)
+}
@@ -0,0 +1,200 @@
+package httpgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/pquads"
+)
+
+// This file defines the wire format used by the quad store endpoints of HTTP API v2.
+// Values are always sent in protobuf encoding to preserve their types.
+
+// Size is a wire representation of refs.Size.
+type Size struct {
+	Value int64 `json:"value"`
+	Exact bool  `json:"exact"`
+}
+
+// Stats is a wire representation of graph.Stats.
+type Stats struct {
+	Nodes Size `json:"nodes"`
+	Quads Size `json:"quads"`
+}
+
+// MakeStats converts graph.Stats to the wire representation.
+func MakeStats(st graph.Stats) Stats {
+	return Stats{
+		Nodes: Size{Value: st.Nodes.Value, Exact: st.Nodes.Exact},
+		Quads: Size{Value: st.Quads.Value, Exact: st.Quads.Exact},
+	}
+}
+
+// ToNative converts Stats to graph.Stats.
+func (s Stats) ToNative() graph.Stats {
+	return graph.Stats{
+		Nodes: refs.Size{Value: s.Nodes.Value, Exact: s.Nodes.Exact},
+		Quads: refs.Size{Value: s.Quads.Value, Exact: s.Quads.Exact},
+	}
+}
+
+// Quad is a wire representation of quad.Quad.
+type Quad struct {
+	Subject   []byte `json:"s,omitempty"`
+	Predicate []byte `json:"p,omitempty"`
+	Object    []byte `json:"o,omitempty"`
+	Label     []byte `json:"l,omitempty"`
+}
+
+// MarshalValue encodes a value for the wire. Nil values are encoded as nil.
+func MarshalValue(v quad.Value) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return pquads.MarshalValue(v)
+}
+
+// UnmarshalValue decodes a value encoded by MarshalValue.
+func UnmarshalValue(ctx context.Context, data []byte) (quad.Value, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return pquads.UnmarshalValue(ctx, data)
+}
+
+// MakeQuad converts quad.Quad to the wire representation.
+func MakeQuad(q quad.Quad) (Quad, error) {
+	var (
+		out Quad
+		err error
+	)
+	for _, d := range quad.Directions {
+		var data []byte
+		if data, err = MarshalValue(q.Get(d)); err != nil {
+			return Quad{}, err
+		}
+		switch d {
+		case quad.Subject:
+			out.Subject = data
+		case quad.Predicate:
+			out.Predicate = data
+		case quad.Object:
+			out.Object = data
+		case quad.Label:
+			out.Label = data
+		}
+	}
+	return out, nil
+}
+
+// ToNative converts Quad to quad.Quad.
+func (q Quad) ToNative(ctx context.Context) (quad.Quad, error) {
+	var (
+		out quad.Quad
+		err error
+	)
+	if out.Subject, err = UnmarshalValue(ctx, q.Subject); err != nil {
+		return quad.Quad{}, err
+	}
+	if out.Predicate, err = UnmarshalValue(ctx, q.Predicate); err != nil {
+		return quad.Quad{}, err
+	}
+	if out.Object, err = UnmarshalValue(ctx, q.Object); err != nil {
+		return quad.Quad{}, err
+	}
+	if out.Label, err = UnmarshalValue(ctx, q.Label); err != nil {
+		return quad.Quad{}, err
+	}
+	return out, nil
+}
+
+// Delta is a wire representation of graph.Delta.
+type Delta struct {
+	Quad   Quad            `json:"quad"`
+	Action graph.Procedure `json:"action"`
+}
+
+// DeltasRequest is a request body for the deltas endpoint.
+type DeltasRequest struct {
+	Deltas        []Delta `json:"deltas"`
+	IgnoreDup     bool    `json:"ignore_dup,omitempty"`
+	IgnoreMissing bool    `json:"ignore_missing,omitempty"`
+}
+
+// Error codes for DeltaError that map to errors defined in graph package.
+const (
+	ErrCodeQuadExists    = "quad_exists"
+	ErrCodeQuadNotExist  = "quad_not_exist"
+	ErrCodeInvalidAction = "invalid_action"
+)
+
+// DeltaError is a response of the deltas endpoint for a delta that cannot be applied.
+type DeltaError struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+	Index int    `json:"index"`
+}
+
+// MakeDeltaError converts an error returned by ApplyDeltas to the wire representation.
+// It returns false if the error is not related to a specific delta.
+func MakeDeltaError(deltas []graph.Delta, err error) (DeltaError, bool) {
+	var de *graph.DeltaError
+	if !errors.As(err, &de) {
+		return DeltaError{}, false
+	}
+	out := DeltaError{Error: de.Error(), Index: -1}
+	for i, d := range deltas {
+		if d == de.Delta {
+			out.Index = i
+			break
+		}
+	}
+	switch {
+	case errors.Is(de.Err, graph.ErrQuadExists):
+		out.Code = ErrCodeQuadExists
+	case errors.Is(de.Err, graph.ErrQuadNotExist):
+		out.Code = ErrCodeQuadNotExist
+	case errors.Is(de.Err, graph.ErrInvalidAction):
+		out.Code = ErrCodeInvalidAction
+	}
+	return out, true
+}
+
+// ToNative converts DeltaError to *graph.DeltaError for the deltas it was returned for.
+func (e DeltaError) ToNative(deltas []graph.Delta) error {
+	var err error
+	switch e.Code {
+	case ErrCodeQuadExists:
+		err = graph.ErrQuadExists
+	case ErrCodeQuadNotExist:
+		err = graph.ErrQuadNotExist
+	case ErrCodeInvalidAction:
+		err = graph.ErrInvalidAction
+	default:
+		err = errors.New(e.Error)
+	}
+	if e.Index < 0 || e.Index >= len(deltas) {
+		return err
+	}
+	return &graph.DeltaError{Delta: deltas[e.Index], Err: err}
+}
+
+// ShapeRequest is a request body for the shape endpoint. Shape is encoded with shape.MarshalJSON.
+type ShapeRequest struct {
+	Shape json.RawMessage `json:"shape"`
+	Quads bool            `json:"quads,omitempty"` // shape returns quads instead of nodes
+	Limit int             `json:"limit,omitempty"`
+}
+
+// ShapeResult is a single result of the shape endpoint. Results are streamed as newline-delimited JSON.
+type ShapeResult struct {
+	Value []byte            `json:"v,omitempty"`
+	Quad  *Quad             `json:"q,omitempty"`
+	Tags  map[string][]byte `json:"tags,omitempty"`
+	Path  bool              `json:"path,omitempty"` // result was returned by NextPath
+	Error string            `json:"error,omitempty"`
+}
@@ -0,0 +1,473 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// AggregateOp is a function used to reduce values of a group to a single value.
+type AggregateOp int
+
+const (
+	// AggregateCount counts paths in a group.
+	AggregateCount AggregateOp = iota
+	// AggregateSum sums numeric values.
+	AggregateSum
+	// AggregateMin finds the smallest numeric or time value.
+	AggregateMin
+	// AggregateMax finds the largest numeric or time value.
+	AggregateMax
+	// AggregateAvg calculates an average of numeric values.
+	AggregateAvg
+)
+
+var aggregateNames = []string{
+	AggregateCount: "count",
+	AggregateSum:   "sum",
+	AggregateMin:   "min",
+	AggregateMax:   "max",
+	AggregateAvg:   "avg",
+}
+
+func (op AggregateOp) String() string {
+	if op >= 0 && int(op) < len(aggregateNames) {
+		return aggregateNames[op]
+	}
+	return fmt.Sprintf("aggregate(%d)", int(op))
+}
+
+// ParseAggregateOp returns an aggregate function with a given name (count, sum, min, max or avg).
+func ParseAggregateOp(name string) (AggregateOp, error) {
+	name = strings.ToLower(name)
+	for i, s := range aggregateNames {
+		if s == name {
+			return AggregateOp(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown aggregate function: %q", name)
+}
+
+// Reducer describes a single aggregate calculated for each group.
+type Reducer struct {
+	Op AggregateOp
+	// Tag is a tag with values to aggregate. If empty, results of the subiterator are used.
+	Tag string
+	// As is a tag name to save the aggregate to.
+	As string
+}
+
+func (r Reducer) String() string {
+	tag := r.Tag
+	if tag == "" {
+		tag = "*"
+	}
+	return fmt.Sprintf("%v(%s) as %s", r.Op, tag, r.As)
+}
+
+// Aggregate iterator groups results of the subiterator by values of given tags and calculates
+// aggregates for each group. Each result contains the group-by tags and one tag per reducer.
+//
+// The result value is the value of the first group-by tag, or the first aggregate if the tag is not set.
+// Without group-by tags all paths form a single group, thus the iterator always returns exactly one result.
+//
+// Numeric reducers accept quad.Int and quad.Float values; Min and Max also accept quad.Time values,
+// but prefer numbers if a group contains both. Values of other types are ignored.
+type Aggregate struct {
+	sub      Shape
+	qs       refs.Namer
+	groupBy  []string
+	reducers []Reducer
+}
+
+// NewAggregate creates a new iterator that groups results of a subiterator and reduces each group.
+func NewAggregate(sub Shape, qs refs.Namer, groupBy []string, reducers []Reducer) *Aggregate {
+	return &Aggregate{
+		sub: sub, qs: qs,
+		groupBy: groupBy, reducers: reducers,
+	}
+}
+
+func (it *Aggregate) Iterate(ctx context.Context) Scanner {
+	return newAggregateNext(it)
+}
+
+func (it *Aggregate) Lookup(ctx context.Context) Index {
+	return newAggregateContains(it)
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Aggregate) SubIterators() []Shape {
+	return []Shape{it.sub}
+}
+
+func (it *Aggregate) Optimize(ctx context.Context) (Shape, bool, error) {
+	sub, optimized, err := it.sub.Optimize(ctx)
+	if err != nil {
+		return it, false, err
+	}
+	it.sub = sub
+	return it, optimized, nil
+}
+
+func (it *Aggregate) Stats(ctx context.Context) (Costs, error) {
+	sub, err := it.sub.Stats(ctx)
+	if len(it.groupBy) == 0 {
+		sub.Size = refs.Size{Value: 1, Exact: true}
+	} else {
+		sub.Size.Exact = false
+	}
+	// all the subiterator must be consumed before returning the first result
+	sub.NextCost *= 2
+	sub.ContainsCost = sub.NextCost
+	return sub, err
+}
+
+func (it *Aggregate) String() string {
+	return fmt.Sprintf("Aggregate(%v, %v)", it.groupBy, it.reducers)
+}
+
+// groupKey is a comparable key of a group. Keys are chained to support any number of group-by tags.
+type groupKey struct {
+	prev any
+	val  any
+}
+
+// aggState accumulates values of a single reducer.
+type aggState struct {
+	n     int64
+	isum  int64
+	fsum  float64
+	float bool
+	num   quad.Value // min or max number
+	time  quad.Value // min or max time
+}
+
+func (s *aggState) add(op AggregateOp, v quad.Value) {
+	switch op {
+	case AggregateCount:
+		s.n++
+	case AggregateSum, AggregateAvg:
+		switch v := v.(type) {
+		case quad.Int:
+			s.isum += int64(v)
+		case quad.Float:
+			s.fsum += float64(v)
+			s.float = true
+		default:
+			return
+		}
+		s.n++
+	case AggregateMin, AggregateMax:
+		var (
+			best *quad.Value
+			d    int
+		)
+		switch v := v.(type) {
+		case quad.Int, quad.Float:
+			best = &s.num
+			if s.num != nil {
+				d = cmpFloat(aggNumber(v), aggNumber(s.num))
+			}
+		case quad.Time:
+			best = &s.time
+			if s.time != nil {
+				d = time.Time(v).Compare(time.Time(s.time.(quad.Time)))
+			}
+		default:
+			return
+		}
+		if *best == nil || (op == AggregateMin && d < 0) || (op == AggregateMax && d > 0) {
+			*best = v
+		}
+	}
+}
+
+func (s *aggState) value(op AggregateOp) quad.Value {
+	switch op {
+	case AggregateCount:
+		return quad.Int(s.n)
+	case AggregateSum:
+		if s.float {
+			return quad.Float(s.fsum + float64(s.isum))
+		}
+		return quad.Int(s.isum)
+	case AggregateAvg:
+		if s.n == 0 {
+			return nil
+		}
+		return quad.Float((s.fsum + float64(s.isum)) / float64(s.n))
+	default:
+		// numbers take precedence over time values
+		if s.num != nil {
+			return s.num
+		}
+		return s.time
+	}
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return +1
+	}
+	return 0
+}
+
+func aggNumber(v quad.Value) float64 {
+	switch v := v.(type) {
+	case quad.Int:
+		return float64(v)
+	case quad.Float:
+		return float64(v)
+	}
+	return 0
+}
+
+type aggGroup struct {
+	tags   map[string]refs.Ref
+	states []aggState
+}
+
+// aggregateNext consumes all results of the subiterator on the first call to Next.
+type aggregateNext struct {
+	it      *Aggregate
+	groups  []*aggGroup
+	result  result
+	index   int
+	started bool
+	err     error
+}
+
+func newAggregateNext(it *Aggregate) *aggregateNext {
+	return &aggregateNext{it: it}
+}
+
+func (it *aggregateNext) nameOf(ctx context.Context, ref refs.Ref) (quad.Value, error) {
+	if v, ok := ref.(refs.PreFetchedValue); ok {
+		return v.NameOf(), nil
+	}
+	if it.it.qs == nil {
+		return nil, nil
+	}
+	return it.it.qs.NameOf(ctx, ref)
+}
+
+func (it *aggregateNext) addPath(ctx context.Context, byKey map[groupKey]*aggGroup, sc Scanner) error {
+	id, err := sc.Result(ctx)
+	if err != nil {
+		return err
+	}
+	tags := make(map[string]refs.Ref)
+	if err := sc.TagResults(ctx, tags); err != nil {
+		return err
+	}
+	var key groupKey
+	for _, t := range it.it.groupBy {
+		key = groupKey{prev: key, val: refs.ToKey(tags[t])}
+	}
+	g := byKey[key]
+	if g == nil {
+		g = &aggGroup{
+			tags:   make(map[string]refs.Ref, len(it.it.groupBy)+len(it.it.reducers)),
+			states: make([]aggState, len(it.it.reducers)),
+		}
+		for _, t := range it.it.groupBy {
+			if ref, ok := tags[t]; ok {
+				g.tags[t] = ref
+			}
+		}
+		byKey[key] = g
+		it.groups = append(it.groups, g)
+	}
+	for i, r := range it.it.reducers {
+		ref := id
+		if r.Tag != "" {
+			ref = tags[r.Tag]
+		}
+		if ref == nil {
+			continue
+		}
+		if r.Op == AggregateCount {
+			g.states[i].add(r.Op, nil)
+			continue
+		}
+		v, err := it.nameOf(ctx, ref)
+		if err != nil {
+			return err
+		}
+		g.states[i].add(r.Op, v)
+	}
+	return nil
+}
+
+func (it *aggregateNext) materialize(ctx context.Context) error {
+	sc := Scan(ctx, it.it.sub)
+	defer sc.Close()
+	byKey := make(map[groupKey]*aggGroup)
+	for sc.Next(ctx) {
+		if err := it.addPath(ctx, byKey, sc); err != nil {
+			return err
+		}
+		for sc.NextPath(ctx) {
+			if err := it.addPath(ctx, byKey, sc); err != nil {
+				return err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if len(it.it.groupBy) == 0 && len(it.groups) == 0 {
+		it.groups = append(it.groups, &aggGroup{
+			tags:   make(map[string]refs.Ref, len(it.it.reducers)),
+			states: make([]aggState, len(it.it.reducers)),
+		})
+	}
+	for _, g := range it.groups {
+		for i, r := range it.it.reducers {
+			if v := g.states[i].value(r.Op); v != nil && r.As != "" {
+				g.tags[r.As] = refs.PreFetched(v)
+			}
+		}
+	}
+	return nil
+}
+
+func (it *aggregateNext) resultOf(g *aggGroup) refs.Ref {
+	if len(it.it.groupBy) != 0 {
+		if ref := g.tags[it.it.groupBy[0]]; ref != nil {
+			return ref
+		}
+	}
+	if len(it.it.reducers) != 0 {
+		r := it.it.reducers[0]
+		if v := g.states[0].value(r.Op); v != nil {
+			return refs.PreFetched(v)
+		}
+	}
+	return nil
+}
+
+func (it *aggregateNext) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if it.err = it.materialize(ctx); it.err != nil {
+			return false
+		}
+	}
+	for it.index < len(it.groups) {
+		g := it.groups[it.index]
+		it.index++
+		if id := it.resultOf(g); id != nil {
+			it.result = result{id: id, tags: g.tags}
+			return true
+		}
+	}
+	it.result = result{}
+	return false
+}
+
+func (it *aggregateNext) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	maps.Copy(dst, it.result.tags)
+	return nil
+}
+
+func (it *aggregateNext) Result(ctx context.Context) (refs.Ref, error) {
+	return it.result.id, it.err
+}
+
+func (it *aggregateNext) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *aggregateNext) Err() error {
+	return it.err
+}
+
+func (it *aggregateNext) Close() error {
+	it.groups = nil
+	return nil
+}
+
+func (it *aggregateNext) String() string { return "AggregateNext" }
+
+// aggregateContains checks if a value is a result of aggregation.
+type aggregateContains struct {
+	next   *aggregateNext
+	byKey  map[any]result
+	result result
+	err    error
+}
+
+func newAggregateContains(it *Aggregate) *aggregateContains {
+	return &aggregateContains{next: newAggregateNext(it)}
+}
+
+func (it *aggregateContains) Contains(ctx context.Context, val refs.Ref) (bool, error) {
+	if it.err != nil {
+		return false, it.err
+	}
+	if it.byKey == nil {
+		it.byKey = make(map[any]result)
+		for it.next.Next(ctx) {
+			r := it.next.result
+			it.byKey[refs.ToKey(r.id)] = r
+		}
+		if err := it.next.Err(); err != nil {
+			it.err = err
+			return false, err
+		}
+	}
+	r, ok := it.byKey[refs.ToKey(val)]
+	if !ok && it.next.it.qs != nil {
+		// aggregates are pre-fetched values, while the value might be a node of the quad store
+		v, err := it.next.nameOf(ctx, val)
+		if err != nil {
+			it.err = err
+			return false, err
+		}
+		if v != nil {
+			r, ok = it.byKey[refs.ToKey(refs.PreFetched(v))]
+		}
+	}
+	if ok {
+		it.result = r
+	} else {
+		it.result = result{}
+	}
+	return ok, nil
+}
+
+func (it *aggregateContains) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	maps.Copy(dst, it.result.tags)
+	return nil
+}
+
+func (it *aggregateContains) Result(ctx context.Context) (refs.Ref, error) {
+	return it.result.id, it.err
+}
+
+func (it *aggregateContains) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *aggregateContains) Err() error {
+	return it.err
+}
+
+func (it *aggregateContains) Close() error {
+	return it.next.Close()
+}
+
+func (it *aggregateContains) String() string { return "AggregateContains" }
@@ -0,0 +1,97 @@
+package iterator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+func aggRow(dev string, val quad.Value) Shape {
+	s := NewSave(NewFixed(refs.PreFetched(val)), "val")
+	if dev != "" {
+		s.AddFixedTag("dev", refs.PreFetched(quad.String(dev)))
+	}
+	return s
+}
+
+func collectAggregate(t *testing.T, it Shape) []map[string]quad.Value {
+	ctx := context.Background()
+	sc := it.Iterate(ctx)
+	defer sc.Close()
+	var out []map[string]quad.Value
+	for sc.Next(ctx) {
+		tags := make(map[string]refs.Ref)
+		require.NoError(t, sc.TagResults(ctx, tags))
+		m := make(map[string]quad.Value)
+		for k, v := range tags {
+			m[k] = v.(refs.PreFetchedValue).NameOf()
+		}
+		out = append(out, m)
+	}
+	require.NoError(t, sc.Err())
+	return out
+}
+
+func TestAggregate(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	rows := NewOr(
+		aggRow("a", quad.Int(1)),
+		aggRow("b", quad.Float(2.5)),
+		aggRow("a", quad.Int(3)),
+		aggRow("b", quad.Int(1)),
+		aggRow("a", quad.String("x")),
+		aggRow("c", quad.Time(t2)),
+		aggRow("c", quad.Time(t1)),
+	)
+	reducers := []Reducer{
+		{Op: AggregateCount, As: "n"},
+		{Op: AggregateSum, Tag: "val", As: "sum"},
+		{Op: AggregateMin, Tag: "val", As: "min"},
+		{Op: AggregateMax, Tag: "val", As: "max"},
+		{Op: AggregateAvg, Tag: "val", As: "avg"},
+	}
+	got := collectAggregate(t, NewAggregate(rows, nil, []string{"dev"}, reducers))
+	require.Equal(t, []map[string]quad.Value{
+		{"dev": quad.String("a"), "n": quad.Int(3), "sum": quad.Int(4), "min": quad.Int(1), "max": quad.Int(3), "avg": quad.Float(2)},
+		{"dev": quad.String("b"), "n": quad.Int(2), "sum": quad.Float(3.5), "min": quad.Int(1), "max": quad.Float(2.5), "avg": quad.Float(1.75)},
+		{"dev": quad.String("c"), "n": quad.Int(2), "sum": quad.Int(0), "min": quad.Time(t1), "max": quad.Time(t2)},
+	}, got)
+
+	ctx := context.Background()
+	ix := NewAggregate(rows, nil, []string{"dev"}, reducers).Lookup(ctx)
+	ok, err := ix.Contains(ctx, refs.PreFetched(quad.String("b")))
+	require.NoError(t, err)
+	require.True(t, ok)
+	tags := make(map[string]refs.Ref)
+	require.NoError(t, ix.TagResults(ctx, tags))
+	require.Equal(t, refs.PreFetched(quad.Int(2)), tags["n"])
+	ok, err = ix.Contains(ctx, refs.PreFetched(quad.String("d")))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, ix.Close())
+}
+
+func TestAggregateNoGroups(t *testing.T) {
+	reducers := []Reducer{
+		{Op: AggregateCount, As: "n"},
+		{Op: AggregateSum, As: "sum"},
+	}
+	rows := NewOr(aggRow("", quad.Int(2)), aggRow("", quad.Int(5)))
+	got := collectAggregate(t, NewAggregate(rows, nil, nil, reducers))
+	require.Equal(t, []map[string]quad.Value{
+		{"n": quad.Int(2), "sum": quad.Int(7)},
+	}, got)
+
+	got = collectAggregate(t, NewAggregate(NewNull(), nil, nil, reducers))
+	require.Equal(t, []map[string]quad.Value{
+		{"n": quad.Int(0), "sum": quad.Int(0)},
+	}, got)
+
+	got = collectAggregate(t, NewAggregate(NewNull(), nil, []string{"dev"}, reducers))
+	require.Empty(t, got)
+}
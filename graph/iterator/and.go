@@ -45,15 +45,20 @@ func (it *And) Iterate(ctx context.Context) Scanner {
 	if len(it.sub) == 0 {
 		return NewNull().Iterate(ctx)
 	}
+	if n := ParallelOf(ctx); n > 0 && len(it.sub) > 1 {
+		return it.parallelAnd(ctx, n)
+	}
+	// subiterators are started in order, thus they are listed in order in profiles
+	primary := Scan(ctx, it.sub[0])
 	sub := make([]Index, 0, len(it.sub)-1)
 	for _, s := range it.sub[1:] {
-		sub = append(sub, s.Lookup(ctx))
+		sub = append(sub, Lookup(ctx, s))
 	}
 	opt := make([]Index, 0, len(it.opt))
 	for _, s := range it.opt {
-		opt = append(opt, s.Lookup(ctx))
+		opt = append(opt, Lookup(ctx, s))
 	}
-	return newAndNext(it.sub[0].Iterate(ctx), newAndContains(sub, opt))
+	return newAndNext(primary, newAndContains(sub, opt))
 }
 
 func (it *And) Lookup(ctx context.Context) Index {
@@ -66,11 +71,11 @@ func (it *And) Lookup(ctx context.Context) Index {
 		check = it.sub
 	}
 	for _, s := range check {
-		sub = append(sub, s.Lookup(ctx))
+		sub = append(sub, Lookup(ctx, s))
 	}
 	opt := make([]Index, 0, len(it.opt))
 	for _, s := range it.opt {
-		opt = append(opt, s.Lookup(ctx))
+		opt = append(opt, Lookup(ctx, s))
 	}
 	return newAndContains(sub, opt)
 }
@@ -87,6 +92,12 @@ func (it *And) String() string {
 	return "And"
 }
 
+// Required returns subiterators that constrain the result of the And, in order.
+// Unlike SubIterators, it does not include optional iterators.
+func (it *And) Required() []Shape {
+	return append([]Shape{}, it.sub...)
+}
+
 // Add a subiterator to this And iterator.
 //
 // The first iterator that is added becomes the primary iterator. This is
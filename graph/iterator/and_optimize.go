@@ -122,6 +122,10 @@ func optimizeReplacement(its []Shape) Shape {
 // optimizeOrder(l) takes a list and returns a list, containing the same contents
 // but with a new ordering, however it wishes.
 func optimizeOrder(ctx context.Context, its []Shape) []Shape {
+	if len(its) > 3 {
+		// for larger intersections the order of Contains matters as much as the choice of the primary iterator
+		return optimizeJoinOrder(ctx, its)
+	}
 	var (
 		best     Shape
 		bestCost = int64(1 << 62)
@@ -178,6 +182,25 @@ func optimizeOrder(ctx context.Context, its []Shape) []Shape {
 	return out
 }
 
+// optimizeJoinOrder orders iterators to minimize the cost of the intersection estimated by the cost model.
+// The first iterator is Next()ed, and the rest are Contains()ed in order.
+func optimizeJoinOrder(ctx context.Context, its []Shape) []Shape {
+	costs := make([]Costs, 0, len(its))
+	for _, it := range its {
+		st, _ := it.Stats(ctx)
+		costs = append(costs, st)
+	}
+	order := JoinOrder(ctx, CostModelOf(ctx), costs)
+	out := make([]Shape, 0, len(its))
+	for _, i := range order {
+		out = append(out, its[i])
+	}
+	if clog.V(3) {
+		clog.Infof("And: Join order: %v", order)
+	}
+	return out
+}
+
 func sortByContainsCost(ctx context.Context, arr []Shape) error {
 	cost := make([]Costs, 0, len(arr))
 	var last error
@@ -0,0 +1,158 @@
+package iterator
+
+import (
+	"context"
+	"math"
+)
+
+// CostModel estimates sizes of intersections. And uses it to choose the order of its subiterators.
+type CostModel interface {
+	// JoinSize returns the estimated number of results of an intersection of shapes with given costs.
+	JoinSize(ctx context.Context, costs []Costs) float64
+}
+
+// UniformCostModel assumes that results of shapes are independent and distributed uniformly over Universe values.
+// If Universe is not set, the size of the largest shape is used instead.
+type UniformCostModel struct {
+	Universe int64
+}
+
+// JoinSize implements CostModel.
+func (m UniformCostModel) JoinSize(ctx context.Context, costs []Costs) float64 {
+	u := m.Universe
+	if u <= 0 {
+		for _, c := range costs {
+			u = max(u, c.Size.Value)
+		}
+	}
+	if u <= 0 {
+		return 0
+	}
+	size := float64(u)
+	for _, c := range costs {
+		size *= min(1, float64(c.Size.Value)/float64(u))
+	}
+	return size
+}
+
+type costModelKey struct{}
+
+// WithCostModel returns a context that makes iterator optimizations use a given cost model.
+func WithCostModel(ctx context.Context, m CostModel) context.Context {
+	return context.WithValue(ctx, costModelKey{}, m)
+}
+
+// CostModelOf returns a cost model associated with the context, or UniformCostModel if it's not set.
+func CostModelOf(ctx context.Context) CostModel {
+	if m, ok := ctx.Value(costModelKey{}).(CostModel); ok {
+		return m
+	}
+	return UniformCostModel{}
+}
+
+// maxJoinOrderDP is the maximal number of shapes ordered with dynamic programming.
+// Larger intersections are ordered greedily.
+const maxJoinOrderDP = 12
+
+// JoinOrder returns an order of shapes with given costs that minimizes the estimated cost of their intersection.
+//
+// It assumes that the first shape in the order is iterated, and each of its results is checked against the rest
+// of the shapes with Contains, in order. Thus, the cost of the order is the cost of iterating the first shape,
+// plus the cost of Contains of each next shape, multiplied by the estimated number of results of previous shapes.
+func JoinOrder(ctx context.Context, m CostModel, costs []Costs) []int {
+	n := len(costs)
+	switch n {
+	case 0:
+		return nil
+	case 1:
+		return []int{0}
+	}
+	if um, ok := m.(UniformCostModel); ok && um.Universe <= 0 {
+		// estimates for subsets must use the same universe to be comparable
+		for _, c := range costs {
+			um.Universe = max(um.Universe, c.Size.Value)
+		}
+		m = um
+	}
+	joinSize := func(set uint) float64 {
+		sub := make([]Costs, 0, n)
+		for i := range n {
+			if set&(1<<i) != 0 {
+				sub = append(sub, costs[i])
+			}
+		}
+		return m.JoinSize(ctx, sub)
+	}
+	scanCost := func(i int) float64 {
+		return float64(max(1, costs[i].Size.Value)) * float64(max(1, costs[i].NextCost))
+	}
+	checkCost := func(rows float64, i int) float64 {
+		return rows * float64(max(1, costs[i].ContainsCost))
+	}
+	if n > maxJoinOrderDP {
+		return joinOrderGreedy(n, joinSize, scanCost, checkCost)
+	}
+	// best[set] is the minimal cost of intersecting a set of shapes, and last[set] is the last shape in that order
+	full := uint(1)<<n - 1
+	best := make([]float64, full+1)
+	last := make([]int, full+1)
+	for i := range best {
+		best[i] = math.Inf(+1)
+	}
+	for i := range n {
+		best[1<<i] = scanCost(i)
+		last[1<<i] = i
+	}
+	// every superset is larger than the set, thus sets are processed after all their subsets
+	for set := uint(1); set < full; set++ {
+		if math.IsInf(best[set], +1) {
+			continue
+		}
+		rows := joinSize(set)
+		for j := range n {
+			if set&(1<<j) != 0 {
+				continue
+			}
+			next := set | 1<<j
+			if c := best[set] + checkCost(rows, j); c < best[next] {
+				best[next] = c
+				last[next] = j
+			}
+		}
+	}
+	order := make([]int, n)
+	for i, set := n-1, full; i >= 0; i-- {
+		order[i] = last[set]
+		set &^= 1 << last[set]
+	}
+	return order
+}
+
+// joinOrderGreedy starts from the cheapest shape to iterate, and adds the shape that makes the intersection cheaper on each step.
+func joinOrderGreedy(n int, joinSize func(set uint) float64, scanCost func(i int) float64, checkCost func(rows float64, i int) float64) []int {
+	order := make([]int, 0, n)
+	first := 0
+	for i := 1; i < n; i++ {
+		if scanCost(i) < scanCost(first) {
+			first = i
+		}
+	}
+	order = append(order, first)
+	set := uint(1) << first
+	for len(order) < n {
+		rows := joinSize(set)
+		next, nextCost := -1, math.Inf(+1)
+		for j := range n {
+			if set&(1<<j) != 0 {
+				continue
+			}
+			// prefer shapes that are cheap to check and leave fewer results for the next shapes
+			if c := checkCost(rows, j) + joinSize(set|1<<j); c < nextCost {
+				next, nextCost = j, c
+			}
+		}
+		order = append(order, next)
+		set |= 1 << next
+	}
+	return order
+}
@@ -0,0 +1,78 @@
+package iterator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+)
+
+func joinCosts(sizes ...int64) []Costs {
+	out := make([]Costs, 0, len(sizes))
+	for _, n := range sizes {
+		out = append(out, Costs{
+			Size:         refs.Size{Value: n, Exact: true},
+			NextCost:     1,
+			ContainsCost: 1,
+		})
+	}
+	return out
+}
+
+func TestJoinOrder(t *testing.T) {
+	ctx := context.Background()
+	m := UniformCostModel{Universe: 1000}
+
+	require.Equal(t, []int{2, 3, 1, 0}, JoinOrder(ctx, m, joinCosts(1000, 500, 5, 100)))
+
+	// a shape that is expensive to check is iterated instead, even if it's not the smallest one
+	costs := joinCosts(10, 100, 100, 500)
+	costs[1].ContainsCost = 1000
+	require.Equal(t, []int{1, 0, 2, 3}, JoinOrder(ctx, m, costs))
+
+	// the same applies when the universe is not known
+	require.Equal(t, []int{2, 3, 1, 0}, JoinOrder(ctx, UniformCostModel{}, joinCosts(1000, 500, 3, 96)))
+
+	// greedy ordering of large intersections starts from the smallest shape
+	sizes := make([]int64, 20)
+	for i := range sizes {
+		sizes[i] = int64(1000 - i)
+	}
+	sizes[13] = 3
+	order := JoinOrder(ctx, m, joinCosts(sizes...))
+	require.Len(t, order, len(sizes))
+	require.Equal(t, 13, order[0])
+}
+
+type fixedCostModel float64
+
+func (m fixedCostModel) JoinSize(ctx context.Context, costs []Costs) float64 {
+	return float64(m)
+}
+
+func TestAndJoinOrder(t *testing.T) {
+	ctx := context.Background()
+	big := newInt64(1, 1000, true)
+	small := newInt64(10, 12, true)
+	and := NewAnd(
+		big,
+		newInt64(1, 500, true),
+		small,
+		newInt64(5, 100, true),
+	)
+	opt, _, err := and.Optimize(ctx)
+	require.NoError(t, err)
+	require.Equal(t, small, opt.SubIterators()[0])
+	require.Equal(t, big, opt.SubIterators()[3])
+
+	require.Equal(t, []int{10, 11, 12}, iterated(t, opt))
+
+	// cost model that ignores sizes of the intersection keeps the cheapest shape to iterate first
+	ctx = WithCostModel(ctx, fixedCostModel(1))
+	opt, _, err = NewAnd(big, small, newInt64(1, 500, true), newInt64(5, 100, true)).Optimize(ctx)
+	require.NoError(t, err)
+	require.Equal(t, small, opt.SubIterators()[0])
+}
@@ -92,7 +92,7 @@ func (it *countNext) Next(ctx context.Context) bool {
 		return false
 	}
 	if !st.Size.Exact {
-		sit := it.it.Iterate(ctx)
+		sit := Scan(ctx, it.it)
 		defer sit.Close()
 		for st.Size.Value = 0; sit.Next(ctx); st.Size.Value++ {
 			// TODO(dennwc): it's unclear if we should call it here or not
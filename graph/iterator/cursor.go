@@ -0,0 +1,300 @@
+package iterator
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/pquads"
+)
+
+// MaxCursorSkip is the maximal number of results a resumed cursor may skip to get to its position.
+// Cursors over sorted results don't skip them, see Cursor.Resume.
+var MaxCursorSkip int64 = 100000
+
+var (
+	// ErrStaleCursor is returned when the position of a cursor cannot be found in the results anymore,
+	// for example when the data was changed since the position was saved.
+	ErrStaleCursor = errors.New("stale cursor")
+	// ErrInvalidCursor is returned when the saved cursor state cannot be decoded.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorTooFar is returned when resuming a cursor requires skipping more than MaxCursorSkip results.
+	ErrCursorTooFar = errors.New("cursor is too far to skip to, sort the results to resume it")
+)
+
+// Cursor iterates over results of an iterator tree, including sub-paths. Unlike Chain, it is driven by the caller,
+// thus the iteration may be paused between results. Position of the cursor can be saved with State to continue
+// the iteration later with ResumeCursor.
+//
+// Iterator tree will be optimized before the iteration, and closed with the cursor.
+type Cursor struct {
+	s       Shape
+	qs      refs.Namer
+	it      Scanner
+	optim   bool // iterator tree is optimized
+	nopaths bool
+
+	n    int64        // number of results returned so far
+	cur  refs.Ref     // current result
+	keys []quad.Value // sort keys of the current result, if the results are sorted
+	dup  int64        // number of results returned so far with the same sort keys
+	path bool         // current result may have more sub-paths
+	done bool
+	err  error
+}
+
+// NewCursor creates a cursor over results of an iterator tree. Namer is optional and is used to save
+// the position of the cursor independently of the ref implementation.
+func NewCursor(s Shape, qs refs.Namer) *Cursor {
+	return &Cursor{s: s, qs: qs}
+}
+
+// WithoutPaths makes the cursor skip sub-paths, thus each result is returned once, as with Scanner.Next.
+// It must be called before the iteration is started or resumed.
+func (c *Cursor) WithoutPaths() *Cursor {
+	c.nopaths = true
+	return c
+}
+
+// ResumeCursor creates a cursor that continues the iteration after the position saved with Cursor.State.
+// See Cursor.Resume.
+func ResumeCursor(ctx context.Context, s Shape, qs refs.Namer, state []byte) (*Cursor, error) {
+	c := NewCursor(s, qs)
+	if err := c.Resume(ctx, state); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Resume continues the iteration after the position saved with Cursor.State.
+// It must be called before the iteration starts.
+//
+// If the iterator tree is a Sort, results ordered before the saved position are dropped while sorting,
+// and only results with the same sort keys are skipped. Other iterators cannot be restored to an arbitrary
+// position, thus all results before the saved position are skipped, and ErrCursorTooFar is returned
+// if there are more than MaxCursorSkip of them.
+// It returns ErrStaleCursor if the last result before the saved position has changed.
+func (c *Cursor) Resume(ctx context.Context, state []byte) error {
+	st, err := decodeCursorState(ctx, state)
+	if err != nil {
+		return err
+	}
+	skip := st.n
+	if st.keys != nil {
+		c.optimize(ctx)
+		sit, ok := c.s.(*Sort)
+		if !ok || len(sit.keys) != len(st.keys) {
+			return ErrInvalidCursor
+		}
+		c.s, skip = sit.From(st.keys), st.dup
+	} else if skip > MaxCursorSkip {
+		return ErrCursorTooFar
+	}
+	for c.n < skip {
+		if !c.Next(ctx) {
+			if err = c.Err(); err == nil {
+				err = ErrStaleCursor
+			}
+			return err
+		}
+		if st.keys != nil && c.order().compareKeys(c.keys, st.keys) != 0 {
+			return ErrStaleCursor
+		}
+	}
+	if skip > 0 {
+		h, err := c.hash(ctx)
+		if err != nil {
+			return err
+		} else if h != st.last {
+			return ErrStaleCursor
+		}
+	}
+	c.n = st.n
+	return nil
+}
+
+func (c *Cursor) optimize(ctx context.Context) {
+	if c.optim {
+		return
+	}
+	c.optim = true
+	if optim, _, err := c.s.Optimize(ctx); err == nil {
+		c.s = optim
+	}
+}
+
+func (c *Cursor) start(ctx context.Context) {
+	c.optimize(ctx)
+	c.it = Scan(ctx, c.s)
+}
+
+// order returns the sort order of results, or nil if they are not sorted.
+func (c *Cursor) order() *sortOrder {
+	if sc, ok := c.it.(*sortNext); ok {
+		return sc.order
+	}
+	return nil
+}
+
+// Next advances the cursor to the next result. It returns false when there are no more results,
+// or when an error was encountered.
+func (c *Cursor) Next(ctx context.Context) bool {
+	if c.done || c.err != nil {
+		return false
+	}
+	if c.it == nil {
+		c.start(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+	ok := c.path && !c.nopaths && c.it.NextPath(ctx)
+	if !ok {
+		ok = c.it.Next(ctx)
+	}
+	c.path = ok
+	if !ok {
+		c.done = true
+		c.err = c.it.Err()
+		return false
+	}
+	c.cur, c.err = c.it.Result(ctx)
+	if c.err != nil {
+		return false
+	}
+	if o := c.order(); o != nil {
+		keys := c.it.(*sortNext).cur.keys
+		if c.keys != nil && o.compareKeys(keys, c.keys) == 0 {
+			c.dup++
+		} else {
+			c.dup = 1
+		}
+		c.keys = keys
+	}
+	c.n++
+	return true
+}
+
+// Result returns the current result.
+func (c *Cursor) Result() refs.Ref {
+	return c.cur
+}
+
+// TagResults fills a map with tags of the current result.
+func (c *Cursor) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	if c.it == nil {
+		return nil
+	}
+	return c.it.TagResults(ctx, dst)
+}
+
+// Offset returns the number of results returned so far.
+func (c *Cursor) Offset() int64 {
+	return c.n
+}
+
+// State returns an opaque position of the cursor after the current result.
+// If results are sorted, it includes values of the sort keys of the current result.
+func (c *Cursor) State(ctx context.Context) ([]byte, error) {
+	var h uint64
+	if c.n > 0 {
+		var err error
+		h, err = c.hash(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf := binary.AppendUvarint(nil, uint64(c.n))
+	buf = binary.BigEndian.AppendUint64(buf, h)
+	if c.keys == nil {
+		return buf, nil
+	}
+	buf = binary.AppendUvarint(buf, uint64(c.dup))
+	for _, v := range c.keys {
+		data, err := pquads.MarshalValue(v)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+// hash returns a hash of the current result. It's used to check if the results have changed when the cursor is resumed.
+func (c *Cursor) hash(ctx context.Context) (uint64, error) {
+	h := fnv.New64a()
+	if c.qs != nil {
+		v, err := c.qs.NameOf(ctx, c.cur)
+		if err != nil {
+			return 0, err
+		} else if v != nil {
+			h.Write([]byte(v.String()))
+			return h.Sum64(), nil
+		}
+	}
+	fmt.Fprint(h, refs.ToKey(c.cur))
+	return h.Sum64(), nil
+}
+
+// cursorState is a decoded position of a cursor.
+type cursorState struct {
+	n    int64        // number of results before the position
+	last uint64       // hash of the last result before the position
+	dup  int64        // number of results before the position with the same sort keys
+	keys []quad.Value // sort keys of the last result before the position, if the results are sorted
+}
+
+func decodeCursorState(ctx context.Context, state []byte) (cursorState, error) {
+	var st cursorState
+	un, sz := binary.Uvarint(state)
+	if sz <= 0 || len(state) < sz+8 {
+		return st, ErrInvalidCursor
+	}
+	st.n, st.last = int64(un), binary.BigEndian.Uint64(state[sz:])
+	state = state[sz+8:]
+	if len(state) == 0 {
+		return st, nil
+	}
+	un, sz = binary.Uvarint(state)
+	if sz <= 0 || un == 0 || int64(un) > st.n {
+		return st, ErrInvalidCursor
+	}
+	st.dup, state = int64(un), state[sz:]
+	for len(state) > 0 {
+		un, sz = binary.Uvarint(state)
+		if sz <= 0 || uint64(len(state)-sz) < un {
+			return st, ErrInvalidCursor
+		}
+		v, err := pquads.UnmarshalValue(ctx, state[sz:sz+int(un)])
+		if err != nil {
+			return st, ErrInvalidCursor
+		}
+		st.keys = append(st.keys, v)
+		state = state[sz+int(un):]
+	}
+	if st.keys == nil {
+		return st, ErrInvalidCursor
+	}
+	return st, nil
+}
+
+// Err returns an error encountered during the iteration, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close closes the underlying iterator.
+func (c *Cursor) Close() error {
+	c.done = true
+	if c.it == nil {
+		return nil
+	}
+	return c.it.Close()
+}
@@ -0,0 +1,98 @@
+package iterator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph/graphmock"
+	. "github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+func cursorPage(t *testing.T, c *Cursor, n int) []int {
+	ctx := context.Background()
+	var res []int
+	for len(res) < n && c.Next(ctx) {
+		res = append(res, int(c.Result().(Int64Node)))
+	}
+	require.NoError(t, c.Err())
+	return res
+}
+
+func TestCursor(t *testing.T) {
+	ctx := context.Background()
+	c := NewCursor(newInt64(1, 8, true), nil)
+	require.Equal(t, []int{1, 2, 3}, cursorPage(t, c, 3))
+	require.Equal(t, []int{4, 5, 6}, cursorPage(t, c, 3))
+	require.Equal(t, int64(6), c.Offset())
+	state, err := c.State(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int{7, 8}, cursorPage(t, c, 3))
+	require.False(t, c.Next(ctx))
+	require.NoError(t, c.Close())
+
+	c, err = ResumeCursor(ctx, newInt64(1, 8, true), nil, state)
+	require.NoError(t, err)
+	require.Equal(t, []int{7, 8}, cursorPage(t, c, 3))
+	c.Close()
+
+	_, err = ResumeCursor(ctx, newInt64(2, 9, true), nil, state)
+	require.ErrorIs(t, err, ErrStaleCursor)
+	_, err = ResumeCursor(ctx, newInt64(1, 3, true), nil, state)
+	require.ErrorIs(t, err, ErrStaleCursor)
+	_, err = ResumeCursor(ctx, newInt64(1, 8, true), nil, state[:1])
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorSorted(t *testing.T) {
+	ctx := context.Background()
+	vals := func() Shape {
+		var rs []refs.Ref
+		for _, s := range []string{"c", "b", "a", "b", "d", "b"} {
+			rs = append(rs, refs.PreFetched(quad.String(s)))
+		}
+		return NewSort(&graphmock.Store{}, NewFixed(rs...))
+	}
+	page := func(c *Cursor, n int) []quad.Value {
+		var out []quad.Value
+		for len(out) < n && c.Next(ctx) {
+			out = append(out, c.Result().(refs.PreFetchedValue).NameOf())
+		}
+		require.NoError(t, c.Err())
+		return out
+	}
+	c := NewCursor(vals(), nil)
+	require.Equal(t, []quad.Value{quad.String("a"), quad.String("b"), quad.String("b")}, page(c, 3))
+	state, err := c.State(ctx)
+	require.NoError(t, err)
+	c.Close()
+
+	// sorted results are not skipped, thus the limit doesn't apply
+	defer func(n int64) { MaxCursorSkip = n }(MaxCursorSkip)
+	MaxCursorSkip = 1
+	c, err = ResumeCursor(ctx, vals(), nil, state)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), c.Offset())
+	require.Equal(t, []quad.Value{quad.String("b"), quad.String("c"), quad.String("d")}, page(c, 3))
+	c.Close()
+
+	_, err = ResumeCursor(ctx, newInt64(1, 8, true), nil, state)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorTooFar(t *testing.T) {
+	ctx := context.Background()
+	c := NewCursor(newInt64(1, 8, true), nil)
+	require.Equal(t, []int{1, 2, 3}, cursorPage(t, c, 3))
+	state, err := c.State(ctx)
+	require.NoError(t, err)
+	c.Close()
+
+	defer func(n int64) { MaxCursorSkip = n }(MaxCursorSkip)
+	MaxCursorSkip = 2
+	_, err = ResumeCursor(ctx, newInt64(1, 8, true), nil, state)
+	require.ErrorIs(t, err, ErrCursorTooFar)
+}
@@ -16,6 +16,7 @@ type Chain struct {
 
 	paths    bool
 	optimize bool
+	parallel int
 
 	limit int
 	n     int
@@ -62,7 +63,10 @@ func (c *Chain) start(ctx context.Context) {
 			c.s = optim
 		}
 	}
-	c.it = c.s.Iterate(ctx)
+	if c.parallel > 0 {
+		ctx = WithParallel(ctx, c.parallel)
+	}
+	c.it = Scan(ctx, c.s)
 }
 
 func (c *Chain) end() {
@@ -88,6 +92,13 @@ func (c *Chain) On(qs refs.Namer) *Chain {
 	return c
 }
 
+// Parallel allows iterators to use up to n goroutines. Results are returned in no particular order.
+// See WithParallel for details.
+func (c *Chain) Parallel(n int) *Chain {
+	c.parallel = n
+	return c
+}
+
 // UnOptimized disables iterator optimization.
 func (c *Chain) UnOptimized() *Chain {
 	c.optimize = false
@@ -22,11 +22,11 @@ func NewLimit(it Shape, max int64) *Limit {
 }
 
 func (it *Limit) Iterate(ctx context.Context) Scanner {
-	return NewLimitNext(it.it.Iterate(ctx), it.limit)
+	return NewLimitNext(Scan(ctx, it.it), it.limit)
 }
 
 func (it *Limit) Lookup(ctx context.Context) Index {
-	return newLimitContains(it.it.Lookup(ctx), it.limit)
+	return newLimitContains(Lookup(ctx, it.it), it.limit)
 }
 
 // SubIterators returns a slice of the sub iterators.
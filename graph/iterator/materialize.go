@@ -112,7 +112,7 @@ func newMaterializeNext(ctx context.Context, sub Shape) *materializeNext {
 	return &materializeNext{
 		containsMap: make(map[any]int),
 		sub:         sub,
-		next:        sub.Iterate(ctx),
+		next:        Scan(ctx, sub),
 		index:       -1,
 	}
 }
@@ -269,7 +269,7 @@ outer:
 		it.values = nil
 		it.containsMap = nil
 		_ = it.next.Close()
-		it.next = it.sub.Iterate(ctx)
+		it.next = Scan(ctx, it.sub)
 	}
 	it.hasRun = true
 }
@@ -325,7 +325,7 @@ func (it *materializeContains) Err() error {
 func (it *materializeContains) run(ctx context.Context) {
 	it.next.materializeSet(ctx)
 	if it.next.aborted {
-		it.sub = it.next.sub.Lookup(ctx)
+		it.sub = Lookup(ctx, it.next.sub)
 	}
 }
 
@@ -21,11 +21,11 @@ func NewNot(primaryIt, allIt Shape) *Not {
 }
 
 func (it *Not) Iterate(ctx context.Context) Scanner {
-	return newNotNext(it.primary.Lookup(ctx), it.allIt.Iterate(ctx))
+	return newNotNext(Lookup(ctx, it.primary), Scan(ctx, it.allIt))
 }
 
 func (it *Not) Lookup(ctx context.Context) Index {
-	return newNotContains(it.primary.Lookup(ctx))
+	return newNotContains(Lookup(ctx, it.primary))
 }
 
 // SubIterators returns a slice of the sub iterators.
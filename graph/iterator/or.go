@@ -57,9 +57,12 @@ func NewShortCircuitOr(sub ...Shape) *Or {
 }
 
 func (it *Or) Iterate(ctx context.Context) Scanner {
+	if n := ParallelOf(ctx); n > 0 && !it.isShortCircuiting && len(it.sub) > 1 {
+		return parallelScan("Or", it.sub, n)
+	}
 	sub := make([]Scanner, 0, len(it.sub))
 	for _, s := range it.sub {
-		sub = append(sub, s.Iterate(ctx))
+		sub = append(sub, Scan(ctx, s))
 	}
 	return newOrNext(sub, it.isShortCircuiting)
 }
@@ -67,7 +70,7 @@ func (it *Or) Iterate(ctx context.Context) Scanner {
 func (it *Or) Lookup(ctx context.Context) Index {
 	sub := make([]Index, 0, len(it.sub))
 	for _, s := range it.sub {
-		sub = append(sub, s.Lookup(ctx))
+		sub = append(sub, Lookup(ctx, s))
 	}
 	return newOrContains(sub, it.isShortCircuiting)
 }
@@ -0,0 +1,350 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aperturerobotics/cayley/graph/refs"
+)
+
+// Partitioner is an optional interface for shapes that can split their results into disjoint parts,
+// which may be iterated in parallel.
+type Partitioner interface {
+	Shape
+	// Partition splits the shape into at most n shapes that together return the same results.
+	Partition(ctx context.Context, n int) ([]Shape, error)
+}
+
+// partitionBounds splits n values into at most parts contiguous ranges.
+func partitionBounds(n, parts int) [][2]int {
+	if parts > n {
+		parts = n
+	}
+	if parts <= 0 {
+		return nil
+	}
+	out := make([][2]int, 0, parts)
+	for i := 0; i < parts; i++ {
+		out = append(out, [2]int{n * i / parts, n * (i + 1) / parts})
+	}
+	return out
+}
+
+// parallelBuffer is a number of results buffered for each worker.
+const parallelBuffer = 64
+
+type parallelKey struct{}
+
+// WithParallel returns a context that enables parallel execution of iterators started with it.
+// Up to n goroutines are used by each And and Or iterator on the Next path, which then return results in no particular order.
+//
+// Only the outermost iterators use multiple goroutines, iterators started by them run sequentially.
+func WithParallel(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, parallelKey{}, n)
+}
+
+// ParallelOf returns a number of goroutines that iterators may use, or zero if parallel execution is not enabled.
+func ParallelOf(ctx context.Context) int {
+	n, _ := ctx.Value(parallelKey{}).(int)
+	if n <= 1 {
+		return 0
+	}
+	return n
+}
+
+// parallelRow is a single result sent by a worker, together with its tags.
+type parallelRow struct {
+	ref  refs.Ref
+	tags map[string]refs.Ref
+}
+
+// parallelJob is a function executed by a single worker. It must stop when the context is canceled.
+type parallelJob func(ctx context.Context, emit func(parallelRow) error) error
+
+// parallelNext runs jobs on separate goroutines and returns their results in the order they are emitted.
+// Sub-paths of results are flattened, thus NextPath always returns false.
+type parallelNext struct {
+	name string
+	jobs []parallelJob
+
+	cancel func()
+	rows   chan parallelRow
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+
+	cur    parallelRow
+	closed bool
+}
+
+func newParallelNext(name string, jobs []parallelJob) *parallelNext {
+	return &parallelNext{name: name, jobs: jobs}
+}
+
+func (it *parallelNext) setErr(err error) {
+	it.mu.Lock()
+	if it.err == nil {
+		it.err = err
+	}
+	it.mu.Unlock()
+}
+
+func (it *parallelNext) start(ctx context.Context) {
+	// workers run sequential iterators only
+	ctx, it.cancel = context.WithCancel(WithParallel(ctx, 0))
+	it.rows = make(chan parallelRow, len(it.jobs)*parallelBuffer)
+	emit := func(r parallelRow) error {
+		select {
+		case it.rows <- r:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for _, job := range it.jobs {
+		it.wg.Add(1)
+		go func() {
+			defer it.wg.Done()
+			if err := job(ctx, emit); err != nil && ctx.Err() == nil {
+				it.setErr(err)
+				it.cancel()
+			}
+		}()
+	}
+	go func() {
+		it.wg.Wait()
+		close(it.rows)
+	}()
+}
+
+func (it *parallelNext) Next(ctx context.Context) bool {
+	if it.closed {
+		return false
+	}
+	if it.rows == nil {
+		it.start(ctx)
+	}
+	select {
+	case r, ok := <-it.rows:
+		if !ok {
+			return false
+		}
+		if it.Err() != nil {
+			return false
+		}
+		it.cur = r
+		return true
+	case <-ctx.Done():
+		it.setErr(ctx.Err())
+		return false
+	}
+}
+
+func (it *parallelNext) Err() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.err
+}
+
+func (it *parallelNext) Result(ctx context.Context) (refs.Ref, error) {
+	return it.cur.ref, it.Err()
+}
+
+func (it *parallelNext) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	maps.Copy(dst, it.cur.tags)
+	return nil
+}
+
+func (it *parallelNext) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *parallelNext) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	if it.rows != nil {
+		it.cancel()
+		it.wg.Wait()
+	}
+	return nil
+}
+
+func (it *parallelNext) String() string {
+	return fmt.Sprintf("%sParallel(%d)", it.name, len(it.jobs))
+}
+
+// scanRows sends all results of a scanner, including sub-paths, with their tags.
+func scanRows(ctx context.Context, sc Scanner, emit func(parallelRow) error) error {
+	send := func() error {
+		ref, err := sc.Result(ctx)
+		if err != nil {
+			return err
+		}
+		tags := make(map[string]refs.Ref)
+		if err = sc.TagResults(ctx, tags); err != nil {
+			return err
+		}
+		return emit(parallelRow{ref: ref, tags: tags})
+	}
+	for sc.Next(ctx) {
+		if err := send(); err != nil {
+			return err
+		}
+		for sc.NextPath(ctx) {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+	}
+	return sc.Err()
+}
+
+// parallelScan returns a scanner that iterates shapes on at most n goroutines.
+func parallelScan(name string, shapes []Shape, n int) Scanner {
+	if n > len(shapes) {
+		n = len(shapes)
+	}
+	var next atomic.Int64
+	jobs := make([]parallelJob, n)
+	for i := range jobs {
+		jobs[i] = func(ctx context.Context, emit func(parallelRow) error) error {
+			for {
+				j := int(next.Add(1)) - 1
+				if j >= len(shapes) {
+					return nil
+				}
+				sc := Scan(ctx, shapes[j])
+				err := scanRows(ctx, sc, emit)
+				if err2 := sc.Close(); err == nil {
+					err = err2
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return newParallelNext(name, jobs)
+}
+
+// andGroup is a result of the primary iterator of And, with tags of all its sub-paths.
+type andGroup struct {
+	ref  refs.Ref
+	tags []map[string]refs.Ref
+}
+
+// parallelAnd returns a scanner for And that checks results of the primary iterator on n goroutines.
+// If the primary iterator can be partitioned, each goroutine iterates its own partition.
+func (it *And) parallelAnd(ctx context.Context, n int) Scanner {
+	if p, ok := it.sub[0].(Partitioner); ok {
+		parts, err := p.Partition(ctx, n)
+		if err == nil && len(parts) > 1 {
+			shapes := make([]Shape, 0, len(parts))
+			for _, part := range parts {
+				sub := append([]Shape{part}, it.sub[1:]...)
+				shapes = append(shapes, &And{sub: sub, opt: it.opt})
+			}
+			return parallelScan("And", shapes, n)
+		}
+	}
+	groups := make(chan andGroup, n*parallelBuffer)
+	jobs := make([]parallelJob, 0, n)
+	// the first worker reads the primary iterator, others check its results
+	jobs = append(jobs, func(ctx context.Context, emit func(parallelRow) error) error {
+		defer close(groups)
+		pri := Scan(ctx, it.sub[0])
+		defer pri.Close()
+		for pri.Next(ctx) {
+			ref, err := pri.Result(ctx)
+			if err != nil {
+				return err
+			}
+			var g andGroup
+			g.ref = ref
+			for {
+				tags := make(map[string]refs.Ref)
+				if err = pri.TagResults(ctx, tags); err != nil {
+					return err
+				}
+				g.tags = append(g.tags, tags)
+				if !pri.NextPath(ctx) {
+					break
+				}
+			}
+			select {
+			case groups <- g:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return pri.Err()
+	})
+	for len(jobs) < n {
+		jobs = append(jobs, func(ctx context.Context, emit func(parallelRow) error) error {
+			sub := make([]Index, 0, len(it.sub)-1)
+			for _, s := range it.sub[1:] {
+				sub = append(sub, Lookup(ctx, s))
+			}
+			opt := make([]Index, 0, len(it.opt))
+			for _, s := range it.opt {
+				opt = append(opt, Lookup(ctx, s))
+			}
+			sec := newAndContains(sub, opt)
+			defer sec.Close()
+			for g := range groups {
+				if err := checkAndGroup(ctx, sec, g, emit); err != nil {
+					return err
+				}
+			}
+			return ctx.Err()
+		})
+	}
+	return newParallelNext("And", jobs)
+}
+
+// checkAndGroup checks a primary result against secondary iterators, and sends it with the same
+// combination of sub-paths as andNext would return.
+func checkAndGroup(ctx context.Context, sec Index, g andGroup, emit func(parallelRow) error) error {
+	ok, err := sec.Contains(ctx, g.ref)
+	if err != nil {
+		return err
+	} else if !ok {
+		return sec.Err()
+	}
+	send := func(pri map[string]refs.Ref) error {
+		tags := maps.Clone(pri)
+		if err := sec.TagResults(ctx, tags); err != nil {
+			return err
+		}
+		return emit(parallelRow{ref: g.ref, tags: tags})
+	}
+	for _, pri := range g.tags {
+		if err := send(pri); err != nil {
+			return err
+		}
+	}
+	for sec.NextPath(ctx) {
+		if err := send(g.tags[len(g.tags)-1]); err != nil {
+			return err
+		}
+	}
+	return sec.Err()
+}
+
+var _ Partitioner = (*Fixed)(nil)
+
+// Partition implements Partitioner.
+func (it *Fixed) Partition(ctx context.Context, n int) ([]Shape, error) {
+	bounds := partitionBounds(len(it.values), n)
+	out := make([]Shape, 0, len(bounds))
+	for _, b := range bounds {
+		out = append(out, &Fixed{values: it.values[b[0]:b[1]]})
+	}
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+)
+
+// tagRows returns all results with their tags in sorted order, iterating the shape on n goroutines.
+func tagRows(t *testing.T, s Shape, n int) []string {
+	ctx := context.Background()
+	var out []string
+	err := Iterate(s).Parallel(n).Paths(true).TagEach(ctx, func(m map[string]refs.Ref) error {
+		row := ""
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			row += fmt.Sprintf("%s=%v ", k, m[k])
+		}
+		out = append(out, row)
+		return nil
+	})
+	require.NoError(t, err)
+	slices.Sort(out)
+	return out
+}
+
+func int64Fixed(min, max int64) *Fixed {
+	f := NewFixed()
+	for i := min; i <= max; i++ {
+		f.Add(Int64Node(i))
+	}
+	return f
+}
+
+func TestParallel(t *testing.T) {
+	var cases = []struct {
+		name  string
+		shape func() Shape
+		size  int
+	}{
+		{
+			name: "and partitioned",
+			shape: func() Shape {
+				return NewAnd(NewSave(int64Fixed(1, 100), "a"), NewSave(newInt64(10, 60, true), "b"))
+			},
+			size: 51,
+		},
+		{
+			name: "and checked",
+			shape: func() Shape {
+				return NewAnd(NewSave(newInt64(1, 100, true), "a"), NewSave(newInt64(10, 60, true), "b"))
+			},
+			size: 51,
+		},
+		{
+			name: "and optional",
+			shape: func() Shape {
+				and := NewAnd(newInt64(1, 100, true), newInt64(10, 60, true))
+				and.AddOptionalIterator(NewSave(int64Fixed(20, 30), "o"))
+				return and
+			},
+			size: 51,
+		},
+		{
+			name: "or",
+			shape: func() Shape {
+				return NewOr(NewSave(int64Fixed(1, 50), "a"), NewSave(newInt64(40, 90, true), "b"), int64Fixed(95, 99))
+			},
+			size: 106,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			exp := tagRows(t, c.shape(), 0)
+			require.Len(t, exp, c.size)
+			for _, n := range []int{2, 4, 16} {
+				require.Equal(t, exp, tagRows(t, c.shape(), n), "parallel: %d", n)
+			}
+		})
+	}
+}
+
+func TestParallelError(t *testing.T) {
+	ctx := WithParallel(context.Background(), 4)
+	errFoo := errors.New("foo")
+	and := NewAnd(newInt64(1, 1000, true), NewError(errFoo))
+	it := and.Iterate(ctx)
+	for it.Next(ctx) {
+	}
+	require.ErrorIs(t, it.Err(), errFoo)
+	require.NoError(t, it.Close())
+
+	// closing the iterator early stops all workers
+	or := NewOr(newInt64(1, 1000, true), newInt64(1, 1000, true))
+	it = or.Iterate(ctx)
+	require.True(t, it.Next(ctx))
+	require.NoError(t, it.Close())
+	require.False(t, it.Next(ctx))
+}
+
+func TestFixedPartition(t *testing.T) {
+	ctx := context.Background()
+	parts, err := int64Fixed(1, 10).Partition(ctx, 3)
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	var got []int
+	for _, p := range parts {
+		got = append(got, iterated(t, p)...)
+	}
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, got)
+
+	parts, err = int64Fixed(1, 2).Partition(ctx, 4)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+}
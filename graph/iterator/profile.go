@@ -0,0 +1,266 @@
+package iterator
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aperturerobotics/cayley/graph/refs"
+)
+
+// NodeStats are statistics of execution of a single iterator.
+//
+// Time is inclusive: it includes the time spent in subiterators.
+type NodeStats struct {
+	Next     int64         `json:"next,omitempty"`
+	NextPath int64         `json:"next_path,omitempty"`
+	Contains int64         `json:"contains,omitempty"`
+	Results  int64         `json:"results"`
+	Time     time.Duration `json:"time_ns"`
+}
+
+type nodeCounters struct {
+	next, nextPath, contains, results, time atomic.Int64
+}
+
+func (c *nodeCounters) since(start time.Time) {
+	c.time.Add(int64(time.Since(start)))
+}
+
+// Profile collects statistics of execution of iterators.
+//
+// To profile the iterator tree, the context passed to Iterate or Lookup must have the profile set with WithProfile.
+// Iterators must start their subiterators with Scan and Lookup to be accounted. Each start of an iterator is
+// recorded as a separate node, under the node of the iterator that started it.
+//
+// A profile must only be used for a single iterator tree, see NewPlan.
+type Profile struct {
+	mu    sync.Mutex
+	nodes []*profileNode
+}
+
+// profileNode is an iterator started by Scan or Lookup.
+type profileNode struct {
+	id     int
+	parent int // -1 for the root
+	s      Shape
+	c      nodeCounters
+}
+
+// NewProfile creates an empty profile.
+func NewProfile() *Profile {
+	return &Profile{}
+}
+
+// wrap records a new node of the iterator, started under a given parent. IDs of nodes are their indexes.
+func (p *Profile) wrap(parent int, s Shape) *profileNode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := &profileNode{id: len(p.nodes), parent: parent, s: s}
+	p.nodes = append(p.nodes, n)
+	return n
+}
+
+// children returns nodes started under each node, in order. Nodes without a parent are stored under -1.
+func (p *Profile) children() map[int][]*profileNode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[int][]*profileNode)
+	for _, n := range p.nodes {
+		out[n.parent] = append(out[n.parent], n)
+	}
+	return out
+}
+
+func (n *profileNode) stats() NodeStats {
+	return NodeStats{
+		Next:     n.c.next.Load(),
+		NextPath: n.c.nextPath.Load(),
+		Contains: n.c.contains.Load(),
+		Results:  n.c.results.Load(),
+		Time:     time.Duration(n.c.time.Load()),
+	}
+}
+
+type profileKey struct{}
+
+// profileCtx is stored in the context: subiterators started with it are recorded under the node.
+type profileCtx struct {
+	p    *Profile
+	node int
+}
+
+// WithProfile returns a context that makes iterators record statistics of their execution to a given profile.
+func WithProfile(ctx context.Context, p *Profile) context.Context {
+	return context.WithValue(ctx, profileKey{}, profileCtx{p: p, node: -1})
+}
+
+// ProfileOf returns a profile associated with the context, or nil if it's not set.
+func ProfileOf(ctx context.Context) *Profile {
+	pc, _ := ctx.Value(profileKey{}).(profileCtx)
+	return pc.p
+}
+
+// startProfile records a new node if the context has a profile.
+func startProfile(ctx context.Context, s Shape) (profiled, bool) {
+	pc, ok := ctx.Value(profileKey{}).(profileCtx)
+	if !ok || pc.p == nil {
+		return profiled{}, false
+	}
+	return profiled{p: pc.p, n: pc.p.wrap(pc.node, s)}, true
+}
+
+// Scan starts the iterator in scanning mode. It is equivalent to s.Iterate(ctx),
+// but accounts the execution if the context has a profile.
+func Scan(ctx context.Context, s Shape) Scanner {
+	pn, ok := startProfile(ctx, s)
+	if !ok {
+		return s.Iterate(ctx)
+	}
+	return &profileNext{Scanner: s.Iterate(pn.context(ctx)), profiled: pn}
+}
+
+// Lookup starts the iterator in an index lookup mode. It is equivalent to s.Lookup(ctx),
+// but accounts the execution if the context has a profile.
+func Lookup(ctx context.Context, s Shape) Index {
+	pn, ok := startProfile(ctx, s)
+	if !ok {
+		return s.Lookup(ctx)
+	}
+	return &profileContains{Index: s.Lookup(pn.context(ctx)), profiled: pn}
+}
+
+// profiled is a node of a started iterator.
+type profiled struct {
+	p *Profile
+	n *profileNode
+}
+
+// context returns a context that records subiterators started by the iterator under its node.
+func (pn profiled) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, profileKey{}, profileCtx{p: pn.p, node: pn.n.id})
+}
+
+type profileNext struct {
+	Scanner
+	profiled
+}
+
+func (it *profileNext) Next(ctx context.Context) bool {
+	c := &it.n.c
+	defer c.since(time.Now())
+	c.next.Add(1)
+	ok := it.Scanner.Next(it.context(ctx))
+	if ok {
+		c.results.Add(1)
+	}
+	return ok
+}
+
+func (it *profileNext) NextPath(ctx context.Context) bool {
+	c := &it.n.c
+	defer c.since(time.Now())
+	c.nextPath.Add(1)
+	ok := it.Scanner.NextPath(it.context(ctx))
+	if ok {
+		c.results.Add(1)
+	}
+	return ok
+}
+
+type profileContains struct {
+	Index
+	profiled
+}
+
+func (it *profileContains) Contains(ctx context.Context, v refs.Ref) (bool, error) {
+	c := &it.n.c
+	defer c.since(time.Now())
+	c.contains.Add(1)
+	ok, err := it.Index.Contains(it.context(ctx), v)
+	if ok {
+		c.results.Add(1)
+	}
+	return ok, err
+}
+
+func (it *profileContains) NextPath(ctx context.Context) bool {
+	c := &it.n.c
+	defer c.since(time.Now())
+	c.nextPath.Add(1)
+	ok := it.Index.NextPath(it.context(ctx))
+	if ok {
+		c.results.Add(1)
+	}
+	return ok
+}
+
+// Plan describes an iterator tree with estimated costs of each iterator,
+// and, optionally, with statistics of its execution.
+type Plan struct {
+	Type         string     `json:"type"`
+	Size         int64      `json:"size"`
+	Exact        bool       `json:"exact,omitempty"`
+	NextCost     int64      `json:"next_cost"`
+	ContainsCost int64      `json:"contains_cost"`
+	Error        string     `json:"error,omitempty"`
+	Stats        *NodeStats `json:"analyze,omitempty"`
+	Sub          []Plan     `json:"sub,omitempty"`
+}
+
+// NewPlan describes an iterator tree.
+//
+// If the profile is set and the tree was executed with it, the plan describes iterators as they were started,
+// with statistics of their execution. Iterators that were never started are omitted, and iterators that were
+// started multiple times are described once for each start.
+func NewPlan(ctx context.Context, s Shape, p *Profile) Plan {
+	if p != nil {
+		if children := p.children(); len(children[-1]) != 0 {
+			return profilePlan(ctx, children, children[-1])
+		}
+	}
+	out := newPlan(ctx, s)
+	for _, sub := range s.SubIterators() {
+		if sub == nil {
+			continue
+		}
+		out.Sub = append(out.Sub, NewPlan(ctx, sub, nil))
+	}
+	return out
+}
+
+// newPlan describes a single iterator, without subiterators.
+func newPlan(ctx context.Context, s Shape) Plan {
+	st, err := s.Stats(ctx)
+	out := Plan{
+		Type:         s.String(),
+		Size:         st.Size.Value,
+		Exact:        st.Size.Exact,
+		NextCost:     st.NextCost,
+		ContainsCost: st.ContainsCost,
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
+
+// profilePlan describes profiled nodes of the same iterator as a single plan, with the sum of their statistics.
+func profilePlan(ctx context.Context, children map[int][]*profileNode, nodes []*profileNode) Plan {
+	out := newPlan(ctx, nodes[0].s)
+	var st NodeStats
+	for _, n := range nodes {
+		ns := n.stats()
+		st.Next += ns.Next
+		st.NextPath += ns.NextPath
+		st.Contains += ns.Contains
+		st.Results += ns.Results
+		st.Time += ns.Time
+		for _, sub := range children[n.id] {
+			out.Sub = append(out.Sub, profilePlan(ctx, children, []*profileNode{sub}))
+		}
+	}
+	out.Stats = &st
+	return out
+}
@@ -0,0 +1,64 @@
+package iterator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/aperturerobotics/cayley/graph/iterator"
+)
+
+func TestProfile(t *testing.T) {
+	p := NewProfile()
+	ctx := WithProfile(context.Background(), p)
+
+	primary := NewFixed(Int64Node(1), Int64Node(2), Int64Node(3))
+	check := newInt64(2, 5, true)
+	and := NewAnd(primary, check)
+
+	var got []int
+	sc := Scan(ctx, and)
+	for sc.Next(ctx) {
+		res, err := sc.Result(ctx)
+		require.NoError(t, err)
+		got = append(got, int(res.(Int64Node)))
+	}
+	require.NoError(t, sc.Close())
+	require.Equal(t, []int{2, 3}, got)
+
+	plan := NewPlan(ctx, and, p)
+	require.Equal(t, "And", plan.Type)
+	require.Equal(t, int64(3), plan.Stats.Next)
+	require.Equal(t, int64(2), plan.Stats.Results)
+	require.Len(t, plan.Sub, 2)
+	require.Equal(t, NodeStats{Next: 4, Results: 3}, withoutTime(plan.Sub[0].Stats))
+	require.Equal(t, NodeStats{Contains: 3, Results: 2}, withoutTime(plan.Sub[1].Stats))
+
+	// plans of trees that were not executed have no statistics
+	plan = NewPlan(ctx, NewAnd(primary), NewProfile())
+	require.Nil(t, plan.Stats)
+	require.Nil(t, plan.Sub[0].Stats)
+
+	// iterators are identified by the order they were started in, thus they can be of any type
+	p = NewProfile()
+	ctx = WithProfile(context.Background(), p)
+	root := uncomparable{Shape: NewFixed(Int64Node(1)), tags: []string{"a"}}
+	sc = Scan(ctx, root)
+	require.True(t, sc.Next(ctx))
+	require.NoError(t, sc.Close())
+	plan = NewPlan(ctx, root, p)
+	require.Equal(t, NodeStats{Next: 1, Results: 1}, withoutTime(plan.Stats))
+}
+
+// uncomparable is an iterator that cannot be used as a map key.
+type uncomparable struct {
+	Shape
+	tags []string
+}
+
+func withoutTime(st *NodeStats) NodeStats {
+	out := *st
+	out.Time = 0
+	return out
+}
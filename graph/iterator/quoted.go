@@ -0,0 +1,435 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// component returns a reference to a component of a quoted triple in a given direction.
+// It returns nil for values that are not quoted triples.
+//
+// Components of quoted triples are not necessarily stored as nodes, thus pre-fetched values
+// are returned for them.
+func component(ctx context.Context, qs refs.Namer, ref refs.Ref, dir quad.Direction) (refs.Ref, error) {
+	v, err := qs.NameOf(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	qt, ok := v.(quad.Quoted)
+	if !ok {
+		return nil, nil
+	}
+	v = qt.Get(dir)
+	if v == nil {
+		return nil, nil
+	}
+	cref, err := qs.ValueOf(ctx, v)
+	if err != nil {
+		return nil, err
+	} else if cref != nil {
+		// some stores return references without checking if the node exists
+		if cv, err := qs.NameOf(ctx, cref); err != nil {
+			return nil, err
+		} else if cv != nil {
+			return cref, nil
+		}
+	}
+	return refs.PreFetched(v), nil
+}
+
+// Unquote iterator enters quoted triples of its subiterator, returning their components in a given direction.
+// Values that are not quoted triples are skipped.
+type Unquote struct {
+	sub Shape
+	dir quad.Direction
+	qs  refs.Namer
+}
+
+func NewUnquote(qs refs.Namer, sub Shape, dir quad.Direction) *Unquote {
+	return &Unquote{
+		sub: sub,
+		dir: dir,
+		qs:  qs,
+	}
+}
+
+func (it *Unquote) Iterate(ctx context.Context) Scanner {
+	return newUnquoteNext(it.qs, Scan(ctx, it.sub), it.dir)
+}
+
+func (it *Unquote) Lookup(ctx context.Context) Index {
+	return newUnquoteContains(it.qs, Scan(ctx, it.sub), it.dir)
+}
+
+func (it *Unquote) SubIterators() []Shape {
+	return []Shape{it.sub}
+}
+
+func (it *Unquote) String() string {
+	return fmt.Sprintf("Unquote(%v)", it.dir)
+}
+
+func (it *Unquote) Optimize(ctx context.Context) (Shape, bool, error) {
+	newSub, changed, err := it.sub.Optimize(ctx)
+	if err != nil {
+		return it, false, err
+	}
+	if changed {
+		it.sub = newSub
+	}
+	return it, false, nil
+}
+
+// Each value of the subiterator is resolved, and the lookup has to scan all of them.
+func (it *Unquote) Stats(ctx context.Context) (Costs, error) {
+	st, err := it.sub.Stats(ctx)
+	st.NextCost += 1
+	st.ContainsCost = st.NextCost * st.Size.Value
+	st.Size.Exact = false
+	return st, err
+}
+
+type unquoteNext struct {
+	sub    Scanner
+	dir    quad.Direction
+	qs     refs.Namer
+	result refs.Ref
+	err    error
+}
+
+func newUnquoteNext(qs refs.Namer, sub Scanner, dir quad.Direction) *unquoteNext {
+	return &unquoteNext{
+		sub: sub,
+		dir: dir,
+		qs:  qs,
+	}
+}
+
+func (it *unquoteNext) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	for it.sub.Next(ctx) {
+		val, err := it.sub.Result(ctx)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		ref, err := component(ctx, it.qs, val, it.dir)
+		if err != nil {
+			it.err = err
+			return false
+		} else if ref != nil {
+			it.result = ref
+			return true
+		}
+	}
+	it.err = it.sub.Err()
+	return false
+}
+
+func (it *unquoteNext) Err() error {
+	return it.err
+}
+
+func (it *unquoteNext) Result(ctx context.Context) (refs.Ref, error) {
+	return it.result, it.err
+}
+
+func (it *unquoteNext) NextPath(ctx context.Context) bool {
+	return it.sub.NextPath(ctx)
+}
+
+func (it *unquoteNext) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	return it.sub.TagResults(ctx, dst)
+}
+
+func (it *unquoteNext) Close() error {
+	return it.sub.Close()
+}
+
+func (it *unquoteNext) String() string {
+	return fmt.Sprintf("UnquoteNext(%v)", it.dir)
+}
+
+// unquoteContains collects components of all quoted triples of the subiterator on the first call.
+// Components are compared by values, since they may be pre-fetched.
+type unquoteContains struct {
+	sub    Scanner
+	dir    quad.Direction
+	qs     refs.Namer
+	values map[string]map[string]refs.Ref // component -> tags
+	tags   map[string]refs.Ref
+	result refs.Ref
+	err    error
+}
+
+func newUnquoteContains(qs refs.Namer, sub Scanner, dir quad.Direction) *unquoteContains {
+	return &unquoteContains{
+		sub: sub,
+		dir: dir,
+		qs:  qs,
+	}
+}
+
+func (it *unquoteContains) materialize(ctx context.Context) error {
+	it.values = make(map[string]map[string]refs.Ref)
+	next := newUnquoteNext(it.qs, it.sub, it.dir)
+	for next.Next(ctx) {
+		ref, _ := next.Result(ctx)
+		v, err := it.qs.NameOf(ctx, ref)
+		if err != nil {
+			return err
+		}
+		key := quad.StringOf(v)
+		if _, ok := it.values[key]; ok {
+			continue
+		}
+		tags := make(map[string]refs.Ref)
+		if err = next.TagResults(ctx, tags); err != nil {
+			return err
+		}
+		it.values[key] = tags
+	}
+	return next.Err()
+}
+
+func (it *unquoteContains) Contains(ctx context.Context, val refs.Ref) (bool, error) {
+	if it.err != nil {
+		return false, it.err
+	}
+	if it.values == nil {
+		if it.err = it.materialize(ctx); it.err != nil {
+			return false, it.err
+		}
+	}
+	v, err := it.qs.NameOf(ctx, val)
+	if err != nil {
+		it.err = err
+		return false, err
+	} else if v == nil {
+		return false, nil
+	}
+	tags, ok := it.values[quad.StringOf(v)]
+	if ok {
+		it.result, it.tags = val, tags
+	}
+	return ok, nil
+}
+
+func (it *unquoteContains) Err() error {
+	return it.err
+}
+
+func (it *unquoteContains) Result(ctx context.Context) (refs.Ref, error) {
+	return it.result, it.err
+}
+
+func (it *unquoteContains) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *unquoteContains) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	for k, v := range it.tags {
+		dst[k] = v
+	}
+	return nil
+}
+
+func (it *unquoteContains) Close() error {
+	return it.sub.Close()
+}
+
+func (it *unquoteContains) String() string {
+	return fmt.Sprintf("UnquoteContains(%v)", it.dir)
+}
+
+// Quote iterator exits quoted triples: it returns quoted triples with components in a given direction
+// contained in its subiterator. The second iterator must list all nodes of the quad store.
+type Quote struct {
+	sub   Shape
+	allIt Shape
+	dir   quad.Direction
+	qs    refs.Namer
+}
+
+func NewQuote(qs refs.Namer, sub, allIt Shape, dir quad.Direction) *Quote {
+	return &Quote{
+		sub:   sub,
+		allIt: allIt,
+		dir:   dir,
+		qs:    qs,
+	}
+}
+
+func (it *Quote) Iterate(ctx context.Context) Scanner {
+	return newQuoteNext(it.qs, Lookup(ctx, it.sub), Scan(ctx, it.allIt), it.dir)
+}
+
+func (it *Quote) Lookup(ctx context.Context) Index {
+	return newQuoteContains(it.qs, Lookup(ctx, it.sub), it.dir)
+}
+
+func (it *Quote) SubIterators() []Shape {
+	return []Shape{it.sub, it.allIt}
+}
+
+func (it *Quote) String() string {
+	return fmt.Sprintf("Quote(%v)", it.dir)
+}
+
+func (it *Quote) Optimize(ctx context.Context) (Shape, bool, error) {
+	newSub, changed, err := it.sub.Optimize(ctx)
+	if err != nil {
+		return it, false, err
+	}
+	if changed {
+		it.sub = newSub
+	}
+	return it, false, nil
+}
+
+func (it *Quote) Stats(ctx context.Context) (Costs, error) {
+	subStats, err := it.sub.Stats(ctx)
+	allStats, err2 := it.allIt.Stats(ctx)
+	if err == nil {
+		err = err2
+	}
+	return Costs{
+		NextCost:     allStats.NextCost + subStats.ContainsCost,
+		ContainsCost: subStats.ContainsCost + 1,
+		Size: refs.Size{
+			Value: subStats.Size.Value,
+			Exact: false,
+		},
+	}, err
+}
+
+type quoteNext struct {
+	sub    *quoteContains
+	allIt  Scanner
+	result refs.Ref
+	err    error
+}
+
+func newQuoteNext(qs refs.Namer, sub Index, allIt Scanner, dir quad.Direction) *quoteNext {
+	return &quoteNext{
+		sub:   newQuoteContains(qs, sub, dir),
+		allIt: allIt,
+	}
+}
+
+func (it *quoteNext) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	for it.allIt.Next(ctx) {
+		val, err := it.allIt.Result(ctx)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		ok, err := it.sub.Contains(ctx, val)
+		if err != nil {
+			it.err = err
+			return false
+		} else if ok {
+			it.result = val
+			return true
+		}
+	}
+	it.err = it.allIt.Err()
+	return false
+}
+
+func (it *quoteNext) Err() error {
+	return it.err
+}
+
+func (it *quoteNext) Result(ctx context.Context) (refs.Ref, error) {
+	return it.result, it.err
+}
+
+func (it *quoteNext) NextPath(ctx context.Context) bool {
+	return it.sub.NextPath(ctx)
+}
+
+func (it *quoteNext) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	return it.sub.TagResults(ctx, dst)
+}
+
+func (it *quoteNext) Close() error {
+	err := it.sub.Close()
+	if err2 := it.allIt.Close(); err2 != nil && err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (it *quoteNext) String() string {
+	return "QuoteNext"
+}
+
+type quoteContains struct {
+	sub    Index
+	dir    quad.Direction
+	qs     refs.Namer
+	result refs.Ref
+	err    error
+}
+
+func newQuoteContains(qs refs.Namer, sub Index, dir quad.Direction) *quoteContains {
+	return &quoteContains{
+		sub: sub,
+		dir: dir,
+		qs:  qs,
+	}
+}
+
+func (it *quoteContains) Contains(ctx context.Context, val refs.Ref) (bool, error) {
+	if it.err != nil {
+		return false, it.err
+	}
+	ref, err := component(ctx, it.qs, val, it.dir)
+	if err != nil {
+		it.err = err
+		return false, err
+	} else if ref == nil {
+		return false, nil
+	}
+	ok, err := it.sub.Contains(ctx, ref)
+	if err != nil {
+		it.err = err
+		return false, err
+	} else if ok {
+		it.result = val
+	}
+	return ok, nil
+}
+
+func (it *quoteContains) Err() error {
+	return it.err
+}
+
+func (it *quoteContains) Result(ctx context.Context) (refs.Ref, error) {
+	return it.result, it.err
+}
+
+func (it *quoteContains) NextPath(ctx context.Context) bool {
+	return it.sub.NextPath(ctx)
+}
+
+func (it *quoteContains) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	return it.sub.TagResults(ctx, dst)
+}
+
+func (it *quoteContains) Close() error {
+	return it.sub.Close()
+}
+
+func (it *quoteContains) String() string {
+	return "QuoteContains"
+}
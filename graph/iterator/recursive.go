@@ -39,11 +39,11 @@ func NewRecursive(it Shape, morphism Morphism, maxDepth int) *Recursive {
 }
 
 func (it *Recursive) Iterate(ctx context.Context) Scanner {
-	return newRecursiveNext(it.subIt.Iterate(ctx), it.morphism, it.maxDepth, it.depthTags)
+	return newRecursiveNext(Scan(ctx, it.subIt), it.morphism, it.maxDepth, it.depthTags)
 }
 
 func (it *Recursive) Lookup(ctx context.Context) Index {
-	return newRecursiveContains(newRecursiveNext(it.subIt.Iterate(ctx), it.morphism, it.maxDepth, it.depthTags))
+	return newRecursiveContains(newRecursiveNext(Scan(ctx, it.subIt), it.morphism, it.maxDepth, it.depthTags))
 }
 
 func (it *Recursive) AddDepthTag(s string) {
@@ -39,11 +39,11 @@ type Save struct {
 }
 
 func (it *Save) Iterate(ctx context.Context) Scanner {
-	return newSaveNext(it.it.Iterate(ctx), it.tags, it.fixedTags)
+	return newSaveNext(Scan(ctx, it.it), it.tags, it.fixedTags)
 }
 
 func (it *Save) Lookup(ctx context.Context) Index {
-	return newSaveContains(it.it.Lookup(ctx), it.tags, it.fixedTags)
+	return newSaveContains(Lookup(ctx, it.it), it.tags, it.fixedTags)
 }
 
 func (it *Save) String() string {
@@ -0,0 +1,607 @@
+package iterator
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// Tags set by ShortestPath on each result.
+const (
+	ShortestPathIndexTag = "path" // index of the path in the result set
+	ShortestPathStepTag  = "step" // position of the node in the path, starting from zero for the source node
+	ShortestPathCostTag  = "cost" // total cost of the path
+)
+
+// WeightFunc returns the cost of the edge from a node to its neighbour. Costs must not be negative.
+type WeightFunc func(ctx context.Context, from, to refs.Ref) (float64, error)
+
+// ShortestPath iterator finds the shortest paths from each result of the sub-iterator to each result of
+// the target iterator, by following a morphism from each node to its neighbours.
+//
+// Without a weight function each step costs one, and paths are found with breadth-first search.
+// Otherwise, each step costs the weight of the edge it follows, and paths are found with Dijkstra's algorithm.
+// If k is more than one, up to k shortest loopless paths are returned for each pair of nodes, using Yen's algorithm.
+//
+// Each node of each path is returned as a separate result, in order from the source to the target.
+// Results are tagged with ShortestPathIndexTag, ShortestPathStepTag and ShortestPathCostTag,
+// as well as with tags of the source node.
+type ShortestPath struct {
+	subIt    Shape
+	to       Shape
+	morphism Morphism
+	weight   WeightFunc
+	k        int
+}
+
+// NewShortestPath creates a new shortest path iterator from the results of it to the results of to.
+// If weight is nil, each step costs one. If k is less than one, only the shortest path is returned.
+func NewShortestPath(it, to Shape, morphism Morphism, weight WeightFunc, k int) *ShortestPath {
+	return &ShortestPath{
+		subIt:    it,
+		to:       to,
+		morphism: morphism,
+		weight:   weight,
+		k:        max(k, 1),
+	}
+}
+
+func (it *ShortestPath) Iterate(ctx context.Context) Scanner {
+	return newShortestPathNext(Scan(ctx, it.subIt), it.to, it.morphism, it.weight, it.k)
+}
+
+func (it *ShortestPath) Lookup(ctx context.Context) Index {
+	return newShortestPathContains(it.Iterate(ctx))
+}
+
+func (it *ShortestPath) SubIterators() []Shape {
+	return []Shape{it.subIt, it.to}
+}
+
+func (it *ShortestPath) Optimize(ctx context.Context) (Shape, bool, error) {
+	sub, opt1, err := it.subIt.Optimize(ctx)
+	if err != nil {
+		return it, false, err
+	}
+	to, opt2, err := it.to.Optimize(ctx)
+	if err != nil {
+		return it, false, err
+	}
+	if !opt1 && !opt2 {
+		return it, false, nil
+	}
+	return NewShortestPath(sub, to, it.morphism, it.weight, it.k), true, nil
+}
+
+func (it *ShortestPath) Stats(ctx context.Context) (Costs, error) {
+	subStats, err := it.subIt.Stats(ctx)
+	toStats, err2 := it.to.Stats(ctx)
+	if err == nil {
+		err = err2
+	}
+	// each path visits a fraction of the graph, and has a few nodes
+	size := subStats.Size.Value * toStats.Size.Value * int64(it.k) * 5
+	return Costs{
+		NextCost:     subStats.NextCost + toStats.NextCost + 100,
+		ContainsCost: (subStats.NextCost + toStats.NextCost + 100) * size,
+		Size: refs.Size{
+			Value: size,
+			Exact: false,
+		},
+	}, err
+}
+
+func (it *ShortestPath) String() string {
+	return fmt.Sprintf("ShortestPath(k=%d, weighted=%v)", it.k, it.weight != nil)
+}
+
+// spNode is a node of the graph explored by the shortest path search.
+type spNode struct {
+	ref  refs.Ref
+	next []spEdge // edges to neighbours
+}
+
+// spEdge is an edge to a neighbour of a node.
+type spEdge struct {
+	key  any // key of the neighbour
+	cost float64
+}
+
+// spPath is a path found by the search, as a sequence of node keys.
+type spPath struct {
+	nodes []any
+	cost  float64
+}
+
+type shortestPathNext struct {
+	subIt    Scanner
+	to       Shape
+	morphism Morphism
+	weight   WeightFunc
+	k        int
+
+	targets []any // keys of target nodes, in order
+	isDst   map[any]bool
+	graph   map[any]*spNode
+	sources map[any]bool
+
+	paths  int               // number of paths returned so far
+	rows   []shortestPathRow // rows of the current source
+	row    int               // index of the current row
+	result shortestPathRow   // current row
+	err    error
+}
+
+type shortestPathRow struct {
+	node refs.Ref
+	tags map[string]refs.Ref
+}
+
+func newShortestPathNext(sub Scanner, to Shape, morphism Morphism, weight WeightFunc, k int) *shortestPathNext {
+	return &shortestPathNext{
+		subIt:    sub,
+		to:       to,
+		morphism: morphism,
+		weight:   weight,
+		k:        k,
+		graph:    make(map[any]*spNode),
+		sources:  make(map[any]bool),
+	}
+}
+
+func (it *shortestPathNext) loadTargets(ctx context.Context) error {
+	it.isDst = make(map[any]bool)
+	sc := Scan(ctx, it.to)
+	defer sc.Close()
+	for sc.Next(ctx) {
+		ref, err := sc.Result(ctx)
+		if err != nil {
+			return err
+		}
+		if key := refs.ToKey(ref); !it.isDst[key] {
+			it.isDst[key] = true
+			it.targets = append(it.targets, key)
+			if err := it.addNode(ctx, ref); err != nil {
+				return err
+			}
+		}
+	}
+	return sc.Err()
+}
+
+// addNode adds a node to the graph, without loading its neighbours.
+func (it *shortestPathNext) addNode(ctx context.Context, ref refs.Ref) error {
+	key := refs.ToKey(ref)
+	if _, ok := it.graph[key]; ok {
+		return nil
+	}
+	it.graph[key] = &spNode{ref: ref}
+	return nil
+}
+
+// neighbours returns edges to nodes that can be reached in one step from a given node.
+func (it *shortestPathNext) neighbours(ctx context.Context, key any) ([]spEdge, error) {
+	n := it.graph[key]
+	if n.next != nil {
+		return n.next, nil
+	}
+	n.next = []spEdge{}
+	sc := it.morphism(ctx, NewFixed(n.ref)).Iterate(ctx)
+	defer sc.Close()
+	seen := make(map[any]bool)
+	for sc.Next(ctx) {
+		ref, err := sc.Result(ctx)
+		if err != nil {
+			return nil, err
+		}
+		k := refs.ToKey(ref)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if err := it.addNode(ctx, ref); err != nil {
+			return nil, err
+		}
+		e := spEdge{key: k, cost: 1}
+		if it.weight != nil {
+			w, err := it.weight(ctx, n.ref, ref)
+			if err != nil {
+				return nil, err
+			} else if w < 0 {
+				return nil, fmt.Errorf("shortest path: negative weight %v", w)
+			}
+			e.cost = w
+		}
+		n.next = append(n.next, e)
+	}
+	return n.next, sc.Err()
+}
+
+// search finds the shortest paths from a source node to given targets, avoiding banned nodes and edges.
+// It returns the paths in the order of targets, with nil for unreachable ones.
+func (it *shortestPathNext) search(ctx context.Context, src any, dst []any, bannedNodes map[any]bool, bannedEdges map[[2]any]bool) ([]*spPath, error) {
+	prev := map[any]any{src: nil}
+	dist := map[any]float64{src: 0}
+	left := len(dst)
+	want := make(map[any]bool, len(dst))
+	for _, k := range dst {
+		want[k] = true
+	}
+	visit := func(k any) {
+		if want[k] {
+			delete(want, k)
+			left--
+		}
+	}
+	if it.weight == nil {
+		// breadth-first search
+		queue := []any{src}
+		visit(src)
+		for len(queue) != 0 && left > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			next, err := it.neighbours(ctx, cur)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range next {
+				k := e.key
+				if _, ok := prev[k]; ok || bannedNodes[k] || bannedEdges[[2]any{cur, k}] {
+					continue
+				}
+				prev[k] = cur
+				dist[k] = dist[cur] + 1
+				visit(k)
+				queue = append(queue, k)
+			}
+		}
+	} else {
+		// Dijkstra's algorithm
+		done := make(map[any]bool)
+		pq := &spQueue{{key: src}}
+		seq := 0
+		for pq.Len() != 0 && left > 0 {
+			cur := heap.Pop(pq).(spItem)
+			if done[cur.key] {
+				continue
+			}
+			done[cur.key] = true
+			visit(cur.key)
+			next, err := it.neighbours(ctx, cur.key)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range next {
+				k := e.key
+				if done[k] || bannedNodes[k] || bannedEdges[[2]any{cur.key, k}] {
+					continue
+				}
+				d := cur.dist + e.cost
+				if old, ok := dist[k]; ok && old <= d {
+					continue
+				}
+				dist[k] = d
+				prev[k] = cur.key
+				seq++
+				heap.Push(pq, spItem{key: k, dist: d, seq: seq})
+			}
+		}
+	}
+	out := make([]*spPath, len(dst))
+	for i, k := range dst {
+		if _, ok := prev[k]; !ok {
+			continue
+		}
+		var nodes []any
+		for cur := k; cur != nil; cur = prev[cur] {
+			nodes = append(nodes, cur)
+		}
+		slices.Reverse(nodes)
+		out[i] = &spPath{nodes: nodes, cost: dist[k]}
+	}
+	return out, nil
+}
+
+// pathCost returns the cost of a path. Edges of the path must be loaded by neighbours.
+func (it *shortestPathNext) pathCost(nodes []any) float64 {
+	var cost float64
+	for i, k := range nodes[1:] {
+		for _, e := range it.graph[nodes[i]].next {
+			if e.key == k {
+				cost += e.cost
+				break
+			}
+		}
+	}
+	return cost
+}
+
+// kShortest finds up to k shortest loopless paths between two nodes with Yen's algorithm.
+func (it *shortestPathNext) kShortest(ctx context.Context, src, dst any) ([]*spPath, error) {
+	first, err := it.search(ctx, src, []any{dst}, nil, nil)
+	if err != nil || first[0] == nil {
+		return nil, err
+	}
+	found := []*spPath{first[0]}
+	var candidates []*spPath
+	for len(found) < it.k {
+		last := found[len(found)-1]
+		for i := 0; i < len(last.nodes)-1; i++ {
+			spur, root := last.nodes[i], last.nodes[:i+1]
+			bannedEdges := make(map[[2]any]bool)
+			for _, p := range found {
+				if len(p.nodes) > i+1 && slices.Equal(p.nodes[:i+1], root) {
+					bannedEdges[[2]any{p.nodes[i], p.nodes[i+1]}] = true
+				}
+			}
+			bannedNodes := make(map[any]bool, i)
+			for _, k := range root[:i] {
+				bannedNodes[k] = true
+			}
+			spurPath, err := it.search(ctx, spur, []any{dst}, bannedNodes, bannedEdges)
+			if err != nil {
+				return nil, err
+			} else if spurPath[0] == nil {
+				continue
+			}
+			nodes := append(slices.Clone(root[:i]), spurPath[0].nodes...)
+			if !hasPath(found, nodes) && !hasPath(candidates, nodes) {
+				candidates = append(candidates, &spPath{nodes: nodes, cost: it.pathCost(nodes)})
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		best := 0
+		for i, p := range candidates {
+			if p.cost < candidates[best].cost || (p.cost == candidates[best].cost && len(p.nodes) < len(candidates[best].nodes)) {
+				best = i
+			}
+		}
+		found = append(found, candidates[best])
+		candidates = slices.Delete(candidates, best, best+1)
+	}
+	return found, nil
+}
+
+func hasPath(paths []*spPath, nodes []any) bool {
+	return slices.ContainsFunc(paths, func(p *spPath) bool {
+		return slices.Equal(p.nodes, nodes)
+	})
+}
+
+// nextSource finds paths from the next source node and converts them to rows.
+func (it *shortestPathNext) nextSource(ctx context.Context) bool {
+	for it.subIt.Next(ctx) {
+		ref, err := it.subIt.Result(ctx)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		src := refs.ToKey(ref)
+		if it.sources[src] {
+			continue
+		}
+		it.sources[src] = true
+		tags := make(map[string]refs.Ref)
+		if err := it.subIt.TagResults(ctx, tags); err != nil {
+			it.err = err
+			return false
+		}
+		if err := it.addNode(ctx, ref); err != nil {
+			it.err = err
+			return false
+		}
+		var paths []*spPath
+		if it.k == 1 {
+			paths, err = it.search(ctx, src, it.targets, nil, nil)
+		} else {
+			for _, dst := range it.targets {
+				var found []*spPath
+				found, err = it.kShortest(ctx, src, dst)
+				if err != nil {
+					break
+				}
+				paths = append(paths, found...)
+			}
+		}
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.rows = it.rows[:0]
+		for _, p := range paths {
+			if p == nil {
+				continue
+			}
+			it.addRows(p, tags)
+		}
+		if len(it.rows) != 0 {
+			return true
+		}
+	}
+	it.err = it.subIt.Err()
+	return false
+}
+
+func (it *shortestPathNext) addRows(p *spPath, tags map[string]refs.Ref) {
+	var cost quad.Value = quad.Int(p.cost)
+	if it.weight != nil {
+		cost = quad.Float(p.cost)
+	}
+	for i, k := range p.nodes {
+		row := shortestPathRow{
+			node: it.graph[k].ref,
+			tags: maps.Clone(tags),
+		}
+		row.tags[ShortestPathIndexTag] = refs.PreFetched(quad.Int(it.paths))
+		row.tags[ShortestPathStepTag] = refs.PreFetched(quad.Int(i))
+		row.tags[ShortestPathCostTag] = refs.PreFetched(cost)
+		it.rows = append(it.rows, row)
+	}
+	it.paths++
+}
+
+func (it *shortestPathNext) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if it.isDst == nil {
+		if err := it.loadTargets(ctx); err != nil {
+			it.err = err
+			return false
+		}
+	}
+	if it.row+1 < len(it.rows) {
+		it.row++
+		it.result = it.rows[it.row]
+		return true
+	}
+	if !it.nextSource(ctx) {
+		return false
+	}
+	it.row = 0
+	it.result = it.rows[0]
+	return true
+}
+
+func (it *shortestPathNext) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *shortestPathNext) Result(ctx context.Context) (refs.Ref, error) {
+	return it.result.node, it.err
+}
+
+func (it *shortestPathNext) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	if it.err != nil {
+		return it.err
+	}
+	maps.Copy(dst, it.result.tags)
+	return nil
+}
+
+func (it *shortestPathNext) Err() error {
+	return it.err
+}
+
+func (it *shortestPathNext) Close() error {
+	it.graph = nil
+	it.rows = nil
+	return it.subIt.Close()
+}
+
+func (it *shortestPathNext) String() string {
+	return "ShortestPathNext"
+}
+
+// shortestPathContains checks if a node belongs to any of the shortest paths.
+type shortestPathContains struct {
+	next  Scanner
+	rows  map[any][]shortestPathRow
+	cur   []shortestPathRow
+	index int
+	err   error
+}
+
+func newShortestPathContains(next Scanner) *shortestPathContains {
+	return &shortestPathContains{next: next}
+}
+
+func (it *shortestPathContains) load(ctx context.Context) error {
+	it.rows = make(map[any][]shortestPathRow)
+	for it.next.Next(ctx) {
+		ref, err := it.next.Result(ctx)
+		if err != nil {
+			return err
+		}
+		tags := make(map[string]refs.Ref)
+		if err := it.next.TagResults(ctx, tags); err != nil {
+			return err
+		}
+		key := refs.ToKey(ref)
+		it.rows[key] = append(it.rows[key], shortestPathRow{node: ref, tags: tags})
+	}
+	return it.next.Err()
+}
+
+func (it *shortestPathContains) Contains(ctx context.Context, v refs.Ref) (bool, error) {
+	if it.err != nil {
+		return false, it.err
+	}
+	if it.rows == nil {
+		if err := it.load(ctx); err != nil {
+			it.err = err
+			return false, err
+		}
+	}
+	it.cur, it.index = it.rows[refs.ToKey(v)], 0
+	return len(it.cur) != 0, nil
+}
+
+func (it *shortestPathContains) NextPath(ctx context.Context) bool {
+	if it.index+1 >= len(it.cur) {
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *shortestPathContains) Result(ctx context.Context) (refs.Ref, error) {
+	if len(it.cur) == 0 {
+		return nil, it.err
+	}
+	return it.cur[it.index].node, it.err
+}
+
+func (it *shortestPathContains) TagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	if it.err != nil {
+		return it.err
+	}
+	if len(it.cur) != 0 {
+		maps.Copy(dst, it.cur[it.index].tags)
+	}
+	return nil
+}
+
+func (it *shortestPathContains) Err() error {
+	return it.err
+}
+
+func (it *shortestPathContains) Close() error {
+	return it.next.Close()
+}
+
+func (it *shortestPathContains) String() string {
+	return "ShortestPathContains"
+}
+
+type spItem struct {
+	key  any
+	dist float64
+	seq  int
+}
+
+// spQueue is a priority queue of nodes ordered by distance. Nodes with the same distance are ordered by insertion.
+type spQueue []spItem
+
+func (q spQueue) Len() int { return len(q) }
+func (q spQueue) Less(i, j int) bool {
+	if q[i].dist != q[j].dist {
+		return q[i].dist < q[j].dist
+	}
+	return q[i].seq < q[j].seq
+}
+func (q spQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *spQueue) Push(x any)   { *q = append(*q, x.(spItem)) }
+func (q *spQueue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,89 @@
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+func shortestPathRows(t *testing.T, it Shape) (nodes []string, costs []quad.Value) {
+	ctx := context.Background()
+	sc := it.Iterate(ctx)
+	defer sc.Close()
+	for sc.Next(ctx) {
+		ref, err := sc.Result(ctx)
+		require.NoError(t, err)
+		qn, err := recTestQs.NameOf(ctx, ref)
+		require.NoError(t, err)
+		nodes = append(nodes, quad.ToString(qn))
+		tags := make(map[string]refs.Ref)
+		require.NoError(t, sc.TagResults(ctx, tags))
+		costs = append(costs, tags[ShortestPathCostTag].Key().(quad.Value))
+	}
+	require.NoError(t, sc.Err())
+	return nodes, costs
+}
+
+func fixedOf(names ...string) *Fixed {
+	fixed := NewFixed()
+	for _, name := range names {
+		fixed.Add(refs.PreFetched(quad.Raw(name)))
+	}
+	return fixed
+}
+
+func TestShortestPath(t *testing.T) {
+	hop := singleHop(recTestQs, "parent")
+
+	nodes, costs := shortestPathRows(t, NewShortestPath(fixedOf("alice"), fixedOf("dani"), hop, nil, 1))
+	require.Equal(t, []string{"alice", "bob", "charlie", "dani"}, nodes)
+	require.Equal(t, []quad.Value{quad.Int(3), quad.Int(3), quad.Int(3), quad.Int(3)}, costs)
+
+	// the edge from bob to charlie is expensive, but it's the only way
+	weight := func(ctx context.Context, from, to refs.Ref) (float64, error) {
+		qf, err := recTestQs.NameOf(ctx, from)
+		if err != nil {
+			return 0, err
+		}
+		qt, err := recTestQs.NameOf(ctx, to)
+		if err != nil {
+			return 0, err
+		}
+		if quad.ToString(qf) == "bob" && quad.ToString(qt) == "charlie" {
+			return 10, nil
+		}
+		return 1, nil
+	}
+	nodes, costs = shortestPathRows(t, NewShortestPath(fixedOf("bob"), fixedOf("emily"), hop, weight, 2))
+	require.Equal(t, []string{"bob", "charlie", "dani", "emily"}, nodes)
+	require.Equal(t, []quad.Value{quad.Float(12), quad.Float(12), quad.Float(12), quad.Float(12)}, costs)
+
+	nodes, _ = shortestPathRows(t, NewShortestPath(fixedOf("emily"), fixedOf("alice"), hop, nil, 1))
+	require.Empty(t, nodes)
+}
+
+func TestShortestPathNegativeWeight(t *testing.T) {
+	ctx := context.Background()
+	weight := func(ctx context.Context, from, to refs.Ref) (float64, error) {
+		return -1, nil
+	}
+	sc := NewShortestPath(fixedOf("alice"), fixedOf("bob"), singleHop(recTestQs, "parent"), weight, 1).Iterate(ctx)
+	defer sc.Close()
+	require.False(t, sc.Next(ctx))
+	require.Error(t, sc.Err())
+
+	errWeight := errors.New("no weight")
+	weight = func(ctx context.Context, from, to refs.Ref) (float64, error) {
+		return 0, errWeight
+	}
+	sc = NewShortestPath(fixedOf("alice"), fixedOf("bob"), singleHop(recTestQs, "parent"), weight, 1).Iterate(ctx)
+	defer sc.Close()
+	require.False(t, sc.Next(ctx))
+	require.ErrorIs(t, sc.Err(), errWeight)
+}
@@ -21,11 +21,11 @@ func NewSkip(primaryIt Shape, off int64) *Skip {
 }
 
 func (it *Skip) Iterate(ctx context.Context) Scanner {
-	return newSkipNext(it.primaryIt.Iterate(ctx), it.skip)
+	return newSkipNext(Scan(ctx, it.primaryIt), it.skip)
 }
 
 func (it *Skip) Lookup(ctx context.Context) Index {
-	return newSkipContains(it.primaryIt.Lookup(ctx), it.skip)
+	return newSkipContains(Lookup(ctx, it.primaryIt), it.skip)
 }
 
 // SubIterators returns a slice of the sub iterators.
@@ -1,36 +1,112 @@
 package iterator
 
 import (
+	"bufio"
+	"container/heap"
 	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
 	"maps"
-	"sort"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
 
 	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/pquads"
 )
 
+// SortMemoryLimit is the number of results Sort keeps in memory.
+// Larger result sets are sorted in chunks that are spilled to temporary files and merged.
+var SortMemoryLimit = 100000
+
+// SortKey describes a single key of the sort order.
+type SortKey struct {
+	// Tag is a tag with values to sort by. If empty, results of the subiterator are used.
+	Tag string
+	// Desc reverses the order.
+	Desc bool
+	// Lang is a BCP 47 language tag used to collate strings.
+	// If empty, strings are compared by code points.
+	Lang string
+}
+
+func (k SortKey) String() string {
+	s := k.Tag
+	if s == "" {
+		s = "*"
+	}
+	if k.Lang != "" {
+		s += "@" + k.Lang
+	}
+	if k.Desc {
+		s += " desc"
+	}
+	return s
+}
+
 // Sort iterator orders values from it's subiterator.
+//
+// Values are compared according to their types: blank nodes go first, followed by IRIs, booleans,
+// numbers (both quad.Int and quad.Float), times and strings. Values of the same kind are compared
+// by their values. Typed strings of known types are compared as parsed values, see quad.TypedString.ParseValue.
+// Results with equal keys preserve the order of the subiterator.
 type Sort struct {
 	namer refs.Namer
 	subIt Shape
+	keys  []SortKey
+	from  []quad.Value
 }
 
-// NewSort creates a new Sort iterator.
+// NewSort creates a new Sort iterator that orders results of the subiterator.
 // TODO(dennwc): This iterator must not be used inside And: it may be moved to a Contains branch and won't do anything.
 //
 //	We should make And/Intersect account for this.
 func NewSort(namer refs.Namer, subIt Shape) *Sort {
-	return &Sort{namer, subIt}
+	return NewSortBy(namer, subIt)
+}
+
+// NewSortBy creates a new Sort iterator that orders results of the subiterator by given keys.
+// If no keys are given, the results are sorted in ascending order.
+//
+// If any of the keys refers to a tag, each path of the subiterator is returned as a separate result.
+func NewSortBy(namer refs.Namer, subIt Shape, keys ...SortKey) *Sort {
+	if len(keys) == 0 {
+		keys = []SortKey{{}}
+	}
+	return &Sort{namer: namer, subIt: subIt, keys: keys}
+}
+
+// Keys returns keys of the sort order.
+func (it *Sort) Keys() []SortKey {
+	return it.keys
+}
+
+// From returns a copy of the iterator that skips results ordered before the given values of the sort keys.
+// Results are dropped before sorting, thus they don't take memory.
+func (it *Sort) From(keys []quad.Value) *Sort {
+	s := *it
+	s.from = keys
+	return &s
 }
 
 func (it *Sort) Iterate(ctx context.Context) Scanner {
-	return newSortNext(it.namer, it.subIt.Iterate(ctx))
+	sc := newSortNext(it.namer, Scan(ctx, it.subIt), it.keys)
+	sc.from = it.from
+	return sc
 }
 
 func (it *Sort) Lookup(ctx context.Context) Index {
 	// TODO(dennwc): Lookup doesn't need any sorting. Using it this way is a bug in the optimizer.
 	//               But instead of failing here, let still allow the query to execute. It won't be sorted,
 	//               but it will work at least. Later consider changing returning an error here.
-	return it.subIt.Lookup(ctx)
+	return Lookup(ctx, it.subIt)
 }
 
 func (it *Sort) Optimize(ctx context.Context) (Shape, bool, error) {
@@ -58,7 +134,10 @@ func (it *Sort) Stats(ctx context.Context) (Costs, error) {
 }
 
 func (it *Sort) String() string {
-	return "Sort"
+	if len(it.keys) == 1 && it.keys[0] == (SortKey{}) {
+		return "Sort"
+	}
+	return fmt.Sprintf("Sort(%v)", it.keys)
 }
 
 // SubIterators returns a slice of the sub iterators.
@@ -66,33 +145,174 @@ func (it *Sort) SubIterators() []Shape {
 	return []Shape{it.subIt}
 }
 
-type sortValue struct {
+// byTags reports if any of the keys refers to a tag.
+func byTags(keys []SortKey) bool {
+	for _, k := range keys {
+		if k.Tag != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// valueKind returns a rank of the value type in the sort order.
+func valueKind(v quad.Value) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case quad.BNode:
+		return 1
+	case quad.IRI:
+		return 2
+	case quad.Bool:
+		return 3
+	case quad.Int, quad.Float:
+		return 4
+	case quad.Time:
+		return 5
+	case quad.String, quad.LangString, quad.TypedString:
+		return 6
+	}
+	return 7
+}
+
+func stringValue(v quad.Value) string {
+	switch v := v.(type) {
+	case quad.String:
+		return string(v)
+	case quad.LangString:
+		return string(v.Value)
+	case quad.TypedString:
+		return string(v.Value)
+	case quad.IRI:
+		return string(v)
+	case quad.BNode:
+		return string(v)
+	}
+	return v.String()
+}
+
+// CompareValues compares two values according to the typed sort order. Strings are compared with a collator,
+// if it's not nil. It returns a negative number if a < b, zero if a == b and a positive number if a > b.
+func CompareValues(a, b quad.Value, coll *collate.Collator) int {
+	ka, kb := valueKind(a), valueKind(b)
+	if ka != kb {
+		return ka - kb
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case quad.Bool:
+		b := b.(quad.Bool)
+		switch {
+		case a == b:
+			return 0
+		case !bool(a):
+			return -1
+		}
+		return +1
+	case quad.Int:
+		if b, ok := b.(quad.Int); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return +1
+			}
+			return 0
+		}
+		return cmpFloat(float64(a), aggNumber(b))
+	case quad.Float:
+		return cmpFloat(float64(a), aggNumber(b))
+	case quad.Time:
+		return time.Time(a).Compare(time.Time(b.(quad.Time)))
+	case quad.String, quad.LangString, quad.TypedString:
+		sa, sb := stringValue(a), stringValue(b)
+		if coll != nil {
+			return coll.CompareString(sa, sb)
+		}
+		return strings.Compare(sa, sb)
+	}
+	return strings.Compare(stringValue(a), stringValue(b))
+}
+
+// sortRecord is a single sorted result with its sort keys. In the grouped mode, it also holds all the next paths.
+type sortRecord struct {
 	result
-	str   string
+	seq   int64
+	keys  []quad.Value
 	paths []result
 }
-type sortByString []sortValue
 
-func (v sortByString) Len() int { return len(v) }
-func (v sortByString) Less(i, j int) bool {
-	return v[i].str < v[j].str
+// sortOrder compares sort records.
+type sortOrder struct {
+	keys  []SortKey
+	colls []*collate.Collator
+}
+
+func newSortOrder(keys []SortKey) *sortOrder {
+	o := &sortOrder{keys: keys, colls: make([]*collate.Collator, len(keys))}
+	for i, k := range keys {
+		if k.Lang != "" {
+			o.colls[i] = collate.New(language.Make(k.Lang))
+		}
+	}
+	return o
+}
+
+func (o *sortOrder) compare(a, b *sortRecord) int {
+	if c := o.compareKeys(a.keys, b.keys); c != 0 {
+		return c
+	}
+	switch {
+	case a.seq < b.seq:
+		return -1
+	case a.seq > b.seq:
+		return +1
+	}
+	return 0
+}
+
+// compareKeys compares values of sort keys.
+func (o *sortOrder) compareKeys(a, b []quad.Value) int {
+	for i, k := range o.keys {
+		c := CompareValues(a[i], b[i], o.colls[i])
+		if k.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
 }
-func (v sortByString) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
 
 type sortNext struct {
-	namer     refs.Namer
-	subIt     Scanner
-	ordered   sortByString
+	namer   refs.Namer
+	subIt   Scanner
+	keys    []SortKey
+	flat    bool
+	order   *sortOrder
+	from    []quad.Value // records before these keys are skipped
+	started bool
+
+	// sorted records; they are either read from memory or merged from spilled runs
+	sources sortMerge
+	spilled []*sortRun
+	cur     *sortRecord
+
 	result    result
 	err       error
-	index     int
 	pathIndex int
 }
 
-func newSortNext(namer refs.Namer, subIt Scanner) *sortNext {
+func newSortNext(namer refs.Namer, subIt Scanner, keys []SortKey) *sortNext {
 	return &sortNext{
 		namer:     namer,
 		subIt:     subIt,
+		keys:      keys,
+		flat:      byTags(keys),
+		order:     newSortOrder(keys),
 		pathIndex: -1,
 	}
 }
@@ -114,78 +334,393 @@ func (it *sortNext) Next(ctx context.Context) bool {
 	if it.err != nil {
 		return false
 	}
-	if it.ordered == nil {
-		v, err := getSortedValues(ctx, it.namer, it.subIt)
-		it.ordered = v
-		it.err = err
-		if it.err != nil {
+	if !it.started {
+		it.started = true
+		if it.err = it.sortValues(ctx); it.err != nil {
 			return false
 		}
 	}
-	if it.index >= len(it.ordered) {
+	it.cur, it.err = it.sources.pop(ctx, it)
+	if it.err != nil || it.cur == nil {
+		it.result = result{}
 		return false
 	}
 	it.pathIndex = -1
-	it.result = it.ordered[it.index].result
-	it.index++
+	it.result = it.cur.result
 	return true
 }
 
 func (it *sortNext) NextPath(ctx context.Context) bool {
-	if it.index >= len(it.ordered) {
+	if it.cur == nil {
 		return false
 	}
-	r := it.ordered[it.index]
-	if it.pathIndex+1 >= len(r.paths) {
+	if it.pathIndex+1 >= len(it.cur.paths) {
 		return false
 	}
 	it.pathIndex++
-	it.result = r.paths[it.pathIndex]
+	it.result = it.cur.paths[it.pathIndex]
 	return true
 }
 
 func (it *sortNext) Close() error {
-	it.ordered = nil
-	return it.subIt.Close()
+	it.sources = nil
+	err := it.subIt.Close()
+	for _, r := range it.spilled {
+		if err2 := r.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	it.spilled = nil
+	return err
 }
 
 func (it *sortNext) String() string {
 	return "SortNext"
 }
 
-func getSortedValues(ctx context.Context, namer refs.Namer, it Scanner) (sortByString, error) {
-	var v sortByString
-	for it.Next(ctx) {
-		id, err := it.Result(ctx)
-		if err != nil {
-			return nil, err
+func (it *sortNext) nameOf(ctx context.Context, ref refs.Ref) (quad.Value, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	if v, ok := ref.(refs.PreFetchedValue); ok {
+		return v.NameOf(), nil
+	}
+	return it.namer.NameOf(ctx, ref)
+}
+
+// newRecord reads the current path of the subiterator.
+func (it *sortNext) newRecord(ctx context.Context, seq int64) (*sortRecord, error) {
+	id, err := it.subIt.Result(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]refs.Ref)
+	if err := it.subIt.TagResults(ctx, tags); err != nil {
+		return nil, err
+	}
+	r := &sortRecord{result: result{id, tags}, seq: seq}
+	if r.keys, err = it.keysOf(ctx, r.result); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// keysOf derives the sort keys of a result. It is used both for fresh and spilled records,
+// so that they are always compared the same way.
+func (it *sortNext) keysOf(ctx context.Context, res result) ([]quad.Value, error) {
+	keys := make([]quad.Value, len(it.keys))
+	for i, k := range it.keys {
+		ref := res.id
+		if k.Tag != "" {
+			ref = res.tags[k.Tag]
 		}
 		// TODO(dennwc): batch and use refs.ValuesOf
-		name, err := namer.NameOf(ctx, id)
+		v, err := it.nameOf(ctx, ref)
 		if err != nil {
 			return nil, err
 		}
-		str := name.String()
-		tags := make(map[string]refs.Ref)
-		if err := it.TagResults(ctx, tags); err != nil {
-			return nil, err
+		if ts, ok := v.(quad.TypedString); ok {
+			if pv, err := ts.ParseValue(); err == nil {
+				v = pv
+			}
+		}
+		keys[i] = v
+	}
+	return keys, nil
+}
+
+func (it *sortNext) sortValues(ctx context.Context) error {
+	var (
+		mem []*sortRecord
+		seq int64
+	)
+	add := func(r *sortRecord) error {
+		seq++
+		if it.from != nil && it.order.compareKeys(r.keys, it.from) < 0 {
+			return nil
 		}
-		val := sortValue{
-			result: result{id, tags},
-			str:    str,
+		mem = append(mem, r)
+		if len(mem) < SortMemoryLimit {
+			return nil
 		}
-		for it.NextPath(ctx) {
-			tags = make(map[string]refs.Ref)
-			if err := it.TagResults(ctx, tags); err != nil {
+		run, err := it.spill(ctx, mem)
+		if err != nil {
+			return err
+		}
+		it.spilled = append(it.spilled, run)
+		mem = nil
+		return nil
+	}
+	for it.subIt.Next(ctx) {
+		r, err := it.newRecord(ctx, seq)
+		if err != nil {
+			return err
+		}
+		for it.subIt.NextPath(ctx) {
+			if it.flat {
+				if err = add(r); err != nil {
+					return err
+				}
+				if r, err = it.newRecord(ctx, seq); err != nil {
+					return err
+				}
+				continue
+			}
+			tags := make(map[string]refs.Ref)
+			if err := it.subIt.TagResults(ctx, tags); err != nil {
+				return err
+			}
+			r.paths = append(r.paths, result{r.id, tags})
+		}
+		if err = add(r); err != nil {
+			return err
+		}
+	}
+	if err := it.subIt.Err(); err != nil {
+		return err
+	}
+	slices.SortFunc(mem, it.order.compare)
+	it.sources = sortMerge{&memRun{recs: mem}}
+	for _, r := range it.spilled {
+		it.sources = append(it.sources, r)
+	}
+	return it.sources.init(ctx, it)
+}
+
+// sortSource is a sorted sequence of records.
+type sortSource interface {
+	next(ctx context.Context, it *sortNext) (*sortRecord, error)
+}
+
+type memRun struct {
+	recs []*sortRecord
+}
+
+func (r *memRun) next(ctx context.Context, it *sortNext) (*sortRecord, error) {
+	if len(r.recs) == 0 {
+		return nil, nil
+	}
+	rec := r.recs[0]
+	r.recs = r.recs[1:]
+	return rec, nil
+}
+
+// spilledResult is a serialized form of a result. Values are stored in protobuf encoding.
+type spilledResult struct {
+	ID   []byte
+	Tags map[string][]byte
+}
+
+type spilledRecord struct {
+	Result spilledResult
+	Seq    int64
+	Paths  []spilledResult
+}
+
+// sortRun is a sorted chunk of records stored in a temporary file.
+type sortRun struct {
+	f   *os.File
+	dec *gob.Decoder
+}
+
+func (r *sortRun) Close() error {
+	name := r.f.Name()
+	err := r.f.Close()
+	if err2 := os.Remove(name); err2 != nil && err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (it *sortNext) marshalResult(ctx context.Context, res result) (spilledResult, error) {
+	var (
+		out spilledResult
+		err error
+	)
+	if out.ID, err = it.marshalRef(ctx, res.id); err != nil {
+		return out, err
+	}
+	out.Tags = make(map[string][]byte, len(res.tags))
+	for k, ref := range res.tags {
+		if out.Tags[k], err = it.marshalRef(ctx, ref); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func (it *sortNext) marshalRef(ctx context.Context, ref refs.Ref) ([]byte, error) {
+	v, err := it.nameOf(ctx, ref)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return pquads.MarshalValue(v)
+}
+
+func (it *sortNext) unmarshalResult(ctx context.Context, in spilledResult) (result, error) {
+	var (
+		out result
+		err error
+	)
+	if out.id, err = it.unmarshalRef(ctx, in.ID); err != nil {
+		return out, err
+	}
+	out.tags = make(map[string]refs.Ref, len(in.Tags))
+	for k, data := range in.Tags {
+		if out.tags[k], err = it.unmarshalRef(ctx, data); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// unmarshalRef decodes a value and converts it back to a reference of the quad store.
+func (it *sortNext) unmarshalRef(ctx context.Context, data []byte) (refs.Ref, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	v, err := pquads.UnmarshalValue(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := it.namer.ValueOf(ctx, v)
+	if err != nil {
+		return nil, err
+	} else if ref == nil {
+		// value is not in the quad store; for example, a result of an aggregation
+		ref = refs.PreFetched(v)
+	}
+	return ref, nil
+}
+
+// spill sorts records and writes them to a temporary file.
+func (it *sortNext) spill(ctx context.Context, recs []*sortRecord) (_ *sortRun, gerr error) {
+	slices.SortFunc(recs, it.order.compare)
+	f, err := os.CreateTemp("", "cayley-sort-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if gerr != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for _, r := range recs {
+		out := spilledRecord{Seq: r.seq}
+		if out.Result, err = it.marshalResult(ctx, r.result); err != nil {
+			return nil, err
+		}
+		for _, p := range r.paths {
+			sp, err := it.marshalResult(ctx, p)
+			if err != nil {
 				return nil, err
 			}
-			val.paths = append(val.paths, result{id, tags})
+			out.Paths = append(out.Paths, sp)
+		}
+		if err = enc.Encode(&out); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &sortRun{f: f, dec: gob.NewDecoder(bufio.NewReader(f))}, nil
+}
+
+func (r *sortRun) next(ctx context.Context, it *sortNext) (*sortRecord, error) {
+	var in spilledRecord
+	if err := r.dec.Decode(&in); errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	res, err := it.unmarshalResult(ctx, in.Result)
+	if err != nil {
+		return nil, err
+	}
+	rec := &sortRecord{result: res, seq: in.Seq}
+	for _, p := range in.Paths {
+		pr, err := it.unmarshalResult(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		rec.paths = append(rec.paths, pr)
+	}
+	if rec.keys, err = it.keysOf(ctx, res); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// sortMerge merges multiple sorted sources.
+type sortMerge []sortSource
+
+type sortHead struct {
+	rec *sortRecord
+	src sortSource
+}
+
+type sortHeap struct {
+	order *sortOrder
+	heads []sortHead
+}
+
+func (h *sortHeap) Len() int           { return len(h.heads) }
+func (h *sortHeap) Less(i, j int) bool { return h.order.compare(h.heads[i].rec, h.heads[j].rec) < 0 }
+func (h *sortHeap) Swap(i, j int)      { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+func (h *sortHeap) Push(x any)         { h.heads = append(h.heads, x.(sortHead)) }
+func (h *sortHeap) Pop() any {
+	n := len(h.heads) - 1
+	x := h.heads[n]
+	h.heads = h.heads[:n]
+	return x
+}
+
+func (m sortMerge) init(ctx context.Context, it *sortNext) error {
+	if len(m) == 1 {
+		return nil
+	}
+	h := &sortHeap{order: it.order}
+	for _, src := range m {
+		rec, err := src.next(ctx, it)
+		if err != nil {
+			return err
+		} else if rec != nil {
+			h.heads = append(h.heads, sortHead{rec: rec, src: src})
 		}
-		v = append(v, val)
 	}
-	if err := it.Err(); err != nil {
-		return v, err
+	heap.Init(h)
+	it.sources = sortMerge{h}
+	return nil
+}
+
+func (m sortMerge) pop(ctx context.Context, it *sortNext) (*sortRecord, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return m[0].next(ctx, it)
+}
+
+func (h *sortHeap) next(ctx context.Context, it *sortNext) (*sortRecord, error) {
+	if len(h.heads) == 0 {
+		return nil, nil
+	}
+	head := h.heads[0]
+	rec, err := head.src.next(ctx, it)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		h.heads[0].rec = rec
+		heap.Fix(h, 0)
+	} else {
+		heap.Pop(h)
 	}
-	sort.Sort(v)
-	return v, nil
+	return head.rec, nil
 }
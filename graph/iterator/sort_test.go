@@ -0,0 +1,145 @@
+package iterator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph/graphmock"
+	. "github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+func sortRow(name string, val quad.Value) Shape {
+	s := NewSave(NewFixed(refs.PreFetched(quad.String(name))), "name")
+	if val != nil {
+		s.AddFixedTag("val", refs.PreFetched(val))
+	}
+	return s
+}
+
+func collectSorted(t *testing.T, it Shape) []quad.Value {
+	ctx := context.Background()
+	sc := it.Iterate(ctx)
+	defer sc.Close()
+	var out []quad.Value
+	for sc.Next(ctx) {
+		ref, err := sc.Result(ctx)
+		require.NoError(t, err)
+		out = append(out, ref.(refs.PreFetchedValue).NameOf())
+	}
+	require.NoError(t, sc.Err())
+	return out
+}
+
+func TestSortTyped(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	vals := NewFixed(
+		refs.PreFetched(quad.String("b")),
+		refs.PreFetched(quad.Int(10)),
+		refs.PreFetched(quad.Time(t1)),
+		refs.PreFetched(quad.Float(2.5)),
+		refs.PreFetched(quad.IRI("x")),
+		refs.PreFetched(quad.Int(9)),
+		refs.PreFetched(quad.TypedString{Value: "3", Type: "http://www.w3.org/2001/XMLSchema#integer"}),
+		refs.PreFetched(quad.String("a")),
+		refs.PreFetched(quad.BNode("n")),
+		refs.PreFetched(quad.Bool(true)),
+	)
+	qs := &graphmock.Store{}
+	got := collectSorted(t, NewSort(qs, vals))
+	require.Equal(t, []quad.Value{
+		quad.BNode("n"), quad.IRI("x"), quad.Bool(true),
+		quad.Float(2.5), quad.TypedString{Value: "3", Type: "http://www.w3.org/2001/XMLSchema#integer"},
+		quad.Int(9), quad.Int(10), quad.Time(t1), quad.String("a"), quad.String("b"),
+	}, got)
+}
+
+func TestSortByTag(t *testing.T) {
+	rows := func() Shape {
+		return NewOr(
+			sortRow("a", quad.Int(3)),
+			sortRow("b", quad.Float(12)),
+			sortRow("c", nil),
+			sortRow("d", quad.Int(3)),
+			sortRow("e", quad.Int(-1)),
+		)
+	}
+	qs := &graphmock.Store{}
+	for _, limit := range []int{SortMemoryLimit, 2} {
+		func() {
+			defer func(v int) { SortMemoryLimit = v }(SortMemoryLimit)
+			SortMemoryLimit = limit
+
+			got := collectSorted(t, NewSortBy(qs, rows(), SortKey{Tag: "val"}))
+			require.Equal(t, []quad.Value{
+				quad.String("c"), quad.String("e"), quad.String("a"), quad.String("d"), quad.String("b"),
+			}, got, "limit: %d", limit)
+
+			got = collectSorted(t, NewSortBy(qs, rows(), SortKey{Tag: "val", Desc: true}, SortKey{Tag: "name", Desc: true}))
+			require.Equal(t, []quad.Value{
+				quad.String("b"), quad.String("d"), quad.String("a"), quad.String("e"), quad.String("c"),
+			}, got, "limit: %d", limit)
+		}()
+	}
+}
+
+func TestSortSpillTyped(t *testing.T) {
+	xint := func(s string) quad.Value {
+		return quad.TypedString{Value: quad.String(s), Type: "http://www.w3.org/2001/XMLSchema#integer"}
+	}
+	qs := &graphmock.Store{}
+	for _, limit := range []int{SortMemoryLimit, 2} {
+		func() {
+			defer func(v int) { SortMemoryLimit = v }(SortMemoryLimit)
+			SortMemoryLimit = limit
+
+			vals := NewFixed(
+				refs.PreFetched(xint("10")),
+				refs.PreFetched(xint("2")),
+				refs.PreFetched(xint("7")),
+				refs.PreFetched(xint("1")),
+				refs.PreFetched(xint("5")),
+				refs.PreFetched(xint("3")),
+			)
+			got := collectSorted(t, NewSort(qs, vals))
+			require.Equal(t, []quad.Value{
+				xint("1"), xint("2"), xint("3"), xint("5"), xint("7"), xint("10"),
+			}, got, "limit: %d", limit)
+
+			vals = NewFixed(
+				refs.PreFetched(xint("10")),
+				refs.PreFetched(quad.Int(2)),
+				refs.PreFetched(xint("7")),
+				refs.PreFetched(quad.Int(1)),
+				refs.PreFetched(quad.Int(5)),
+				refs.PreFetched(xint("3")),
+			)
+			got = collectSorted(t, NewSort(qs, vals))
+			require.Equal(t, []quad.Value{
+				quad.Int(1), quad.Int(2), xint("3"), quad.Int(5), xint("7"), xint("10"),
+			}, got, "limit: %d", limit)
+		}()
+	}
+}
+
+func TestSortCollation(t *testing.T) {
+	words := NewFixed(
+		refs.PreFetched(quad.String("zebra")),
+		refs.PreFetched(quad.String("Äpfel")),
+		refs.PreFetched(quad.String("apple")),
+	)
+	qs := &graphmock.Store{}
+	got := collectSorted(t, NewSortBy(qs, words, SortKey{}))
+	require.Equal(t, []quad.Value{
+		quad.String("apple"), quad.String("zebra"), quad.String("Äpfel"),
+	}, got)
+
+	got = collectSorted(t, NewSortBy(qs, words, SortKey{Lang: "de"}))
+	require.Equal(t, []quad.Value{
+		quad.String("Äpfel"), quad.String("apple"), quad.String("zebra"),
+	}, got)
+}
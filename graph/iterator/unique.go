@@ -18,11 +18,11 @@ func NewUnique(subIt Shape) *Unique {
 }
 
 func (it *Unique) Iterate(ctx context.Context) Scanner {
-	return newUniqueNext(it.subIt.Iterate(ctx))
+	return newUniqueNext(Scan(ctx, it.subIt))
 }
 
 func (it *Unique) Lookup(ctx context.Context) Index {
-	return newUniqueContains(it.subIt.Lookup(ctx))
+	return newUniqueContains(Lookup(ctx, it.subIt))
 }
 
 // SubIterators returns a slice of the sub iterators. The first iterator is the
@@ -38,11 +38,11 @@ func NewValueFilter(qs refs.Namer, sub Shape, filter ValueFilterFunc) *ValueFilt
 }
 
 func (it *ValueFilter) Iterate(ctx context.Context) Scanner {
-	return newValueFilterNext(it.qs, it.sub.Iterate(ctx), it.filter)
+	return newValueFilterNext(it.qs, Scan(ctx, it.sub), it.filter)
 }
 
 func (it *ValueFilter) Lookup(ctx context.Context) Index {
-	return newValueFilterContains(it.qs, it.sub.Lookup(ctx), it.filter)
+	return newValueFilterContains(it.qs, Lookup(ctx, it.sub), it.filter)
 }
 
 func (it *ValueFilter) SubIterators() []Shape {
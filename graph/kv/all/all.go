@@ -3,5 +3,6 @@ package all
 import (
 	_ "github.com/aperturerobotics/cayley/graph/kv"
 	_ "github.com/aperturerobotics/cayley/graph/kv/bolt"
+	_ "github.com/aperturerobotics/cayley/graph/kv/pebble"
 	_ "github.com/aperturerobotics/cayley/kv/all"
 )
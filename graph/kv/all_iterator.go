@@ -30,10 +30,18 @@ type constraint struct {
 	val Int64Value
 }
 
+// idRange is a range of primitive ids, (lo, hi].
+type idRange struct {
+	lo, hi uint64
+}
+
+var _ iterator.Partitioner = (*allIterator)(nil)
+
 type allIterator struct {
 	qs    *QuadStore
 	nodes bool
 	cons  *constraint
+	rng   *idRange // set for partitions
 }
 
 func (qs *QuadStore) newAllIterator(nodes bool, cons *constraint) *allIterator {
@@ -48,11 +56,42 @@ func (qs *QuadStore) newAllIterator(nodes bool, cons *constraint) *allIterator {
 }
 
 func (it *allIterator) Iterate(ctx context.Context) iterator.Scanner {
-	return it.qs.newAllIteratorNext(it.nodes, it.cons)
+	next := it.qs.newAllIteratorNext(it.nodes, it.cons)
+	if it.rng != nil {
+		next.id = it.rng.lo
+		next.horizon = min(next.horizon, int64(it.rng.hi))
+	}
+	return next
 }
 
 func (it *allIterator) Lookup(ctx context.Context) iterator.Index {
-	return it.qs.newAllIteratorContains(it.nodes, it.cons)
+	c := it.qs.newAllIteratorContains(it.nodes, it.cons)
+	c.rng = it.rng
+	return c
+}
+
+// Partition implements iterator.Partitioner. Primitives are split into ranges of ids,
+// which are the keys of the primitive index.
+func (it *allIterator) Partition(ctx context.Context, n int) ([]iterator.Shape, error) {
+	rng := idRange{hi: uint64(it.qs.horizon(ctx))}
+	if it.rng != nil {
+		rng.lo, rng.hi = it.rng.lo, min(rng.hi, it.rng.hi)
+	}
+	if rng.hi <= rng.lo {
+		return nil, nil
+	}
+	size := rng.hi - rng.lo
+	if uint64(n) > size {
+		n = int(size)
+	}
+	out := make([]iterator.Shape, 0, n)
+	for i := uint64(0); i < uint64(n); i++ {
+		out = append(out, &allIterator{
+			qs: it.qs, nodes: it.nodes, cons: it.cons,
+			rng: &idRange{lo: rng.lo + size*i/uint64(n), hi: rng.lo + size*(i+1)/uint64(n)},
+		})
+	}
+	return out, nil
 }
 
 // No subiterators.
@@ -71,6 +110,15 @@ func (it *allIterator) Optimize(ctx context.Context) (iterator.Shape, bool, erro
 }
 
 func (it *allIterator) Stats(ctx context.Context) (iterator.Costs, error) {
+	if it.cons != nil {
+		if sz, ok, err := it.qs.predicateSize(ctx, it.cons.dir, it.cons.val); err != nil || ok {
+			return iterator.Costs{
+				ContainsCost: 1,
+				NextCost:     2,
+				Size:         sz,
+			}, err
+		}
+	}
 	sz, err := it.qs.Size(ctx)
 	return iterator.Costs{
 		ContainsCost: 1,
@@ -165,7 +213,7 @@ func (it *allIteratorNext) Next(ctx context.Context) bool {
 		for ; len(it.buf) > 0; it.buf = it.buf[1:] {
 			p := it.buf[0]
 			it.prim = p
-			if p == nil || p.Deleted {
+			if !it.qs.isLive(p) {
 				continue
 			}
 			it.id = it.prim.ID
@@ -202,6 +250,7 @@ type allIteratorContains struct {
 	qs      *QuadStore
 	err     error
 	cons    *constraint
+	rng     *idRange
 }
 
 func (qs *QuadStore) newAllIteratorContains(nodes bool, cons *constraint) *allIteratorContains {
@@ -262,12 +311,18 @@ func (it *allIteratorContains) Contains(ctx context.Context, v graph.Ref) (bool,
 			return false, nil
 		}
 		it.id = uint64(x)
-		return it.id <= uint64(it.horizon), nil
+		return it.id <= uint64(it.horizon) && it.inRange(it.id), nil
 	}
 	p, ok := v.(*proto.Primitive)
 	if !ok {
 		return false, errors.New("ref must be a proto.Primitive")
 	}
+	if it.qs.view != nil && !it.qs.view.live(p) {
+		return false, nil
+	}
+	if !it.inRange(p.ID) {
+		return false, nil
+	}
 	it.prim = p
 	it.id = it.prim.ID
 	if it.cons == nil {
@@ -279,6 +334,10 @@ func (it *allIteratorContains) Contains(ctx context.Context, v graph.Ref) (bool,
 	return true, nil
 }
 
+func (it *allIteratorContains) inRange(id uint64) bool {
+	return it.rng == nil || (id > it.rng.lo && id <= it.rng.hi)
+}
+
 func (it *allIteratorContains) String() string {
 	return "KVAllContains"
 }
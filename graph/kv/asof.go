@@ -0,0 +1,183 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/proto"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/pquads"
+)
+
+// snapshot restricts the quad store to primitives that were live at a given log position.
+type snapshot struct {
+	horizon int64
+	// primitives that existed at the horizon, but were deleted later
+	deleted map[uint64]struct{}
+	// IDs of nodes that existed at the horizon, but were deleted later
+	nodes map[refs.ValueHash]uint64
+
+	mu    sync.Mutex
+	quads *int64 // cached number of live quads
+}
+
+func (s *snapshot) live(p *proto.Primitive) bool {
+	if p == nil || p.ID > uint64(s.horizon) {
+		return false
+	} else if !p.Deleted {
+		return true
+	}
+	_, ok := s.deleted[p.ID]
+	return ok
+}
+
+// isLive checks if the primitive is visible in this quad store.
+func (qs *QuadStore) isLive(p *proto.Primitive) bool {
+	if qs.view != nil {
+		return qs.view.live(p)
+	}
+	return p != nil && !p.Deleted
+}
+
+// Horizon returns the current position in the log of the quad store.
+// It can be passed to AsOf later to get a view of the graph at this point.
+func (qs *QuadStore) Horizon(ctx context.Context) (int64, error) {
+	if qs.view != nil {
+		return qs.view.horizon, nil
+	}
+	return int64(qs.ids.horizon()), nil
+}
+
+// AsOf returns a read-only view of the quad store at a given log position.
+// The view only contains quads and nodes that were live at that point, as returned by Horizon.
+//
+// Deletions are recorded in the log since tombstones were introduced. Primitives deleted before that
+// carry no information about the time of removal and are considered deleted at any position.
+//
+// History before the position preserved by Compact is not available.
+//
+// The view shares the database with the quad store and must not be used after the store is closed.
+func (qs *QuadStore) AsOf(ctx context.Context, horizon int64) (graph.QuadStore, error) {
+	limit, err := qs.Horizon(ctx)
+	if err != nil {
+		return nil, err
+	}
+	first, err := qs.compactedHorizon(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if horizon < first || horizon > limit {
+		return nil, fmt.Errorf("kv: horizon %d is out of range [%d, %d]", horizon, first, limit)
+	}
+	snap := &snapshot{
+		horizon: horizon,
+		deleted: make(map[uint64]struct{}),
+		nodes:   make(map[refs.ValueHash]uint64),
+	}
+	err = kv.View(ctx, qs.db, func(tx kv.Tx) error {
+		// deletions are recorded up to the end of the log, not the horizon of the store or a parent view
+		cur, err := qs.readHorizonTx(ctx, tx)
+		if err == kv.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return snap.load(ctx, qs, tx, cur)
+	})
+	if err != nil {
+		return nil, err
+	}
+	view := newQuadStore(qs.db)
+	qs.indexes.RLock()
+	view.indexes.all = qs.indexes.all
+	view.indexes.exists = qs.indexes.exists
+	qs.indexes.RUnlock()
+	view.valueLRU = qs.valueLRU
+	view.view = snap
+	return view, nil
+}
+
+// load finds all tombstones in the log after the horizon.
+func (s *snapshot) load(ctx context.Context, qs *QuadStore, tx kv.Tx, cur int64) error {
+	var replaced []uint64
+	ids := make([]uint64, 0, nextBatch)
+	for id := uint64(s.horizon) + 1; id <= uint64(cur); id++ {
+		ids = append(ids, id)
+		if len(ids) < nextBatch && id < uint64(cur) {
+			continue
+		}
+		prims, err := qs.getPrimitivesFromLog(ctx, tx, ids)
+		if err != nil {
+			return err
+		}
+		for _, p := range prims {
+			if p == nil || !p.Deleted || p.Replaces == 0 || p.Replaces > uint64(s.horizon) {
+				continue
+			}
+			s.deleted[p.Replaces] = struct{}{}
+			replaced = append(replaced, p.Replaces)
+		}
+		ids = ids[:0]
+	}
+	// values of nodes deleted after the horizon are no longer indexed by hash
+	for len(replaced) > 0 {
+		batch := replaced
+		if len(batch) > nextBatch {
+			batch = batch[:nextBatch]
+		}
+		replaced = replaced[len(batch):]
+		prims, err := qs.getPrimitivesFromLog(ctx, tx, batch)
+		if err != nil {
+			return err
+		}
+		for _, p := range prims {
+			if p == nil || !p.IsNode() {
+				continue
+			}
+			v, err := pquads.UnmarshalValue(ctx, p.Value)
+			if err != nil {
+				return err
+			}
+			s.nodes[refs.HashOf(v)] = p.ID
+		}
+	}
+	return nil
+}
+
+// resolveValues fixes node IDs resolved from the current state of the value index.
+func (s *snapshot) resolveValues(vals []quad.Value, ids []uint64) {
+	for i, id := range ids {
+		if id != 0 && id <= uint64(s.horizon) {
+			// node existed at the horizon and was never deleted
+			continue
+		}
+		ids[i] = 0
+		if vals[i] != nil && len(s.nodes) != 0 {
+			ids[i] = s.nodes[refs.HashOf(vals[i])]
+		}
+	}
+}
+
+// countQuads returns the number of quads visible in the view.
+func (s *snapshot) countQuads(ctx context.Context, qs *QuadStore) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.quads != nil {
+		return *s.quads, nil
+	}
+	it := qs.QuadsAllIterator(ctx).Iterate(ctx)
+	defer it.Close()
+	var n int64
+	for it.Next(ctx) {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return 0, err
+	}
+	s.quads = &n
+	return n, nil
+}
@@ -15,12 +15,22 @@
 package badger
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 
 	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/graphtest"
+	"github.com/aperturerobotics/cayley/graph/kv"
 	"github.com/aperturerobotics/cayley/graph/kv/kvtest"
 	hkv "github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/quad"
 )
 
 func makeBadgerkv(t testing.TB) (hkv.KV, graph.Options, func()) {
@@ -46,3 +56,123 @@ func TestBadgerkv(t *testing.T) {
 func BenchmarkBadgerkv(b *testing.B) {
 	kvtest.BenchmarkAll(b, makeBadgerkv, nil)
 }
+
+// commitBarrier makes the first write transaction wait on commit until another one commits as well,
+// once it's armed. If transactions were serialized, the second commit would never happen while the first one waits.
+type commitBarrier struct {
+	hkv.KV
+	armed   atomic.Bool
+	once    sync.Once
+	waiting atomic.Int32
+	both    chan struct{}
+}
+
+func (db *commitBarrier) ConcurrentWrites() bool {
+	c, ok := db.KV.(hkv.ConcurrentWriter)
+	return ok && c.ConcurrentWrites()
+}
+
+func (db *commitBarrier) Tx(ctx context.Context, rw bool) (hkv.Tx, error) {
+	tx, err := db.KV.Tx(ctx, rw)
+	if err != nil || !rw {
+		return tx, err
+	}
+	return &barrierTx{Tx: tx, db: db}, nil
+}
+
+func (db *commitBarrier) View(ctx context.Context, fn func(tx hkv.Tx) error) error {
+	return hkv.View(ctx, db, fn)
+}
+
+func (db *commitBarrier) Update(ctx context.Context, fn func(tx hkv.Tx) error) error {
+	return hkv.Update(ctx, db, fn)
+}
+
+type barrierTx struct {
+	hkv.Tx
+	db *commitBarrier
+}
+
+func (tx *barrierTx) Commit(ctx context.Context) error {
+	if !tx.db.armed.Load() {
+		return tx.Tx.Commit(ctx)
+	}
+	if tx.db.waiting.Add(1) == 2 {
+		tx.db.once.Do(func() { close(tx.db.both) })
+	}
+	select {
+	case <-tx.db.both:
+	case <-time.After(5 * time.Second):
+	}
+	tx.db.armed.Store(false)
+	tx.db.waiting.Add(-1)
+	return tx.Tx.Commit(ctx)
+}
+
+func TestBadgerParallelCommits(t *testing.T) {
+	const (
+		writers = 8
+		batches = 50 // more transactions than the number of pending counter records that triggers folding
+	)
+	kdb, _, closer := makeBadgerkv(t)
+	defer closer()
+	db := &commitBarrier{KV: kdb, both: make(chan struct{})}
+
+	ctx := context.Background()
+	require.NoError(t, kv.Init(ctx, db, nil))
+	qs, err := kv.New(ctx, db, nil)
+	require.NoError(t, err)
+
+	db.armed.Store(true)
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := 0; b < batches; b++ {
+				q := quad.MakeIRI(fmt.Sprintf("s%d_%d", w, b), "p", fmt.Sprintf("o%d", b%5), "")
+				if err := qs.ApplyDeltas(ctx, []graph.Delta{{Action: graph.Add, Quad: q}}, graph.IgnoreOpts{}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	select {
+	case <-db.both:
+	default:
+		t.Fatal("write transactions were not committed in parallel")
+	}
+
+	check := func(qs graph.QuadStore) int64 {
+		st, err := qs.Stats(ctx, false)
+		require.NoError(t, err)
+		require.Equal(t, int64(writers*batches), st.Quads.Value)
+
+		p, err := qs.ValueOf(ctx, quad.IRI("p"))
+		require.NoError(t, err)
+		ps, ok, err := qs.(graph.PredicateStats).PredicateStats(ctx, p)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, graph.PredicateStat{Quads: writers * batches, Subjects: writers * batches, Objects: 5}, ps)
+
+		h, err := qs.(*kv.QuadStore).Horizon(ctx)
+		require.NoError(t, err)
+		view, err := qs.(*kv.QuadStore).AsOf(ctx, h)
+		require.NoError(t, err)
+		require.Len(t, graphtest.IteratedQuads(t, view, view.QuadsAllIterator(ctx)), writers*batches)
+		return h
+	}
+	h := check(qs)
+
+	// IDs and counters must be restored after reopening the store
+	qs, err = kv.New(ctx, db, nil)
+	require.NoError(t, err)
+	require.Equal(t, h, check(qs))
+}
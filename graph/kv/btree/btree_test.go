@@ -46,6 +46,7 @@ func makeBtreeDebug(t testing.TB) (hkv.KV, graph.Options, func()) {
 
 var conf = &kvtest.Config{
 	AlwaysRunIntegration: true,
+	NoSnapshots:          true,
 }
 
 func TestBtree(t *testing.T) {
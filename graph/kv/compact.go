@@ -0,0 +1,359 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph/proto"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/options"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/pquads"
+)
+
+// metaCompacted is the log position before which the history was removed by Compact.
+const metaCompacted = "compacted"
+
+// CompactOptions controls which history is preserved by Compact.
+type CompactOptions struct {
+	// KeepHistory is a log position, as returned by Horizon. Deleted primitives that were still live
+	// at this position are preserved, thus AsOf and Watch keep working for any later position.
+	// Zero discards all history.
+	KeepHistory int64
+}
+
+// CompactStats describes the data removed by Compact.
+type CompactStats struct {
+	Primitives int64 // log entries of deleted primitives and tombstones
+	Nodes      int64 // nodes that were no longer referenced by any quad
+	Postings   int64 // index entries pointing to removed quads
+	Bytes      int64 // total size of removed keys and values
+}
+
+// Compact removes deleted primitives and their tombstones from the log and indexes,
+// and reclaims nodes that are no longer referenced by any quad. Node reference counts are recalculated.
+//
+// Writes are blocked while compaction runs. Views returned by AsOf for positions before
+// the preserved history must not be used after compaction.
+func (qs *QuadStore) Compact(ctx context.Context, opt CompactOptions) (CompactStats, error) {
+	var st CompactStats
+	if qs.view != nil {
+		return st, kv.ErrReadOnly
+	}
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	end, err := qs.Horizon(ctx)
+	if err != nil {
+		return st, err
+	}
+	keep := opt.KeepHistory
+	if keep == 0 {
+		keep = end
+	} else if keep < 0 || keep > end {
+		return st, fmt.Errorf("kv: horizon %d is out of range [0, %d]", keep, end)
+	}
+	c := &compaction{
+		qs:    qs,
+		st:    &st,
+		keep:  uint64(keep),
+		dead:  make(map[uint64]int64),
+		tombs: make(map[uint64]uint64),
+		nodes: make(map[uint64]struct{}),
+		refs:  make(map[uint64]int64),
+	}
+	if err = c.scanLog(ctx, uint64(end)); err != nil {
+		return st, err
+	}
+	if err = c.fixNodes(ctx, opt.KeepHistory != 0); err != nil {
+		return st, err
+	}
+	qs.indexes.RLock()
+	inds := append(qs.indexes.all[:len(qs.indexes.all):len(qs.indexes.all)], qs.indexes.building...)
+	qs.indexes.RUnlock()
+	for _, ind := range inds {
+		if err = c.compactIndex(ctx, ind); err != nil {
+			return st, err
+		}
+	}
+	if err = c.deleteDead(ctx); err != nil {
+		return st, err
+	}
+	err = kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+		prev, err := qs.getMetaIntTx(ctx, tx, metaCompacted)
+		if err != nil && err != kv.ErrNotFound {
+			return err
+		} else if prev >= keep {
+			return nil
+		}
+		return qs.putMetaInt(ctx, tx, metaCompacted, keep)
+	})
+	return st, err
+}
+
+// compactedHorizon returns the first log position for which the history is complete.
+func (qs *QuadStore) compactedHorizon(ctx context.Context) (int64, error) {
+	h, err := qs.getMetaInt(ctx, metaCompacted)
+	if err == ErrNoBucket {
+		return 0, nil
+	}
+	return h, err
+}
+
+type compaction struct {
+	qs   *QuadStore
+	st   *CompactStats
+	keep uint64
+
+	// log entries to remove and their sizes
+	dead map[uint64]int64
+	// tombstones for each deleted primitive
+	tombs map[uint64]uint64
+	// live nodes and the number of live quads referencing them
+	nodes map[uint64]struct{}
+	refs  map[uint64]int64
+}
+
+func logEntrySize(p *proto.Primitive) int64 {
+	return int64(len(logIndex[0]) + len(uint64KeyBytesBase10(p.ID)) + p.SizeVT())
+}
+
+// scanLog finds dead primitives and counts references to live nodes.
+func (c *compaction) scanLog(ctx context.Context, end uint64) error {
+	// deleted primitives and their sizes
+	deleted := make(map[uint64]int64)
+	for from := uint64(1); from <= end; from += indexBackfillBatch {
+		last := min(from+indexBackfillBatch-1, end)
+		err := kv.View(ctx, c.qs.db, func(tx kv.Tx) error {
+			ids := make([]uint64, 0, nextBatch)
+			for id := from; id <= last; id++ {
+				ids = append(ids, id)
+				if len(ids) < nextBatch && id < last {
+					continue
+				}
+				prims, err := c.qs.getPrimitivesFromLog(ctx, tx, ids)
+				if err != nil {
+					return err
+				}
+				for _, p := range prims {
+					switch {
+					case p == nil:
+					case p.Replaces != 0:
+						c.tombs[p.Replaces] = p.ID
+						if p.ID <= c.keep {
+							c.dead[p.ID] = logEntrySize(p)
+						}
+					case p.Deleted:
+						deleted[p.ID] = logEntrySize(p)
+					case p.IsNode():
+						c.nodes[p.ID] = struct{}{}
+					default:
+						for _, d := range quad.Directions {
+							if id := p.GetDirection(d); id != 0 {
+								c.refs[id]++
+							}
+						}
+					}
+				}
+				ids = ids[:0]
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for id, sz := range deleted {
+		// primitives deleted before tombstones were introduced are dead at any position
+		if tomb, ok := c.tombs[id]; !ok || tomb <= c.keep {
+			c.dead[id] = sz
+		}
+	}
+	return nil
+}
+
+// fixNodes removes nodes that are not referenced by any quad and corrects reference counts of others.
+// If history is preserved, removed nodes are marked as deleted instead of being dropped from the log.
+func (c *compaction) fixNodes(ctx context.Context, history bool) error {
+	ids := make([]uint64, 0, len(c.nodes))
+	for id := range c.nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), nextBatch)]
+		ids = ids[len(batch):]
+		cache := newTxCache()
+		err := kv.Update(ctx, c.qs.db, func(tx kv.Tx) error {
+			return c.fixNodesBatch(ctx, tx, cache, batch, history)
+		})
+		c.qs.endTx(ctx, cache, err == nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compaction) fixNodesBatch(ctx context.Context, tx kv.Tx, cache *txCache, ids []uint64, history bool) error {
+	qs := c.qs
+	prims, err := qs.getPrimitivesFromLog(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+	vals := make([]quad.Value, len(prims))
+	hashes := make([]refs.ValueHash, len(prims))
+	for i, p := range prims {
+		if p == nil {
+			continue
+		}
+		if vals[i], err = pquads.UnmarshalValue(ctx, p.Value); err != nil {
+			return err
+		}
+		hashes[i] = refs.HashOf(vals[i])
+	}
+	var orphans []*proto.Primitive
+	for i, p := range prims {
+		if p == nil {
+			continue
+		}
+		key := bucketKeyForHashRefs(hashes[i])
+		if cnt := c.refs[p.ID]; cnt != 0 {
+			cur, err := tx.Get(ctx, key)
+			if err != nil && err != kv.ErrNotFound {
+				return err
+			}
+			if want := uint64toBytes(uint64(cnt)); string(cur) != string(want) {
+				if err = tx.Put(ctx, key, want); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for _, k := range []kv.Key{key, bucketKeyForHash(hashes[i][:])} {
+			v, err := tx.Get(ctx, k)
+			if err == kv.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			c.st.Bytes += int64(len(k[0])+len(k[1])) + int64(len(v))
+			if err = tx.Del(ctx, k); err != nil {
+				return err
+			}
+		}
+		if iri, ok := vals[i].(quad.IRI); ok {
+			qs.valueLRU.Del(string(iri))
+		}
+		c.st.Nodes++
+		if history {
+			orphans = append(orphans, p)
+		} else {
+			c.dead[p.ID] = logEntrySize(p)
+		}
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	tomb, err := qs.genIDs(ctx, tx, cache, len(orphans))
+	if err != nil {
+		return err
+	}
+	for i, p := range orphans {
+		if err = qs.markAsDead(ctx, tx, p, tomb+uint64(i)); err != nil {
+			return err
+		}
+	}
+	return qs.flushMetaCache(ctx, tx, cache)
+}
+
+// compactIndex removes dead quads from all posting lists of the index.
+func (c *compaction) compactIndex(ctx context.Context, ind QuadIndex) error {
+	var changes []kv.Pair
+	err := kv.View(ctx, c.qs.db, func(tx kv.Tx) error {
+		it := tx.Scan(ctx, options.WithPrefixKV(ind.Key(nil)))
+		defer it.Close()
+		for it.Next(ctx) {
+			list, err := decodeIndex(it.Val())
+			if err != nil {
+				return err
+			}
+			live := list[:0:0]
+			for _, id := range list {
+				if _, ok := c.dead[id]; !ok {
+					live = append(live, id)
+				}
+			}
+			if len(live) == len(list) {
+				continue
+			}
+			c.st.Postings += int64(len(list) - len(live))
+			p := kv.Pair{Key: it.Key().Clone()}
+			if len(live) == 0 {
+				c.st.Bytes += int64(len(p.Key[0]) + len(p.Key[1]))
+			} else {
+				p.Val = appendIndex(nil, live)
+			}
+			c.st.Bytes += int64(len(it.Val()) - len(p.Val))
+			changes = append(changes, p)
+		}
+		return it.Err()
+	})
+	if err != nil {
+		return err
+	}
+	for len(changes) > 0 {
+		batch := changes[:min(len(changes), indexBackfillBatch)]
+		changes = changes[len(batch):]
+		err = kv.Update(ctx, c.qs.db, func(tx kv.Tx) error {
+			for _, p := range batch {
+				var err error
+				if p.Val == nil {
+					err = tx.Del(ctx, p.Key)
+				} else {
+					err = tx.Put(ctx, p.Key, p.Val)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if clog.V(1) {
+		clog.Infof("index %v: compacted", ind)
+	}
+	return nil
+}
+
+// deleteDead removes log entries of dead primitives.
+func (c *compaction) deleteDead(ctx context.Context) error {
+	ids := make([]uint64, 0, len(c.dead))
+	for id, sz := range c.dead {
+		ids = append(ids, id)
+		c.st.Bytes += sz
+	}
+	c.st.Primitives = int64(len(ids))
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), indexBackfillBatch)]
+		ids = ids[len(batch):]
+		err := kv.Update(ctx, c.qs.db, func(tx kv.Tx) error {
+			for _, id := range batch {
+				if err := tx.Del(ctx, logIndex.AppendBytes(uint64KeyBytesBase10(id))); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/options"
+)
+
+// Meta counters, such as the number of quads, the horizon and statistics of predicates, are changed by most
+// write transactions. Updating them directly would make all concurrent transactions conflict with each other.
+//
+// Instead, each transaction that allocates IDs writes changes of counters to a separate record, keyed
+// by the first allocated ID. The record also stores the last allocated ID, which advances the horizon.
+// Readers add pending records to the values of counters. Records are folded into counters from time to time.
+
+const (
+	// metaDeltaPrefix is a prefix of records with changes of counters
+	metaDeltaPrefix = "delta/"
+	// foldDeltas is the number of pending records that triggers folding, see foldCounters
+	foldDeltas = 256
+)
+
+var errBadDeltas = errors.New("kv: invalid counters record")
+
+func counterDeltasKey(first uint64) kv.Key {
+	k := make([]byte, len(metaDeltaPrefix), len(metaDeltaPrefix)+8)
+	copy(k, metaDeltaPrefix)
+	return metaBucket.AppendBytes(binary.BigEndian.AppendUint64(k, first))
+}
+
+// counterDeltas is a record with changes of counters made by a single transaction.
+type counterDeltas struct {
+	last uint64
+	vals map[string]int64
+}
+
+func (d *counterDeltas) encode() []byte {
+	keys := make([]string, 0, len(d.vals))
+	for key := range d.vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf := binary.AppendUvarint(nil, d.last)
+	for _, key := range keys {
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.AppendVarint(buf, d.vals[key])
+	}
+	return buf
+}
+
+func decodeCounterDeltas(b []byte) (*counterDeltas, error) {
+	last, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errBadDeltas
+	}
+	b = b[n:]
+	d := &counterDeltas{last: last, vals: make(map[string]int64)}
+	for len(b) != 0 {
+		sz, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < sz {
+			return nil, errBadDeltas
+		}
+		key := string(b[n : n+int(sz)])
+		b = b[n+int(sz):]
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, errBadDeltas
+		}
+		b = b[n:]
+		d.vals[key] = v
+	}
+	return d, nil
+}
+
+// writeCounterDeltas writes changes of counters buffered in the cache to the record of the transaction.
+// The record is written even if no counters were changed, to persist IDs allocated by the transaction.
+func (qs *QuadStore) writeCounterDeltas(ctx context.Context, tx kv.Tx, cache *txCache) error {
+	d := counterDeltas{last: cache.last, vals: make(map[string]int64, len(cache.dirty))}
+	for key := range cache.dirty {
+		if v := cache.vals[key]; v != 0 {
+			d.vals[key] = v
+		}
+	}
+	if err := tx.Put(ctx, counterDeltasKey(cache.first), d.encode()); err != nil {
+		return fmt.Errorf("cannot write counters: %v", err)
+	}
+	clear(cache.vals)
+	clear(cache.dirty)
+	return nil
+}
+
+// scanCounterDeltas calls fn for each pending record with changes of counters.
+func scanCounterDeltas(ctx context.Context, tx kv.Tx, fn func(k kv.Key, d *counterDeltas) error) error {
+	it := tx.Scan(ctx, options.WithPrefixKV(metaBucket.AppendBytes([]byte(metaDeltaPrefix))))
+	defer it.Close()
+	for it.Next(ctx) {
+		d, err := decodeCounterDeltas(it.Val())
+		if err != nil {
+			return err
+		}
+		if err = fn(it.Key(), d); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// readCountersTx returns current values of meta counters, including pending changes.
+// Counters that were never set are zero.
+func (qs *QuadStore) readCountersTx(ctx context.Context, tx kv.Tx, keys ...string) ([]int64, error) {
+	out := make([]int64, len(keys))
+	for i, key := range keys {
+		v, err := qs.getMetaIntTx(ctx, tx, key)
+		if err != nil && err != kv.ErrNotFound {
+			return nil, err
+		}
+		out[i] = v
+	}
+	err := scanCounterDeltas(ctx, tx, func(_ kv.Key, d *counterDeltas) error {
+		for i, key := range keys {
+			out[i] += d.vals[key]
+		}
+		return nil
+	})
+	return out, err
+}
+
+// readCounter is like readCountersTx, but reads a single counter in a separate transaction.
+func (qs *QuadStore) readCounter(ctx context.Context, key string) (int64, error) {
+	var v int64
+	err := kv.View(ctx, qs.db, func(tx kv.Tx) error {
+		vals, err := qs.readCountersTx(ctx, tx, key)
+		if err == nil {
+			v = vals[0]
+		}
+		return err
+	})
+	return v, err
+}
+
+// readHorizonTx returns the last ID allocated by committed transactions.
+// It returns kv.ErrNotFound if no IDs were allocated yet.
+func (qs *QuadStore) readHorizonTx(ctx context.Context, tx kv.Tx) (int64, error) {
+	h, err := qs.getMetaIntTx(ctx, tx, "horizon")
+	if err != nil && err != kv.ErrNotFound {
+		return 0, err
+	}
+	found := err == nil
+	err = scanCounterDeltas(ctx, tx, func(_ kv.Key, d *counterDeltas) error {
+		h, found = max(h, int64(d.last)), true
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	} else if !found {
+		return 0, kv.ErrNotFound
+	}
+	return h, nil
+}
+
+// readHorizon is like readHorizonTx, but returns zero for an empty database.
+func (qs *QuadStore) readHorizon(ctx context.Context) (int64, error) {
+	var h int64
+	err := kv.View(ctx, qs.db, func(tx kv.Tx) error {
+		var err error
+		h, err = qs.readHorizonTx(ctx, tx)
+		if err == kv.ErrNotFound {
+			err = nil
+		}
+		return err
+	})
+	return h, err
+}
+
+// foldCounters adds pending records to meta counters and removes them. It must be called with
+// the writer lock held, since maintenance operations rely on the absence of pending records.
+func (qs *QuadStore) foldCounters(ctx context.Context) error {
+	var n int
+	err := retryConflicts(ctx, func() error {
+		return kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+			var (
+				keys []kv.Key
+				last uint64
+				vals = make(map[string]int64)
+			)
+			n = 0
+			err := scanCounterDeltas(ctx, tx, func(k kv.Key, d *counterDeltas) error {
+				keys = append(keys, k.Clone())
+				last = max(last, d.last)
+				for key, v := range d.vals {
+					vals[key] += v
+				}
+				return nil
+			})
+			if err != nil || len(keys) == 0 {
+				return err
+			}
+			for _, k := range keys {
+				if err = tx.Del(ctx, k); err != nil {
+					return err
+				}
+			}
+			names := make([]string, 0, len(vals))
+			for key := range vals {
+				names = append(names, key)
+			}
+			sort.Strings(names)
+			for _, key := range names {
+				if err = qs.incMetaInt(ctx, tx, nil, key, vals[key]); err != nil {
+					return err
+				}
+			}
+			h, err := qs.getMetaIntTx(ctx, tx, "horizon")
+			if err != nil && err != kv.ErrNotFound {
+				return err
+			}
+			if int64(last) > h {
+				err = qs.putMetaInt(ctx, tx, "horizon", int64(last))
+			}
+			n = len(keys)
+			return err
+		})
+	})
+	if err == nil {
+		qs.pendingDeltas.Add(-int64(n))
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package kv
+
+import (
+	"errors"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/kv/crypt"
+	"github.com/aperturerobotics/cayley/kv/options"
+)
+
+const (
+	// OptEncryptionKey is an AES key for encrypting the database, encoded in hex or base64.
+	OptEncryptionKey = "encryption_key"
+	// OptEncryptionKeyFile is a path to a file with the encryption key. See crypt.ReadKeyFile.
+	OptEncryptionKeyFile = "encryption_key_file"
+	// OptEncryptionOldKey is a previous encryption key, set while the database is re-encrypted with a new one.
+	// Values encrypted by it can still be read. Encrypted keys can only be read after the re-encryption completes.
+	OptEncryptionOldKey = "encryption_old_key"
+	// OptEncryptionOldKeyFile is a path to a file with the previous encryption key. See OptEncryptionOldKey.
+	OptEncryptionOldKeyFile = "encryption_old_key_file"
+	// OptEncryptKeys enables encryption of keys, in addition to values.
+	OptEncryptKeys = "encrypt_keys"
+)
+
+func init() {
+	options.RegisterWrapper("crypt", func(opt map[string]any) (options.Wrapper, error) {
+		c, err := CipherFromOptions(opt)
+		if c == nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+// keyFromOptions reads an encryption key from either a key or a key file option.
+// It returns nil if neither is set.
+func keyFromOptions(opt graph.Options, keyOpt, fileOpt string) ([]byte, error) {
+	str, err := opt.StringKey(keyOpt, "")
+	if err != nil {
+		return nil, err
+	}
+	path, err := opt.StringKey(fileOpt, "")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case str != "" && path != "":
+		return nil, errors.New("kv: either " + keyOpt + " or " + fileOpt + " must be set, not both")
+	case str != "":
+		return crypt.ParseKey(str)
+	case path != "":
+		return crypt.ReadKeyFile(path)
+	}
+	return nil, nil
+}
+
+// CipherFromOptions returns a cipher configured by the encryption options.
+// The old key, if set, is only used for decrypting values.
+// It returns nil if the encryption is disabled.
+func CipherFromOptions(opt graph.Options) (*crypt.Cipher, error) {
+	key, err := keyFromOptions(opt, OptEncryptionKey, OptEncryptionKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	old, err := keyFromOptions(opt, OptEncryptionOldKey, OptEncryptionOldKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		if old != nil {
+			return nil, errors.New("kv: old encryption key is set without the new one")
+		}
+		return nil, nil
+	}
+	keys, err := opt.BoolKey(OptEncryptKeys, false)
+	if err != nil {
+		return nil, err
+	}
+	copt := &crypt.Options{EncryptKeys: keys}
+	if old != nil {
+		copt.OldKeys = [][]byte{old}
+	}
+	return crypt.New(key, copt)
+}
+
+// OldCipherFromOptions returns a cipher for the old encryption key, which the database is re-encrypted from.
+// It returns nil if the old key is not set.
+func OldCipherFromOptions(opt graph.Options) (*crypt.Cipher, error) {
+	old, err := keyFromOptions(opt, OptEncryptionOldKey, OptEncryptionOldKeyFile)
+	if err != nil || old == nil {
+		return nil, err
+	}
+	keys, err := opt.BoolKey(OptEncryptKeys, false)
+	if err != nil {
+		return nil, err
+	}
+	return crypt.New(old, &crypt.Options{EncryptKeys: keys})
+}
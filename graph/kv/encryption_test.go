@@ -0,0 +1,84 @@
+package kv_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/kv"
+	"github.com/aperturerobotics/cayley/graph/kv/btree"
+	"github.com/aperturerobotics/cayley/graph/kv/kvtest"
+	hkv "github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/options"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+func TestEncryption(t *testing.T) {
+	opt := graph.Options{
+		kv.OptEncryptionKey: strings.Repeat("ab", 32),
+		kv.OptEncryptKeys:   true,
+	}
+	c, err := kv.CipherFromOptions(opt)
+	require.NoError(t, err)
+	require.True(t, c.EncryptsKeys())
+
+	kvtest.TestAll(t, func(t testing.TB) (hkv.KV, graph.Options, func()) {
+		return c.WrapKV(btree.New()), nil, func() {}
+	}, &kvtest.Config{NoSnapshots: true})
+
+	c, err = kv.CipherFromOptions(nil)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	opt[kv.OptEncryptionKeyFile] = "key"
+	_, err = kv.CipherFromOptions(opt)
+	require.Error(t, err)
+
+	_, err = kv.CipherFromOptions(graph.Options{kv.OptEncryptionOldKey: strings.Repeat("ab", 32)})
+	require.Error(t, err)
+}
+
+func TestEncryptionWrapper(t *testing.T) {
+	ctx := context.TODO()
+	opt := graph.Options{
+		kv.OptEncryptionKey:    strings.Repeat("cd", 32),
+		kv.OptEncryptionOldKey: strings.Repeat("ab", 32),
+	}
+	old, err := kv.OldCipherFromOptions(opt)
+	require.NoError(t, err)
+	c, err := kv.CipherFromOptions(opt)
+	require.NoError(t, err)
+
+	// values written with the old key must be readable during the rotation
+	raw := btree.New()
+	key := hkv.Key{[]byte("k")}
+	err = hkv.Update(ctx, old.WrapKV(raw), func(tx hkv.Tx) error {
+		return tx.Put(ctx, key, []byte("v"))
+	})
+	require.NoError(t, err)
+	err = hkv.View(ctx, c.WrapKV(raw), func(tx hkv.Tx) error {
+		v, err := tx.Get(ctx, key)
+		require.Equal(t, hkv.Value("v"), v)
+		return err
+	})
+	require.NoError(t, err)
+
+	ws, err := options.Wrappers(opt)
+	require.NoError(t, err)
+	require.Len(t, ws, 1)
+	ws, err = options.Wrappers(nil)
+	require.NoError(t, err)
+	require.Empty(t, ws)
+
+	qs, err := graph.NewQuadStore(ctx, btree.Type, "", opt)
+	require.NoError(t, err)
+	defer qs.Close()
+	q := quad.MakeIRI("a", "b", "c", "")
+	require.NoError(t, qs.ApplyDeltas(ctx, []graph.Delta{{Quad: q, Action: graph.Add}}, graph.IgnoreOpts{}))
+	st, err := qs.Stats(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), st.Quads.Value)
+}
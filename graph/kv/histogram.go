@@ -0,0 +1,144 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// Histograms are built from a sample of quads read from random positions of the log.
+// They are cached and rebuilt once the number of quads changes significantly.
+
+var _ graph.Histograms = (*QuadStore)(nil)
+
+const (
+	// histogramSample is the number of quads sampled to build a histogram.
+	histogramSample = 10000
+	// histogramTop is the number of the most frequent nodes kept in histograms.
+	histogramTop = 32
+)
+
+// histograms caches histograms of each direction.
+type histograms struct {
+	sync.Mutex
+	quads    int64 // number of quads when histograms were built
+	hist     *[4]*graph.Histogram
+	building bool // set while histograms are built by one of the callers
+}
+
+// Histogram implements graph.Histograms.
+//
+// Histograms are built by the first caller that finds them missing or outdated. Meanwhile, other callers
+// get outdated histograms, or nil if there are none.
+func (qs *QuadStore) Histogram(ctx context.Context, d quad.Direction) (*graph.Histogram, error) {
+	if d < quad.Subject || d > quad.Label {
+		return nil, fmt.Errorf("illegal direction: %v", d)
+	}
+	size, err := qs.Size(ctx)
+	if err != nil {
+		return nil, err
+	}
+	qs.hist.Lock()
+	cur, diff := qs.hist.hist, size-qs.hist.quads
+	build := (cur == nil || diff > qs.hist.quads/10 || -diff > qs.hist.quads/10) && !qs.hist.building
+	qs.hist.building = qs.hist.building || build
+	qs.hist.Unlock()
+	if build {
+		hist, err := qs.buildHistograms(ctx, size)
+		qs.hist.Lock()
+		if err == nil {
+			qs.hist.hist, qs.hist.quads = hist, size
+		}
+		qs.hist.building = false
+		qs.hist.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		cur = hist
+	}
+	if cur == nil {
+		return nil, nil
+	}
+	return cur[d-1], nil
+}
+
+// buildHistograms samples quads and builds histograms for all directions at once.
+func (qs *QuadStore) buildHistograms(ctx context.Context, size int64) (*[4]*graph.Histogram, error) {
+	sample, err := qs.sampleQuads(ctx, histogramSample)
+	if err != nil {
+		return nil, err
+	}
+	hist := new([4]*graph.Histogram)
+	for _, dir := range quad.Directions {
+		nodes := make([]graph.Ref, 0, len(sample))
+		for _, p := range sample {
+			if id := p.GetDirection(dir); id != 0 {
+				nodes = append(nodes, Int64Value(id))
+			} else {
+				nodes = append(nodes, nil)
+			}
+		}
+		hist[dir-1] = graph.NewHistogram(size, nodes, histogramTop)
+	}
+	return hist, nil
+}
+
+// sampleQuads reads up to n live quads from random positions of the log.
+// If the log is small enough, all quads are returned.
+func (qs *QuadStore) sampleQuads(ctx context.Context, n int) ([]quadPrimitive, error) {
+	horizon := uint64(qs.horizon(ctx))
+	if horizon == 0 {
+		return nil, nil
+	}
+	var (
+		out      []quadPrimitive
+		ids      = make([]uint64, 0, nextBatch)
+		attempts = 4 * uint64(n)
+		all      = horizon <= attempts
+	)
+	if all {
+		attempts = horizon
+	}
+	err := kv.View(ctx, qs.db, func(tx kv.Tx) error {
+		for i := uint64(1); i <= attempts && len(out) < n; i++ {
+			id := i
+			if !all {
+				id = 1 + rand.Uint64N(horizon)
+			}
+			ids = append(ids, id)
+			if len(ids) < nextBatch && i < attempts {
+				continue
+			}
+			prims, err := qs.getPrimitivesFromLog(ctx, tx, ids)
+			if err != nil {
+				return err
+			}
+			for _, p := range prims {
+				if !qs.isLive(p) || p.IsNode() || p.Subject == 0 {
+					continue
+				}
+				out = append(out, quadPrimitive{
+					p.Subject, p.Predicate, p.Object, p.Label,
+				})
+			}
+			ids = ids[:0]
+		}
+		return nil
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, err
+}
+
+// quadPrimitive holds node IDs of a quad.
+type quadPrimitive [4]uint64
+
+func (q quadPrimitive) GetDirection(d quad.Direction) uint64 {
+	return q[d-1]
+}
@@ -0,0 +1,477 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/options"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+var (
+	ErrIndexExists   = errors.New("kv: index already exists")
+	ErrIndexNotFound = errors.New("kv: index does not exist")
+)
+
+// indexBackfillBatch is the number of log entries processed in a single transaction during backfill.
+const indexBackfillBatch = 10000
+
+// IndexStatus describes a quad index of the store.
+type IndexStatus struct {
+	QuadIndex
+	// Building is set for indexes that are not yet used for reads.
+	Building bool
+	// Done is the last log position indexed by the backfill, and End is the position it will stop at.
+	// Everything written after End is indexed by regular writes.
+	Done, End int64
+}
+
+func (ind QuadIndex) String() string {
+	buf := make([]byte, len(ind.Dirs))
+	for i, d := range ind.Dirs {
+		buf[i] = d.Prefix()
+	}
+	s := string(buf)
+	if ind.Unique {
+		s += " (unique)"
+	}
+	return s
+}
+
+// ParseQuadIndex parses an index definition from a string of direction prefixes, for example "po"
+// for an index on predicate and object. Directions are: "s" - subject, "p" - predicate, "o" - object
+// and "c" - label.
+func ParseQuadIndex(s string) (QuadIndex, error) {
+	var ind QuadIndex
+	for _, c := range []byte(s) {
+		var d quad.Direction
+		switch c {
+		case 's':
+			d = quad.Subject
+		case 'p':
+			d = quad.Predicate
+		case 'o':
+			d = quad.Object
+		case 'c':
+			d = quad.Label
+		default:
+			return QuadIndex{}, fmt.Errorf("kv: invalid index direction: %q", c)
+		}
+		ind.Dirs = append(ind.Dirs, d)
+	}
+	if err := ind.validate(); err != nil {
+		return QuadIndex{}, err
+	}
+	return ind, nil
+}
+
+func (ind QuadIndex) validate() error {
+	if len(ind.Dirs) == 0 {
+		return errors.New("kv: index must have at least one direction")
+	}
+	seen := make(map[quad.Direction]struct{}, len(ind.Dirs))
+	for _, d := range ind.Dirs {
+		if d == quad.Any || d.Prefix() == 0 {
+			return errors.New("invalid direction")
+		}
+		if _, ok := seen[d]; ok {
+			return fmt.Errorf("kv: duplicate direction in index: %v", d)
+		}
+		seen[d] = struct{}{}
+	}
+	return nil
+}
+
+func indexMetaKey(ind QuadIndex, name string) string {
+	return "index/" + string(ind.bucket()[0]) + "/" + name
+}
+
+// writeAllIndexesMeta writes both active and building indexes in a given transaction.
+func (qs *QuadStore) writeAllIndexesMeta(ctx context.Context, tx kv.Tx, all, building []QuadIndex) error {
+	data, err := encodeQuadIndexes(all)
+	if err != nil {
+		return err
+	}
+	if err = tx.Put(ctx, kv.Key{keyMetaIndexes}, data); err != nil {
+		return err
+	}
+	if len(building) == 0 {
+		if err = tx.Del(ctx, kv.Key{keyMetaIndexesBuilding}); err != nil && err != kv.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+	data, err = encodeQuadIndexes(building)
+	if err != nil {
+		return err
+	}
+	return tx.Put(ctx, kv.Key{keyMetaIndexesBuilding}, data)
+}
+
+func findIndex(list []QuadIndex, ind QuadIndex) int {
+	for i, in := range list {
+		if CompareQuadDirections(in.Dirs, ind.Dirs) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Indexes returns the status of all quad indexes of the store.
+func (qs *QuadStore) Indexes(ctx context.Context) ([]IndexStatus, error) {
+	qs.indexes.RLock()
+	all, building := qs.indexes.all, qs.indexes.building
+	qs.indexes.RUnlock()
+	out := make([]IndexStatus, 0, len(all)+len(building))
+	for _, ind := range all {
+		out = append(out, IndexStatus{QuadIndex: ind})
+	}
+	err := kv.View(ctx, qs.db, func(tx kv.Tx) error {
+		for _, ind := range building {
+			st := IndexStatus{QuadIndex: ind, Building: true}
+			var err error
+			if st.Done, err = qs.getMetaIntTx(ctx, tx, indexMetaKey(ind, "done")); err != nil && err != kv.ErrNotFound {
+				return err
+			}
+			if st.End, err = qs.getMetaIntTx(ctx, tx, indexMetaKey(ind, "end")); err != nil && err != kv.ErrNotFound {
+				return err
+			}
+			out = append(out, st)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// AddIndex adds a new quad index to the store without blocking writes.
+//
+// All new quads are added to the index right away, while existing quads are indexed in batches
+// from the log. The index is used for reads only after the backfill completes.
+// The progress is saved after each batch; if the process is interrupted, calling AddIndex again resumes the backfill.
+func (qs *QuadStore) AddIndex(ctx context.Context, ind QuadIndex) error {
+	if qs.view != nil {
+		return kv.ErrReadOnly
+	}
+	if err := ind.validate(); err != nil {
+		return err
+	}
+	if ind.Unique {
+		// uniqueness cannot be enforced for existing data
+		return errors.New("kv: unique index cannot be added to an existing database")
+	}
+	if err := qs.registerIndex(ctx, ind); err != nil {
+		return err
+	}
+	for {
+		done, err := qs.backfillIndex(ctx, ind)
+		if err != nil {
+			return err
+		} else if done {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return qs.activateIndex(ctx, ind)
+}
+
+// registerIndex adds the index to the list of indexes maintained by writes and records the backfill range.
+func (qs *QuadStore) registerIndex(ctx context.Context, ind QuadIndex) error {
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	qs.indexes.RLock()
+	all, building := qs.indexes.all, qs.indexes.building
+	qs.indexes.RUnlock()
+	if findIndex(all, ind) >= 0 {
+		return ErrIndexExists
+	} else if findIndex(building, ind) >= 0 {
+		// resume the backfill
+		return nil
+	}
+	building = append(building[:len(building):len(building)], ind)
+	err := kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+		if err := qs.writeAllIndexesMeta(ctx, tx, all, building); err != nil {
+			return err
+		}
+		// quads added after this point are indexed by regular writes
+		end, err := qs.readHorizonTx(ctx, tx)
+		if err != nil && err != kv.ErrNotFound {
+			return err
+		}
+		if err = qs.putMetaInt(ctx, tx, indexMetaKey(ind, "done"), 0); err != nil {
+			return err
+		}
+		return qs.putMetaInt(ctx, tx, indexMetaKey(ind, "end"), end)
+	})
+	if err != nil {
+		return err
+	}
+	qs.indexes.Lock()
+	qs.indexes.building = building
+	qs.indexes.Unlock()
+	return nil
+}
+
+// backfillIndex indexes the next batch of quads from the log. It returns true when there is nothing left to index.
+//
+// The log is read from a snapshot without blocking writes, since entries below the end of the backfill
+// are only changed by Compact. Only merging the batch into posting lists runs under the writer lock,
+// as it modifies lists shared with writes.
+func (qs *QuadStore) backfillIndex(ctx context.Context, ind QuadIndex) (bool, error) {
+	var (
+		done, end, last int64
+		compacted       int64
+		postings        map[string][]uint64
+		keys            []kv.Key
+	)
+	err := kv.View(ctx, qs.db, func(tx kv.Tx) error {
+		var err error
+		if compacted, err = qs.getMetaIntTx(ctx, tx, metaCompacted); err != nil && err != kv.ErrNotFound {
+			return err
+		}
+		done, err = qs.getMetaIntTx(ctx, tx, indexMetaKey(ind, "done"))
+		if err != nil && err != kv.ErrNotFound {
+			return err
+		}
+		end, err = qs.getMetaIntTx(ctx, tx, indexMetaKey(ind, "end"))
+		if err != nil && err != kv.ErrNotFound {
+			return err
+		}
+		if done >= end {
+			return nil
+		}
+		last = min(done+indexBackfillBatch, end)
+		postings, keys, err = qs.readIndexBackfill(ctx, tx, ind, uint64(done)+1, uint64(last))
+		return err
+	})
+	if err != nil {
+		return false, err
+	} else if done >= end {
+		return true, nil
+	}
+	unlock := qs.lockWrites()
+	defer unlock()
+	err = retryConflicts(ctx, func() error {
+		return kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+			cur, err := qs.getMetaIntTx(ctx, tx, indexMetaKey(ind, "done"))
+			if err == kv.ErrNotFound {
+				// the index was dropped concurrently
+				return ErrIndexNotFound
+			} else if err != nil {
+				return err
+			} else if cur != done {
+				// the batch was merged by a concurrent call
+				return nil
+			}
+			if cur, err = qs.getMetaIntTx(ctx, tx, metaCompacted); err != nil && err != kv.ErrNotFound {
+				return err
+			} else if cur != compacted {
+				// entries read from the snapshot might be removed since then; the batch is read again
+				last = done
+				return nil
+			}
+			if len(keys) != 0 {
+				// writes may have appended larger IDs to the same posting lists; merging keeps them sorted
+				vals, err := tx.GetBatch(ctx, keys)
+				if err != nil {
+					return err
+				}
+				for i, key := range keys {
+					cur, err := decodeIndex(vals[i])
+					if err != nil {
+						return err
+					}
+					list := mergeSortedUint64(cur, postings[string(key[1])])
+					if err = tx.Put(ctx, key, appendIndex(nil, list)); err != nil {
+						return err
+					}
+				}
+			}
+			return qs.putMetaInt(ctx, tx, indexMetaKey(ind, "done"), last)
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	if clog.V(1) && last > done {
+		clog.Infof("index %v: backfilled %d/%d", ind, last, end)
+	}
+	return last >= end, nil
+}
+
+// readIndexBackfill reads log entries in the range [from, to] and returns posting lists of the index for them.
+func (qs *QuadStore) readIndexBackfill(ctx context.Context, tx kv.Tx, ind QuadIndex, from, to uint64) (map[string][]uint64, []kv.Key, error) {
+	postings := make(map[string][]uint64)
+	var keys []kv.Key
+	ids := make([]uint64, 0, nextBatch)
+	for id := from; id <= to; id++ {
+		ids = append(ids, id)
+		if len(ids) < nextBatch && id < to {
+			continue
+		}
+		prims, err := qs.getPrimitivesFromLog(ctx, tx, ids)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range prims {
+			// deleted quads are indexed as well, since indexes are also used to read past states of the store
+			if p == nil || p.IsNode() || p.Subject == 0 {
+				continue
+			}
+			key := ind.KeyFor(p)
+			k := string(key[1])
+			if _, ok := postings[k]; !ok {
+				keys = append(keys, key)
+			}
+			postings[k] = append(postings[k], p.ID)
+		}
+		ids = ids[:0]
+	}
+	return postings, keys, nil
+}
+
+// activateIndex makes a fully backfilled index available for reads.
+func (qs *QuadStore) activateIndex(ctx context.Context, ind QuadIndex) error {
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	qs.indexes.RLock()
+	all, building := qs.indexes.all, qs.indexes.building
+	qs.indexes.RUnlock()
+	i := findIndex(building, ind)
+	if i < 0 {
+		if findIndex(all, ind) >= 0 {
+			// activated by a concurrent call
+			return nil
+		}
+		return ErrIndexNotFound
+	}
+	all = append(all[:len(all):len(all)], building[i])
+	building = append(building[:i:i], building[i+1:]...)
+	err := kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+		if err := qs.writeAllIndexesMeta(ctx, tx, all, building); err != nil {
+			return err
+		}
+		return qs.delIndexProgress(ctx, tx, ind)
+	})
+	if err != nil {
+		return err
+	}
+	qs.setIndexes(all, building)
+	return nil
+}
+
+func (qs *QuadStore) delIndexProgress(ctx context.Context, tx kv.Tx, ind QuadIndex) error {
+	for _, name := range []string{"done", "end"} {
+		err := tx.Del(ctx, metaBucket.AppendBytes([]byte(indexMetaKey(ind, name))))
+		if err != nil && err != kv.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (qs *QuadStore) setIndexes(all, building []QuadIndex) {
+	qs.indexes.Lock()
+	qs.indexes.all = all
+	qs.indexes.building = building
+	// recalculate indexes used for duplicate detection
+	qs.indexes.exists = nil
+	qs.indexes.Unlock()
+}
+
+// DropIndex removes the quad index from the store and deletes its data.
+// Index that is still being built can be dropped as well, cancelling the backfill.
+//
+// Iterators that were already reading from the index may return incomplete results.
+func (qs *QuadStore) DropIndex(ctx context.Context, ind QuadIndex) error {
+	if qs.view != nil {
+		return kv.ErrReadOnly
+	}
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	qs.indexes.RLock()
+	all, building := qs.indexes.all, qs.indexes.building
+	qs.indexes.RUnlock()
+	if i := findIndex(all, ind); i >= 0 {
+		if len(all) == 1 {
+			return errors.New("kv: cannot drop the last index")
+		}
+		all = append(all[:i:i], all[i+1:]...)
+	} else if i = findIndex(building, ind); i >= 0 {
+		building = append(building[:i:i], building[i+1:]...)
+	} else {
+		return ErrIndexNotFound
+	}
+	err := kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+		if err := qs.writeAllIndexesMeta(ctx, tx, all, building); err != nil {
+			return err
+		}
+		return qs.delIndexProgress(ctx, tx, ind)
+	})
+	if err != nil {
+		return err
+	}
+	qs.setIndexes(all, building)
+	return qs.deleteIndexData(ctx, ind)
+}
+
+// deleteIndexData removes all keys of the index bucket in batches.
+func (qs *QuadStore) deleteIndexData(ctx context.Context, ind QuadIndex) error {
+	// empty last part prevents matching buckets of longer indexes, e.g. "ops" for "op"
+	return qs.deletePrefix(ctx, ind.Key(nil))
+}
+
+// deletePrefix removes all keys with a given prefix in batches.
+func (qs *QuadStore) deletePrefix(ctx context.Context, pref kv.Key) error {
+	for {
+		var keys []kv.Key
+		err := kv.View(ctx, qs.db, func(tx kv.Tx) error {
+			it := tx.Scan(ctx, options.WithPrefixKV(pref))
+			defer it.Close()
+			for len(keys) < indexBackfillBatch && it.Next(ctx) {
+				keys = append(keys, it.Key().Clone())
+			}
+			return it.Err()
+		})
+		if err != nil {
+			return err
+		} else if len(keys) == 0 {
+			return nil
+		}
+		err = kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+			for _, k := range keys {
+				if err := tx.Del(ctx, k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mergeSortedUint64 merges two sorted lists, removing duplicates.
+func mergeSortedUint64(a, b []uint64) []uint64 {
+	out := make([]uint64, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		var v uint64
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			v, a = a[0], a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			v, b = b[0], b[1:]
+		default:
+			v, a, b = a[0], a[1:], b[1:]
+		}
+		if n := len(out); n == 0 || out[n-1] != v {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -61,7 +61,7 @@ func (qs *QuadStore) IterateIndexPrefixNextRefs(
 				if err != nil {
 					return false, err
 				}
-				if p != nil && !p.Deleted {
+				if qs.isLive(p) {
 					live = true
 					return true, nil
 				}
@@ -44,6 +44,8 @@ var (
 	logIndex   = kv.Key{[]byte("l")}
 
 	keyMetaIndexes = []byte("i")
+	// indexes that are still being backfilled
+	keyMetaIndexesBuilding = []byte("ib")
 
 	DefaultQuadIndexes = []QuadIndex{
 		// First index optimizes forward traversals. Getting all relations for a node should
@@ -145,17 +147,32 @@ func bucketForValRefs() kv.Key {
 	return kv.Key{[]byte{'n'}}
 }
 
-type metaCache struct {
-	vals   map[string]int64
-	loaded map[string]struct{}
-	dirty  map[string]struct{}
+// txCache buffers changes made by a single write transaction. Meta counters and index postings
+// are written right before the commit, while in-memory caches of the store are only updated
+// after the transaction commits, since it may be retried or rolled back.
+type txCache struct {
+	// changes of meta counters, see incMetaInt
+	vals  map[string]int64
+	dirty map[string]struct{}
+	// range of IDs allocated by the transaction, see genIDs
+	first, last uint64
+
+	postings map[string]map[string]*indexPosting
+	// IDs of IRIs resolved or created by the transaction; zero ID is set for deleted nodes
+	iris map[string]uint64
+	// quads added by the transaction
+	quads []refs.QuadHash
+
+	// changes of per-predicate statistics, see countQuad
+	preds map[uint64]int64
+	pairs map[string]*pairCount
 }
 
-func newMetaCache() *metaCache {
-	return &metaCache{
-		vals:   make(map[string]int64),
-		loaded: make(map[string]struct{}),
-		dirty:  make(map[string]struct{}),
+func newTxCache() *txCache {
+	return &txCache{
+		vals:  make(map[string]int64),
+		dirty: make(map[string]struct{}),
+		iris:  make(map[string]uint64),
 	}
 }
 
@@ -173,25 +190,37 @@ func (qs *QuadStore) writeIndexesMeta(ctx context.Context) error {
 
 // readIndexesMeta read metadata about current indexes from the KV database.
 // If no indexes are set, it returns a list of legacy indexes to preserve backward compatibility.
-func (qs *QuadStore) readIndexesMeta(ctx context.Context) ([]QuadIndex, error) {
+// It also returns a list of indexes that are still being built.
+func (qs *QuadStore) readIndexesMeta(ctx context.Context) ([]QuadIndex, []QuadIndex, error) {
 	tx, err := qs.db.Tx(ctx, false)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer tx.Close()
 	val, err := tx.Get(ctx, kv.Key{keyMetaIndexes})
 	if err == kv.ErrNotFound {
-		return DefaultQuadIndexes, nil
+		return DefaultQuadIndexes, nil, nil
 	} else if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	out, err := decodeQuadIndexes(val)
 	if err != nil {
-		return nil, fmt.Errorf("cannot decode indexes: %v", err)
+		return nil, nil, fmt.Errorf("cannot decode indexes: %v", err)
 	} else if len(out) == 0 {
-		return DefaultQuadIndexes, nil
+		out = DefaultQuadIndexes
 	}
-	return out, nil
+	// building indexes are only set together with the list above
+	val, err = tx.Get(ctx, kv.Key{keyMetaIndexesBuilding})
+	if err == kv.ErrNotFound {
+		return out, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	building, err := decodeQuadIndexes(val)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decode indexes: %v", err)
+	}
+	return out, building, nil
 }
 
 func encodeQuadIndexes(indexes []QuadIndex) ([]byte, error) {
@@ -234,12 +263,18 @@ func decodeQuadIndexes(data []byte) ([]QuadIndex, error) {
 	return indexes, nil
 }
 
-func (qs *QuadStore) resolveValDeltas(ctx context.Context, tx kv.Tx, deltas []graphlog.NodeUpdate, fnc func(i int, id uint64)) error {
+func (qs *QuadStore) resolveValDeltas(ctx context.Context, tx kv.Tx, cache *txCache, deltas []graphlog.NodeUpdate, fnc func(i int, id uint64)) error {
 	inds := make([]int, 0, len(deltas))
 	keys := make([]kv.Key, 0, len(deltas))
 	for i, d := range deltas {
 		if iri, ok := d.Val.(quad.IRI); ok {
-			if x, ok := qs.valueLRU.Get(string(iri)); ok {
+			if id, ok := cache.iris[string(iri)]; ok {
+				// node might be deleted by this transaction, read it from the database in this case
+				if id != 0 {
+					fnc(i, id)
+					continue
+				}
+			} else if x, ok := qs.valueLRU.Get(string(iri)); ok {
 				fnc(i, x.(uint64))
 				continue
 			}
@@ -266,7 +301,7 @@ func (qs *QuadStore) resolveValDeltas(ctx context.Context, tx kv.Tx, deltas []gr
 		id, _ := binary.Uvarint(b)
 		d := &deltas[ind]
 		if iri, ok := d.Val.(quad.IRI); ok && id != 0 {
-			qs.valueLRU.Put(string(iri), id)
+			cache.iris[string(iri)] = id
 		}
 		fnc(ind, id)
 	}
@@ -283,44 +318,30 @@ func (qs *QuadStore) getMetaIntTx(ctx context.Context, tx kv.Tx, key string) (in
 	return int64(binary.LittleEndian.Uint64(val)), nil
 }
 
+// incMetaInt adds n to a meta counter. If the cache is set, the change is buffered and written to
+// the record of the transaction by flushMetaCache, see writeCounterDeltas.
 func (qs *QuadStore) incMetaInt(
 	ctx context.Context,
 	tx kv.Tx,
-	cache *metaCache,
+	cache *txCache,
 	key string,
 	n int64,
-) (int64, error) {
+) error {
 	if n == 0 {
-		return 0, nil
+		return nil
 	}
 	if cache != nil {
-		if _, ok := cache.loaded[key]; !ok {
-			getCtx, getTask := trace.NewTask(ctx, "cayley/kv/inc-meta-int/get-meta")
-			v, err := qs.getMetaIntTx(getCtx, tx, key)
-			getTask.End()
-			if err != nil && err != kv.ErrNotFound {
-				return 0, fmt.Errorf("cannot get %s: %v", key, err)
-			}
-			cache.vals[key] = v
-			cache.loaded[key] = struct{}{}
-		}
-		start := cache.vals[key]
-		cache.vals[key] = start + n
+		cache.vals[key] += n
 		cache.dirty[key] = struct{}{}
-		return start, nil
+		return nil
 	}
 	getCtx, getTask := trace.NewTask(ctx, "cayley/kv/inc-meta-int/get-meta")
 	v, err := qs.getMetaIntTx(getCtx, tx, key)
 	getTask.End()
 	if err != nil && err != kv.ErrNotFound {
-		return 0, fmt.Errorf("cannot get %s: %v", key, err)
+		return fmt.Errorf("cannot get %s: %v", key, err)
 	}
-	start := v
-	v += n
-	if err := qs.putMetaInt(ctx, tx, key, v); err != nil {
-		return 0, err
-	}
-	return start, nil
+	return qs.putMetaInt(ctx, tx, key, v+n)
 }
 
 func (qs *QuadStore) putMetaInt(ctx context.Context, tx kv.Tx, key string, v int64) error {
@@ -336,8 +357,14 @@ func (qs *QuadStore) putMetaInt(ctx context.Context, tx kv.Tx, key string, v int
 	return nil
 }
 
-func (qs *QuadStore) flushMetaCache(ctx context.Context, tx kv.Tx, cache *metaCache) error {
-	if cache == nil || len(cache.dirty) == 0 {
+// flushMetaCache writes changes of meta counters buffered in the cache. Transactions that allocated IDs
+// write them to a separate record, others update counters directly.
+func (qs *QuadStore) flushMetaCache(ctx context.Context, tx kv.Tx, cache *txCache) error {
+	if cache == nil {
+		return nil
+	} else if cache.first != 0 {
+		return qs.writeCounterDeltas(ctx, tx, cache)
+	} else if len(cache.dirty) == 0 {
 		return nil
 	}
 	keys := make([]string, 0, len(cache.dirty))
@@ -346,25 +373,15 @@ func (qs *QuadStore) flushMetaCache(ctx context.Context, tx kv.Tx, cache *metaCa
 	}
 	sort.Strings(keys)
 	for _, key := range keys {
-		if err := qs.putMetaInt(ctx, tx, key, cache.vals[key]); err != nil {
+		if err := qs.incMetaInt(ctx, tx, nil, key, cache.vals[key]); err != nil {
 			return err
 		}
 	}
+	clear(cache.vals)
 	clear(cache.dirty)
 	return nil
 }
 
-func (qs *QuadStore) genIDs(ctx context.Context, tx kv.Tx, cache *metaCache, n int) (uint64, error) {
-	if n == 0 {
-		return 0, nil
-	}
-	start, err := qs.incMetaInt(ctx, tx, cache, "horizon", int64(n))
-	if err != nil {
-		return 0, err
-	}
-	return uint64(start + 1), nil
-}
-
 type nodeUpdate struct {
 	Ind int
 	ID  uint64
@@ -432,7 +449,7 @@ type resolvedNode struct {
 func (qs *QuadStore) incNodes(
 	ctx context.Context,
 	tx kv.Tx,
-	cache *metaCache,
+	cache *txCache,
 	deltas []graphlog.NodeUpdate,
 	resolved map[refs.ValueHash]uint64,
 ) (map[refs.ValueHash]resolvedNode, error) {
@@ -465,7 +482,7 @@ func (qs *QuadStore) incNodes(
 	}
 	if len(unresolved) != 0 {
 		resolveCtx, resolveTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/apply-add-deltas/inc-nodes/resolve-values")
-		err := qs.resolveValDeltas(resolveCtx, tx, unresolved, func(i int, id uint64) {
+		err := qs.resolveValDeltas(resolveCtx, tx, cache, unresolved, func(i int, id uint64) {
 			handleResolved(unresolvedInds[i], id)
 		})
 		resolveTask.End()
@@ -496,7 +513,7 @@ func (qs *QuadStore) incNodes(
 
 			node.ID = id
 			ids[iv.Hash] = resolvedNode{ID: id, New: true}
-			if err := qs.indexNode(ctx, tx, node, iv.Val); err != nil {
+			if err := qs.indexNode(ctx, tx, cache, node, iv.Val); err != nil {
 				indexTask.End()
 				return ids, err
 			}
@@ -510,7 +527,7 @@ func (qs *QuadStore) incNodes(
 	return ids, err
 }
 
-func (qs *QuadStore) decNodes(ctx context.Context, tx kv.Tx, deltas []graphlog.NodeUpdate, nodes map[refs.ValueHash]uint64) error {
+func (qs *QuadStore) decNodes(ctx context.Context, tx kv.Tx, cache *txCache, deltas []graphlog.NodeUpdate, nodes map[refs.ValueHash]uint64) error {
 	upds := make([]nodeUpdate, 0, len(deltas))
 	for i, d := range deltas {
 		id := nodes[d.Hash]
@@ -523,22 +540,25 @@ func (qs *QuadStore) decNodes(ctx context.Context, tx kv.Tx, deltas []graphlog.N
 	if err != nil {
 		return err
 	}
-	for _, i := range del {
+	tomb, err := qs.genIDs(ctx, tx, cache, len(del))
+	if err != nil {
+		return err
+	}
+	for j, i := range del {
 		d := upds[i]
 		key := bucketKeyForHash(d.Hash[:])
 		if err = tx.Del(ctx, key); err != nil {
 			return err
 		}
 		if iri, ok := d.Val.(quad.IRI); ok {
-			qs.valueLRU.Del(string(iri))
+			cache.iris[string(iri)] = 0
 		}
 		node, err := createNodePrimitive(d.Val)
 		if err != nil {
 			return err
 		}
 		node.ID = d.ID
-		node.Deleted = true
-		if err := qs.addToLog(ctx, tx, node); err != nil {
+		if err := qs.markAsDead(ctx, tx, node, tomb+uint64(j)); err != nil {
 			return err
 		}
 	}
@@ -546,13 +566,16 @@ func (qs *QuadStore) decNodes(ctx context.Context, tx kv.Tx, deltas []graphlog.N
 }
 
 func (qs *QuadStore) NewQuadWriter(ctx context.Context) (quad.WriteCloser, error) {
+	if qs.view != nil {
+		return nil, kv.ErrReadOnly
+	}
 	return &quadWriter{qs: qs}, nil
 }
 
 type quadWriter struct {
 	qs  *QuadStore
 	tx  kv.Tx
-	mc  *metaCache
+	mc  *txCache
 	err error
 	n   int
 }
@@ -562,45 +585,50 @@ func (w *quadWriter) WriteQuad(ctx context.Context, q quad.Quad) error {
 	return err
 }
 
-func (w *quadWriter) flush(ctx context.Context) error {
-	w.n = 0
-	if err := w.qs.flushMapBucket(ctx, w.tx); err != nil {
-		w.err = err
+// begin opens a new transaction. The caller must hold the writer lock exclusively,
+// since bulk writes would likely conflict with concurrent transactions.
+func (w *quadWriter) begin(ctx context.Context) error {
+	tx, err := w.qs.db.Tx(ctx, true)
+	if err != nil {
 		return err
 	}
-	if err := w.qs.flushMetaCache(ctx, w.tx, w.mc); err != nil {
-		w.err = err
-		return err
+	w.tx, w.mc = tx, newTxCache()
+	return nil
+}
+
+// end commits the current transaction if commit is set, and releases it.
+func (w *quadWriter) end(ctx context.Context, commit bool) error {
+	var err error
+	if commit {
+		err = w.qs.commitTx(ctx, w.tx, w.mc)
 	}
-	if err := w.tx.Commit(ctx); err != nil {
-		w.qs.writer.Unlock()
-		w.tx = nil
-		w.mc = nil
-		w.err = err
-		return err
+	_ = w.tx.Close()
+	w.qs.endTx(ctx, w.mc, commit && err == nil)
+	w.tx, w.mc = nil, nil
+	return err
+}
+
+func (w *quadWriter) flush(ctx context.Context) error {
+	w.n = 0
+	err := w.end(ctx, true)
+	if err == nil {
+		err = w.begin(ctx)
 	}
-	tx, err := w.qs.db.Tx(ctx, true)
 	if err != nil {
 		w.qs.writer.Unlock()
 		w.err = err
-		return err
 	}
-	w.tx = tx
-	w.mc = newMetaCache()
-	return nil
+	return err
 }
 
 func (w *quadWriter) WriteQuads(ctx context.Context, buf []quad.Quad) (int, error) {
 	if w.tx == nil {
 		w.qs.writer.Lock()
-		tx, err := w.qs.db.Tx(ctx, true)
-		if err != nil {
+		if err := w.begin(ctx); err != nil {
 			w.qs.writer.Unlock()
 			w.err = err
 			return 0, err
 		}
-		w.tx = tx
-		w.mc = newMetaCache()
 	}
 	deltas := graphlog.InsertQuads(buf)
 	if _, err := w.qs.applyAddDeltas(w.tx, w.mc, nil, deltas, graph.IgnoreOpts{IgnoreDup: true}, nil); err != nil {
@@ -622,37 +650,19 @@ func (w *quadWriter) Close() error {
 	}
 	defer w.qs.writer.Unlock()
 
+	ctx := context.TODO()
 	if w.err != nil {
-		_ = w.tx.Close()
-		w.tx = nil
+		_ = w.end(ctx, false)
 		return w.err
 	}
-
-	ctx := context.TODO()
 	// flush quad indexes and commit
-	err := w.qs.flushMapBucket(ctx, w.tx)
-	if err != nil {
-		_ = w.tx.Close()
-		w.tx = nil
-		w.mc = nil
-		return err
-	}
-	err = w.qs.flushMetaCache(ctx, w.tx, w.mc)
-	if err != nil {
-		_ = w.tx.Close()
-		w.tx = nil
-		w.mc = nil
-		return err
-	}
-	err = w.tx.Commit(ctx)
-	w.tx = nil
-	w.mc = nil
-	return err
+	return w.end(ctx, true)
 }
 
 func (qs *QuadStore) precheckAddDeltas(
 	ctx context.Context,
 	tx kv.Tx,
+	cache *txCache,
 	in []graph.Delta,
 	ignoreOpts graph.IgnoreOpts,
 ) ([]graph.Delta, map[refs.ValueHash]uint64, error) {
@@ -669,10 +679,8 @@ func (qs *QuadStore) precheckAddDeltas(
 			continue
 		}
 		qh := quadHashOf(d.Quad)
-		if ignoreOpts.IgnoreDup {
-			if _, ok := qs.quadExists[qh]; !ok {
-				continue
-			}
+		if ignoreOpts.IgnoreDup && !qs.quadRecentlyAdded(qh) {
+			continue
 		}
 		if qhashes == nil {
 			qhashes = make([]refs.QuadHash, len(in))
@@ -706,7 +714,7 @@ func (qs *QuadStore) precheckAddDeltas(
 
 	nodes := make(map[refs.ValueHash]uint64, len(nodesToResolve))
 	resolveCtx, resolveTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/precheck-adds/resolve-nodes")
-	err := qs.resolveValDeltas(resolveCtx, tx, nodesToResolve, func(i int, id uint64) {
+	err := qs.resolveValDeltas(resolveCtx, tx, cache, nodesToResolve, func(i int, id uint64) {
 		nodes[nodesToResolve[i].Hash] = id
 	})
 	resolveTask.End()
@@ -767,6 +775,7 @@ func (qs *QuadStore) precheckAddDeltas(
 func (qs *QuadStore) filterDuplicateAddDeltas(
 	ctx context.Context,
 	tx kv.Tx,
+	cache *txCache,
 	in []graph.Delta,
 	deltas *graphlog.Deltas,
 	ignoreOpts graph.IgnoreOpts,
@@ -777,7 +786,7 @@ func (qs *QuadStore) filterDuplicateAddDeltas(
 
 	nodes := make(map[refs.ValueHash]uint64, len(deltas.IncNode))
 	resolveCtx, resolveTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/apply-add-deltas/resolve-duplicate-check-nodes")
-	err := qs.resolveValDeltas(resolveCtx, tx, deltas.IncNode, func(i int, id uint64) {
+	err := qs.resolveValDeltas(resolveCtx, tx, cache, deltas.IncNode, func(i int, id uint64) {
 		nodes[deltas.IncNode[i].Hash] = id
 	})
 	resolveTask.End()
@@ -849,7 +858,7 @@ func (qs *QuadStore) filterDuplicateAddDeltas(
 
 func (qs *QuadStore) applyAddDeltas(
 	tx kv.Tx,
-	cache *metaCache,
+	cache *txCache,
 	in []graph.Delta,
 	deltas *graphlog.Deltas,
 	ignoreOpts graph.IgnoreOpts,
@@ -860,7 +869,7 @@ func (qs *QuadStore) applyAddDeltas(
 	if resolved == nil {
 		filterCtx, filterTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/apply-add-deltas/filter-duplicate-adds")
 		var err error
-		resolved, err = qs.filterDuplicateAddDeltas(filterCtx, tx, in, deltas, ignoreOpts)
+		resolved, err = qs.filterDuplicateAddDeltas(filterCtx, tx, cache, in, deltas, ignoreOpts)
 		filterTask.End()
 		if err != nil {
 			return nil, err
@@ -921,18 +930,29 @@ func (qs *QuadStore) applyAddDeltas(
 		return nil, err
 	}
 	indexTask.End()
-	for _, qh := range linkHashes {
-		qs.rememberQuadExists(qh)
-	}
+	cache.quads = append(cache.quads, linkHashes...)
 	return nodes, nil
 }
 
+// ApplyDeltas implements graph.QuadWriter.
+//
+// If the database supports concurrent writes, multiple calls run in parallel. Calls that conflict
+// with concurrent writes are retried, thus the result is the same as if they were applied one by one.
 func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	if qs.view != nil {
+		return kv.ErrReadOnly
+	}
 	ctx, task := trace.NewTask(ctx, "cayley/kv/apply-deltas")
 	defer task.End()
 
-	qs.writer.Lock()
-	defer qs.writer.Unlock()
+	unlock := qs.lockWrites()
+	defer unlock()
+	return retryConflicts(ctx, func() error {
+		return qs.applyDeltas(ctx, in, ignoreOpts)
+	})
+}
+
+func (qs *QuadStore) applyDeltas(ctx context.Context, in []graph.Delta, ignoreOpts graph.IgnoreOpts) (err error) {
 	txCtx, txTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/open-tx")
 	tx, err := qs.db.Tx(txCtx, true)
 	txTask.End()
@@ -941,9 +961,14 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, ignoreOp
 	}
 	defer tx.Close()
 
+	cache := newTxCache()
+	defer func() {
+		// commitTx is the last step, thus the transaction is committed if there is no error
+		qs.endTx(ctx, cache, err == nil)
+	}()
 	precheckCtx, precheckTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/precheck-adds")
 	var resolved map[refs.ValueHash]uint64
-	in, resolved, err = qs.precheckAddDeltas(precheckCtx, tx, in, ignoreOpts)
+	in, resolved, err = qs.precheckAddDeltas(precheckCtx, tx, cache, in, ignoreOpts)
 	precheckTask.End()
 	if err != nil {
 		return err
@@ -952,7 +977,7 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, ignoreOp
 	_, splitTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/split-deltas")
 	deltas := graphlog.SplitDeltas(in)
 	splitTask.End()
-	cache := newMetaCache()
+
 	_, addTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/apply-add-deltas")
 	nodes, err := qs.applyAddDeltas(tx, cache, in, deltas, ignoreOpts, resolved)
 	addTask.End()
@@ -965,7 +990,7 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, ignoreOp
 		// resolve all nodes that will be removed
 		dnodes := make(map[refs.ValueHash]uint64, len(deltas.DecNode))
 		resolveCtx, resolveTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/resolve-dec-nodes")
-		if err := qs.resolveValDeltas(resolveCtx, tx, deltas.DecNode, func(i int, id uint64) {
+		if err := qs.resolveValDeltas(resolveCtx, tx, cache, deltas.DecNode, func(i int, id uint64) {
 			dnodes[deltas.DecNode[i].Hash] = id
 		}); err != nil {
 			resolveTask.End()
@@ -1039,7 +1064,7 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, ignoreOp
 
 		// finally decrement and remove nodes
 		decCtx, decTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/dec-nodes")
-		if err := qs.decNodes(decCtx, tx, deltas.DecNode, dnodes); err != nil {
+		if err := qs.decNodes(decCtx, tx, cache, deltas.DecNode, dnodes); err != nil {
 			decTask.End()
 			return err
 		}
@@ -1048,22 +1073,13 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, ignoreOp
 		dnodes = nil
 	}
 	// flush quad indexes and commit
-	flushCtx, flushTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/flush-map-bucket")
-	err = qs.flushMapBucket(flushCtx, tx)
-	flushTask.End()
-	if err != nil {
-		return err
-	}
-	if err := qs.flushMetaCache(ctx, tx, cache); err != nil {
-		return err
-	}
 	commitCtx, commitTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/commit-tx")
-	err = tx.Commit(commitCtx)
+	err = qs.commitTx(commitCtx, tx, cache)
 	commitTask.End()
 	return err
 }
 
-func (qs *QuadStore) indexNode(ctx context.Context, tx kv.Tx, p *proto.Primitive, val quad.Value) error {
+func (qs *QuadStore) indexNode(ctx context.Context, tx kv.Tx, cache *txCache, p *proto.Primitive, val quad.Value) error {
 	var err error
 	if val == nil {
 		unmarshalCtx, unmarshalTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/apply-add-deltas/inc-nodes/index-new-nodes/index-node/unmarshal-value")
@@ -1082,7 +1098,7 @@ func (qs *QuadStore) indexNode(ctx context.Context, tx kv.Tx, p *proto.Primitive
 		return err
 	}
 	if iri, ok := val.(quad.IRI); ok {
-		qs.valueLRU.Put(string(iri), p.ID)
+		cache.iris[string(iri)] = p.ID
 	}
 	logCtx, logTask := trace.NewTask(ctx, "cayley/kv/apply-deltas/apply-add-deltas/inc-nodes/index-new-nodes/index-node/add-log")
 	err = qs.addToLog(logCtx, tx, p)
@@ -1090,21 +1106,23 @@ func (qs *QuadStore) indexNode(ctx context.Context, tx kv.Tx, p *proto.Primitive
 	return err
 }
 
-func (qs *QuadStore) indexLinks(ctx context.Context, tx kv.Tx, cache *metaCache, links []*proto.Primitive, newIDs map[uint64]struct{}) error {
+func (qs *QuadStore) indexLinks(ctx context.Context, tx kv.Tx, cache *txCache, links []*proto.Primitive, newIDs map[uint64]struct{}) error {
 	for _, p := range links {
-		if err := qs.indexLink(ctx, tx, p, newIDs); err != nil {
+		if err := qs.indexLink(ctx, tx, cache, p, newIDs); err != nil {
 			return err
 		}
 	}
-	_, err := qs.incMetaInt(ctx, tx, cache, "size", int64(len(links)))
-	return err
+	return qs.incMetaInt(ctx, tx, cache, "size", int64(len(links)))
 }
 
-func (qs *QuadStore) indexLink(ctx context.Context, tx kv.Tx, p *proto.Primitive, newIDs map[uint64]struct{}) error {
+func (qs *QuadStore) indexLink(ctx context.Context, tx kv.Tx, cache *txCache, p *proto.Primitive, newIDs map[uint64]struct{}) error {
 	var err error
 	qs.indexes.RLock()
-	all := qs.indexes.all
+	all, building := qs.indexes.all, qs.indexes.building
 	qs.indexes.RUnlock()
+	if len(building) != 0 {
+		all = append(all[:len(all):len(all)], building...)
+	}
 	for _, ind := range all {
 		// A posting list is empty on disk when any of its index-key directions
 		// resolves to a node minted in this transaction: no prior quad could
@@ -1116,11 +1134,14 @@ func (qs *QuadStore) indexLink(ctx context.Context, tx kv.Tx, p *proto.Primitive
 				break
 			}
 		}
-		err = qs.addToMapBucket(tx, ind.KeyFor(p), p.ID, fresh)
+		err = cache.addToMapBucket(ind.KeyFor(p), p.ID, fresh)
 		if err != nil {
 			return err
 		}
 	}
+	if qs.predStats.Load() {
+		cache.countQuad(p, +1, newIDs)
+	}
 	err = qs.indexSchema(tx, p)
 	if err != nil {
 		return err
@@ -1128,20 +1149,30 @@ func (qs *QuadStore) indexLink(ctx context.Context, tx kv.Tx, p *proto.Primitive
 	return qs.addToLog(ctx, tx, p)
 }
 
-func (qs *QuadStore) markAsDead(ctx context.Context, tx kv.Tx, p *proto.Primitive) error {
+// markAsDead marks the primitive as deleted and appends a tombstone with a given ID to the log.
+// Tombstones record the log position of the deletion, which is required for point-in-time reads.
+func (qs *QuadStore) markAsDead(ctx context.Context, tx kv.Tx, p *proto.Primitive, tomb uint64) error {
 	p.Deleted = true
-	// TODO(barakmich): Add tombstone?
-	return qs.addToLog(ctx, tx, p)
+	if err := qs.addToLog(ctx, tx, p); err != nil {
+		return err
+	}
+	return qs.addToLog(ctx, tx, &proto.Primitive{ID: tomb, Replaces: p.ID, Deleted: true})
 }
 
-func (qs *QuadStore) markLinksDead(ctx context.Context, tx kv.Tx, cache *metaCache, links []*proto.Primitive) error {
-	for _, p := range links {
-		if err := qs.markAsDead(ctx, tx, p); err != nil {
+func (qs *QuadStore) markLinksDead(ctx context.Context, tx kv.Tx, cache *txCache, links []*proto.Primitive) error {
+	tomb, err := qs.genIDs(ctx, tx, cache, len(links))
+	if err != nil {
+		return err
+	}
+	for i, p := range links {
+		if err := qs.markAsDead(ctx, tx, p, tomb+uint64(i)); err != nil {
 			return err
 		}
+		if qs.predStats.Load() {
+			cache.countQuad(p, -1, nil)
+		}
 	}
-	_, err := qs.incMetaInt(ctx, tx, cache, "size", -int64(len(links)))
-	return err
+	return qs.incMetaInt(ctx, tx, cache, "size", -int64(len(links)))
 }
 
 func (qs *QuadStore) getBucketIndexes(ctx context.Context, tx kv.Tx, keys []kv.Key) ([][]uint64, error) {
@@ -1248,6 +1279,8 @@ func (qs *QuadStore) bestIndexes(dirs []quad.Direction) []QuadIndex {
 	var (
 		max  int // more specific index is better
 		best QuadIndex
+		// index that has all the directions as a prefix
+		prefix []QuadIndex
 	)
 	for _, ind := range all {
 		if len(ind.Dirs) < len(dirs) {
@@ -1261,14 +1294,24 @@ func (qs *QuadStore) bestIndexes(dirs []quad.Direction) []QuadIndex {
 			match++
 		}
 		if match == len(dirs) {
-			// exact index match
-			return []QuadIndex{ind}
+			if len(ind.Dirs) == len(dirs) {
+				// exact index match
+				return []QuadIndex{ind}
+			}
+			if prefix == nil {
+				// an exact match may be defined later, for example by AddIndex
+				prefix = []QuadIndex{ind}
+			}
+			continue
 		}
 		if match > 0 && match > max {
 			best = ind
 			max = match
 		}
 	}
+	if prefix != nil {
+		return prefix
+	}
 	if max == 0 {
 		return nil
 	}
@@ -1322,7 +1365,7 @@ func (qs *QuadStore) hasPrimitive(ctx context.Context, tx kv.Tx, p *proto.Primit
 		if err != nil {
 			return nil, err
 		}
-		if prim.Deleted {
+		if !qs.isLive(prim) {
 			continue
 		}
 		if prim.IsSameLink(p) {
@@ -1367,7 +1410,7 @@ type indexPosting struct {
 	fresh bool
 }
 
-func (qs *QuadStore) addToMapBucket(tx kv.Tx, key kv.Key, value uint64, fresh bool) error {
+func (c *txCache) addToMapBucket(key kv.Key, value uint64, fresh bool) error {
 	if len(key) != 2 {
 		return fmt.Errorf("trying to add to map bucket with invalid key: %v", key)
 	}
@@ -1375,14 +1418,14 @@ func (qs *QuadStore) addToMapBucket(tx kv.Tx, key kv.Key, value uint64, fresh bo
 	if len(k) == 0 {
 		return fmt.Errorf("trying to add to map bucket %s with key 0", b)
 	}
-	if qs.mapBucket == nil {
-		qs.mapBucket = make(map[string]map[string]*indexPosting)
+	if c.postings == nil {
+		c.postings = make(map[string]map[string]*indexPosting)
 	}
 	bucket := string(b)
-	m, ok := qs.mapBucket[bucket]
+	m, ok := c.postings[bucket]
 	if !ok {
 		m = make(map[string]*indexPosting)
-		qs.mapBucket[bucket] = m
+		c.postings[bucket] = m
 	}
 	e, ok := m[string(k)]
 	if !ok {
@@ -1396,14 +1439,14 @@ func (qs *QuadStore) addToMapBucket(tx kv.Tx, key kv.Key, value uint64, fresh bo
 	return nil
 }
 
-func (qs *QuadStore) flushMapBucket(ctx context.Context, tx kv.Tx) error {
-	bs := make([]string, 0, len(qs.mapBucket))
-	for k := range qs.mapBucket {
+func (qs *QuadStore) flushMapBucket(ctx context.Context, tx kv.Tx, cache *txCache) error {
+	bs := make([]string, 0, len(cache.postings))
+	for k := range cache.postings {
 		bs = append(bs, k)
 	}
 	sort.Strings(bs)
 	for _, bucket := range bs {
-		m := qs.mapBucket[bucket]
+		m := cache.postings[bucket]
 		if len(m) == 0 {
 			continue
 		}
@@ -1441,7 +1484,7 @@ func (qs *QuadStore) flushMapBucket(ctx context.Context, tx kv.Tx) error {
 			}
 		}
 	}
-	qs.mapBucket = nil
+	cache.postings = nil
 	return nil
 }
 
@@ -1503,11 +1546,22 @@ func quadHashOf(q quad.Quad) refs.QuadHash {
 	return qh
 }
 
-func (qs *QuadStore) rememberQuadExists(qh refs.QuadHash) {
-	if len(qs.quadExists) >= 2000 {
-		clear(qs.quadExists)
+func (qs *QuadStore) quadRecentlyAdded(qh refs.QuadHash) bool {
+	qs.quadExists.Lock()
+	defer qs.quadExists.Unlock()
+	_, ok := qs.quadExists.m[qh]
+	return ok
+}
+
+func (qs *QuadStore) rememberQuadsExist(hashes []refs.QuadHash) {
+	qs.quadExists.Lock()
+	defer qs.quadExists.Unlock()
+	for _, qh := range hashes {
+		if len(qs.quadExists.m) >= 2000 {
+			clear(qs.quadExists.m)
+		}
+		qs.quadExists.m[qh] = struct{}{}
 	}
-	qs.quadExists[qh] = struct{}{}
 }
 
 func (qs *QuadStore) resolveQuadValues(ctx context.Context, tx kv.Tx, vals []quad.Value) ([]uint64, error) {
@@ -1527,6 +1581,9 @@ func (qs *QuadStore) resolveQuadValues(ctx context.Context, tx kv.Tx, vals []qua
 		keys = append(keys, bucketKeyForVal(v))
 	}
 	if len(keys) == 0 {
+		if qs.view != nil {
+			qs.view.resolveValues(vals, out)
+		}
 		return out, nil
 	}
 	resp, err := tx.GetBatch(ctx, keys)
@@ -1543,6 +1600,9 @@ func (qs *QuadStore) resolveQuadValues(ctx context.Context, tx kv.Tx, vals []qua
 			qs.valueLRU.Put(string(iri), out[ind])
 		}
 	}
+	if qs.view != nil {
+		qs.view.resolveValues(vals, out)
+	}
 	return out, nil
 }
 
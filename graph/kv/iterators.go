@@ -40,7 +40,8 @@ func (qs *QuadStore) indexSize(ctx context.Context, ind QuadIndex, vals []uint64
 	if len(ind.Dirs) == len(vals) {
 		return refs.Size{
 			Value: sz,
-			Exact: true,
+			// index of a view may contain quads added after the horizon
+			Exact: qs.view == nil,
 		}, nil
 	}
 	return refs.Size{
@@ -62,6 +63,9 @@ func (qs *QuadStore) QuadIteratorSize(ctx context.Context, d quad.Direction, v g
 			return qs.indexSize(ctx, ind, []uint64{uint64(vi)})
 		}
 	}
+	if sz, ok, err := qs.predicateSize(ctx, d, vi); err != nil || ok {
+		return sz, err
+	}
 	st, err := qs.Stats(ctx, false)
 	if err != nil {
 		return refs.Size{}, err
@@ -116,10 +120,14 @@ func (qs *QuadStore) optimizeQuadsAction(s shape.QuadsAction) (shape.Shape, bool
 	for _, d := range ind[0].Dirs {
 		v, ok := s.Filter[d].(Int64Value)
 		if !ok {
-			return s, false, nil
+			// the rest of the index can be scanned as a prefix
+			break
 		}
 		quads.Values = append(quads.Values, uint64(v))
 	}
+	if len(quads.Values) != len(s.Filter) {
+		return s, false, nil
+	}
 	return s.SimplifyFrom(quads), true, nil
 }
 
@@ -2,7 +2,10 @@ package kvtest
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/aperturerobotics/cayley/graph"
@@ -19,6 +22,7 @@ type DatabaseFunc func(t testing.TB) (hkv.KV, graph.Options, func())
 
 type Config struct {
 	AlwaysRunIntegration bool
+	NoSnapshots          bool // read transactions are not isolated from concurrent writes
 }
 
 func (c Config) quadStore() *graphtest.Config {
@@ -76,6 +80,130 @@ func TestAll(t *testing.T, gen DatabaseFunc, conf *Config) {
 	t.Run("optimize", func(t *testing.T) {
 		testOptimize(t, gen, conf)
 	})
+	t.Run("concurrent writes", func(t *testing.T) {
+		testConcurrentWrites(t, gen, conf)
+	})
+	t.Run("add index", func(t *testing.T) {
+		testAddIndexConcurrentWrites(t, gen, conf)
+	})
+}
+
+// testAddIndexConcurrentWrites checks that writes are not blocked by the index backfill,
+// and that quads written during the backfill are indexed.
+func testAddIndexConcurrentWrites(t *testing.T, gen DatabaseFunc, conf *Config) {
+	if conf.NoSnapshots {
+		t.Skip("database is not safe for concurrent reads and writes")
+	}
+	ctx := context.Background()
+	gqs, _, closer := NewQuadStore(t, gen)
+	defer closer()
+	qs := gqs.(*kv.QuadStore)
+
+	const (
+		n = 12000 // spans multiple backfill batches
+		m = 100
+	)
+	in := make([]graph.Delta, 0, n)
+	for i := 0; i < n; i++ {
+		in = append(in, graph.Delta{Action: graph.Add, Quad: quad.MakeIRI(fmt.Sprintf("s%d", i), "p", "b", "")})
+	}
+	require.NoError(t, qs.ApplyDeltas(ctx, in, graph.IgnoreOpts{}))
+
+	po, err := kv.ParseQuadIndex("po")
+	require.NoError(t, err)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- qs.AddIndex(ctx, po)
+	}()
+	for i := 0; i < m; i++ {
+		q := quad.MakeIRI(fmt.Sprintf("w%d", i), "p", "b", "")
+		require.NoError(t, qs.ApplyDeltas(ctx, []graph.Delta{{Action: graph.Add, Quad: q}}, graph.IgnoreOpts{}))
+	}
+	require.NoError(t, <-errc)
+
+	list, err := qs.Indexes(ctx)
+	require.NoError(t, err)
+	require.Equal(t, kv.IndexStatus{QuadIndex: po}, list[len(list)-1])
+
+	byPO := shape.Quads{
+		{Dir: quad.Predicate, Values: shape.Lookup{quad.IRI("p")}},
+		{Dir: quad.Object, Values: shape.Lookup{quad.IRI("b")}},
+	}
+	it := shape.BuildIterator(ctx, qs, byPO)
+	require.Len(t, graphtest.IteratedQuads(t, qs, it), n+m)
+}
+
+// testConcurrentWrites checks that concurrent transactions sharing nodes and quads
+// give the same result as if they were applied one by one.
+func testConcurrentWrites(t *testing.T, gen DatabaseFunc, _ *Config) {
+	const (
+		writers = 8
+		batches = 10
+	)
+	ctx := context.Background()
+	qs, _, closer := NewQuadStore(t, gen)
+	defer closer()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, writers)
+	)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := 0; b < batches; b++ {
+				s := quad.IRI(fmt.Sprintf("w%d_%d", w, b))
+				in := []graph.Delta{
+					{Action: graph.Add, Quad: quad.MakeIRI("shared", "p", "o", "")},
+					{Action: graph.Add, Quad: quad.Make(s, quad.IRI("p"), quad.IRI(fmt.Sprintf("o%d", b%3)), nil)},
+					{Action: graph.Add, Quad: quad.Make(s, quad.IRI("tmp"), quad.String("x"), nil)},
+				}
+				if err := qs.ApplyDeltas(ctx, in, graph.IgnoreOpts{IgnoreDup: true}); err != nil {
+					errs <- err
+					return
+				}
+				del := []graph.Delta{
+					{Action: graph.Delete, Quad: quad.Make(s, quad.IRI("tmp"), quad.String("x"), nil)},
+				}
+				if err := qs.ApplyDeltas(ctx, del, graph.IgnoreOpts{}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	exp := []string{quad.MakeIRI("shared", "p", "o", "").String()}
+	for w := 0; w < writers; w++ {
+		for b := 0; b < batches; b++ {
+			exp = append(exp, quad.MakeIRI(fmt.Sprintf("w%d_%d", w, b), "p", fmt.Sprintf("o%d", b%3), "").String())
+		}
+	}
+	sort.Strings(exp)
+
+	var got []string
+	for _, q := range graphtest.IteratedQuads(t, qs, qs.QuadsAllIterator(ctx)) {
+		got = append(got, q.String())
+	}
+	sort.Strings(got)
+	require.Equal(t, exp, got)
+
+	st, err := qs.Stats(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(exp)), st.Quads.Value)
+
+	// nodes that are no longer used must be removed
+	for _, v := range []quad.Value{quad.IRI("tmp"), quad.String("x")} {
+		ref, err := qs.ValueOf(ctx, v)
+		require.NoError(t, err)
+		require.Nil(t, ref, "%v", v)
+	}
 }
 
 func testOptimize(t *testing.T, gen DatabaseFunc, _ *Config) {
@@ -0,0 +1,22 @@
+// Package pebble registers the Pebble key-value backend for the quad store.
+// See the kv/flat/pebble package for its use of cgo.
+package pebble
+
+import (
+	"github.com/aperturerobotics/cayley/kv/flat/pebble"
+)
+
+const (
+	Type = pebble.Name
+)
+
+const (
+	// OptCacheSize is the size of the block cache in megabytes.
+	OptCacheSize = "cache_size_mb"
+	// OptMemTableSize is the size of a single memtable in megabytes.
+	OptMemTableSize = "memtable_size_mb"
+	// OptCompression is the compression of table blocks: "snappy", "zstd" or "none".
+	OptCompression = "compression"
+	// OptNoSync disables syncing the write-ahead log on each commit.
+	OptNoSync = "nosync"
+)
@@ -0,0 +1,90 @@
+
+package pebble
+
+import (
+	"os"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/kv"
+	hkv "github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/flat"
+	"github.com/aperturerobotics/cayley/kv/flat/pebble"
+)
+
+func init() {
+	kv.Register(Type, kv.Registration{
+		NewFlatFunc:  OpenFlat,
+		InitFlatFunc: CreateFlat,
+		IsPersistent: true,
+	})
+}
+
+func options(m graph.Options) (*pebble.Options, error) {
+	var opt pebble.Options
+	cache, err := m.IntKey(OptCacheSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	opt.CacheSize = int64(cache) << 20
+	mem, err := m.IntKey(OptMemTableSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	opt.MemTableSize = uint64(mem) << 20
+	if opt.Compression, err = m.StringKey(OptCompression, pebble.DefaultCompression); err != nil {
+		return nil, err
+	}
+	// BoolKey returns false on non-existence. IE, Sync by default.
+	if opt.NoSync, err = m.BoolKey(OptNoSync, false); err != nil {
+		return nil, err
+	}
+	if opt.NoSync {
+		clog.Infof("Running in nosync mode")
+	}
+	return &opt, nil
+}
+
+func Create(path string, m graph.Options) (hkv.KV, error) {
+	db, err := CreateFlat(path, m)
+	if err != nil {
+		return nil, err
+	}
+	return flat.Upgrade(db), nil
+}
+
+func Open(path string, m graph.Options) (hkv.KV, error) {
+	db, err := OpenFlat(path, m)
+	if err != nil {
+		return nil, err
+	}
+	return flat.Upgrade(db), nil
+}
+
+// CreateFlat is like Create, but returns the flat database.
+func CreateFlat(path string, m graph.Options) (flat.KV, error) {
+	if path == "" {
+		return nil, kv.ErrEmptyPath
+	}
+	err := os.MkdirAll(path, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return OpenFlat(path, m)
+}
+
+// OpenFlat is like Open, but returns the flat database.
+func OpenFlat(path string, m graph.Options) (flat.KV, error) {
+	if path == "" {
+		return nil, kv.ErrEmptyPath
+	}
+	opt, err := options(m)
+	if err != nil {
+		return nil, err
+	}
+	db, err := pebble.Open(path, opt)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,35 @@
+
+package pebble
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/kv/kvtest"
+	hkv "github.com/aperturerobotics/cayley/kv"
+)
+
+func makePebblekv(t testing.TB) (hkv.KV, graph.Options, func()) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "cayley_test_"+Type)
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	db, err := Create(tmpDir, nil)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatal("Failed to create Pebble database.", err)
+	}
+	return db, nil, func() {
+		db.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func TestPebblekv(t *testing.T) {
+	kvtest.TestAll(t, makePebblekv, nil)
+}
+
+func BenchmarkPebblekv(b *testing.B) {
+	kvtest.BenchmarkAll(b, makePebblekv, nil)
+}
@@ -215,7 +215,7 @@ func (qs *QuadStore) collectQuadFilterScanGroup(
 			}
 			var matches []quadBatchPrimitiveMatch
 			for _, prim := range prims {
-				if prim == nil || prim.Deleted {
+				if !qs.isLive(prim) {
 					continue
 				}
 				match := quadBatchPrimitiveMatch{prim: prim}
@@ -256,12 +256,15 @@ func (qs *QuadStore) collectQuadFilterScanGroup(
 }
 
 func (qs *QuadStore) collectAllQuadsForBatchFilter(ctx context.Context, tx kv.Tx, filter resolvedQuadBatchFilter, results *[]quad.Quad, limit uint32) error {
-	horizon, err := qs.getMetaIntTx(ctx, tx, "horizon")
+	horizon, err := qs.readHorizonTx(ctx, tx)
 	if err == kv.ErrNotFound {
 		return nil
 	} else if err != nil {
 		return err
 	}
+	if qs.view != nil {
+		horizon = qs.view.horizon
+	}
 	var id uint64
 	for id < uint64(horizon) {
 		ids := make([]uint64, 0, nextBatch)
@@ -278,7 +281,7 @@ func (qs *QuadStore) collectAllQuadsForBatchFilter(ctx context.Context, tx kv.Tx
 		}
 		var matches []quadBatchPrimitiveMatch
 		for _, prim := range prims {
-			if prim == nil || prim.Deleted || prim.IsNode() || !primitiveMatchesQuadFilter(prim, filter) {
+			if !qs.isLive(prim) || prim.IsNode() || !primitiveMatchesQuadFilter(prim, filter) {
 				continue
 			}
 			matches = append(matches, quadBatchPrimitiveMatch{prim: prim})
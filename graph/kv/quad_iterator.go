@@ -72,6 +72,16 @@ func (it *QuadIterator) getSize(ctx context.Context) (refs.Size, error) {
 		it.size = sz
 		return sz, nil
 	}
+	if len(it.vals) == 1 {
+		sz, ok, err := it.qs.predicateSize(ctx, it.ind.Dirs[0], Int64Value(it.vals[0]))
+		if err != nil {
+			it.err = err
+			return refs.Size{}, it.err
+		} else if ok {
+			it.size = sz
+			return sz, nil
+		}
+	}
 	rsize, err := it.qs.Size(ctx)
 	if err != nil {
 		return refs.Size{}, err
@@ -212,7 +222,7 @@ func (it *quadIteratorNext) Next(ctx context.Context) bool {
 		}
 		for ; len(it.buf) > 0; it.buf, it.off = it.buf[1:], it.off+1 {
 			p := it.buf[0]
-			if p == nil || p.Deleted {
+			if !it.qs.isLive(p) {
 				continue
 			}
 			// TODO(dennwc): shouldn't this check the horizon?
@@ -282,6 +292,9 @@ func (it *quadIteratorContains) Contains(ctx context.Context, v graph.Ref) (bool
 	if !ok {
 		return false, nil
 	}
+	if it.qs.view != nil && !it.qs.view.live(p) {
+		return false, nil
+	}
 	for i, v := range it.vals {
 		if p.GetDirection(it.ind.Dirs[i]) != v {
 			return false, nil
@@ -20,12 +20,15 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/aperturerobotics/cayley/graph"
 	"github.com/aperturerobotics/cayley/graph/proto"
 	"github.com/aperturerobotics/cayley/graph/refs"
 	"github.com/aperturerobotics/cayley/internal/lru"
 	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/flat"
+	"github.com/aperturerobotics/cayley/kv/options"
 	"github.com/aperturerobotics/cayley/quad"
 	"github.com/aperturerobotics/cayley/quad/pquads"
 	"github.com/aperturerobotics/cayley/query/shape"
@@ -37,23 +40,57 @@ var (
 )
 
 type Registration struct {
-	NewFunc      NewFunc
-	InitFunc     InitFunc
+	NewFunc  NewFunc
+	InitFunc InitFunc
+	// NewFlatFunc and InitFlatFunc can be set instead of NewFunc and InitFunc by flat databases.
+	// Database wrappers are then applied to the flat database before upgrading it.
+	NewFlatFunc  FlatFunc
+	InitFlatFunc FlatFunc
 	IsPersistent bool
 }
 
 type (
 	InitFunc func(string, graph.Options) (kv.KV, error)
 	NewFunc  func(string, graph.Options) (kv.KV, error)
+	FlatFunc func(string, graph.Options) (flat.KV, error)
 )
 
+// open opens the database and applies database wrappers (see options.RegisterWrapper) enabled by options.
+func (r *Registration) open(addr string, opt graph.Options, init bool) (kv.KV, error) {
+	ws, err := options.Wrappers(opt)
+	if err != nil {
+		return nil, err
+	}
+	if r.NewFlatFunc != nil {
+		fn := r.NewFlatFunc
+		if init {
+			fn = r.InitFlatFunc
+		}
+		db, err := fn(addr, opt)
+		if err != nil {
+			return nil, err
+		}
+		return flat.Upgrade(options.WrapFlat(db, ws)), nil
+	}
+	var db kv.KV
+	if init {
+		db, err = r.InitFunc(addr, opt)
+	} else {
+		db, err = r.NewFunc(addr, opt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return options.WrapKV(db, ws), nil
+}
+
 func Register(name string, r Registration) {
 	graph.RegisterQuadStore(name, graph.QuadStoreRegistration{
 		InitFunc: func(ctx context.Context, addr string, opt graph.Options) error {
 			if !r.IsPersistent {
 				return nil
 			}
-			kv, err := r.InitFunc(addr, opt)
+			kv, err := r.open(addr, opt, true)
 			if err != nil {
 				return err
 			}
@@ -64,7 +101,7 @@ func Register(name string, r Registration) {
 			return kv.Close()
 		},
 		NewFunc: func(ctx context.Context, addr string, opt graph.Options) (graph.QuadStore, error) {
-			kv, err := r.NewFunc(addr, opt)
+			kv, err := r.open(addr, opt, false)
 			if err != nil {
 				return nil, err
 			}
@@ -76,6 +113,28 @@ func Register(name string, r Registration) {
 			}
 			return New(ctx, kv, opt)
 		},
+		UpgradeFunc: func(ctx context.Context, addr string, opt graph.Options) error {
+			if !r.IsPersistent {
+				return nil
+			}
+			kv, err := r.open(addr, opt, false)
+			if err != nil {
+				return err
+			}
+			gqs, err := New(ctx, kv, opt)
+			if err != nil {
+				kv.Close()
+				return err
+			}
+			defer gqs.Close()
+			qs := gqs.(*QuadStore)
+			if !qs.predStats.Load() {
+				if err = qs.RebuildStats(ctx); err != nil {
+					return err
+				}
+			}
+			return qs.Close()
+		},
 		IsPersistent: r.IsPersistent,
 	})
 }
@@ -95,13 +154,39 @@ type QuadStore struct {
 		dirty bool
 		// indexes used to detect duplicate quads
 		exists []QuadIndex
+		// indexes that are maintained by writes, but are not yet used for reads
+		building []QuadIndex
+	}
+
+	valueLRU *lru.Cache
+	// quads that were recently added, see precheckAddDeltas
+	quadExists struct {
+		sync.Mutex
+		m map[refs.QuadHash]struct{}
 	}
 
-	valueLRU   *lru.Cache
-	quadExists map[refs.QuadHash]struct{}
+	// writer is shared by write transactions and held exclusively by maintenance operations.
+	// Write transactions hold it exclusively as well, unless the database supports concurrent writes.
+	writer     sync.RWMutex
+	concurrent bool
 
-	writer    sync.Mutex
-	mapBucket map[string]map[string]*indexPosting
+	// ids allocates IDs for write transactions, see genIDs
+	ids idAllocator
+	// pendingDeltas is the number of records with changes of counters written since they were folded,
+	// see foldCounters; folding is set while they are folded
+	pendingDeltas atomic.Int64
+	folding       atomic.Bool
+
+	// predStats is set if writes maintain statistics for each predicate, see RebuildStats
+	predStats atomic.Bool
+	// hist caches histograms of nodes, see Histogram
+	hist histograms
+
+	// view is set for read-only views returned by AsOf
+	view *snapshot
+
+	// changes is notified after each commit
+	changes notifier
 }
 
 func newQuadStore(kv kv.KV) *QuadStore {
@@ -118,7 +203,7 @@ func Init(ctx context.Context, kv kv.KV, opt graph.Options) error {
 			return err
 		}
 	}
-	return nil
+	return qs.initPredicateStats(ctx)
 }
 
 const (
@@ -129,16 +214,28 @@ func New(ctx context.Context, kv kv.KV, opt graph.Options) (graph.QuadStore, err
 	qs := newQuadStore(kv)
 	assumeDefaultIdx, _ := opt.BoolKey(OptAssumeDefaultIdx, false)
 	if !assumeDefaultIdx {
-		list, err := qs.readIndexesMeta(ctx)
+		list, building, err := qs.readIndexesMeta(ctx)
 		if err != nil {
 			return nil, err
 		}
 		qs.indexes.all = list
+		qs.indexes.building = building
 	} else {
 		qs.indexes.all = DefaultQuadIndexes
 	}
+	if v, err := qs.getMetaInt(ctx, metaStats); err == nil {
+		qs.predStats.Store(v != 0)
+	} else if err != ErrNoBucket {
+		return nil, err
+	}
+	h, err := qs.readHorizon(ctx)
+	if err != nil {
+		return nil, err
+	}
+	qs.ids.load(uint64(h))
 	qs.valueLRU = lru.New(2000)
-	qs.quadExists = make(map[refs.QuadHash]struct{})
+	qs.quadExists.m = make(map[refs.QuadHash]struct{})
+	qs.concurrent = concurrentWrites(kv)
 	return qs, nil
 }
 
@@ -161,19 +258,26 @@ func (qs *QuadStore) getMetaInt(ctx context.Context, key string) (int64, error)
 }
 
 func (qs *QuadStore) getSize(ctx context.Context) (int64, error) {
-	sz, err := qs.getMetaInt(ctx, "size")
-	if err == ErrNoBucket {
-		return 0, nil
-	}
-	return sz, err
+	return qs.readCounter(ctx, "size")
 }
 
 func (qs *QuadStore) Size(ctx context.Context) (int64, error) {
+	if qs.view != nil {
+		return qs.view.countQuads(ctx, qs)
+	}
 	return qs.getSize(ctx)
 }
 
 func (qs *QuadStore) Stats(ctx context.Context, exact bool) (graph.Stats, error) {
-	sz, err := qs.getMetaInt(ctx, "size")
+	var (
+		sz  int64
+		err error
+	)
+	if qs.view != nil {
+		sz, err = qs.view.countQuads(ctx, qs)
+	} else {
+		sz, err = qs.getSize(ctx)
+	}
 	if err != nil {
 		return graph.Stats{}, err
 	}
@@ -204,6 +308,11 @@ func (qs *QuadStore) Stats(ctx context.Context, exact bool) (graph.Stats, error)
 }
 
 func (qs *QuadStore) Close() error {
+	if qs.view != nil {
+		// database is owned by the parent quad store
+		return nil
+	}
+	qs.changes.close()
 	return qs.db.Close()
 }
 
@@ -218,8 +327,10 @@ func asInt64(b []byte, empty int64) (int64, error) {
 }
 
 func (qs *QuadStore) horizon(ctx context.Context) int64 {
-	h, _ := qs.getMetaInt(ctx, "horizon")
-	return h
+	if qs.view != nil {
+		return qs.view.horizon
+	}
+	return int64(qs.ids.horizon())
 }
 
 func (qs *QuadStore) ValuesOf(ctx context.Context, vals []graph.Ref) ([]quad.Value, error) {
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	henc "encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
@@ -14,6 +15,7 @@ import (
 	"testing"
 
 	hkv "github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/options"
 	"github.com/stretchr/testify/require"
 
 	"github.com/aperturerobotics/cayley/graph"
@@ -21,6 +23,8 @@ import (
 	"github.com/aperturerobotics/cayley/graph/kv/btree"
 	"github.com/aperturerobotics/cayley/graph/refs"
 	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/path"
+	"github.com/aperturerobotics/cayley/query/shape"
 	"github.com/aperturerobotics/cayley/writer"
 	b58 "github.com/mr-tron/base58/base58"
 )
@@ -71,6 +75,10 @@ func ukey(n uint64) []byte {
 	return []byte(strconv.FormatUint(n, 10))
 }
 
+func dkey(first uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte("delta/"), first)
+}
+
 func le(v uint64) []byte {
 	var b [8]byte
 	binary.LittleEndian.PutUint64(b[:], v)
@@ -143,8 +151,14 @@ func TestApplyDeltas(t *testing.T) {
 	defer qs.Close()
 
 	expect(Ops{
+		// statistics of predicates are enabled for empty databases
+		{opGet, key(bMeta, []byte("horizon")), nil, hkv.ErrNotFound},
+		{opPut, key(bMeta, []byte("stats")), le(1), nil},
 		{opGet, hkv.Key{[]byte("i")}, nil, hkv.ErrNotFound},
 		// {opGet, key(bMeta, []byte("size")), nil, hkv.ErrNotFound},
+		{opGet, key(bMeta, []byte("stats")), le(1), nil},
+		// the last allocated ID
+		{opGet, key(bMeta, []byte("horizon")), nil, hkv.ErrNotFound},
 	})
 
 	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
@@ -158,7 +172,6 @@ func TestApplyDeltas(t *testing.T) {
 		{opGet, key(irib("b"), irih("b")), nil, nil},
 		{opGet, key(irib("c"), irih("c")), nil, nil},
 
-		{opGet, key(bMeta, []byte("horizon")), nil, hkv.ErrNotFound},
 		{opPut, key(irib("a"), irih("a")), vAuto, nil},
 		{opPut, key(bLog, ukey(1)), vAuto, nil},
 		{opPut, key(irib("b"), irih("b")), vAuto, nil},
@@ -170,12 +183,14 @@ func TestApplyDeltas(t *testing.T) {
 		{opPut, key(iric("b"), irih("b")), hex("01"), nil},
 		{opPut, key(iric("c"), irih("c")), hex("01"), nil},
 		{opPut, key(bLog, ukey(4)), vAuto, nil},
-		{opGet, key(bMeta, []byte("size")), nil, hkv.ErrNotFound},
 		// New-node index keys blind-write: the posting list cannot pre-exist.
 		{opPut, key("ops", b64Col(3, 2, 1)), hex("04"), nil},
 		{opPut, key("sp", b64Col(1, 2)), hex("04"), nil},
-		{opPut, key(bMeta, []byte("horizon")), le(4), nil},
-		{opPut, key(bMeta, []byte("size")), le(1), nil},
+		// counts of (predicate, node) pairs for new nodes are written without reading them
+		{opPut, key("t", []byte("o2:3")), hex("01"), nil},
+		{opPut, key("t", []byte("s2:1")), hex("01"), nil},
+		// changes of counters are written to a separate record keyed by the first ID of the transaction
+		{opPut, key(bMeta, dkey(1)), vAuto, nil},
 	})
 
 	err = qw.AddQuad(ctx, quad.MakeIRI("a", "b", "e", ""))
@@ -187,7 +202,6 @@ func TestApplyDeltas(t *testing.T) {
 		// served from IRI cache
 		//{opGet, irib("a"), irih("a"), vAuto, nil},
 		//{opGet, irib("b"), irih("b"), vAuto, nil},
-		{opGet, key(bMeta, []byte("horizon")), le(4), nil},
 		{opPut, key(irib("e"), irih("e")), vAuto, nil},
 		{opPut, key(bLog, ukey(5)), vAuto, nil},
 
@@ -197,13 +211,14 @@ func TestApplyDeltas(t *testing.T) {
 		{opPut, key(iric("b"), irih("b")), hex("02"), nil},
 		{opPut, key(iric("e"), irih("e")), hex("01"), nil},
 		{opPut, key(bLog, ukey(6)), vAuto, nil},
-		{opGet, key(bMeta, []byte("size")), le(1), nil},
 		// New object node: ops posting list blind-writes; sp exists, so it merges.
 		{opPut, key("ops", b64Col(5, 2, 1)), hex("06"), nil},
 		{opGet, key("sp", b64Col(1, 2)), hex("04"), nil},
 		{opPut, key("sp", b64Col(1, 2)), hex("0406"), nil},
-		{opPut, key(bMeta, []byte("horizon")), le(6), nil},
-		{opPut, key(bMeta, []byte("size")), le(2), nil},
+		{opPut, key("t", []byte("o2:5")), hex("01"), nil},
+		{opGet, key("t", []byte("s2:1")), hex("01"), nil},
+		{opPut, key("t", []byte("s2:1")), hex("02"), nil},
+		{opPut, key(bMeta, dkey(5)), vAuto, nil},
 	})
 
 	err = qw.RemoveQuad(ctx, quad.MakeIRI("a", "b", "c", ""))
@@ -211,7 +226,8 @@ func TestApplyDeltas(t *testing.T) {
 		{opGet, key("ops", b64Col(3, 2, 1)), hex("04"), nil},
 		{opGet, key(bLog, ukey(4)), vAuto, nil},
 		{opPut, key(bLog, ukey(4)), vAuto, nil},
-		{opGet, key(bMeta, []byte("size")), le(2), nil},
+		// tombstones record the position of deletions in the log
+		{opPut, key(bLog, ukey(7)), vAuto, nil},
 		{opGet, key(iric("a"), irih("a")), hex("02"), nil},
 		{opGet, key(iric("b"), irih("b")), hex("02"), nil},
 		{opGet, key(iric("c"), irih("c")), hex("01"), nil},
@@ -220,7 +236,12 @@ func TestApplyDeltas(t *testing.T) {
 		{opDel, key(iric("c"), irih("c")), nil, nil},
 		{opDel, key(irib("c"), irih("c")), nil, nil},
 		{opPut, key(bLog, ukey(3)), vAuto, nil},
-		{opPut, key(bMeta, []byte("size")), le(1), nil},
+		{opPut, key(bLog, ukey(8)), vAuto, nil},
+		{opGet, key("t", []byte("o2:3")), hex("01"), nil},
+		{opGet, key("t", []byte("s2:1")), hex("02"), nil},
+		{opDel, key("t", []byte("o2:3")), nil, nil},
+		{opPut, key("t", []byte("s2:1")), hex("01"), nil},
+		{opPut, key(bMeta, dkey(7)), vAuto, nil},
 	})
 	require.NoError(t, err)
 }
@@ -318,8 +339,8 @@ func TestApplyDeltasWriteCostSingleAddAndDuplicate(t *testing.T) {
 	}, graph.IgnoreOpts{IgnoreDup: true}))
 
 	addOps := hook.log()
-	require.LessOrEqual(t, len(addOps), 21, "first add-new quad should stay within the known current write-cost envelope")
-	require.Equal(t, 14, countOpsOfType(addOps, opPut), "add-new should write value/log/refcount records, quad indexes, and meta keys")
+	require.LessOrEqual(t, len(addOps), 27, "first add-new quad should stay within the known current write-cost envelope")
+	require.Equal(t, 15, countOpsOfType(addOps, opPut), "add-new should write value/log/refcount records, quad indexes, predicate pairs, and a record of counter changes")
 
 	refCountsBefore := readRefCounts(ctx, t, hook.db, q.Subject, q.Predicate, q.Object)
 	require.NoError(t, qs.ApplyDeltas(ctx, []graph.Delta{
@@ -404,8 +425,8 @@ func TestApplyTransactionWriteCostBatchAdds(t *testing.T) {
 	require.NoError(t, qw.ApplyTransaction(ctx, tx))
 
 	ops := hook.log()
-	require.LessOrEqual(t, len(ops), 42, "four-quad ApplyTransaction should batch shared node and index work")
-	require.Equal(t, 29, countOpsOfType(ops, opPut), "batch add should write six values, six node logs, six refcounts, four quad logs, five index buckets, and two meta keys")
+	require.LessOrEqual(t, len(ops), 48, "four-quad ApplyTransaction should batch shared node and index work")
+	require.Equal(t, 33, countOpsOfType(ops, opPut), "batch add should write six values, six node logs, six refcounts, four quad logs, five index buckets, five predicate pairs, and a record of counter changes")
 
 	requireRefCount(t, ctx, hook.db, quad.IRI("batch/s"), 4)
 	requireRefCount(t, ctx, hook.db, quad.IRI("batch/p"), 4)
@@ -580,6 +601,400 @@ func TestCollectFilteredQuadsBatchLimitPerFilterSkipsFilledFilters(t *testing.T)
 	require.Equal(t, []string{quad.MakeIRI("a", "q", "d", "").String()}, quadStrings(results[1]))
 }
 
+func TestAsOf(t *testing.T) {
+	kdb := btree.New()
+	ctx := context.Background()
+
+	err := kv.Init(ctx, kdb, nil)
+	require.NoError(t, err)
+
+	gqs, err := kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	defer gqs.Close()
+
+	qs, ok := gqs.(*kv.QuadStore)
+	require.True(t, ok)
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "c", "")))
+	h1, err := qs.Horizon(ctx)
+	require.NoError(t, err)
+
+	// node "c" is removed and then added back with a new ID
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("a", "p", "c", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "d", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("c", "q", "e", "")))
+	h2, err := qs.Horizon(ctx)
+	require.NoError(t, err)
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+
+	_, err = qs.AsOf(ctx, h2+100)
+	require.Error(t, err)
+
+	out := func(qs graph.QuadStore, from quad.IRI) []quad.Value {
+		vals, err := path.StartPath(qs, from).Out(quad.IRI("p")).Iterate(ctx).AllValues(ctx, qs)
+		require.NoError(t, err)
+		return vals
+	}
+
+	v1, err := qs.AsOf(ctx, h1)
+	require.NoError(t, err)
+	defer v1.Close()
+	require.ElementsMatch(t, []string{
+		quad.MakeIRI("a", "p", "b", "").String(),
+		quad.MakeIRI("a", "p", "c", "").String(),
+	}, quadStrings(allQuads(ctx, t, v1.(*kv.QuadStore))))
+	require.ElementsMatch(t, []quad.Value{quad.IRI("b"), quad.IRI("c")}, out(v1, "a"))
+	mustValueOf(ctx, t, v1, quad.IRI("c"))
+	ref, err := v1.ValueOf(ctx, quad.IRI("d"))
+	require.NoError(t, err)
+	require.Nil(t, ref)
+
+	st, err := v1.Stats(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, refs.Size{Value: 2, Exact: true}, st.Quads)
+	require.Equal(t, refs.Size{Value: 4, Exact: true}, st.Nodes)
+
+	v2, err := qs.AsOf(ctx, h2)
+	require.NoError(t, err)
+	defer v2.Close()
+	require.ElementsMatch(t, []quad.Value{quad.IRI("b"), quad.IRI("d")}, out(v2, "a"))
+	require.ElementsMatch(t, []string{
+		quad.MakeIRI("a", "p", "b", "").String(),
+		quad.MakeIRI("a", "p", "d", "").String(),
+		quad.MakeIRI("c", "q", "e", "").String(),
+	}, quadStrings(allQuads(ctx, t, v2.(*kv.QuadStore))))
+
+	require.ElementsMatch(t, []quad.Value{quad.IRI("d")}, out(qs, "a"))
+
+	err = v1.ApplyDeltas(ctx, []graph.Delta{
+		{Quad: quad.MakeIRI("x", "y", "z", ""), Action: graph.Add},
+	}, graph.IgnoreOpts{})
+	require.Equal(t, hkv.ErrReadOnly, err)
+}
+
+func TestAddDropIndex(t *testing.T) {
+	kdb := btree.New()
+	ctx := context.Background()
+
+	err := kv.Init(ctx, kdb, nil)
+	require.NoError(t, err)
+
+	gqs, err := kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	defer gqs.Close()
+
+	qs, ok := gqs.(*kv.QuadStore)
+	require.True(t, ok)
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("c", "p", "b", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("d", "p", "b", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "q", "b", "")))
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("d", "p", "b", "")))
+
+	po, err := kv.ParseQuadIndex("po")
+	require.NoError(t, err)
+	require.Equal(t, []quad.Direction{quad.Predicate, quad.Object}, po.Dirs)
+
+	require.NoError(t, qs.AddIndex(ctx, po))
+	require.Equal(t, kv.ErrIndexExists, qs.AddIndex(ctx, po))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("e", "p", "b", "")))
+
+	list, err := qs.Indexes(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	require.Equal(t, kv.IndexStatus{QuadIndex: po}, list[2])
+
+	subjects := func(qs graph.QuadStore) []quad.Value {
+		vals, err := path.StartPath(qs).Has(quad.IRI("p"), quad.IRI("b")).Iterate(ctx).AllValues(ctx, qs)
+		require.NoError(t, err)
+		return vals
+	}
+	require.ElementsMatch(t, []quad.Value{quad.IRI("a"), quad.IRI("c"), quad.IRI("e")}, subjects(qs))
+
+	byPO := shape.QuadsAction{Result: quad.Subject, Filter: map[quad.Direction]graph.Ref{
+		quad.Predicate: mustValueOf(ctx, t, qs, quad.IRI("p")),
+		quad.Object:    mustValueOf(ctx, t, qs, quad.IRI("b")),
+	}}
+	opt, _, err := qs.OptimizeShape(ctx, byPO)
+	require.NoError(t, err)
+	require.Equal(t, po, opt.(shape.NodesFrom).Quads.(kv.IndexScan).Index)
+
+	// index list is persisted
+	gqs2, err := kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	list, err = gqs2.(*kv.QuadStore).Indexes(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+
+	countKeys := func(ind kv.QuadIndex) int {
+		n := 0
+		err := hkv.View(ctx, kdb, func(tx hkv.Tx) error {
+			return hkv.Each(ctx, tx, func(k hkv.Key, v hkv.Value) error {
+				n++
+				return nil
+			}, options.WithPrefixKV(ind.Key(nil)))
+		})
+		require.NoError(t, err)
+		return n
+	}
+	// deleted quads are indexed as well
+	require.Equal(t, 2, countKeys(po))
+
+	require.NoError(t, qs.DropIndex(ctx, po))
+	require.Equal(t, kv.ErrIndexNotFound, qs.DropIndex(ctx, po))
+	require.Equal(t, 0, countKeys(po))
+	require.NotZero(t, countKeys(kv.DefaultQuadIndexes[1]))
+	list, err = qs.Indexes(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.ElementsMatch(t, []quad.Value{quad.IRI("a"), quad.IRI("c"), quad.IRI("e")}, subjects(qs))
+}
+
+func TestCompact(t *testing.T) {
+	kdb := btree.New()
+	ctx := context.Background()
+
+	err := kv.Init(ctx, kdb, nil)
+	require.NoError(t, err)
+
+	gqs, err := kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	defer gqs.Close()
+	qs := gqs.(*kv.QuadStore)
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "c", "")))
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("a", "p", "c", "")))
+	h1, err := qs.Horizon(ctx)
+	require.NoError(t, err)
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("x", "p", "y", "")))
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("x", "p", "y", "")))
+
+	// simulate a leaked reference
+	err = hkv.Update(ctx, kdb, func(tx hkv.Tx) error {
+		return tx.Put(ctx, key(iric(""), irih("a")), []byte{5})
+	})
+	require.NoError(t, err)
+
+	_, err = qs.Compact(ctx, kv.CompactOptions{KeepHistory: -1})
+	require.Error(t, err)
+
+	// the quad, the node and their tombstones
+	st, err := qs.Compact(ctx, kv.CompactOptions{KeepHistory: h1})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), st.Primitives)
+	require.Equal(t, int64(2), st.Postings)
+	require.Equal(t, int64(0), st.Nodes)
+	require.NotZero(t, st.Bytes)
+	requireRefCount(t, ctx, kdb, quad.IRI("a"), 1)
+
+	_, err = qs.AsOf(ctx, h1-1)
+	require.Error(t, err)
+	v, err := qs.AsOf(ctx, h1)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		quad.MakeIRI("a", "p", "b", "").String(),
+	}, quadStrings(allQuads(ctx, t, v.(*kv.QuadStore))))
+
+	_, err = qs.Watch(ctx, "0")
+	require.True(t, errors.Is(err, graph.ErrCursorExpired), "%v", err)
+	feed, err := qs.Watch(ctx, strconv.FormatInt(h1, 10))
+	require.NoError(t, err)
+	require.True(t, feed.Next(ctx))
+	require.Equal(t, []graph.Delta{
+		{Quad: quad.MakeIRI("x", "p", "y", ""), Action: graph.Add},
+		{Quad: quad.MakeIRI("x", "p", "y", ""), Action: graph.Delete},
+	}, feed.Batch().Deltas)
+	require.NoError(t, feed.Close())
+
+	// remove the rest of the history
+	st, err = qs.Compact(ctx, kv.CompactOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int64(6), st.Primitives)
+	require.Equal(t, int64(2), st.Postings)
+
+	st, err = qs.Compact(ctx, kv.CompactOptions{})
+	require.NoError(t, err)
+	require.Equal(t, kv.CompactStats{}, st)
+
+	require.Equal(t, []string{
+		quad.MakeIRI("a", "p", "b", "").String(),
+	}, quadStrings(allQuads(ctx, t, qs)))
+	mustValueOf(ctx, t, qs, quad.IRI("a"))
+	ref, err := qs.ValueOf(ctx, quad.IRI("x"))
+	require.NoError(t, err)
+	require.Nil(t, ref)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	kdb := btree.New()
+	ctx := context.Background()
+
+	err := kv.Init(ctx, kdb, nil)
+	require.NoError(t, err)
+
+	gqs, err := kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	defer gqs.Close()
+	qs := gqs.(*kv.QuadStore)
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("a", "p", "c", "g")))
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+	po, err := kv.ParseQuadIndex("po")
+	require.NoError(t, err)
+	require.NoError(t, qs.AddIndex(ctx, po))
+
+	var buf bytes.Buffer
+	_, err = hkv.WriteSnapshot(ctx, kdb, &buf)
+	require.NoError(t, err)
+
+	kdb2 := btree.New()
+	_, err = hkv.RestoreSnapshot(ctx, kdb2, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	var buf2 bytes.Buffer
+	_, err = hkv.WriteSnapshot(ctx, kdb2, &buf2)
+	require.NoError(t, err)
+	require.Equal(t, buf.Bytes(), buf2.Bytes())
+
+	gqs2, err := kv.New(ctx, kdb2, graph.Options{kv.OptAssumeDefaultIdx: false})
+	require.NoError(t, err)
+	defer gqs2.Close()
+	qs2 := gqs2.(*kv.QuadStore)
+
+	require.Equal(t, quadStrings(allQuads(ctx, t, qs)), quadStrings(allQuads(ctx, t, qs2)))
+	list, err := qs2.Indexes(ctx)
+	require.NoError(t, err)
+	var names []string
+	for _, ind := range list {
+		names = append(names, ind.String())
+	}
+	require.Contains(t, names, po.String())
+	h1, err := qs.Horizon(ctx)
+	require.NoError(t, err)
+	h2, err := qs2.Horizon(ctx)
+	require.NoError(t, err)
+	require.Equal(t, h1, h2)
+}
+
+func TestPredicateStats(t *testing.T) {
+	kdb := btree.New()
+	ctx := context.Background()
+
+	err := kv.Init(ctx, kdb, nil)
+	require.NoError(t, err)
+
+	gqs, err := kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	qs := gqs.(*kv.QuadStore)
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	require.NoError(t, qw.AddQuadSet(ctx, []quad.Quad{
+		quad.MakeIRI("a", "p", "b", ""),
+		quad.MakeIRI("a", "p", "c", ""),
+		quad.MakeIRI("d", "p", "c", "g"),
+		quad.MakeIRI("a", "q", "b", ""),
+	}))
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+
+	stat := func(qs *kv.QuadStore, pred string) (graph.PredicateStat, bool) {
+		st, ok, err := qs.PredicateStats(ctx, mustValueOf(ctx, t, qs, quad.IRI(pred)))
+		require.NoError(t, err)
+		return st, ok
+	}
+	expP := graph.PredicateStat{Quads: 2, Subjects: 2, Objects: 1}
+	expQ := graph.PredicateStat{Quads: 1, Subjects: 1, Objects: 1}
+	st, ok := stat(qs, "p")
+	require.True(t, ok)
+	require.Equal(t, expP, st)
+	st, ok = stat(qs, "q")
+	require.True(t, ok)
+	require.Equal(t, expQ, st)
+
+	sz, err := qs.QuadIteratorSize(ctx, quad.Predicate, mustValueOf(ctx, t, qs, quad.IRI("p")))
+	require.NoError(t, err)
+	require.Equal(t, refs.Size{Value: 2, Exact: true}, sz)
+	require.NoError(t, qs.Close())
+
+	// simulate a database created without statistics
+	err = hkv.Update(ctx, kdb, func(tx hkv.Tx) error {
+		return tx.Del(ctx, key("m", []byte("stats")))
+	})
+	require.NoError(t, err)
+
+	gqs, err = kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	defer gqs.Close()
+	qs = gqs.(*kv.QuadStore)
+	_, ok = stat(qs, "p")
+	require.False(t, ok)
+
+	require.NoError(t, qs.RebuildStats(ctx))
+	st, ok = stat(qs, "p")
+	require.True(t, ok)
+	require.Equal(t, expP, st)
+	st, ok = stat(qs, "q")
+	require.True(t, ok)
+	require.Equal(t, expQ, st)
+}
+
+func TestHistogram(t *testing.T) {
+	kdb := btree.New()
+	ctx := context.Background()
+
+	err := kv.Init(ctx, kdb, nil)
+	require.NoError(t, err)
+
+	gqs, err := kv.New(ctx, kdb, nil)
+	require.NoError(t, err)
+	defer gqs.Close()
+	qs := gqs.(*kv.QuadStore)
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	require.NoError(t, qw.AddQuadSet(ctx, []quad.Quad{
+		quad.MakeIRI("a", "p", "b", ""),
+		quad.MakeIRI("a", "p", "c", ""),
+		quad.MakeIRI("d", "p", "c", "g"),
+		quad.MakeIRI("a", "q", "b", ""),
+	}))
+	require.NoError(t, qw.RemoveQuad(ctx, quad.MakeIRI("a", "p", "b", "")))
+
+	// small logs are read completely, thus histograms are exact
+	h, err := qs.Histogram(ctx, quad.Object)
+	require.NoError(t, err)
+	require.Equal(t, &graph.Histogram{
+		Quads: 3, Distinct: 2,
+		Top: []graph.Frequency{{Node: mustValueOf(ctx, t, qs, quad.IRI("c")), Quads: 2}},
+	}, h)
+
+	h, err = qs.Histogram(ctx, quad.Label)
+	require.NoError(t, err)
+	require.Equal(t, &graph.Histogram{Quads: 1, Distinct: 1}, h)
+
+	// histograms are rebuilt after a significant change
+	require.NoError(t, qw.AddQuad(ctx, quad.MakeIRI("e", "p", "c", "")))
+	h, err = qs.Histogram(ctx, quad.Object)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), h.Quads)
+	require.Equal(t, int64(3), h.Frequency(mustValueOf(ctx, t, qs, quad.IRI("c"))))
+}
+
 func newHookedQuadStore(t testing.TB) (context.Context, *kv.QuadStore, *kvHook, func()) {
 	t.Helper()
 
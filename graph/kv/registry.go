@@ -5,6 +5,7 @@ import (
 
 	"github.com/aperturerobotics/cayley/graph"
 	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/flat"
 )
 
 func init() {
@@ -12,6 +13,8 @@ func init() {
 		switch r.Name {
 		case "bolt":
 			continue // legacy: register manually; see comments in the bolt package
+		case "flat.pebble":
+			continue // registered manually to support tuning options
 		}
 		r := r
 		reg := Registration{
@@ -24,6 +27,13 @@ func init() {
 			IsPersistent: !r.Volatile,
 		}
 		name := r.Name
+		if fr := flatRegistration(name); fr != nil {
+			// open flat databases directly, so database wrappers are applied before the upgrade
+			open := func(s string, options graph.Options) (flat.KV, error) {
+				return fr.OpenPath(s)
+			}
+			reg.NewFlatFunc, reg.InitFlatFunc = open, open
+		}
 		// override names for backward compatibility
 		// names are also nicer without the "flat." prefix
 		if strings.HasPrefix(name, "flat.") && !graph.IsRegistered(name[5:]) {
@@ -32,3 +42,11 @@ func init() {
 		Register(name, reg)
 	}
 }
+
+// flatRegistration returns a flat database driver registered under a given hierarchical driver name, if any.
+func flatRegistration(name string) *flat.Registration {
+	if !strings.HasPrefix(name, "flat.") {
+		return nil
+	}
+	return flat.ByName(name[5:])
+}
@@ -0,0 +1,308 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/proto"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// Statistics of each predicate are stored as meta counters: the number of quads, distinct subjects and objects.
+//
+// Distinct values are tracked by reference counts of (predicate, subject) and (predicate, object) pairs,
+// thus counters of distinct values only change when a pair is referenced by the first quad,
+// or when the last quad referencing it is deleted.
+
+var (
+	// pairsBucket stores reference counts of (predicate, node) pairs
+	pairsBucket = kv.Key{[]byte("t")}
+
+	_ graph.PredicateStats = (*QuadStore)(nil)
+)
+
+const (
+	// metaStats is set if per-predicate statistics account for all quads in the database.
+	metaStats = "stats"
+	// metaStatsPrefix is a prefix of meta counters for predicates
+	metaStatsPrefix = "stats/"
+)
+
+func predicateStatsKey(pred uint64, name string) string {
+	return metaStatsPrefix + strconv.FormatUint(pred, 10) + "/" + name
+}
+
+func pairKey(d quad.Direction, pred, node uint64) []byte {
+	k := []byte{d.Prefix()}
+	k = append(k, uint64KeyBytes(pred)...)
+	k = append(k, ':')
+	return append(k, uint64KeyBytes(node)...)
+}
+
+// pairCount is a pending change of a reference count of a (predicate, node) pair.
+// Similar to indexPosting, fresh is set if the pair references a node created by the transaction,
+// thus the count cannot exist in the database.
+type pairCount struct {
+	dir   quad.Direction
+	pred  uint64
+	n     int64
+	fresh bool
+}
+
+// countQuad records changes of statistics of the quad predicate, after the quad was added (n > 0) or deleted.
+func (c *txCache) countQuad(p *proto.Primitive, n int64, newIDs map[uint64]struct{}) {
+	if c.preds == nil {
+		c.preds = make(map[uint64]int64)
+		c.pairs = make(map[string]*pairCount)
+	}
+	pred := p.Predicate
+	c.preds[pred] += n
+	_, freshPred := newIDs[pred]
+	for _, d := range []quad.Direction{quad.Subject, quad.Object} {
+		id := p.GetDirection(d)
+		_, fresh := newIDs[id]
+		fresh = fresh || freshPred
+		k := string(pairKey(d, pred, id))
+		e, ok := c.pairs[k]
+		if !ok {
+			e = &pairCount{dir: d, pred: pred, fresh: fresh}
+			c.pairs[k] = e
+		} else {
+			e.fresh = e.fresh && fresh
+		}
+		e.n += n
+	}
+}
+
+// flushPredicateStats updates reference counts of pairs and statistics counters in the meta cache.
+func (qs *QuadStore) flushPredicateStats(ctx context.Context, tx kv.Tx, cache *txCache) error {
+	if len(cache.preds) == 0 {
+		return nil
+	}
+	// changes in the number of distinct subjects and objects
+	distinct := make(map[uint64]*[2]int64, len(cache.preds))
+	count := func(e *pairCount, n int64) {
+		d := distinct[e.pred]
+		if d == nil {
+			d = new([2]int64)
+			distinct[e.pred] = d
+		}
+		if e.dir == quad.Subject {
+			d[0] += n
+		} else {
+			d[1] += n
+		}
+	}
+	var buf [binary.MaxVarintLen64]byte
+	put := func(key kv.Key, n int64) error {
+		sz := binary.PutUvarint(buf[:], uint64(n))
+		return tx.Put(ctx, key, append([]byte{}, buf[:sz]...))
+	}
+	keys := make([]string, 0, len(cache.pairs))
+	for k := range cache.pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	mergeKeys := make([]kv.Key, 0, len(keys))
+	for _, k := range keys {
+		e := cache.pairs[k]
+		if !e.fresh {
+			mergeKeys = append(mergeKeys, pairsBucket.AppendBytes([]byte(k)))
+			continue
+		} else if e.n <= 0 {
+			continue
+		}
+		if err := put(pairsBucket.AppendBytes([]byte(k)), e.n); err != nil {
+			return err
+		}
+		count(e, +1)
+	}
+	if len(mergeKeys) != 0 {
+		vals, err := tx.GetBatch(ctx, mergeKeys)
+		if err != nil {
+			return err
+		}
+		for i, key := range mergeKeys {
+			e := cache.pairs[string(key[1])]
+			var prev int64
+			if vals[i] != nil {
+				v, _ := binary.Uvarint(vals[i])
+				prev = int64(v)
+			}
+			cur := prev + e.n
+			switch {
+			case cur == prev:
+				continue
+			case cur > 0:
+				err = put(key, cur)
+			case prev > 0:
+				err = tx.Del(ctx, key)
+			}
+			if err != nil {
+				return err
+			}
+			if prev <= 0 && cur > 0 {
+				count(e, +1)
+			} else if prev > 0 && cur <= 0 {
+				count(e, -1)
+			}
+		}
+	}
+	preds := make([]uint64, 0, len(cache.preds))
+	for p := range cache.preds {
+		preds = append(preds, p)
+	}
+	slices.Sort(preds)
+	for _, p := range preds {
+		if err := qs.incMetaInt(ctx, tx, cache, predicateStatsKey(p, "quads"), cache.preds[p]); err != nil {
+			return err
+		}
+		d := distinct[p]
+		if d == nil {
+			continue
+		}
+		if err := qs.incMetaInt(ctx, tx, cache, predicateStatsKey(p, "subjects"), d[0]); err != nil {
+			return err
+		}
+		if err := qs.incMetaInt(ctx, tx, cache, predicateStatsKey(p, "objects"), d[1]); err != nil {
+			return err
+		}
+	}
+	cache.preds, cache.pairs = nil, nil
+	return nil
+}
+
+// PredicateStats implements graph.PredicateStats. Statistics are not available for views returned by AsOf,
+// and for databases created by older versions, until they are upgraded.
+func (qs *QuadStore) PredicateStats(ctx context.Context, pred graph.Ref) (graph.PredicateStat, bool, error) {
+	if qs.view != nil || !qs.predStats.Load() {
+		return graph.PredicateStat{}, false, nil
+	}
+	p, ok := pred.(Int64Value)
+	if !ok {
+		return graph.PredicateStat{}, true, nil
+	}
+	var vals []int64
+	err := kv.View(ctx, qs.db, func(tx kv.Tx) error {
+		var err error
+		vals, err = qs.readCountersTx(ctx, tx,
+			predicateStatsKey(uint64(p), "quads"),
+			predicateStatsKey(uint64(p), "subjects"),
+			predicateStatsKey(uint64(p), "objects"),
+		)
+		return err
+	})
+	if err != nil {
+		return graph.PredicateStat{}, false, err
+	}
+	return graph.PredicateStat{Quads: vals[0], Subjects: vals[1], Objects: vals[2]}, true, nil
+}
+
+// predicateSize returns the number of quads with a given predicate, if d is a predicate direction
+// and statistics are available.
+func (qs *QuadStore) predicateSize(ctx context.Context, d quad.Direction, pred Int64Value) (refs.Size, bool, error) {
+	if d != quad.Predicate {
+		return refs.Size{}, false, nil
+	}
+	st, ok, err := qs.PredicateStats(ctx, pred)
+	if err != nil || !ok {
+		return refs.Size{}, false, err
+	}
+	return refs.Size{Value: st.Quads, Exact: true}, true, nil
+}
+
+// initPredicateStats enables statistics for an empty database.
+// Statistics for existing quads can only be calculated by RebuildStats.
+func (qs *QuadStore) initPredicateStats(ctx context.Context) error {
+	return kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+		_, err := qs.readHorizonTx(ctx, tx)
+		if err == nil {
+			return nil
+		} else if err != kv.ErrNotFound {
+			return err
+		}
+		return qs.putMetaInt(ctx, tx, metaStats, 1)
+	})
+}
+
+// RebuildStats calculates statistics for each predicate from the log. Statistics are maintained by writes
+// for new databases, thus it's only required for databases created by older versions.
+//
+// Writes are blocked while statistics are rebuilt.
+func (qs *QuadStore) RebuildStats(ctx context.Context) error {
+	if qs.view != nil {
+		return kv.ErrReadOnly
+	}
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	// pending changes of statistics would be counted twice
+	if err := qs.foldCounters(ctx); err != nil {
+		return err
+	}
+	qs.predStats.Store(false)
+	err := kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+		return tx.Del(ctx, metaBucket.AppendBytes([]byte(metaStats)))
+	})
+	if err != nil {
+		return err
+	}
+	if err = qs.deletePrefix(ctx, metaBucket.AppendBytes([]byte(metaStatsPrefix))); err != nil {
+		return err
+	}
+	if err = qs.deletePrefix(ctx, pairsBucket.AppendBytes(nil)); err != nil {
+		return err
+	}
+	end, err := qs.Horizon(ctx)
+	if err != nil {
+		return err
+	}
+	for from := uint64(1); from <= uint64(end); from += indexBackfillBatch {
+		last := min(from+indexBackfillBatch-1, uint64(end))
+		err = kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+			cache := newTxCache()
+			ids := make([]uint64, 0, nextBatch)
+			for id := from; id <= last; id++ {
+				ids = append(ids, id)
+				if len(ids) < nextBatch && id < last {
+					continue
+				}
+				prims, err := qs.getPrimitivesFromLog(ctx, tx, ids)
+				if err != nil {
+					return err
+				}
+				for _, p := range prims {
+					if p == nil || p.Deleted || p.IsNode() || p.Subject == 0 {
+						continue
+					}
+					cache.countQuad(p, +1, nil)
+				}
+				ids = ids[:0]
+			}
+			if err := qs.flushPredicateStats(ctx, tx, cache); err != nil {
+				return err
+			}
+			return qs.flushMetaCache(ctx, tx, cache)
+		})
+		if err != nil {
+			return err
+		}
+		if clog.V(1) {
+			clog.Infof("predicate stats: counted %d/%d", last, end)
+		}
+	}
+	err = kv.Update(ctx, qs.db, func(tx kv.Tx) error {
+		return qs.putMetaInt(ctx, tx, metaStats, 1)
+	})
+	if err != nil {
+		return err
+	}
+	qs.predStats.Store(true)
+	return nil
+}
@@ -0,0 +1,232 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/proto"
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/pquads"
+)
+
+// watchBatch is the maximal number of log entries read for a single batch of changes.
+const watchBatch = 1000
+
+var _ graph.Watcher = (*QuadStore)(nil)
+
+// notifier wakes up change feeds after each commit.
+type notifier struct {
+	mu     sync.Mutex
+	wait   chan struct{}
+	closed bool
+}
+
+func (n *notifier) waitChan() (<-chan struct{}, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.wait == nil {
+		n.wait = make(chan struct{})
+	}
+	return n.wait, n.closed
+}
+
+func (n *notifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.wait != nil {
+		close(n.wait)
+		n.wait = nil
+	}
+}
+
+func (n *notifier) close() {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	n.notify()
+}
+
+// Watch implements graph.Watcher. Changes are read from the log, thus the feed can be resumed
+// from any cursor issued by this database, unless the history was removed by Compact.
+// Cursor "0" replays the whole log.
+//
+// Batches follow the order of the log, but large transactions may be split into multiple batches.
+// Deletions made before tombstones were introduced are not reported.
+func (qs *QuadStore) Watch(ctx context.Context, cursor string) (graph.DeltaFeed, error) {
+	if qs.view != nil {
+		return nil, errors.New("kv: cannot watch a read-only view")
+	}
+	cur, err := qs.Horizon(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pos := uint64(cur)
+	if cursor != "" {
+		v, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", graph.ErrInvalidCursor, cursor)
+		}
+		first, err := qs.compactedHorizon(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if v < uint64(first) || v > pos {
+			return nil, graph.ErrCursorExpired
+		}
+		pos = v
+	}
+	return &logFeed{qs: qs, pos: pos}, nil
+}
+
+type logFeed struct {
+	qs     *QuadStore
+	pos    uint64
+	cur    graph.DeltaBatch
+	err    error
+	closed bool
+}
+
+func (f *logFeed) Next(ctx context.Context) bool {
+	if f.closed || f.err != nil {
+		return false
+	}
+	for {
+		// get the channel first to not miss commits made while reading the log
+		wait, closed := f.qs.changes.waitChan()
+		if closed {
+			return false
+		}
+		end, err := f.qs.Horizon(ctx)
+		if err != nil {
+			f.err = err
+			return false
+		}
+		if uint64(end) > f.pos {
+			// history might be removed while the feed was behind
+			first, err := f.qs.compactedHorizon(ctx)
+			if err != nil {
+				f.err = err
+				return false
+			} else if f.pos < uint64(first) {
+				f.err = graph.ErrCursorExpired
+				return false
+			}
+		}
+		for uint64(end) > f.pos {
+			last := min(uint64(end), f.pos+watchBatch)
+			var deltas []graph.Delta
+			err = kv.View(ctx, f.qs.db, func(tx kv.Tx) error {
+				deltas, err = f.qs.readLogDeltas(ctx, tx, f.pos+1, last)
+				return err
+			})
+			if err != nil {
+				f.err = err
+				return false
+			}
+			f.pos = last
+			if len(deltas) != 0 {
+				f.cur = graph.DeltaBatch{Deltas: deltas, Cursor: strconv.FormatUint(last, 10)}
+				return true
+			}
+		}
+		select {
+		case <-ctx.Done():
+			f.err = ctx.Err()
+			return false
+		case <-wait:
+		}
+	}
+}
+
+func (f *logFeed) Batch() graph.DeltaBatch {
+	return f.cur
+}
+
+func (f *logFeed) Err() error {
+	return f.err
+}
+
+func (f *logFeed) Close() error {
+	f.closed = true
+	f.cur = graph.DeltaBatch{}
+	return nil
+}
+
+// readLogDeltas converts log entries in the range [from, to] to a list of quad changes.
+func (qs *QuadStore) readLogDeltas(ctx context.Context, tx kv.Tx, from, to uint64) ([]graph.Delta, error) {
+	ids := make([]uint64, 0, to-from+1)
+	for id := from; id <= to; id++ {
+		ids = append(ids, id)
+	}
+	prims, err := qs.getPrimitivesFromLog(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	// quads removed by tombstones in this range
+	var replaced []uint64
+	for _, p := range prims {
+		if p != nil && p.Replaces != 0 {
+			replaced = append(replaced, p.Replaces)
+		}
+	}
+	removed := make(map[uint64]*proto.Primitive, len(replaced))
+	if len(replaced) != 0 {
+		rprims, err := qs.getPrimitivesFromLog(ctx, tx, replaced)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range rprims {
+			if p != nil && !p.IsNode() {
+				removed[p.ID] = p
+			}
+		}
+	}
+	vals := make(map[uint64]quad.Value)
+	toQuad := func(p *proto.Primitive) (quad.Quad, error) {
+		var q quad.Quad
+		for _, dir := range quad.Directions {
+			id := p.GetDirection(dir)
+			if id == 0 {
+				continue
+			}
+			v, ok := vals[id]
+			if !ok {
+				n, err := qs.getPrimitiveFromLog(ctx, tx, id)
+				if err != nil {
+					return q, err
+				}
+				if v, err = pquads.UnmarshalValue(ctx, n.Value); err != nil {
+					return q, err
+				}
+				vals[id] = v
+			}
+			q.Set(dir, v)
+		}
+		return q, nil
+	}
+	var out []graph.Delta
+	for _, p := range prims {
+		if p == nil || p.IsNode() {
+			continue
+		}
+		action, link := graph.Add, p
+		if p.Replaces != 0 {
+			if link = removed[p.Replaces]; link == nil {
+				// tombstone of a node
+				continue
+			}
+			action = graph.Delete
+		}
+		q, err := toQuad(link)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, graph.Delta{Quad: q, Action: action})
+	}
+	return out, nil
+}
@@ -0,0 +1,176 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"runtime/trace"
+	"sync"
+	"time"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/kv"
+)
+
+const (
+	// maxConflictRetries limits the number of times a transaction is restarted after a conflict with concurrent writes.
+	maxConflictRetries = 16
+	// conflictBackoff is the initial delay before restarting a conflicting transaction. It doubles with each attempt.
+	conflictBackoff    = time.Millisecond
+	maxConflictBackoff = 200 * time.Millisecond
+)
+
+// concurrentWrites checks if the database allows read-write transactions to run in parallel.
+func concurrentWrites(db kv.KV) bool {
+	c, ok := db.(kv.ConcurrentWriter)
+	return ok && c.ConcurrentWrites()
+}
+
+// lockWrites locks the store for a write transaction and returns a function to unlock it.
+// Transactions run in parallel if the database supports concurrent writes, otherwise they are serialized.
+// Maintenance operations lock the writer exclusively and wait for all transactions to finish.
+func (qs *QuadStore) lockWrites() (unlock func()) {
+	if qs.concurrent {
+		qs.writer.RLock()
+		return qs.writer.RUnlock
+	}
+	qs.writer.Lock()
+	return qs.writer.Unlock
+}
+
+// retryConflicts calls fn until it returns an error other than kv.ErrConflict. Attempts are delayed
+// with an exponential backoff with jitter, to let conflicting transactions finish.
+func retryConflicts(ctx context.Context, fn func() error) error {
+	delay := conflictBackoff
+	for i := 0; ; i++ {
+		err := fn()
+		if !errors.Is(err, kv.ErrConflict) || i >= maxConflictRetries {
+			return err
+		}
+		d := delay/2 + rand.N(delay/2+1)
+		if clog.V(2) {
+			clog.Infof("kv: transaction conflict, retrying in %v", d)
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		delay = min(2*delay, maxConflictBackoff)
+	}
+}
+
+// idAllocator generates IDs for write transactions in memory, thus transactions don't conflict with each
+// other when generating IDs and can commit in any order. It tracks transactions that are in progress
+// to find the horizon: the last ID such that all transactions with lower IDs are finished.
+// Change feeds and AsOf rely on the horizon, since IDs may be committed out of order.
+type idAllocator struct {
+	sync.Mutex
+	// next is the next ID to allocate
+	next uint64
+	// committed is the last ID persisted by committed transactions
+	committed uint64
+	// active contains the first IDs of transactions in progress
+	active map[uint64]struct{}
+}
+
+// load initializes the allocator with the last ID stored in the database.
+func (a *idAllocator) load(last uint64) {
+	a.Lock()
+	a.next, a.committed = last+1, last
+	a.active = make(map[uint64]struct{})
+	a.Unlock()
+}
+
+// horizon returns the last ID such that all transactions with lower IDs are finished.
+func (a *idAllocator) horizon() uint64 {
+	a.Lock()
+	defer a.Unlock()
+	return a.horizonLocked()
+}
+
+func (a *idAllocator) horizonLocked() uint64 {
+	h := a.committed
+	for first := range a.active {
+		h = min(h, first-1)
+	}
+	return h
+}
+
+// genIDs allocates n consecutive IDs for a write transaction and returns the first one.
+// The transaction must be finished with endTx.
+func (qs *QuadStore) genIDs(ctx context.Context, tx kv.Tx, cache *txCache, n int) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	a := &qs.ids
+	a.Lock()
+	defer a.Unlock()
+	start := a.next
+	a.next += uint64(n)
+	if cache.first == 0 {
+		cache.first = start
+		a.active[start] = struct{}{}
+	}
+	cache.last = a.next - 1
+	return start, nil
+}
+
+// endTx must be called after a write transaction is committed or discarded. It releases IDs allocated
+// by the transaction, wakes up change feeds if the horizon advances and folds changes of counters
+// if there are too many of them (see foldCounters). The writer lock must be held by the caller.
+func (qs *QuadStore) endTx(ctx context.Context, cache *txCache, committed bool) {
+	if cache.first == 0 {
+		return
+	}
+	a := &qs.ids
+	a.Lock()
+	prev := a.horizonLocked()
+	delete(a.active, cache.first)
+	if committed {
+		a.committed = max(a.committed, cache.last)
+	}
+	advanced := a.horizonLocked() != prev
+	a.Unlock()
+	cache.first, cache.last = 0, 0
+	if advanced {
+		qs.changes.notify()
+	}
+	if committed && qs.pendingDeltas.Add(1) >= foldDeltas && qs.folding.CompareAndSwap(false, true) {
+		defer qs.folding.Store(false)
+		if err := qs.foldCounters(ctx); err != nil {
+			clog.Warningf("kv: cannot fold counters: %v", err)
+		}
+	}
+}
+
+// commitTx writes changes buffered in the cache and commits the transaction.
+// If the commit succeeds, caches of the store are updated.
+func (qs *QuadStore) commitTx(ctx context.Context, tx kv.Tx, cache *txCache) error {
+	flushCtx, flushTask := trace.NewTask(ctx, "cayley/kv/commit-tx/flush-map-bucket")
+	err := qs.flushMapBucket(flushCtx, tx, cache)
+	flushTask.End()
+	if err == nil {
+		err = qs.flushPredicateStats(ctx, tx, cache)
+	}
+	if err == nil {
+		err = qs.flushMetaCache(ctx, tx, cache)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	for iri, id := range cache.iris {
+		if id == 0 {
+			qs.valueLRU.Del(iri)
+		} else {
+			qs.valueLRU.Put(iri, id)
+		}
+	}
+	qs.rememberQuadsExist(cache.quads)
+	return nil
+}
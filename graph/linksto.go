@@ -62,11 +62,11 @@ func NewLinksTo(qs QuadIndexer, it iterator.Shape, d quad.Direction) *LinksTo {
 func (it *LinksTo) Direction() quad.Direction { return it.dir }
 
 func (it *LinksTo) Iterate(ctx context.Context) iterator.Scanner {
-	return newLinksToNext(ctx, it.qs, it.primary.Iterate(ctx), it.dir)
+	return newLinksToNext(ctx, it.qs, iterator.Scan(ctx, it.primary), it.dir)
 }
 
 func (it *LinksTo) Lookup(ctx context.Context) iterator.Index {
-	return newLinksToContains(it.qs, it.primary.Lookup(ctx), it.dir)
+	return newLinksToContains(it.qs, iterator.Lookup(ctx, it.primary), it.dir)
 }
 
 func (it *LinksTo) String() string {
@@ -127,8 +127,10 @@ func (it *LinksTo) getSize(ctx context.Context) refs.Size {
 	}
 	stats, _ := it.qs.Stats(ctx, false)
 	maxSize := stats.Quads.Value/2 + 1
-	// TODO(barakmich): It should really come from the quadstore itself
-	const fanoutFactor = 20
+	fanoutFactor := int64(20)
+	if h := HistogramOf(ctx, it.qs, it.dir); h != nil {
+		maxSize, fanoutFactor = min(maxSize, h.Quads), h.Fanout()
+	}
 	st, _ := it.primary.Stats(ctx)
 	value := min(st.Size.Value*fanoutFactor, maxSize)
 	it.size.Value, it.size.Exact = value, false
@@ -16,17 +16,22 @@ package memstore
 
 import (
 	"context"
+	"sort"
 
 	"github.com/aperturerobotics/cayley/graph"
 	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/graph/refs"
 )
 
-var _ iterator.Shape = (*allIterator)(nil)
+var (
+	_ iterator.Shape       = (*allIterator)(nil)
+	_ iterator.Partitioner = (*allIterator)(nil)
+)
 
 type allIterator struct {
 	qs    *QuadStore
 	all   []*Primitive
+	minid int64 // id of the first primitive, if the iterator is a partition
 	maxid int64 // id of last observed insert (prim id)
 	nodes bool
 }
@@ -43,7 +48,29 @@ func (it *allIterator) Iterate(ctx context.Context) iterator.Scanner {
 }
 
 func (it *allIterator) Lookup(ctx context.Context) iterator.Index {
-	return it.qs.newAllIteratorContains(it.nodes, it.maxid)
+	c := it.qs.newAllIteratorContains(it.nodes, it.maxid)
+	c.minid = it.minid
+	return c
+}
+
+// Partition implements iterator.Partitioner. Primitives are split into ranges of ids.
+func (it *allIterator) Partition(ctx context.Context, n int) ([]iterator.Shape, error) {
+	// primitives are ordered by id; skip ones inserted after the iterator was created
+	all := it.all[:sort.Search(len(it.all), func(i int) bool {
+		return it.all[i].ID > it.maxid
+	})]
+	if n > len(all) {
+		n = len(all)
+	}
+	out := make([]iterator.Shape, 0, n)
+	for i := 0; i < n; i++ {
+		part := all[len(all)*i/n : len(all)*(i+1)/n]
+		out = append(out, &allIterator{
+			qs: it.qs, all: part, nodes: it.nodes,
+			minid: part[0].ID, maxid: part[len(part)-1].ID,
+		})
+	}
+	return out, nil
 }
 
 func (it *allIterator) SubIterators() []iterator.Shape { return nil }
@@ -153,6 +180,7 @@ func (it *allIteratorNext) NextPath(ctx context.Context) bool { return false }
 
 type allIteratorContains struct {
 	qs    *QuadStore
+	minid int64
 	maxid int64 // id of last observed insert (prim id)
 	nodes bool
 
@@ -181,7 +209,7 @@ func (it *allIteratorContains) Contains(ctx context.Context, v graph.Ref) (bool,
 		return false, nil
 	}
 	p := it.qs.prim[id]
-	if p.ID > it.maxid {
+	if p.ID > it.maxid || p.ID < it.minid {
 		return false, nil
 	}
 	if !it.ok(p) {
@@ -17,8 +17,10 @@ package memstore
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/aperturerobotics/cayley/graph"
 	"github.com/aperturerobotics/cayley/graph/iterator"
@@ -143,6 +145,9 @@ type QuadStore struct {
 	reading bool         // someone else might be reading "all" slice - next insert/delete should clone it
 	index   QuadDirectionIndex
 	horizon int64 // used only to assign ids to tx
+	changes *graph.ChangeLog
+	preds   map[int64]*predStats               // statistics for each predicate
+	hist    [4]atomic.Pointer[graph.Histogram] // histograms of nodes for each direction; built on demand
 	// vip_index map[string]map[int64]map[string]map[int64]*b.Tree
 }
 
@@ -158,10 +163,12 @@ func New(quads ...quad.Quad) *QuadStore {
 
 func newQuadStore() *QuadStore {
 	return &QuadStore{
-		vals:  make(map[string]int64),
-		quads: make(map[internalQuad]int64),
-		prim:  make(map[int64]*Primitive),
-		index: NewQuadDirectionIndex(),
+		vals:    make(map[string]int64),
+		quads:   make(map[internalQuad]int64),
+		prim:    make(map[int64]*Primitive),
+		index:   NewQuadDirectionIndex(),
+		changes: graph.NewChangeLog(0),
+		preds:   make(map[int64]*predStats),
 	}
 }
 
@@ -297,6 +304,7 @@ func (qs *QuadStore) AddQuad(q quad.Quad) (int64, bool) {
 	for _, t := range qs.indexesForQuad(p) {
 		t.Set(id, pr)
 	}
+	qs.countPredicate(p, +1)
 	// TODO(barakmich): Add VIP indexing
 	return id, true
 }
@@ -311,9 +319,13 @@ func (qs *QuadStore) WriteQuad(ctx context.Context, q quad.Quad) error {
 
 // WriteQuads implements quad.Writer.
 func (qs *QuadStore) WriteQuads(ctx context.Context, buf []quad.Quad) (int, error) {
+	var added []graph.Delta
 	for _, q := range buf {
-		qs.AddQuad(q)
+		if _, ok := qs.AddQuad(q); ok {
+			added = append(added, graph.Delta{Quad: q, Action: graph.Add})
+		}
 	}
+	qs.changes.Append(added)
 	return len(buf), nil
 }
 
@@ -326,15 +338,12 @@ type quadWriter struct {
 }
 
 func (w *quadWriter) WriteQuad(ctx context.Context, q quad.Quad) error {
-	w.qs.AddQuad(q)
-	return nil
+	_, err := w.qs.WriteQuads(ctx, []quad.Quad{q})
+	return err
 }
 
 func (w *quadWriter) WriteQuads(ctx context.Context, buf []quad.Quad) (int, error) {
-	for _, q := range buf {
-		w.qs.AddQuad(q)
-	}
-	return len(buf), nil
+	return w.qs.WriteQuads(ctx, buf)
 }
 
 func (w *quadWriter) Close() error {
@@ -371,7 +380,10 @@ func (qs *QuadStore) Delete(id int64) bool {
 	for _, t := range qs.indexesForQuad(p.Quad) {
 		t.Delete(id)
 	}
-	delete(qs.quads, p.Quad)
+	if !p.Quad.Zero() {
+		delete(qs.quads, p.Quad)
+		qs.countPredicate(p.Quad, -1)
+	}
 	// remove primitive
 	delete(qs.prim, id)
 	di := -1
@@ -428,23 +440,38 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, deltas []graph.Delta, igno
 		}
 	}
 
+	applied := make([]graph.Delta, 0, len(deltas))
 	for _, d := range deltas {
 		switch d.Action {
 		case graph.Add:
-			qs.AddQuad(d.Quad)
+			if _, ok := qs.AddQuad(d.Quad); ok {
+				applied = append(applied, d)
+			}
 		case graph.Delete:
 			if id, _, ok := qs.findQuad(d.Quad); ok {
 				qs.Delete(id)
+				applied = append(applied, d)
 			}
 		default:
 			// TODO: ideally we should rollback it
+			qs.changes.Append(applied)
 			return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
 		}
 	}
 	qs.horizon++
+	qs.changes.Append(applied)
 	return nil
 }
 
+var _ graph.Watcher = (*QuadStore)(nil)
+
+// Watch implements graph.Watcher. Only a limited number of recent changes is kept in memory.
+//
+// Changes made directly with AddQuad and Delete are not reported.
+func (qs *QuadStore) Watch(ctx context.Context, cursor string) (graph.DeltaFeed, error) {
+	return qs.changes.Watch(ctx, cursor)
+}
+
 func asID(v graph.Ref) (int64, bool) {
 	switch v := v.(type) {
 	case bnode:
@@ -517,6 +544,95 @@ func (qs *QuadStore) Stats(ctx context.Context, exact bool) (graph.Stats, error)
 	}, nil
 }
 
+var _ graph.PredicateStats = (*QuadStore)(nil)
+
+// predStats counts quads with the same predicate and references to their subjects and objects.
+type predStats struct {
+	quads    int64
+	subjects map[int64]int
+	objects  map[int64]int
+}
+
+func incRefs(m map[int64]int, id int64, n int) {
+	if c := m[id] + n; c > 0 {
+		m[id] = c
+	} else {
+		delete(m, id)
+	}
+}
+
+func (qs *QuadStore) countPredicate(q internalQuad, n int) {
+	st := qs.preds[q.P]
+	if st == nil {
+		st = &predStats{
+			subjects: make(map[int64]int),
+			objects:  make(map[int64]int),
+		}
+		qs.preds[q.P] = st
+	}
+	// histograms are exact, thus any change invalidates them
+	for i := range qs.hist {
+		qs.hist[i].Store(nil)
+	}
+	st.quads += int64(n)
+	incRefs(st.subjects, q.S, n)
+	incRefs(st.objects, q.O, n)
+	if st.quads <= 0 {
+		delete(qs.preds, q.P)
+	}
+}
+
+// PredicateStats implements graph.PredicateStats.
+func (qs *QuadStore) PredicateStats(ctx context.Context, pred graph.Ref) (graph.PredicateStat, bool, error) {
+	id, ok := asID(pred)
+	if !ok {
+		return graph.PredicateStat{}, true, nil
+	}
+	st := qs.preds[id]
+	if st == nil {
+		return graph.PredicateStat{}, true, nil
+	}
+	return graph.PredicateStat{
+		Quads:    st.quads,
+		Subjects: int64(len(st.subjects)),
+		Objects:  int64(len(st.objects)),
+	}, true, nil
+}
+
+var _ graph.Histograms = (*QuadStore)(nil)
+
+// histogramTop is the number of the most frequent nodes kept in histograms.
+const histogramTop = 32
+
+// Histogram implements graph.Histograms. Histograms are exact and are calculated from the index.
+func (qs *QuadStore) Histogram(ctx context.Context, d quad.Direction) (*graph.Histogram, error) {
+	if d < quad.Subject || d > quad.Label {
+		return nil, fmt.Errorf("illegal direction: %v", d)
+	}
+	if h := qs.hist[d-1].Load(); h != nil {
+		return h, nil
+	}
+	h := &graph.Histogram{}
+	for id, tree := range qs.index.index[d-1] {
+		n := int64(tree.Len())
+		if n == 0 {
+			continue
+		}
+		h.Quads += n
+		h.Distinct++
+		h.Top = append(h.Top, graph.Frequency{Node: bnode(id), Quads: n})
+	}
+	sort.Slice(h.Top, func(i, j int) bool {
+		a, b := h.Top[i], h.Top[j]
+		return a.Quads > b.Quads || (a.Quads == b.Quads && a.Node.(bnode) < b.Node.(bnode))
+	})
+	if len(h.Top) > histogramTop {
+		h.Top = h.Top[:histogramTop:histogramTop]
+	}
+	qs.hist[d-1].Store(h)
+	return h, nil
+}
+
 func (qs *QuadStore) ValueOf(ctx context.Context, name quad.Value) (graph.Ref, error) {
 	if name == nil {
 		return nil, nil
@@ -564,4 +680,7 @@ func (qs *QuadStore) NodesAllIterator(ctx context.Context) iterator.Shape {
 	return qs.newAllIterator(true, qs.last)
 }
 
-func (qs *QuadStore) Close() error { return nil }
+func (qs *QuadStore) Close() error {
+	qs.changes.Close()
+	return nil
+}
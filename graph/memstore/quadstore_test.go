@@ -245,6 +245,90 @@ func TestRemoveQuad(t *testing.T) {
 	}
 }
 
+func TestPredicateStats(t *testing.T) {
+	ctx := context.Background()
+	qs, w, _ := makeTestStore(t, simpleGraph)
+
+	stat := func(pred string) graph.PredicateStat {
+		ref, err := qs.ValueOf(ctx, quad.Raw(pred))
+		require.NoError(t, err)
+		st, ok, err := qs.PredicateStats(ctx, ref)
+		require.NoError(t, err)
+		require.True(t, ok)
+		return st
+	}
+	require.Equal(t, graph.PredicateStat{Quads: 8, Subjects: 6, Objects: 4}, stat("follows"))
+	require.Equal(t, graph.PredicateStat{Quads: 3, Subjects: 3, Objects: 1}, stat("status"))
+
+	// E is the only subject of this quad, but F is still referenced by another one
+	require.NoError(t, w.RemoveQuad(ctx, quad.MakeRaw("E", "follows", "F", "")))
+	require.Equal(t, graph.PredicateStat{Quads: 7, Subjects: 5, Objects: 4}, stat("follows"))
+
+	st, ok, err := qs.PredicateStats(ctx, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Zero(t, st)
+}
+
+func TestHistogram(t *testing.T) {
+	ctx := context.Background()
+	qs, w, _ := makeTestStore(t, simpleGraph)
+
+	ref := func(name string) graph.Ref {
+		ref, err := qs.ValueOf(ctx, quad.Raw(name))
+		require.NoError(t, err)
+		return ref
+	}
+	h, err := qs.Histogram(ctx, quad.Object)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), h.Quads)
+	require.Equal(t, int64(5), h.Distinct)
+	require.Equal(t, int64(3), h.Frequency(ref("B")))
+	require.Equal(t, int64(3), h.Frequency(ref("cool")))
+	require.Equal(t, int64(1), h.Frequency(ref("D")))
+
+	h, err = qs.Histogram(ctx, quad.Label)
+	require.NoError(t, err)
+	require.Equal(t, &graph.Histogram{
+		Quads: 3, Distinct: 1,
+		Top: []graph.Frequency{{Node: ref("status_graph"), Quads: 3}},
+	}, h)
+
+	require.NoError(t, w.RemoveQuad(ctx, quad.MakeRaw("A", "follows", "B", "")))
+	h, err = qs.Histogram(ctx, quad.Object)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), h.Quads)
+	require.Equal(t, int64(2), h.Frequency(ref("B")))
+}
+
+func TestAllPartition(t *testing.T) {
+	ctx := context.Background()
+	qs, _, _ := makeTestStore(t, simpleGraph)
+
+	all := qs.NodesAllIterator(ctx)
+	exp, err := iterator.Iterate(all).All(ctx)
+	require.NoError(t, err)
+
+	parts, err := all.(iterator.Partitioner).Partition(ctx, 3)
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	var got []refs.Ref
+	for i, p := range parts {
+		res, err := iterator.Iterate(p).All(ctx)
+		require.NoError(t, err)
+		got = append(got, res...)
+		// partitions are disjoint
+		for j, o := range parts {
+			for _, r := range res {
+				ok, err := o.Lookup(ctx).Contains(ctx, r)
+				require.NoError(t, err)
+				require.Equal(t, i == j, ok)
+			}
+		}
+	}
+	require.ElementsMatch(t, exp, got)
+}
+
 func TestTransaction(t *testing.T) {
 	qs, w, _ := makeTestStore(t, simpleGraph)
 	ctx := context.Background()
@@ -86,6 +86,44 @@ type Stats struct {
 	Quads refs.Size // number of quads
 }
 
+// PredicateStat describes quads with the same predicate.
+type PredicateStat struct {
+	Quads    int64 // number of quads
+	Subjects int64 // number of distinct subjects
+	Objects  int64 // number of distinct objects
+}
+
+// PredicateStats is an optional interface for quad stores that maintain exact statistics for each predicate.
+//
+// Query optimizer uses these statistics to estimate sizes of joins on predicates.
+type PredicateStats interface {
+	// PredicateStats returns statistics of quads with a given predicate.
+	// It returns false if statistics are not available.
+	PredicateStats(ctx context.Context, pred Ref) (PredicateStat, bool, error)
+}
+
+// PredicateStatsOf returns combined statistics for a set of predicates.
+// It returns false if the quad store does not maintain statistics for predicates.
+//
+// Quad counts are exact, while distinct subjects and objects are only exact for a single predicate.
+func PredicateStatsOf(ctx context.Context, qs QuadIndexer, preds []Ref) (PredicateStat, bool) {
+	ps, ok := qs.(PredicateStats)
+	if !ok {
+		return PredicateStat{}, false
+	}
+	var out PredicateStat
+	for _, p := range preds {
+		st, ok, err := ps.PredicateStats(ctx, p)
+		if err != nil || !ok {
+			return PredicateStat{}, false
+		}
+		out.Quads += st.Quads
+		out.Subjects += st.Subjects
+		out.Objects += st.Objects
+	}
+	return out, true
+}
+
 type QuadStore interface {
 	refs.Namer
 	QuadIndexer
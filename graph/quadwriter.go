@@ -63,6 +63,27 @@ func Unwrap(qs QuadStore) QuadStore {
 	return qs
 }
 
+// UnwrapAll is the same as Unwrap, but it also unwraps each Wrapper, and returns the innermost QuadStore.
+func UnwrapAll(qs QuadStore) QuadStore {
+	for {
+		switch w := qs.(type) {
+		case *Handle:
+			qs = w.QuadStore
+		case Wrapper:
+			qs = w.Unwrap()
+		default:
+			return qs
+		}
+	}
+}
+
+// Wrapper is implemented by quad stores that add functionality on top of another quad store.
+type Wrapper interface {
+	QuadStore
+	// Unwrap returns the underlying quad store.
+	Unwrap() QuadStore
+}
+
 type Handle struct {
 	QuadStore
 	QuadWriter
@@ -0,0 +1,433 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+
+	"github.com/aperturerobotics/cayley/graph"
+	httpgraph "github.com/aperturerobotics/cayley/graph/http"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+var (
+	_ shape.Shape         = Shape{}
+	_ shape.JSONMarshaler = Shape{}
+)
+
+// Shape is a part of the query that will be executed on the remote side.
+type Shape struct {
+	qs    *QuadStore
+	data  []byte // encoded with shape.MarshalJSON
+	quads bool   // shape returns quads instead of nodes
+}
+
+func (s Shape) BuildIterator(ctx context.Context, _ graph.QuadStore) iterator.Shape {
+	return s.qs.newIteratorData(s.data, s.quads)
+}
+
+func (s Shape) Optimize(ctx context.Context, r shape.Optimizer) (shape.Shape, bool, error) {
+	return s, false, nil
+}
+
+// MarshalShapeJSON implements shape.JSONMarshaler. It allows to send a parent shape to the server,
+// if it has this shape as a child.
+func (s Shape) MarshalShapeJSON(ctx context.Context, _ refs.Namer) ([]byte, error) {
+	return s.data, nil
+}
+
+// OptimizeShape replaces parts of the query that can be executed by the server with remote shapes.
+// Optimizer is called from leaves to the root, thus the largest subtree possible will be sent to the server.
+func (qs *QuadStore) OptimizeShape(ctx context.Context, s shape.Shape) (shape.Shape, bool, error) {
+	switch s.(type) {
+	case Shape, shape.Null, shape.Fixed, shape.Lookup:
+		// these shapes do not access the store, so there is nothing to gain from sending them alone
+		return s, false, nil
+	}
+	data, err := shape.MarshalJSON(ctx, s, qs)
+	if err != nil {
+		// some shapes cannot be serialized; they will be executed locally
+		return s, false, nil
+	}
+	return Shape{qs: qs, data: data, quads: isQuads(s)}, true, nil
+}
+
+// isQuads checks if the shape returns quads instead of nodes.
+func isQuads(s shape.Shape) bool {
+	switch s := s.(type) {
+	case Shape:
+		return s.quads
+	case shape.Quads:
+		return true
+	case shape.QuadsAction:
+		return s.Result == quad.Any
+	case shape.Fixed:
+		if len(s) == 0 {
+			return false
+		}
+		_, ok := s[0].(quadRef)
+		return ok
+	case shape.Intersect:
+		return len(s) != 0 && isQuads(s[0])
+	case shape.IntersectOpt:
+		return isQuads(s.Sub)
+	case shape.Union:
+		return len(s) != 0 && isQuads(s[0])
+	case shape.Except:
+		return s.From != nil && isQuads(s.From)
+	case shape.Filter:
+		return isQuads(s.From)
+	case shape.FixedTags:
+		return isQuads(s.On)
+	case shape.Materialize:
+		return isQuads(s.Values)
+	case shape.Page:
+		return isQuads(s.From)
+	case shape.Unique:
+		return isQuads(s.From)
+	case shape.Save:
+		return isQuads(s.From)
+	case shape.Sort:
+		return isQuads(s.From)
+	}
+	return false
+}
+
+func (qs *QuadStore) newIterator(ctx context.Context, s shape.Shape) iterator.Shape {
+	data, err := shape.MarshalJSON(ctx, s, qs)
+	if err != nil {
+		return iterator.NewError(err)
+	}
+	return qs.newIteratorData(data, isQuads(s))
+}
+
+func (qs *QuadStore) newIteratorData(data []byte, quads bool) *Iterator {
+	return &Iterator{qs: qs, data: data, quads: quads}
+}
+
+var _ iterator.Shape = (*Iterator)(nil)
+
+// Iterator executes a query shape on the remote side.
+type Iterator struct {
+	qs    *QuadStore
+	data  []byte
+	quads bool
+	size  *refs.Size
+}
+
+func (it *Iterator) shape() Shape {
+	return Shape{qs: it.qs, data: it.data, quads: it.quads}
+}
+
+func (it *Iterator) Iterate(ctx context.Context) iterator.Scanner {
+	return &iteratorNext{
+		iteratorBase: newIteratorBase(it.qs, it.quads),
+		data:         it.data,
+	}
+}
+
+func (it *Iterator) Lookup(ctx context.Context) iterator.Index {
+	return &iteratorContains{
+		iteratorBase: newIteratorBase(it.qs, it.quads),
+		from:         it.shape(),
+	}
+}
+
+func (it *Iterator) Stats(ctx context.Context) (iterator.Costs, error) {
+	if it.size == nil {
+		n, err := it.qs.count(ctx, it.shape())
+		if err != nil {
+			return iterator.Costs{}, err
+		}
+		it.size = &refs.Size{Value: n, Exact: true}
+	}
+	return iterator.Costs{
+		NextCost:     1,
+		ContainsCost: 10,
+		Size:         *it.size,
+	}, nil
+}
+
+func (it *Iterator) Optimize(ctx context.Context) (iterator.Shape, bool, error) {
+	return it, false, nil
+}
+
+func (it *Iterator) SubIterators() []iterator.Shape {
+	return nil
+}
+
+func (it *Iterator) String() string {
+	return fmt.Sprintf("Remote(%s)", it.data)
+}
+
+// resultStream reads results of a shape query.
+type resultStream struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+func (qs *QuadStore) query(ctx context.Context, req httpgraph.ShapeRequest) (*resultStream, error) {
+	resp, err := qs.postJSON(ctx, "/shape", req)
+	if err != nil {
+		return nil, err
+	}
+	return &resultStream{body: resp.Body, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+// next reads the next result from the stream. It returns false when there are no more results.
+func (s *resultStream) next() (httpgraph.ShapeResult, bool, error) {
+	var r httpgraph.ShapeResult
+	if err := s.dec.Decode(&r); err == io.EOF {
+		return r, false, nil
+	} else if err != nil {
+		return r, false, err
+	} else if r.Error != "" {
+		return r, false, fmt.Errorf("remote: %s", r.Error)
+	}
+	return r, true, nil
+}
+
+func (s *resultStream) Close() error {
+	return s.body.Close()
+}
+
+func newIteratorBase(qs *QuadStore, quads bool) iteratorBase {
+	return iteratorBase{qs: qs, quads: quads}
+}
+
+type iteratorBase struct {
+	qs    *QuadStore
+	quads bool
+
+	err  error
+	res  graph.Ref
+	tags map[string]graph.Ref
+}
+
+// setResult decodes a result received from the server.
+func (it *iteratorBase) setResult(ctx context.Context, r httpgraph.ShapeResult) bool {
+	if it.quads {
+		if r.Quad == nil {
+			it.err = fmt.Errorf("remote: expected a quad in the result")
+			return false
+		}
+		q, err := r.Quad.ToNative(ctx)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.res = quadRef(q)
+	} else {
+		v, err := httpgraph.UnmarshalValue(ctx, r.Value)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.res = refs.PreFetched(v)
+	}
+	it.tags = make(map[string]graph.Ref, len(r.Tags))
+	for tag, data := range r.Tags {
+		v, err := httpgraph.UnmarshalValue(ctx, data)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.tags[tag] = refs.PreFetched(v)
+	}
+	return true
+}
+
+func (it *iteratorBase) TagResults(ctx context.Context, m map[string]graph.Ref) error {
+	if err := it.Err(); err != nil {
+		return err
+	}
+	maps.Copy(m, it.tags)
+	return nil
+}
+
+func (it *iteratorBase) Result(ctx context.Context) (graph.Ref, error) {
+	return it.res, it.err
+}
+
+func (it *iteratorBase) Err() error {
+	return it.err
+}
+
+func (it *iteratorBase) String() string {
+	return "Remote"
+}
+
+type iteratorNext struct {
+	iteratorBase
+	data []byte
+
+	stream *resultStream
+	done   bool
+	// next result that was read by NextPath, but belongs to the next call to Next
+	pending *httpgraph.ShapeResult
+}
+
+func (it *iteratorNext) read(ctx context.Context) (httpgraph.ShapeResult, bool) {
+	if it.pending != nil {
+		r := *it.pending
+		it.pending = nil
+		return r, true
+	}
+	if it.done || it.err != nil {
+		return httpgraph.ShapeResult{}, false
+	}
+	if it.stream == nil {
+		it.stream, it.err = it.qs.query(ctx, httpgraph.ShapeRequest{Shape: it.data, Quads: it.quads})
+		if it.err != nil {
+			return httpgraph.ShapeResult{}, false
+		}
+	}
+	r, ok, err := it.stream.next()
+	if err != nil {
+		it.err = err
+	}
+	if !ok {
+		it.done = true
+		it.stream.Close()
+	}
+	return r, ok
+}
+
+func (it *iteratorNext) Next(ctx context.Context) bool {
+	for {
+		r, ok := it.read(ctx)
+		if !ok {
+			it.res, it.tags = nil, nil
+			return false
+		}
+		if r.Path {
+			// skip alternative paths, if the caller is not interested in them
+			continue
+		}
+		return it.setResult(ctx, r)
+	}
+}
+
+func (it *iteratorNext) NextPath(ctx context.Context) bool {
+	if it.pending != nil || it.stream == nil {
+		return false
+	}
+	r, ok := it.read(ctx)
+	if !ok {
+		return false
+	}
+	if !r.Path {
+		// different result - keep it for the Next call
+		it.pending = &r
+		return false
+	}
+	return it.setResult(ctx, r)
+}
+
+func (it *iteratorNext) Close() error {
+	if it.stream != nil && !it.done {
+		it.done = true
+		return it.stream.Close()
+	}
+	return nil
+}
+
+type iteratorContains struct {
+	iteratorBase
+	from Shape
+
+	stream *resultStream
+}
+
+func (it *iteratorContains) closeStream() {
+	if it.stream != nil {
+		_ = it.stream.Close()
+		it.stream = nil
+	}
+}
+
+func (it *iteratorContains) Contains(ctx context.Context, v graph.Ref) (bool, error) {
+	it.closeStream()
+	it.res, it.tags = nil, nil
+	var (
+		filter shape.Shape
+		label  quad.Value
+	)
+	switch v := v.(type) {
+	case refs.PreFetchedValue:
+		if it.quads {
+			return false, nil
+		}
+		filter = shape.Fixed{v}
+	case quadRef:
+		if !it.quads {
+			return false, nil
+		}
+		var filt shape.Quads
+		for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object} {
+			filt = append(filt, shape.QuadFilter{Dir: d, Values: shape.Fixed{refs.PreFetched(quad.Quad(v).Get(d))}})
+		}
+		// empty label cannot be expressed as a filter, so it will be checked on our side
+		if label = v.Label; label != nil {
+			filt = append(filt, shape.QuadFilter{Dir: quad.Label, Values: shape.Fixed{refs.PreFetched(label)}})
+		}
+		filter = filt
+	default:
+		return false, nil
+	}
+	data, err := shape.MarshalJSON(ctx, shape.Intersect{it.from, filter}, it.qs)
+	if err != nil {
+		it.err = err
+		return false, err
+	}
+	it.stream, err = it.qs.query(ctx, httpgraph.ShapeRequest{Shape: data, Quads: it.quads})
+	if err != nil {
+		it.err = err
+		return false, err
+	}
+	for {
+		r, ok, err := it.stream.next()
+		if err != nil {
+			it.err = err
+			return false, err
+		} else if !ok {
+			it.closeStream()
+			return false, nil
+		}
+		if r.Path {
+			continue
+		}
+		if !it.setResult(ctx, r) {
+			return false, it.err
+		}
+		if q, ok := it.res.(quadRef); ok && label == nil && q.Label != nil {
+			continue
+		}
+		return true, nil
+	}
+}
+
+func (it *iteratorContains) NextPath(ctx context.Context) bool {
+	if it.err != nil || it.stream == nil {
+		return false
+	}
+	r, ok, err := it.stream.next()
+	if err != nil {
+		it.err = err
+		return false
+	} else if !ok || !r.Path {
+		it.closeStream()
+		return false
+	}
+	return it.setResult(ctx, r)
+}
+
+func (it *iteratorContains) Close() error {
+	it.closeStream()
+	return nil
+}
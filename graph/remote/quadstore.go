@@ -0,0 +1,361 @@
+// Package remote implements a quad store backend that forwards all requests
+// to another Cayley instance over HTTP API v2.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aperturerobotics/cayley/graph"
+	httpgraph "github.com/aperturerobotics/cayley/graph/http"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+const QuadStoreType = "http"
+
+const (
+	// OptTimeout is an option for request timeout in seconds. Zero means no timeout.
+	OptTimeout = "timeout"
+
+	apiPrefix = "/api/v2"
+)
+
+func init() {
+	graph.RegisterQuadStore(QuadStoreType, graph.QuadStoreRegistration{
+		NewFunc: func(ctx context.Context, addr string, opts graph.Options) (graph.QuadStore, error) {
+			return newQuadStore(addr, opts)
+		},
+		UpgradeFunc:  nil,
+		InitFunc:     nil,
+		IsPersistent: true,
+	})
+}
+
+var (
+	_ graph.QuadStore = (*QuadStore)(nil)
+	_ refs.BatchNamer = (*QuadStore)(nil)
+	_ shape.Optimizer = (*QuadStore)(nil)
+)
+
+// QuadStore is a client for a quad store exposed by another Cayley instance.
+//
+// All values are kept on the remote side; references returned by this quad store
+// contain the values themselves, thus NameOf never accesses the network.
+type QuadStore struct {
+	addr string
+	cli  *http.Client
+}
+
+func newQuadStore(addr string, opts graph.Options) (*QuadStore, error) {
+	timeout, err := opts.IntKey(OptTimeout, 0)
+	if err != nil {
+		return nil, err
+	}
+	cli := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	return New(addr, cli), nil
+}
+
+// New creates a quad store that sends requests to a Cayley server at a given address.
+// If client is nil, http.DefaultClient is used.
+func New(addr string, cli *http.Client) *QuadStore {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	return &QuadStore{addr: strings.TrimSuffix(addr, "/"), cli: cli}
+}
+
+// quadRef is a reference to a quad returned by the remote server.
+type quadRef quad.Quad
+
+func (q quadRef) Key() any { return quad.Quad(q) }
+
+func (qs *QuadStore) url(path string) string {
+	return qs.addr + apiPrefix + path
+}
+
+// readError converts a failed response to an error.
+func readError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var e struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &e); err == nil && e.Error != "" {
+		return fmt.Errorf("remote: %s", e.Error)
+	}
+	return fmt.Errorf("remote: request failed: %s", resp.Status)
+}
+
+// do sends a request and returns a response body. Caller must close the body.
+func (qs *QuadStore) do(req *http.Request) (*http.Response, error) {
+	resp, err := qs.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+func (qs *QuadStore) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	if ctx == nil {
+		// some callers still pass nil context
+		ctx = context.Background()
+	}
+	return http.NewRequestWithContext(ctx, method, qs.url(path), body)
+}
+
+func (qs *QuadStore) postJSON(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := qs.newRequest(ctx, http.MethodPost, path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return qs.do(req)
+}
+
+func (qs *QuadStore) ValueOf(ctx context.Context, v quad.Value) (graph.Ref, error) {
+	if v == nil {
+		return nil, nil
+	}
+	out, err := qs.RefsOf(ctx, []quad.Value{v})
+	if err != nil {
+		return nil, err
+	}
+	return out[0], nil
+}
+
+// RefsOf checks which of the values exist on the remote side in a single request.
+// References for missing values are set to nil.
+func (qs *QuadStore) RefsOf(ctx context.Context, nodes []quad.Value) ([]graph.Ref, error) {
+	lookup := make(shape.Lookup, 0, len(nodes))
+	for _, v := range nodes {
+		if v != nil {
+			lookup = append(lookup, v)
+		}
+	}
+	out := make([]graph.Ref, len(nodes))
+	if len(lookup) == 0 {
+		return out, nil
+	}
+	it := qs.newIterator(ctx, lookup).Iterate(ctx)
+	defer it.Close()
+	exists := make(map[string]struct{}, len(lookup))
+	for it.Next(ctx) {
+		r, err := it.Result(ctx)
+		if err != nil {
+			return nil, err
+		}
+		v, err := qs.NameOf(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		exists[string(quad.HashOf(v))] = struct{}{}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	for i, v := range nodes {
+		if v == nil {
+			continue
+		}
+		if _, ok := exists[string(quad.HashOf(v))]; ok {
+			out[i] = refs.PreFetched(v)
+		}
+	}
+	return out, nil
+}
+
+func (qs *QuadStore) ValuesOf(ctx context.Context, vals []graph.Ref) ([]quad.Value, error) {
+	out := make([]quad.Value, len(vals))
+	for i, v := range vals {
+		var err error
+		if out[i], err = qs.NameOf(ctx, v); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (qs *QuadStore) NameOf(ctx context.Context, v graph.Ref) (quad.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case refs.PreFetchedValue:
+		return v.NameOf(), nil
+	case quadRef:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected ref type: %T", v)
+}
+
+func (qs *QuadStore) Quad(ctx context.Context, v graph.Ref) (quad.Quad, error) {
+	q, ok := v.(quadRef)
+	if !ok {
+		return quad.Quad{}, fmt.Errorf("unexpected quad ref type: %T", v)
+	}
+	return quad.Quad(q), nil
+}
+
+func (qs *QuadStore) QuadDirection(ctx context.Context, v graph.Ref, d quad.Direction) (graph.Ref, error) {
+	q, err := qs.Quad(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	if val := q.Get(d); val != nil {
+		// values of existing quads are known to exist, so there is no need to check them
+		return refs.PreFetched(val), nil
+	}
+	return nil, nil
+}
+
+func (qs *QuadStore) quadsShape(d quad.Direction, v graph.Ref) shape.Shape {
+	return shape.Quads{{Dir: d, Values: shape.Fixed{v}}}
+}
+
+func (qs *QuadStore) QuadIterator(ctx context.Context, d quad.Direction, v graph.Ref) iterator.Shape {
+	return qs.newIterator(ctx, qs.quadsShape(d, v))
+}
+
+func (qs *QuadStore) QuadIteratorSize(ctx context.Context, d quad.Direction, v graph.Ref) (refs.Size, error) {
+	n, err := qs.count(ctx, qs.quadsShape(d, v))
+	if err != nil {
+		return refs.Size{}, err
+	}
+	return refs.Size{Value: n, Exact: true}, nil
+}
+
+func (qs *QuadStore) QuadsAllIterator(ctx context.Context) iterator.Shape {
+	return qs.newIterator(ctx, shape.Quads{})
+}
+
+func (qs *QuadStore) NodesAllIterator(ctx context.Context) iterator.Shape {
+	return qs.newIterator(ctx, shape.AllNodes{})
+}
+
+func (qs *QuadStore) Stats(ctx context.Context, exact bool) (graph.Stats, error) {
+	req, err := qs.newRequest(ctx, http.MethodGet, "/stats?exact="+strconv.FormatBool(exact), nil)
+	if err != nil {
+		return graph.Stats{}, err
+	}
+	resp, err := qs.do(req)
+	if err != nil {
+		return graph.Stats{}, err
+	}
+	defer resp.Body.Close()
+	var st httpgraph.Stats
+	if err = json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return graph.Stats{}, err
+	}
+	return st.ToNative(), nil
+}
+
+func (qs *QuadStore) ApplyDeltas(ctx context.Context, deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	req := httpgraph.DeltasRequest{
+		Deltas:        make([]httpgraph.Delta, 0, len(deltas)),
+		IgnoreDup:     ignoreOpts.IgnoreDup,
+		IgnoreMissing: ignoreOpts.IgnoreMissing,
+	}
+	for _, d := range deltas {
+		q, err := httpgraph.MakeQuad(d.Quad)
+		if err != nil {
+			return &graph.DeltaError{Delta: d, Err: err}
+		}
+		req.Deltas = append(req.Deltas, httpgraph.Delta{Quad: q, Action: d.Action})
+	}
+	resp, err := qs.postJSON(ctx, "/deltas", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		var de httpgraph.DeltaError
+		if err = json.NewDecoder(resp.Body).Decode(&de); err != nil {
+			return err
+		}
+		return de.ToNative(deltas)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+func (qs *QuadStore) NewQuadWriter(ctx context.Context) (quad.WriteCloser, error) {
+	return &quadWriter{qs: qs}, nil
+}
+
+type quadWriter struct {
+	qs *QuadStore
+}
+
+func (w *quadWriter) WriteQuad(ctx context.Context, q quad.Quad) error {
+	_, err := w.WriteQuads(ctx, []quad.Quad{q})
+	return err
+}
+
+func (w *quadWriter) WriteQuads(ctx context.Context, buf []quad.Quad) (int, error) {
+	deltas := make([]graph.Delta, 0, len(buf))
+	for _, q := range buf {
+		deltas = append(deltas, graph.Delta{Quad: q, Action: graph.Add})
+	}
+	err := w.qs.ApplyDeltas(ctx, deltas, graph.IgnoreOpts{IgnoreDup: true})
+	if err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (w *quadWriter) Close() error {
+	return nil
+}
+
+func (qs *QuadStore) Close() error {
+	qs.cli.CloseIdleConnections()
+	return nil
+}
+
+// count returns the number of results of a shape executed on the remote side.
+func (qs *QuadStore) count(ctx context.Context, s shape.Shape) (int64, error) {
+	it := qs.newIterator(ctx, shape.Count{Values: s}).Iterate(ctx)
+	defer it.Close()
+	if !it.Next(ctx) {
+		if err := it.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("remote: no results for count")
+	}
+	r, err := it.Result(ctx)
+	if err != nil {
+		return 0, err
+	}
+	v, err := qs.NameOf(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(quad.Int)
+	if !ok {
+		return 0, fmt.Errorf("remote: unexpected count value: %T", v)
+	}
+	return int64(n), nil
+}
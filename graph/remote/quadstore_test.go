@@ -0,0 +1,56 @@
+package remote_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/graphtest"
+	"github.com/aperturerobotics/cayley/graph/memstore"
+	"github.com/aperturerobotics/cayley/graph/remote"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/path"
+	"github.com/aperturerobotics/cayley/query/shape"
+	cayleyhttp "github.com/aperturerobotics/cayley/server/http"
+)
+
+func makeRemote(t testing.TB) (*remote.QuadStore, *memstore.QuadStore, func()) {
+	mem := memstore.New()
+	api := cayleyhttp.NewAPIv2(&graph.Handle{QuadStore: mem})
+	srv := httptest.NewServer(api)
+	qs := remote.New(srv.URL, nil)
+	return qs, mem, func() {
+		qs.Close()
+		srv.Close()
+	}
+}
+
+func TestRemote(t *testing.T) {
+	graphtest.TestAll(t, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		qs, _, closer := makeRemote(t)
+		return qs, nil, closer
+	}, &graphtest.Config{
+		OptimizesComparison:  true,
+		AlwaysRunIntegration: true,
+	})
+}
+
+func TestRemotePushdown(t *testing.T) {
+	ctx := context.Background()
+	qs, mem, closer := makeRemote(t)
+	defer closer()
+	mem.AddQuad(quad.MakeIRI("alice", "follows", "bob", ""))
+	mem.AddQuad(quad.MakeIRI("bob", "follows", "charlie", ""))
+
+	p := path.StartPath(qs, quad.IRI("alice")).Out(quad.IRI("follows")).Out(quad.IRI("follows"))
+	s, _, err := shape.Optimize(ctx, p.Shape(), qs)
+	require.NoError(t, err)
+	require.IsType(t, remote.Shape{}, s, "query should be executed on the server")
+
+	vals, err := p.Iterate(ctx).AllValues(ctx, qs)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.IRI("charlie")}, vals)
+}
@@ -393,3 +393,198 @@ func (it *iteratorContains) Close() error {
 	}
 	return nil
 }
+
+func (qs *QuadStore) newAggregateIterator(s Aggregate) *aggregateIterator {
+	return &aggregateIterator{
+		qs:    qs,
+		query: s,
+	}
+}
+
+// aggregateIterator runs a GROUP BY query and merges columns of each reducer into a single value.
+type aggregateIterator struct {
+	qs    *QuadStore
+	query Aggregate
+}
+
+func (it *aggregateIterator) Iterate(ctx context.Context) iterator.Scanner {
+	return &aggregateNext{qs: it.qs, query: it.query}
+}
+
+func (it *aggregateIterator) Lookup(ctx context.Context) iterator.Index {
+	return iterator.NewMaterialize(it).Lookup(ctx)
+}
+
+func (it *aggregateIterator) Stats(ctx context.Context) (iterator.Costs, error) {
+	sz, err := it.qs.querySize(ctx, it.query.From)
+	if len(it.query.GroupBy) == 0 {
+		sz = refs.Size{Value: 1, Exact: true}
+	} else {
+		sz.Exact = false
+	}
+	return iterator.Costs{
+		NextCost:     1,
+		ContainsCost: 10,
+		Size:         sz,
+	}, err
+}
+
+func (it *aggregateIterator) Optimize(ctx context.Context) (iterator.Shape, bool, error) {
+	return it, false, nil
+}
+
+func (it *aggregateIterator) SubIterators() []iterator.Shape {
+	return nil
+}
+
+func (it *aggregateIterator) String() string {
+	return it.query.SQL(NewBuilder(it.qs.flavor.QueryDialect))
+}
+
+type aggregateNext struct {
+	qs     *QuadStore
+	query  Aggregate
+	cursor *sql.Rows
+	err    error
+	res    graph.Ref
+	tags   map[string]graph.Ref
+}
+
+func (it *aggregateNext) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if it.cursor == nil {
+		if it.cursor, it.err = it.qs.Query(ctx, it.query); it.err != nil {
+			return false
+		}
+	}
+	for it.cursor.Next() {
+		if !it.scan() {
+			return false
+		}
+		if it.res != nil {
+			return true
+		}
+	}
+	it.err = it.cursor.Err()
+	it.cursor.Close()
+	return false
+}
+
+func (it *aggregateNext) scan() bool {
+	groups := make([]NodeHash, len(it.query.GroupBy))
+	var dst []any
+	for i := range groups {
+		dst = append(dst, &groups[i])
+	}
+	type columns struct {
+		i1, i2 sql.NullInt64
+		f      sql.NullFloat64
+		n      sql.NullInt64
+		t      NullTime
+	}
+	cols := make([]columns, len(it.query.Reducers))
+	for i, r := range it.query.Reducers {
+		c := &cols[i]
+		switch r.Op {
+		case iterator.AggregateCount:
+			dst = append(dst, &c.n)
+		case iterator.AggregateSum, iterator.AggregateAvg:
+			dst = append(dst, &c.i1, &c.i2, &c.f, &c.n)
+		case iterator.AggregateMin, iterator.AggregateMax:
+			dst = append(dst, &c.i1, &c.f, &c.t)
+		}
+	}
+	if err := it.cursor.Scan(dst...); err != nil {
+		it.err = err
+		return false
+	}
+	it.res = nil
+	it.tags = make(map[string]graph.Ref)
+	for i, t := range it.query.GroupBy {
+		if groups[i].Valid() {
+			it.tags[t] = groups[i]
+		}
+	}
+	for i, r := range it.query.Reducers {
+		c := cols[i]
+		var v quad.Value
+		switch r.Op {
+		case iterator.AggregateCount:
+			v = quad.Int(c.n.Int64)
+		case iterator.AggregateSum:
+			if c.n.Int64 != 0 {
+				v = quad.Float(float64(c.i1.Int64) + c.f.Float64)
+			} else {
+				v = quad.Int(c.i1.Int64)
+			}
+		case iterator.AggregateAvg:
+			if n := c.i2.Int64 + c.n.Int64; n != 0 {
+				v = quad.Float((float64(c.i1.Int64) + c.f.Float64) / float64(n))
+			}
+		case iterator.AggregateMin, iterator.AggregateMax:
+			switch {
+			case c.i1.Valid && c.f.Valid:
+				// prefer a float only if it's strictly smaller (or larger) than an integer
+				fi := float64(c.i1.Int64)
+				if (r.Op == iterator.AggregateMin && c.f.Float64 < fi) || (r.Op == iterator.AggregateMax && c.f.Float64 > fi) {
+					v = quad.Float(c.f.Float64)
+				} else {
+					v = quad.Int(c.i1.Int64)
+				}
+			case c.i1.Valid:
+				v = quad.Int(c.i1.Int64)
+			case c.f.Valid:
+				v = quad.Float(c.f.Float64)
+			case c.t.Valid:
+				v = quad.Time(c.t.Time)
+			}
+		}
+		if v == nil {
+			continue
+		}
+		if r.As != "" {
+			it.tags[r.As] = refs.PreFetched(v)
+		}
+		if i == 0 {
+			it.res = refs.PreFetched(v)
+		}
+	}
+	if len(groups) != 0 && groups[0].Valid() {
+		it.res = groups[0]
+	}
+	return true
+}
+
+func (it *aggregateNext) TagResults(ctx context.Context, m map[string]graph.Ref) error {
+	if err := it.Err(); err != nil {
+		return err
+	}
+	maps.Copy(m, it.tags)
+	return nil
+}
+
+func (it *aggregateNext) Result(ctx context.Context) (graph.Ref, error) {
+	return it.res, it.err
+}
+
+func (it *aggregateNext) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *aggregateNext) Err() error {
+	return it.err
+}
+
+func (it *aggregateNext) Close() error {
+	if it.cursor != nil {
+		it.cursor.Close()
+		it.cursor = nil
+	}
+	return nil
+}
+
+func (it *aggregateNext) String() string {
+	return it.query.SQL(NewBuilder(it.qs.flavor.QueryDialect))
+}
@@ -95,6 +95,10 @@ func (opt *Optimizer) OptimizeShape(ctx context.Context, s shape.Shape) (shape.S
 		return opt.optimizeSave(s)
 	case shape.Page:
 		return opt.optimizePage(s)
+	case shape.Aggregate:
+		return opt.optimizeAggregate(s)
+	case shape.Sort:
+		return opt.optimizeSort(s)
 	default:
 		return s, false, nil
 	}
@@ -562,3 +566,96 @@ func (opt *Optimizer) optimizeIntersect(s shape.Intersect) (shape.Shape, bool, e
 	other[0] = pri
 	return other, true, nil
 }
+
+func (opt *Optimizer) optimizeAggregate(s shape.Aggregate) (shape.Shape, bool, error) {
+	sel, ok := s.From.(Select)
+	if !ok {
+		return s, false, nil
+	}
+	// all tags must be available as columns of the subquery
+	cols := make(map[string]struct{})
+	for _, c := range sel.Columns() {
+		cols[c] = struct{}{}
+	}
+	if _, ok := cols[tagNode]; !ok {
+		return s, false, nil
+	}
+	for _, t := range s.GroupBy {
+		if _, ok := cols[t]; !ok {
+			return s, false, nil
+		}
+	}
+	for _, r := range s.Reducers {
+		if _, ok := cols[r.Tag]; r.Tag != "" && !ok {
+			return s, false, nil
+		}
+	}
+	return Aggregate{
+		From:     sel,
+		GroupBy:  s.GroupBy,
+		Reducers: s.Reducers,
+	}, true, nil
+}
+
+func (opt *Optimizer) optimizeSort(s shape.Sort) (shape.Shape, bool, error) {
+	sel, ok := s.From.(Select)
+	if !ok {
+		return s, false, nil
+	}
+	keys := s.By
+	if len(keys) == 0 {
+		keys = []iterator.SortKey{{}}
+	}
+	cols := sel.Columns()
+	has := func(c string) bool {
+		return slices.Contains(cols, c)
+	}
+	if !has(tagNode) {
+		return s, false, nil
+	}
+	flat := false
+	for _, k := range keys {
+		if k.Lang != "" {
+			// collation is done by the database and may not match the requested one
+			return s, false, nil
+		} else if k.Tag != "" {
+			flat = true
+			if !has(k.Tag) {
+				return s, false, nil
+			}
+		}
+	}
+	// sort results of the query wrapped into a subquery, and join values of all the tags
+	sub := opt.nextTable()
+	out := Select{
+		From: []Source{Subquery{Query: sel, Alias: sub}},
+		// each path is a separate result when sorting by tags; see iterator.Sort
+		nextPath: sel.nextPath && !flat,
+	}
+	for _, c := range cols {
+		out.Fields = append(out.Fields, Field{Table: sub, Name: c, Alias: c})
+	}
+	tables := make(map[string]string)
+	for _, k := range keys {
+		tag := k.Tag
+		if tag == "" {
+			tag = tagNode
+		}
+		tbl := tables[tag]
+		if tbl == "" {
+			tbl = opt.nextTable()
+			tables[tag] = tbl
+			out.Joins = append(out.Joins, Join{
+				Table: Table{Name: "nodes", Alias: tbl},
+				On: Where{
+					Table: tbl, Field: "hash", Op: OpEqual,
+					Value: FieldName{Table: sub, Name: tag},
+				},
+			})
+		}
+		out.OrderBy = append(out.OrderBy, OrderBy{Nodes: tbl, Desc: k.Desc})
+	}
+	// database may return results with equal keys in any order, thus sort by the node to make it stable
+	out.OrderBy = append(out.OrderBy, OrderBy{Field: FieldName{Table: sub, Name: tagNode}})
+	return out, true, nil
+}
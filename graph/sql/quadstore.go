@@ -113,6 +113,8 @@ type QuadStore struct {
 	mu    sync.RWMutex
 	nodes int64
 	quads int64
+
+	changes *graph.ChangeLog
 }
 
 func connect(addr string, flavor string, opts graph.Options) (*sql.DB, error) {
@@ -265,6 +267,7 @@ func New(typ string, addr string, options graph.Options) (graph.QuadStore, error
 		sizes:   lru.New(1024),
 		ids:     lru.New(1024),
 		noSizes: true, // Skip size checking by default.
+		changes: graph.NewChangeLog(0),
 	}
 	qs.opt.SetRegexpOp(qs.flavor.RegexpOp)
 	if qs.flavor.NoOffsetWithoutLimit {
@@ -399,7 +402,10 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, opts gra
 		p[i] = qs.flavor.Placeholder(i + 1)
 	}
 
+	// deletes of quads that did not exist
+	var missing map[int]struct{}
 	err = retry(tx, func() error {
+		missing = make(map[int]struct{})
 		err = qs.flavor.RunTx(tx, deltas.IncNode, deltas.QuadAdd, opts)
 		if err != nil {
 			return err
@@ -445,6 +451,7 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, opts gra
 					// TODO: reference to delta
 					return &graph.DeltaError{Err: graph.ErrQuadNotExist}
 				}
+				missing[d.Ind] = struct{}{}
 				// revert counters for all directions of this quad
 				for _, dir := range quad.Directions {
 					if h := d.Quad.Get(dir); h.Valid() {
@@ -490,7 +497,27 @@ func (qs *QuadStore) ApplyDeltas(ctx context.Context, in []graph.Delta, opts gra
 	qs.quads = -1
 	qs.nodes = -1
 	qs.mu.Unlock()
-	return tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	applied := make([]graph.Delta, 0, len(in))
+	for i, d := range in {
+		if _, ok := missing[i]; !ok {
+			applied = append(applied, d)
+		}
+	}
+	qs.changes.Append(applied)
+	return nil
+}
+
+var _ graph.Watcher = (*QuadStore)(nil)
+
+// Watch implements graph.Watcher. Only changes made by this process are reported,
+// and only a limited number of recent changes is kept in memory.
+//
+// With IgnoreDup, quads that already existed may be reported as added again.
+func (qs *QuadStore) Watch(ctx context.Context, cursor string) (graph.DeltaFeed, error) {
+	return qs.changes.Watch(ctx, cursor)
 }
 
 func (qs *QuadStore) Quad(ctx context.Context, val graph.Ref) (quad.Quad, error) {
@@ -560,6 +587,13 @@ func (qs *QuadStore) ValueOf(ctx context.Context, s quad.Value) (graph.Ref, erro
 	return HashOf(s), nil
 }
 
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
 // NullTime represents a time.Time that may be null. NullTime implements the
 // sql.Scanner interface so it can be used as a scan destination, similar to
 // sql.NullString.
@@ -583,6 +617,15 @@ func (nt *NullTime) Scan(value any) error {
 			return err
 		}
 		nt.Time, nt.Valid = t, true
+	case string:
+		// results of expressions over time columns might be returned as strings (for example, MAX in SQLite)
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				nt.Time, nt.Valid = t, true
+				return nil
+			}
+		}
+		return fmt.Errorf("unsupported time format: %q", value)
 	default:
 		return fmt.Errorf("unsupported time format: %T: %v", value, value)
 	}
@@ -739,6 +782,7 @@ func (qs *QuadStore) Stats(ctx context.Context, exact bool) (graph.Stats, error)
 }
 
 func (qs *QuadStore) Close() error {
+	qs.changes.Close()
 	return qs.db.Close()
 }
 
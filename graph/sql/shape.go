@@ -262,16 +262,73 @@ func (w Where) SQL(b *Builder) string {
 	return strings.Join(parts, " ")
 }
 
+// Join is a LEFT JOIN clause of SQL SELECT query.
+type Join struct {
+	Table Table
+	On    Where
+}
+
+func (j Join) SQL(b *Builder) string {
+	return "LEFT JOIN " + j.Table.SQL(b) + " ON " + j.On.SQL(b)
+}
+
+// OrderBy is a single key of ORDER BY clause.
+type OrderBy struct {
+	// Nodes is an alias of the nodes table joined to the query.
+	// If set, values of the nodes are compared according to their types; see iterator.Sort.
+	Nodes string
+	// Field is compared as is, if Nodes is not set.
+	Field FieldName
+	Desc  bool
+}
+
+// nodeOrderColumns returns expressions that order values of the nodes table in the same way as iterator.Sort does.
+func nodeOrderColumns(b *Builder, tbl string) []string {
+	col := func(name string) string {
+		return tbl + "." + b.EscapeField(name)
+	}
+	kind := "CASE WHEN " + col("hash") + " IS NULL THEN 0" +
+		" WHEN " + col("bnode") + " IS true THEN 1" +
+		" WHEN " + col("iri") + " IS true THEN 2" +
+		" WHEN " + col("value_bool") + " IS NOT NULL THEN 3" +
+		" WHEN " + col("value_int") + " IS NOT NULL OR " + col("value_float") + " IS NOT NULL THEN 4" +
+		" WHEN " + col("value_time") + " IS NOT NULL THEN 5" +
+		" WHEN " + col("value_string") + " IS NOT NULL THEN 6" +
+		" ELSE 7 END"
+	return []string{
+		kind,
+		col("value_bool"),
+		"COALESCE(" + col("value_int") + ", " + col("value_float") + ")",
+		col("value_time"),
+		col("value_string"),
+	}
+}
+
+func (o OrderBy) SQL(b *Builder) string {
+	exprs := []string{o.Field.SQL(b)}
+	if o.Nodes != "" {
+		exprs = nodeOrderColumns(b, o.Nodes)
+	}
+	if o.Desc {
+		for i := range exprs {
+			exprs[i] += " DESC"
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
 var _ Shape = Select{}
 
 // Select is a simplified representation of SQL SELECT query.
 type Select struct {
-	Fields []Field
-	From   []Source
-	Where  []Where
-	Params []Value
-	Limit  int64
-	Offset int64
+	Fields  []Field
+	From    []Source
+	Joins   []Join
+	Where   []Where
+	Params  []Value
+	OrderBy []OrderBy
+	Limit   int64
+	Offset  int64
 
 	// TODO(dennwc): this field in unexported because we don't want it to a be a part of the API
 	//               however, it's necessary to make NodesFrom optimizations to work with SQL
@@ -281,8 +338,10 @@ type Select struct {
 func (s Select) Clone() Select {
 	s.Fields = append([]Field{}, s.Fields...)
 	s.From = append([]Source{}, s.From...)
+	s.Joins = append([]Join{}, s.Joins...)
 	s.Where = append([]Where{}, s.Where...)
 	s.Params = append([]Value{}, s.Params...)
+	s.OrderBy = append([]OrderBy{}, s.OrderBy...)
 	return s
 }
 
@@ -293,7 +352,7 @@ func (s Select) isAll() bool {
 // onlyAsSubquery indicates that query cannot be merged into existing SELECT because of some specific properties of query.
 // An example of such properties might be LIMIT, DISTINCT, etc.
 func (s Select) onlyAsSubquery() bool {
-	return s.Limit > 0 || s.Offset > 0
+	return s.Limit > 0 || s.Offset > 0 || len(s.Joins) != 0 || len(s.OrderBy) != 0
 }
 
 func (s Select) Columns() []string {
@@ -350,6 +409,10 @@ func (s Select) SQL(b *Builder) string {
 	}
 	parts = append(parts, "FROM "+strings.Join(tables, ", "))
 
+	for _, j := range s.Joins {
+		parts = append(parts, j.SQL(b))
+	}
+
 	if len(s.Where) != 0 {
 		var wheres []string
 		for _, w := range s.Where {
@@ -357,6 +420,13 @@ func (s Select) SQL(b *Builder) string {
 		}
 		parts = append(parts, "WHERE "+strings.Join(wheres, " AND "))
 	}
+	if len(s.OrderBy) != 0 {
+		var orders []string
+		for _, o := range s.OrderBy {
+			orders = append(orders, o.SQL(b))
+		}
+		parts = append(parts, "ORDER BY "+strings.Join(orders, ", "))
+	}
 	if s.Limit > 0 {
 		parts = append(parts, "LIMIT "+strconv.FormatInt(s.Limit, 10))
 	}
@@ -380,3 +450,117 @@ func (s Select) Args() []Value {
 	args = append(args, s.Params...)
 	return args
 }
+
+const aggTable = "agg"
+
+var _ Shape = Aggregate{}
+
+// Aggregate is a SQL query that groups results of a SELECT query by tags and calculates aggregates for each group.
+//
+// Each reducer produces multiple columns, because values of different types are stored in separate columns
+// of the nodes table. They are merged into a single value when reading the results.
+type Aggregate struct {
+	From     Select
+	GroupBy  []string
+	Reducers []iterator.Reducer
+}
+
+// reducerColumns returns expressions calculated for a reducer.
+func reducerColumns(r iterator.Reducer, col, tbl string) []string {
+	switch r.Op {
+	case iterator.AggregateCount:
+		return []string{"COUNT(" + col + ")"}
+	case iterator.AggregateSum, iterator.AggregateAvg:
+		return []string{
+			"SUM(" + tbl + ".value_int)", "COUNT(" + tbl + ".value_int)",
+			"SUM(" + tbl + ".value_float)", "COUNT(" + tbl + ".value_float)",
+		}
+	case iterator.AggregateMin, iterator.AggregateMax:
+		fnc := "MIN"
+		if r.Op == iterator.AggregateMax {
+			fnc = "MAX"
+		}
+		return []string{
+			fnc + "(" + tbl + ".value_int)",
+			fnc + "(" + tbl + ".value_float)",
+			fnc + "(" + tbl + ".value_time)",
+		}
+	}
+	return nil
+}
+
+func (s Aggregate) reducerTag(r iterator.Reducer) string {
+	if r.Tag == "" {
+		return tagNode
+	}
+	return r.Tag
+}
+
+func (s Aggregate) Columns() []string {
+	names := append([]string{}, s.GroupBy...)
+	for i, r := range s.Reducers {
+		for j := range reducerColumns(r, "", "") {
+			names = append(names, fmt.Sprintf("%sagg%d_%d", tagPref, i, j))
+		}
+	}
+	return names
+}
+
+func (s Aggregate) SQL(b *Builder) string {
+	cols := s.Columns()
+	var (
+		fields []string
+		groups []string
+		joins  []string
+	)
+	for i, t := range s.GroupBy {
+		name := aggTable + "." + b.EscapeField(t)
+		groups = append(groups, name)
+		fields = append(fields, name+" AS "+b.EscapeField(cols[i]))
+	}
+	// join values of each tag only once
+	tables := make(map[string]string)
+	ci := len(s.GroupBy)
+	for _, r := range s.Reducers {
+		tag := s.reducerTag(r)
+		col := aggTable + "." + b.EscapeField(tag)
+		tbl := ""
+		if r.Op != iterator.AggregateCount {
+			tbl = tables[tag]
+			if tbl == "" {
+				tbl = fmt.Sprintf("v_%d", len(tables))
+				tables[tag] = tbl
+				joins = append(joins, "LEFT JOIN nodes AS "+tbl+" ON "+tbl+".hash = "+col)
+			}
+		}
+		for _, expr := range reducerColumns(r, col, tbl) {
+			fields = append(fields, expr+" AS "+b.EscapeField(cols[ci]))
+			ci++
+		}
+	}
+	parts := []string{
+		"SELECT " + strings.Join(fields, ", "),
+		"FROM " + Subquery{Query: s.From, Alias: aggTable}.SQL(b),
+	}
+	parts = append(parts, joins...)
+	if len(groups) != 0 {
+		parts = append(parts, "GROUP BY "+strings.Join(groups, ", "))
+	}
+	return strings.Join(parts, "\n\t")
+}
+
+func (s Aggregate) Args() []Value {
+	return s.From.Args()
+}
+
+func (s Aggregate) BuildIterator(ctx context.Context, qs graph.QuadStore) iterator.Shape {
+	sq, ok := qs.(*QuadStore)
+	if !ok {
+		return iterator.NewError(fmt.Errorf("not a SQL quadstore: %T", qs))
+	}
+	return sq.newAggregateIterator(s)
+}
+
+func (s Aggregate) Optimize(ctx context.Context, r shape.Optimizer) (shape.Shape, bool, error) {
+	return s, false, nil
+}
@@ -355,6 +355,58 @@ var shapeCases = []struct {
 		qu:   `SELECT t_5.object_hash AS __node FROM quads AS t_5, (SELECT t_3.subject_hash AS __node FROM quads AS t_3, (SELECT t_1.subject_hash AS __node FROM quads AS t_1, (SELECT subject_hash AS __node FROM quads WHERE predicate_hash = $1 AND object_hash = $2) AS t_2 WHERE t_1.predicate_hash = $3 AND t_1.object_hash = t_2.__node) AS t_4 WHERE t_3.predicate_hash = $4 AND t_3.object_hash = t_4.__node) AS t_6 WHERE t_5.predicate_hash = $5 AND t_5.subject_hash = t_6.__node`,
 		args: sVals("n", "k", "a", "s", "s"),
 	},
+	{
+		name: "aggregate",
+		s: shape.Aggregate{
+			From: shape.QuadsAction{
+				Result: quad.Subject,
+				Save: map[quad.Direction][]string{
+					quad.Object: {"dev"},
+				},
+				Filter: map[quad.Direction]graph.Ref{
+					quad.Predicate: sVal("p"),
+				},
+			},
+			GroupBy: []string{"dev"},
+			Reducers: []iterator.Reducer{
+				{Op: iterator.AggregateCount, As: "n"},
+				{Op: iterator.AggregateMax, As: "last"},
+			},
+		},
+		qu: `SELECT agg.dev AS dev, COUNT(agg.__node) AS __agg0_0, MAX(v_0.value_int) AS __agg1_0, MAX(v_0.value_float) AS __agg1_1, MAX(v_0.value_time) AS __agg1_2
+	FROM (SELECT subject_hash AS __node, object_hash AS dev
+	FROM quads
+	WHERE predicate_hash = $1) AS agg
+	LEFT JOIN nodes AS v_0 ON v_0.hash = agg.__node
+	GROUP BY agg.dev`,
+		args: sVals("p"),
+	},
+	{
+		name: "sort by tag",
+		s: shape.Page{
+			Limit: 5,
+			From: shape.Sort{
+				From: shape.QuadsAction{
+					Result: quad.Subject,
+					Save: map[quad.Direction][]string{
+						quad.Object: {"dev"},
+					},
+					Filter: map[quad.Direction]graph.Ref{
+						quad.Predicate: sVal("p"),
+					},
+				},
+				By: []iterator.SortKey{{Tag: "dev", Desc: true}},
+			},
+		},
+		qu: `SELECT t_1.__node AS __node, t_1.dev AS dev
+	FROM (SELECT subject_hash AS __node, object_hash AS dev
+	FROM quads
+	WHERE predicate_hash = $1) AS t_1
+	LEFT JOIN nodes AS t_2 ON t_2.hash = t_1.dev
+	ORDER BY CASE WHEN t_2.hash IS NULL THEN 0 WHEN t_2.bnode IS true THEN 1 WHEN t_2.iri IS true THEN 2 WHEN t_2.value_bool IS NOT NULL THEN 3 WHEN t_2.value_int IS NOT NULL OR t_2.value_float IS NOT NULL THEN 4 WHEN t_2.value_time IS NOT NULL THEN 5 WHEN t_2.value_string IS NOT NULL THEN 6 ELSE 7 END DESC, t_2.value_bool DESC, COALESCE(t_2.value_int, t_2.value_float) DESC, t_2.value_time DESC, t_2.value_string DESC, t_1.__node
+	LIMIT 5`,
+		args: sVals("p"),
+	},
 }
 
 func TestSQLShapes(t *testing.T) {
@@ -0,0 +1,219 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrInvalidCursor is returned by Watcher if the cursor was not issued by the quad store.
+	ErrInvalidCursor = errors.New("graph: invalid cursor")
+	// ErrCursorExpired is returned when changes after the cursor are no longer available.
+	// The consumer should read the whole graph again and watch from an empty cursor.
+	ErrCursorExpired = errors.New("graph: cursor expired")
+)
+
+// DeltaBatch is an ordered set of committed changes.
+type DeltaBatch struct {
+	Deltas []Delta
+	// Cursor is the position right after this batch. It can be passed to Watch later
+	// to resume receiving changes.
+	Cursor string
+}
+
+// Watcher is an optional interface for quad stores that can report committed changes.
+type Watcher interface {
+	// Watch starts a feed of changes committed after the cursor.
+	// An empty cursor starts the feed at the current position.
+	Watch(ctx context.Context, cursor string) (DeltaFeed, error)
+}
+
+// DeltaFeed is a stream of changes returned by Watcher.
+type DeltaFeed interface {
+	// Next waits for the next batch of changes. It returns false if the context is cancelled,
+	// the quad store is closed or an error occurred.
+	Next(ctx context.Context) bool
+	// Batch returns the current batch. Deltas must not be modified by the caller.
+	Batch() DeltaBatch
+	// Err returns an error that stopped the feed, if any.
+	Err() error
+	// Close stops the feed.
+	Close() error
+}
+
+// DefaultChangeLogSize is the default number of deltas retained by ChangeLog.
+const DefaultChangeLogSize = 10000
+
+// ChangeLog is an in-memory history of changes for quad stores that don't keep one.
+// It retains a limited number of recent deltas and implements Watcher on top of them.
+//
+// Cursors carry a random epoch of the log instance, thus cursors issued before a restart are rejected
+// instead of being matched against unrelated batches. Cursor "0" replays all changes, as long as none were
+// dropped from the log yet.
+type ChangeLog struct {
+	limit int
+	epoch string
+
+	mu      sync.Mutex
+	seq     uint64 // position of the last batch
+	batches []changeBatch
+	size    int // number of retained deltas
+	wait    chan struct{}
+	closed  bool
+}
+
+type changeBatch struct {
+	seq    uint64
+	deltas []Delta
+}
+
+// NewChangeLog creates a change log that retains at least limit recent deltas.
+// If limit is not positive, DefaultChangeLogSize is used.
+func NewChangeLog(limit int) *ChangeLog {
+	if limit <= 0 {
+		limit = DefaultChangeLogSize
+	}
+	return &ChangeLog{limit: limit, epoch: strconv.FormatUint(rand.Uint64(), 36)}
+}
+
+func (l *ChangeLog) cursor(seq uint64) string {
+	return l.epoch + "." + strconv.FormatUint(seq, 10)
+}
+
+// Append records a batch of committed changes and wakes up all feeds.
+func (l *ChangeLog) Append(deltas []Delta) {
+	if len(deltas) == 0 {
+		return
+	}
+	deltas = append([]Delta(nil), deltas...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.seq++
+	l.batches = append(l.batches, changeBatch{seq: l.seq, deltas: deltas})
+	l.size += len(deltas)
+	// the last batch is always kept, even if it's larger than the limit
+	for l.size > l.limit && len(l.batches) > 1 {
+		l.size -= len(l.batches[0].deltas)
+		l.batches[0] = changeBatch{}
+		l.batches = l.batches[1:]
+	}
+	l.notify()
+}
+
+// Close stops all feeds of the log.
+func (l *ChangeLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.batches = nil
+	l.size = 0
+	l.notify()
+}
+
+func (l *ChangeLog) notify() {
+	if l.wait != nil {
+		close(l.wait)
+		l.wait = nil
+	}
+}
+
+func (l *ChangeLog) waitChan() <-chan struct{} {
+	if l.wait == nil {
+		l.wait = make(chan struct{})
+	}
+	return l.wait
+}
+
+// Watch implements Watcher.
+func (l *ChangeLog) Watch(ctx context.Context, cursor string) (DeltaFeed, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pos := l.seq
+	if cursor == "0" {
+		// replay the whole history, if it's still retained
+		if len(l.batches) != 0 && l.batches[0].seq != 1 {
+			return nil, ErrCursorExpired
+		}
+		pos = 0
+	} else if cursor != "" {
+		epoch, seq, ok := strings.Cut(cursor, ".")
+		v, err := strconv.ParseUint(seq, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+		}
+		if epoch != l.epoch {
+			// the cursor was issued by another instance of the log, for example before a restart
+			return nil, ErrCursorExpired
+		}
+		if v > l.seq || (v < l.seq && (len(l.batches) == 0 || l.batches[0].seq > v+1)) {
+			// history was trimmed
+			return nil, ErrCursorExpired
+		}
+		pos = v
+	}
+	return &changeFeed{l: l, pos: pos}, nil
+}
+
+type changeFeed struct {
+	l      *ChangeLog
+	pos    uint64
+	cur    DeltaBatch
+	err    error
+	closed bool
+}
+
+func (f *changeFeed) Next(ctx context.Context) bool {
+	if f.closed || f.err != nil {
+		return false
+	}
+	l := f.l
+	for {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return false
+		}
+		if l.seq > f.pos {
+			if len(l.batches) == 0 || l.batches[0].seq > f.pos+1 {
+				l.mu.Unlock()
+				f.err = ErrCursorExpired
+				return false
+			}
+			b := l.batches[f.pos+1-l.batches[0].seq]
+			l.mu.Unlock()
+			f.pos = b.seq
+			f.cur = DeltaBatch{Deltas: b.deltas, Cursor: l.cursor(b.seq)}
+			return true
+		}
+		wait := l.waitChan()
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			f.err = ctx.Err()
+			return false
+		case <-wait:
+		}
+	}
+}
+
+func (f *changeFeed) Batch() DeltaBatch {
+	return f.cur
+}
+
+func (f *changeFeed) Err() error {
+	return f.err
+}
+
+func (f *changeFeed) Close() error {
+	f.closed = true
+	f.cur = DeltaBatch{}
+	return nil
+}
@@ -0,0 +1,42 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+func TestChangeLogCursorEpoch(t *testing.T) {
+	ctx := context.Background()
+	deltas := []graph.Delta{{Action: graph.Add, Quad: quad.MakeIRI("a", "b", "c", "")}}
+
+	l := graph.NewChangeLog(0)
+	feed, err := l.Watch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append(deltas)
+	l.Append(deltas)
+	if !feed.Next(ctx) {
+		t.Fatal(feed.Err())
+	}
+	cursor := feed.Batch().Cursor
+
+	f2, err := l.Watch(ctx, cursor)
+	if err != nil {
+		t.Fatal(err)
+	} else if !f2.Next(ctx) {
+		t.Fatal(f2.Err())
+	}
+
+	// a new log has the same sequence numbers, but must not accept cursors of the old one
+	l2 := graph.NewChangeLog(0)
+	l2.Append(deltas)
+	l2.Append(deltas)
+	if _, err = l2.Watch(ctx, cursor); !errors.Is(err, graph.ErrCursorExpired) {
+		t.Fatalf("expected expired cursor, got: %v", err)
+	}
+}
@@ -41,6 +41,7 @@ type Config struct {
 	ReadOnly bool
 	Timeout  time.Duration
 	Batch    int
+	Parallel int // number of goroutines used by each query
 }
 
 func SetupRoutes(handle *graph.Handle, cfg *Config) error {
@@ -65,6 +66,7 @@ func SetupRoutes(handle *graph.Handle, cfg *Config) error {
 	api2.SetReadOnly(cfg.ReadOnly)
 	api2.SetBatchSize(cfg.Batch)
 	api2.SetQueryTimeout(cfg.Timeout)
+	api2.SetQueryParallel(cfg.Parallel)
 
 	http.Handle("/", CORS(LogRequest(r)))
 
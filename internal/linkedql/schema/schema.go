@@ -32,6 +32,7 @@ var (
 	propertyPath     = reflect.TypeFor[*linkedql.PropertyPath]()
 	stringMap        = reflect.TypeFor[map[string]string]()
 	graphPattern     = reflect.TypeFor[linkedql.GraphPattern]()
+	reducer          = reflect.TypeFor[linkedql.Reducer]()
 )
 
 func typeToRange(t reflect.Type) string {
@@ -65,6 +66,9 @@ func typeToRange(t reflect.Type) string {
 	if t == propertyPath {
 		return linkedql.Prefix + "PropertyPath"
 	}
+	if t == reducer {
+		return linkedql.Prefix + "Reducer"
+	}
 	panic("Unexpected type " + t.String())
 }
 
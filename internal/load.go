@@ -41,7 +41,8 @@ type nopCloser struct {
 
 func (r nopCloser) Close() error { return nil }
 
-func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
+// open opens a file or a URL, and decompresses its content. It returns a nil reader for empty inputs.
+func open(path string) (io.Reader, io.Closer, error) {
 	var (
 		r io.Reader
 		c io.Closer
@@ -56,15 +57,15 @@ func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
 		}
 		f, err := os.Open(path)
 		if os.IsNotExist(err) {
-			return nil, err
+			return nil, nil, err
 		} else if err != nil {
-			return nil, fmt.Errorf("could not open file %q: %v", path, err)
+			return nil, nil, fmt.Errorf("could not open file %q: %v", path, err)
 		}
 		r, c = f, f
 	} else {
 		res, err := http.Get(path)
 		if err != nil {
-			return nil, fmt.Errorf("could not get resource <%s>: %v", u, err)
+			return nil, nil, fmt.Errorf("could not get resource <%s>: %v", u, err)
 		}
 		// TODO(dennwc): save content type for format auto-detection
 		r, c = res.Body, res.Body
@@ -76,9 +77,34 @@ func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
 			c.Close()
 		}
 		if err == io.EOF {
-			return nopCloser{quad.NewReader(nil)}, nil
+			return nil, nil, nil
 		}
+		return nil, nil, err
+	}
+	return r, c, nil
+}
+
+// QuadReaderWith opens a file or a URL, and decodes it with a given function instead of detecting a format.
+func QuadReaderWith(path string, newReader func(r io.Reader) quad.ReadCloser) (quad.ReadCloser, error) {
+	r, c, err := open(path)
+	if err != nil {
 		return nil, err
+	} else if r == nil {
+		return nopCloser{quad.NewReader(nil)}, nil
+	}
+	qr := newReader(r)
+	if c != nil {
+		return readCloser{ReadCloser: qr, close: c.Close}, nil
+	}
+	return qr, nil
+}
+
+func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
+	r, c, err := open(path)
+	if err != nil {
+		return nil, err
+	} else if r == nil {
+		return nopCloser{quad.NewReader(nil)}, nil
 	}
 
 	var qr quad.ReadCloser
@@ -129,9 +155,24 @@ func DecompressAndLoad(ctx context.Context, qw quad.WriteCloser, batch int, path
 	if err != nil {
 		return err
 	}
-	defer qr.Close()
+	return load(ctx, qw, batch, qr)
+}
 
-	_, err = quad.CopyBatch(ctx, &batchLogger{w: qw}, qr, batch)
+// LoadWith is like Load, but decodes the file with a given function instead of detecting a format.
+func LoadWith(ctx context.Context, qw quad.WriteCloser, batch int, path string, newReader func(r io.Reader) quad.ReadCloser) error {
+	if path == "" {
+		return nil
+	}
+	qr, err := QuadReaderWith(path, newReader)
+	if err != nil {
+		return err
+	}
+	return load(ctx, qw, batch, qr)
+}
+
+func load(ctx context.Context, qw quad.WriteCloser, batch int, qr quad.ReadCloser) error {
+	defer qr.Close()
+	_, err := quad.CopyBatch(ctx, &batchLogger{w: qw}, qr, batch)
 	if err != nil {
 		return fmt.Errorf("db: failed to load data: %v", err)
 	}
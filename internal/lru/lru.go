@@ -22,16 +22,21 @@ import (
 // TODO(kortschak) Reimplement without container/list.
 
 // Cache implements an LRU cache.
+//
+// The cache is bounded either by the number of values, or by the total size of values.
 type Cache struct {
 	mu       sync.Mutex
 	cache    map[string]*list.Element
 	priority *list.List
 	maxSize  int
+	maxBytes int64
+	bytes    int64
 }
 
 type kv struct {
 	key   string
 	value any
+	size  int64
 }
 
 func New(size int) *Cache {
@@ -42,19 +47,46 @@ func New(size int) *Cache {
 	}
 }
 
+// NewSized creates a cache that keeps values with a total size of at most maxBytes.
+// Sizes of values are reported to PutSized.
+func NewSized(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		priority: list.New(),
+		cache:    make(map[string]*list.Element),
+	}
+}
+
 func (lru *Cache) Put(key string, value any) {
+	lru.PutSized(key, value, 0)
+}
+
+// PutSized adds a value of a given size to the cache and evicts the least recently used values
+// to stay within the size bound. Values larger than the bound are not added.
+func (lru *Cache) PutSized(key string, value any, size int64) {
 	if _, ok := lru.Get(key); ok {
 		return
 	}
 
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
-	if len(lru.cache) == lru.maxSize {
-		last := lru.priority.Remove(lru.priority.Back())
-		delete(lru.cache, last.(kv).key)
+	if lru.maxBytes > 0 && size > lru.maxBytes {
+		return
 	}
-	lru.priority.PushFront(kv{key: key, value: value})
+	for lru.priority.Len() != 0 &&
+		((lru.maxSize > 0 && len(lru.cache) >= lru.maxSize) ||
+			(lru.maxBytes > 0 && lru.bytes+size > lru.maxBytes)) {
+		lru.remove(lru.priority.Back())
+	}
+	lru.priority.PushFront(kv{key: key, value: value, size: size})
 	lru.cache[key] = lru.priority.Front()
+	lru.bytes += size
+}
+
+func (lru *Cache) remove(e *list.Element) {
+	v := lru.priority.Remove(e).(kv)
+	delete(lru.cache, v.key)
+	lru.bytes -= v.size
 }
 
 func (lru *Cache) Del(key string) {
@@ -64,8 +96,7 @@ func (lru *Cache) Del(key string) {
 	if e == nil {
 		return
 	}
-	delete(lru.cache, key)
-	lru.priority.Remove(e)
+	lru.remove(e)
 }
 
 func (lru *Cache) Get(key string) (any, bool) {
@@ -77,3 +108,26 @@ func (lru *Cache) Get(key string) (any, bool) {
 	}
 	return nil, false
 }
+
+// Purge removes all values from the cache.
+func (lru *Cache) Purge() {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.priority.Init()
+	clear(lru.cache)
+	lru.bytes = 0
+}
+
+// Len returns the number of values in the cache.
+func (lru *Cache) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return len(lru.cache)
+}
+
+// Size returns the total size of values in the cache.
+func (lru *Cache) Size() int64 {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.bytes
+}
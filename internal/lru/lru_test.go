@@ -36,3 +36,32 @@ func TestPanicLRUCache(t *testing.T) {
 		<-xch
 	}
 }
+
+func TestSizedLRUCache(t *testing.T) {
+	c := NewSized(10)
+	c.PutSized("a", 1, 4)
+	c.PutSized("b", 2, 4)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a value")
+	}
+	// b is the least recently used value now
+	c.PutSized("c", 3, 4)
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	if n, size := c.Len(), c.Size(); n != 2 || size != 8 {
+		t.Fatalf("unexpected size: %d values, %d bytes", n, size)
+	}
+	c.PutSized("d", 4, 11)
+	if _, ok := c.Get("d"); ok {
+		t.Fatal("expected a large value to be skipped")
+	}
+	c.Del("a")
+	if size := c.Size(); size != 4 {
+		t.Fatalf("unexpected size after delete: %d", size)
+	}
+	c.Purge()
+	if n, size := c.Len(), c.Size(); n != 0 || size != 0 {
+		t.Fatalf("unexpected size after purge: %d values, %d bytes", n, size)
+	}
+}
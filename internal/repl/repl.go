@@ -16,6 +16,7 @@ package repl
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -81,6 +82,24 @@ func Run(ctx context.Context, qu string, ses query.REPLSession) error {
 	return nil
 }
 
+// Explain prints execution plans of a query. If analyze is set, the query is executed and profiled.
+func Explain(ctx context.Context, qu string, ses query.REPLSession, analyze bool) error {
+	exp, err := query.Explain(ctx, ses, qu, query.Options{
+		Collation: query.REPL,
+		Limit:     100,
+		Analyze:   analyze,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(exp, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", data)
+	return nil
+}
+
 const (
 	defaultLanguage = "gizmo"
 
@@ -194,8 +213,22 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 				}
 				continue
 
+			case ":explain":
+				qu := strings.TrimSpace(args)
+				analyze := false
+				if rest, ok := strings.CutPrefix(qu, "analyze "); ok {
+					qu, analyze = strings.TrimSpace(rest), true
+				}
+				nctx, cancel := newCtx()
+				err = Explain(nctx, qu, ses, analyze)
+				cancel()
+				if err != nil {
+					fmt.Println("Error: ", err)
+				}
+				continue
+
 			case "help":
-				fmt.Printf("Help\n\texit // Exit\n\thelp // this help\n\td: <quad> // delete quad\n\ta: <quad> // add quad\n\t:debug [t|f]\n")
+				fmt.Printf("Help\n\texit // Exit\n\thelp // this help\n\td: <quad> // delete quad\n\ta: <quad> // add quad\n\t:debug [t|f]\n\t:explain [analyze] <query> // show query plan\n")
 				continue
 
 			case "exit":
@@ -40,7 +40,10 @@ func init() {
 	})
 }
 
-var _ kv.KV = (*DB)(nil)
+var (
+	_ kv.KV          = (*DB)(nil)
+	_ kv.Snapshotter = (*DB)(nil)
+)
 
 func New(d *bolt.DB) *DB {
 	return &DB{db: d}
@@ -92,6 +95,31 @@ func (db *DB) Update(ctx context.Context, fn func(tx kv.Tx) error) error {
 	return kv.Update(ctx, db, fn)
 }
 
+// Snapshot implements kv.Snapshotter. All buckets are read from a single read-only transaction,
+// thus it doesn't block writers.
+func (db *DB) Snapshot(ctx context.Context, fn func(k kv.Key, v kv.Value) error) error {
+	return db.db.View(func(btx *bolt.Tx) error {
+		tx := &Tx{tx: btx}
+		return snapshotBucket(ctx, tx.root(), nil, fn)
+	})
+}
+
+func snapshotBucket(ctx context.Context, b *bolt.Bucket, pref kv.Key, fn func(k kv.Key, v kv.Value) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key := append(pref[:len(pref):len(pref)], nil)
+	return b.ForEach(func(k, v []byte) error {
+		key[len(key)-1] = k
+		if v == nil {
+			if sub := b.Bucket(k); sub != nil {
+				return snapshotBucket(ctx, sub, key, fn)
+			}
+		}
+		return fn(key, v)
+	})
+}
+
 type Tx struct {
 	tx *bolt.Tx
 }
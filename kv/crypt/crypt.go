@@ -0,0 +1,306 @@
+// Package crypt provides a middleware that encrypts data stored in key-value databases.
+//
+// Values are encrypted with AES-GCM using a random nonce. Keys can optionally be encrypted as well.
+// Key encryption is deterministic and preserves prefixes of keys, thus prefix scans still work,
+// but keys sharing a prefix in the plaintext share a prefix in the ciphertext as well.
+// The order of keys is not preserved.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/flat"
+	"github.com/aperturerobotics/cayley/kv/options"
+)
+
+var (
+	// ErrDecrypt is returned when a value cannot be decrypted: it was either encrypted with a different key,
+	// was not encrypted at all or was corrupted.
+	ErrDecrypt = errors.New("crypt: cannot decrypt the value")
+	// ErrUnknownKey is returned when a value was encrypted with a key that is not known to the Cipher.
+	ErrUnknownKey = errors.New("crypt: value is encrypted with an unknown key")
+)
+
+var _ options.Wrapper = (*Cipher)(nil)
+
+const (
+	formatVersion = 1
+	keyIDSize     = 4
+	// header is version, key ID and a nonce
+	headerSize = 1 + keyIDSize + 12
+)
+
+// Options for creating a Cipher.
+type Options struct {
+	// EncryptKeys enables deterministic encryption of keys.
+	EncryptKeys bool
+	// OldKeys are used only for decrypting values that were encrypted before the key rotation.
+	// They cannot be used for decrypting keys.
+	OldKeys [][]byte
+}
+
+// Cipher encrypts keys and values of the database. It implements options.Wrapper.
+type Cipher struct {
+	cur  *secret
+	old  []*secret
+	keys bool
+}
+
+type secret struct {
+	id   [keyIDSize]byte
+	aead cipher.AEAD
+	// block for key encryption
+	kblock cipher.Block
+}
+
+// derive returns a subkey of the master key for a given purpose.
+func derive(key []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("cayley/kv/crypt: " + purpose))
+	return h.Sum(nil)
+}
+
+func validKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+func newSecret(key []byte) (*secret, error) {
+	if !validKeySize(len(key)) {
+		return nil, fmt.Errorf("crypt: invalid key size %d, expected 16, 24 or 32 bytes", len(key))
+	}
+	var s secret
+	copy(s.id[:], derive(key, "id"))
+	vb, err := aes.NewCipher(derive(key, "values")[:len(key)])
+	if err != nil {
+		return nil, err
+	}
+	if s.aead, err = cipher.NewGCM(vb); err != nil {
+		return nil, err
+	}
+	if s.kblock, err = aes.NewCipher(derive(key, "keys")[:len(key)]); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// New creates a Cipher from an AES key. The key must be 16, 24 or 32 bytes long. Options may be nil.
+func New(key []byte, opt *Options) (*Cipher, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+	cur, err := newSecret(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cipher{cur: cur, keys: opt.EncryptKeys}
+	for _, k := range opt.OldKeys {
+		s, err := newSecret(k)
+		if err != nil {
+			return nil, err
+		}
+		c.old = append(c.old, s)
+	}
+	return c, nil
+}
+
+// ParseKey decodes a key from a hex or base64 string.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(s); err == nil {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("crypt: key must be encoded in hex or base64")
+}
+
+// ReadKeyFile reads a key from a file. The file may either contain a raw key or a key encoded in hex or base64.
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := ParseKey(string(data)); err == nil && validKeySize(len(key)) {
+		return key, nil
+	} else if validKeySize(len(data)) {
+		return data, nil
+	}
+	return nil, fmt.Errorf("crypt: no valid key in %q", path)
+}
+
+// EncryptsKeys reports if the Cipher encrypts keys.
+func (c *Cipher) EncryptsKeys() bool {
+	return c.keys
+}
+
+// secretFor returns a secret that was used to encrypt the value.
+func (c *Cipher) secretFor(v []byte) (*secret, error) {
+	if len(v) < headerSize+c.cur.aead.Overhead() || v[0] != formatVersion {
+		return nil, ErrDecrypt
+	}
+	id := v[1 : 1+keyIDSize]
+	if bytes.Equal(id, c.cur.id[:]) {
+		return c.cur, nil
+	}
+	for _, s := range c.old {
+		if bytes.Equal(id, s.id[:]) {
+			return s, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// isCurrent checks if the value is encrypted with the current key.
+func (c *Cipher) isCurrent(v []byte) bool {
+	return len(v) >= headerSize && v[0] == formatVersion && bytes.Equal(v[1:1+keyIDSize], c.cur.id[:])
+}
+
+// seal encrypts the value. The key is authenticated together with the value,
+// thus encrypted values cannot be moved to a different key.
+func (c *Cipher) seal(key, v []byte) ([]byte, error) {
+	s := c.cur
+	out := make([]byte, headerSize, headerSize+len(v)+s.aead.Overhead())
+	out[0] = formatVersion
+	copy(out[1:], s.id[:])
+	nonce := out[1+keyIDSize : headerSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(out, nonce, v, key), nil
+}
+
+func (c *Cipher) open(key, v []byte) ([]byte, error) {
+	s, err := c.secretFor(v)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.aead.Open(nil, v[1+keyIDSize:headerSize], v[headerSize:], key)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return out, nil
+}
+
+// keyAD encodes a hierarchical key for authenticating values.
+func keyAD(k kv.Key) []byte {
+	var buf []byte
+	for _, p := range k {
+		buf = binary.AppendUvarint(buf, uint64(len(p)))
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+// keyStream is a prefix-preserving deterministic cipher for keys.
+//
+// Each byte is masked with a pad derived from all the preceding bytes of the key, thus the same
+// prefix is always encrypted the same way. Boundaries of key parts are mixed into the state as well.
+type keyStream struct {
+	b     cipher.Block
+	state [aes.BlockSize]byte
+}
+
+const (
+	mixByte = 1
+	mixPart = 2
+	// padByte is a byte of the state used to mask the next byte of the key
+	padByte = aes.BlockSize - 1
+)
+
+func newKeyStream(b cipher.Block) *keyStream {
+	s := &keyStream{b: b}
+	b.Encrypt(s.state[:], s.state[:])
+	return s
+}
+
+func (s *keyStream) mix(typ, p byte) {
+	s.state[0] ^= typ
+	s.state[1] ^= p
+	s.b.Encrypt(s.state[:], s.state[:])
+}
+
+func (s *keyStream) encrypt(dst, src []byte) {
+	for i, p := range src {
+		dst[i] = p ^ s.state[padByte]
+		s.mix(mixByte, p)
+	}
+}
+
+func (s *keyStream) decrypt(dst, src []byte) {
+	for i, c := range src {
+		p := c ^ s.state[padByte]
+		dst[i] = p
+		s.mix(mixByte, p)
+	}
+}
+
+func (s *keyStream) endPart() {
+	s.mix(mixPart, 0)
+}
+
+// encryptFlat encrypts a flat key. Nil key is preserved.
+func (c *Cipher) encryptFlat(k flat.Key) flat.Key {
+	if !c.keys || k == nil {
+		return k
+	}
+	out := make(flat.Key, len(k))
+	newKeyStream(c.cur.kblock).encrypt(out, k)
+	return out
+}
+
+func (c *Cipher) decryptFlat(k flat.Key) flat.Key {
+	if !c.keys || k == nil {
+		return k
+	}
+	out := make(flat.Key, len(k))
+	newKeyStream(c.cur.kblock).decrypt(out, k)
+	return out
+}
+
+// encryptKV encrypts each part of a hierarchical key. Since the last part might be a prefix,
+// its boundary is not mixed into the state.
+func (c *Cipher) encryptKV(k kv.Key) kv.Key {
+	if !c.keys || k == nil {
+		return k
+	}
+	s := newKeyStream(c.cur.kblock)
+	out := make(kv.Key, len(k))
+	for i, p := range k {
+		if i != 0 {
+			s.endPart()
+		}
+		out[i] = make([]byte, len(p))
+		s.encrypt(out[i], p)
+	}
+	return out
+}
+
+func (c *Cipher) decryptKV(k kv.Key) kv.Key {
+	if !c.keys || k == nil {
+		return k
+	}
+	s := newKeyStream(c.cur.kblock)
+	out := make(kv.Key, len(k))
+	for i, p := range k {
+		if i != 0 {
+			s.endPart()
+		}
+		out[i] = make([]byte, len(p))
+		s.decrypt(out[i], p)
+	}
+	return out
+}
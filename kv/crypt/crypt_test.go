@@ -0,0 +1,132 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/flat"
+	"github.com/aperturerobotics/cayley/kv/flat/btree"
+	"github.com/aperturerobotics/cayley/kv/kvtest"
+	"github.com/aperturerobotics/cayley/kv/options"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func newCipher(t testing.TB, key []byte, opt *Options) *Cipher {
+	c, err := New(key, opt)
+	require.NoError(t, err)
+	return c
+}
+
+func TestWrapKV(t *testing.T) {
+	kvtest.RunTest(t, func(t testing.TB) kv.KV {
+		return newCipher(t, testKey1, nil).WrapKV(flat.Upgrade(btree.New()))
+	}, &kvtest.Options{
+		NoLocks: true,
+		NoTx:    true,
+	})
+}
+
+func TestWrapFlat(t *testing.T) {
+	kvtest.RunTest(t, func(t testing.TB) kv.KV {
+		return flat.Upgrade(newCipher(t, testKey1, nil).WrapFlat(btree.New()))
+	}, &kvtest.Options{
+		NoLocks: true,
+		NoTx:    true,
+	})
+}
+
+// rawPairs returns all pairs stored in the underlying database.
+func rawPairs(t testing.TB, db kv.KV) []kv.Pair {
+	ctx := context.Background()
+	var out []kv.Pair
+	err := kv.View(ctx, db, func(tx kv.Tx) error {
+		return kv.Each(ctx, tx, func(k kv.Key, v kv.Value) error {
+			out = append(out, kv.Pair{Key: k.Clone(), Val: v.Clone()})
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	return out
+}
+
+func TestEncryptKeys(t *testing.T) {
+	ctx := context.Background()
+	raw := flat.Upgrade(btree.New())
+	db := newCipher(t, testKey1, &Options{EncryptKeys: true}).WrapKV(raw)
+	td := kvtest.NewTest(t, db)
+
+	keys := []kv.Key{
+		kv.SKey("a"),
+		kv.SKey("b", "1:2"),
+		kv.SKey("b", "1:3"),
+		kv.SKey("b", "2:1"),
+		kv.SKey("c", "1:2"),
+	}
+	for _, k := range keys {
+		td.Put(k, kv.Value("secret "+string(bytes.Join(k, nil))))
+	}
+	for _, p := range rawPairs(t, raw) {
+		for _, part := range p.Key {
+			require.NotContains(t, string(part), ":")
+		}
+		require.NotContains(t, string(p.Val), "secret")
+	}
+	td.Expect(keys[1], kv.Value("secret b1:2"))
+
+	var got []string
+	err := kv.View(ctx, db, func(tx kv.Tx) error {
+		return kv.Each(ctx, tx, func(k kv.Key, v kv.Value) error {
+			got = append(got, string(v))
+			return nil
+		}, options.WithPrefixKV(kv.SKey("b", "1:")))
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"secret b1:2", "secret b1:3"}, got)
+
+	// the same data is not readable with a different key
+	other := newCipher(t, testKey2, &Options{EncryptKeys: true}).WrapKV(raw)
+	_, err = kvtest.NewTest(t, other).Get(keys[0])
+	require.Equal(t, kv.ErrNotFound, err)
+}
+
+func TestReencrypt(t *testing.T) {
+	ctx := context.Background()
+	for _, keys := range []bool{false, true} {
+		raw := flat.Upgrade(btree.New())
+		c1 := newCipher(t, testKey1, &Options{EncryptKeys: keys})
+		c2 := newCipher(t, testKey2, &Options{EncryptKeys: keys, OldKeys: [][]byte{testKey1}})
+
+		var all []kv.Pair
+		td := kvtest.NewTest(t, c1.WrapKV(raw))
+		for i := range 2*reencryptBatch + 10 {
+			p := kv.Pair{Key: kv.SKey("b", string(rune('a'+i%20)), string(rune(i))), Val: kv.Value{byte(i)}}
+			td.Put(p.Key, p.Val)
+			all = append(all, p)
+		}
+
+		n, err := Reencrypt(ctx, raw, c1, c2)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(all)), n)
+		require.Len(t, rawPairs(t, raw), len(all))
+
+		td = kvtest.NewTest(t, c2.WrapKV(raw))
+		for _, p := range all {
+			td.Expect(p.Key, p.Val)
+		}
+		_, err = kvtest.NewTest(t, c1.WrapKV(raw)).Get(all[0].Key)
+		require.Error(t, err)
+
+		// restarting is a no-op
+		n, err = Reencrypt(ctx, raw, c1, c2)
+		require.NoError(t, err)
+		require.Zero(t, n)
+	}
+}
@@ -0,0 +1,182 @@
+package crypt
+
+import (
+	"context"
+
+	"github.com/aperturerobotics/cayley/kv/flat"
+	"github.com/aperturerobotics/cayley/kv/options"
+)
+
+// WrapFlat implements options.Wrapper. Values are authenticated together with their keys.
+func (c *Cipher) WrapFlat(db flat.KV) flat.KV {
+	return &cryptFlat{db: db, c: c}
+}
+
+type cryptFlat struct {
+	db flat.KV
+	c  *Cipher
+}
+
+func (db *cryptFlat) Close() error {
+	return db.db.Close()
+}
+
+// ConcurrentWrites implements flat.ConcurrentWriter.
+func (db *cryptFlat) ConcurrentWrites() bool {
+	c, ok := db.db.(flat.ConcurrentWriter)
+	return ok && c.ConcurrentWrites()
+}
+
+func (db *cryptFlat) Tx(ctx context.Context, rw bool) (flat.Tx, error) {
+	tx, err := db.db.Tx(ctx, rw)
+	if err != nil {
+		return nil, err
+	}
+	return &cryptFlatTx{tx: tx, c: db.c}, nil
+}
+
+func (db *cryptFlat) View(ctx context.Context, fn func(tx flat.Tx) error) error {
+	return flat.View(ctx, db, fn)
+}
+
+func (db *cryptFlat) Update(ctx context.Context, fn func(tx flat.Tx) error) error {
+	return flat.Update(ctx, db, fn)
+}
+
+type cryptFlatTx struct {
+	tx flat.Tx
+	c  *Cipher
+}
+
+func (tx *cryptFlatTx) Commit(ctx context.Context) error {
+	return tx.tx.Commit(ctx)
+}
+
+func (tx *cryptFlatTx) Close() error {
+	return tx.tx.Close()
+}
+
+func (tx *cryptFlatTx) Get(ctx context.Context, key flat.Key) (flat.Value, error) {
+	v, err := tx.tx.Get(ctx, tx.c.encryptFlat(key))
+	if err != nil {
+		return nil, err
+	}
+	return tx.c.open(key, v)
+}
+
+func (tx *cryptFlatTx) GetBatch(ctx context.Context, keys []flat.Key) ([]flat.Value, error) {
+	ekeys := keys
+	if tx.c.keys {
+		ekeys = make([]flat.Key, len(keys))
+		for i, k := range keys {
+			ekeys[i] = tx.c.encryptFlat(k)
+		}
+	}
+	vals, err := tx.tx.GetBatch(ctx, ekeys)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if v == nil {
+			continue
+		}
+		if vals[i], err = tx.c.open(keys[i], v); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (tx *cryptFlatTx) Put(ctx context.Context, k flat.Key, v flat.Value) error {
+	ev, err := tx.c.seal(k, v)
+	if err != nil {
+		return err
+	}
+	return tx.tx.Put(ctx, tx.c.encryptFlat(k), ev)
+}
+
+func (tx *cryptFlatTx) Del(ctx context.Context, k flat.Key) error {
+	return tx.tx.Del(ctx, tx.c.encryptFlat(k))
+}
+
+func (tx *cryptFlatTx) Scan(ctx context.Context, opts ...flat.IteratorOption) flat.Iterator {
+	var it flat.Iterator = &cryptFlatIterator{base: tx.tx.Scan(ctx), c: tx.c}
+	return flat.ApplyIteratorOptions(it, opts)
+}
+
+var (
+	_ flat.Seeker         = &cryptFlatIterator{}
+	_ flat.PrefixIterator = &cryptFlatIterator{}
+)
+
+// cryptFlatIterator decrypts keys and values of the underlying iterator.
+// If keys are encrypted, iteration and seeking follows the order of encrypted keys.
+type cryptFlatIterator struct {
+	base flat.Iterator
+	c    *Cipher
+	key  flat.Key
+	val  flat.Value
+	err  error
+}
+
+func (it *cryptFlatIterator) reset() {
+	it.key, it.val = nil, nil
+}
+
+func (it *cryptFlatIterator) Reset() {
+	it.base.Reset()
+	it.reset()
+}
+
+func (it *cryptFlatIterator) WithPrefix(pref flat.Key) flat.Iterator {
+	it.base = options.WithPrefixFlat(it.c.encryptFlat(pref)).ApplyFlat(it.base)
+	it.reset()
+	return it
+}
+
+func (it *cryptFlatIterator) Seek(ctx context.Context, key flat.Key) bool {
+	it.reset()
+	return flat.Seek(ctx, it.base, it.c.encryptFlat(key))
+}
+
+func (it *cryptFlatIterator) Next(ctx context.Context) bool {
+	it.reset()
+	if it.err != nil {
+		return false
+	}
+	return it.base.Next(ctx)
+}
+
+func (it *cryptFlatIterator) Key() flat.Key {
+	if it.key == nil {
+		it.key = it.c.decryptFlat(it.base.Key())
+	}
+	return it.key
+}
+
+func (it *cryptFlatIterator) Val() flat.Value {
+	if it.val != nil || it.err != nil {
+		return it.val
+	}
+	v := it.base.Val()
+	if v == nil {
+		return nil
+	}
+	it.val, it.err = it.c.open(it.Key(), v)
+	return it.val
+}
+
+func (it *cryptFlatIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.base.Err()
+}
+
+func (it *cryptFlatIterator) Close() error {
+	err := it.base.Close()
+	if it.err != nil {
+		return it.err
+	}
+	return err
+}
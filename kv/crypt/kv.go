@@ -0,0 +1,182 @@
+package crypt
+
+import (
+	"context"
+
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/options"
+)
+
+// WrapKV implements options.Wrapper. Values are authenticated together with their keys.
+func (c *Cipher) WrapKV(db kv.KV) kv.KV {
+	return &cryptKV{db: db, c: c}
+}
+
+type cryptKV struct {
+	db kv.KV
+	c  *Cipher
+}
+
+func (db *cryptKV) Close() error {
+	return db.db.Close()
+}
+
+// ConcurrentWrites implements kv.ConcurrentWriter.
+func (db *cryptKV) ConcurrentWrites() bool {
+	c, ok := db.db.(kv.ConcurrentWriter)
+	return ok && c.ConcurrentWrites()
+}
+
+func (db *cryptKV) Tx(ctx context.Context, rw bool) (kv.Tx, error) {
+	tx, err := db.db.Tx(ctx, rw)
+	if err != nil {
+		return nil, err
+	}
+	return &cryptTx{tx: tx, c: db.c}, nil
+}
+
+func (db *cryptKV) View(ctx context.Context, fn func(tx kv.Tx) error) error {
+	return kv.View(ctx, db, fn)
+}
+
+func (db *cryptKV) Update(ctx context.Context, fn func(tx kv.Tx) error) error {
+	return kv.Update(ctx, db, fn)
+}
+
+type cryptTx struct {
+	tx kv.Tx
+	c  *Cipher
+}
+
+func (tx *cryptTx) Commit(ctx context.Context) error {
+	return tx.tx.Commit(ctx)
+}
+
+func (tx *cryptTx) Close() error {
+	return tx.tx.Close()
+}
+
+func (tx *cryptTx) Get(ctx context.Context, key kv.Key) (kv.Value, error) {
+	v, err := tx.tx.Get(ctx, tx.c.encryptKV(key))
+	if err != nil {
+		return nil, err
+	}
+	return tx.c.open(keyAD(key), v)
+}
+
+func (tx *cryptTx) GetBatch(ctx context.Context, keys []kv.Key) ([]kv.Value, error) {
+	ekeys := keys
+	if tx.c.keys {
+		ekeys = make([]kv.Key, len(keys))
+		for i, k := range keys {
+			ekeys[i] = tx.c.encryptKV(k)
+		}
+	}
+	vals, err := tx.tx.GetBatch(ctx, ekeys)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if v == nil {
+			continue
+		}
+		if vals[i], err = tx.c.open(keyAD(keys[i]), v); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (tx *cryptTx) Put(ctx context.Context, k kv.Key, v kv.Value) error {
+	ev, err := tx.c.seal(keyAD(k), v)
+	if err != nil {
+		return err
+	}
+	return tx.tx.Put(ctx, tx.c.encryptKV(k), ev)
+}
+
+func (tx *cryptTx) Del(ctx context.Context, k kv.Key) error {
+	return tx.tx.Del(ctx, tx.c.encryptKV(k))
+}
+
+func (tx *cryptTx) Scan(ctx context.Context, opts ...kv.IteratorOption) kv.Iterator {
+	var it kv.Iterator = &cryptIterator{base: tx.tx.Scan(ctx), c: tx.c}
+	return kv.ApplyIteratorOptions(it, opts)
+}
+
+var (
+	_ kv.Seeker         = &cryptIterator{}
+	_ kv.PrefixIterator = &cryptIterator{}
+)
+
+// cryptIterator decrypts keys and values of the underlying iterator.
+// If keys are encrypted, iteration and seeking follows the order of encrypted keys.
+type cryptIterator struct {
+	base kv.Iterator
+	c    *Cipher
+	key  kv.Key
+	val  kv.Value
+	err  error
+}
+
+func (it *cryptIterator) reset() {
+	it.key, it.val = nil, nil
+}
+
+func (it *cryptIterator) Reset() {
+	it.base.Reset()
+	it.reset()
+}
+
+func (it *cryptIterator) WithPrefix(pref kv.Key) kv.Iterator {
+	it.base = options.WithPrefixKV(it.c.encryptKV(pref)).ApplyKV(it.base)
+	it.reset()
+	return it
+}
+
+func (it *cryptIterator) Seek(ctx context.Context, key kv.Key) bool {
+	it.reset()
+	return kv.Seek(ctx, it.base, it.c.encryptKV(key))
+}
+
+func (it *cryptIterator) Next(ctx context.Context) bool {
+	it.reset()
+	if it.err != nil {
+		return false
+	}
+	return it.base.Next(ctx)
+}
+
+func (it *cryptIterator) Key() kv.Key {
+	if it.key == nil {
+		it.key = it.c.decryptKV(it.base.Key())
+	}
+	return it.key
+}
+
+func (it *cryptIterator) Val() kv.Value {
+	if it.val != nil || it.err != nil {
+		return it.val
+	}
+	v := it.base.Val()
+	if v == nil {
+		return nil
+	}
+	it.val, it.err = it.c.open(keyAD(it.Key()), v)
+	return it.val
+}
+
+func (it *cryptIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.base.Err()
+}
+
+func (it *cryptIterator) Close() error {
+	err := it.base.Close()
+	if it.err != nil {
+		return it.err
+	}
+	return err
+}
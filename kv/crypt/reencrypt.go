@@ -0,0 +1,159 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/flat"
+)
+
+// reencryptBatch is the maximal number of pairs re-encrypted in a single transaction.
+const reencryptBatch = 1000
+
+// Reencrypt re-encrypts all the data of a raw database that was encrypted by the from Cipher, using the to Cipher.
+// The database must not be used while the process runs. If it is interrupted, it can be restarted
+// with the same arguments; pairs that were already re-encrypted are skipped.
+//
+// Ciphers must agree on key encryption. Only the current key of the from Cipher is used.
+// It returns the number of re-encrypted pairs.
+func Reencrypt(ctx context.Context, db kv.KV, from, to *Cipher) (int64, error) {
+	var n int64
+	if from.keys != to.keys {
+		return n, errors.New("crypt: ciphers must either both encrypt keys or not")
+	}
+	var last kv.Key
+	for {
+		type pair struct {
+			old kv.Key
+			kv.Pair
+		}
+		var batch []pair
+		err := kv.View(ctx, db, func(tx kv.Tx) error {
+			it := tx.Scan(ctx)
+			defer it.Close()
+			var ok bool
+			if last == nil {
+				ok = it.Next(ctx)
+			} else {
+				ok = kv.Seek(ctx, it, last)
+				if ok && it.Key().Compare(last) == 0 {
+					ok = it.Next(ctx)
+				}
+			}
+			for ; ok && len(batch) < reencryptBatch; ok = it.Next(ctx) {
+				k, v := it.Key(), it.Val()
+				last = k.Clone()
+				if to.isCurrent(v) {
+					continue
+				}
+				pk := from.decryptKV(k)
+				pv, err := from.open(keyAD(pk), v)
+				if err != nil {
+					return fmt.Errorf("key %q: %w", pk, err)
+				}
+				nv, err := to.seal(keyAD(pk), pv)
+				if err != nil {
+					return err
+				}
+				batch = append(batch, pair{old: last, Pair: kv.Pair{Key: to.encryptKV(pk), Val: nv}})
+			}
+			return it.Err()
+		})
+		if err != nil {
+			return n, err
+		}
+		if len(batch) == 0 {
+			return n, nil
+		}
+		err = kv.Update(ctx, db, func(tx kv.Tx) error {
+			for _, p := range batch {
+				if p.old.Compare(p.Key) != 0 {
+					if err := tx.Del(ctx, p.old); err != nil {
+						return err
+					}
+				}
+				if err := tx.Put(ctx, p.Key, p.Val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		n += int64(len(batch))
+	}
+}
+
+// ReencryptFlat is like Reencrypt, but for flat databases wrapped with WrapFlat.
+func ReencryptFlat(ctx context.Context, db flat.KV, from, to *Cipher) (int64, error) {
+	var n int64
+	if from.keys != to.keys {
+		return n, errors.New("crypt: ciphers must either both encrypt keys or not")
+	}
+	var last flat.Key
+	for {
+		type pair struct {
+			old flat.Key
+			flat.Pair
+		}
+		var batch []pair
+		err := flat.View(ctx, db, func(tx flat.Tx) error {
+			it := tx.Scan(ctx)
+			defer it.Close()
+			var ok bool
+			if last == nil {
+				ok = it.Next(ctx)
+			} else {
+				ok = flat.Seek(ctx, it, last)
+				if ok && bytes.Equal(it.Key(), last) {
+					ok = it.Next(ctx)
+				}
+			}
+			for ; ok && len(batch) < reencryptBatch; ok = it.Next(ctx) {
+				k, v := it.Key(), it.Val()
+				last = k.Clone()
+				if to.isCurrent(v) {
+					continue
+				}
+				pk := from.decryptFlat(k)
+				pv, err := from.open(pk, v)
+				if err != nil {
+					return fmt.Errorf("key %q: %w", pk, err)
+				}
+				nv, err := to.seal(pk, pv)
+				if err != nil {
+					return err
+				}
+				batch = append(batch, pair{old: last, Pair: flat.Pair{Key: to.encryptFlat(pk), Val: nv}})
+			}
+			return it.Err()
+		})
+		if err != nil {
+			return n, err
+		}
+		if len(batch) == 0 {
+			return n, nil
+		}
+		err = flat.Update(ctx, db, func(tx flat.Tx) error {
+			for _, p := range batch {
+				if !bytes.Equal(p.old, p.Key) {
+					if err := tx.Del(ctx, p.old); err != nil {
+						return err
+					}
+				}
+				if err := tx.Put(ctx, p.Key, p.Val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		n += int64(len(batch))
+	}
+}
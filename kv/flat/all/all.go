@@ -3,4 +3,5 @@ package all
 import (
 	_ "github.com/aperturerobotics/cayley/kv/flat/badger"
 	_ "github.com/aperturerobotics/cayley/kv/flat/btree"
+	_ "github.com/aperturerobotics/cayley/kv/flat/pebble"
 )
@@ -23,7 +23,11 @@ func init() {
 	})
 }
 
-var _ flat.KV = (*DB)(nil)
+var (
+	_ flat.KV               = (*DB)(nil)
+	_ flat.Snapshotter      = (*DB)(nil)
+	_ flat.ConcurrentWriter = (*DB)(nil)
+)
 
 func New(d *badger.DB) *DB {
 	return &DB{db: d}
@@ -66,6 +70,11 @@ func (db *DB) Close() error {
 	return db.db.Close()
 }
 
+// ConcurrentWrites implements flat.ConcurrentWriter. Badger detects conflicts between transactions on commit.
+func (db *DB) ConcurrentWrites() bool {
+	return true
+}
+
 func (db *DB) Tx(ctx context.Context, rw bool) (flat.Tx, error) {
 	tx := db.db.NewTransaction(rw)
 	return &Tx{tx: tx}, nil
@@ -79,6 +88,28 @@ func (db *DB) Update(ctx context.Context, fn func(tx flat.Tx) error) error {
 	return flat.Update(ctx, db, fn)
 }
 
+// Snapshot implements flat.Snapshotter. Pairs are read from a single read-only transaction,
+// thus it doesn't block writers.
+func (db *DB) Snapshot(ctx context.Context, fn func(k flat.Key, v flat.Value) error) error {
+	return db.db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			err := item.Value(func(v []byte) error {
+				return fn(item.Key(), v)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 type Tx struct {
 	tx *badger.Txn
 }
@@ -42,7 +42,10 @@ func init() {
 	})
 }
 
-var _ flat.KV = (*DB)(nil)
+var (
+	_ flat.KV          = (*DB)(nil)
+	_ flat.Snapshotter = (*DB)(nil)
+)
 
 // New creates a new flat in-memory key-value store.
 // It's not safe for concurrent use.
@@ -70,6 +73,28 @@ func (db *DB) Update(ctx context.Context, fn func(tx flat.Tx) error) error {
 	return flat.Update(ctx, db, fn)
 }
 
+// Snapshot implements flat.Snapshotter.
+func (db *DB) Snapshot(ctx context.Context, fn func(k flat.Key, v flat.Value) error) error {
+	e, err := db.t.SeekFirst()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer e.Close()
+	for {
+		k, v, err := e.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = fn(k, v); err != nil {
+			return err
+		}
+	}
+}
+
 type Tx struct {
 	t  *Tree
 	rw bool
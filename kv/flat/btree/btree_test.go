@@ -1,6 +1,10 @@
 package btree
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
 	"testing"
 
 	"github.com/aperturerobotics/cayley/kv"
@@ -16,3 +20,48 @@ func TestBtree(t *testing.T) {
 		NoTx:    true,
 	})
 }
+
+// TestTreeInsertFirstAfterDelete checks an insert at the start of a full leaf when its left sibling
+// has room. Separators are not updated on deletion, thus the key may fall before the first key of the leaf.
+func TestTreeInsertFirstAfterDelete(t *testing.T) {
+	tr := TreeNew(bytes.Compare)
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%05d", i)) }
+	for i := 0; i < 200; i += 2 {
+		tr.Set(key(i), key(i))
+	}
+	// the right leaf starts with 72 and is full, the left one has room
+	tr.Delete(key(72))
+	tr.Set(key(201), key(201))
+	tr.Set(key(73), key(73))
+
+	var exp [][]byte
+	for i := 0; i < 200; i += 2 {
+		if i == 72 {
+			exp = append(exp, key(73))
+			continue
+		}
+		exp = append(exp, key(i))
+	}
+	exp = append(exp, key(201))
+
+	e, err := tr.SeekFirst()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	var got [][]byte
+	for {
+		k, v, err := e.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(k, v) {
+			t.Fatalf("unexpected value for %q: %q", k, v)
+		}
+		got = append(got, k)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("unexpected keys:\n%q\nvs\n%q", exp, got)
+	}
+}
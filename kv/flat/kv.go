@@ -27,6 +27,14 @@ type KV interface {
 	Update(ctx context.Context, fn func(tx Tx) error) error
 }
 
+// ConcurrentWriter is an optional interface for flat databases that allow multiple read-write transactions
+// to run in parallel. See kv.ConcurrentWriter.
+type ConcurrentWriter interface {
+	KV
+	// ConcurrentWrites reports if read-write transactions can run in parallel.
+	ConcurrentWrites() bool
+}
+
 // Key is a flat binary key used in a database.
 type Key []byte
 
@@ -0,0 +1,8 @@
+// Package pebble provides a flat key-value store backed by Pebble, an LSM storage engine.
+//
+// Pebble builds with CGO_ENABLED=0, but uses cgo for its manual memory allocation and zstd compression when cgo is enabled.
+package pebble
+
+const (
+	Name = "pebble"
+)
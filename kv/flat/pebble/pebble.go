@@ -0,0 +1,394 @@
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble/v2"
+	"github.com/cockroachdb/pebble/v2/sstable"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/kv/base"
+	"github.com/aperturerobotics/cayley/kv/flat"
+)
+
+func init() {
+	flat.Register(flat.Registration{
+		Registration: base.Registration{
+			Name: Name, Title: "Pebble",
+			Local: true,
+		},
+		OpenPath: OpenPath,
+	})
+}
+
+var (
+	_ flat.KV          = (*DB)(nil)
+	_ flat.Snapshotter = (*DB)(nil)
+)
+
+const (
+	// DefaultCacheSize is the default size of the block cache.
+	DefaultCacheSize = 32 << 20
+	// DefaultMemTableSize is the default size of a single memtable.
+	DefaultMemTableSize = 16 << 20
+	// DefaultCompression is the default compression of table blocks.
+	DefaultCompression = "snappy"
+)
+
+// Options controls resource usage of the database. Zero values are replaced with defaults.
+//
+// Defaults are chosen to keep memory usage low, while still allowing fast bulk imports.
+type Options struct {
+	// CacheSize is the size of the block cache in bytes.
+	CacheSize int64
+	// MemTableSize is the size of a single memtable in bytes. Larger memtables speed up imports
+	// at the cost of memory usage.
+	MemTableSize uint64
+	// Compression of table blocks: "snappy", "zstd" or "none".
+	Compression string
+	// NoSync disables syncing the write-ahead log on each commit.
+	// Recent transactions might be lost on power failure, but the database stays consistent.
+	NoSync bool
+}
+
+func compressionProfile(name string) (*sstable.CompressionProfile, error) {
+	switch name {
+	case "", DefaultCompression:
+		return sstable.SnappyCompression, nil
+	case "zstd":
+		return sstable.ZstdCompression, nil
+	case "none":
+		return sstable.NoCompression, nil
+	}
+	return nil, fmt.Errorf("pebble: unsupported compression: %q", name)
+}
+
+func New(d *pebble.DB, noSync bool) *DB {
+	wopt := pebble.Sync
+	if noSync {
+		wopt = pebble.NoSync
+	}
+	return &DB{db: d, wopt: wopt}
+}
+
+// Open opens or creates a database in the given directory. Options may be nil.
+func Open(path string, opt *Options) (*DB, error) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if o.CacheSize <= 0 {
+		o.CacheSize = DefaultCacheSize
+	}
+	if o.MemTableSize == 0 {
+		o.MemTableSize = DefaultMemTableSize
+	}
+	comp, err := compressionProfile(o.Compression)
+	if err != nil {
+		return nil, err
+	}
+	cache := pebble.NewCache(o.CacheSize)
+	defer cache.Unref()
+	popt := &pebble.Options{
+		Cache:        cache,
+		MemTableSize: o.MemTableSize,
+		// allow more files in L0 before slowing down writes, since large imports produce many of them
+		L0CompactionThreshold: 4,
+		L0StopWritesThreshold: 24,
+		Logger:                logger{},
+	}
+	for i := range popt.Levels {
+		popt.Levels[i].Compression = func() *sstable.CompressionProfile { return comp }
+	}
+	db, err := pebble.Open(path, popt)
+	if err != nil {
+		return nil, err
+	}
+	return New(db, o.NoSync), nil
+}
+
+func OpenPath(path string) (flat.KV, error) {
+	db, err := Open(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// logger redirects Pebble logs to clog. Informational messages are only shown in verbose mode.
+type logger struct{}
+
+func (logger) Infof(format string, args ...any) {
+	if clog.V(2) {
+		clog.Infof(format, args...)
+	}
+}
+
+func (logger) Errorf(format string, args ...any) {
+	clog.Errorf(format, args...)
+}
+
+func (logger) Fatalf(format string, args ...any) {
+	clog.Fatalf(format, args...)
+}
+
+// DB is a flat key-value store backed by Pebble.
+//
+// Pebble has no transactions, thus read-only transactions are implemented with snapshots,
+// and read-write transactions are implemented with indexed batches. Only one read-write
+// transaction can be active at a time, others will wait for it to finish.
+type DB struct {
+	db   *pebble.DB
+	wopt *pebble.WriteOptions
+
+	writer sync.Mutex
+	closed atomic.Bool
+}
+
+func (db *DB) DB() *pebble.DB {
+	return db.db
+}
+
+func (db *DB) Close() error {
+	if !db.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return db.db.Close()
+}
+
+func (db *DB) Tx(ctx context.Context, rw bool) (flat.Tx, error) {
+	if !rw {
+		return &Tx{r: db.db.NewSnapshot()}, nil
+	}
+	db.writer.Lock()
+	b := db.db.NewIndexedBatch()
+	return &Tx{db: db, r: b, b: b}, nil
+}
+
+func (db *DB) View(ctx context.Context, fn func(tx flat.Tx) error) error {
+	return flat.View(ctx, db, fn)
+}
+
+func (db *DB) Update(ctx context.Context, fn func(tx flat.Tx) error) error {
+	return flat.Update(ctx, db, fn)
+}
+
+// Snapshot implements flat.Snapshotter. Pairs are read from a single snapshot,
+// thus it doesn't block writers.
+func (db *DB) Snapshot(ctx context.Context, fn func(k flat.Key, v flat.Value) error) error {
+	snap := db.db.NewSnapshot()
+	defer snap.Close()
+	it, err := snap.NewIter(nil)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ok := it.First(); ok; ok = it.Next() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// reader is a common interface of pebble.Snapshot and pebble.Batch.
+type reader interface {
+	Get(key []byte) ([]byte, io.Closer, error)
+	NewIter(o *pebble.IterOptions) (*pebble.Iterator, error)
+	Close() error
+}
+
+type Tx struct {
+	db   *DB
+	r    reader
+	b    *pebble.Batch // set for read-write transactions
+	done bool
+}
+
+func (tx *Tx) finish() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	err := tx.r.Close()
+	if tx.b != nil {
+		tx.db.writer.Unlock()
+	}
+	return err
+}
+
+func (tx *Tx) Commit(ctx context.Context) error {
+	if tx.done {
+		return nil
+	}
+	if tx.b != nil {
+		if err := tx.b.Commit(tx.db.wopt); err != nil {
+			tx.finish()
+			return err
+		}
+	}
+	return tx.finish()
+}
+
+func (tx *Tx) Close() error {
+	return tx.finish()
+}
+
+func (tx *Tx) Get(ctx context.Context, key flat.Key) (flat.Value, error) {
+	if len(key) == 0 {
+		return nil, flat.ErrNotFound
+	}
+	v, c, err := tx.r.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, flat.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return flat.Value(v).Clone(), nil
+}
+
+func (tx *Tx) GetBatch(ctx context.Context, keys []flat.Key) ([]flat.Value, error) {
+	return flat.GetBatch(ctx, tx, keys)
+}
+
+func (tx *Tx) Put(ctx context.Context, k flat.Key, v flat.Value) error {
+	if tx.b == nil {
+		return flat.ErrReadOnly
+	}
+	return tx.b.Set(k, v, nil)
+}
+
+func (tx *Tx) Del(ctx context.Context, k flat.Key) error {
+	if tx.b == nil {
+		return flat.ErrReadOnly
+	}
+	return tx.b.Delete(k, nil)
+}
+
+func (tx *Tx) Scan(ctx context.Context, opts ...flat.IteratorOption) flat.Iterator {
+	var it flat.Iterator = &Iterator{r: tx.r, first: true}
+	it = flat.ApplyIteratorOptions(it, opts)
+	return it
+}
+
+var (
+	_ flat.Seeker         = &Iterator{}
+	_ flat.PrefixIterator = &Iterator{}
+)
+
+type Iterator struct {
+	r     reader
+	it    *pebble.Iterator
+	pref  flat.Key
+	first bool
+	valid bool
+	err   error
+}
+
+// prefixEnd returns the smallest key that is larger than all keys with a given prefix.
+func prefixEnd(pref []byte) []byte {
+	end := append([]byte{}, pref...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] != 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func (it *Iterator) iter() bool {
+	if it.it != nil {
+		return true
+	} else if it.r == nil || it.err != nil {
+		return false
+	}
+	var opt pebble.IterOptions
+	if len(it.pref) != 0 {
+		opt.LowerBound = it.pref
+		opt.UpperBound = prefixEnd(it.pref)
+	}
+	it.it, it.err = it.r.NewIter(&opt)
+	return it.err == nil
+}
+
+func (it *Iterator) Reset() {
+	it.first = true
+	it.valid = false
+}
+
+func (it *Iterator) WithPrefix(pref flat.Key) flat.Iterator {
+	it.Reset()
+	if it.it != nil {
+		it.err = it.it.Close()
+		it.it = nil
+	}
+	it.pref = pref.Clone()
+	return it
+}
+
+func (it *Iterator) Seek(ctx context.Context, key flat.Key) bool {
+	it.Reset()
+	it.first = false
+	if !it.iter() {
+		return false
+	}
+	it.valid = it.it.SeekGE(key)
+	return it.valid
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	if !it.iter() {
+		return false
+	}
+	if it.first {
+		it.first = false
+		it.valid = it.it.First()
+	} else if it.valid {
+		it.valid = it.it.Next()
+	}
+	return it.valid
+}
+
+func (it *Iterator) Err() error {
+	if it.err == nil && it.it != nil {
+		return it.it.Error()
+	}
+	return it.err
+}
+
+func (it *Iterator) Close() error {
+	err := it.Err()
+	if it.it != nil {
+		if cerr := it.it.Close(); err == nil {
+			err = cerr
+		}
+		it.it = nil
+	}
+	it.r = nil
+	it.valid = false
+	return err
+}
+
+func (it *Iterator) Key() flat.Key {
+	if !it.valid {
+		return nil
+	}
+	return it.it.Key()
+}
+
+func (it *Iterator) Val() flat.Value {
+	if !it.valid {
+		return nil
+	}
+	return it.it.Value()
+}
@@ -0,0 +1,32 @@
+package flat
+
+import (
+	"context"
+
+	"github.com/aperturerobotics/cayley/kv"
+)
+
+var _ kv.Snapshotter = (*hieKV)(nil)
+
+// Snapshotter is an optional interface for flat databases that can efficiently enumerate all the data
+// from a single read-only transaction.
+type Snapshotter interface {
+	KV
+	// Snapshot calls fn for every key-value pair in the database, in key order.
+	// All pairs must be read from the same consistent state of the database.
+	// Key and value are only valid until fn returns.
+	Snapshot(ctx context.Context, fn func(k Key, v Value) error) error
+}
+
+// Snapshot implements kv.Snapshotter. If the flat database implements Snapshotter, it is used to read the data.
+func (hkv *hieKV) Snapshot(ctx context.Context, fn func(k kv.Key, v kv.Value) error) error {
+	ffn := func(k Key, v Value) error {
+		return fn(KeyUnescape(k), v)
+	}
+	if s, ok := hkv.flat.(Snapshotter); ok {
+		return s.Snapshot(ctx, ffn)
+	}
+	return View(ctx, hkv.flat, func(tx Tx) error {
+		return Each(ctx, tx, ffn)
+	})
+}
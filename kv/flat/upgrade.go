@@ -6,7 +6,10 @@ import (
 	"github.com/aperturerobotics/cayley/kv"
 )
 
-var _ kv.KV = (*hieKV)(nil)
+var (
+	_ kv.KV               = (*hieKV)(nil)
+	_ kv.ConcurrentWriter = (*hieKV)(nil)
+)
 
 const (
 	sep = '/'
@@ -75,6 +78,12 @@ func KeyUnescape(k Key) kv.Key {
 	return k2
 }
 
+// ConcurrentWrites implements kv.ConcurrentWriter.
+func (hkv *hieKV) ConcurrentWrites() bool {
+	c, ok := hkv.flat.(ConcurrentWriter)
+	return ok && c.ConcurrentWrites()
+}
+
 func (hkv *hieKV) Close() error {
 	return hkv.flat.Close()
 }
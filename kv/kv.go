@@ -16,7 +16,7 @@ var (
 	ErrReadOnly = errors.New("kv: read only")
 	// ErrConflict is returned when write operation performed be current transaction cannot be committed
 	// because of another concurrent write. Caller must restart the transaction.
-	ErrConflict = errors.New("kv: read only")
+	ErrConflict = errors.New("kv: transaction conflict")
 )
 
 // KV is an interface for hierarchical key-value databases.
@@ -27,6 +27,15 @@ type KV interface {
 	Update(ctx context.Context, fn func(tx Tx) error) error
 }
 
+// ConcurrentWriter is an optional interface for databases that allow multiple read-write transactions
+// to run in parallel. Such transactions are isolated from each other, and a transaction that read or
+// wrote data modified by a concurrent transaction fails to commit with ErrConflict.
+type ConcurrentWriter interface {
+	KV
+	// ConcurrentWrites reports if read-write transactions can run in parallel.
+	ConcurrentWrites() bool
+}
+
 // Key is a hierarchical binary key used in a database.
 type Key [][]byte
 
@@ -1,7 +1,9 @@
 package kvtest
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"os"
 	"strconv"
 	"sync"
@@ -75,6 +77,7 @@ var testList = []struct {
 	{name: "ro", test: readonly},
 	{name: "seek", test: seek},
 	{name: "increment", test: increment, txOnly: true, concurrent: true},
+	{name: "snapshot", test: snapshot},
 }
 
 func basic(t testing.TB, db kv.KV) {
@@ -268,3 +271,62 @@ func increment(t testing.TB, db kv.KV) {
 	}
 	td.Expect(key, []byte("10"))
 }
+
+func snapshot(t testing.TB, db kv.KV) {
+	td := NewTest(t, db)
+
+	keys := []kv.Key{
+		{[]byte("a")},
+		{[]byte("b"), []byte("a")},
+		{[]byte("b"), []byte("a/1")},
+		{[]byte("b"), []byte("b\\")},
+		{[]byte("c"), []byte("a"), []byte("b")},
+	}
+
+	var all []kv.Pair
+	for i, k := range keys {
+		v := kv.Value(strconv.Itoa(i))
+		td.Put(k, v)
+		all = append(all, kv.Pair{Key: k, Val: v})
+	}
+
+	ctx := context.Background()
+	var buf bytes.Buffer
+	st, err := kv.WriteSnapshot(ctx, db, &buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(all)), st.Pairs)
+	require.Equal(t, int64(buf.Len()), st.Bytes)
+	data := buf.Bytes()
+
+	_, err = kv.RestoreSnapshot(ctx, db, bytes.NewReader(data))
+	require.Equal(t, kv.ErrNotEmpty, err)
+
+	for _, k := range keys {
+		td.Del(k)
+	}
+	// corrupted streams must be rejected before anything is written,
+	// both for seekable streams and for streams staged to a temporary file
+	for _, bad := range [][]byte{
+		data[:len(data)-1],
+		data[:len(data)/2],
+	} {
+		_, err = kv.RestoreSnapshot(ctx, db, bytes.NewReader(bad))
+		require.ErrorIs(t, err, kv.ErrBadSnapshot)
+		td.Scan(nil)
+		_, err = kv.RestoreSnapshot(ctx, db, struct{ io.Reader }{bytes.NewReader(bad)})
+		require.ErrorIs(t, err, kv.ErrBadSnapshot)
+		td.Scan(nil)
+	}
+
+	st, err = kv.RestoreSnapshot(ctx, db, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(all)), st.Pairs)
+	require.Equal(t, int64(len(data)), st.Bytes)
+	td.Scan(all)
+
+	// snapshot of the restored database must be the same
+	buf.Reset()
+	_, err = kv.WriteSnapshot(ctx, db, &buf)
+	require.NoError(t, err)
+	require.Equal(t, data, buf.Bytes())
+}
@@ -0,0 +1,71 @@
+package options
+
+import (
+	"sort"
+
+	"github.com/aperturerobotics/cayley/kv"
+	"github.com/aperturerobotics/cayley/kv/base"
+	"github.com/aperturerobotics/cayley/kv/flat"
+)
+
+// Wrapper is a middleware for key-value databases.
+//
+// Similar to IteratorOption, a single implementation works with both hierarchical and flat databases.
+// Flat databases should be wrapped before upgrading them to hierarchical ones.
+type Wrapper interface {
+	// WrapKV wraps a hierarchical key-value database.
+	WrapKV(db kv.KV) kv.KV
+	// WrapFlat wraps a flat key-value database.
+	WrapFlat(db flat.KV) flat.KV
+}
+
+// WrapperFunc creates a Wrapper configured by database options.
+// It returns nil if the middleware is not enabled by the options.
+type WrapperFunc func(opt map[string]any) (Wrapper, error)
+
+var wrappers = make(map[string]WrapperFunc)
+
+// RegisterWrapper globally registers a database middleware.
+func RegisterWrapper(name string, fn WrapperFunc) {
+	if name == "" {
+		panic("name cannot be empty")
+	} else if _, ok := wrappers[name]; ok {
+		panic(base.ErrRegistered{Name: name})
+	}
+	wrappers[name] = fn
+}
+
+// Wrappers returns all globally registered middlewares enabled by the database options, ordered by name.
+func Wrappers(opt map[string]any) ([]Wrapper, error) {
+	names := make([]string, 0, len(wrappers))
+	for name := range wrappers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out []Wrapper
+	for _, name := range names {
+		w, err := wrappers[name](opt)
+		if err != nil {
+			return nil, err
+		} else if w != nil {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+// WrapKV applies middlewares to a hierarchical database. The first one is the closest to the database.
+func WrapKV(db kv.KV, ws []Wrapper) kv.KV {
+	for _, w := range ws {
+		db = w.WrapKV(db)
+	}
+	return db
+}
+
+// WrapFlat applies middlewares to a flat database. The first one is the closest to the database.
+func WrapFlat(db flat.KV, ws []Wrapper) flat.KV {
+	for _, w := range ws {
+		db = w.WrapFlat(db)
+	}
+	return db
+}
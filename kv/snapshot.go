@@ -0,0 +1,405 @@
+package kv
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+var (
+	// ErrNotEmpty is returned when restoring a snapshot into a database that already has data.
+	ErrNotEmpty = errors.New("kv: database is not empty")
+	// ErrBadSnapshot is returned when a snapshot stream is truncated or corrupted.
+	ErrBadSnapshot = errors.New("kv: invalid snapshot")
+)
+
+// Snapshotter is an optional interface for databases that can efficiently enumerate all the data
+// from a single read-only transaction. See WriteSnapshot.
+type Snapshotter interface {
+	KV
+	// Snapshot calls fn for every key-value pair in the database, in key order.
+	// All pairs must be read from the same consistent state of the database.
+	// Key and value are only valid until fn returns.
+	Snapshot(ctx context.Context, fn func(k Key, v Value) error) error
+}
+
+const (
+	snapshotMagic   = "CAYLEYKV"
+	snapshotVersion = 1
+
+	// restoreBatchPairs and restoreBatchSize limit the size of a single write transaction during restore.
+	restoreBatchPairs = 10000
+	restoreBatchSize  = 4 << 20
+)
+
+// SnapshotStats describes the data written or read by WriteSnapshot and RestoreSnapshot.
+type SnapshotStats struct {
+	Pairs int64 // number of key-value pairs
+	Bytes int64 // size of the snapshot stream
+}
+
+// WriteSnapshot writes a copy of all key-value pairs of the database to w.
+//
+// If the database implements Snapshotter, it is used to read the data. Otherwise, all pairs are read
+// from a single read-only transaction.
+//
+// The snapshot is independent of the database backend, thus it can be restored into any database.
+func WriteSnapshot(ctx context.Context, db KV, w io.Writer) (SnapshotStats, error) {
+	sw := newSnapshotWriter(w)
+	sw.header()
+	fn := func(k Key, v Value) error {
+		if len(k) == 0 {
+			return nil
+		}
+		return sw.pair(k, v)
+	}
+	var err error
+	if s, ok := db.(Snapshotter); ok {
+		err = s.Snapshot(ctx, fn)
+	} else {
+		err = View(ctx, db, func(tx Tx) error {
+			return Each(ctx, tx, fn)
+		})
+	}
+	if err == nil {
+		err = sw.finish()
+	}
+	return SnapshotStats{Pairs: sw.pairs, Bytes: sw.n}, err
+}
+
+// RestoreSnapshot reads a snapshot written by WriteSnapshot and stores all key-value pairs in the database.
+// The database must be empty, otherwise ErrNotEmpty is returned.
+//
+// The stream is verified before anything is written: if r implements io.Seeker it is read twice,
+// otherwise it is staged to a temporary file. Pairs are written in multiple transactions, thus
+// the database must not be used until the restore completes. If writing fails, pairs that were
+// already written are removed.
+func RestoreSnapshot(ctx context.Context, db KV, r io.Reader) (SnapshotStats, error) {
+	err := View(ctx, db, func(tx Tx) error {
+		it := tx.Scan(ctx)
+		defer it.Close()
+		if it.Next(ctx) {
+			return ErrNotEmpty
+		}
+		return it.Err()
+	})
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+	rs, ok := r.(io.ReadSeeker)
+	if ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return SnapshotStats{}, err
+		}
+		if _, err = readSnapshot(ctx, rs, nil); err != nil {
+			return SnapshotStats{}, err
+		}
+		if _, err = rs.Seek(start, io.SeekStart); err != nil {
+			return SnapshotStats{}, err
+		}
+	} else {
+		f, err := os.CreateTemp("", "cayley-restore-*")
+		if err != nil {
+			return SnapshotStats{}, err
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+		if _, err = readSnapshot(ctx, io.TeeReader(r, f), nil); err != nil {
+			return SnapshotStats{}, err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return SnapshotStats{}, err
+		}
+		rs = f
+	}
+	var (
+		batch []Pair
+		size  int
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := Update(ctx, db, func(tx Tx) error {
+			for _, p := range batch {
+				if err := tx.Put(ctx, p.Key, p.Val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		batch, size = batch[:0], 0
+		return err
+	}
+	st, err := readSnapshot(ctx, rs, func(p Pair) error {
+		batch = append(batch, p)
+		size += len(p.Val)
+		for _, s := range p.Key {
+			size += len(s)
+		}
+		if len(batch) >= restoreBatchPairs || size >= restoreBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// the database was empty, thus everything that was written belongs to the snapshot
+		if derr := clearDB(context.WithoutCancel(ctx), db); derr != nil {
+			err = fmt.Errorf("%w (cannot remove restored pairs: %v)", err, derr)
+		}
+		return st, err
+	}
+	return st, nil
+}
+
+// readSnapshot reads and verifies the snapshot stream, calling fn for each pair, if it's set.
+func readSnapshot(ctx context.Context, r io.Reader, fn func(p Pair) error) (SnapshotStats, error) {
+	var st SnapshotStats
+	sr := newSnapshotReader(r)
+	if err := sr.header(); err != nil {
+		return st, err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return st, err
+		}
+		p, done, err := sr.pair()
+		if err != nil {
+			return st, err
+		} else if done {
+			break
+		}
+		if fn != nil {
+			if err = fn(p); err != nil {
+				return st, err
+			}
+		}
+		st.Pairs++
+	}
+	err := sr.finish(st.Pairs)
+	st.Bytes = sr.n
+	return st, err
+}
+
+// clearDB removes all keys from the database in batches.
+func clearDB(ctx context.Context, db KV) error {
+	for {
+		var keys []Key
+		err := View(ctx, db, func(tx Tx) error {
+			it := tx.Scan(ctx)
+			defer it.Close()
+			for len(keys) < restoreBatchPairs && it.Next(ctx) {
+				keys = append(keys, it.Key().Clone())
+			}
+			return it.Err()
+		})
+		if err != nil {
+			return err
+		} else if len(keys) == 0 {
+			return nil
+		}
+		err = Update(ctx, db, func(tx Tx) error {
+			for _, k := range keys {
+				if err := tx.Del(ctx, k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// The snapshot stream consists of a header, a sequence of key-value pairs and a trailer.
+//
+//	header:  "CAYLEYKV" uvarint(version)
+//	pair:    uvarint(len(key)) { uvarint(len(part)) part } uvarint(len(val)) val
+//	trailer: uvarint(0) uvarint(pairs) crc32c
+//
+// The checksum covers all the preceding bytes of the stream.
+
+var snapshotCRC = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotWriter struct {
+	w     *bufio.Writer
+	crc   hash.Hash32
+	buf   [binary.MaxVarintLen64]byte
+	n     int64
+	pairs int64
+	err   error
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	sw := &snapshotWriter{crc: crc32.New(snapshotCRC)}
+	sw.w = bufio.NewWriter(io.MultiWriter(w, sw.crc))
+	return sw
+}
+
+func (w *snapshotWriter) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	var n int
+	n, w.err = w.w.Write(p)
+	w.n += int64(n)
+}
+
+func (w *snapshotWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(w.buf[:], v)
+	w.write(w.buf[:n])
+}
+
+func (w *snapshotWriter) header() {
+	w.write([]byte(snapshotMagic))
+	w.uvarint(snapshotVersion)
+}
+
+func (w *snapshotWriter) pair(k Key, v Value) error {
+	w.uvarint(uint64(len(k)))
+	for _, s := range k {
+		w.uvarint(uint64(len(s)))
+		w.write(s)
+	}
+	w.uvarint(uint64(len(v)))
+	w.write(v)
+	w.pairs++
+	return w.err
+}
+
+func (w *snapshotWriter) finish() error {
+	w.uvarint(0)
+	w.uvarint(uint64(w.pairs))
+	if w.err != nil {
+		return w.err
+	}
+	// the checksum itself is not a part of the checksum
+	if w.err = w.w.Flush(); w.err != nil {
+		return w.err
+	}
+	sum := w.crc.Sum32()
+	binary.BigEndian.PutUint32(w.buf[:4], sum)
+	w.write(w.buf[:4])
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	n   int64
+}
+
+func newSnapshotReader(r io.Reader) *snapshotReader {
+	return &snapshotReader{r: bufio.NewReader(r), crc: crc32.New(snapshotCRC)}
+}
+
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+		r.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (r *snapshotReader) read(p []byte) error {
+	n, err := io.ReadFull(r.r, p)
+	r.n += int64(n)
+	r.crc.Write(p[:n])
+	return err
+}
+
+func (r *snapshotReader) uvarint() (uint64, error) {
+	return binary.ReadUvarint(r)
+}
+
+func (r *snapshotReader) bytes() ([]byte, error) {
+	sz, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	} else if sz > 1<<31 {
+		return nil, fmt.Errorf("%w: value is too large (%d bytes)", ErrBadSnapshot, sz)
+	}
+	p := make([]byte, sz)
+	if err = r.read(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: unexpected end of stream", ErrBadSnapshot)
+	}
+	return err
+}
+
+func (r *snapshotReader) header() error {
+	magic := make([]byte, len(snapshotMagic))
+	if err := r.read(magic); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	} else if string(magic) != snapshotMagic {
+		return fmt.Errorf("%w: unknown format", ErrBadSnapshot)
+	}
+	vers, err := r.uvarint()
+	if err != nil {
+		return unexpectedEOF(err)
+	} else if vers != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, vers)
+	}
+	return nil
+}
+
+func (r *snapshotReader) pair() (Pair, bool, error) {
+	parts, err := r.uvarint()
+	if err != nil {
+		return Pair{}, false, unexpectedEOF(err)
+	} else if parts == 0 {
+		return Pair{}, true, nil
+	} else if parts > 1<<16 {
+		return Pair{}, false, fmt.Errorf("%w: key has too many parts (%d)", ErrBadSnapshot, parts)
+	}
+	p := Pair{Key: make(Key, parts)}
+	for i := range p.Key {
+		if p.Key[i], err = r.bytes(); err != nil {
+			return Pair{}, false, unexpectedEOF(err)
+		}
+	}
+	if p.Val, err = r.bytes(); err != nil {
+		return Pair{}, false, unexpectedEOF(err)
+	}
+	return p, false, nil
+}
+
+func (r *snapshotReader) finish(pairs int64) error {
+	cnt, err := r.uvarint()
+	if err != nil {
+		return unexpectedEOF(err)
+	} else if cnt != uint64(pairs) {
+		return fmt.Errorf("%w: expected %d pairs, got %d", ErrBadSnapshot, cnt, pairs)
+	}
+	want := r.crc.Sum32()
+	var sum [4]byte
+	if err = r.read(sum[:]); err != nil {
+		return unexpectedEOF(err)
+	} else if got := binary.BigEndian.Uint32(sum[:]); got != want {
+		return fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+	return nil
+}
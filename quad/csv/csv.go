@@ -0,0 +1,168 @@
+// Package csv provides a decoder for tables in CSV and TSV formats, and an encoder for tabular query results.
+//
+// Rows of a table are converted to quads according to a Mapping. Without a mapping, each row is a blank node
+// with string properties named by columns of the header.
+package csv
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+)
+
+func init() {
+	quad.RegisterFormat(quad.Format{
+		Name:   "csv",
+		Ext:    []string{".csv"},
+		Mime:   []string{"text/csv"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewReader(r, nil) },
+	})
+	quad.RegisterFormat(quad.Format{
+		Name:   "tsv",
+		Ext:    []string{".tsv", ".tab"},
+		Mime:   []string{"text/tab-separated-values"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewTSVReader(r, nil) },
+	})
+}
+
+var rdfType = quad.IRI(rdf.NS + "type")
+
+// Reader converts rows of a table to quads.
+type Reader struct {
+	r   *csv.Reader
+	m   *Mapping
+	c   *compiled
+	row int // index of the current row, starting from 1
+	buf []quad.Quad
+	err error
+}
+
+// NewReader creates a reader for comma-separated values. If the mapping is nil, a default one is used.
+func NewReader(r io.Reader, m *Mapping) *Reader {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	if m == nil {
+		m = &Mapping{}
+	}
+	return &Reader{r: cr, m: m}
+}
+
+// NewTSVReader creates a reader for tab-separated values. If the mapping is nil, a default one is used.
+func NewTSVReader(r io.Reader, m *Mapping) *Reader {
+	tr := NewReader(r, m)
+	tr.r.Comma = '\t'
+	tr.r.LazyQuotes = true
+	return tr
+}
+
+func (r *Reader) ReadQuad(ctx context.Context) (quad.Quad, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return quad.Quad{}, r.err
+		}
+		r.buf, r.err = r.next()
+		if r.err != nil && r.err != io.EOF {
+			r.err = fmt.Errorf("csv: %w", r.err)
+		}
+	}
+	q := r.buf[0]
+	r.buf = r.buf[1:]
+	return q, nil
+}
+
+// next converts the next row to quads.
+func (r *Reader) next() ([]quad.Quad, error) {
+	if r.c == nil {
+		header := r.m.Header
+		if len(header) == 0 {
+			rec, err := r.r.Read()
+			if err == io.EOF {
+				return nil, io.EOF
+			} else if err != nil {
+				return nil, err
+			}
+			header = append([]string{}, rec...)
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+		r.r.FieldsPerRecord = len(header)
+		c, err := r.m.compile(header)
+		if err != nil {
+			return nil, err
+		}
+		r.c = c
+	}
+	rec, err := r.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.row++
+	line, _ := r.r.FieldPos(0)
+
+	var s quad.Value = quad.BNode(fmt.Sprintf("r%d", r.row))
+	if r.c.subject != nil {
+		var ok bool
+		if s, ok = r.c.subject.value(rec); !ok {
+			// no subject, as in R2RML
+			return nil, nil
+		}
+	}
+	var label quad.Value
+	if r.c.label != nil {
+		label, _ = r.c.label.value(rec)
+	}
+	var out []quad.Quad
+	for _, typ := range r.c.class {
+		out = append(out, quad.Quad{Subject: s, Predicate: rdfType, Object: typ, Label: label})
+	}
+	for i := range r.c.props {
+		p := &r.c.props[i]
+		o, err := p.value(rec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: column %q: %w", line, p.name, err)
+		} else if o == nil {
+			continue
+		}
+		q := quad.Quad{Subject: s, Predicate: p.pred, Object: o, Label: label}
+		if p.label != nil {
+			q.Label, _ = p.label.value(rec)
+		}
+		out = append(out, q)
+	}
+	return out, nil
+}
+
+// value returns a value of the property in a row, or nil if the cell is empty.
+func (p *property) value(row []string) (quad.Value, error) {
+	if p.tmpl != nil {
+		v, _ := p.tmpl.value(row)
+		return v, nil
+	}
+	s := row[p.col]
+	switch {
+	case s == "":
+		return nil, nil
+	case p.lang != "":
+		return quad.LangString{Value: quad.String(s), Lang: p.lang}, nil
+	case p.time != "":
+		t, err := time.Parse(p.time, s)
+		if err != nil {
+			return nil, err
+		}
+		return quad.Time(t), nil
+	case p.typ != "":
+		v, err := quad.TypedString{Value: quad.String(s), Type: p.typ}.ParseValue()
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q of type %v: %w", s, p.typ, err)
+		}
+		return v, nil
+	}
+	return quad.String(s), nil
+}
+
+func (r *Reader) Close() error { return nil }
@@ -0,0 +1,161 @@
+package csv_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/csv"
+)
+
+func readAll(t testing.TB, r quad.Reader) []quad.Quad {
+	quads, err := quad.ReadAll(context.Background(), r)
+	require.NoError(t, err)
+	return quads
+}
+
+func TestReadDefault(t *testing.T) {
+	const data = "\ufeffname,age\nAlice,30\nBob,\n"
+	quads := readAll(t, quad.FormatByName("csv").Reader(strings.NewReader(data)))
+	require.Equal(t, []quad.Quad{
+		{Subject: quad.BNode("r1"), Predicate: quad.IRI("name"), Object: quad.String("Alice")},
+		{Subject: quad.BNode("r1"), Predicate: quad.IRI("age"), Object: quad.String("30")},
+		{Subject: quad.BNode("r2"), Predicate: quad.IRI("name"), Object: quad.String("Bob")},
+	}, quads)
+}
+
+const mapping = `{
+	"prefixes": {"ex": "http://example.org/", "schema": "http://schema.org/"},
+	"subject": "ex:person/{id}",
+	"class": ["schema:Person"],
+	"label": "ex:dept/{dept}",
+	"columns": [
+		{"column": "name", "predicate": "schema:name", "lang": "en"},
+		{"column": "age", "predicate": "schema:age", "datatype": "xsd:integer"},
+		{"column": "born", "predicate": "schema:birthDate", "time_layout": "2006-01-02"},
+		{"column": "code", "predicate": "ex:code", "datatype": "ex:Code"},
+		{"template": "ex:person/{boss}", "predicate": "ex:boss", "label": "ex:org"}
+	]
+}`
+
+func TestReadMapping(t *testing.T) {
+	m, err := csv.ParseMapping(strings.NewReader(mapping))
+	require.NoError(t, err)
+
+	const data = "id,name,age,born,code,boss,dept\n" +
+		"j doe,John,42,1980-05-01,X1,a/b,sales\n" +
+		"a/b,Ann,,,,,\n" +
+		",Nobody,1,,,,\n"
+	var (
+		john = quad.IRI("http://example.org/person/j%20doe")
+		ann  = quad.IRI("http://example.org/person/a%2Fb")
+		typ  = quad.IRI("http://www.w3.org/1999/02/22-rdf-syntax-ns#type")
+	)
+	quads := readAll(t, csv.NewReader(strings.NewReader(data), m))
+	require.Equal(t, []quad.Quad{
+		{Subject: john, Predicate: typ, Object: quad.IRI("http://schema.org/Person"), Label: quad.IRI("http://example.org/dept/sales")},
+		{Subject: john, Predicate: quad.IRI("http://schema.org/name"), Object: quad.LangString{Value: "John", Lang: "en"}, Label: quad.IRI("http://example.org/dept/sales")},
+		{Subject: john, Predicate: quad.IRI("http://schema.org/age"), Object: quad.Int(42), Label: quad.IRI("http://example.org/dept/sales")},
+		{Subject: john, Predicate: quad.IRI("http://schema.org/birthDate"), Object: quad.Time(time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)), Label: quad.IRI("http://example.org/dept/sales")},
+		{Subject: john, Predicate: quad.IRI("http://example.org/code"), Object: quad.TypedString{Value: "X1", Type: "http://example.org/Code"}, Label: quad.IRI("http://example.org/dept/sales")},
+		{Subject: john, Predicate: quad.IRI("http://example.org/boss"), Object: ann, Label: quad.IRI("http://example.org/org")},
+		{Subject: ann, Predicate: typ, Object: quad.IRI("http://schema.org/Person")},
+		{Subject: ann, Predicate: quad.IRI("http://schema.org/name"), Object: quad.LangString{Value: "Ann", Lang: "en"}},
+	}, quads)
+}
+
+func TestReadTSV(t *testing.T) {
+	m := &csv.Mapping{
+		Header:  []string{"id", "name"},
+		Subject: "_:n{id}",
+		Columns: []csv.Column{{Column: "name", Predicate: "http://example.org/name"}},
+	}
+	quads := readAll(t, csv.NewTSVReader(strings.NewReader("1\tA \"quoted\" name\n2\tB\n"), m))
+	require.Equal(t, []quad.Quad{
+		{Subject: quad.BNode("n1"), Predicate: quad.IRI("http://example.org/name"), Object: quad.String(`A "quoted" name`)},
+		{Subject: quad.BNode("n2"), Predicate: quad.IRI("http://example.org/name"), Object: quad.String("B")},
+	}, quads)
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		mapping string
+		data    string
+		err     string
+	}{
+		{
+			name:    "unknown field",
+			mapping: `{"subjet": "x"}`,
+			err:     `unknown field "subjet"`,
+		},
+		{
+			name:    "unknown column",
+			mapping: `{"columns": [{"column": "b", "predicate": "p"}]}`,
+			data:    "a\n1\n",
+			err:     `unknown column "b"`,
+		},
+		{
+			name:    "bad template",
+			mapping: `{"subject": "http://example.org/{a"}`,
+			data:    "a\n1\n",
+			err:     `unterminated column reference`,
+		},
+		{
+			name:    "no predicate",
+			mapping: `{"columns": [{"column": "a"}]}`,
+			data:    "a\n1\n",
+			err:     `column "a": no predicate`,
+		},
+		{
+			name:    "bad value",
+			mapping: `{"columns": [{"column": "a", "predicate": "p", "datatype": "xsd:integer"}]}`,
+			data:    "a\n1\nx\n",
+			err:     `csv: line 3: column "a": invalid value "x"`,
+		},
+		{
+			name: "wrong number of fields",
+			data: "a,b\n1\n",
+			err:  `wrong number of fields`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			m := &csv.Mapping{}
+			if c.mapping != "" {
+				var err error
+				m, err = csv.ParseMapping(strings.NewReader(c.mapping))
+				if err != nil {
+					require.ErrorContains(t, err, c.err)
+					return
+				}
+			}
+			_, err := quad.ReadAll(context.Background(), csv.NewReader(strings.NewReader(c.data), m))
+			require.ErrorContains(t, err, c.err)
+		})
+	}
+}
+
+func TestResultWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := csv.NewResultWriter(&buf, []string{"s", "v", "x"})
+	require.NoError(t, w.WriteResult(map[string]quad.Value{
+		"s": quad.IRI("http://example.org/a"),
+		"v": quad.String("a, \"b\""),
+	}))
+	require.NoError(t, w.WriteResult(map[string]quad.Value{
+		"s": quad.BNode("b1"),
+		"v": quad.Int(5),
+		"x": quad.LangString{Value: "hi", Lang: "en"},
+	}))
+	require.NoError(t, w.Close())
+	require.Equal(t, "s,v,x\r\nhttp://example.org/a,\"a, \"\"b\"\"\",\r\n_:b1,5,hi\r\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, csv.NewResultWriter(&buf, []string{"s"}).Close())
+	require.Equal(t, "s\r\n", buf.String())
+}
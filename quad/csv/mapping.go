@@ -0,0 +1,275 @@
+package csv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc"
+)
+
+// Mapping describes how rows of a table are converted to quads. It is loosely modeled after R2RML.
+//
+// Templates, such as "http://example.org/person/{id}", refer to columns in braces. Values of columns are
+// percent-encoded, so they are safe to use in IRIs. Literal braces and backslashes are escaped with a backslash.
+// A template that refers to an empty cell produces no value, and quads with such values are skipped.
+//
+// IRIs of the mapping may be written in a compact form, using Prefixes or globally registered namespaces.
+type Mapping struct {
+	// Prefixes maps prefixes, such as "ex", to namespaces.
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+	// Header lists names of columns for tables without a header row.
+	Header []string `json:"header,omitempty"`
+	// Subject is a template of subject IRIs. Templates starting with "_:" produce blank nodes.
+	// If it's empty, each row is a new blank node.
+	Subject string `json:"subject,omitempty"`
+	// Class lists types of subjects, written as rdf:type properties.
+	Class []string `json:"class,omitempty"`
+	// Label is a template of quad labels. Quads have no label if it's empty.
+	Label string `json:"label,omitempty"`
+	// Columns lists properties of subjects. If it's empty, every column is converted to
+	// a string property with a column name as a predicate.
+	Columns []Column `json:"columns,omitempty"`
+}
+
+// Column describes a property of a subject.
+type Column struct {
+	// Column is the name of a column that holds values of the property.
+	Column string `json:"column,omitempty"`
+	// Template is a template of IRIs of the property. It is used instead of Column to link subjects to other nodes.
+	Template string `json:"template,omitempty"`
+	// Predicate is an IRI of the property.
+	Predicate string `json:"predicate"`
+	// Datatype is an IRI of the datatype of values. Values of known types are converted to native types,
+	// such as quad.Int or quad.Time; others are written as quad.TypedString.
+	Datatype string `json:"datatype,omitempty"`
+	// Lang is a language tag of values.
+	Lang string `json:"lang,omitempty"`
+	// TimeLayout is a layout of time values, as accepted by time.Parse. Values are converted to quad.Time.
+	TimeLayout string `json:"time_layout,omitempty"`
+	// Label is a template of labels of quads with the property. It overrides the label of the mapping.
+	Label string `json:"label,omitempty"`
+}
+
+// ParseMapping reads a mapping in JSON format.
+func ParseMapping(r io.Reader) (*Mapping, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var m Mapping
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("csv: cannot parse mapping: %w", err)
+	}
+	return &m, nil
+}
+
+// LoadMapping reads a mapping from a JSON file.
+func LoadMapping(path string) (*Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMapping(f)
+}
+
+// part is a part of a template: either a literal string, or a reference to a column.
+type part struct {
+	lit string
+	col int // -1 for literals
+}
+
+type template []part
+
+// parseTemplate parses a template and resolves column names to their indexes.
+func parseTemplate(s string, cols map[string]int) (template, error) {
+	var (
+		out template
+		cur strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("template %q: trailing backslash", s)
+			}
+			i++
+			cur.WriteByte(s[i])
+		case '{':
+			j := strings.IndexByte(s[i:], '}')
+			if j < 0 {
+				return nil, fmt.Errorf("template %q: unterminated column reference", s)
+			}
+			name := s[i+1 : i+j]
+			col, ok := cols[name]
+			if !ok {
+				return nil, fmt.Errorf("template %q: unknown column %q", s, name)
+			}
+			if cur.Len() != 0 {
+				out = append(out, part{lit: cur.String(), col: -1})
+				cur.Reset()
+			}
+			out = append(out, part{col: col})
+			i += j
+		case '}':
+			return nil, fmt.Errorf("template %q: unexpected '}'", s)
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if cur.Len() != 0 {
+		out = append(out, part{lit: cur.String(), col: -1})
+	}
+	return out, nil
+}
+
+// expand fills a template with values of a row. It returns false if any of referenced cells is empty.
+func (t template) expand(row []string) (string, bool) {
+	var sb strings.Builder
+	for _, p := range t {
+		if p.col < 0 {
+			sb.WriteString(p.lit)
+			continue
+		}
+		v := row[p.col]
+		if v == "" {
+			return "", false
+		}
+		escape(&sb, v)
+	}
+	return sb.String(), true
+}
+
+// value expands a template to an IRI or a blank node.
+func (t template) value(row []string) (quad.Value, bool) {
+	s, ok := t.expand(row)
+	if !ok {
+		return nil, false
+	} else if strings.HasPrefix(s, "_:") {
+		return quad.BNode(s[2:]), true
+	}
+	return quad.IRI(s), true
+}
+
+// escape percent-encodes all characters except unreserved ones, as defined by RFC 3986.
+func escape(sb *strings.Builder, s string) {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&15])
+		}
+	}
+}
+
+// property is a compiled Column.
+type property struct {
+	name  string
+	col   int // -1 if tmpl is set
+	tmpl  template
+	pred  quad.IRI
+	typ   quad.IRI
+	lang  string
+	time  string
+	label template
+}
+
+// compiled is a Mapping with templates parsed and IRIs expanded.
+type compiled struct {
+	subject template
+	class   []quad.IRI
+	label   template
+	props   []property
+}
+
+func (m *Mapping) compile(header []string) (*compiled, error) {
+	var ns voc.Namespaces
+	for pref, full := range m.Prefixes {
+		ns.Register(voc.Namespace{Prefix: strings.TrimSuffix(pref, ":") + ":", Full: full})
+	}
+	iri := func(s string) quad.IRI {
+		return quad.IRI(s).FullWith(&ns).Full()
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, ok := cols[name]; !ok {
+			cols[name] = i
+		}
+	}
+	// tmpl parses a template of IRIs, which may start with a compact IRI
+	tmpl := func(s string) (template, error) {
+		t, err := parseTemplate(s, cols)
+		if err == nil && len(t) != 0 && t[0].col < 0 && !strings.HasPrefix(t[0].lit, "_:") {
+			t[0].lit = string(iri(t[0].lit))
+		}
+		return t, err
+	}
+	var (
+		c   compiled
+		err error
+	)
+	if m.Subject != "" {
+		if c.subject, err = tmpl(m.Subject); err != nil {
+			return nil, err
+		}
+	}
+	if m.Label != "" {
+		if c.label, err = tmpl(m.Label); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range m.Class {
+		c.class = append(c.class, iri(s))
+	}
+	if len(m.Columns) == 0 {
+		for i, name := range header {
+			c.props = append(c.props, property{name: name, col: i, pred: quad.IRI(name)})
+		}
+		return &c, nil
+	}
+	for _, col := range m.Columns {
+		p := property{name: col.Column, col: -1, lang: col.Lang, time: col.TimeLayout}
+		switch {
+		case col.Predicate == "":
+			return nil, fmt.Errorf("column %q: no predicate", col.Column)
+		case col.Column == "" && col.Template == "":
+			return nil, errors.New("either a column or a template must be set")
+		case col.Column != "" && col.Template != "":
+			return nil, fmt.Errorf("column %q: both a column and a template are set", col.Column)
+		case col.Template != "" && (col.Datatype != "" || col.Lang != "" || col.TimeLayout != ""):
+			return nil, fmt.Errorf("template %q: datatypes and languages are not supported for IRIs", col.Template)
+		case col.Lang != "" && (col.Datatype != "" || col.TimeLayout != ""):
+			return nil, fmt.Errorf("column %q: both a language and a datatype are set", col.Column)
+		}
+		if col.Template != "" {
+			p.name = col.Template
+			if p.tmpl, err = tmpl(col.Template); err != nil {
+				return nil, err
+			}
+		} else if i, ok := cols[col.Column]; ok {
+			p.col = i
+		} else {
+			return nil, fmt.Errorf("unknown column %q", col.Column)
+		}
+		if col.Label != "" {
+			if p.label, err = tmpl(col.Label); err != nil {
+				return nil, err
+			}
+		}
+		p.pred = iri(col.Predicate)
+		if col.Datatype != "" {
+			p.typ = iri(col.Datatype)
+		}
+		c.props = append(c.props, p)
+	}
+	return &c, nil
+}
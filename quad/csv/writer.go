@@ -0,0 +1,87 @@
+package csv
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// ResultWriter writes results of SELECT-style queries as comma-separated values, with a header row
+// of variable names. Values are written in their lexical forms, as in the SPARQL 1.1 CSV results format,
+// and unbound variables are left empty.
+type ResultWriter struct {
+	w      *csv.Writer
+	vars   []string
+	rec    []string
+	header bool
+}
+
+// NewResultWriter creates a writer for results with given variables. Columns follow the order of variables.
+func NewResultWriter(w io.Writer, vars []string) *ResultWriter {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	return &ResultWriter{w: cw, vars: vars, rec: make([]string, len(vars))}
+}
+
+func (w *ResultWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.w.Write(w.vars)
+}
+
+// WriteResult writes a row with values of variables.
+func (w *ResultWriter) WriteResult(r map[string]quad.Value) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	for i, name := range w.vars {
+		w.rec[i] = ""
+		if v := r[name]; v != nil {
+			w.rec[i] = lexical(v)
+		}
+	}
+	return w.w.Write(w.rec)
+}
+
+// Flush writes buffered rows to the underlying writer.
+func (w *ResultWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Close writes the header, if no rows were written, and flushes the writer.
+func (w *ResultWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func lexical(v quad.Value) string {
+	switch v := v.(type) {
+	case quad.IRI:
+		return string(v.Full())
+	case quad.BNode:
+		return v.String()
+	case quad.String:
+		return string(v)
+	case quad.LangString:
+		return string(v.Value)
+	case quad.TypedString:
+		return string(v.Value)
+	case quad.Int:
+		return strconv.FormatInt(int64(v), 10)
+	case quad.Float:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case quad.Bool:
+		return strconv.FormatBool(bool(v))
+	case quad.Time:
+		return time.Time(v).Format(time.RFC3339Nano)
+	}
+	return quad.StringOf(v)
+}
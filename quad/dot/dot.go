@@ -1,4 +1,4 @@
-// Package dot provides an encoder for DOT format (graphviz).
+// Package dot provides an encoder and a decoder for DOT format (graphviz).
 package dot
 
 import (
@@ -14,6 +14,7 @@ func init() {
 	quad.RegisterFormat(quad.Format{
 		Name:   "graphviz",
 		Ext:    []string{".gv", ".dot"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewReader(r) },
 		Writer: func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
 	})
 }
@@ -3,6 +3,8 @@ package dot_test
 import (
 	"bytes"
 	"context"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aperturerobotics/cayley/quad"
@@ -71,3 +73,58 @@ func TestWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestReader(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range testData {
+		quads, err := quad.ReadAll(ctx, dot.NewReader(strings.NewReader(c.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c.quads, quads) {
+			t.Fatalf("wrong quads:\n%v\n\nvs\n\n%v", quads, c.quads)
+		}
+	}
+}
+
+func TestReaderAttributes(t *testing.T) {
+	const data = `/* network */
+strict graph net {
+	node [ shape = box ];
+	r1 [ label = "Router " + "1" ];
+	// switches
+	r1 -- { s1; s2 } [ speed = 10, label = uplink ];
+	s2:p1 -- "<http://example.org/host>" -- r1
+}
+`
+	exp := []quad.Quad{
+		{Subject: quad.BNode("r1"), Predicate: quad.IRI("label"), Object: quad.String("Router 1")},
+		{Subject: quad.BNode("r1"), Predicate: quad.IRI("shape"), Object: quad.String("box")},
+		{Subject: quad.BNode("s1"), Predicate: quad.IRI("shape"), Object: quad.String("box")},
+		{Subject: quad.BNode("s2"), Predicate: quad.IRI("shape"), Object: quad.String("box")},
+		{Subject: quad.IRI("http://example.org/host"), Predicate: quad.IRI("shape"), Object: quad.String("box")},
+	}
+	rdf := func(s string) quad.IRI { return quad.IRI("http://www.w3.org/1999/02/22-rdf-syntax-ns#" + s) }
+	for i, o := range []quad.Value{quad.BNode("s1"), quad.BNode("s2")} {
+		st := quad.BNode([]string{"e1", "e2"}[i])
+		exp = append(exp,
+			quad.Quad{Subject: quad.BNode("r1"), Predicate: quad.IRI("uplink"), Object: o},
+			quad.Quad{Subject: st, Predicate: rdf("type"), Object: rdf("Statement")},
+			quad.Quad{Subject: st, Predicate: rdf("subject"), Object: quad.BNode("r1")},
+			quad.Quad{Subject: st, Predicate: rdf("predicate"), Object: quad.IRI("uplink")},
+			quad.Quad{Subject: st, Predicate: rdf("object"), Object: o},
+			quad.Quad{Subject: st, Predicate: quad.IRI("speed"), Object: quad.String("10")},
+		)
+	}
+	exp = append(exp,
+		quad.Quad{Subject: quad.BNode("s2"), Predicate: quad.IRI("edge"), Object: quad.IRI("http://example.org/host")},
+		quad.Quad{Subject: quad.IRI("http://example.org/host"), Predicate: quad.IRI("edge"), Object: quad.BNode("r1")},
+	)
+	quads, err := quad.ReadAll(context.Background(), dot.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exp, quads) {
+		t.Fatalf("wrong quads:\n%v\n\nvs\n\n%v", quads, exp)
+	}
+}
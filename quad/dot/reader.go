@@ -0,0 +1,523 @@
+package dot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/internal/graphconv"
+)
+
+// NewReader creates a DOT reader.
+//
+// Node and edge attributes, other than labels, are converted to properties, including default attributes
+// set by node and edge statements. Graph attributes are ignored.
+func NewReader(r io.Reader) quad.ReadCloser {
+	return graphconv.NewReader(func() (*graphconv.Graph, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		p := &parser{lex: lexer{s: string(data), line: 1}, seen: make(map[string]struct{})}
+		if err = p.document(); err != nil {
+			return nil, fmt.Errorf("dot: line %d: %w", p.lex.line, err)
+		}
+		return &p.g, nil
+	})
+}
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokID               // identifier, number or string
+	tokEdgeOp           // -> or --
+	tokPunct            // { } [ ] = ; , :
+)
+
+type token struct {
+	kind   tokenKind
+	val    string
+	quoted bool // quoted and HTML strings are never keywords
+}
+
+// keyword checks if a token is an unquoted keyword. Keywords are case-insensitive.
+func (t token) keyword(name string) bool {
+	return t.kind == tokID && !t.quoted && strings.EqualFold(t.val, name)
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokPunct && t.val == punct
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+type lexer struct {
+	s    string
+	i    int
+	line int
+}
+
+func (l *lexer) advance(n int) {
+	l.line += strings.Count(l.s[l.i:l.i+n], "\n")
+	l.i += n
+}
+
+func (l *lexer) skipSpace() error {
+	for l.i < len(l.s) {
+		switch rest := l.s[l.i:]; {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n':
+			l.advance(1)
+		case strings.HasPrefix(rest, "//") || (rest[0] == '#' && (l.i == 0 || l.s[l.i-1] == '\n')):
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			l.advance(n)
+		case strings.HasPrefix(rest, "/*"):
+			n := strings.Index(rest[2:], "*/")
+			if n < 0 {
+				return errors.New("unterminated comment")
+			}
+			l.advance(n + 4)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isIDStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *lexer) token() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	if l.i >= len(l.s) {
+		return token{kind: tokEOF}, nil
+	}
+	rest := l.s[l.i:]
+	switch c := rest[0]; {
+	case strings.HasPrefix(rest, "->") || strings.HasPrefix(rest, "--"):
+		l.advance(2)
+		return token{kind: tokEdgeOp, val: rest[:2]}, nil
+	case strings.IndexByte("{}[]=;,:", c) >= 0:
+		l.advance(1)
+		return token{kind: tokPunct, val: rest[:1]}, nil
+	case c == '"':
+		return l.quoted()
+	case c == '<':
+		return l.html()
+	case isIDStart(c):
+		n := 1
+		for n < len(rest) && (isIDStart(rest[n]) || isDigit(rest[n])) {
+			n++
+		}
+		l.advance(n)
+		return token{kind: tokID, val: rest[:n]}, nil
+	case isDigit(c) || c == '-' || c == '.':
+		n := 0
+		if c == '-' {
+			n++
+		}
+		for n < len(rest) && (isDigit(rest[n]) || rest[n] == '.') {
+			n++
+		}
+		if num := strings.TrimPrefix(rest[:n], "-"); num == "" || num == "." || strings.Count(num, ".") > 1 {
+			return token{}, fmt.Errorf("invalid number: %q", rest[:n])
+		}
+		l.advance(n)
+		return token{kind: tokID, val: rest[:n]}, nil
+	}
+	return token{}, fmt.Errorf("unexpected character %q", rest[0])
+}
+
+// quoted reads a quoted string, including strings concatenated with '+'.
+func (l *lexer) quoted() (token, error) {
+	var sb strings.Builder
+	for {
+		l.advance(1)
+		for {
+			if l.i >= len(l.s) {
+				return token{}, errors.New("unterminated string")
+			}
+			c := l.s[l.i]
+			if c == '"' {
+				l.advance(1)
+				break
+			} else if c == '\\' && l.i+1 < len(l.s) {
+				switch e := l.s[l.i+1]; e {
+				case '"', '\\':
+					sb.WriteByte(e)
+				case '\n':
+					// line continuation
+				default:
+					// other escape sequences are interpreted by Graphviz
+					sb.WriteByte(c)
+					sb.WriteByte(e)
+				}
+				l.advance(2)
+				continue
+			}
+			sb.WriteByte(c)
+			l.advance(1)
+		}
+		// check for a concatenation
+		i, line := l.i, l.line
+		if err := l.skipSpace(); err != nil {
+			return token{}, err
+		}
+		if !strings.HasPrefix(l.s[l.i:], "+") {
+			l.i, l.line = i, line
+			break
+		}
+		l.advance(1)
+		if err := l.skipSpace(); err != nil {
+			return token{}, err
+		} else if !strings.HasPrefix(l.s[l.i:], `"`) {
+			return token{}, errors.New("expected a string after '+'")
+		}
+	}
+	return token{kind: tokID, val: sb.String(), quoted: true}, nil
+}
+
+// html reads an HTML string in angle brackets.
+func (l *lexer) html() (token, error) {
+	depth := 0
+	for n := 0; l.i+n < len(l.s); n++ {
+		switch l.s[l.i+n] {
+		case '<':
+			depth++
+		case '>':
+			if depth--; depth == 0 {
+				val := l.s[l.i+1 : l.i+n]
+				l.advance(n + 1)
+				return token{kind: tokID, val: val, quoted: true}, nil
+			}
+		}
+	}
+	return token{}, errors.New("unterminated HTML string")
+}
+
+// attr is a single attribute from an attribute list.
+type attr struct {
+	name, val string
+}
+
+// scope holds default attributes of nodes and edges in a graph or a subgraph.
+type scope struct {
+	node, edge []attr
+}
+
+type parser struct {
+	lex    lexer
+	tok    token
+	peeked bool
+
+	g    graphconv.Graph
+	seen map[string]struct{}
+}
+
+func (p *parser) peek() (token, error) {
+	if !p.peeked {
+		t, err := p.lex.token()
+		if err != nil {
+			return t, err
+		}
+		p.tok, p.peeked = t, true
+	}
+	return p.tok, nil
+}
+
+func (p *parser) next() (token, error) {
+	t, err := p.peek()
+	p.peeked = false
+	return t, err
+}
+
+func (p *parser) expect(punct string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	} else if !t.is(punct) {
+		return fmt.Errorf("expected '%s', got %v", punct, t)
+	}
+	return nil
+}
+
+// document parses all graphs in a document.
+func (p *parser) document() error {
+	for {
+		t, err := p.next()
+		if err != nil {
+			return err
+		} else if t.kind == tokEOF {
+			return nil
+		}
+		if t.keyword("strict") {
+			if t, err = p.next(); err != nil {
+				return err
+			}
+		}
+		if !t.keyword("graph") && !t.keyword("digraph") {
+			return fmt.Errorf("expected a graph, got %v", t)
+		}
+		if t, err = p.peek(); err != nil {
+			return err
+		} else if t.kind == tokID {
+			p.next()
+		}
+		if err = p.expect("{"); err != nil {
+			return err
+		}
+		if _, err = p.statements(&scope{}); err != nil {
+			return err
+		}
+	}
+}
+
+// statements parses statements up to the closing brace, and returns IDs of all nodes they refer to.
+func (p *parser) statements(sc *scope) ([]string, error) {
+	var nodes []string
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case t.kind == tokEOF:
+			return nil, fmt.Errorf("expected '}', got %v", t)
+		case t.is("}"):
+			p.next()
+			return nodes, nil
+		case t.is(";"):
+			p.next()
+			continue
+		case t.keyword("graph") || t.keyword("node") || t.keyword("edge"):
+			p.next()
+			attrs, err := p.attrList()
+			if err != nil {
+				return nil, err
+			}
+			if t.keyword("node") {
+				sc.node = append(sc.node, attrs...)
+			} else if t.keyword("edge") {
+				sc.edge = append(sc.edge, attrs...)
+			}
+			continue
+		case t.kind == tokID && !t.keyword("subgraph"):
+			p.next()
+			if t2, err := p.peek(); err != nil {
+				return nil, err
+			} else if t2.is("=") {
+				// graph attribute
+				p.next()
+				if t2, err = p.next(); err != nil {
+					return nil, err
+				} else if t2.kind != tokID {
+					return nil, fmt.Errorf("expected a value, got %v", t2)
+				}
+				continue
+			}
+			if err = p.port(); err != nil {
+				return nil, err
+			}
+			if t2, err := p.peek(); err != nil {
+				return nil, err
+			} else if t2.kind != tokEdgeOp {
+				attrs, err := p.attrList()
+				if err != nil {
+					return nil, err
+				}
+				p.node(sc, t.val, attrs)
+				nodes = append(nodes, t.val)
+				continue
+			}
+			p.node(sc, t.val, nil)
+			ids, err := p.edges(sc, []string{t.val})
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, ids...)
+			continue
+		}
+		// a subgraph
+		left, err := p.operand(sc)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, left...)
+		if t, err = p.peek(); err != nil {
+			return nil, err
+		} else if t.kind == tokEdgeOp {
+			ids, err := p.edges(sc, left)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, ids...)
+		}
+	}
+}
+
+// port skips a port of a node, if any.
+func (p *parser) port() error {
+	for i := 0; i < 2; i++ {
+		if t, err := p.peek(); err != nil || !t.is(":") {
+			return err
+		}
+		p.next()
+		if t, err := p.next(); err != nil {
+			return err
+		} else if t.kind != tokID {
+			return fmt.Errorf("expected a port, got %v", t)
+		}
+	}
+	return nil
+}
+
+// operand parses a node or a subgraph in an edge statement, and returns IDs of nodes.
+func (p *parser) operand(sc *scope) ([]string, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == tokID && !t.keyword("subgraph") {
+		if err = p.port(); err != nil {
+			return nil, err
+		}
+		p.node(sc, t.val, nil)
+		return []string{t.val}, nil
+	}
+	if t.keyword("subgraph") {
+		if t, err = p.next(); err != nil {
+			return nil, err
+		} else if t.kind == tokID {
+			if t, err = p.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !t.is("{") {
+		return nil, fmt.Errorf("expected a node or a subgraph, got %v", t)
+	}
+	sub := &scope{node: sc.node[:len(sc.node):len(sc.node)], edge: sc.edge[:len(sc.edge):len(sc.edge)]}
+	return p.statements(sub)
+}
+
+// edges parses the rest of an edge statement, and returns IDs of nodes it refers to.
+func (p *parser) edges(sc *scope, left []string) ([]string, error) {
+	groups := [][]string{left}
+	var nodes []string
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		} else if t.kind != tokEdgeOp {
+			break
+		}
+		p.next()
+		right, err := p.operand(sc)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, right)
+		nodes = append(nodes, right...)
+	}
+	attrs, err := p.attrList()
+	if err != nil {
+		return nil, err
+	}
+	label, props := convert(append(sc.edge[:len(sc.edge):len(sc.edge)], attrs...))
+	for i := 1; i < len(groups); i++ {
+		for _, s := range groups[i-1] {
+			for _, o := range groups[i] {
+				p.g.AddEdge(graphconv.Edge{Source: s, Target: o, Label: label, Attrs: props})
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// node adds a node to the graph. Default attributes are applied to nodes that are seen for the first time.
+func (p *parser) node(sc *scope, id string, attrs []attr) {
+	if _, ok := p.seen[id]; !ok {
+		p.seen[id] = struct{}{}
+		attrs = append(sc.node[:len(sc.node):len(sc.node)], attrs...)
+	}
+	label, props := convert(attrs)
+	p.g.AddNode(graphconv.Node{ID: id, Label: label, Attrs: props})
+}
+
+// convert splits attributes into a label and other properties. Later attributes override earlier ones.
+func convert(attrs []attr) (string, []graphconv.Attr) {
+	var (
+		label string
+		props []graphconv.Attr
+		index = make(map[string]int)
+	)
+	for _, a := range attrs {
+		if a.name == "label" {
+			if a.val != `\N` { // default label of nodes
+				label = a.val
+			}
+			continue
+		}
+		if i, ok := index[a.name]; ok {
+			props[i].Value = quad.String(a.val)
+			continue
+		}
+		index[a.name] = len(props)
+		props = append(props, graphconv.Attr{Name: a.name, Value: quad.String(a.val)})
+	}
+	return label, props
+}
+
+// attrList parses optional attribute lists.
+func (p *parser) attrList() ([]attr, error) {
+	var out []attr
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		} else if !t.is("[") {
+			return out, nil
+		}
+		p.next()
+		for {
+			t, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.is("]") {
+				break
+			} else if t.is(";") || t.is(",") {
+				continue
+			} else if t.kind != tokID {
+				return nil, fmt.Errorf("expected an attribute, got %v", t)
+			}
+			if err = p.expect("="); err != nil {
+				return nil, err
+			}
+			v, err := p.next()
+			if err != nil {
+				return nil, err
+			} else if v.kind != tokID {
+				return nil, fmt.Errorf("expected a value, got %v", v)
+			}
+			out = append(out, attr{name: t.val, val: v.val})
+		}
+	}
+}
@@ -1,4 +1,4 @@
-// Package gml provides an encoder for Graph Modeling Format
+// Package gml provides an encoder and a decoder for Graph Modeling Format
 package gml
 
 import (
@@ -14,6 +14,7 @@ func init() {
 	quad.RegisterFormat(quad.Format{
 		Name:   "gml",
 		Ext:    []string{".gml"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewReader(r) },
 		Writer: func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
 	})
 }
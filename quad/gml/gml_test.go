@@ -3,6 +3,8 @@ package gml_test
 import (
 	"bytes"
 	"context"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aperturerobotics/cayley/quad"
@@ -70,3 +72,45 @@ func TestWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestReader(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range testData {
+		quads, err := quad.ReadAll(ctx, gml.NewReader(strings.NewReader(c.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c.quads, quads) {
+			t.Fatalf("wrong quads:\n%v\n\nvs\n\n%v", quads, c.quads)
+		}
+	}
+}
+
+func TestReaderAttributes(t *testing.T) {
+	const data = `# exported from another tool
+graph [
+	directed 0
+	node [ id 1 label "Router 1" ports 24 graphics [ x 1.5 y 2 ] ]
+	node [ id 2 load 0.75 ]
+	edge [ id 10 source 1 target 2 label "uplink" ]
+]
+`
+	exp := []quad.Quad{
+		{Subject: quad.BNode("1"), Predicate: quad.IRI("label"), Object: quad.String("Router 1")},
+		{Subject: quad.BNode("1"), Predicate: quad.IRI("ports"), Object: quad.Int(24)},
+		{Subject: quad.BNode("2"), Predicate: quad.IRI("load"), Object: quad.Float(0.75)},
+		{Subject: quad.BNode("1"), Predicate: quad.IRI("uplink"), Object: quad.BNode("2")},
+	}
+	quads, err := quad.ReadAll(context.Background(), gml.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exp, quads) {
+		t.Fatalf("wrong quads:\n%v\n\nvs\n\n%v", quads, exp)
+	}
+
+	_, err = quad.ReadAll(context.Background(), gml.NewReader(strings.NewReader("graph [\n node [ id 1 ]\n")))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatal("expected an error at the end of file, got:", err)
+	}
+}
@@ -0,0 +1,244 @@
+package gml
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/internal/graphconv"
+)
+
+// NewReader creates a GML reader.
+//
+// Scalar attributes of nodes and edges, other than identifiers and labels, are converted to properties.
+// Nested attributes, such as graphics, are ignored.
+func NewReader(r io.Reader) quad.ReadCloser {
+	return graphconv.NewReader(func() (*graphconv.Graph, error) {
+		p := &parser{r: bufio.NewReader(r), line: 1}
+		list, err := p.list(false)
+		if err != nil {
+			return nil, fmt.Errorf("gml: line %d: %w", p.line, err)
+		}
+		g, err := toGraph(list)
+		if err != nil {
+			return nil, fmt.Errorf("gml: %w", err)
+		}
+		return g, nil
+	})
+}
+
+// pair is a key-value pair. The value is either an int64, a float64, a string or a list.
+type pair struct {
+	key string
+	val any
+}
+
+type parser struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (p *parser) read() (byte, error) {
+	c, err := p.r.ReadByte()
+	if c == '\n' {
+		p.line++
+	}
+	return c, err
+}
+
+// skipSpace skips whitespace and comments, and returns the next character without consuming it.
+func (p *parser) skipSpace() (byte, error) {
+	for {
+		c, err := p.read()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		case '#':
+			for c != '\n' {
+				if c, err = p.read(); err != nil {
+					return 0, err
+				}
+			}
+		default:
+			return c, p.r.UnreadByte()
+		}
+	}
+}
+
+// word reads a sequence of characters that satisfy a function.
+func (p *parser) word(fnc func(c byte) bool) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := p.r.ReadByte()
+		if err == io.EOF {
+			return sb.String(), nil
+		} else if err != nil {
+			return "", err
+		} else if !fnc(c) {
+			return sb.String(), p.r.UnreadByte()
+		}
+		sb.WriteByte(c)
+	}
+}
+
+func isKeyChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isNumChar(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '+' || c == 'e' || c == 'E'
+}
+
+// list reads key-value pairs up to the end of a list, or up to the end of the document.
+func (p *parser) list(nested bool) ([]pair, error) {
+	var out []pair
+	for {
+		c, err := p.skipSpace()
+		if err == io.EOF && !nested {
+			return out, nil
+		} else if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+		if c == ']' && nested {
+			p.read()
+			return out, nil
+		} else if !isKeyChar(c) || (c >= '0' && c <= '9') {
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+		key, err := p.word(isKeyChar)
+		if err != nil {
+			return nil, err
+		}
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pair{key: key, val: val})
+	}
+}
+
+func (p *parser) value() (any, error) {
+	c, err := p.skipSpace()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	switch {
+	case c == '[':
+		p.read()
+		return p.list(true)
+	case c == '"':
+		p.read()
+		var sb strings.Builder
+		for {
+			c, err := p.read()
+			if err == io.EOF {
+				return nil, errors.New("unterminated string")
+			} else if err != nil {
+				return nil, err
+			} else if c == '"' {
+				return html.UnescapeString(sb.String()), nil
+			}
+			sb.WriteByte(c)
+		}
+	case isNumChar(c):
+		s, err := p.word(isNumChar)
+		if err != nil {
+			return nil, err
+		}
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v, nil
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %q", s)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unexpected character %q", c)
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return ""
+}
+
+func toValue(v any) quad.Value {
+	switch v := v.(type) {
+	case int64:
+		return quad.Int(v)
+	case float64:
+		return quad.Float(v)
+	case string:
+		return quad.String(v)
+	}
+	return nil
+}
+
+func toGraph(doc []pair) (*graphconv.Graph, error) {
+	var g graphconv.Graph
+	for _, gr := range doc {
+		list, ok := gr.val.([]pair)
+		if gr.key != "graph" || !ok {
+			continue
+		}
+		for _, el := range list {
+			attrs, ok := el.val.([]pair)
+			if !ok || (el.key != "node" && el.key != "edge") {
+				continue
+			}
+			var (
+				n graphconv.Node
+				e graphconv.Edge
+			)
+			for _, a := range attrs {
+				switch {
+				case a.key == "label":
+					n.Label = toString(a.val)
+				case el.key == "node" && a.key == "id":
+					n.ID = toString(a.val)
+				case el.key == "edge" && a.key == "id":
+					// edges are identified by nodes they connect
+				case el.key == "edge" && a.key == "source":
+					e.Source = toString(a.val)
+				case el.key == "edge" && a.key == "target":
+					e.Target = toString(a.val)
+				default:
+					if v := toValue(a.val); v != nil {
+						n.Attrs = append(n.Attrs, graphconv.Attr{Name: a.key, Value: v})
+					}
+				}
+			}
+			if el.key == "node" {
+				if n.ID == "" {
+					return nil, errors.New("node without an id")
+				}
+				g.AddNode(n)
+				continue
+			}
+			if e.Source == "" || e.Target == "" {
+				return nil, errors.New("edge without a source or a target")
+			}
+			e.Label, e.Attrs = n.Label, n.Attrs
+			g.AddEdge(e)
+		}
+	}
+	return &g, nil
+}
@@ -1,4 +1,4 @@
-// Package graphml provides an encoder for GraphML format
+// Package graphml provides an encoder and a decoder for GraphML format
 package graphml
 
 import (
@@ -15,6 +15,7 @@ func init() {
 		Name:   "graphml",
 		Ext:    []string{".graphml"},
 		Mime:   []string{"application/xml"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewReader(r) },
 		Writer: func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
 	})
 }
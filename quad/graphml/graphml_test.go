@@ -3,6 +3,8 @@ package graphml_test
 import (
 	"bytes"
 	"context"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aperturerobotics/cayley/quad"
@@ -76,3 +78,57 @@ func TestWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestReader(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range testData {
+		quads, err := quad.ReadAll(ctx, graphml.NewReader(strings.NewReader(c.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c.quads, quads) {
+			t.Fatalf("wrong quads:\n%v\n\nvs\n\n%v", quads, c.quads)
+		}
+	}
+}
+
+func TestReaderAttributes(t *testing.T) {
+	const data = `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:y="http://www.yworks.com/xml/graphml">
+	<key id="name" for="node" attr.name="label" attr.type="string"/>
+	<key id="w" for="edge" attr.name="weight" attr.type="double"><default>1</default></key>
+	<key id="up" for="node" attr.name="up" attr.type="boolean"/>
+	<key id="g" for="node" yfiles.type="nodegraphics"/>
+	<graph id="G" edgedefault="undirected">
+		<node id="r1"><data key="name">Router 1</data><data key="up">true</data></node>
+		<node id="r2"><data key="g"><y:ShapeNode><y:Fill color="#FFCC00"/></y:ShapeNode></data></node>
+		<edge source="r1" target="r2"><data key="w">2.5</data></edge>
+		<edge source="r2" target="r1"/>
+	</graph>
+</graphml>
+`
+	rdf := func(s string) quad.IRI { return quad.IRI("http://www.w3.org/1999/02/22-rdf-syntax-ns#" + s) }
+	exp := []quad.Quad{
+		{Subject: quad.BNode("r1"), Predicate: quad.IRI("label"), Object: quad.String("Router 1")},
+		{Subject: quad.BNode("r1"), Predicate: quad.IRI("up"), Object: quad.Bool(true)},
+		{Subject: quad.BNode("r1"), Predicate: quad.IRI("edge"), Object: quad.BNode("r2")},
+		{Subject: quad.BNode("e1"), Predicate: rdf("type"), Object: rdf("Statement")},
+		{Subject: quad.BNode("e1"), Predicate: rdf("subject"), Object: quad.BNode("r1")},
+		{Subject: quad.BNode("e1"), Predicate: rdf("predicate"), Object: quad.IRI("edge")},
+		{Subject: quad.BNode("e1"), Predicate: rdf("object"), Object: quad.BNode("r2")},
+		{Subject: quad.BNode("e1"), Predicate: quad.IRI("weight"), Object: quad.Float(2.5)},
+		{Subject: quad.BNode("r2"), Predicate: quad.IRI("edge"), Object: quad.BNode("r1")},
+		{Subject: quad.BNode("e2"), Predicate: rdf("type"), Object: rdf("Statement")},
+		{Subject: quad.BNode("e2"), Predicate: rdf("subject"), Object: quad.BNode("r2")},
+		{Subject: quad.BNode("e2"), Predicate: rdf("predicate"), Object: quad.IRI("edge")},
+		{Subject: quad.BNode("e2"), Predicate: rdf("object"), Object: quad.BNode("r1")},
+		{Subject: quad.BNode("e2"), Predicate: quad.IRI("weight"), Object: quad.Float(1)},
+	}
+	quads, err := quad.ReadAll(context.Background(), graphml.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exp, quads) {
+		t.Fatalf("wrong quads:\n%v\n\nvs\n\n%v", quads, exp)
+	}
+}
@@ -0,0 +1,201 @@
+package graphml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/internal/graphconv"
+)
+
+// NewReader creates a GraphML reader.
+//
+// Node and edge labels are read from attributes named "description", as written by Writer, or "label".
+// Other attributes are converted to properties of nodes and edges.
+func NewReader(r io.Reader) quad.ReadCloser {
+	return graphconv.NewReader(func() (*graphconv.Graph, error) {
+		g, err := parse(r)
+		if err != nil {
+			return nil, fmt.Errorf("graphml: %w", err)
+		}
+		return g, nil
+	})
+}
+
+// key is a declaration of an attribute.
+type key struct {
+	name string
+	typ  string
+	dom  string // node, edge or all
+	def  *string
+}
+
+// isLabel checks if an attribute holds labels of nodes and edges.
+func (k *key) isLabel() bool {
+	return strings.EqualFold(k.name, "description") || strings.EqualFold(k.name, "label")
+}
+
+func (k *key) value(s string) (quad.Value, error) {
+	switch k.typ {
+	case "int", "long":
+		v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		return quad.Int(v), err
+	case "float", "double":
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return quad.Float(v), err
+	case "boolean":
+		v, err := strconv.ParseBool(strings.TrimSpace(s))
+		return quad.Bool(v), err
+	}
+	return quad.String(s), nil
+}
+
+// element is a node or an edge with its attributes.
+type element struct {
+	dom   string
+	node  graphconv.Node
+	edge  graphconv.Edge
+	label string
+	data  map[string]string
+}
+
+func parse(r io.Reader) (*graphconv.Graph, error) {
+	var (
+		g     graphconv.Graph
+		dec   = xml.NewDecoder(r)
+		keys  = make(map[string]*key)
+		order []string // keys in the order of declaration
+
+		stack  []*element // nodes may contain nested graphs
+		cur    *key       // key with a default value being read
+		data   string     // key of the data being read
+		text   strings.Builder
+		depth  int  // depth of elements inside data, which are ignored
+		nested bool // the data has child elements
+	)
+	attr := func(e xml.StartElement, name string) string {
+		for _, a := range e.Attr {
+			if a.Name.Local == name {
+				return a.Value
+			}
+		}
+		return ""
+	}
+	finish := func(el *element) error {
+		var attrs []graphconv.Attr
+		for _, id := range order {
+			k := keys[id]
+			if k.dom != el.dom && k.dom != "all" {
+				continue
+			}
+			s, ok := el.data[id]
+			if !ok && k.def == nil {
+				continue
+			} else if !ok {
+				s = *k.def
+			}
+			if k.isLabel() && el.label == "" {
+				el.label = s
+				continue
+			}
+			v, err := k.value(s)
+			if err != nil {
+				return fmt.Errorf("invalid value of %q: %w", k.name, err)
+			}
+			attrs = append(attrs, graphconv.Attr{Name: k.name, Value: v})
+		}
+		if el.dom == "node" {
+			el.node.Label, el.node.Attrs = el.label, attrs
+			g.AddNode(el.node)
+		} else {
+			el.edge.Label, el.edge.Attrs = el.label, attrs
+			g.AddEdge(el.edge)
+		}
+		return nil
+	}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return &g, nil
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if data != "" || depth != 0 {
+				// structured data, such as graphics of yEd
+				depth++
+				nested = true
+				continue
+			}
+			switch tok.Name.Local {
+			case "key":
+				id := attr(tok, "id")
+				k := &key{name: attr(tok, "attr.name"), typ: attr(tok, "attr.type"), dom: attr(tok, "for")}
+				if k.name == "" {
+					k.name = id
+				}
+				if k.dom == "" {
+					k.dom = "all"
+				}
+				if _, ok := keys[id]; !ok {
+					order = append(order, id)
+				}
+				keys[id], cur = k, k
+			case "default":
+				text.Reset()
+			case "node":
+				stack = append(stack, &element{dom: "node", node: graphconv.Node{ID: attr(tok, "id")}, data: make(map[string]string)})
+			case "edge":
+				stack = append(stack, &element{dom: "edge", edge: graphconv.Edge{
+					Source: attr(tok, "source"),
+					Target: attr(tok, "target"),
+				}, data: make(map[string]string)})
+			case "data":
+				data, nested = attr(tok, "key"), false
+				text.Reset()
+			}
+		case xml.CharData:
+			if depth == 0 {
+				text.Write(tok)
+			}
+		case xml.EndElement:
+			if depth != 0 {
+				depth--
+				continue
+			}
+			switch tok.Name.Local {
+			case "default":
+				if cur != nil {
+					def := text.String()
+					cur.def = &def
+				}
+			case "key":
+				cur = nil
+			case "data":
+				if len(stack) != 0 && data != "" && !nested {
+					stack[len(stack)-1].data[data] = text.String()
+				}
+				data = ""
+			case "node", "edge":
+				if len(stack) == 0 {
+					return nil, fmt.Errorf("unexpected end of %s", tok.Name.Local)
+				}
+				el := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if el.dom == "node" && el.node.ID == "" {
+					return nil, errors.New("node without an id")
+				} else if el.dom == "edge" && (el.edge.Source == "" || el.edge.Target == "") {
+					return nil, errors.New("edge without a source or a target")
+				}
+				if err = finish(el); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package graphconv converts graphs of nodes and edges, as described by graph drawing formats, to quads.
+//
+// Conversion follows conventions of writers for these formats: labels of nodes and edges hold values
+// in N-Quads syntax. Graphs created by other tools are converted as follows:
+//
+//   - A node with a label that is not a valid value is a blank node named by node ID, unless the ID itself
+//     is a valid value. The label is converted to a <label> property of the node.
+//   - Other attributes of a node are converted to properties named by attributes.
+//   - An edge with a label that is not a valid value has an IRI with the label as a predicate,
+//     and edges without labels have an <edge> predicate.
+//   - Attributes of an edge are converted to properties of a blank node that reifies the edge,
+//     as an rdf:Statement.
+package graphconv
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/nquads"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+)
+
+const (
+	// LabelPredicate is a predicate of node labels that are not valid values.
+	LabelPredicate = quad.IRI("label")
+	// EdgePredicate is a predicate of edges without labels.
+	EdgePredicate = quad.IRI("edge")
+)
+
+var (
+	rdfType      = quad.IRI(rdf.NS + "type")
+	rdfStatement = quad.IRI(rdf.NS + "Statement")
+	rdfSubject   = quad.IRI(rdf.NS + "subject")
+	rdfPredicate = quad.IRI(rdf.NS + "predicate")
+	rdfObject    = quad.IRI(rdf.NS + "object")
+)
+
+// Attr is an attribute of a node or an edge.
+type Attr struct {
+	Name  string
+	Value quad.Value
+}
+
+// Node is a node of a graph.
+type Node struct {
+	ID    string
+	Label string
+	Attrs []Attr
+}
+
+// Edge is a directed edge of a graph.
+type Edge struct {
+	Source string
+	Target string
+	Label  string
+	Attrs  []Attr
+}
+
+// Graph is a set of nodes and edges.
+type Graph struct {
+	nodes []Node
+	index map[string]int
+	edges []Edge
+}
+
+// AddNode adds a node to the graph. Attributes of a node with the same ID are merged.
+func (g *Graph) AddNode(n Node) {
+	if g.index == nil {
+		g.index = make(map[string]int)
+	}
+	i, ok := g.index[n.ID]
+	if !ok {
+		g.index[n.ID] = len(g.nodes)
+		g.nodes = append(g.nodes, n)
+		return
+	}
+	cur := &g.nodes[i]
+	if n.Label != "" {
+		cur.Label = n.Label
+	}
+	cur.Attrs = append(cur.Attrs, n.Attrs...)
+}
+
+// AddEdge adds an edge to the graph. Nodes that are not in the graph are identified by their IDs.
+func (g *Graph) AddEdge(e Edge) {
+	g.edges = append(g.edges, e)
+}
+
+// ParseValue parses a value in N-Quads syntax. Unlike the N-Quads reader, it doesn't accept unquoted strings.
+func ParseValue(s string) (quad.Value, bool) {
+	if !strings.HasPrefix(s, "<") && !strings.HasPrefix(s, "_:") && !strings.HasPrefix(s, `"`) {
+		return nil, false
+	}
+	q, err := nquads.Parse("<s> <p> " + s + " .")
+	if err != nil || q.Label != nil {
+		return nil, false
+	}
+	return q.Object, true
+}
+
+// Quads converts the graph to quads.
+func (g *Graph) Quads() []quad.Quad {
+	var (
+		out    []quad.Quad
+		values = make(map[string]quad.Value)
+		used   = make(map[string]struct{})
+	)
+	emit := func(s, p, o quad.Value) {
+		out = append(out, quad.Quad{Subject: s, Predicate: p, Object: o})
+	}
+	value := func(id string) quad.Value {
+		if v, ok := values[id]; ok {
+			return v
+		}
+		v, ok := ParseValue(id)
+		if !ok {
+			v = quad.BNode(id)
+		}
+		if b, ok := v.(quad.BNode); ok {
+			used[string(b)] = struct{}{}
+		}
+		values[id] = v
+		return v
+	}
+	for _, n := range g.nodes {
+		if v, ok := ParseValue(n.Label); ok {
+			values[n.ID] = v
+			if b, ok := v.(quad.BNode); ok {
+				used[string(b)] = struct{}{}
+			}
+			n.Label = ""
+		}
+		v := value(n.ID)
+		if n.Label != "" {
+			emit(v, LabelPredicate, quad.String(n.Label))
+		}
+		for _, a := range n.Attrs {
+			emit(v, quad.IRI(a.Name), a.Value)
+		}
+	}
+	next := 0
+	newBNode := func() quad.BNode {
+		for {
+			next++
+			label := "e" + strconv.Itoa(next)
+			if _, ok := used[label]; !ok {
+				used[label] = struct{}{}
+				return quad.BNode(label)
+			}
+		}
+	}
+	// node values must be known before generating blank nodes for edges
+	for _, e := range g.edges {
+		value(e.Source)
+		value(e.Target)
+	}
+	for _, e := range g.edges {
+		s, o := value(e.Source), value(e.Target)
+		p, ok := ParseValue(e.Label)
+		if !ok && e.Label != "" {
+			p = quad.IRI(e.Label)
+		} else if !ok {
+			p = EdgePredicate
+		}
+		emit(s, p, o)
+		if len(e.Attrs) == 0 {
+			continue
+		}
+		st := newBNode()
+		emit(st, rdfType, rdfStatement)
+		emit(st, rdfSubject, s)
+		emit(st, rdfPredicate, p)
+		emit(st, rdfObject, o)
+		for _, a := range e.Attrs {
+			emit(st, quad.IRI(a.Name), a.Value)
+		}
+	}
+	return out
+}
+
+// Reader returns quads of a graph, which is parsed on the first read.
+type Reader struct {
+	parse func() (*Graph, error)
+	quads []quad.Quad
+	err   error
+}
+
+// NewReader creates a reader for a graph returned by the parse function.
+// The whole document is read at once, since edges may refer to nodes defined after them.
+func NewReader(parse func() (*Graph, error)) *Reader {
+	return &Reader{parse: parse}
+}
+
+func (r *Reader) ReadQuad(ctx context.Context) (quad.Quad, error) {
+	if r.parse != nil {
+		g, err := r.parse()
+		r.parse = nil
+		if err != nil {
+			r.err = err
+		} else {
+			r.quads = g.Quads()
+		}
+	}
+	if r.err != nil {
+		return quad.Quad{}, r.err
+	} else if len(r.quads) == 0 {
+		return quad.Quad{}, io.EOF
+	}
+	q := r.quads[0]
+	r.quads = r.quads[1:]
+	return q, nil
+}
+
+func (r *Reader) Close() error { return nil }
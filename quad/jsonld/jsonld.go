@@ -236,6 +236,9 @@ func ToNode(value quad.Value) (ld.Node, error) {
 		return ld.NewLiteral(string(v.Value), string(v.Type), ""), nil
 	case quad.LangString:
 		return ld.NewLiteral(string(v.Value), "", v.Lang), nil
+	case quad.TypedStringer:
+		ts := v.TypedString()
+		return ld.NewLiteral(string(ts.Value), string(ts.Type.Full()), ""), nil
 	default:
 		return nil, fmt.Errorf("can not convert %v to ld.Node", value)
 	}
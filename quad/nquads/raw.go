@@ -35,10 +35,10 @@ const raw_en_statement int = 1
 
 // line 117 "raw.rl"
 
-// ParseRaw returns a valid quad.Quad or a non-nil error. ParseRaw does
+// parseRaw returns a valid quad.Quad or a non-nil error. parseRaw does
 // handle comments except where the comment placement does not prevent
 // a complete valid quad.Quad from being defined.
-func ParseRaw(statement string) (quad.Quad, error) {
+func parseRaw(statement string) (quad.Quad, error) {
 	data := []rune(statement)
 
 	var (
@@ -0,0 +1,130 @@
+package nquads
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// Parse returns a valid quad.Quad or a non-nil error. Parse does
+// handle comments except where the comment placement does not prevent
+// a complete valid quad.Quad from being defined.
+//
+// Quoted triples (ex: << <s> <p> <o> >>) are accepted as subjects and objects, as defined by N-Quads-star.
+func Parse(statement string) (quad.Quad, error) {
+	return parseStar(statement, parse)
+}
+
+// ParseRaw is the same as Parse, but values are parsed as defined by N-Quads specification.
+func ParseRaw(statement string) (quad.Quad, error) {
+	return parseStar(statement, parseRaw)
+}
+
+// parseStar replaces quoted triples in a statement with placeholder IRIs, thus the statement can be parsed
+// by the N-Quads parser. Quoted triples are parsed recursively and substituted back to the quad.
+func parseStar(statement string, parse func(string) (quad.Quad, error)) (quad.Quad, error) {
+	if !strings.Contains(statement, "<<") {
+		return parse(statement)
+	}
+	spans, err := quotedSpans(statement)
+	if err != nil {
+		return quad.Quad{}, err
+	} else if len(spans) == 0 {
+		return parse(statement)
+	}
+	var (
+		sb     strings.Builder
+		quoted = make(map[quad.IRI]quad.Quoted, len(spans))
+		last   int
+	)
+	for i, sp := range spans {
+		q, err := parseStar(statement[sp[0]+2:sp[1]-2]+" .", parse)
+		if err != nil {
+			return quad.Quad{}, err
+		} else if q.Label != nil {
+			return quad.Quad{}, errors.New("quoted triple cannot have a label")
+		}
+		iri := placeholder(statement, i)
+		quoted[iri] = quad.Quote(q)
+		sb.WriteString(statement[last:sp[0]])
+		sb.WriteString(iri.String())
+		last = sp[1]
+	}
+	sb.WriteString(statement[last:])
+	q, err := parse(sb.String())
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		iri, ok := q.Get(d).(quad.IRI)
+		if !ok {
+			continue
+		}
+		v, ok := quoted[iri]
+		if !ok {
+			continue
+		} else if d != quad.Subject && d != quad.Object {
+			return quad.Quad{}, fmt.Errorf("quoted triple cannot be a %v", d)
+		}
+		q.Set(d, v)
+	}
+	return q, nil
+}
+
+// placeholder returns an IRI that is not used in a statement.
+func placeholder(statement string, i int) quad.IRI {
+	iri := fmt.Sprintf("urn:x-quoted:%d", i)
+	for strings.Contains(statement, iri) {
+		iri += "_"
+	}
+	return quad.IRI(iri)
+}
+
+// quotedSpans returns offsets of quoted triples in a statement, excluding nested ones.
+func quotedSpans(s string) ([][2]int, error) {
+	var (
+		out   [][2]int
+		depth int
+		start int
+	)
+scan:
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			// string literal
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case c == '#' && depth == 0:
+			// comment
+			break scan
+		case strings.HasPrefix(s[i:], "<<"):
+			if depth == 0 {
+				start = i
+			}
+			depth++
+			i++
+		case strings.HasPrefix(s[i:], ">>") && depth != 0:
+			depth--
+			i++
+			if depth == 0 {
+				out = append(out, [2]int{start, i + 1})
+			}
+		case c == '<':
+			// IRI
+			j := strings.IndexByte(s[i:], '>')
+			if j < 0 {
+				break scan
+			}
+			i += j
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unterminated quoted triple")
+	}
+	return out, nil
+}
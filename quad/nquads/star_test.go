@@ -0,0 +1,108 @@
+package nquads
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+var (
+	bobAge = quad.Quoted{
+		Subject:   quad.IRI("http://example.org/bob"),
+		Predicate: quad.IRI("http://example.org/age"),
+		Object:    quad.Int(23),
+	}
+	bobSays = quad.Quoted{
+		Subject:   quad.IRI("http://example.org/bob"),
+		Predicate: quad.IRI("http://example.org/says"),
+		Object:    quad.String("a >> b"),
+	}
+)
+
+var testStar = []struct {
+	message string
+	input   string
+	expect  quad.Quad
+	err     string
+}{
+	{
+		message: "parse quoted subject",
+		input:   `<< <http://example.org/bob> <http://example.org/age> "23"^^<http://www.w3.org/2001/XMLSchema#integer> >> <http://example.org/source> <http://example.org/census> .`,
+		expect: quad.Quad{
+			Subject:   bobAge,
+			Predicate: quad.IRI("http://example.org/source"),
+			Object:    quad.IRI("http://example.org/census"),
+		},
+	},
+	{
+		message: "parse quoted object with a string and a comment",
+		input:   `_:a <http://example.org/doubts> <<<http://example.org/bob> <http://example.org/says> "a >> b">> <http://example.org/graph> . # << comment`,
+		expect: quad.Quad{
+			Subject:   quad.BNode("a"),
+			Predicate: quad.IRI("http://example.org/doubts"),
+			Object:    bobSays,
+			Label:     quad.IRI("http://example.org/graph"),
+		},
+	},
+	{
+		message: "parse nested quoted triples",
+		input:   `<< _:a <http://example.org/doubts> << <http://example.org/bob> <http://example.org/age> "23"^^<http://www.w3.org/2001/XMLSchema#integer> >> >> <http://example.org/source> << <http://example.org/bob> <http://example.org/says> "a >> b" >> .`,
+		expect: quad.Quad{
+			Subject:   quad.Quoted{Subject: quad.BNode("a"), Predicate: quad.IRI("http://example.org/doubts"), Object: bobAge},
+			Predicate: quad.IRI("http://example.org/source"),
+			Object:    bobSays,
+		},
+	},
+	{
+		message: "reject quoted predicate",
+		input:   `_:a << _:b <p> <o> >> <o> .`,
+		err:     "quoted triple cannot be a predicate",
+	},
+	{
+		message: "reject quoted triple with a label",
+		input:   `<< _:b <p> <o> <g> >> <p> <o> .`,
+		err:     "quoted triple cannot have a label",
+	},
+	{
+		message: "reject unterminated quoted triple",
+		input:   `<< _:b <p> <o> <p> <o> .`,
+		err:     "unterminated quoted triple",
+	},
+}
+
+func TestParseStar(t *testing.T) {
+	for _, test := range testStar {
+		t.Run(test.message, func(t *testing.T) {
+			got, err := Parse(test.input)
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expect, got)
+		})
+	}
+}
+
+func TestWriteStar(t *testing.T) {
+	ctx := context.Background()
+	quads := []quad.Quad{
+		{Subject: bobAge, Predicate: quad.IRI("http://example.org/source"), Object: quad.IRI("http://example.org/census")},
+		{Subject: quad.BNode("a"), Predicate: quad.IRI("http://example.org/doubts"), Object: quad.Quoted{
+			Subject: quad.BNode("c"), Predicate: quad.IRI("http://example.org/quotes"), Object: bobSays,
+		}},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_, err := quad.Copy(ctx, w, quad.NewReader(quads))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	got, err := quad.ReadAll(ctx, NewReader(&buf, false))
+	require.NoError(t, err)
+	require.Equal(t, quads, got)
+}
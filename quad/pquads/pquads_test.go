@@ -100,3 +100,26 @@ func TestPQuads(t *testing.T) {
 		})
 	}
 }
+
+func TestQuotedValue(t *testing.T) {
+	ctx := context.Background()
+	v := quad.Quoted{
+		Subject:   quad.BNode("a"),
+		Predicate: quad.IRI("http://example.org/says"),
+		Object: quad.Quoted{
+			Subject:   quad.IRI("http://example.org/bob"),
+			Predicate: quad.IRI("http://example.org/age"),
+			Object:    quad.Int(23),
+		},
+	}
+	data, err := pquads.MarshalValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := pquads.UnmarshalValue(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(v, got) {
+		t.Fatalf("corrupted value:\n%#v\n%#v", v, got)
+	}
+}
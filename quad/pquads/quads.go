@@ -1,11 +1,13 @@
 package pquads
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"time"
 
 	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/nquads"
 )
 
 // MakeValue converts quad.Value to its protobuf representation.
@@ -38,6 +40,9 @@ func MakeValue(qv quad.Value) *Value {
 		return &Value{Value: &Value_Float{float64(v)}}
 	case quad.Bool:
 		return &Value{Value: &Value_Boolean{bool(v)}}
+	case quad.Quoted:
+		// quoted triples are stored in N-Quads-star syntax
+		return &Value{Value: &Value_Raw{[]byte(v.String())}}
 	case quad.Time:
 		t := time.Time(v)
 		seconds := t.Unix()
@@ -78,6 +83,12 @@ func (m *Value) ToNative() (qv quad.Value) {
 	}
 	switch v := m.Value.(type) {
 	case *Value_Raw:
+		if bytes.HasPrefix(v.Raw, []byte("<<")) {
+			q, err := nquads.Parse("<s> <p> " + string(v.Raw) + " .")
+			if qv, ok := q.Object.(quad.Quoted); ok && err == nil {
+				return qv
+			}
+		}
 		return quad.StringToValue(string(v.Raw))
 	case *Value_Str:
 		return quad.String(v.Str)
@@ -0,0 +1,561 @@
+// Package rdfxml implements reading and writing of the RDF/XML (https://www.w3.org/TR/rdf-syntax-grammar/) format.
+package rdfxml
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/nquads"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+)
+
+func init() {
+	quad.RegisterFormat(quad.Format{
+		Name:   "rdfxml",
+		Ext:    []string{".rdf", ".owl"},
+		Mime:   []string{"application/rdf+xml"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewReader(r) },
+		Writer: func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
+	})
+}
+
+// xmlNS is a namespace of xml:lang and xml:base attributes.
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+var (
+	rdfType       = quad.IRI(rdf.NS + "type")
+	rdfFirst      = quad.IRI(rdf.NS + "first")
+	rdfRest       = quad.IRI(rdf.NS + "rest")
+	rdfNil        = quad.IRI(rdf.NS + "nil")
+	rdfStatement  = quad.IRI(rdf.NS + "Statement")
+	rdfSubject    = quad.IRI(rdf.NS + "subject")
+	rdfPredicate  = quad.IRI(rdf.NS + "predicate")
+	rdfObject     = quad.IRI(rdf.NS + "object")
+	rdfXMLLiteral = quad.IRI(rdf.NS + "XMLLiteral")
+)
+
+// reEntity matches entity declarations in a DOCTYPE, commonly used by OWL ontologies.
+var reEntity = regexp.MustCompile(`<!ENTITY\s+([^\s%]+)\s+(?:"([^"]*)"|'([^']*)')\s*>`)
+
+// Reader is a streaming parser of RDF/XML documents.
+//
+// Each top-level node element is parsed at once, thus the memory used by the reader
+// depends only on the size of the largest description in the document.
+// Typed literals are converted to native values in the same way as nquads.AutoConvertTypedString does.
+type Reader struct {
+	dec  *xml.Decoder
+	root scope
+
+	started bool // the root element was read
+	inRDF   bool // the root element is rdf:RDF
+
+	bnodes map[string]quad.BNode // blank node labels from the document
+	used   map[string]struct{}   // labels of all blank nodes
+	nextID int
+
+	queue []quad.Quad
+	err   error
+}
+
+// NewReader creates an RDF/XML reader.
+func NewReader(r io.Reader) *Reader {
+	dec := xml.NewDecoder(r)
+	dec.Entity = make(map[string]string)
+	return &Reader{
+		dec:    dec,
+		bnodes: make(map[string]quad.BNode),
+		used:   make(map[string]struct{}),
+	}
+}
+
+// SetBase sets a base IRI to resolve relative IRIs against. It can be changed by xml:base attributes.
+func (r *Reader) SetBase(base string) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	r.root.base = u
+	return nil
+}
+
+// ReadQuad returns the next quad from the document, or io.EOF at the end of it.
+func (r *Reader) ReadQuad(ctx context.Context) (quad.Quad, error) {
+	for len(r.queue) == 0 {
+		if r.err != nil {
+			return quad.Quad{}, r.err
+		}
+		if err := r.nextNode(); err == io.EOF {
+			r.err = io.EOF
+		} else if err != nil {
+			line, _ := r.dec.InputPos()
+			r.err = fmt.Errorf("rdfxml: line %d: %w", line, err)
+		}
+	}
+	q := r.queue[0]
+	r.queue[0] = quad.Quad{}
+	r.queue = r.queue[1:]
+	return q, nil
+}
+
+func (r *Reader) Close() error { return nil }
+
+func (r *Reader) emit(s, p, o quad.Value) {
+	r.queue = append(r.queue, quad.Quad{Subject: s, Predicate: p, Object: o})
+}
+
+// token returns the next token from the document, and an io.ErrUnexpectedEOF if the document ends.
+func (r *Reader) token() (xml.Token, error) {
+	tok, err := r.dec.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return tok, err
+}
+
+// nextNode reads the next top-level node element.
+func (r *Reader) nextNode() error {
+	for {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.Directive:
+			if !r.started {
+				r.entities(tok)
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) != 0 {
+				return errors.New("unexpected text outside of node elements")
+			}
+		case xml.StartElement:
+			if !r.started && isRDF(tok.Name, "RDF") {
+				r.started, r.inRDF = true, true
+				r.root, err = r.scope(tok, r.root)
+				return err
+			} else if r.started && !r.inRDF {
+				return errors.New("multiple root elements")
+			}
+			r.started = true
+			_, err = r.nodeElement(tok, r.root)
+			return err
+		case xml.EndElement:
+			// end of rdf:RDF
+			r.inRDF = false
+		}
+	}
+}
+
+// entities registers entities declared in a DOCTYPE.
+func (r *Reader) entities(d xml.Directive) {
+	for _, m := range reEntity.FindAllStringSubmatch(string(d), -1) {
+		r.dec.Entity[m[1]] = m[2] + m[3]
+	}
+}
+
+// scope holds the base IRI and the language inherited by elements.
+type scope struct {
+	base *url.URL
+	lang string
+}
+
+func (sc scope) resolve(s string) (quad.IRI, error) {
+	if sc.base == nil {
+		return quad.IRI(s), nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return quad.IRI(sc.base.ResolveReference(u).String()), nil
+}
+
+// id returns an IRI for an rdf:ID attribute.
+func (sc scope) id(s string) (quad.IRI, error) {
+	return sc.resolve("#" + s)
+}
+
+func (sc scope) literal(s string) quad.Value {
+	if sc.lang != "" {
+		return quad.LangString{Value: quad.String(s), Lang: sc.lang}
+	}
+	return quad.String(s)
+}
+
+// scope applies xml:base and xml:lang attributes of an element.
+func (r *Reader) scope(e xml.StartElement, sc scope) (scope, error) {
+	for _, a := range e.Attr {
+		if a.Name.Space != xmlNS {
+			continue
+		}
+		switch a.Name.Local {
+		case "lang":
+			sc.lang = a.Value
+		case "base":
+			u, err := url.Parse(a.Value)
+			if err != nil {
+				return sc, err
+			}
+			if sc.base != nil {
+				u = sc.base.ResolveReference(u)
+			}
+			u.Fragment = ""
+			sc.base = u
+		}
+	}
+	return sc, nil
+}
+
+func isRDF(name xml.Name, local string) bool {
+	return name.Space == rdf.NS && name.Local == local
+}
+
+func attr(e xml.StartElement, local string) (string, bool) {
+	for _, a := range e.Attr {
+		if isRDF(a.Name, local) {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func nameIRI(name xml.Name) (quad.IRI, error) {
+	if name.Space == "" {
+		return "", fmt.Errorf("element or attribute without a namespace: %q", name.Local)
+	}
+	return quad.IRI(name.Space + name.Local), nil
+}
+
+// isPropertyAttr checks if an attribute describes a property, rather than being a part of the syntax.
+func isPropertyAttr(name xml.Name) bool {
+	switch name.Space {
+	case "", "xmlns", xmlNS:
+		return false
+	case rdf.NS:
+		switch name.Local {
+		case "about", "nodeID", "ID", "resource", "datatype", "parseType", "li", "aboutEach", "aboutEachPrefix", "bagID":
+			return false
+		}
+	}
+	return true
+}
+
+// propertyAttrs emits properties described by attributes of an element.
+func (r *Reader) propertyAttrs(s quad.Value, e xml.StartElement, sc scope) error {
+	for _, a := range e.Attr {
+		if !isPropertyAttr(a.Name) {
+			continue
+		}
+		if isRDF(a.Name, "type") {
+			o, err := sc.resolve(a.Value)
+			if err != nil {
+				return err
+			}
+			r.emit(s, rdfType, o)
+			continue
+		}
+		p, err := nameIRI(a.Name)
+		if err != nil {
+			return err
+		}
+		r.emit(s, p, sc.literal(a.Value))
+	}
+	return nil
+}
+
+// nodeElement parses an element that describes a node and returns the node.
+func (r *Reader) nodeElement(e xml.StartElement, sc scope) (quad.Value, error) {
+	sc, err := r.scope(e, sc)
+	if err != nil {
+		return nil, err
+	}
+	var s quad.Value
+	if v, ok := attr(e, "about"); ok {
+		s, err = sc.resolve(v)
+	} else if v, ok = attr(e, "nodeID"); ok {
+		s = r.bnode(v)
+	} else if v, ok = attr(e, "ID"); ok {
+		s, err = sc.id(v)
+	} else {
+		s = r.newBNode()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isRDF(e.Name, "Description") {
+		typ, err := nameIRI(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		r.emit(s, rdfType, typ)
+	}
+	if err = r.propertyAttrs(s, e, sc); err != nil {
+		return nil, err
+	}
+	return s, r.propertyElements(s, sc)
+}
+
+// propertyElements parses child elements of a node element, up to its end.
+func (r *Reader) propertyElements(s quad.Value, sc scope) error {
+	li := 0
+	for {
+		tok, err := r.token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) != 0 {
+				return errors.New("unexpected text in a node element")
+			}
+		case xml.StartElement:
+			if err = r.propertyElement(s, tok, sc, &li); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// propertyElement parses an element that describes a single property of a node.
+func (r *Reader) propertyElement(s quad.Value, e xml.StartElement, sc scope, li *int) error {
+	sc, err := r.scope(e, sc)
+	if err != nil {
+		return err
+	}
+	var p quad.IRI
+	if isRDF(e.Name, "li") {
+		*li++
+		p = quad.IRI(rdf.NS + "_" + strconv.Itoa(*li))
+	} else if p, err = nameIRI(e.Name); err != nil {
+		return err
+	}
+	var o quad.Value
+	switch pt, ok := attr(e, "parseType"); {
+	case ok && pt == "Resource":
+		b := r.newBNode()
+		r.emit(s, p, b)
+		if err = r.propertyElements(b, sc); err != nil {
+			return err
+		}
+		return r.reify(e, sc, s, p, b)
+	case ok && pt == "Collection":
+		o, err = r.collection(sc)
+	case ok:
+		// parseType="Literal", other values are treated in the same way
+		var lit string
+		lit, err = r.xmlLiteral()
+		o = quad.TypedString{Value: quad.String(lit), Type: rdfXMLLiteral}
+	default:
+		o, err = r.propertyValue(e, sc)
+	}
+	if err != nil {
+		return err
+	}
+	r.emit(s, p, o)
+	return r.reify(e, sc, s, p, o)
+}
+
+// reify describes a statement, if a property element has an rdf:ID attribute.
+func (r *Reader) reify(e xml.StartElement, sc scope, s, p, o quad.Value) error {
+	id, ok := attr(e, "ID")
+	if !ok {
+		return nil
+	}
+	st, err := sc.id(id)
+	if err != nil {
+		return err
+	}
+	r.emit(st, rdfType, rdfStatement)
+	r.emit(st, rdfSubject, s)
+	r.emit(st, rdfPredicate, p)
+	r.emit(st, rdfObject, o)
+	return nil
+}
+
+// propertyValue parses the content of a property element: a literal, a nested node element,
+// or a reference to another node.
+func (r *Reader) propertyValue(e xml.StartElement, sc scope) (quad.Value, error) {
+	var text []byte
+	for {
+		tok, err := r.token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			text = append(text, tok...)
+		case xml.StartElement:
+			if len(bytes.TrimSpace(text)) != 0 {
+				return nil, errors.New("mixed content in a property element")
+			}
+			o, err := r.nodeElement(tok, sc)
+			if err != nil {
+				return nil, err
+			}
+			return o, r.endElement()
+		case xml.EndElement:
+			return r.propertyEnd(e, sc, string(text))
+		}
+	}
+}
+
+// endElement reads the end of a property element with a single node element.
+func (r *Reader) endElement() error {
+	for {
+		tok, err := r.token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) != 0 {
+				return errors.New("mixed content in a property element")
+			}
+		case xml.StartElement:
+			return errors.New("multiple node elements in a property element")
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// propertyEnd returns an object of a property element without child elements.
+func (r *Reader) propertyEnd(e xml.StartElement, sc scope, text string) (quad.Value, error) {
+	if dt, ok := attr(e, "datatype"); ok {
+		typ, err := sc.resolve(dt)
+		if err != nil {
+			return nil, err
+		}
+		return typed(text, typ), nil
+	}
+	var (
+		o   quad.Value
+		err error
+	)
+	if v, ok := attr(e, "resource"); ok {
+		o, err = sc.resolve(v)
+	} else if v, ok = attr(e, "nodeID"); ok {
+		o = r.bnode(v)
+	} else {
+		for _, a := range e.Attr {
+			if isPropertyAttr(a.Name) {
+				o = r.newBNode()
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	} else if o == nil {
+		return sc.literal(text), nil
+	} else if strings.TrimSpace(text) != "" {
+		return nil, errors.New("text in a property element with a resource")
+	}
+	return o, r.propertyAttrs(o, e, sc)
+}
+
+// collection parses node elements of a parseType="Collection" property and returns the head of the list.
+func (r *Reader) collection(sc scope) (quad.Value, error) {
+	var head, cur quad.Value = rdfNil, nil
+	for {
+		tok, err := r.token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			o, err := r.nodeElement(tok, sc)
+			if err != nil {
+				return nil, err
+			}
+			b := r.newBNode()
+			if cur == nil {
+				head = b
+			} else {
+				r.emit(cur, rdfRest, b)
+			}
+			r.emit(b, rdfFirst, o)
+			cur = b
+		case xml.EndElement:
+			if cur != nil {
+				r.emit(cur, rdfRest, rdfNil)
+			}
+			return head, nil
+		}
+	}
+}
+
+// xmlLiteral reads the content of a parseType="Literal" property element as XML.
+func (r *Reader) xmlLiteral() (string, error) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for depth := 0; ; {
+		tok, err := r.token()
+		if err != nil {
+			return "", err
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				if err = enc.Flush(); err != nil {
+					return "", err
+				}
+				return buf.String(), nil
+			}
+			depth--
+		}
+		if err = enc.EncodeToken(tok); err != nil {
+			return "", err
+		}
+	}
+}
+
+func typed(s string, typ quad.IRI) quad.Value {
+	v := quad.TypedString{Value: quad.String(s), Type: typ}
+	if nquads.AutoConvertTypedString {
+		if nv, err := v.ParseValue(); err == nil {
+			return nv
+		}
+	}
+	return v
+}
+
+// bnode returns a blank node for a label from the document.
+func (r *Reader) bnode(label string) quad.BNode {
+	if b, ok := r.bnodes[label]; ok {
+		return b
+	}
+	b := quad.BNode(label)
+	if _, ok := r.used[label]; ok {
+		// the label was already generated for an anonymous node
+		b = r.newBNode()
+	}
+	r.used[string(b)] = struct{}{}
+	r.bnodes[label] = b
+	return b
+}
+
+// newBNode generates a label for an anonymous blank node.
+func (r *Reader) newBNode() quad.BNode {
+	for {
+		r.nextID++
+		label := "b" + strconv.Itoa(r.nextID)
+		if _, ok := r.used[label]; !ok {
+			r.used[label] = struct{}{}
+			return quad.BNode(label)
+		}
+	}
+}
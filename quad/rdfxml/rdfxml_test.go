@@ -0,0 +1,248 @@
+package rdfxml_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/rdfxml"
+	"github.com/aperturerobotics/cayley/quad/voc"
+)
+
+const (
+	ex    = "http://example.org/"
+	rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	owlNS = "http://www.w3.org/2002/07/owl#"
+)
+
+func iri(s string) quad.IRI { return quad.IRI(ex + s) }
+
+func rdfIRI(s string) quad.IRI { return quad.IRI(rdfNS + s) }
+
+var readTests = []struct {
+	name  string
+	data  string
+	quads []quad.Quad
+}{
+	{
+		name: "descriptions",
+		data: `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:ex="http://example.org/" xml:lang="en">
+	<rdf:Description rdf:about="http://example.org/alice" ex:name="Alice">
+		<ex:knows rdf:resource="http://example.org/bob"/>
+		<ex:knows rdf:nodeID="x"/>
+		<ex:age rdf:datatype="http://www.w3.org/2001/XMLSchema#integer">30</ex:age>
+		<ex:note xml:lang="fr">Bonjour</ex:note>
+		<ex:empty></ex:empty>
+	</rdf:Description>
+	<ex:Person rdf:nodeID="x" rdf:type="http://example.org/Agent">
+		<ex:address ex:city="Paris"/>
+	</ex:Person>
+</rdf:RDF>
+`,
+		quads: []quad.Quad{
+			{Subject: iri("alice"), Predicate: iri("name"), Object: quad.LangString{Value: "Alice", Lang: "en"}},
+			{Subject: iri("alice"), Predicate: iri("knows"), Object: iri("bob")},
+			{Subject: iri("alice"), Predicate: iri("knows"), Object: quad.BNode("x")},
+			{Subject: iri("alice"), Predicate: iri("age"), Object: quad.Int(30)},
+			{Subject: iri("alice"), Predicate: iri("note"), Object: quad.LangString{Value: "Bonjour", Lang: "fr"}},
+			{Subject: iri("alice"), Predicate: iri("empty"), Object: quad.LangString{Value: "", Lang: "en"}},
+			{Subject: quad.BNode("x"), Predicate: rdfIRI("type"), Object: iri("Person")},
+			{Subject: quad.BNode("x"), Predicate: rdfIRI("type"), Object: iri("Agent")},
+			{Subject: quad.BNode("b1"), Predicate: iri("city"), Object: quad.LangString{Value: "Paris", Lang: "en"}},
+			{Subject: quad.BNode("x"), Predicate: iri("address"), Object: quad.BNode("b1")},
+		},
+	},
+	{
+		name: "base and ID",
+		data: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:ex="http://example.org/"
+	xml:base="http://example.org/doc">
+	<rdf:Description rdf:ID="a">
+		<ex:p rdf:ID="st" rdf:resource="b"/>
+		<ex:q>
+			<rdf:Description rdf:about="c" xml:base="http://example.org/dir/"/>
+		</ex:q>
+	</rdf:Description>
+</rdf:RDF>
+`,
+		quads: []quad.Quad{
+			{Subject: iri("doc#a"), Predicate: iri("p"), Object: iri("b")},
+			{Subject: iri("doc#st"), Predicate: rdfIRI("type"), Object: rdfIRI("Statement")},
+			{Subject: iri("doc#st"), Predicate: rdfIRI("subject"), Object: iri("doc#a")},
+			{Subject: iri("doc#st"), Predicate: rdfIRI("predicate"), Object: iri("p")},
+			{Subject: iri("doc#st"), Predicate: rdfIRI("object"), Object: iri("b")},
+			{Subject: iri("doc#a"), Predicate: iri("q"), Object: iri("dir/c")},
+		},
+	},
+	{
+		name: "parse types",
+		data: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:ex="http://example.org/">
+	<rdf:Description rdf:about="http://example.org/s">
+		<ex:res rdf:parseType="Resource">
+			<ex:v>1</ex:v>
+		</ex:res>
+		<ex:lit rdf:parseType="Literal"><b>bold</b> text</ex:lit>
+		<ex:list rdf:parseType="Collection">
+			<rdf:Description rdf:about="http://example.org/a"/>
+			<rdf:Description rdf:about="http://example.org/b"/>
+		</ex:list>
+		<ex:seq>
+			<rdf:Seq>
+				<rdf:li>one</rdf:li>
+				<rdf:li>two</rdf:li>
+			</rdf:Seq>
+		</ex:seq>
+	</rdf:Description>
+</rdf:RDF>
+`,
+		quads: []quad.Quad{
+			{Subject: iri("s"), Predicate: iri("res"), Object: quad.BNode("b1")},
+			{Subject: quad.BNode("b1"), Predicate: iri("v"), Object: quad.String("1")},
+			{Subject: iri("s"), Predicate: iri("lit"), Object: quad.TypedString{Value: "<b>bold</b> text", Type: rdfIRI("XMLLiteral")}},
+			{Subject: quad.BNode("b2"), Predicate: rdfIRI("first"), Object: iri("a")},
+			{Subject: quad.BNode("b2"), Predicate: rdfIRI("rest"), Object: quad.BNode("b3")},
+			{Subject: quad.BNode("b3"), Predicate: rdfIRI("first"), Object: iri("b")},
+			{Subject: quad.BNode("b3"), Predicate: rdfIRI("rest"), Object: rdfIRI("nil")},
+			{Subject: iri("s"), Predicate: iri("list"), Object: quad.BNode("b2")},
+			{Subject: quad.BNode("b4"), Predicate: rdfIRI("type"), Object: rdfIRI("Seq")},
+			{Subject: quad.BNode("b4"), Predicate: rdfIRI("_1"), Object: quad.String("one")},
+			{Subject: quad.BNode("b4"), Predicate: rdfIRI("_2"), Object: quad.String("two")},
+			{Subject: iri("s"), Predicate: iri("seq"), Object: quad.BNode("b4")},
+		},
+	},
+	{
+		name: "ontology",
+		data: `<?xml version="1.0"?>
+<!DOCTYPE rdf:RDF [
+	<!ENTITY owl "http://www.w3.org/2002/07/owl#" >
+	<!ENTITY ex 'http://example.org/' >
+]>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:owl="&owl;">
+	<owl:Class rdf:about="&ex;Person"/>
+</rdf:RDF>
+`,
+		quads: []quad.Quad{
+			{Subject: iri("Person"), Predicate: rdfIRI("type"), Object: quad.IRI(owlNS + "Class")},
+		},
+	},
+	{
+		name: "single node",
+		data: `<ex:Person xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:ex="http://example.org/" rdf:about="http://example.org/a"/>`,
+		quads: []quad.Quad{
+			{Subject: iri("a"), Predicate: rdfIRI("type"), Object: iri("Person")},
+		},
+	},
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range readTests {
+		t.Run(c.name, func(t *testing.T) {
+			quads, err := quad.ReadAll(ctx, rdfxml.NewReader(strings.NewReader(c.data)))
+			require.NoError(t, err)
+			require.Equal(t, c.quads, quads)
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		data string
+		err  string
+	}{
+		{
+			data: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="a">`,
+			err: "unexpected EOF",
+		},
+		{
+			data: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="a"><p>x</p></rdf:Description></rdf:RDF>`,
+			err: `line 2: element or attribute without a namespace: "p"`,
+		},
+		{
+			data: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:ex="http://example.org/">
+<rdf:Description rdf:about="a"><ex:p>x<rdf:Description/></ex:p></rdf:Description></rdf:RDF>`,
+			err: "line 2: mixed content in a property element",
+		},
+	} {
+		_, err := quad.ReadAll(ctx, rdfxml.NewReader(strings.NewReader(c.data)))
+		require.ErrorContains(t, err, c.err, c.data)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	var ns voc.Namespaces
+	ns.Register(voc.Namespace{Prefix: "ex:", Full: ex})
+	ns.Register(voc.Namespace{Prefix: "owl:", Full: owlNS})
+	write := func(quads ...quad.Quad) string {
+		buf := bytes.NewBuffer(nil)
+		w := rdfxml.NewWriter(buf)
+		w.SetNamespaces(&ns)
+		_, err := quad.Copy(ctx, w, quad.NewReader(quads))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf.String()
+	}
+
+	// quads of a subject are written as one description, even if they are not consecutive;
+	// the owl namespace is not used, thus it's not declared
+	alice := []quad.Quad{
+		{Subject: iri("alice"), Predicate: rdfIRI("type"), Object: iri("Person")},
+		{Subject: iri("alice"), Predicate: iri("knows"), Object: quad.BNode("x")},
+		{Subject: iri("alice"), Predicate: iri("age"), Object: quad.Int(30)},
+		{Subject: iri("alice"), Predicate: quad.IRI("http://other.org/ns#name"), Object: quad.LangString{Value: "Alice & co", Lang: "en"}},
+	}
+	x := []quad.Quad{
+		{Subject: quad.BNode("x"), Predicate: iri("ok"), Object: quad.Bool(true)},
+		{Subject: quad.BNode("x"), Predicate: iri("note"), Object: quad.String("<a>")},
+	}
+	doc := write(alice[0], alice[1], x[0], alice[2], x[1], alice[3])
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmlns:ex="http://example.org/">
+	<rdf:Description rdf:about="http://example.org/alice">
+		<rdf:type rdf:resource="http://example.org/Person"/>
+		<ex:knows rdf:nodeID="x"/>
+		<ex:age rdf:datatype="http://www.w3.org/2001/XMLSchema#integer">30</ex:age>
+		<name xmlns="http://other.org/ns#" xml:lang="en">Alice &amp; co</name>
+	</rdf:Description>
+	<rdf:Description rdf:nodeID="x">
+		<ex:ok rdf:datatype="http://www.w3.org/2001/XMLSchema#boolean">true</ex:ok>
+		<ex:note>&lt;a&gt;</ex:note>
+	</rdf:Description>
+</rdf:RDF>
+`, doc)
+	quads, err := quad.ReadAll(ctx, rdfxml.NewReader(strings.NewReader(doc)))
+	require.NoError(t, err)
+	require.Equal(t, append(alice, x...), quads)
+
+	// only the rdf namespace is declared if no other is used
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+	<rdf:Description rdf:about="http://other.org/s">
+		<p xmlns="http://other.org/">o</p>
+	</rdf:Description>
+</rdf:RDF>
+`, write(quad.Make(quad.IRI("http://other.org/s"), quad.IRI("http://other.org/p"), quad.String("o"), nil)))
+
+	w := rdfxml.NewWriter(io.Discard)
+	err = w.WriteQuad(ctx, quad.MakeIRI("a", "http://example.org/1", "b", ""))
+	require.ErrorContains(t, err, "cannot write predicate")
+	err = w.WriteQuad(ctx, quad.Quad{Subject: quad.String("a"), Predicate: iri("p"), Object: iri("b")})
+	require.ErrorContains(t, err, "subject must be an IRI or a blank node")
+}
+
+func TestFormat(t *testing.T) {
+	f := quad.FormatByMime("application/rdf+xml")
+	require.NotNil(t, f)
+	require.Equal(t, "rdfxml", f.Name)
+	require.Equal(t, f, quad.FormatByExt(".rdf"))
+}
@@ -0,0 +1,255 @@
+package rdfxml
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+)
+
+// Writer generates RDF/XML documents.
+//
+// Quads are buffered until the writer is closed. Quads with the same subject are written as a single
+// rdf:Description, in order of the first appearance of subjects. Only namespaces that are used are declared.
+// RDF/XML has no named graphs, thus labels are not written. Predicates must end with a valid XML name,
+// since they are written as element names.
+type Writer struct {
+	w  io.Writer
+	ns *voc.Namespaces
+
+	pref []voc.Namespace // namespaces that can be declared on the root element, longest first
+	used map[string]bool // prefixes used in the document
+
+	descs  []*description // in order of the first appearance
+	bySubj map[string]*description
+	closed bool
+}
+
+// description is a group of quads with the same subject.
+type description struct {
+	subj  quad.Value
+	quads []quad.Quad
+}
+
+// NewWriter creates an RDF/XML writer.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, ns: voc.Clone(), bySubj: make(map[string]*description)}
+}
+
+// SetNamespaces sets namespaces to use instead of globally registered ones.
+// It must be called before writing any quads.
+func (w *Writer) SetNamespaces(ns *voc.Namespaces) {
+	w.ns = ns
+}
+
+func escape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// setPrefixes collects namespaces that can be declared on the root element.
+func (w *Writer) setPrefixes() {
+	w.used = make(map[string]bool)
+	for _, ns := range w.ns.List() {
+		pref := strings.TrimSuffix(ns.Prefix, ":")
+		if pref == ns.Prefix || pref == "rdf" || !isName(pref) || strings.HasPrefix(strings.ToLower(pref), "xml") {
+			continue
+		}
+		w.pref = append(w.pref, voc.Namespace{Prefix: pref, Full: ns.Full})
+	}
+	w.pref = append(w.pref, voc.Namespace{Prefix: "rdf", Full: rdf.NS})
+	sort.Slice(w.pref, func(i, j int) bool {
+		if len(w.pref[i].Full) != len(w.pref[j].Full) {
+			return len(w.pref[i].Full) > len(w.pref[j].Full)
+		}
+		return w.pref[i].Prefix < w.pref[j].Prefix
+	})
+}
+
+// writeHeader writes the root element and declares namespaces that are used in the document.
+func (w *Writer) writeHeader(bw *bufio.Writer) {
+	bw.WriteString(xml.Header + `<rdf:RDF xmlns:rdf="` + rdf.NS + `"`)
+	var list []voc.Namespace
+	for _, ns := range w.pref {
+		if ns.Prefix != "rdf" && w.used[ns.Prefix] {
+			list = append(list, ns)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Prefix < list[j].Prefix })
+	for _, ns := range list {
+		bw.WriteString("\n\txmlns:" + ns.Prefix + `="` + escape(ns.Full) + `"`)
+	}
+	bw.WriteString(">\n")
+}
+
+func (w *Writer) WriteQuad(ctx context.Context, q quad.Quad) error {
+	if !q.IsValid() {
+		return quad.ErrInvalid
+	}
+	p, ok := q.Predicate.(quad.IRI)
+	if !ok {
+		return fmt.Errorf("rdfxml: predicate must be an IRI, got %v", q.Predicate)
+	}
+	switch q.Subject.(type) {
+	case quad.IRI, quad.BNode:
+	default:
+		return fmt.Errorf("rdfxml: subject must be an IRI or a blank node, got %v", q.Subject)
+	}
+	if w.used == nil {
+		w.setPrefixes()
+	}
+	if _, err := w.element(p); err != nil {
+		return err
+	}
+	key := q.Subject.String()
+	d := w.bySubj[key]
+	if d == nil {
+		d = &description{subj: q.Subject}
+		w.bySubj[key] = d
+		w.descs = append(w.descs, d)
+	}
+	d.quads = append(d.quads, q)
+	return nil
+}
+
+// writeProperty writes a property element for a quad.
+func (w *Writer) writeProperty(sb *strings.Builder, q quad.Quad) {
+	elem, _ := w.element(q.Predicate.(quad.IRI))
+	name, _, _ := strings.Cut(elem, " ")
+	sb.WriteString("\t\t<" + elem)
+	switch o := q.Object.(type) {
+	case quad.IRI:
+		sb.WriteString(` rdf:resource="` + escape(string(w.full(o))) + "\"/>\n")
+		return
+	case quad.BNode:
+		sb.WriteString(` rdf:nodeID="` + escape(string(o)) + "\"/>\n")
+		return
+	case quad.String:
+		sb.WriteString(">" + escape(string(o)))
+	case quad.LangString:
+		sb.WriteString(` xml:lang="` + escape(o.Lang) + `">` + escape(string(o.Value)))
+	default:
+		var ts quad.TypedString
+		switch v := o.(type) {
+		case quad.TypedString:
+			ts = v
+		case quad.Bool:
+			// xsd:boolean values are lowercase
+			ts = v.TypedString()
+			ts.Value = quad.String(strconv.FormatBool(bool(v)))
+		case quad.TypedStringer:
+			ts = v.TypedString()
+		default:
+			ts = quad.TypedString{Value: quad.String(o.String())}
+		}
+		if ts.Type != "" {
+			sb.WriteString(` rdf:datatype="` + escape(string(w.full(ts.Type))) + `"`)
+		}
+		sb.WriteString(">" + escape(string(ts.Value)))
+	}
+	sb.WriteString("</" + name + ">\n")
+}
+
+func (w *Writer) WriteQuads(ctx context.Context, buf []quad.Quad) (int, error) {
+	for i, q := range buf {
+		if err := w.WriteQuad(ctx, q); err != nil {
+			return i, err
+		}
+	}
+	return len(buf), nil
+}
+
+// Close writes buffered quads to the document.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.used == nil {
+		w.setPrefixes()
+	}
+	var body strings.Builder
+	for _, d := range w.descs {
+		switch s := d.subj.(type) {
+		case quad.IRI:
+			body.WriteString("\t<rdf:Description rdf:about=\"" + escape(string(w.full(s))) + "\">\n")
+		case quad.BNode:
+			body.WriteString("\t<rdf:Description rdf:nodeID=\"" + escape(string(s)) + "\">\n")
+		}
+		for _, q := range d.quads {
+			w.writeProperty(&body, q)
+		}
+		body.WriteString("\t</rdf:Description>\n")
+	}
+	bw := bufio.NewWriter(w.w)
+	w.writeHeader(bw)
+	bw.WriteString(body.String())
+	bw.WriteString("</rdf:RDF>\n")
+	return bw.Flush()
+}
+
+// full expands IRIs shortened with either globally registered or the writer's namespaces.
+func (w *Writer) full(iri quad.IRI) quad.IRI {
+	return iri.Full().FullWith(w.ns)
+}
+
+// element returns an element name for a predicate. If the namespace of the predicate is not declared,
+// the name includes the declaration of the default namespace.
+func (w *Writer) element(p quad.IRI) (string, error) {
+	full := string(w.full(p))
+	for _, ns := range w.pref {
+		if local, ok := strings.CutPrefix(full, ns.Full); ok && isName(local) {
+			w.used[ns.Prefix] = true
+			return ns.Prefix + ":" + local, nil
+		}
+	}
+	// split the IRI at the longest suffix that is a valid name
+	i := len(full)
+	for i > 0 {
+		c, n := utf8.DecodeLastRuneInString(full[:i])
+		if !isNameChar(c) {
+			break
+		}
+		i -= n
+	}
+	for i < len(full) {
+		c, n := utf8.DecodeRuneInString(full[i:])
+		if isNameStart(c) {
+			break
+		}
+		i += n
+	}
+	if i == 0 || i == len(full) {
+		return "", fmt.Errorf("rdfxml: cannot write predicate %v as an XML element", p)
+	}
+	return full[i:] + ` xmlns="` + escape(full[:i]) + `"`, nil
+}
+
+func isNameStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isNameChar(c rune) bool {
+	return isNameStart(c) || c == '-' || c == '.' || unicode.IsDigit(c) || c == 0xb7 || unicode.Is(unicode.Mn, c)
+}
+
+// isName checks if a string is a valid XML name without a colon.
+func isName(s string) bool {
+	for i, c := range s {
+		if (i == 0 && !isNameStart(c)) || !isNameChar(c) {
+			return false
+		}
+	}
+	return s != ""
+}
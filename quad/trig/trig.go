@@ -0,0 +1,31 @@
+// Package trig registers the TriG (https://www.w3.org/TR/trig/) format, an extension of Turtle with named graphs.
+//
+// The format is implemented by the quad/turtle package.
+package trig
+
+import (
+	"io"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/turtle"
+)
+
+func init() {
+	quad.RegisterFormat(quad.Format{
+		Name:   "trig",
+		Ext:    []string{".trig"},
+		Mime:   []string{"application/trig"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewReader(r) },
+		Writer: func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
+	})
+}
+
+// NewReader creates a TriG reader.
+func NewReader(r io.Reader) *turtle.Reader {
+	return turtle.NewTriGReader(r)
+}
+
+// NewWriter creates a TriG writer.
+func NewWriter(w io.Writer) *turtle.Writer {
+	return turtle.NewTriGWriter(w)
+}
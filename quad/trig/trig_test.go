@@ -0,0 +1,42 @@
+package trig_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/quad"
+	_ "github.com/aperturerobotics/cayley/quad/trig"
+)
+
+func TestFormat(t *testing.T) {
+	f := quad.FormatByMime("application/trig")
+	require.NotNil(t, f)
+	require.Equal(t, "trig", f.Name)
+	require.Equal(t, f, quad.FormatByExt(".trig"))
+
+	const data = `<http://example.org/g> {
+    <http://example.org/s> <http://example.org/p> "o" .
+}
+`
+	ctx := context.Background()
+	r := f.Reader(strings.NewReader(data))
+	quads, err := quad.ReadAll(ctx, r)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Quad{{
+		Subject:   quad.IRI("http://example.org/s"),
+		Predicate: quad.IRI("http://example.org/p"),
+		Object:    quad.String("o"),
+		Label:     quad.IRI("http://example.org/g"),
+	}}, quads)
+
+	buf := bytes.NewBuffer(nil)
+	w := f.Writer(buf)
+	_, err = quad.Copy(ctx, w, quad.NewReader(quads))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.True(t, strings.HasSuffix(buf.String(), data), buf.String())
+}
@@ -0,0 +1,410 @@
+package turtle
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF     tokenKind = iota
+	tokIRI               // <iri>
+	tokPName             // prefix:local
+	tokBNode             // _:label
+	tokString            // "string"
+	tokLang              // @lang
+	tokInteger           // 1
+	tokDecimal           // 1.0
+	tokDouble            // 1e0
+	tokWord              // a, true, false, PREFIX, BASE, GRAPH, @prefix, @base
+	tokPunct             // . ; , [ ] ( ) { } ^^
+)
+
+type token struct {
+	kind  tokenKind
+	val   string
+	local string // local part of a prefixed name
+	line  int
+}
+
+func (t token) is(kind tokenKind, val string) bool {
+	return t.kind == kind && t.val == val
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokIRI:
+		return "<" + t.val + ">"
+	case tokPName:
+		return t.val + ":" + t.local
+	case tokBNode:
+		return "_:" + t.val
+	case tokString:
+		return strconv.Quote(t.val)
+	case tokLang:
+		return "@" + t.val
+	}
+	return strconv.Quote(t.val)
+}
+
+const eof = -1
+
+// lexer splits Turtle and TriG documents into tokens.
+type lexer struct {
+	r    *bufio.Reader
+	buf  []rune // runes read ahead
+	line int
+	err  error
+}
+
+func newLexer(r io.Reader) *lexer {
+	return &lexer{r: bufio.NewReader(r), line: 1}
+}
+
+// peek returns a rune at a given offset without consuming it.
+func (l *lexer) peek(i int) rune {
+	for len(l.buf) <= i {
+		if l.err != nil {
+			return eof
+		}
+		c, _, err := l.r.ReadRune()
+		if err != nil {
+			l.err = err
+			return eof
+		}
+		l.buf = append(l.buf, c)
+	}
+	return l.buf[i]
+}
+
+func (l *lexer) next() rune {
+	c := l.peek(0)
+	if c == eof {
+		return eof
+	}
+	l.buf = l.buf[1:]
+	if c == '\n' {
+		l.line++
+	}
+	return c
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: "+format, append([]any{l.line}, args...)...)
+}
+
+func (l *lexer) skipSpace() {
+	for {
+		switch c := l.peek(0); {
+		case c == '#':
+			for c != '\n' && c != eof {
+				c = l.next()
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.next()
+		default:
+			return
+		}
+	}
+}
+
+// token reads the next token from the input.
+func (l *lexer) token() (token, error) {
+	l.skipSpace()
+	t := token{line: l.line}
+	c := l.peek(0)
+	switch {
+	case c == eof:
+		if l.err != nil && !errors.Is(l.err, io.EOF) {
+			return t, l.err
+		}
+		t.kind = tokEOF
+		return t, nil
+	case c == '<':
+		l.next()
+		s, err := l.iri()
+		t.kind, t.val = tokIRI, s
+		return t, err
+	case c == '"' || c == '\'':
+		s, err := l.string()
+		t.kind, t.val = tokString, s
+		return t, err
+	case c == '@':
+		l.next()
+		s := l.langTag()
+		if s == "" {
+			return t, l.errorf("expected a language tag")
+		}
+		if s == "prefix" || s == "base" {
+			t.kind, t.val = tokWord, "@"+s
+		} else {
+			t.kind, t.val = tokLang, s
+		}
+		return t, nil
+	case c == '^':
+		if l.next(); l.next() != '^' {
+			return t, l.errorf("expected '^^'")
+		}
+		t.kind, t.val = tokPunct, "^^"
+		return t, nil
+	case c == '_' && l.peek(1) == ':':
+		l.next()
+		l.next()
+		s, err := l.name(true)
+		if err == nil && s == "" {
+			err = l.errorf("expected a blank node label")
+		}
+		t.kind, t.val = tokBNode, s
+		return t, err
+	case isDigit(c) || ((c == '+' || c == '-') && (isDigit(l.peek(1)) || l.peek(1) == '.')) ||
+		(c == '.' && isDigit(l.peek(1))):
+		return l.number(t)
+	case strings.ContainsRune(".;,[]()}{", c):
+		l.next()
+		t.kind, t.val = tokPunct, string(c)
+		return t, nil
+	case c == ':' || isNameStart(c):
+		pref := l.prefix()
+		if l.peek(0) != ':' {
+			// a keyword
+			t.kind, t.val = tokWord, pref
+			return t, nil
+		}
+		l.next()
+		local, err := l.name(false)
+		t.kind, t.val, t.local = tokPName, pref, local
+		return t, err
+	}
+	return t, l.errorf("unexpected character %q", c)
+}
+
+// iri reads an IRI reference after the opening bracket.
+func (l *lexer) iri() (string, error) {
+	var sb strings.Builder
+	for {
+		c := l.next()
+		switch {
+		case c == '>':
+			return sb.String(), nil
+		case c == '\\':
+			r, err := l.uchar()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(r)
+		case c == eof || c <= ' ' || strings.ContainsRune(`<"{}|^`+"`", c):
+			return "", l.errorf("invalid character in IRI: %q", c)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+}
+
+// uchar reads a numeric escape sequence after the backslash.
+func (l *lexer) uchar() (rune, error) {
+	n := 0
+	switch l.next() {
+	case 'u':
+		n = 4
+	case 'U':
+		n = 8
+	default:
+		return 0, l.errorf("invalid escape sequence")
+	}
+	var hex [8]rune
+	for i := 0; i < n; i++ {
+		hex[i] = l.next()
+	}
+	v, err := strconv.ParseUint(string(hex[:n]), 16, 32)
+	if err != nil {
+		return 0, l.errorf("invalid escape sequence: %q", string(hex[:n]))
+	}
+	return rune(v), nil
+}
+
+// string reads a quoted string literal, including long strings in triple quotes.
+func (l *lexer) string() (string, error) {
+	q := l.next()
+	long := false
+	if l.peek(0) == q && l.peek(1) == q {
+		l.next()
+		l.next()
+		long = true
+	} else if l.peek(0) == q {
+		l.next()
+		return "", nil
+	}
+	var sb strings.Builder
+	for {
+		if c := l.peek(0); (c == '\n' || c == '\r') && !long {
+			return "", l.errorf("line break in a string")
+		}
+		c := l.next()
+		switch {
+		case c == eof:
+			return "", l.errorf("unterminated string")
+		case c == q && !long:
+			return sb.String(), nil
+		case c == q && l.peek(0) == q && l.peek(1) == q:
+			l.next()
+			l.next()
+			// a long string may end with more quotes
+			for l.peek(0) == q {
+				sb.WriteRune(l.next())
+			}
+			return sb.String(), nil
+		case c == '\\':
+			switch e := l.peek(0); e {
+			case 'u', 'U':
+				r, err := l.uchar()
+				if err != nil {
+					return "", err
+				}
+				sb.WriteRune(r)
+				continue
+			case 't':
+				sb.WriteByte('\t')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'f':
+				sb.WriteByte('\f')
+			case '"', '\'', '\\':
+				sb.WriteRune(e)
+			default:
+				return "", l.errorf("invalid escape sequence: \\%c", e)
+			}
+			l.next()
+		default:
+			sb.WriteRune(c)
+		}
+	}
+}
+
+func (l *lexer) langTag() string {
+	var sb strings.Builder
+	for c := l.peek(0); isLetter(c) || (sb.Len() != 0 && (c == '-' || isDigit(c))); c = l.peek(0) {
+		sb.WriteRune(l.next())
+	}
+	return sb.String()
+}
+
+// number reads integer, decimal and double literals.
+func (l *lexer) number(t token) (token, error) {
+	var sb strings.Builder
+	digits := func() {
+		for isDigit(l.peek(0)) {
+			sb.WriteRune(l.next())
+		}
+	}
+	isExp := func(i int) bool {
+		c := l.peek(i)
+		if c != 'e' && c != 'E' {
+			return false
+		}
+		if c = l.peek(i + 1); c == '+' || c == '-' {
+			return isDigit(l.peek(i + 2))
+		}
+		return isDigit(c)
+	}
+	t.kind = tokInteger
+	if c := l.peek(0); c == '+' || c == '-' {
+		sb.WriteRune(l.next())
+	}
+	digits()
+	// a dot may end the statement instead
+	if l.peek(0) == '.' && (isDigit(l.peek(1)) || isExp(1)) {
+		t.kind = tokDecimal
+		sb.WriteRune(l.next())
+		digits()
+	}
+	if isExp(0) {
+		t.kind = tokDouble
+		sb.WriteRune(l.next())
+		if c := l.peek(0); c == '+' || c == '-' {
+			sb.WriteRune(l.next())
+		}
+		digits()
+	}
+	t.val = sb.String()
+	if t.val == "+" || t.val == "-" || t.val == "." {
+		return t, l.errorf("invalid number: %q", t.val)
+	}
+	return t, nil
+}
+
+// prefix reads a namespace prefix or a keyword.
+func (l *lexer) prefix() string {
+	var sb strings.Builder
+	for c := l.peek(0); isNameChar(c) || (c == '.' && isNameChar(l.peek(1))); c = l.peek(0) {
+		sb.WriteRune(l.next())
+	}
+	return sb.String()
+}
+
+// name reads a local part of a prefixed name, or a blank node label.
+func (l *lexer) name(bnode bool) (string, error) {
+	var sb strings.Builder
+	for {
+		c := l.peek(0)
+		switch {
+		case isNameChar(c) || (!bnode && c == ':'):
+			sb.WriteRune(l.next())
+		case c == '.':
+			// names cannot end with a dot
+			if c2 := l.peek(1); !isNameChar(c2) && (bnode || (c2 != ':' && c2 != '%' && c2 != '\\')) {
+				return sb.String(), nil
+			}
+			sb.WriteRune(l.next())
+		case c == '%' && !bnode:
+			sb.WriteRune(l.next())
+			for i := 0; i < 2; i++ {
+				if !isHex(l.peek(0)) {
+					return "", l.errorf("invalid percent encoding")
+				}
+				sb.WriteRune(l.next())
+			}
+		case c == '\\' && !bnode:
+			l.next()
+			e := l.next()
+			if !strings.ContainsRune(`_~.-!$&'()*+,;=/?#@%`, e) {
+				return "", l.errorf("invalid escape sequence: \\%c", e)
+			}
+			sb.WriteRune(e)
+		default:
+			return sb.String(), nil
+		}
+	}
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c rune) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameStart(c rune) bool {
+	return isLetter(c) || (c > 0x7f && unicode.IsLetter(c))
+}
+
+func isNameChar(c rune) bool {
+	return isNameStart(c) || isDigit(c) || c == '_' || c == '-' || c == 0xb7 ||
+		(c > 0x7f && (unicode.IsDigit(c) || unicode.Is(unicode.Mn, c)))
+}
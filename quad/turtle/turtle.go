@@ -0,0 +1,536 @@
+// Package turtle implements reading and writing of the RDF 1.1 Turtle (https://www.w3.org/TR/turtle/)
+// and TriG (https://www.w3.org/TR/trig/) formats.
+//
+// TriG format is registered by the quad/trig package.
+package turtle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/nquads"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+	"github.com/aperturerobotics/cayley/quad/voc/xsd"
+)
+
+func init() {
+	quad.RegisterFormat(quad.Format{
+		Name:   "turtle",
+		Ext:    []string{".ttl"},
+		Mime:   []string{"text/turtle"},
+		Reader: func(r io.Reader) quad.ReadCloser { return NewReader(r) },
+		Writer: func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
+	})
+}
+
+var (
+	rdfType  = quad.IRI(rdf.Type).Full()
+	rdfFirst = quad.IRI(rdf.First).Full()
+	rdfRest  = quad.IRI(rdf.Rest).Full()
+	rdfNil   = quad.IRI(rdf.Nil).Full()
+
+	xsdInteger = quad.IRI(xsd.Integer).Full()
+	xsdDecimal = quad.IRI(xsd.NS + "decimal")
+	xsdDouble  = quad.IRI(xsd.Double).Full()
+	xsdBoolean = quad.IRI(xsd.Boolean).Full()
+)
+
+// Reader is a streaming parser of Turtle and TriG documents.
+//
+// Typed literals, including numeric and boolean shorthands, are converted to native values
+// in the same way as nquads.AutoConvertTypedString does.
+type Reader struct {
+	lex    *lexer
+	tok    token
+	peeked bool
+	trig   bool
+
+	base     *url.URL
+	prefixes map[string]string
+
+	graph   quad.Value // current graph in TriG
+	inGraph bool
+
+	bnodes map[string]quad.BNode // blank node labels from the document
+	used   map[string]struct{}   // labels of all blank nodes
+	nextID int
+
+	queue []quad.Quad
+	err   error
+}
+
+// NewReader creates a Turtle reader.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		lex:      newLexer(r),
+		prefixes: make(map[string]string),
+		bnodes:   make(map[string]quad.BNode),
+		used:     make(map[string]struct{}),
+	}
+}
+
+// NewTriGReader creates a reader for TriG, an extension of Turtle with named graphs.
+func NewTriGReader(r io.Reader) *Reader {
+	rd := NewReader(r)
+	rd.trig = true
+	return rd
+}
+
+// SetBase sets a base IRI to resolve relative IRIs against. It can be changed by the document.
+func (r *Reader) SetBase(base string) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	r.base = u
+	return nil
+}
+
+// ReadQuad returns the next quad from the document, or io.EOF at the end of it.
+func (r *Reader) ReadQuad(ctx context.Context) (quad.Quad, error) {
+	for len(r.queue) == 0 {
+		if r.err != nil {
+			return quad.Quad{}, r.err
+		}
+		if err := r.statement(); err == io.EOF {
+			r.err = io.EOF
+		} else if err != nil {
+			r.err = fmt.Errorf("turtle: %w", err)
+		}
+	}
+	q := r.queue[0]
+	r.queue[0] = quad.Quad{}
+	r.queue = r.queue[1:]
+	return q, nil
+}
+
+func (r *Reader) Close() error { return nil }
+
+func (r *Reader) peek() (token, error) {
+	if !r.peeked {
+		t, err := r.lex.token()
+		if err != nil {
+			return t, err
+		}
+		r.tok, r.peeked = t, true
+	}
+	return r.tok, nil
+}
+
+func (r *Reader) next() (token, error) {
+	t, err := r.peek()
+	r.peeked = false
+	return t, err
+}
+
+func (r *Reader) expect(punct string) error {
+	t, err := r.next()
+	if err != nil {
+		return err
+	} else if !t.is(tokPunct, punct) {
+		return r.unexpected(t, "'"+punct+"'")
+	}
+	return nil
+}
+
+func (r *Reader) unexpected(t token, exp string) error {
+	return fmt.Errorf("line %d: expected %s, got %v", t.line, exp, t)
+}
+
+// emit adds a quad to the output queue.
+func (r *Reader) emit(s, p, o quad.Value) {
+	r.queue = append(r.queue, quad.Quad{Subject: s, Predicate: p, Object: o, Label: r.graph})
+}
+
+// statement parses a single directive, a set of triples or a start or an end of a graph block in TriG.
+func (r *Reader) statement() error {
+	t, err := r.peek()
+	if err != nil {
+		return err
+	}
+	switch {
+	case t.kind == tokEOF:
+		if r.inGraph {
+			return r.unexpected(t, "'}'")
+		}
+		return io.EOF
+	case r.inGraph && t.is(tokPunct, "}"):
+		r.next()
+		r.inGraph, r.graph = false, nil
+		return nil
+	case r.inGraph:
+		if err = r.triples(); err != nil {
+			return err
+		}
+		// the last dot in a graph block is optional
+		if t, err = r.peek(); err != nil {
+			return err
+		} else if t.is(tokPunct, "}") {
+			return nil
+		}
+		return r.expect(".")
+	case t.is(tokWord, "@prefix"), t.is(tokWord, "@base"):
+		r.next()
+		if err = r.directive(t.val[1:]); err != nil {
+			return err
+		}
+		return r.expect(".")
+	case t.kind == tokWord && (strings.EqualFold(t.val, "prefix") || strings.EqualFold(t.val, "base")):
+		r.next()
+		return r.directive(strings.ToLower(t.val))
+	case r.trig && t.kind == tokWord && strings.EqualFold(t.val, "graph"):
+		r.next()
+		label, err := r.graphLabel()
+		if err != nil {
+			return err
+		}
+		return r.startGraph(label)
+	case r.trig && t.is(tokPunct, "{"):
+		return r.startGraph(nil)
+	}
+	if err = r.triples(); err != nil || r.inGraph {
+		// a graph block was started instead
+		return err
+	}
+	return r.expect(".")
+}
+
+func (r *Reader) directive(name string) error {
+	if name == "prefix" {
+		t, err := r.next()
+		if err != nil {
+			return err
+		} else if t.kind != tokPName || t.local != "" {
+			return r.unexpected(t, "a prefix")
+		}
+		iri, err := r.iriRef()
+		if err != nil {
+			return err
+		}
+		r.prefixes[t.val] = string(iri)
+		return nil
+	}
+	iri, err := r.iriRef()
+	if err != nil {
+		return err
+	}
+	return r.SetBase(string(iri))
+}
+
+func (r *Reader) graphLabel() (quad.Value, error) {
+	t, err := r.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.is(tokPunct, "[") {
+		r.next()
+		if err = r.expect("]"); err != nil {
+			return nil, err
+		}
+		return r.newBNode(), nil
+	}
+	return r.iriOrBNode()
+}
+
+func (r *Reader) startGraph(label quad.Value) error {
+	if err := r.expect("{"); err != nil {
+		return err
+	}
+	r.inGraph, r.graph = true, label
+	return nil
+}
+
+// triples parses a subject with a list of predicates and objects. In TriG, the subject may be a graph label instead.
+func (r *Reader) triples() error {
+	t, err := r.peek()
+	if err != nil {
+		return err
+	}
+	var s quad.Value
+	switch {
+	case t.is(tokPunct, "["):
+		r.next()
+		if t, err = r.peek(); err != nil {
+			return err
+		}
+		s = r.newBNode()
+		if !t.is(tokPunct, "]") {
+			if err = r.predicateObjectList(s); err != nil {
+				return err
+			}
+			if err = r.expect("]"); err != nil {
+				return err
+			}
+			// predicates are optional after a blank node property list
+			if t, err = r.peek(); err != nil {
+				return err
+			} else if t.is(tokPunct, ".") || t.is(tokPunct, "}") {
+				return nil
+			}
+			break
+		}
+		r.next()
+	case t.is(tokPunct, "("):
+		r.next()
+		if s, err = r.collection(); err != nil {
+			return err
+		}
+	default:
+		if s, err = r.iriOrBNode(); err != nil {
+			return err
+		}
+	}
+	if r.trig && !r.inGraph {
+		if t, err = r.peek(); err != nil {
+			return err
+		} else if t.is(tokPunct, "{") {
+			return r.startGraph(s)
+		}
+	}
+	return r.predicateObjectList(s)
+}
+
+func (r *Reader) predicateObjectList(s quad.Value) error {
+	for {
+		p, err := r.verb()
+		if err != nil {
+			return err
+		}
+		if err = r.objectList(s, p); err != nil {
+			return err
+		}
+		t, err := r.peek()
+		if err != nil {
+			return err
+		} else if !t.is(tokPunct, ";") {
+			return nil
+		}
+		for t.is(tokPunct, ";") {
+			r.next()
+			if t, err = r.peek(); err != nil {
+				return err
+			}
+		}
+		// the list may end with a semicolon
+		if t.kind == tokEOF || (t.kind == tokPunct && strings.Contains(".]}", t.val)) {
+			return nil
+		}
+	}
+}
+
+func (r *Reader) verb() (quad.Value, error) {
+	t, err := r.peek()
+	if err != nil {
+		return nil, err
+	} else if t.is(tokWord, "a") {
+		r.next()
+		return rdfType, nil
+	}
+	return r.iri()
+}
+
+func (r *Reader) objectList(s, p quad.Value) error {
+	for {
+		o, err := r.object()
+		if err != nil {
+			return err
+		}
+		r.emit(s, p, o)
+		t, err := r.peek()
+		if err != nil {
+			return err
+		} else if !t.is(tokPunct, ",") {
+			return nil
+		}
+		r.next()
+	}
+}
+
+func (r *Reader) object() (quad.Value, error) {
+	t, err := r.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case tokIRI, tokPName, tokBNode:
+		return r.iriOrBNode()
+	case tokString:
+		r.next()
+		return r.literal(t.val)
+	case tokInteger:
+		r.next()
+		return typed(t.val, xsdInteger), nil
+	case tokDecimal:
+		r.next()
+		return typed(t.val, xsdDecimal), nil
+	case tokDouble:
+		r.next()
+		return typed(t.val, xsdDouble), nil
+	case tokWord:
+		if t.val == "true" || t.val == "false" {
+			r.next()
+			return typed(t.val, xsdBoolean), nil
+		}
+	case tokPunct:
+		switch t.val {
+		case "[":
+			r.next()
+			b := r.newBNode()
+			if t, err = r.peek(); err != nil {
+				return nil, err
+			} else if !t.is(tokPunct, "]") {
+				if err = r.predicateObjectList(b); err != nil {
+					return nil, err
+				}
+			}
+			return b, r.expect("]")
+		case "(":
+			r.next()
+			return r.collection()
+		}
+	}
+	return nil, r.unexpected(t, "an object")
+}
+
+// collection parses a list of objects after the opening parenthesis and returns the head of the list.
+func (r *Reader) collection() (quad.Value, error) {
+	var head, cur quad.Value = rdfNil, nil
+	for {
+		t, err := r.peek()
+		if err != nil {
+			return nil, err
+		} else if t.is(tokPunct, ")") {
+			r.next()
+			if cur != nil {
+				r.emit(cur, rdfRest, rdfNil)
+			}
+			return head, nil
+		}
+		o, err := r.object()
+		if err != nil {
+			return nil, err
+		}
+		b := r.newBNode()
+		if cur == nil {
+			head = b
+		} else {
+			r.emit(cur, rdfRest, b)
+		}
+		r.emit(b, rdfFirst, o)
+		cur = b
+	}
+}
+
+func (r *Reader) literal(s string) (quad.Value, error) {
+	t, err := r.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.kind == tokLang:
+		r.next()
+		return quad.LangString{Value: quad.String(s), Lang: t.val}, nil
+	case t.is(tokPunct, "^^"):
+		r.next()
+		typ, err := r.iri()
+		if err != nil {
+			return nil, err
+		}
+		return typed(s, typ.(quad.IRI)), nil
+	}
+	return quad.String(s), nil
+}
+
+func typed(s string, typ quad.IRI) quad.Value {
+	v := quad.TypedString{Value: quad.String(s), Type: typ}
+	if nquads.AutoConvertTypedString {
+		if nv, err := v.ParseValue(); err == nil {
+			return nv
+		}
+	}
+	return v
+}
+
+func (r *Reader) iriOrBNode() (quad.Value, error) {
+	t, err := r.peek()
+	if err != nil {
+		return nil, err
+	} else if t.kind == tokBNode {
+		r.next()
+		return r.bnode(t.val), nil
+	}
+	return r.iri()
+}
+
+// iri parses an IRI reference or a prefixed name.
+func (r *Reader) iri() (quad.Value, error) {
+	t, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case tokIRI:
+		return r.resolve(t.val)
+	case tokPName:
+		ns, ok := r.prefixes[t.val]
+		if !ok {
+			return nil, fmt.Errorf("line %d: undefined prefix %q", t.line, t.val+":")
+		}
+		return quad.IRI(ns + t.local), nil
+	}
+	return nil, r.unexpected(t, "an IRI")
+}
+
+func (r *Reader) iriRef() (quad.IRI, error) {
+	t, err := r.next()
+	if err != nil {
+		return "", err
+	} else if t.kind != tokIRI {
+		return "", r.unexpected(t, "an IRI")
+	}
+	return r.resolve(t.val)
+}
+
+// resolve resolves a relative IRI against the base IRI.
+func (r *Reader) resolve(s string) (quad.IRI, error) {
+	if r.base == nil {
+		return quad.IRI(s), nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("line %d: %w", r.lex.line, err)
+	}
+	return quad.IRI(r.base.ResolveReference(u).String()), nil
+}
+
+// bnode returns a blank node for a label from the document.
+func (r *Reader) bnode(label string) quad.BNode {
+	if b, ok := r.bnodes[label]; ok {
+		return b
+	}
+	b := quad.BNode(label)
+	if _, ok := r.used[label]; ok {
+		// the label was already generated for an anonymous node
+		b = r.newBNode()
+	}
+	r.used[string(b)] = struct{}{}
+	r.bnodes[label] = b
+	return b
+}
+
+// newBNode generates a label for an anonymous blank node.
+func (r *Reader) newBNode() quad.BNode {
+	for {
+		r.nextID++
+		label := "b" + strconv.Itoa(r.nextID)
+		if _, ok := r.used[label]; !ok {
+			r.used[label] = struct{}{}
+			return quad.BNode(label)
+		}
+	}
+}
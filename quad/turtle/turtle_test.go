@@ -0,0 +1,265 @@
+package turtle_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/turtle"
+	"github.com/aperturerobotics/cayley/quad/voc"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+)
+
+const (
+	ex      = "http://example.org/"
+	rdfType = quad.IRI("http://www.w3.org/1999/02/22-rdf-syntax-ns#type")
+)
+
+func iri(s string) quad.IRI { return quad.IRI(ex + s) }
+
+func newReader(trig bool, data string) quad.ReadCloser {
+	if trig {
+		return turtle.NewTriGReader(strings.NewReader(data))
+	}
+	return turtle.NewReader(strings.NewReader(data))
+}
+
+var readTests = []struct {
+	name  string
+	trig  bool
+	data  string
+	quads []quad.Quad
+	err   string
+}{
+	{
+		name: "prefixes",
+		data: `@prefix ex: <http://example.org/> .
+PREFIX foaf: <http://xmlns.com/foaf/0.1/>
+ex:alice a foaf:Person ; foaf:knows ex:bob, ex:carol ;
+	foaf:name "Alice"@en ; .
+# comment
+<http://example.org/bob> foaf:name 'Bob' .
+`,
+		quads: []quad.Quad{
+			{Subject: iri("alice"), Predicate: rdfType, Object: quad.IRI("http://xmlns.com/foaf/0.1/Person")},
+			{Subject: iri("alice"), Predicate: quad.IRI("http://xmlns.com/foaf/0.1/knows"), Object: iri("bob")},
+			{Subject: iri("alice"), Predicate: quad.IRI("http://xmlns.com/foaf/0.1/knows"), Object: iri("carol")},
+			{Subject: iri("alice"), Predicate: quad.IRI("http://xmlns.com/foaf/0.1/name"), Object: quad.LangString{Value: "Alice", Lang: "en"}},
+			{Subject: iri("bob"), Predicate: quad.IRI("http://xmlns.com/foaf/0.1/name"), Object: quad.String("Bob")},
+		},
+	},
+	{
+		name: "base",
+		data: `@base <http://example.org/a/> .
+<b> <c> <../d> .
+BASE <http://example.org/x/>
+<y> <#z> <> .
+`,
+		quads: []quad.Quad{
+			{Subject: iri("a/b"), Predicate: iri("a/c"), Object: iri("d")},
+			{Subject: iri("x/y"), Predicate: iri("x/#z"), Object: iri("x/")},
+		},
+	},
+	{
+		name: "literals",
+		data: `@prefix ex: <http://example.org/> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+ex:s ex:p 42, -1.5, 1e3, true, false, "7"^^xsd:integer, "x"^^ex:t,
+	"""multi
+"line" string""", "esc\tA" .
+`,
+		quads: []quad.Quad{
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.Int(42)},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.TypedString{Value: "-1.5", Type: "http://www.w3.org/2001/XMLSchema#decimal"}},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.Float(1000)},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.Bool(true)},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.Bool(false)},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.Int(7)},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.TypedString{Value: "x", Type: iri("t")}},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.String("multi\n\"line\" string")},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.String("esc\tA")},
+		},
+	},
+	{
+		name: "blank nodes",
+		data: `@prefix : <http://example.org/> .
+_:b1 :p [ :q :o ; :r [] ] .
+[ :p :o ] .
+[] :p _:b1 .
+`,
+		quads: []quad.Quad{
+			{Subject: quad.BNode("b2"), Predicate: iri("q"), Object: iri("o")},
+			{Subject: quad.BNode("b2"), Predicate: iri("r"), Object: quad.BNode("b3")},
+			{Subject: quad.BNode("b1"), Predicate: iri("p"), Object: quad.BNode("b2")},
+			{Subject: quad.BNode("b4"), Predicate: iri("p"), Object: iri("o")},
+			{Subject: quad.BNode("b5"), Predicate: iri("p"), Object: quad.BNode("b1")},
+		},
+	},
+	{
+		name: "collections",
+		data: `@prefix : <http://example.org/> .
+:s :p ( 1 :a ), () .
+`,
+		quads: []quad.Quad{
+			{Subject: quad.BNode("b1"), Predicate: quad.IRI(rdf.First).Full(), Object: quad.Int(1)},
+			{Subject: quad.BNode("b1"), Predicate: quad.IRI(rdf.Rest).Full(), Object: quad.BNode("b2")},
+			{Subject: quad.BNode("b2"), Predicate: quad.IRI(rdf.First).Full(), Object: iri("a")},
+			{Subject: quad.BNode("b2"), Predicate: quad.IRI(rdf.Rest).Full(), Object: quad.IRI(rdf.Nil).Full()},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.BNode("b1")},
+			{Subject: iri("s"), Predicate: iri("p"), Object: quad.IRI(rdf.Nil).Full()},
+		},
+	},
+	{
+		name: "trig",
+		trig: true,
+		data: `@prefix : <http://example.org/> .
+:s :p :o .
+GRAPH :g1 { :s :p :o1 }
+:g2 { :s :p :o2 . :s :p :o3 . }
+{ :s :p :o4 }
+_:g3 { :s :p :o5 }
+`,
+		quads: []quad.Quad{
+			{Subject: iri("s"), Predicate: iri("p"), Object: iri("o")},
+			{Subject: iri("s"), Predicate: iri("p"), Object: iri("o1"), Label: iri("g1")},
+			{Subject: iri("s"), Predicate: iri("p"), Object: iri("o2"), Label: iri("g2")},
+			{Subject: iri("s"), Predicate: iri("p"), Object: iri("o3"), Label: iri("g2")},
+			{Subject: iri("s"), Predicate: iri("p"), Object: iri("o4")},
+			{Subject: iri("s"), Predicate: iri("p"), Object: iri("o5"), Label: quad.BNode("g3")},
+		},
+	},
+	{name: "no dot", data: "<s> <p> <o>", err: "line 1: expected '.'"},
+	{name: "line break", data: "<s> <p> \"o .\n", err: "line 1: line break in a string"},
+	{name: "undefined prefix", data: "\nex:s <p> <o> .", err: `line 2: undefined prefix "ex:"`},
+	{name: "no object", data: "<s> <p> .", err: "line 1: expected an object"},
+	{name: "graph in turtle", data: "<s> <p> <o> <g> .", err: "line 1: expected '.'"},
+	{name: "graph in trig", trig: true, data: "<s> <p> <o> <g> .", err: "line 1: expected '.'"},
+}
+
+func TestReader(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range readTests {
+		t.Run(c.name, func(t *testing.T) {
+			quads, err := quad.ReadAll(ctx, newReader(c.trig, c.data))
+			if c.err != "" {
+				require.ErrorContains(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.quads, quads)
+		})
+	}
+}
+
+// writeQuads are not sorted: the writer groups them by graph and subject.
+var writeQuads = []quad.Quad{
+	{Subject: iri("alice"), Predicate: rdfType, Object: iri("Person")},
+	{Subject: iri("alice"), Predicate: iri("knows"), Object: iri("bob")},
+	{Subject: quad.BNode("x"), Predicate: iri("ok"), Object: quad.Bool(true)},
+	{Subject: iri("bob"), Predicate: iri("name"), Object: quad.LangString{Value: "Bob", Lang: "en"}, Label: iri("g")},
+	{Subject: iri("alice"), Predicate: iri("age"), Object: quad.Int(30)},
+	{Subject: quad.BNode("x"), Predicate: iri("path"), Object: quad.IRI("http://other.org/a b"), Label: iri("g")},
+	{Subject: iri("alice"), Predicate: iri("knows"), Object: quad.BNode("x")},
+	{Subject: iri("bob"), Predicate: iri("height"), Object: quad.Float(1.8), Label: iri("g")},
+	{Subject: quad.BNode("x"), Predicate: iri("date"), Object: quad.TypedString{Value: "2020-01-01", Type: "http://www.w3.org/2001/XMLSchema#date"}},
+}
+
+func TestWriter(t *testing.T) {
+	var ns voc.Namespaces
+	ns.Register(voc.Namespace{Prefix: "ex:", Full: ex})
+	ns.Register(voc.Namespace{Prefix: "xsd:", Full: "http://www.w3.org/2001/XMLSchema#"})
+	ns.Register(voc.Namespace{Prefix: "foaf:", Full: "http://xmlns.com/foaf/0.1/"})
+
+	for _, c := range []struct {
+		name  string
+		trig  bool
+		quads []quad.Quad
+		exp   string
+	}{
+		{
+			name:  "turtle",
+			quads: writeQuads,
+			exp: `@prefix ex: <http://example.org/> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+ex:alice a ex:Person ;
+    ex:knows ex:bob,
+        _:x ;
+    ex:age 30 .
+_:x ex:ok true ;
+    ex:path <http://other.org/a\u0020b> ;
+    ex:date "2020-01-01"^^xsd:date .
+ex:bob ex:name "Bob"@en ;
+    ex:height 1.8E+00 .
+`,
+		},
+		{
+			name:  "trig",
+			trig:  true,
+			quads: writeQuads,
+			exp: `@prefix ex: <http://example.org/> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+ex:alice a ex:Person ;
+    ex:knows ex:bob,
+        _:x ;
+    ex:age 30 .
+_:x ex:ok true ;
+    ex:date "2020-01-01"^^xsd:date .
+ex:g {
+    ex:bob ex:name "Bob"@en ;
+        ex:height 1.8E+00 .
+    _:x ex:path <http://other.org/a\u0020b> .
+}
+`,
+		},
+		{
+			name: "no prefixes",
+			quads: []quad.Quad{
+				{Subject: quad.IRI("http://other.org/s"), Predicate: quad.IRI("http://other.org/p"), Object: quad.String("o")},
+			},
+			exp: `<http://other.org/s> <http://other.org/p> "o" .
+`,
+		},
+		{
+			name: "empty",
+			exp:  ``,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			buf := bytes.NewBuffer(nil)
+			var w *turtle.Writer
+			if c.trig {
+				w = turtle.NewTriGWriter(buf)
+			} else {
+				w = turtle.NewWriter(buf)
+			}
+			w.SetNamespaces(&ns)
+			_, err := quad.Copy(ctx, w, quad.NewReader(c.quads))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			require.Equal(t, c.exp, buf.String())
+
+			// the document is read back with the same quads; Turtle drops labels
+			quads, err := quad.ReadAll(ctx, newReader(c.trig, buf.String()))
+			require.NoError(t, err)
+			var exp []quad.Quad
+			for _, q := range c.quads {
+				if !c.trig {
+					q.Label = nil
+				}
+				exp = append(exp, q)
+			}
+			require.ElementsMatch(t, exp, quads)
+		})
+	}
+	f := quad.FormatByMime("text/turtle")
+	require.NotNil(t, f)
+	require.Equal(t, f, quad.FormatByExt(".ttl"))
+	require.Equal(t, "turtle", f.Name)
+}
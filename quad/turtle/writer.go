@@ -0,0 +1,280 @@
+package turtle
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc"
+)
+
+const indent = "    "
+
+// Writer generates Turtle and TriG documents.
+//
+// Quads are buffered until the writer is closed. Quads with the same subject are grouped into a single
+// statement, and subjects are written in order of their first appearance. IRIs are shortened with
+// registered namespace prefixes, and only prefixes that are used are declared. Turtle documents
+// have no named graphs, thus labels are not written.
+type Writer struct {
+	w    io.Writer
+	ns   *voc.Namespaces
+	trig bool
+
+	pref []voc.Namespace // namespaces that can be declared, longest first
+	used map[string]bool // prefixes used in the document
+
+	graphs  []*graphQuads // in order of the first appearance
+	byGraph map[string]*graphQuads
+	closed  bool
+}
+
+// graphQuads is a group of quads with the same label.
+type graphQuads struct {
+	label  quad.Value
+	subj   []*subjectQuads // in order of the first appearance
+	bySubj map[string]*subjectQuads
+}
+
+// subjectQuads is a group of quads with the same subject. Objects are grouped by predicates.
+type subjectQuads struct {
+	subj   quad.Value
+	preds  []quad.Value // in order of the first appearance
+	byPred map[string][]quad.Value
+}
+
+// NewWriter creates a Turtle writer.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, ns: voc.Clone(), byGraph: make(map[string]*graphQuads)}
+}
+
+// NewTriGWriter creates a TriG writer.
+func NewTriGWriter(w io.Writer) *Writer {
+	wr := NewWriter(w)
+	wr.trig = true
+	return wr
+}
+
+// SetNamespaces sets namespaces to use instead of globally registered ones.
+// It must be called before closing the writer.
+func (w *Writer) SetNamespaces(ns *voc.Namespaces) {
+	w.ns = ns
+}
+
+// key returns a key of a value for grouping. Nil values have an empty key.
+func key(v quad.Value) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+func (w *Writer) WriteQuad(ctx context.Context, q quad.Quad) error {
+	if !q.IsValid() {
+		return quad.ErrInvalid
+	}
+	var label quad.Value
+	if w.trig {
+		label = q.Label
+	}
+	g := w.byGraph[key(label)]
+	if g == nil {
+		g = &graphQuads{label: label, bySubj: make(map[string]*subjectQuads)}
+		w.byGraph[key(label)] = g
+		w.graphs = append(w.graphs, g)
+	}
+	sq := g.bySubj[key(q.Subject)]
+	if sq == nil {
+		sq = &subjectQuads{subj: q.Subject, byPred: make(map[string][]quad.Value)}
+		g.bySubj[key(q.Subject)] = sq
+		g.subj = append(g.subj, sq)
+	}
+	pk := key(q.Predicate)
+	if _, ok := sq.byPred[pk]; !ok {
+		sq.preds = append(sq.preds, q.Predicate)
+	}
+	sq.byPred[pk] = append(sq.byPred[pk], q.Object)
+	return nil
+}
+
+func (w *Writer) WriteQuads(ctx context.Context, buf []quad.Quad) (int, error) {
+	for i, q := range buf {
+		if err := w.WriteQuad(ctx, q); err != nil {
+			return i, err
+		}
+	}
+	return len(buf), nil
+}
+
+// Close writes buffered quads to the document.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.setPrefixes()
+	var body strings.Builder
+	for _, g := range w.graphs {
+		ind := ""
+		if g.label != nil {
+			body.WriteString(w.value(g.label) + " {\n")
+			ind = indent
+		}
+		for _, sq := range g.subj {
+			body.WriteString(ind + w.value(sq.subj))
+			for i, p := range sq.preds {
+				if i == 0 {
+					body.WriteString(" ")
+				} else {
+					body.WriteString(" ;\n" + ind + indent)
+				}
+				body.WriteString(w.predicate(p) + " ")
+				for j, o := range sq.byPred[key(p)] {
+					if j != 0 {
+						body.WriteString(",\n" + ind + indent + indent)
+					}
+					body.WriteString(w.value(o))
+				}
+			}
+			body.WriteString(" .\n")
+		}
+		if g.label != nil {
+			body.WriteString("}\n")
+		}
+	}
+	bw := bufio.NewWriter(w.w)
+	w.writeHeader(bw)
+	bw.WriteString(body.String())
+	return bw.Flush()
+}
+
+// setPrefixes collects namespaces that can be declared in the document.
+func (w *Writer) setPrefixes() {
+	w.used = make(map[string]bool)
+	for _, ns := range w.ns.List() {
+		pref := strings.TrimSuffix(ns.Prefix, ":")
+		if pref == ns.Prefix || !isPrefix(pref) {
+			continue
+		}
+		w.pref = append(w.pref, ns)
+	}
+	sort.Slice(w.pref, func(i, j int) bool {
+		if len(w.pref[i].Full) != len(w.pref[j].Full) {
+			return len(w.pref[i].Full) > len(w.pref[j].Full)
+		}
+		return w.pref[i].Prefix < w.pref[j].Prefix
+	})
+}
+
+// writeHeader declares namespaces that are used in the document.
+func (w *Writer) writeHeader(bw *bufio.Writer) {
+	var list []voc.Namespace
+	for _, ns := range w.pref {
+		if w.used[ns.Prefix] {
+			list = append(list, ns)
+		}
+	}
+	if len(list) == 0 {
+		return
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Prefix < list[j].Prefix })
+	for _, ns := range list {
+		bw.WriteString("@prefix " + ns.Prefix + " <" + escapeIRI(ns.Full) + "> .\n")
+	}
+	bw.WriteString("\n")
+}
+
+func (w *Writer) predicate(p quad.Value) string {
+	if iri, ok := p.(quad.IRI); ok && w.full(iri) == rdfType {
+		return "a"
+	}
+	return w.value(p)
+}
+
+func (w *Writer) value(v quad.Value) string {
+	switch v := v.(type) {
+	case quad.IRI:
+		return w.iri(v)
+	case quad.TypedString:
+		return v.Value.String() + "^^" + w.iri(v.Type)
+	case quad.Int:
+		return strconv.FormatInt(int64(v), 10)
+	case quad.Bool:
+		return strconv.FormatBool(bool(v))
+	case quad.Float:
+		if f := float64(v); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return strconv.FormatFloat(f, 'E', -1, 64)
+		}
+	case quad.String, quad.LangString, quad.BNode:
+		return v.String()
+	}
+	if ts, ok := v.(quad.TypedStringer); ok {
+		return w.value(ts.TypedString())
+	}
+	return v.String()
+}
+
+// full expands IRIs shortened with either globally registered or the writer's namespaces.
+func (w *Writer) full(iri quad.IRI) quad.IRI {
+	return iri.Full().FullWith(w.ns)
+}
+
+// iri returns a prefixed name for an IRI, if possible, or a full IRI reference.
+func (w *Writer) iri(iri quad.IRI) string {
+	full := string(w.full(iri))
+	for _, ns := range w.pref {
+		if local, ok := strings.CutPrefix(full, ns.Full); ok && isLocal(local) {
+			w.used[ns.Prefix] = true
+			return ns.Prefix + local
+		}
+	}
+	return "<" + escapeIRI(full) + ">"
+}
+
+// escapeIRI replaces characters that are not allowed in IRI references with numeric escapes.
+func escapeIRI(s string) string {
+	if !strings.ContainsFunc(s, invalidIRIChar) {
+		return s
+	}
+	var sb strings.Builder
+	for _, c := range s {
+		if invalidIRIChar(c) {
+			fmt.Fprintf(&sb, "\\u%04X", c)
+		} else {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+func invalidIRIChar(c rune) bool {
+	return c <= ' ' || strings.ContainsRune(`<>"{}|^\`+"`", c)
+}
+
+// isPrefix checks if a string is a valid namespace prefix.
+func isPrefix(s string) bool {
+	for i, c := range s {
+		if (i == 0 && !isNameStart(c)) || (!isNameChar(c) && c != '.') {
+			return false
+		}
+	}
+	return !strings.HasSuffix(s, ".")
+}
+
+// isLocal checks if a string can be written as a local part of a prefixed name without escaping.
+func isLocal(s string) bool {
+	for i, c := range s {
+		if i == 0 && (c == '-' || c == '.' || c == 0xb7) {
+			return false
+		} else if !isNameChar(c) && c != ':' && c != '.' {
+			return false
+		}
+	}
+	return !strings.HasSuffix(s, ".")
+}
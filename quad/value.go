@@ -16,7 +16,8 @@ import (
 	"github.com/aperturerobotics/cayley/quad/voc/xsd"
 )
 
-// IsValidValue checks if the value is valid. It returns false if the value is nil, an empty IRI or an empty BNode.
+// IsValidValue checks if the value is valid. It returns false if the value is nil, an empty IRI, an empty BNode,
+// or a quoted triple with invalid values.
 func IsValidValue(v Value) bool {
 	if v == nil {
 		return false
@@ -26,6 +27,8 @@ func IsValidValue(v Value) bool {
 		return v != ""
 	case BNode:
 		return v != ""
+	case Quoted:
+		return v.Quad().IsValid()
 	}
 	return true
 }
@@ -330,6 +333,55 @@ func (s BNode) GoString() string {
 }
 func (s BNode) Native() any { return s }
 
+// Quoted is an RDF-star quoted triple (ex: << <s> <p> "o" >>). It is used to make statements
+// about other statements, without asserting them.
+type Quoted struct {
+	Subject   Value
+	Predicate Value
+	Object    Value
+}
+
+// Quote creates a quoted triple from a quad. The label of the quad is ignored.
+func Quote(q Quad) Quoted {
+	return Quoted{Subject: q.Subject, Predicate: q.Predicate, Object: q.Object}
+}
+
+func (s Quoted) String() string {
+	return `<< ` + StringOf(s.Subject) + ` ` + StringOf(s.Predicate) + ` ` + StringOf(s.Object) + ` >>`
+}
+func (s Quoted) Native() any { return s }
+
+// Quad returns the quoted triple as a quad without a label.
+func (s Quoted) Quad() Quad {
+	return Quad{Subject: s.Subject, Predicate: s.Predicate, Object: s.Object}
+}
+
+// Get returns a value of the quoted triple in a given direction. Quoted triples have no labels.
+func (s Quoted) Get(d Direction) Value {
+	if d == Label {
+		return nil
+	}
+	return s.Quad().Get(d)
+}
+
+func (s Quoted) Equal(v Value) bool {
+	q, ok := v.(Quoted)
+	if !ok {
+		return false
+	}
+	for _, d := range []Direction{Subject, Predicate, Object} {
+		a, b := s.Get(d), q.Get(d)
+		if eq, ok := a.(Equaler); ok {
+			if !eq.Equal(b) {
+				return false
+			}
+		} else if a != b {
+			return false
+		}
+	}
+	return true
+}
+
 // Native support for basic types
 
 // StringConversion is a function to convert string values with a
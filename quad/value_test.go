@@ -15,6 +15,8 @@ var hashCases = []struct {
 	{Raw(`_:abc`), "3603f98d3203a037ffa6b8780b97ef8bc964fd94"},
 	{IRI(`abc`), "b301db80a006fb0c667f3feffbf8c68a7b38fe7e"},
 	{Raw(`<abc>`), "b301db80a006fb0c667f3feffbf8c68a7b38fe7e"},
+	{Quoted{IRI(`a`), IRI(`b`), String(`c`)}, "bbfbda7a7682a30856daa153a278d6b7aa182d7a"},
+	{Raw(`<< <a> <b> "c" >>`), "bbfbda7a7682a30856daa153a278d6b7aa182d7a"},
 }
 
 func TestHashOf(t *testing.T) {
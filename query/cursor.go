@@ -0,0 +1,384 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/aperturerobotics/cayley/graph/iterator"
+)
+
+var (
+	// ErrStaleCursor is returned when results of the query have changed since the cursor was issued.
+	ErrStaleCursor = iterator.ErrStaleCursor
+	// ErrInvalidCursor is returned when the cursor cannot be decoded or was issued for a different query.
+	ErrInvalidCursor = iterator.ErrInvalidCursor
+	// ErrCursorTooFar is returned when the query cannot be resumed at the cursor without skipping
+	// more than iterator.MaxCursorSkip results.
+	ErrCursorTooFar = iterator.ErrCursorTooFar
+)
+
+// CursorIterator is an optional interface for iterators that can save their position.
+type CursorIterator interface {
+	Iterator
+	// State returns an opaque position after the current result.
+	State(ctx context.Context) ([]byte, error)
+}
+
+// CursorSession is an optional interface for sessions that can continue a query at a position saved
+// by CursorIterator. Paginated queries of such sessions don't go through the results before the cursor.
+type CursorSession interface {
+	Session
+	// ExecuteAt runs the query and continues after the position saved with CursorIterator.State.
+	ExecuteAt(ctx context.Context, query string, opt Options, state []byte) (Iterator, error)
+}
+
+// Page is a single page of query results.
+type Page struct {
+	Results []any
+	// Next is an opaque cursor for the next page. It's empty if there are no more results.
+	Next string
+}
+
+// cursorState is a position in query results that is encoded in a cursor.
+type cursorState struct {
+	ID    uint64 `json:"id,omitempty"` // open iterator, if any
+	Query uint64 `json:"q"`            // hash of the query
+	N     int64  `json:"n"`            // number of results before the cursor
+	Last  uint64 `json:"h,omitempty"`  // hash of the last result before the cursor
+	Pos   []byte `json:"p,omitempty"`  // position of a CursorIterator, if the query has one
+}
+
+func (st cursorState) equal(o cursorState) bool {
+	return st.ID == o.ID && st.Query == o.Query && st.N == o.N && st.Last == o.Last && bytes.Equal(st.Pos, o.Pos)
+}
+
+func (st cursorState) encode() string {
+	data, _ := json.Marshal(st)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursorState, error) {
+	var st cursorState
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return st, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(data, &st); err != nil || st.N < 0 {
+		return st, ErrInvalidCursor
+	}
+	return st, nil
+}
+
+func hashQuery(qu string, coll Collation) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%s", coll, qu)
+	return h.Sum64()
+}
+
+// hashResult returns a hash of a single query result. It's used to check that results before the cursor have not changed.
+func hashResult(r any) uint64 {
+	h := fnv.New64a()
+	if data, err := json.Marshal(r); err == nil {
+		h.Write(data)
+	} else {
+		fmt.Fprint(h, r)
+	}
+	return h.Sum64()
+}
+
+// liveCursor is an open iterator of a paginated query.
+type liveCursor struct {
+	st     cursorState
+	it     Iterator
+	ctx    context.Context
+	cancel func()
+	timer  *time.Timer
+	since  time.Time // when the iterator was paused
+
+	next    any // result that was read ahead to check for the next page
+	hasNext bool
+}
+
+func (l *liveCursor) read() (any, bool, error) {
+	if l.hasNext {
+		r := l.next
+		l.next, l.hasNext = nil, false
+		return r, true, nil
+	}
+	if !l.it.Next(l.ctx) {
+		return nil, false, l.it.Err()
+	}
+	r, err := l.it.Result(l.ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return r, true, nil
+}
+
+// page reads at most limit results and checks if there are more of them.
+func (l *liveCursor) page(ctx context.Context, limit int) ([]any, bool, error) {
+	stop := context.AfterFunc(ctx, l.cancel)
+	defer stop()
+	var out []any
+	for limit <= 0 || len(out) < limit {
+		r, ok, err := l.read()
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return nil, false, err
+		} else if !ok {
+			return out, false, nil
+		}
+		out = append(out, r)
+	}
+	var pos []byte
+	if it, ok := l.it.(CursorIterator); ok && len(out) > 0 {
+		var err error
+		if pos, err = it.State(l.ctx); err != nil {
+			return nil, false, err
+		}
+	}
+	r, ok, err := l.read()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil || !ok {
+		return out, false, err
+	}
+	l.next, l.hasNext = r, true
+	l.st.N += int64(len(out))
+	l.st.Last = hashResult(out[len(out)-1])
+	l.st.Pos = pos
+	return out, true, nil
+}
+
+func (l *liveCursor) close() {
+	l.it.Close()
+	l.cancel()
+}
+
+// startCursor runs the query and continues at the cursor. If the session cannot resume the query
+// at a saved position, results before the cursor are skipped, up to iterator.MaxCursorSkip of them.
+func startCursor(ctx context.Context, s Session, qu string, st cursorState, opt Options) (*liveCursor, error) {
+	if st.N > iterator.MaxCursorSkip && st.Pos == nil {
+		return nil, ErrCursorTooFar
+	}
+	// the iterator may outlive the request; results must be in the same order each time the query runs
+	lctx, cancel := context.WithCancel(iterator.WithParallel(context.WithoutCancel(ctx), 0))
+	opt.Limit = 0
+	var (
+		it  Iterator
+		err error
+	)
+	if st.Pos != nil {
+		cs, ok := s.(CursorSession)
+		if !ok {
+			cancel()
+			return nil, ErrInvalidCursor
+		}
+		stop := context.AfterFunc(ctx, cancel)
+		it, err = cs.ExecuteAt(lctx, qu, opt, st.Pos)
+		stop()
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			if it != nil {
+				it.Close()
+			}
+			cancel()
+			return nil, err
+		}
+		st.ID = 0
+		return &liveCursor{st: st, it: it, ctx: lctx, cancel: cancel}, nil
+	}
+	it, err = s.Execute(lctx, qu, opt)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	l := &liveCursor{st: cursorState{Query: st.Query}, it: it, ctx: lctx, cancel: cancel}
+	if st.N == 0 {
+		return l, nil
+	}
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	var last any
+	for l.st.N < st.N {
+		r, ok, err := l.read()
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil && !ok {
+			err = ErrStaleCursor
+		}
+		if err != nil {
+			l.close()
+			return nil, err
+		}
+		l.st.N++
+		last = r
+	}
+	if l.st.Last = hashResult(last); l.st.Last != st.Last {
+		l.close()
+		return nil, ErrStaleCursor
+	}
+	return l, nil
+}
+
+// Cursors keeps iterators of paginated queries open between pages, thus the next page continues
+// where the previous one has stopped, instead of running the query again.
+//
+// A nil value is valid and keeps no iterators open.
+type Cursors struct {
+	max int
+	ttl time.Duration
+
+	mu   sync.Mutex
+	live map[uint64]*liveCursor
+}
+
+// NewCursors creates a set that keeps at most max iterators open. Each iterator is closed
+// if the next page is not requested within ttl.
+func NewCursors(max int, ttl time.Duration) *Cursors {
+	return &Cursors{max: max, ttl: ttl, live: make(map[uint64]*liveCursor)}
+}
+
+// take returns an open iterator at the position of the cursor, or nil if there is none.
+func (c *Cursors) take(st cursorState) *liveCursor {
+	if c == nil || st.ID == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := c.live[st.ID]
+	if l == nil || !l.st.equal(st) {
+		return nil
+	}
+	delete(c.live, st.ID)
+	l.timer.Stop()
+	return l
+}
+
+// put keeps an iterator open until the next page, and returns a cursor for it.
+func (c *Cursors) put(l *liveCursor) string {
+	if c == nil || c.max <= 0 {
+		l.close()
+		l.st.ID = 0
+		return l.st.encode()
+	}
+	var evict *liveCursor
+	c.mu.Lock()
+	if len(c.live) >= c.max {
+		for _, o := range c.live {
+			if evict == nil || o.since.Before(evict.since) {
+				evict = o
+			}
+		}
+		delete(c.live, evict.st.ID)
+		evict.timer.Stop()
+	}
+	l.st.ID = c.newID()
+	l.since = time.Now()
+	c.live[l.st.ID] = l
+	l.timer = time.AfterFunc(c.ttl, func() {
+		c.mu.Lock()
+		expired := c.live[l.st.ID] == l
+		if expired {
+			delete(c.live, l.st.ID)
+		}
+		c.mu.Unlock()
+		if expired {
+			l.close()
+		}
+	})
+	st := l.st
+	c.mu.Unlock()
+	if evict != nil {
+		evict.close()
+	}
+	return st.encode()
+}
+
+// newID returns a random unused id for an iterator. IDs are random to make cursors of other clients hard to guess.
+func (c *Cursors) newID() uint64 {
+	var b [8]byte
+	for {
+		rand.Read(b[:])
+		id := binary.BigEndian.Uint64(b[:])
+		if _, ok := c.live[id]; id != 0 && !ok {
+			return id
+		}
+	}
+}
+
+// Len returns the number of open iterators.
+func (c *Cursors) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.live)
+}
+
+// Close closes all open iterators.
+func (c *Cursors) Close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	live := c.live
+	c.live = make(map[uint64]*liveCursor)
+	c.mu.Unlock()
+	for _, l := range live {
+		l.timer.Stop()
+		l.close()
+	}
+}
+
+// ExecutePage runs the query and returns a page of at most opt.Limit results, starting at the cursor.
+// An empty cursor starts from the first result.
+//
+// If the iterator of the cursor is not open anymore, the query runs again. Sessions that implement CursorSession
+// continue it at the cursor, otherwise results before the cursor are skipped, and ErrCursorTooFar is returned
+// if there are more than iterator.MaxCursorSkip of them.
+// ErrStaleCursor is returned if results before the cursor have changed since it was issued.
+func (c *Cursors) ExecutePage(ctx context.Context, s Session, qu string, cursor string, opt Options) (*Page, error) {
+	st := cursorState{Query: hashQuery(qu, opt.Collation)}
+	if cursor != "" {
+		cur, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		} else if cur.Query != st.Query {
+			return nil, ErrInvalidCursor
+		}
+		st = cur
+	}
+	l := c.take(st)
+	if l == nil {
+		var err error
+		l, err = startCursor(ctx, s, qu, st, opt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res, more, err := l.page(ctx, opt.Limit)
+	if err != nil || !more {
+		l.close()
+		if err != nil {
+			return nil, err
+		}
+		return &Page{Results: res}, nil
+	}
+	return &Page{Results: res, Next: c.put(l)}, nil
+}
@@ -0,0 +1,80 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+// Explanation describes execution plans of a query.
+type Explanation struct {
+	// Plans of all shape trees built by the query, in order.
+	Plans []shape.Plan `json:"plans"`
+	// Results is the number of results returned by the query. Set only with Analyze.
+	Results int `json:"results,omitempty"`
+	// Time is the total time of the query execution. Set only with Analyze.
+	Time time.Duration `json:"time_ns,omitempty"`
+}
+
+// Explain runs the query in a given session and returns its execution plans instead of results.
+//
+// Unless Analyze is set in options, iterators built by the query return no results. Languages that
+// evaluate queries in multiple steps may thus build fewer iterators than they would during the normal execution.
+func Explain(ctx context.Context, s Session, query string, opt Options) (*Explanation, error) {
+	analyze := opt.Analyze
+	e := shape.NewExplainer(analyze)
+	opt.Explain, opt.Analyze = false, false
+	ctx = shape.WithExplainer(ctx, e)
+
+	start := time.Now()
+	it, err := s.Execute(ctx, query, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	n := 0
+	for it.Next(ctx) {
+		n++
+	}
+	if err = it.Err(); err != nil {
+		return nil, err
+	}
+	out := &Explanation{Plans: e.Plans(ctx)}
+	if analyze {
+		out.Results = n
+		out.Time = time.Since(start)
+	}
+	return out, nil
+}
+
+// explainIterator returns an explanation as a single result.
+type explainIterator struct {
+	exp  *Explanation
+	coll Collation
+	done bool
+}
+
+func (it *explainIterator) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	it.done = true
+	return true
+}
+
+func (it *explainIterator) Err() error { return nil }
+
+func (it *explainIterator) Result(ctx context.Context) (any, error) {
+	if it.coll != REPL {
+		return it.exp, nil
+	}
+	data, err := json.MarshalIndent(it.exp, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return string(data) + "\n", nil
+}
+
+func (it *explainIterator) Close() error { return nil }
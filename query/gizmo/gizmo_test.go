@@ -691,6 +691,79 @@ var testQueries = []struct {
 			"smart_person",
 		},
 	},
+	{
+		message: "use order descending",
+		query: `
+			g.V().order("desc").limit(3).all()
+		`,
+		expect: []string{"smart_person", "cool_person", "<status>"},
+	},
+	{
+		message: "use order by tag",
+		query: `
+			g.V("<alice>", "<bob>", "<charlie>").save("<follows>", "target").order("target", "desc").limit(1).all()
+		`,
+		tag:    "target",
+		expect: []string{"<fred>"},
+	},
+	{
+		message: "use groupBy and aggregate",
+		query: `
+			g.V().tag("who").out("<follows>").groupBy("who").aggregate({op: "count", as: "n"}).all()
+		`,
+		tag: "n",
+		expect: []string{
+			`"1"^^<xsd:integer>`, `"1"^^<xsd:integer>`, `"1"^^<xsd:integer>`,
+			`"1"^^<xsd:integer>`, `"2"^^<xsd:integer>`, `"2"^^<xsd:integer>`,
+		},
+	},
+	{
+		message: "use aggregate without groups",
+		query: `
+			g.V().has("<status>").groupBy().aggregate({op: "count"}).all()
+		`,
+		expect: []string{`"5"^^<xsd:integer>`},
+	},
+	{
+		message: "use aggregate with unknown function",
+		query: `
+			g.V().groupBy().aggregate({op: "median"}).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use shortestPath",
+		query: `
+			g.V("<charlie>").shortestPath(g.V("<greg>"), "<follows>").all()
+		`,
+		expect: []string{"<charlie>", "<dani>", "<greg>"},
+	},
+	{
+		message: "use shortestPath cost",
+		query: `
+			g.V("<charlie>").shortestPath(g.V("<greg>"), "<follows>").all()
+		`,
+		tag:    "cost",
+		expect: []string{`"2"^^<xsd:integer>`, `"2"^^<xsd:integer>`, `"2"^^<xsd:integer>`},
+	},
+	{
+		message: "use k shortest paths",
+		query: `
+			g.V("<charlie>").shortestPath(g.V("<greg>"), "<follows>", null, 2).all()
+		`,
+		tag: "cost",
+		expect: []string{
+			`"2"^^<xsd:integer>`, `"2"^^<xsd:integer>`, `"2"^^<xsd:integer>`,
+			`"3"^^<xsd:integer>`, `"3"^^<xsd:integer>`, `"3"^^<xsd:integer>`, `"3"^^<xsd:integer>`,
+		},
+	},
+	{
+		message: "use shortestPath without predicate",
+		query: `
+			g.V("<charlie>").shortestPath(g.V("<greg>")).all()
+		`,
+		err: true,
+	},
 }
 
 func runQueryGetTag(ctx context.Context, rec func(), g []quad.Quad, qu string, tag string, limit int) ([]string, error) {
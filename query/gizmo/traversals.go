@@ -277,6 +277,56 @@ func (p *pathObject) FollowRecursive(call goja.FunctionCall) goja.Value {
 	return p.newVal(np)
 }
 
+// ShortestPath finds the shortest paths from each of the current nodes to the nodes of another path.
+//
+// Arguments:
+//
+//   - `to`: A path with target nodes.
+//   - `via`: A predicate or a morphism path to follow.
+//   - `weight` (Optional): A predicate or a morphism path that resolves to a numeric cost of an edge.
+//     It's followed from the reified statement of the edge, or from its label if there is none.
+//     If not set or null, each step costs one.
+//   - `k` (Optional): A number of shortest paths to return for each pair of nodes. Defaults to one.
+//
+// Each node of each path is returned as a separate result, tagged with the index of the path ("path"),
+// the position of the node in the path ("step") and the total cost of the path ("cost").
+//
+// Example:
+//
+//	// javascript:
+//	// Returns charlie, dani and greg, with a cost of 2.
+//	g.V("<charlie>").shortestPath(g.V("<greg>"), "<follows>").all()
+func (p *pathObject) ShortestPath(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) < 2 {
+		return throwErr(p.s.vm, errors.New("expected a target path and a predicate for shortest path"))
+	}
+	to, ok := args[0].(*path.Path)
+	if !ok {
+		return throwErr(p.s.vm, fmt.Errorf("expected a target path, got: %T", args[0]))
+	}
+	preds := toVia(args[1:2])
+	if len(preds) != 1 {
+		return throwErr(p.s.vm, fmt.Errorf("expected one predicate or path for shortest path"))
+	}
+	var weight any
+	if len(args) > 2 {
+		if w := toVia(args[2:3]); len(w) == 1 {
+			weight = w[0]
+		} else if len(w) > 1 {
+			return throwErr(p.s.vm, fmt.Errorf("expected one predicate or path for weight"))
+		}
+	}
+	k := 1
+	if len(args) > 3 {
+		if k, ok = toInt(args[3]); !ok || k < 1 {
+			return throwErr(p.s.vm, fmt.Errorf("expected a positive number of paths, got: %v", args[3]))
+		}
+	}
+	np := p.clonePath().KShortestPaths(to, preds[0], weight, k)
+	return p.newVal(np)
+}
+
 // And is an alias for Intersect.
 func (p *pathObject) And(path *pathObject) *pathObject {
 	return p.Intersect(path)
@@ -732,11 +782,102 @@ func (p *pathObject) Skip(offset int) *pathObject {
 	return p.new(np)
 }
 
-func (p *pathObject) Order() *pathObject {
-	np := p.clonePath().Order()
+// Order sorts nodes of the path. Numbers are compared numerically, times chronologically, and
+// strings by their values.
+//
+// Arguments:
+//
+//   - `tag` (Optional): A tag with values to sort by. If not set, current nodes of the path are used.
+//   - `direction` (Optional): Either "asc" or "desc". Applies to the preceding tag.
+//
+// Both arguments can be repeated to sort by multiple keys.
+//
+// Example:
+//
+//	// javascript
+//	// Sort all nodes in descending order.
+//	g.V().order("desc").all()
+//	// Sort people by their age, from the oldest to the youngest.
+//	g.V().save("<age>", "age").order("age", "desc").all()
+func (p *pathObject) Order(args ...string) *pathObject {
+	var keys []iterator.SortKey
+	for _, a := range args {
+		switch a {
+		case "asc", "desc":
+			if len(keys) == 0 {
+				keys = append(keys, iterator.SortKey{})
+			}
+			keys[len(keys)-1].Desc = a == "desc"
+		default:
+			keys = append(keys, iterator.SortKey{Tag: a})
+		}
+	}
+	np := p.clonePath().OrderBy(keys...)
 	return p.new(np)
 }
 
+// GroupBy groups paths by values of given tags. It returns a grouping object, and aggregate must be called on it.
+//
+// Arguments:
+//
+// * `tag`: A string or list of strings with tags to group paths by. Without tags all paths form a single group.
+//
+// Example:
+//
+//	// javascript
+//	// Count how many people each person follows.
+//	// Results are:
+//	//   {"id": "<alice>", "who": "<alice>", "n": 1},
+//	//   {"id": "<charlie>", "who": "<charlie>", "n": 2},
+//	//   ...
+//	g.V().tag("who").out("<follows>").groupBy("who").aggregate({op: "count", as: "n"}).all()
+func (p *pathObject) GroupBy(tags ...string) *groupingObject {
+	return &groupingObject{p: p, tags: tags}
+}
+
+// groupingObject is a result of GroupBy call in Gizmo.
+type groupingObject struct {
+	p    *pathObject
+	tags []string
+}
+
+// reducerArg is a JS object that describes a single aggregate.
+type reducerArg struct {
+	Op  string
+	Tag string
+	As  string
+}
+
+// Aggregate calculates aggregates for each group and saves them to tags.
+//
+// Arguments:
+//
+// * `reducer`: An object with the following fields. Can be repeated.
+//   - `op`: An aggregate function: "count", "sum", "min", "max" or "avg".
+//   - `tag`: A tag with values to aggregate. If not set, current nodes of the path are used.
+//   - `as`: A tag to save the aggregate to.
+//
+// Example:
+//
+//	// javascript
+//	// Find the latest reading of each device.
+//	g.V().save("<device>", "device").save("<time>", "time").groupBy("device").aggregate({op: "max", tag: "time", as: "last"}).all()
+func (g *groupingObject) Aggregate(args ...reducerArg) (*pathObject, error) {
+	if len(args) == 0 {
+		return nil, errArgCount{Got: len(args)}
+	}
+	reducers := make([]iterator.Reducer, 0, len(args))
+	for _, a := range args {
+		op, err := iterator.ParseAggregateOp(a.Op)
+		if err != nil {
+			return nil, err
+		}
+		reducers = append(reducers, iterator.Reducer{Op: op, Tag: a.Tag, As: a.As})
+	}
+	np := g.p.clonePath().GroupBy(g.tags...).Aggregate(reducers...)
+	return g.p.new(np), nil
+}
+
 // Backwards compatibility
 func (p *pathObject) CapitalizedIs(call goja.FunctionCall) goja.Value {
 	return p.Is(call)
@@ -28,10 +28,7 @@ func NewDocumentIterator(valueIt *ValueIterator) *DocumentIterator {
 func (it *DocumentIterator) getDataset(ctx context.Context) (*ld.RDFDataset, error) {
 	d := ld.NewRDFDataset()
 	for it.tagsIt.Next(ctx) {
-		r, err := it.tagsIt.ValueIt.scanner.Result(ctx)
-		if err != nil {
-			return nil, err
-		}
+		r := it.tagsIt.ValueIt.result()
 		if err := it.tagsIt.Err(); err != nil {
 			if err != nil {
 				return nil, err
@@ -40,7 +37,7 @@ func (it *DocumentIterator) getDataset(ctx context.Context) (*ld.RDFDataset, err
 		if r == nil {
 			continue
 		}
-		err = it.tagsIt.addResultsToDataset(ctx, d, r)
+		err := it.tagsIt.addResultsToDataset(ctx, d, r)
 		if err != nil {
 			return nil, err
 		}
@@ -13,7 +13,7 @@ import (
 	"github.com/piprate/json-gold/ld"
 )
 
-var _ query.Iterator = (*TagsIterator)(nil)
+var _ query.CursorIterator = (*TagsIterator)(nil)
 
 // TagsIterator is a result iterator for records consisting of selected tags
 // or all the tags in the query.
@@ -39,6 +39,15 @@ func (it *TagsIterator) Next(ctx context.Context) bool {
 	return it.ValueIt.Next(ctx)
 }
 
+// State implements query.CursorIterator.
+func (it *TagsIterator) State(ctx context.Context) ([]byte, error) {
+	return it.ValueIt.State(ctx)
+}
+
+func (it *TagsIterator) resume(ctx context.Context, state []byte) error {
+	return it.ValueIt.resume(ctx, state)
+}
+
 func (it *TagsIterator) addQuadFromRef(ctx context.Context, dataset *ld.RDFDataset, subject ld.Node, tag string, ref refs.Ref) error {
 	p := ld.NewIRI(tag)
 	rname, err := it.ValueIt.Namer.NameOf(ctx, ref)
@@ -73,7 +82,7 @@ func (it *TagsIterator) addResultsToDataset(ctx context.Context, dataset *ld.RDF
 	}
 
 	refTags := make(map[string]refs.Ref)
-	if err := it.ValueIt.scanner.TagResults(ctx, refTags); err != nil {
+	if err := it.ValueIt.tagResults(ctx, refTags); err != nil {
 		return err
 	}
 
@@ -96,15 +105,12 @@ func (it *TagsIterator) Result(ctx context.Context) (any, error) {
 		return nil, err
 	}
 	// FIXME(iddan): only convert when collation is JSON/JSON-LD, leave as Ref otherwise
-	r, err := it.ValueIt.scanner.Result(ctx)
-	if err != nil {
-		return nil, err
-	}
+	r := it.ValueIt.result()
 	if r == nil {
 		return nil, nil
 	}
 	d := ld.NewRDFDataset()
-	err = it.addResultsToDataset(ctx, d, r)
+	err := it.addResultsToDataset(ctx, d, r)
 	if err != nil {
 		it.err = err
 		return nil, err
@@ -15,14 +15,14 @@ import (
 	"github.com/aperturerobotics/cayley/query/path"
 )
 
-var _ query.Iterator = (*ValueIterator)(nil)
+var _ query.CursorIterator = (*ValueIterator)(nil)
 
 // ValueIterator is an iterator of values from the graph.
 type ValueIterator struct {
-	Namer   refs.Namer
-	path    *path.Path
-	scanner iterator.Scanner
-	err     error
+	Namer  refs.Namer
+	path   *path.Path
+	cursor *iterator.Cursor
+	err    error
 }
 
 // NewValueIterator returns a new ValueIterator for a path and namer.
@@ -40,12 +40,46 @@ func NewValueIteratorFromPathStep(ctx context.Context, step PathStep, qs graph.Q
 	return NewValueIterator(p, qs), nil
 }
 
+func (it *ValueIterator) newCursor(ctx context.Context) {
+	it.cursor = iterator.NewCursor(it.path.BuildIterator(ctx), it.Namer).WithoutPaths()
+}
+
 // Next implements query.Iterator.
 func (it *ValueIterator) Next(ctx context.Context) bool {
-	if it.scanner == nil {
-		it.scanner = it.path.BuildIterator(ctx).Iterate(ctx)
+	if it.cursor == nil {
+		it.newCursor(ctx)
+	}
+	return it.cursor.Next(ctx)
+}
+
+// State implements query.CursorIterator.
+func (it *ValueIterator) State(ctx context.Context) ([]byte, error) {
+	if it.cursor == nil {
+		it.newCursor(ctx)
 	}
-	return it.scanner.Next(ctx)
+	return it.cursor.State(ctx)
+}
+
+// resume continues the iteration after the position saved with State.
+func (it *ValueIterator) resume(ctx context.Context, state []byte) error {
+	it.newCursor(ctx)
+	return it.cursor.Resume(ctx, state)
+}
+
+// result returns the current result, or nil if the iteration has not started.
+func (it *ValueIterator) result() refs.Ref {
+	if it.cursor == nil {
+		return nil
+	}
+	return it.cursor.Result()
+}
+
+// tagResults fills a map with tags of the current result.
+func (it *ValueIterator) tagResults(ctx context.Context, dst map[string]refs.Ref) error {
+	if it.cursor == nil {
+		return nil
+	}
+	return it.cursor.TagResults(ctx, dst)
 }
 
 // Value returns the current value
@@ -53,14 +87,10 @@ func (it *ValueIterator) Value(ctx context.Context) (quad.Value, error) {
 	if err := it.Err(); err != nil {
 		return nil, err
 	}
-	if it.scanner == nil {
+	res := it.result()
+	if res == nil {
 		return nil, nil
 	}
-	res, err := it.scanner.Result(ctx)
-	if err != nil {
-		it.err = err
-		return nil, err
-	}
 	rname, err := it.Namer.NameOf(ctx, res)
 	if err != nil {
 		it.err = err
@@ -86,16 +116,16 @@ func (it *ValueIterator) Err() error {
 	if it.err != nil {
 		return it.err
 	}
-	if it.scanner == nil {
+	if it.cursor == nil {
 		return nil
 	}
-	return it.scanner.Err()
+	return it.cursor.Err()
 }
 
 // Close implements query.Iterator.
 func (it *ValueIterator) Close() error {
-	if it.scanner == nil {
+	if it.cursor == nil {
 		return nil
 	}
-	return it.scanner.Close()
+	return it.cursor.Close()
 }
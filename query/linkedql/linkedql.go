@@ -32,7 +32,7 @@ func init() {
 	})
 }
 
-var _ query.Session = &Session{}
+var _ query.CursorSession = &Session{}
 
 // Session represents a LinkedQL query processing.
 type Session struct {
@@ -60,6 +60,26 @@ func (s *Session) Execute(ctx context.Context, query string, opt query.Options)
 	return BuildIterator(ctx, step, s.qs, &ns)
 }
 
+// ExecuteAt implements query.CursorSession.
+func (s *Session) ExecuteAt(ctx context.Context, qu string, opt query.Options, state []byte) (query.Iterator, error) {
+	it, err := s.Execute(ctx, qu, opt)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := it.(interface {
+		resume(ctx context.Context, state []byte) error
+	})
+	if !ok {
+		it.Close()
+		return nil, query.ErrInvalidCursor
+	}
+	if err = r.resume(ctx, state); err != nil {
+		it.Close()
+		return nil, err
+	}
+	return it, nil
+}
+
 // BuildIterator for given Step returns a query.Iterator
 func BuildIterator(ctx context.Context, step Step, qs graph.QuadStore, ns *voc.Namespaces) (query.Iterator, error) {
 	switch s := step.(type) {
@@ -60,6 +60,7 @@ var (
 	quadSliceValue = reflect.TypeFor[[]quad.Value]()
 	quadIRI        = reflect.TypeFor[quad.IRI]()
 	quadSliceIRI   = reflect.TypeFor[[]quad.IRI]()
+	stringSlice    = reflect.TypeFor[[]string]()
 )
 
 // Unmarshal attempts to unmarshal an Item or returns error.
@@ -179,6 +180,27 @@ func Unmarshal(data []byte) (RegistryItem, error) {
 			}
 			fv.Set(reflect.ValueOf(values))
 			continue
+		case stringSlice:
+			// compaction replaces arrays of a single element with the element itself
+			var a any
+			err := json.Unmarshal(v, &a)
+			if err != nil {
+				return nil, err
+			}
+			arr, ok := a.([]any)
+			if !ok {
+				arr = []any{a}
+			}
+			values := make([]string, 0, len(arr))
+			for _, item := range arr {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected a string but received %v instead", item)
+				}
+				values = append(values, s)
+			}
+			fv.Set(reflect.ValueOf(values))
+			continue
 		}
 		switch f.Type.Kind() {
 		case reflect.Interface:
@@ -6,6 +6,7 @@ import (
 	"context"
 
 	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/quad/voc"
 	"github.com/aperturerobotics/cayley/query"
 	"github.com/aperturerobotics/cayley/query/path"
@@ -27,3 +28,9 @@ type PathStep interface {
 	Step
 	BuildPath(ctx context.Context, qs graph.QuadStore, ns *voc.Namespaces) (*path.Path, error)
 }
+
+// Reducer is an item that describes an aggregate calculated for each group of values.
+type Reducer interface {
+	RegistryItem
+	BuildReducer() (iterator.Reducer, error)
+}
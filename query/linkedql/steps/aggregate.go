@@ -0,0 +1,72 @@
+//go:build !tinygo
+
+package steps
+
+import (
+	"context"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/quad/voc"
+	"github.com/aperturerobotics/cayley/query/linkedql"
+	"github.com/aperturerobotics/cayley/query/path"
+)
+
+func init() {
+	linkedql.Register(&Aggregate{})
+	linkedql.Register(&Reducer{})
+}
+
+var _ linkedql.PathStep = (*Aggregate)(nil)
+
+// Aggregate corresponds to .groupBy().aggregate().
+type Aggregate struct {
+	From     linkedql.PathStep  `json:"from"`
+	GroupBy  []string           `json:"groupBy"`
+	Reducers []linkedql.Reducer `json:"reducers"`
+}
+
+// Description implements Step.
+func (s *Aggregate) Description() string {
+	return "groups the resolved values of the from step by values of the groupBy names and calculates the reducers for each group. It resolves to the values of the first groupBy name, or to the first aggregate if groupBy is empty"
+}
+
+// BuildPath implements linkedql.PathStep.
+func (s *Aggregate) BuildPath(ctx context.Context, qs graph.QuadStore, ns *voc.Namespaces) (*path.Path, error) {
+	fromPath, err := s.From.BuildPath(ctx, qs, ns)
+	if err != nil {
+		return nil, err
+	}
+	reducers := make([]iterator.Reducer, 0, len(s.Reducers))
+	for _, r := range s.Reducers {
+		ir, err := r.BuildReducer()
+		if err != nil {
+			return nil, err
+		}
+		reducers = append(reducers, ir)
+	}
+	return fromPath.GroupBy(s.GroupBy...).Aggregate(reducers...), nil
+}
+
+var _ linkedql.Reducer = (*Reducer)(nil)
+
+// Reducer is a single aggregate of the Aggregate step.
+type Reducer struct {
+	Function string `json:"function"`
+	Tag      string `json:"tag"`
+	Name     string `json:"name"`
+}
+
+// Description implements RegistryItem.
+func (s *Reducer) Description() string {
+	return "calculates an aggregate function (count, sum, min, max or avg) over values of the tag, or over the resolved values if the tag is not set, and assigns it to a given name"
+}
+
+// BuildReducer implements linkedql.Reducer.
+func (s *Reducer) BuildReducer() (iterator.Reducer, error) {
+	op, err := iterator.ParseAggregateOp(s.Function)
+	if err != nil {
+		return iterator.Reducer{}, err
+	}
+	return iterator.Reducer{Op: op, Tag: s.Tag, As: s.Name}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 
 	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/quad/voc"
 	"github.com/aperturerobotics/cayley/query/linkedql"
 	"github.com/aperturerobotics/cayley/query/path"
@@ -19,12 +20,14 @@ var _ linkedql.PathStep = (*Order)(nil)
 
 // Order corresponds to .order().
 type Order struct {
-	From linkedql.PathStep `json:"from"`
+	From       linkedql.PathStep `json:"from"`
+	Name       string            `json:"name,omitempty"`
+	Descending bool              `json:"descending,omitempty"`
 }
 
 // Description implements Step.
 func (s *Order) Description() string {
-	return "sorts the results in ascending order according to the current entity / value"
+	return "sorts the results according to the current entity / value, or to the values of the name if it is set. Numbers are sorted numerically, times chronologically and strings by their values. If descending is set, the results are sorted in descending order"
 }
 
 // BuildPath implements linkedql.PathStep.
@@ -33,5 +36,5 @@ func (s *Order) BuildPath(ctx context.Context, qs graph.QuadStore, ns *voc.Names
 	if err != nil {
 		return nil, err
 	}
-	return fromPath.Order(), nil
+	return fromPath.OrderBy(iterator.SortKey{Tag: s.Name, Desc: s.Descending}), nil
 }
@@ -0,0 +1,61 @@
+//go:build !tinygo
+
+package steps
+
+import (
+	"context"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/quad/voc"
+	"github.com/aperturerobotics/cayley/query/linkedql"
+	"github.com/aperturerobotics/cayley/query/path"
+)
+
+func init() {
+	linkedql.Register(&ShortestPath{})
+}
+
+var _ linkedql.PathStep = (*ShortestPath)(nil)
+
+// ShortestPath corresponds to .shortestPath().
+type ShortestPath struct {
+	From       linkedql.PathStep      `json:"from"`
+	To         linkedql.PathStep      `json:"to"`
+	Properties *linkedql.PropertyPath `json:"properties"`
+	Weight     *linkedql.PropertyPath `json:"weight,omitempty"`
+	Limit      int64                  `json:"limit,omitempty"`
+}
+
+// Description implements Step.
+func (s *ShortestPath) Description() string {
+	return "resolves to the nodes of the shortest paths from the current objects to the objects of to, following the given properties. If weight is set, its values are the costs of edges, read from the reified statement or the graph of each edge, otherwise each step costs one. If limit is set, up to limit shortest paths are found for each pair of objects. Each node is tagged with the index of its path (path), its position in the path (step) and the total cost of the path (cost)"
+}
+
+// BuildPath implements linkedql.PathStep.
+func (s *ShortestPath) BuildPath(ctx context.Context, qs graph.QuadStore, ns *voc.Namespaces) (*path.Path, error) {
+	fromPath, err := s.From.BuildPath(ctx, qs, ns)
+	if err != nil {
+		return nil, err
+	}
+	toPath, err := s.To.BuildPath(ctx, qs, ns)
+	if err != nil {
+		return nil, err
+	}
+	viaPath, err := s.Properties.BuildPath(ctx, qs, ns)
+	if err != nil {
+		return nil, err
+	}
+	var weight any
+	if s.Weight != nil {
+		weightPath, err := s.Weight.BuildPath(ctx, qs, ns)
+		if err != nil {
+			return nil, err
+		}
+		weight = path.StartMorphism().Out(weightPath)
+	}
+	k := 1
+	if s.Limit > 0 {
+		k = int(s.Limit)
+	}
+	return fromPath.KShortestPaths(toPath, path.StartMorphism().Out(viaPath), weight, k), nil
+}
@@ -17,10 +17,12 @@ package path
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/aperturerobotics/cayley/graph"
 	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc/xsd"
 	"github.com/aperturerobotics/cayley/query/shape"
 )
 
@@ -337,6 +339,138 @@ func followRecursiveMorphism(p *Path, maxDepth int, depthTags []string) morphism
 	}
 }
 
+// shortestPathMorphism finds shortest paths to the nodes of to by following via. If weight is set, it's followed
+// from quads that link nodes to read costs of edges, see edgeWeight. Quads are limited to preds, if it's set.
+func shortestPathMorphism(to, via *Path, preds shape.Shape, weight *Path, k int) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			return shortestPathMorphism(to, via, preds, weight, k), ctx
+		},
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return iteratorBuilder(func(ctx context.Context, qs graph.QuadStore) iterator.Shape {
+				var w iterator.WeightFunc
+				if weight != nil {
+					var predIt iterator.Shape
+					if preds != nil {
+						predIt = preds.BuildIterator(ctx, qs)
+					}
+					w = edgeWeight(qs, predIt, weight.MorphismFor(qs))
+				}
+				return iterator.NewShortestPath(
+					in.BuildIterator(ctx, qs), to.Shape().BuildIterator(ctx, qs),
+					via.MorphismFor(qs), w, k,
+				)
+			}), ctx
+		},
+		tags: []string{iterator.ShortestPathIndexTag, iterator.ShortestPathStepTag, iterator.ShortestPathCostTag},
+	}
+}
+
+// edgeWeight returns the cost of the cheapest quad from one node to another, with one of preds, if it's set.
+// If there is no such quad, quads in the opposite direction are used, thus paths that follow quads backward,
+// for example with In, are weighted as well. The cost of a quad is read by following a morphism from its
+// reified statement or, if it has none, from its label. Quads without a cost are free.
+func edgeWeight(qs graph.QuadStore, preds iterator.Shape, m iterator.Morphism) iterator.WeightFunc {
+	return func(ctx context.Context, from, to graph.Ref) (float64, error) {
+		cost, found, err := cheapestQuad(ctx, qs, preds, m, from, to)
+		if err != nil || found {
+			return cost, err
+		}
+		cost, _, err = cheapestQuad(ctx, qs, preds, m, to, from)
+		return cost, err
+	}
+}
+
+// cheapestQuad returns the lowest cost of quads with a given subject and object. It returns false if there are no quads.
+func cheapestQuad(ctx context.Context, qs graph.QuadStore, preds iterator.Shape, m iterator.Morphism, sub, obj graph.Ref) (float64, bool, error) {
+	its := []iterator.Shape{
+		qs.QuadIterator(ctx, quad.Subject, sub),
+		qs.QuadIterator(ctx, quad.Object, obj),
+	}
+	if preds != nil {
+		its = append(its, graph.NewLinksTo(qs, preds, quad.Predicate))
+	}
+	sc := iterator.NewAnd(its...).Iterate(ctx)
+	defer sc.Close()
+	var (
+		cost  float64
+		found bool
+	)
+	for sc.Next(ctx) {
+		ref, err := sc.Result(ctx)
+		if err != nil {
+			return 0, false, err
+		}
+		w, err := quadWeight(ctx, qs, m, ref)
+		if err != nil {
+			return 0, false, err
+		}
+		if !found || w < cost {
+			cost, found = w, true
+		}
+	}
+	return cost, found, sc.Err()
+}
+
+// quadWeight reads the cost of a quad from its reified statement or its label.
+func quadWeight(ctx context.Context, qs graph.QuadStore, m iterator.Morphism, ref graph.Ref) (float64, error) {
+	q, err := qs.Quad(ctx, ref)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := qs.ValueOf(ctx, quad.Quote(q))
+	if err != nil {
+		return 0, err
+	}
+	if stmt != nil {
+		if w, ok, err := readWeight(ctx, qs, m, stmt); err != nil || ok {
+			return w, err
+		}
+	}
+	label, err := qs.QuadDirection(ctx, ref, quad.Label)
+	if err != nil || label == nil {
+		return 0, err
+	}
+	w, _, err := readWeight(ctx, qs, m, label)
+	return w, err
+}
+
+var xsdDecimal = quad.IRI(xsd.Prefix + "decimal").Full()
+
+// readWeight reads a numeric weight by following a morphism from a node. It returns false if there is no weight.
+func readWeight(ctx context.Context, qs graph.QuadStore, m iterator.Morphism, node graph.Ref) (float64, bool, error) {
+	sc := m(ctx, iterator.NewFixed(node)).Iterate(ctx)
+	defer sc.Close()
+	if !sc.Next(ctx) {
+		return 0, false, sc.Err()
+	}
+	ref, err := sc.Result(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	v, err := qs.NameOf(ctx, ref)
+	if err != nil {
+		return 0, false, err
+	}
+	if ts, ok := v.(quad.TypedString); ok {
+		if ts.Type.Full() == xsdDecimal {
+			// decimals have no conversion registered in quad, since floats can't represent them exactly
+			if f, err := strconv.ParseFloat(string(ts.Value), 64); err == nil {
+				v = quad.Float(f)
+			}
+		} else if pv, err := ts.ParseValue(); err == nil {
+			v = pv
+		}
+	}
+	switch v := v.(type) {
+	case quad.Int:
+		return float64(v), true, nil
+	case quad.Float:
+		return float64(v), true, nil
+	}
+	return 0, false, fmt.Errorf("weight is not a number: %v", v)
+}
+
 // exceptMorphism removes all results on p.(*Path) from the current iterators.
 func exceptMorphism(p *Path) morphism {
 	return morphism{
@@ -357,6 +491,26 @@ func uniqueMorphism() morphism {
 	}
 }
 
+// unquoteMorphism enters quoted triples, moving to their components in a given direction.
+func unquoteMorphism(dir quad.Direction) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return quoteMorphism(dir), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.Unquote{From: in, Dir: dir}, ctx
+		},
+	}
+}
+
+// quoteMorphism exits quoted triples, moving from components in a given direction to quoted triples.
+func quoteMorphism(dir quad.Direction) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return unquoteMorphism(dir), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.Quote{From: in, Dir: dir}, ctx
+		},
+	}
+}
+
 func saveMorphism(via any, tag string) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return saveMorphism(via, tag), ctx },
@@ -439,11 +593,11 @@ func skipMorphism(v int64) morphism {
 	}
 }
 
-func orderMorphism() morphism {
+func orderMorphism(keys ...iterator.SortKey) morphism {
 	return morphism{
-		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return orderMorphism(), ctx },
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return orderMorphism(keys...), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.Sort{From: in}, ctx
+			return shape.Sort{From: in, By: keys}, ctx
 		},
 	}
 }
@@ -472,3 +626,13 @@ func countMorphism() morphism {
 		},
 	}
 }
+
+// aggregateMorphism will group values by tags and reduce each group.
+func aggregateMorphism(groupBy []string, reducers []iterator.Reducer) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return aggregateMorphism(groupBy, reducers), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.Aggregate{From: in, GroupBy: groupBy, Reducers: reducers}, ctx
+		},
+	}
+}
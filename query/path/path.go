@@ -363,6 +363,22 @@ func (p *Path) Unique() *Path {
 	return np
 }
 
+// Unquote updates the current Path to represent components of quoted triples in a given direction.
+// Nodes that are not quoted triples are skipped.
+func (p *Path) Unquote(dir quad.Direction) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, unquoteMorphism(dir))
+	return np
+}
+
+// Quote updates the current Path to represent quoted triples with one of current nodes
+// as a component in a given direction. It is the reverse of Unquote.
+func (p *Path) Quote(dir quad.Direction) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, quoteMorphism(dir))
+	return np
+}
+
 // Follow allows you to stitch two paths together. The resulting path will start
 // from where the first path left off and continue iterating down the path given.
 func (p *Path) Follow(path *Path) *Path {
@@ -413,6 +429,55 @@ func (p *Path) FollowRecursive(via any, maxDepth int, depthTags []string) *Path
 	return np
 }
 
+// ShortestPath finds the shortest path from each of the current nodes to each node of the to path,
+// by following the given string predicate or Path object.
+//
+// If weight is nil, each step costs one. Otherwise, weight is a predicate or a Path object that resolves
+// to a numeric cost of an edge, and each step costs the cheapest of the edges it follows. Edges are quads
+// from a node to its neighbour, with the via predicate, or with any predicate if via is a Path object.
+// The cost of a quad is read from its reified statement (a quoted triple), or, if there is none, from its label.
+// Edges without a cost are free.
+//
+// Each node of each path is returned as a separate result, in order from the source to the target,
+// and tagged with the index of the path ("path"), the position of the node in the path ("step")
+// and the total cost of the path ("cost").
+func (p *Path) ShortestPath(to *Path, via, weight any) *Path {
+	return p.KShortestPaths(to, via, weight, 1)
+}
+
+// KShortestPaths is the same as ShortestPath, but returns up to k shortest paths without loops
+// for each pair of nodes, in order of their cost.
+func (p *Path) KShortestPaths(to *Path, via, weight any, k int) *Path {
+	var preds shape.Shape
+	switch via.(type) {
+	case string, quad.Value:
+		preds = buildVia(via)
+	}
+	np := p.clone()
+	np.stack = append(p.stack, shortestPathMorphism(to, toMorphism(via, "ShortestPath"), preds, toWeightMorphism(weight), k))
+	return np
+}
+
+// toMorphism converts a string predicate or a Path object to a morphism path.
+func toMorphism(via any, fnc string) *Path {
+	switch v := via.(type) {
+	case string:
+		return StartMorphism().Out(v)
+	case quad.Value:
+		return StartMorphism().Out(v)
+	case *Path:
+		return v
+	}
+	panic("did not pass a string predicate or a Path to " + fnc)
+}
+
+func toWeightMorphism(weight any) *Path {
+	if weight == nil {
+		return nil
+	}
+	return toMorphism(weight, "ShortestPath")
+}
+
 // Save will, from the current nodes in the path, retrieve the node
 // one linkage away (given by either a path or a predicate), add the given
 // tag, and propagate that to the result set.
@@ -556,11 +621,20 @@ func (p *Path) Skip(v int64) *Path {
 	return p
 }
 
+// Order sorts results in ascending order.
 func (p *Path) Order() *Path {
 	p.stack = append(p.stack, orderMorphism())
 	return p
 }
 
+// OrderBy sorts results by given keys. Keys may refer to tags saved earlier in the path.
+//
+// If any of the keys refers to a tag, each path is returned as a separate result.
+func (p *Path) OrderBy(keys ...iterator.SortKey) *Path {
+	p.stack = append(p.stack, orderMorphism(keys...))
+	return p
+}
+
 // Limit will limit a number of values in result set.
 func (p *Path) Limit(v int64) *Path {
 	p.stack = append(p.stack, limitMorphism(v))
@@ -573,11 +647,43 @@ func (p *Path) Count() *Path {
 	return p
 }
 
+// Grouping is a path with a list of tags to group results by. Call Aggregate to finish the grouping.
+type Grouping struct {
+	p    *Path
+	tags []string
+}
+
+// GroupBy starts a grouping of paths by values of given tags. Without tags all paths form a single group.
+func (p *Path) GroupBy(tags ...string) *Grouping {
+	return &Grouping{p: p, tags: tags}
+}
+
+// Aggregate calculates reducers for each group. Result set of the path contains one value per group:
+// a value of the first group-by tag, or the first aggregate if there are no group-by tags.
+// Both group-by tags and aggregates are saved as tags of results.
+func (g *Grouping) Aggregate(reducers ...iterator.Reducer) *Path {
+	g.p.stack = append(g.p.stack, aggregateMorphism(g.tags, reducers))
+	return g.p
+}
+
 // Iterate is an shortcut for graph.Iterate.
 func (p *Path) Iterate(ctx context.Context) *iterator.Chain {
 	return shape.Iterate(ctx, p.qs, p.Shape())
 }
 
+// Cursor is a resumable form of Iterate. If state is set, the iteration continues after the position
+// saved with Cursor.State; iterator.ErrStaleCursor is returned if the results have changed since then.
+//
+// Paths that end with Order or OrderBy are resumed without going through the results before the position.
+// Other paths skip those results, up to iterator.MaxCursorSkip of them.
+func (p *Path) Cursor(ctx context.Context, state []byte) (*iterator.Cursor, error) {
+	it := shape.BuildIterator(ctx, p.qs, p.Shape())
+	if state == nil {
+		return iterator.NewCursor(it, p.qs), nil
+	}
+	return iterator.ResumeCursor(ctx, it, p.qs, state)
+}
+
 func (p *Path) Shape() shape.Shape {
 	return p.ShapeFrom(shape.AllNodes{})
 }
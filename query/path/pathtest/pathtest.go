@@ -18,6 +18,7 @@ import (
 	"context"
 	"reflect"
 	"regexp"
+	"slices"
 	"sort"
 	"testing"
 	"time"
@@ -26,6 +27,7 @@ import (
 	"github.com/aperturerobotics/cayley/graph/graphtest/testutil"
 	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc/xsd"
 	"github.com/aperturerobotics/cayley/query/path"
 	"github.com/aperturerobotics/cayley/query/shape"
 	_ "github.com/aperturerobotics/cayley/writer"
@@ -344,6 +346,19 @@ func testSet(qs graph.QuadStore) []test {
 			path:    path.StartPath(qs).Has(vStatus).Count(),
 			expect:  []quad.Value{quad.Int(5)},
 		},
+		{
+			message: "Aggregate without groups",
+			path:    path.StartPath(qs).Has(vStatus).GroupBy().Aggregate(iterator.Reducer{Op: iterator.AggregateCount, As: "n"}),
+			expect:  []quad.Value{quad.Int(5)},
+		},
+		{
+			message: "GroupBy and count",
+			path: path.StartPath(qs).Tag("who").Out(vFollows).GroupBy("who").Aggregate(
+				iterator.Reducer{Op: iterator.AggregateCount, As: "n"},
+			),
+			tag:    "n",
+			expect: []quad.Value{quad.Int(1), quad.Int(1), quad.Int(1), quad.Int(1), quad.Int(2), quad.Int(2)},
+		},
 		{
 			message: "double Has",
 			path:    path.StartPath(qs).Has(vStatus, vCool).Has(vFollows, vFred),
@@ -529,21 +544,32 @@ func RunTestMorphisms(t *testing.T, fnc testutil.DatabaseFunc) {
 	for _, ftest := range []func(*testing.T, testutil.DatabaseFunc){
 		testFollowRecursive,
 		testFollowRecursiveHas,
+		testAggregate,
+		testOrderBy,
+		testShortestPath,
+		testCursor,
+		testQuoted,
 	} {
 		ftest(t, fnc)
 	}
 	qs, closer := makeTestStore(t, fnc)
 	defer closer()
 
-	ctx := context.Background()
 	for _, test := range testSet(qs) {
-		for _, opt := range []bool{true, false} {
-			name := test.message
-			if !opt {
-				name += " (unoptimized)"
-			}
+		for _, mode := range []struct {
+			suffix   string
+			opt      bool
+			parallel int
+		}{
+			{suffix: "", opt: true},
+			{suffix: " (unoptimized)", opt: false},
+			{suffix: " (parallel)", opt: true, parallel: 4},
+		} {
+			name := test.message + mode.suffix
+			opt := mode.opt
+			ctx := iterator.WithParallel(context.Background(), mode.parallel)
 			t.Run(name, func(t *testing.T) {
-				if test.skip {
+				if test.skip || (mode.parallel > 0 && test.unsorted) {
 					t.SkipNow()
 				}
 				var (
@@ -708,3 +734,348 @@ func testFollowRecursiveHas(t *testing.T, fnc testutil.DatabaseFunc) {
 		})
 	}
 }
+
+func testAggregate(t *testing.T, fnc testutil.DatabaseFunc) {
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	var (
+		device = quad.IRI("device")
+		value  = quad.IRI("value")
+		at     = quad.IRI("at")
+	)
+	qs, closer := makeTestStore(t, fnc, []quad.Quad{
+		quad.Make(quad.IRI("r1"), device, quad.IRI("d1"), nil),
+		quad.Make(quad.IRI("r1"), value, quad.Int(3), nil),
+		quad.Make(quad.IRI("r1"), at, quad.Time(t1), nil),
+		quad.Make(quad.IRI("r2"), device, quad.IRI("d1"), nil),
+		quad.Make(quad.IRI("r2"), value, quad.Float(1.5), nil),
+		quad.Make(quad.IRI("r2"), at, quad.Time(t2), nil),
+		quad.Make(quad.IRI("r3"), device, quad.IRI("d2"), nil),
+		quad.Make(quad.IRI("r3"), value, quad.Int(7), nil),
+		quad.Make(quad.IRI("r3"), at, quad.Time(t1), nil),
+	}...)
+	defer closer()
+
+	qu := path.StartPath(qs).Save(device, "dev").Save(value, "val").Save(at, "ts").
+		GroupBy("dev").Aggregate(
+		iterator.Reducer{Op: iterator.AggregateCount, As: "n"},
+		iterator.Reducer{Op: iterator.AggregateSum, Tag: "val", As: "sum"},
+		iterator.Reducer{Op: iterator.AggregateMin, Tag: "val", As: "min"},
+		iterator.Reducer{Op: iterator.AggregateAvg, Tag: "val", As: "avg"},
+		iterator.Reducer{Op: iterator.AggregateMax, Tag: "ts", As: "last"},
+	)
+
+	expect := []map[string]quad.Value{
+		{"dev": quad.IRI("d1"), "n": quad.Int(2), "sum": quad.Float(4.5), "min": quad.Float(1.5), "avg": quad.Float(2.25), "last": quad.Time(t2)},
+		{"dev": quad.IRI("d2"), "n": quad.Int(1), "sum": quad.Int(7), "min": quad.Int(7), "avg": quad.Float(7), "last": quad.Time(t1)},
+	}
+	sortTags := []string{"dev"}
+
+	const msg = "aggregate by device"
+
+	ctx := context.Background()
+	for _, opt := range []bool{true, false} {
+		unopt := ""
+		if !opt {
+			unopt = " (unoptimized)"
+		}
+		t.Run(msg+unopt, func(t *testing.T) {
+			got, err := runAllTags(ctx, qs, qu, opt)
+			if err != nil {
+				t.Errorf("Failed to check %s%s: %v", msg, unopt, err)
+				return
+			}
+			sort.Sort(byTags{
+				tags: sortTags,
+				arr:  got,
+			})
+			for _, m := range got {
+				if ts, ok := m["last"].(quad.Time); ok {
+					m["last"] = quad.Time(time.Time(ts).UTC())
+				}
+			}
+			require.Equal(t, expect, got)
+		})
+	}
+}
+
+func testQuoted(t *testing.T, fnc testutil.DatabaseFunc) {
+	var (
+		source = quad.IRI("source")
+		doubts = quad.IRI("doubts")
+		name   = quad.IRI("name")
+		bobAge = quad.Quoted{Subject: vBob, Predicate: quad.IRI("age"), Object: quad.Int(23)}
+		aliAge = quad.Quoted{Subject: vAlice, Predicate: quad.IRI("age"), Object: quad.Int(30)}
+	)
+	qs, closer := makeTestStore(t, fnc, []quad.Quad{
+		quad.Make(bobAge, source, quad.IRI("census"), nil),
+		quad.Make(aliAge, source, quad.IRI("survey"), nil),
+		quad.Make(vCharlie, doubts, bobAge, nil),
+		quad.Make(vBob, name, quad.String("Bob"), nil),
+	}...)
+	defer closer()
+
+	for _, c := range []struct {
+		msg    string
+		path   *path.Path
+		expect []quad.Value
+	}{
+		{
+			msg:    "unquote stored node",
+			path:   path.StartPath(qs, quad.IRI("census")).In(source).Unquote(quad.Subject).Out(name),
+			expect: []quad.Value{quad.String("Bob")},
+		},
+		{
+			msg:    "unquote value",
+			path:   path.StartPath(qs, vCharlie).Out(doubts).Unquote(quad.Object),
+			expect: []quad.Value{quad.Int(23)},
+		},
+		{
+			msg:    "quote",
+			path:   path.StartPath(qs, vBob).Quote(quad.Subject).Out(source),
+			expect: []quad.Value{quad.IRI("census")},
+		},
+		{
+			msg:    "unquote and quote",
+			path:   path.StartPath(qs).Has(source).Unquote(quad.Subject).Quote(quad.Subject),
+			expect: []quad.Value{aliAge, bobAge},
+		},
+		{
+			msg:    "reverse unquote",
+			path:   path.StartPath(qs, vBob).FollowReverse(path.StartMorphism().Unquote(quad.Subject)).Out(source),
+			expect: []quad.Value{quad.IRI("census")},
+		},
+		{
+			msg:    "intersect with quote",
+			path:   path.StartPath(qs, bobAge, aliAge).And(path.StartPath(qs, vBob).Quote(quad.Subject)),
+			expect: []quad.Value{bobAge},
+		},
+		{
+			msg:    "intersect with unquote",
+			path:   path.StartPath(qs, vBob, vCharlie).And(path.StartPath(qs).Has(source).Unquote(quad.Subject)),
+			expect: []quad.Value{vBob},
+		},
+	} {
+		for _, opt := range []bool{true, false} {
+			unopt := ""
+			if !opt {
+				unopt = " (unoptimized)"
+			}
+			t.Run(c.msg+unopt, func(t *testing.T) {
+				got, err := runTopLevel(context.Background(), qs, c.path, opt)
+				require.NoError(t, err)
+				sort.Sort(quad.ByValueString(got))
+				sort.Sort(quad.ByValueString(c.expect))
+				require.Equal(t, c.expect, got)
+			})
+		}
+	}
+}
+
+func testOrderBy(t *testing.T, fnc testutil.DatabaseFunc) {
+	value := quad.IRI("value")
+	qs, closer := makeTestStore(t, fnc, []quad.Quad{
+		quad.Make(quad.IRI("r1"), value, quad.Int(10), nil),
+		quad.Make(quad.IRI("r2"), value, quad.Int(9), nil),
+		quad.Make(quad.IRI("r3"), value, quad.Float(1.5), nil),
+		quad.Make(quad.IRI("r4"), value, quad.Int(9), nil),
+	}...)
+	defer closer()
+
+	for _, c := range []struct {
+		msg    string
+		keys   []iterator.SortKey
+		expect []map[string]quad.Value
+	}{
+		{
+			msg:  "order by a numeric tag",
+			keys: []iterator.SortKey{{Tag: "val"}, {Tag: "r"}},
+			expect: []map[string]quad.Value{
+				{"r": quad.IRI("r3"), "val": quad.Float(1.5)},
+				{"r": quad.IRI("r2"), "val": quad.Int(9)},
+				{"r": quad.IRI("r4"), "val": quad.Int(9)},
+				{"r": quad.IRI("r1"), "val": quad.Int(10)},
+			},
+		},
+		{
+			msg:  "order by a numeric tag descending",
+			keys: []iterator.SortKey{{Tag: "val", Desc: true}, {Tag: "r", Desc: true}},
+			expect: []map[string]quad.Value{
+				{"r": quad.IRI("r1"), "val": quad.Int(10)},
+				{"r": quad.IRI("r4"), "val": quad.Int(9)},
+				{"r": quad.IRI("r2"), "val": quad.Int(9)},
+				{"r": quad.IRI("r3"), "val": quad.Float(1.5)},
+			},
+		},
+	} {
+		qu := path.StartPath(qs).Tag("r").Save(value, "val").OrderBy(c.keys...)
+		ctx := context.Background()
+		for _, opt := range []bool{true, false} {
+			unopt := ""
+			if !opt {
+				unopt = " (unoptimized)"
+			}
+			t.Run(c.msg+unopt, func(t *testing.T) {
+				got, err := runAllTags(ctx, qs, qu, opt)
+				require.NoError(t, err)
+				require.Equal(t, c.expect, got)
+			})
+		}
+	}
+}
+
+func testShortestPath(t *testing.T, fnc testutil.DatabaseFunc) {
+	link, cost := quad.IRI("link"), quad.IRI("cost")
+	edge := func(from, to string, label quad.Value) quad.Quad {
+		return quad.Make(quad.IRI(from), link, quad.IRI(to), label)
+	}
+	// costs of edges are set on their reified statements or on their labels;
+	// r3 reaches r4 through a free edge to y, so paths via r2 and r3 differ in length
+	quads := []quad.Quad{
+		edge("r1", "r2", nil), quad.Make(quad.Quote(edge("r1", "r2", nil)), cost, quad.Int(1), nil),
+		edge("r1", "r3", nil), quad.Make(quad.Quote(edge("r1", "r3", nil)), cost, quad.Int(5), nil),
+		edge("r1", "r4", nil), quad.Make(quad.Quote(edge("r1", "r4", nil)), cost, quad.Int(10), nil),
+		edge("r2", "r4", quad.IRI("fast")),
+		quad.Make(quad.IRI("fast"), cost, quad.TypedString{Value: "0.5", Type: xsd.Prefix + "decimal"}, nil),
+		// a parallel edge with another predicate: only the cheapest of the followed edges is used
+		quad.Make(quad.IRI("r2"), quad.IRI("other"), quad.IRI("r4"), nil),
+		quad.Make(quad.Quoted{Subject: quad.IRI("r2"), Predicate: quad.IRI("other"), Object: quad.IRI("r4")}, cost, quad.Int(7), nil),
+		edge("r3", "y", nil),
+		edge("y", "r4", quad.IRI("fast")),
+	}
+	qs, closer := makeTestStore(t, fnc, quads...)
+	defer closer()
+
+	row := func(path, step int, cost quad.Value, node string) map[string]quad.Value {
+		return map[string]quad.Value{
+			"path": quad.Int(path), "step": quad.Int(step), "cost": cost, "node": quad.IRI(node),
+		}
+	}
+	rows := func(path int, cost quad.Value, nodes ...string) []map[string]quad.Value {
+		var out []map[string]quad.Value
+		for i, n := range nodes {
+			out = append(out, row(path, i, cost, n))
+		}
+		return out
+	}
+	from, to := path.StartPath(qs, quad.IRI("r1")), path.StartPath(qs, quad.IRI("r4"))
+	for _, c := range []struct {
+		msg    string
+		path   *path.Path
+		expect []map[string]quad.Value
+	}{
+		{
+			msg:    "unweighted",
+			path:   from.ShortestPath(to, link, nil),
+			expect: rows(0, quad.Int(1), "r1", "r4"),
+		},
+		{
+			msg:    "weighted",
+			path:   from.ShortestPath(to, link, cost),
+			expect: rows(0, quad.Float(1.5), "r1", "r2", "r4"),
+		},
+		{
+			msg:  "k shortest",
+			path: from.KShortestPaths(to, link, cost, 4),
+			expect: slices.Concat(
+				rows(0, quad.Float(1.5), "r1", "r2", "r4"),
+				rows(1, quad.Float(5.5), "r1", "r3", "y", "r4"),
+				rows(2, quad.Float(10), "r1", "r4"),
+			),
+		},
+		{
+			msg:  "k shortest unweighted",
+			path: from.KShortestPaths(to, link, nil, 2),
+			expect: slices.Concat(
+				rows(0, quad.Int(1), "r1", "r4"),
+				rows(1, quad.Int(2), "r1", "r2", "r4"),
+			),
+		},
+		{
+			msg:    "weighted via path",
+			path:   from.ShortestPath(to, path.StartMorphism().Out(link), cost),
+			expect: rows(0, quad.Float(1.5), "r1", "r2", "r4"),
+		},
+		{
+			msg:    "weighted reverse",
+			path:   to.ShortestPath(from, path.StartMorphism().In(link), cost),
+			expect: rows(0, quad.Float(1.5), "r4", "r2", "r1"),
+		},
+		{
+			msg:    "unreachable",
+			path:   to.ShortestPath(from, link, nil),
+			expect: nil,
+		},
+	} {
+		qu := c.path.Tag("node")
+		ctx := context.Background()
+		for _, opt := range []bool{true, false} {
+			unopt := ""
+			if !opt {
+				unopt = " (unoptimized)"
+			}
+			t.Run(c.msg+unopt, func(t *testing.T) {
+				got, err := runAllTags(ctx, qs, qu, opt)
+				require.NoError(t, err)
+				require.Equal(t, c.expect, got)
+			})
+		}
+	}
+}
+
+func testCursor(t *testing.T, fnc testutil.DatabaseFunc) {
+	qs, closer := makeTestStore(t, fnc)
+	defer closer()
+
+	ctx := context.Background()
+	page := func(c *iterator.Cursor, n int) []quad.Value {
+		var out []quad.Value
+		for len(out) < n && c.Next(ctx) {
+			v, err := qs.NameOf(ctx, c.Result())
+			require.NoError(t, err)
+			out = append(out, v)
+		}
+		require.NoError(t, c.Err())
+		return out
+	}
+	for _, c := range []struct {
+		msg  string
+		path *path.Path
+	}{
+		{msg: "unordered", path: path.StartPath(qs).Out(vFollows)},
+		{msg: "ordered", path: path.StartPath(qs).Out(vFollows).Order()},
+		{msg: "ordered by tag", path: path.StartPath(qs).Tag("src").Out(vFollows).OrderBy(
+			iterator.SortKey{Tag: "src", Desc: true}, iterator.SortKey{},
+		)},
+	} {
+		t.Run(c.msg, func(t *testing.T) {
+			var expect []quad.Value
+			all := iterator.NewCursor(c.path.BuildIterator(ctx), qs)
+			for {
+				vals := page(all, 100)
+				expect = append(expect, vals...)
+				if len(vals) < 100 {
+					break
+				}
+			}
+			all.Close()
+			require.NotEmpty(t, expect)
+
+			var got []quad.Value
+			var state []byte
+			for {
+				cur, err := c.path.Cursor(ctx, state)
+				require.NoError(t, err)
+				vals := page(cur, 3)
+				got = append(got, vals...)
+				state, err = cur.State(ctx)
+				require.NoError(t, err)
+				cur.Close()
+				if len(vals) < 3 {
+					break
+				}
+			}
+			require.Equal(t, expect, got)
+		})
+	}
+}
@@ -67,6 +67,12 @@ const (
 type Options struct {
 	Limit     int
 	Collation Collation
+
+	// Explain makes Execute return a single Explanation of the query instead of its results.
+	// Sessions don't handle it directly, see Explain.
+	Explain bool
+	// Analyze executes the query when it's explained, and adds statistics of the execution to the explanation.
+	Analyze bool
 }
 
 type Session interface {
@@ -137,5 +143,12 @@ func Execute(ctx context.Context, qs graph.QuadStore, lang, query string, opt Op
 		return nil, fmt.Errorf("unsupported language: %q", lang)
 	}
 	sess := l.Session(qs)
+	if opt.Explain {
+		exp, err := Explain(ctx, sess, query, opt)
+		if err != nil {
+			return nil, err
+		}
+		return &explainIterator{exp: exp, coll: opt.Collation}, nil
+	}
 	return sess.Execute(ctx, query, opt)
 }
@@ -0,0 +1,55 @@
+package shape
+
+import (
+	"context"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+)
+
+// ResultCache is an optional interface for quad store wrappers that cache results of queries.
+type ResultCache interface {
+	graph.Wrapper
+	// CachedIterator returns an iterator for results of a shape with a given key.
+	// Build is called to construct an iterator on the underlying quad store if results are not cached.
+	CachedIterator(ctx context.Context, key string, build func() iterator.Shape) iterator.Shape
+}
+
+// resultCacheOf finds a result cache in a chain of quad store wrappers.
+func resultCacheOf(qs graph.QuadStore) ResultCache {
+	for {
+		switch w := qs.(type) {
+		case ResultCache:
+			return w
+		case *graph.Handle:
+			qs = w.QuadStore
+		case graph.Wrapper:
+			qs = w.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// buildCached builds an iterator that may read results of the shape from the cache.
+//
+// The cache key is a serialized shape after generic optimizations, thus equivalent queries share results.
+// Optimizations based on statistics are applied later and don't affect the key.
+func buildCached(ctx context.Context, c ResultCache, s Shape) iterator.Shape {
+	qs := graph.UnwrapAll(c)
+	optim, _, err := optimizeGeneric(ctx, s, qs)
+	if err != nil {
+		return BuildIterator(ctx, qs, s)
+	} else if IsNull(optim) {
+		return iterator.NewNull()
+	}
+	s = optim
+	key, err := MarshalJSON(ctx, s, qs)
+	if err != nil {
+		// shapes defined outside of this package may not be serializable
+		return BuildIterator(ctx, qs, s)
+	}
+	return c.CachedIterator(ctx, string(key), func() iterator.Shape {
+		return BuildIterator(ctx, qs, s)
+	})
+}
@@ -0,0 +1,161 @@
+package shape
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+)
+
+// Plan describes how a single shape tree was executed.
+type Plan struct {
+	// Shape is the shape tree before optimization.
+	Shape any `json:"shape"`
+	// Optimized is the shape tree after Optimize.
+	Optimized any `json:"optimized"`
+	// Iterator is the final iterator tree with its estimated costs.
+	Iterator iterator.Plan `json:"iterator"`
+}
+
+// Explainer records plans of all shape trees built with BuildIterator.
+//
+// Without analyze, iterators built by BuildIterator return no results, thus the query is not executed.
+// With analyze, the query is executed as usual and statistics of execution are recorded for each iterator.
+type Explainer struct {
+	analyze bool
+
+	mu    sync.Mutex
+	plans []*explainEntry
+}
+
+type explainEntry struct {
+	qs        graph.QuadStore
+	profile   *iterator.Profile // set with analyze
+	shape     Shape
+	optimized Shape
+	it        iterator.Shape
+	itOpt     bool // iterator tree was optimized
+}
+
+// NewExplainer creates a new explainer. If analyze is set, queries are executed and profiled.
+func NewExplainer(analyze bool) *Explainer {
+	return &Explainer{analyze: analyze}
+}
+
+type explainerKey struct{}
+
+// WithExplainer returns a context that makes BuildIterator record plans to a given explainer.
+func WithExplainer(ctx context.Context, e *Explainer) context.Context {
+	return context.WithValue(ctx, explainerKey{}, e)
+}
+
+// ExplainerOf returns an explainer associated with the context, or nil if it's not set.
+func ExplainerOf(ctx context.Context) *Explainer {
+	e, _ := ctx.Value(explainerKey{}).(*Explainer)
+	return e
+}
+
+func (e *Explainer) record(qs graph.QuadStore, s, optimized Shape, it iterator.Shape) iterator.Shape {
+	p := &explainEntry{qs: qs, shape: s, optimized: optimized, it: it}
+	if e.analyze {
+		// each tree is profiled separately, see iterator.NewPlan
+		p.profile = iterator.NewProfile()
+	}
+	e.mu.Lock()
+	e.plans = append(e.plans, p)
+	e.mu.Unlock()
+	return &explainedIterator{e: e, p: p, it: it}
+}
+
+// Plans returns plans of all shape trees built so far, in order.
+func (e *Explainer) Plans(ctx context.Context) []Plan {
+	e.mu.Lock()
+	entries := append([]*explainEntry{}, e.plans...)
+	e.mu.Unlock()
+	out := make([]Plan, 0, len(entries))
+	for _, p := range entries {
+		e.mu.Lock()
+		it, itOpt := p.it, p.itOpt
+		e.mu.Unlock()
+		if !itOpt {
+			// the tree was not executed, but it would be optimized before the execution
+			if optim, ok, err := it.Optimize(ctx); err == nil && ok {
+				it = optim
+			}
+		}
+		out = append(out, Plan{
+			Shape:     explainShape(ctx, p.shape, p.qs),
+			Optimized: explainShape(ctx, p.optimized, p.qs),
+			Iterator:  iterator.NewPlan(ctx, it, p.profile),
+		})
+	}
+	return out
+}
+
+// explainShape returns a JSON representation of the shape tree, or a Go syntax representation
+// if the tree cannot be serialized.
+func explainShape(ctx context.Context, s Shape, qs refs.Namer) any {
+	if qs != nil {
+		if data, err := MarshalJSON(ctx, s, qs); err == nil {
+			return json.RawMessage(data)
+		}
+	}
+	return fmt.Sprintf("%#v", s)
+}
+
+var _ iterator.Shape = (*explainedIterator)(nil)
+
+// explainedIterator is the root of an iterator tree recorded by the explainer.
+// It tracks optimizations of the tree, and either profiles the execution or prevents it.
+type explainedIterator struct {
+	e  *Explainer
+	p  *explainEntry
+	it iterator.Shape
+}
+
+func (it *explainedIterator) String() string {
+	return it.it.String()
+}
+
+func (it *explainedIterator) Iterate(ctx context.Context) iterator.Scanner {
+	if it.p.profile == nil {
+		return iterator.NewNull().Iterate(ctx)
+	}
+	return iterator.Scan(iterator.WithProfile(ctx, it.p.profile), it.it)
+}
+
+func (it *explainedIterator) Lookup(ctx context.Context) iterator.Index {
+	if it.p.profile == nil {
+		return iterator.NewNull().Lookup(ctx)
+	}
+	return iterator.Lookup(iterator.WithProfile(ctx, it.p.profile), it.it)
+}
+
+func (it *explainedIterator) Stats(ctx context.Context) (iterator.Costs, error) {
+	return it.it.Stats(ctx)
+}
+
+func (it *explainedIterator) Optimize(ctx context.Context) (iterator.Shape, bool, error) {
+	optim, ok, err := it.it.Optimize(ctx)
+	if err != nil {
+		return it, false, err
+	}
+	it.e.mu.Lock()
+	it.p.itOpt = true
+	if ok {
+		it.p.it = optim
+	}
+	it.e.mu.Unlock()
+	if !ok {
+		return it, false, nil
+	}
+	return &explainedIterator{e: it.e, p: it.p, it: optim}, true, nil
+}
+
+func (it *explainedIterator) SubIterators() []iterator.Shape {
+	return []iterator.Shape{it.it}
+}
@@ -0,0 +1,634 @@
+package shape
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/pquads"
+)
+
+// ErrNotSerializable is returned when a shape tree contains a shape or a value filter
+// that has no serialized representation.
+var ErrNotSerializable = errors.New("shape cannot be serialized")
+
+// JSONMarshaler is an optional interface for shapes defined outside of this package
+// that can serialize themselves into a form accepted by UnmarshalJSON.
+type JSONMarshaler interface {
+	MarshalShapeJSON(ctx context.Context, qs refs.Namer) ([]byte, error)
+}
+
+// Shape type names used in the serialized form.
+const (
+	jsonNull         = "null"
+	jsonAllNodes     = "all_nodes"
+	jsonExcept       = "except"
+	jsonFilter       = "filter"
+	jsonCount        = "count"
+	jsonAggregate    = "aggregate"
+	jsonQuads        = "quads"
+	jsonNodesFrom    = "nodes_from"
+	jsonQuadsAction  = "quads_action"
+	jsonFixed        = "fixed"
+	jsonFixedTags    = "fixed_tags"
+	jsonLookup       = "lookup"
+	jsonMaterialize  = "materialize"
+	jsonIntersect    = "intersect"
+	jsonIntersectOpt = "intersect_opt"
+	jsonUnion        = "union"
+	jsonPage         = "page"
+	jsonUnique       = "unique"
+	jsonSave         = "save"
+	jsonSort         = "sort"
+	jsonUnquote      = "unquote"
+	jsonQuote        = "quote"
+)
+
+// Value filter type names used in the serialized form.
+const (
+	jsonComparison = "cmp"
+	jsonRegexp     = "regexp"
+	jsonWildcard   = "wildcard"
+)
+
+// jsonShape is a serialized form of a single node of the shape tree.
+// Values are stored in protobuf encoding to preserve their types.
+type jsonShape struct {
+	Type string `json:"type"`
+
+	Values [][]byte          `json:"values,omitempty"`
+	Tags   []string          `json:"tags,omitempty"`
+	Fixed  map[string][]byte `json:"fixed,omitempty"`
+
+	Dir     quad.Direction      `json:"dir,omitempty"`
+	Save    map[string][]string `json:"save,omitempty"`
+	Filter  map[string][]byte   `json:"filter,omitempty"`
+	Quads   []jsonQuadFilter    `json:"quads,omitempty"`
+	Filters []jsonValueFilter   `json:"filters,omitempty"`
+
+	Reducers []jsonReducer `json:"reducers,omitempty"`
+	By       []jsonSortKey `json:"by,omitempty"`
+
+	From json.RawMessage   `json:"from,omitempty"`
+	Sub  json.RawMessage   `json:"sub,omitempty"`
+	Subs []json.RawMessage `json:"subs,omitempty"`
+	Opt  []json.RawMessage `json:"opt,omitempty"`
+
+	Size  int64 `json:"size,omitempty"`
+	Skip  int64 `json:"skip,omitempty"`
+	Limit int64 `json:"limit,omitempty"`
+}
+
+type jsonQuadFilter struct {
+	Dir    quad.Direction  `json:"dir"`
+	Values json.RawMessage `json:"values"`
+}
+
+type jsonReducer struct {
+	Op  string `json:"op"`
+	Tag string `json:"tag,omitempty"`
+	As  string `json:"as,omitempty"`
+}
+
+type jsonSortKey struct {
+	Tag  string `json:"tag,omitempty"`
+	Desc bool   `json:"desc,omitempty"`
+	Lang string `json:"lang,omitempty"`
+}
+
+type jsonValueFilter struct {
+	Type    string `json:"type"`
+	Op      int    `json:"op,omitempty"`
+	Value   []byte `json:"value,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Refs    bool   `json:"refs,omitempty"`
+}
+
+// MarshalJSON serializes a shape tree. Node references in the tree are resolved to values with qs,
+// thus the result can be executed on a different quad store with UnmarshalJSON.
+//
+// It returns ErrNotSerializable if the tree contains shapes that are specific to a quad store.
+func MarshalJSON(ctx context.Context, s Shape, qs refs.Namer) ([]byte, error) {
+	e := jsonEncoder{ctx: ctx, qs: qs}
+	return e.shape(s)
+}
+
+// UnmarshalJSON decodes a shape tree serialized by MarshalJSON. Values are resolved to references using qs.
+// Values that are not present in qs are dropped from the tree.
+func UnmarshalJSON(ctx context.Context, data []byte, qs refs.Namer) (Shape, error) {
+	d := jsonDecoder{ctx: ctx, qs: qs}
+	return d.shape(data)
+}
+
+type jsonEncoder struct {
+	ctx context.Context
+	qs  refs.Namer
+}
+
+func (e *jsonEncoder) value(v quad.Value) ([]byte, error) {
+	return pquads.MarshalValue(v)
+}
+
+func (e *jsonEncoder) ref(r refs.Ref) ([]byte, error) {
+	if r == nil {
+		return nil, nil
+	}
+	v, err := e.qs.NameOf(e.ctx, r)
+	if err != nil {
+		return nil, err
+	} else if v == nil {
+		return nil, ErrNotSerializable
+	}
+	return e.value(v)
+}
+
+func (e *jsonEncoder) shapes(arr []Shape) ([]json.RawMessage, error) {
+	out := make([]json.RawMessage, 0, len(arr))
+	for _, s := range arr {
+		data, err := e.shape(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
+
+func (e *jsonEncoder) optShape(s Shape) (json.RawMessage, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return e.shape(s)
+}
+
+func (e *jsonEncoder) filter(f ValueFilter) (jsonValueFilter, error) {
+	switch f := f.(type) {
+	case Comparison:
+		data, err := e.value(f.Val)
+		if err != nil {
+			return jsonValueFilter{}, err
+		}
+		return jsonValueFilter{Type: jsonComparison, Op: int(f.Op), Value: data}, nil
+	case Regexp:
+		return jsonValueFilter{Type: jsonRegexp, Pattern: f.Re.String(), Refs: f.Refs}, nil
+	case Wildcard:
+		return jsonValueFilter{Type: jsonWildcard, Pattern: f.Pattern}, nil
+	}
+	return jsonValueFilter{}, fmt.Errorf("%w: %T", ErrNotSerializable, f)
+}
+
+func (e *jsonEncoder) shape(s Shape) ([]byte, error) {
+	if m, ok := s.(JSONMarshaler); ok {
+		return m.MarshalShapeJSON(e.ctx, e.qs)
+	}
+	var (
+		out jsonShape
+		err error
+	)
+	switch s := s.(type) {
+	case nil, Null:
+		out.Type = jsonNull
+	case AllNodes:
+		out.Type = jsonAllNodes
+	case Except:
+		out.Type = jsonExcept
+		if out.Sub, err = e.optShape(s.Exclude); err != nil {
+			return nil, err
+		}
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+	case Filter:
+		out.Type = jsonFilter
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+		for _, f := range s.Filters {
+			jf, err := e.filter(f)
+			if err != nil {
+				return nil, err
+			}
+			out.Filters = append(out.Filters, jf)
+		}
+	case Count:
+		out.Type = jsonCount
+		if out.From, err = e.optShape(s.Values); err != nil {
+			return nil, err
+		}
+	case Aggregate:
+		out.Type = jsonAggregate
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+		out.Tags = s.GroupBy
+		for _, r := range s.Reducers {
+			out.Reducers = append(out.Reducers, jsonReducer{Op: r.Op.String(), Tag: r.Tag, As: r.As})
+		}
+	case Quads:
+		out.Type = jsonQuads
+		for _, f := range s {
+			data, err := e.optShape(f.Values)
+			if err != nil {
+				return nil, err
+			}
+			out.Quads = append(out.Quads, jsonQuadFilter{Dir: f.Dir, Values: data})
+		}
+	case NodesFrom:
+		out.Type = jsonNodesFrom
+		out.Dir = s.Dir
+		if out.From, err = e.optShape(s.Quads); err != nil {
+			return nil, err
+		}
+	case QuadsAction:
+		out.Type = jsonQuadsAction
+		out.Dir = s.Result
+		out.Size = s.Size
+		if len(s.Save) != 0 {
+			out.Save = make(map[string][]string, len(s.Save))
+			for d, tags := range s.Save {
+				out.Save[d.String()] = tags
+			}
+		}
+		if len(s.Filter) != 0 {
+			out.Filter = make(map[string][]byte, len(s.Filter))
+			for d, r := range s.Filter {
+				data, err := e.ref(r)
+				if err != nil {
+					return nil, err
+				}
+				out.Filter[d.String()] = data
+			}
+		}
+	case Fixed:
+		out.Type = jsonFixed
+		for _, r := range s {
+			data, err := e.ref(r)
+			if err != nil {
+				return nil, err
+			}
+			out.Values = append(out.Values, data)
+		}
+	case FixedTags:
+		out.Type = jsonFixedTags
+		out.Fixed = make(map[string][]byte, len(s.Tags))
+		for tag, r := range s.Tags {
+			data, err := e.ref(r)
+			if err != nil {
+				return nil, err
+			}
+			out.Fixed[tag] = data
+		}
+		if out.From, err = e.optShape(s.On); err != nil {
+			return nil, err
+		}
+	case Lookup:
+		out.Type = jsonLookup
+		for _, v := range s {
+			data, err := e.value(v)
+			if err != nil {
+				return nil, err
+			}
+			out.Values = append(out.Values, data)
+		}
+	case Materialize:
+		out.Type = jsonMaterialize
+		out.Size = int64(s.Size)
+		if out.From, err = e.optShape(s.Values); err != nil {
+			return nil, err
+		}
+	case Intersect:
+		out.Type = jsonIntersect
+		if out.Subs, err = e.shapes(s); err != nil {
+			return nil, err
+		}
+	case IntersectOpt:
+		out.Type = jsonIntersectOpt
+		if out.Subs, err = e.shapes(s.Sub); err != nil {
+			return nil, err
+		}
+		if out.Opt, err = e.shapes(s.Opt); err != nil {
+			return nil, err
+		}
+	case Union:
+		out.Type = jsonUnion
+		if out.Subs, err = e.shapes(s); err != nil {
+			return nil, err
+		}
+	case Page:
+		out.Type = jsonPage
+		out.Skip, out.Limit = s.Skip, s.Limit
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+	case Unique:
+		out.Type = jsonUnique
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+	case Unquote:
+		out.Type = jsonUnquote
+		out.Dir = s.Dir
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+	case Quote:
+		out.Type = jsonQuote
+		out.Dir = s.Dir
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+	case Save:
+		out.Type = jsonSave
+		out.Tags = s.Tags
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+	case Sort:
+		out.Type = jsonSort
+		for _, k := range s.By {
+			out.By = append(out.By, jsonSortKey(k))
+		}
+		if out.From, err = e.optShape(s.From); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrNotSerializable, s)
+	}
+	return json.Marshal(out)
+}
+
+type jsonDecoder struct {
+	ctx context.Context
+	qs  refs.Namer
+}
+
+func (d *jsonDecoder) value(data []byte) (quad.Value, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return pquads.UnmarshalValue(d.ctx, data)
+}
+
+func (d *jsonDecoder) ref(data []byte) (refs.Ref, error) {
+	v, err := d.value(data)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return d.qs.ValueOf(d.ctx, v)
+}
+
+func (d *jsonDecoder) optShape(data json.RawMessage) (Shape, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return d.shape(data)
+}
+
+func (d *jsonDecoder) shapes(arr []json.RawMessage) ([]Shape, error) {
+	out := make([]Shape, 0, len(arr))
+	for _, data := range arr {
+		s, err := d.shape(data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func (d *jsonDecoder) filter(f jsonValueFilter) (ValueFilter, error) {
+	switch f.Type {
+	case jsonComparison:
+		v, err := d.value(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		return Comparison{Op: iterator.Operator(f.Op), Val: v}, nil
+	case jsonRegexp:
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return Regexp{Re: re, Refs: f.Refs}, nil
+	case jsonWildcard:
+		return Wildcard{Pattern: f.Pattern}, nil
+	}
+	return nil, fmt.Errorf("unsupported value filter: %q", f.Type)
+}
+
+func parseDirection(s string) (quad.Direction, error) {
+	for _, d := range quad.Directions {
+		if d.String() == s {
+			return d, nil
+		}
+	}
+	return quad.Any, fmt.Errorf("invalid direction: %q", s)
+}
+
+func (d *jsonDecoder) shape(data []byte) (Shape, error) {
+	var in jsonShape
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+	var err error
+	switch in.Type {
+	case jsonNull:
+		return Null{}, nil
+	case jsonAllNodes:
+		return AllNodes{}, nil
+	case jsonExcept:
+		var s Except
+		if s.Exclude, err = d.optShape(in.Sub); err != nil {
+			return nil, err
+		}
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonFilter:
+		var s Filter
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		for _, jf := range in.Filters {
+			f, err := d.filter(jf)
+			if err != nil {
+				return nil, err
+			}
+			s.Filters = append(s.Filters, f)
+		}
+		return s, nil
+	case jsonCount:
+		var s Count
+		if s.Values, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonAggregate:
+		s := Aggregate{GroupBy: in.Tags}
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		for _, jr := range in.Reducers {
+			op, err := iterator.ParseAggregateOp(jr.Op)
+			if err != nil {
+				return nil, err
+			}
+			s.Reducers = append(s.Reducers, iterator.Reducer{Op: op, Tag: jr.Tag, As: jr.As})
+		}
+		return s, nil
+	case jsonQuads:
+		s := make(Quads, 0, len(in.Quads))
+		for _, f := range in.Quads {
+			sub, err := d.optShape(f.Values)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, QuadFilter{Dir: f.Dir, Values: sub})
+		}
+		return s, nil
+	case jsonNodesFrom:
+		s := NodesFrom{Dir: in.Dir}
+		if s.Quads, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonQuadsAction:
+		s := QuadsAction{Result: in.Dir, Size: in.Size}
+		for name, tags := range in.Save {
+			dir, err := parseDirection(name)
+			if err != nil {
+				return nil, err
+			}
+			if s.Save == nil {
+				s.Save = make(map[quad.Direction][]string, len(in.Save))
+			}
+			s.Save[dir] = tags
+		}
+		for name, data := range in.Filter {
+			dir, err := parseDirection(name)
+			if err != nil {
+				return nil, err
+			}
+			r, err := d.ref(data)
+			if err != nil {
+				return nil, err
+			} else if r == nil {
+				// value is not in the store, so nothing can match this filter
+				return Null{}, nil
+			}
+			s.SetFilter(dir, r)
+		}
+		return s, nil
+	case jsonFixed:
+		s := make(Fixed, 0, len(in.Values))
+		for _, data := range in.Values {
+			r, err := d.ref(data)
+			if err != nil {
+				return nil, err
+			} else if r != nil {
+				s = append(s, r)
+			}
+		}
+		return s, nil
+	case jsonFixedTags:
+		s := FixedTags{Tags: make(map[string]refs.Ref, len(in.Fixed))}
+		for tag, data := range in.Fixed {
+			r, err := d.ref(data)
+			if err != nil {
+				return nil, err
+			} else if r == nil {
+				return Null{}, nil
+			}
+			s.Tags[tag] = r
+		}
+		if s.On, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonLookup:
+		s := make(Lookup, 0, len(in.Values))
+		for _, data := range in.Values {
+			v, err := d.value(data)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case jsonMaterialize:
+		s := Materialize{Size: int(in.Size)}
+		if s.Values, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonIntersect:
+		subs, err := d.shapes(in.Subs)
+		if err != nil {
+			return nil, err
+		}
+		return Intersect(subs), nil
+	case jsonIntersectOpt:
+		var s IntersectOpt
+		subs, err := d.shapes(in.Subs)
+		if err != nil {
+			return nil, err
+		}
+		s.Sub = Intersect(subs)
+		if s.Opt, err = d.shapes(in.Opt); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonUnion:
+		subs, err := d.shapes(in.Subs)
+		if err != nil {
+			return nil, err
+		}
+		return Union(subs), nil
+	case jsonPage:
+		s := Page{Skip: in.Skip, Limit: in.Limit}
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonUnique:
+		var s Unique
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonUnquote:
+		s := Unquote{Dir: in.Dir}
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonQuote:
+		s := Quote{Dir: in.Dir}
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonSave:
+		s := Save{Tags: in.Tags}
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case jsonSort:
+		var s Sort
+		for _, k := range in.By {
+			s.By = append(s.By, iterator.SortKey(k))
+		}
+		if s.From, err = d.optShape(in.From); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported shape type: %q", in.Type)
+}
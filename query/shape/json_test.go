@@ -0,0 +1,64 @@
+package shape_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/memstore"
+	"github.com/aperturerobotics/cayley/quad"
+	. "github.com/aperturerobotics/cayley/query/shape"
+)
+
+func TestShapeJSON(t *testing.T) {
+	ctx := context.Background()
+	qs := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.Make(quad.IRI("bob"), quad.IRI("age"), quad.Int(30), nil),
+	)
+	bob, err := qs.ValueOf(ctx, quad.IRI("bob"))
+	require.NoError(t, err)
+
+	s := Page{
+		Skip: 1, Limit: 10,
+		From: Union{
+			Save{Tags: []string{"x"}, From: Fixed{bob}},
+			Filter{
+				From: NodesFrom{Dir: quad.Object, Quads: Quads{
+					{Dir: quad.Subject, Values: Lookup{quad.IRI("alice")}},
+					{Dir: quad.Predicate, Values: Lookup{quad.IRI("follows")}},
+				}},
+				Filters: []ValueFilter{
+					Comparison{Op: iterator.CompareGT, Val: quad.Int(3)},
+					Wildcard{Pattern: "b%"},
+				},
+			},
+			Except{Exclude: Lookup{quad.IRI("bob")}},
+			Aggregate{
+				From:    Save{Tags: []string{"y"}, From: AllNodes{}},
+				GroupBy: []string{"y"},
+				Reducers: []iterator.Reducer{
+					{Op: iterator.AggregateCount, As: "n"},
+					{Op: iterator.AggregateMax, Tag: "y", As: "max"},
+				},
+			},
+			Sort{
+				From: Save{Tags: []string{"y"}, From: AllNodes{}},
+				By:   []iterator.SortKey{{Tag: "y", Desc: true}, {Lang: "en"}},
+			},
+			Unquote{Dir: quad.Object, From: Quote{Dir: quad.Subject, From: Fixed{bob}}},
+		},
+	}
+	data, err := MarshalJSON(ctx, s, qs)
+	require.NoError(t, err)
+
+	got, err := UnmarshalJSON(ctx, data, qs)
+	require.NoError(t, err)
+	require.Equal(t, s, got)
+
+	_, err = MarshalJSON(ctx, Filter{From: AllNodes{}, Filters: []ValueFilter{nil}}, qs)
+	require.True(t, errors.Is(err, ErrNotSerializable))
+}
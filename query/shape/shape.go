@@ -64,11 +64,21 @@ func (r resolveValues) OptimizeShape(ctx context.Context, s Shape) (Shape, bool,
 // If quad store is specified it will also resolve Lookups and apply any specific optimizations.
 // Should not be used with Simplify - it will fold query to a compact form again.
 func Optimize(ctx context.Context, s Shape, qs graph.QuadStore) (Shape, bool, error) {
-	var opt bool
 	if s == nil {
 		return nil, false, nil
 	}
-	qs = graph.Unwrap(qs)
+	qs = graph.UnwrapAll(qs)
+	s, opt, err := optimizeGeneric(ctx, s, qs)
+	if err != nil {
+		return s, opt, err
+	}
+	optim, opt2, err := optimizeForStore(ctx, s, qs)
+	return optim, opt || opt2, err
+}
+
+// optimizeGeneric resolves lookups and applies optimizations that don't depend on the quad store implementation.
+func optimizeGeneric(ctx context.Context, s Shape, qs graph.QuadStore) (Shape, bool, error) {
+	var opt bool
 	if qs != nil {
 		// resolve all lookups earlier
 		optim, opt1, err := s.Optimize(ctx, resolveValues{qs: qs})
@@ -95,6 +105,28 @@ func Optimize(ctx context.Context, s Shape, qs graph.QuadStore) (Shape, bool, er
 	if s == nil {
 		return Null{}, true, nil
 	}
+	return s, opt, nil
+}
+
+// optimizeForStore applies optimizations based on statistics and implementation of the quad store.
+// Results of the shape are not changed by these optimizations.
+func optimizeForStore(ctx context.Context, s Shape, qs graph.QuadStore) (Shape, bool, error) {
+	var opt bool
+	// use statistics of predicates and histograms, if quad store maintains them
+	_, preds := qs.(graph.PredicateStats)
+	if _, hist := qs.(graph.Histograms); preds || hist {
+		optim, opt2, err := s.Optimize(ctx, statsOptimizer{qs: qs})
+		if err != nil {
+			return s, opt, err
+		}
+		if opt2 {
+			opt = true
+			s = optim
+		}
+		if s == nil {
+			return Null{}, true, nil
+		}
+	}
 	// apply quadstore-specific optimizations
 	if so, ok := qs.(Optimizer); ok && s != nil {
 		optim, opt2, err := s.Optimize(ctx, so)
@@ -132,6 +164,8 @@ func walkChildren(s Shape, fnc WalkFunc) {
 		Walk(s.From, fnc)
 	case Count:
 		Walk(s.Values, fnc)
+	case Aggregate:
+		Walk(s.From, fnc)
 	case Quads:
 		for _, q := range s {
 			Walk(q.Values, fnc)
@@ -161,6 +195,10 @@ func walkChildren(s Shape, fnc WalkFunc) {
 		Walk(s.From, fnc)
 	case Unique:
 		Walk(s.From, fnc)
+	case Unquote:
+		Walk(s.From, fnc)
+	case Quote:
+		Walk(s.From, fnc)
 	case Save:
 		Walk(s.From, fnc)
 	case Sort:
@@ -226,8 +264,15 @@ func IsNull(s Shape) bool {
 }
 
 // BuildIterator optimizes the shape and builds a corresponding iterator tree.
+//
+// If the context has an Explainer, the shape tree and the resulting iterator are recorded to it.
+// Otherwise, if the quad store is wrapped by a ResultCache, results may be read from the cache.
 func BuildIterator(ctx context.Context, qs graph.QuadStore, s Shape) iterator.Shape {
-	qs = graph.Unwrap(qs)
+	if c := resultCacheOf(qs); c != nil && s != nil && ExplainerOf(ctx) == nil {
+		return buildCached(ctx, c, s)
+	}
+	qs = graph.UnwrapAll(qs)
+	orig := s
 	if s != nil {
 		if debugShapes || clog.V(2) {
 			clog.Infof("shape: %#v", s)
@@ -245,7 +290,11 @@ func BuildIterator(ctx context.Context, qs graph.QuadStore, s Shape) iterator.Sh
 	if IsNull(s) {
 		return iterator.NewNull()
 	}
-	return s.BuildIterator(ctx, qs)
+	it := s.BuildIterator(ctx, qs)
+	if e := ExplainerOf(ctx); e != nil {
+		return e.record(qs, orig, s, it)
+	}
+	return it
 }
 
 // Null represent an empty set. Mostly used as a safe alias for nil shape.
@@ -486,6 +535,49 @@ func (s Count) Optimize(ctx context.Context, r Optimizer) (Shape, bool, error) {
 	return s, opt, nil
 }
 
+// Aggregate groups paths of the source by values of GroupBy tags and calculates Reducers for each group.
+// Results are tagged with group-by tags and aggregates. Without GroupBy, it always returns exactly one value.
+type Aggregate struct {
+	From     Shape
+	GroupBy  []string
+	Reducers []iterator.Reducer
+}
+
+func (s Aggregate) BuildIterator(ctx context.Context, qs graph.QuadStore) iterator.Shape {
+	var it iterator.Shape
+	if IsNull(s.From) {
+		it = iterator.NewNull()
+	} else {
+		it = s.From.BuildIterator(ctx, qs)
+	}
+	return iterator.NewAggregate(it, qs, s.GroupBy, s.Reducers)
+}
+
+func (s Aggregate) Optimize(ctx context.Context, r Optimizer) (Shape, bool, error) {
+	if IsNull(s.From) && len(s.GroupBy) != 0 {
+		return Null{}, true, nil
+	}
+	var opt bool
+	if s.From != nil {
+		optim, sopt, err := s.From.Optimize(ctx, r)
+		if err != nil {
+			return s, false, err
+		}
+		s.From, opt = optim, sopt
+		if IsNull(s.From) && len(s.GroupBy) != 0 {
+			return Null{}, true, nil
+		}
+	}
+	if r != nil {
+		ns, nopt, err := r.OptimizeShape(ctx, s)
+		if err != nil {
+			return s, opt, err
+		}
+		return ns, opt || nopt, nil
+	}
+	return s, opt, nil
+}
+
 // QuadFilter is a constraint used to filter quads that have a certain set of values on a given direction.
 // Analog of LinksTo iterator.
 type QuadFilter struct {
@@ -1540,6 +1632,82 @@ func (s Unique) Optimize(ctx context.Context, r Optimizer) (Shape, bool, error)
 	return s, opt, nil
 }
 
+// Unquote enters quoted triples, returning their components in a given direction.
+// Nodes that are not quoted triples are skipped.
+type Unquote struct {
+	From Shape
+	Dir  quad.Direction
+}
+
+func (s Unquote) BuildIterator(ctx context.Context, qs graph.QuadStore) iterator.Shape {
+	if IsNull(s.From) {
+		return iterator.NewNull()
+	}
+	return iterator.NewUnquote(qs, s.From.BuildIterator(ctx, qs), s.Dir)
+}
+
+func (s Unquote) Optimize(ctx context.Context, r Optimizer) (Shape, bool, error) {
+	if IsNull(s.From) {
+		return nil, true, nil
+	}
+	optim, opt, err := s.From.Optimize(ctx, r)
+	if err != nil {
+		return s, false, err
+	}
+	if opt {
+		s.From = optim
+	}
+	if IsNull(s.From) {
+		return nil, true, nil
+	}
+	if r != nil {
+		ns, nopt, err := r.OptimizeShape(ctx, s)
+		if err != nil {
+			return s, opt, err
+		}
+		return ns, opt || nopt, nil
+	}
+	return s, opt, nil
+}
+
+// Quote exits quoted triples: it returns all quoted triples with a component in a given direction
+// that is one of nodes in the source.
+type Quote struct {
+	From Shape
+	Dir  quad.Direction
+}
+
+func (s Quote) BuildIterator(ctx context.Context, qs graph.QuadStore) iterator.Shape {
+	if IsNull(s.From) {
+		return iterator.NewNull()
+	}
+	return iterator.NewQuote(qs, s.From.BuildIterator(ctx, qs), qs.NodesAllIterator(ctx), s.Dir)
+}
+
+func (s Quote) Optimize(ctx context.Context, r Optimizer) (Shape, bool, error) {
+	if IsNull(s.From) {
+		return nil, true, nil
+	}
+	optim, opt, err := s.From.Optimize(ctx, r)
+	if err != nil {
+		return s, false, err
+	}
+	if opt {
+		s.From = optim
+	}
+	if IsNull(s.From) {
+		return nil, true, nil
+	}
+	if r != nil {
+		ns, nopt, err := r.OptimizeShape(ctx, s)
+		if err != nil {
+			return s, opt, err
+		}
+		return ns, opt || nopt, nil
+	}
+	return s, opt, nil
+}
+
 // Save tags a results of query with provided tags.
 type Save struct {
 	Tags []string
@@ -1601,8 +1769,11 @@ func FilterQuads(subject, predicate, object, label []quad.Value) Shape {
 	return q
 }
 
+// Sort orders results of the From shape.
 type Sort struct {
 	From Shape
+	// By lists keys of the sort order. If empty, results are sorted in ascending order.
+	By []iterator.SortKey
 }
 
 func (s Sort) BuildIterator(ctx context.Context, qs graph.QuadStore) iterator.Shape {
@@ -1610,7 +1781,7 @@ func (s Sort) BuildIterator(ctx context.Context, qs graph.QuadStore) iterator.Sh
 		return iterator.NewNull()
 	}
 	it := s.From.BuildIterator(ctx, qs)
-	return iterator.NewSort(qs, it)
+	return iterator.NewSortBy(qs, it, s.By...)
 }
 
 func (s Sort) Optimize(ctx context.Context, r Optimizer) (Shape, bool, error) {
@@ -384,6 +384,137 @@ func TestOptimize(t *testing.T) {
 	}
 }
 
+// StatsLookup is a quad store that maintains statistics of predicates.
+type StatsLookup struct {
+	ValLookup
+	preds map[refs.Ref]graph.PredicateStat
+}
+
+func (qs StatsLookup) PredicateStats(ctx context.Context, pred refs.Ref) (graph.PredicateStat, bool, error) {
+	return qs.preds[pred], true, nil
+}
+
+func TestOptimizeStats(t *testing.T) {
+	ctx := context.Background()
+	qs := StatsLookup{
+		ValLookup: ValLookup{
+			quad.IRI("big"):   intVal(1),
+			quad.IRI("small"): intVal(2),
+			quad.IRI("none"):  intVal(3),
+		},
+		preds: map[refs.Ref]graph.PredicateStat{
+			intVal(1): {Quads: 100, Subjects: 50, Objects: 10},
+			intVal(2): {Quads: 10, Subjects: 10, Objects: 1},
+		},
+	}
+	from := func(dir quad.Direction, pred string) Shape {
+		return NodesFrom{
+			Dir:   dir,
+			Quads: Quads{{Dir: quad.Predicate, Values: Lookup{quad.IRI(pred)}}},
+		}
+	}
+	action := func(dir quad.Direction, ref int) Shape {
+		return QuadsAction{
+			Result: dir,
+			Filter: map[quad.Direction]refs.Ref{quad.Predicate: intVal(ref)},
+		}
+	}
+
+	got, opt, err := Optimize(ctx, Intersect{
+		from(quad.Subject, "big"),
+		from(quad.Object, "big"),
+		from(quad.Subject, "small"),
+	}, qs)
+	require.NoError(t, err)
+	require.True(t, opt)
+	require.Equal(t, Intersect{
+		action(quad.Object, 1),
+		action(quad.Subject, 2),
+		action(quad.Subject, 1),
+	}, got)
+
+	got, opt, err = Optimize(ctx, Intersect{
+		from(quad.Subject, "big"),
+		from(quad.Subject, "none"),
+	}, qs)
+	require.NoError(t, err)
+	require.True(t, opt)
+	require.Equal(t, Null{}, got)
+}
+
+// HistLookup is a quad store that maintains statistics of predicates and histograms of nodes.
+type HistLookup struct {
+	StatsLookup
+	nodes int64
+	hist  map[quad.Direction]*graph.Histogram
+}
+
+func (qs HistLookup) Stats(ctx context.Context, exact bool) (graph.Stats, error) {
+	return graph.Stats{Nodes: refs.Size{Value: qs.nodes}}, nil
+}
+
+func (qs HistLookup) Histogram(ctx context.Context, d quad.Direction) (*graph.Histogram, error) {
+	return qs.hist[d], nil
+}
+
+func TestOptimizeJoinOrder(t *testing.T) {
+	ctx := context.Background()
+	qs := HistLookup{
+		StatsLookup: StatsLookup{
+			ValLookup: ValLookup{
+				quad.IRI("big"):   intVal(1),
+				quad.IRI("small"): intVal(2),
+				quad.IRI("seven"): intVal(7),
+			},
+			preds: map[refs.Ref]graph.PredicateStat{
+				intVal(1): {Quads: 100, Subjects: 50, Objects: 10},
+				intVal(2): {Quads: 10, Subjects: 10, Objects: 1},
+			},
+		},
+		nodes: 100,
+		hist: map[quad.Direction]*graph.Histogram{
+			quad.Subject: {Quads: 110, Distinct: 55},
+			quad.Object:  {Quads: 110, Distinct: 11, Top: []graph.Frequency{{Node: intVal(7), Quads: 3}}},
+		},
+	}
+	from := func(dir quad.Direction, pred string) Shape {
+		return NodesFrom{
+			Dir:   dir,
+			Quads: Quads{{Dir: quad.Predicate, Values: Lookup{quad.IRI(pred)}}},
+		}
+	}
+	action := func(dir quad.Direction, ref int) QuadsAction {
+		return QuadsAction{
+			Result: dir,
+			Filter: map[quad.Direction]refs.Ref{quad.Predicate: intVal(ref)},
+		}
+	}
+	seven := action(quad.Subject, 1)
+	seven.Filter[quad.Object] = intVal(7)
+
+	got, opt, err := Optimize(ctx, Intersect{
+		from(quad.Subject, "big"),
+		from(quad.Object, "big"),
+		from(quad.Subject, "small"),
+		NodesFrom{
+			Dir: quad.Subject,
+			Quads: Quads{
+				{Dir: quad.Predicate, Values: Lookup{quad.IRI("big")}},
+				{Dir: quad.Object, Values: Lookup{quad.IRI("seven")}},
+			},
+		},
+	}, qs)
+	require.NoError(t, err)
+	require.True(t, opt)
+	// objects are more expensive to check, thus a larger set of subjects is checked first
+	require.Equal(t, Intersect{
+		seven,
+		action(quad.Subject, 2),
+		action(quad.Subject, 1),
+		action(quad.Object, 1),
+	}, got)
+}
+
 func TestWalk(t *testing.T) {
 	var s Shape = NodesFrom{
 		Dir: quad.Subject,
@@ -444,6 +575,11 @@ func TestWalkCompositeChildren(t *testing.T) {
 			shape:  Count{Values: fixed1},
 			expect: []string{"shape.Count", "shape.Fixed"},
 		},
+		{
+			name:   "aggregate",
+			shape:  Aggregate{From: fixed1, GroupBy: []string{"x"}},
+			expect: []string{"shape.Aggregate", "shape.Fixed"},
+		},
 		{
 			name: "quads",
 			shape: Quads{
@@ -0,0 +1,255 @@
+package shape
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// statsOptimizer uses statistics of predicates and histograms of nodes maintained by the quad store to remove branches
+// that cannot match any quads and to place the most selective shapes first in intersections.
+//
+// Intersections with more than three shapes are ordered by iterator.JoinOrder, with graph.HistogramCostModel
+// if histograms are available.
+type statsOptimizer struct {
+	qs graph.QuadStore
+}
+
+func (o statsOptimizer) OptimizeShape(ctx context.Context, s Shape) (Shape, bool, error) {
+	switch s := s.(type) {
+	case Intersect:
+		return o.optimizeIntersect(ctx, s)
+	case Quads, NodesFrom, QuadsAction:
+		if n, ok := o.size(ctx, s); ok && n == 0 {
+			return nil, true, nil
+		}
+	}
+	return s, false, nil
+}
+
+func (o statsOptimizer) optimizeIntersect(ctx context.Context, s Intersect) (Shape, bool, error) {
+	type sized struct {
+		s     Shape
+		n     int64
+		known bool
+	}
+	arr := make([]sized, 0, len(s))
+	for _, sub := range s {
+		n, ok := o.size(ctx, sub)
+		if ok && n == 0 {
+			return nil, true, nil
+		}
+		arr = append(arr, sized{s: sub, n: n, known: ok})
+	}
+	if len(arr) > 3 {
+		return o.joinOrder(ctx, s)
+	}
+	sorted := sort.SliceIsSorted(arr, func(i, j int) bool {
+		return arr[i].known && (!arr[j].known || arr[i].n < arr[j].n)
+	})
+	if sorted {
+		return s, false, nil
+	}
+	// shapes with unknown sizes are placed last
+	sort.SliceStable(arr, func(i, j int) bool {
+		return arr[i].known && (!arr[j].known || arr[i].n < arr[j].n)
+	})
+	out := make(Intersect, 0, len(arr))
+	for _, v := range arr {
+		out = append(out, v.s)
+	}
+	return out, true, nil
+}
+
+// joinOrder orders shapes of the intersection to minimize the cost estimated with iterator.JoinOrder.
+func (o statsOptimizer) joinOrder(ctx context.Context, s Intersect) (Shape, bool, error) {
+	st, err := o.qs.Stats(ctx, false)
+	if err != nil {
+		return s, false, err
+	}
+	universe := st.Nodes.Value
+	costs := make([]iterator.Costs, 0, len(s))
+	for _, sub := range s {
+		n, ok := o.size(ctx, sub)
+		if !ok {
+			n = universe
+		}
+		costs = append(costs, iterator.Costs{
+			NextCost:     1,
+			ContainsCost: o.containsCost(ctx, sub),
+			Size:         refs.Size{Value: n},
+		})
+	}
+	order := iterator.JoinOrder(ctx, o.costModel(ctx, s, universe), costs)
+	if slices.IsSorted(order) {
+		return s, false, nil
+	}
+	out := make(Intersect, 0, len(s))
+	for _, i := range order {
+		out = append(out, s[i])
+	}
+	return out, true, nil
+}
+
+// costModel returns a cost model for the intersection. If shapes return nodes from the same direction of quads,
+// the histogram of this direction is used. Shapes with an unknown direction, such as fixed nodes, are ignored.
+func (o statsOptimizer) costModel(ctx context.Context, s Intersect, universe int64) iterator.CostModel {
+	dir := quad.Any
+	for _, sub := range s {
+		switch d := nodesDir(sub); {
+		case d == quad.Any:
+		case dir == quad.Any:
+			dir = d
+		case d != dir:
+			return iterator.UniformCostModel{Universe: universe}
+		}
+	}
+	if dir != quad.Any {
+		if h := graph.HistogramOf(ctx, o.qs, dir); h != nil {
+			return graph.HistogramCostModel{Hist: h}
+		}
+	}
+	return iterator.UniformCostModel{Universe: universe}
+}
+
+// nodesDir returns the direction of quads that the shape takes nodes from, or quad.Any if it's unknown.
+func nodesDir(s Shape) quad.Direction {
+	switch s := s.(type) {
+	case Save:
+		return nodesDir(s.From)
+	case FixedTags:
+		return nodesDir(s.On)
+	case NodesFrom:
+		return s.Dir
+	case QuadsAction:
+		return s.Result
+	}
+	return quad.Any
+}
+
+// containsCost estimates the cost of checking if a node is in the result of the shape.
+func (o statsOptimizer) containsCost(ctx context.Context, s Shape) int64 {
+	dir := nodesDir(s)
+	if dir == quad.Any {
+		return 1
+	}
+	// quads that reference the node must be checked
+	if h := graph.HistogramOf(ctx, o.qs, dir); h != nil {
+		return h.Fanout()
+	}
+	return 1
+}
+
+// predicateStats returns combined statistics of predicates, if values are fixed.
+func (o statsOptimizer) predicateStats(ctx context.Context, values Shape) (graph.PredicateStat, bool) {
+	fixed, ok := values.(Fixed)
+	if !ok {
+		return graph.PredicateStat{}, false
+	}
+	return graph.PredicateStatsOf(ctx, o.qs, fixed)
+}
+
+// quadsSize returns the number of quads that match the filter, and the number of distinct nodes in direction d.
+// Both values are upper bounds.
+func (o statsOptimizer) quadsSize(ctx context.Context, q Quads, d quad.Direction) (quads, nodes int64, _ bool) {
+	found := false
+	for _, f := range q {
+		if f.Dir != quad.Predicate {
+			if n, ok := o.frequency(ctx, f); ok {
+				if !found || n < quads {
+					quads = n
+				}
+				if f.Dir == d {
+					n = min(n, int64(len(f.Values.(Fixed))))
+				}
+				if !found || n < nodes {
+					nodes = n
+				}
+				found = true
+			}
+			continue
+		}
+		st, ok := o.predicateStats(ctx, f.Values)
+		if !ok {
+			continue
+		}
+		n := st.Quads
+		switch d {
+		case quad.Subject:
+			n = st.Subjects
+		case quad.Object:
+			n = st.Objects
+		}
+		if !found || st.Quads < quads {
+			quads = st.Quads
+		}
+		if !found || n < nodes {
+			nodes = n
+		}
+		found = true
+	}
+	return quads, nodes, found
+}
+
+// frequency estimates the number of quads that match a filter with fixed values, using a histogram of the direction.
+func (o statsOptimizer) frequency(ctx context.Context, f QuadFilter) (int64, bool) {
+	fixed, ok := f.Values.(Fixed)
+	if !ok {
+		return 0, false
+	}
+	h := graph.HistogramOf(ctx, o.qs, f.Dir)
+	if h == nil {
+		return 0, false
+	}
+	var n int64
+	for _, v := range fixed {
+		n += h.Frequency(v)
+	}
+	return n, true
+}
+
+// size estimates the maximal number of results of the shape. It returns false if the size cannot be estimated.
+func (o statsOptimizer) size(ctx context.Context, s Shape) (int64, bool) {
+	switch s := s.(type) {
+	case Fixed:
+		return int64(len(s)), true
+	case Quads:
+		n, _, ok := o.quadsSize(ctx, s, quad.Any)
+		return n, ok
+	case NodesFrom:
+		q, ok := s.Quads.(Quads)
+		if !ok {
+			return 0, false
+		}
+		_, n, ok := o.quadsSize(ctx, q, s.Dir)
+		return n, ok
+	case QuadsAction:
+		q := make(Quads, 0, len(s.Filter))
+		for d, v := range s.Filter {
+			q = append(q, QuadFilter{Dir: d, Values: Fixed{v}})
+		}
+		_, n, ok := o.quadsSize(ctx, q, s.Result)
+		return n, ok
+	case Save:
+		return o.size(ctx, s.From)
+	case FixedTags:
+		return o.size(ctx, s.On)
+	case Intersect:
+		var (
+			min   int64
+			found bool
+		)
+		for _, sub := range s {
+			if n, ok := o.size(ctx, sub); ok && (!found || n < min) {
+				min, found = n, true
+			}
+		}
+		return min, found
+	}
+	return 0, false
+}
@@ -0,0 +1,199 @@
+package sparql
+
+import (
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+// Form is a form of the SPARQL query.
+type Form int
+
+const (
+	Select = Form(iota)
+	Ask
+	Construct
+	Describe
+)
+
+func (f Form) String() string {
+	switch f {
+	case Select:
+		return "SELECT"
+	case Ask:
+		return "ASK"
+	case Construct:
+		return "CONSTRUCT"
+	case Describe:
+		return "DESCRIBE"
+	}
+	return "unknown"
+}
+
+// Query is a parsed SPARQL query.
+type Query struct {
+	Form Form
+
+	distinct  bool
+	vars      []string // projected variables; nil means all variables
+	template  []triple // CONSTRUCT template
+	describe  []term   // DESCRIBE resources
+	from      []quad.Value
+	fromNamed []quad.Value
+	where     *group
+	orderBy   []orderCond
+	limit     int // -1 if not set
+	offset    int
+}
+
+// SetDataset replaces the dataset specified in FROM and FROM NAMED clauses of the query.
+func (q *Query) SetDataset(from, fromNamed []quad.Value) {
+	q.from, q.fromNamed = from, fromNamed
+}
+
+// Update is a parsed SPARQL update request.
+type Update struct {
+	ops []updateOp
+}
+
+// updateOp is an operation of the update request. It is either *modify or *clearGraph.
+type updateOp interface {
+	isUpdateOp()
+}
+
+// modify deletes and inserts quads for each solution of the pattern. INSERT DATA and DELETE DATA
+// are represented as modify operations without a pattern.
+type modify struct {
+	with       quad.Value // default graph for templates and the pattern
+	del, ins   []quadPattern
+	using      []quad.Value
+	usingNamed []quad.Value
+	where      *group // nil for DATA operations
+}
+
+type graphTarget int
+
+const (
+	targetGraph = graphTarget(iota)
+	targetDefault
+	targetNamed
+	targetAll
+)
+
+// clearGraph removes all quads from a graph. It is used for both CLEAR and DROP.
+type clearGraph struct {
+	target graphTarget
+	graph  quad.Value // set for targetGraph
+	silent bool
+}
+
+func (*modify) isUpdateOp()     {}
+func (*clearGraph) isUpdateOp() {}
+
+// term is either a variable, or a constant value.
+//
+// Blank nodes in patterns are represented as variables that start with "_:", thus they cannot be projected.
+type term struct {
+	Var string
+	Val quad.Value
+}
+
+func (t term) isVar() bool { return t.Var != "" }
+
+func (t term) isZero() bool { return t.Var == "" && t.Val == nil }
+
+type triple struct {
+	S, P, O term
+}
+
+// quadPattern is a triple pattern in a graph. Zero graph term means the default graph.
+type quadPattern struct {
+	triple
+	G term
+}
+
+type orderCond struct {
+	expr expr
+	desc bool
+}
+
+// group is a group graph pattern, for example { ?s ?p ?o . OPTIONAL { ... } FILTER(...) }.
+type group struct {
+	elems   []element
+	filters []expr
+}
+
+// element is a part of the group graph pattern. It is one of:
+// *bgp, *optional, *union, *graphPattern or *group.
+type element interface {
+	isElement()
+}
+
+// bgp is a basic graph pattern - a set of triple patterns.
+type bgp struct {
+	triples []triple
+}
+
+type optional struct {
+	group *group
+}
+
+type union struct {
+	groups []*group
+}
+
+type graphPattern struct {
+	name  term
+	group *group
+}
+
+func (*bgp) isElement()          {}
+func (*optional) isElement()     {}
+func (*union) isElement()        {}
+func (*graphPattern) isElement() {}
+func (*group) isElement()        {}
+
+// expr is an expression used in FILTER and ORDER BY. It is one of:
+// exprVar, exprConst, *exprUnary, *exprBinary, *exprCall, *exprIn or *exprExists.
+type expr interface {
+	isExpr()
+}
+
+type exprVar string
+
+type exprConst struct {
+	val quad.Value
+}
+
+type exprUnary struct {
+	op string
+	x  expr
+}
+
+type exprBinary struct {
+	op   string
+	l, r expr
+}
+
+// exprCall is a call of a built-in function. Name is always in upper case.
+type exprCall struct {
+	name string
+	args []expr
+}
+
+type exprIn struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+type exprExists struct {
+	group *group
+	not   bool
+}
+
+func (exprVar) isExpr()     {}
+func (exprConst) isExpr()   {}
+func (*exprUnary) isExpr()  {}
+func (*exprBinary) isExpr() {}
+func (*exprCall) isExpr()   {}
+func (*exprIn) isExpr()     {}
+func (*exprExists) isExpr() {}
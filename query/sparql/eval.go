@@ -0,0 +1,662 @@
+package sparql
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+// binding is a solution mapping of variables to values.
+type binding map[string]quad.Value
+
+func compatible(a, b binding) bool {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	for k, v := range a {
+		if w, ok := b[k]; ok && !sameTerm(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func merge(a, b binding) binding {
+	m := make(binding, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+// joinKeys returns variables bound in all solutions of both sets.
+func joinKeys(a, b []binding) []string {
+	var keys []string
+	for k := range a[0] {
+		all := true
+		for _, set := range [][]binding{a, b} {
+			for _, r := range set {
+				if _, ok := r[k]; !ok {
+					all = false
+					break
+				}
+			}
+		}
+		if all {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func hashKey(b binding, keys []string) string {
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(lexical(b[k]))
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+// index groups solutions by values of variables that are bound in both sets. This way
+// joins only check compatibility of solutions that may match.
+func index(a, b []binding) func(binding) []binding {
+	keys := joinKeys(a, b)
+	if len(keys) == 0 {
+		return func(binding) []binding { return b }
+	}
+	m := make(map[string][]binding)
+	for _, r := range b {
+		k := hashKey(r, keys)
+		m[k] = append(m[k], r)
+	}
+	return func(r binding) []binding {
+		return m[hashKey(r, keys)]
+	}
+}
+
+func join(a, b []binding) []binding {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	if len(a) == 1 && len(a[0]) == 0 {
+		return b
+	}
+	lookup := index(a, b)
+	var out []binding
+	for _, x := range a {
+		for _, y := range lookup(x) {
+			if compatible(x, y) {
+				out = append(out, merge(x, y))
+			}
+		}
+	}
+	return out
+}
+
+func (e *engine) leftJoin(ctx context.Context, a, b []binding, filters []expr) ([]binding, error) {
+	if len(a) == 0 {
+		return nil, nil
+	} else if len(b) == 0 {
+		return a, nil
+	}
+	lookup := index(a, b)
+	var out []binding
+	for _, x := range a {
+		matched := false
+		for _, y := range lookup(x) {
+			if !compatible(x, y) {
+				continue
+			}
+			m := merge(x, y)
+			ok, err := e.testAll(ctx, filters, m)
+			if err != nil {
+				return nil, err
+			} else if ok {
+				out = append(out, m)
+				matched = true
+			}
+		}
+		if !matched {
+			out = append(out, x)
+		}
+	}
+	return out, nil
+}
+
+// engine evaluates a query on a quad store.
+type engine struct {
+	qs  graph.QuadStore
+	q   *Query
+	seq int // sequence for generated tags
+
+	names   map[any]quad.Value
+	exists  map[*exprExists][]binding
+	regexps map[string]*regexp.Regexp
+}
+
+func newEngine(qs graph.QuadStore, q *Query) *engine {
+	return &engine{
+		qs: qs, q: q,
+		names:   make(map[any]quad.Value),
+		exists:  make(map[*exprExists][]binding),
+		regexps: make(map[string]*regexp.Regexp),
+	}
+}
+
+func (e *engine) testAll(ctx context.Context, filters []expr, b binding) (bool, error) {
+	for _, f := range filters {
+		ok, err := e.test(ctx, f, b)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (e *engine) filter(ctx context.Context, rows []binding, filters []expr) ([]binding, error) {
+	if len(filters) == 0 {
+		return rows, nil
+	}
+	out := rows[:0]
+	for _, r := range rows {
+		ok, err := e.testAll(ctx, filters, r)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// evalGroup evaluates a group graph pattern. Name is set for patterns inside GRAPH.
+func (e *engine) evalGroup(ctx context.Context, g *group, name *term) ([]binding, error) {
+	rows, err := e.evalElems(ctx, g, name)
+	if err != nil {
+		return nil, err
+	}
+	return e.filter(ctx, rows, g.filters)
+}
+
+// evalElems evaluates a group graph pattern without applying its filters.
+func (e *engine) evalElems(ctx context.Context, g *group, name *term) ([]binding, error) {
+	rows := []binding{{}}
+	for _, el := range g.elems {
+		var (
+			res []binding
+			err error
+		)
+		switch el := el.(type) {
+		case *bgp:
+			res, err = e.evalBGP(ctx, el.triples, name)
+		case *group:
+			res, err = e.evalGroup(ctx, el, name)
+		case *graphPattern:
+			res, err = e.evalGroup(ctx, el.group, &el.name)
+		case *union:
+			for _, sub := range el.groups {
+				var r []binding
+				r, err = e.evalGroup(ctx, sub, name)
+				if err != nil {
+					break
+				}
+				res = append(res, r...)
+			}
+		case *optional:
+			res, err = e.evalElems(ctx, el.group, name)
+			if err == nil {
+				rows, err = e.leftJoin(ctx, rows, res, el.group.filters)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = join(rows, res)
+		if len(rows) == 0 {
+			return nil, nil
+		}
+	}
+	return rows, nil
+}
+
+// lookupValues returns alternative representations of a constant value, since the same
+// value can be stored either as a typed string or as a native value, and IRIs can be shortened.
+func lookupValues(v quad.Value) shape.Lookup {
+	out := shape.Lookup{v}
+	add := func(v quad.Value) {
+		for _, v2 := range out {
+			if quad.StringOf(v2) == quad.StringOf(v) {
+				return
+			}
+		}
+		out = append(out, v)
+	}
+	switch v := v.(type) {
+	case quad.IRI:
+		add(v.Full())
+		add(v.Short())
+	case quad.TypedString:
+		add(quad.TypedString{Value: v.Value, Type: v.Type.Short()})
+		if nv := normalize(v); nv != quad.Value(v) {
+			add(nv)
+		}
+	}
+	return out
+}
+
+// bgpCompiler converts a basic graph pattern to shapes.
+//
+// Variables are nodes of the graph and triple patterns are edges. The compiler builds a spanning tree of each
+// connected component, tagging variables with Save. Other occurrences of the same variable (in cycles
+// or in a predicate position) are tagged with an alias and are checked for equality after the query.
+// Components that are not connected are evaluated separately and joined.
+type bgpCompiler struct {
+	e       *engine
+	triples []triple
+	used    []bool
+	graph   *term
+	visited map[string]bool
+	aliases map[string]string
+	// filters applied to values of variables, see compileBGP
+	filters map[string]shape.ValueFilter
+}
+
+func newBGPCompiler(e *engine, triples []triple, name *term) *bgpCompiler {
+	return &bgpCompiler{
+		e:       e,
+		triples: triples,
+		used:    make([]bool, len(triples)),
+		graph:   name,
+		visited: make(map[string]bool),
+		aliases: make(map[string]string),
+	}
+}
+
+// tag returns a tag for a variable, or an alias if the variable was already used.
+func (c *bgpCompiler) tag(name string) string {
+	if !c.visited[name] {
+		c.visited[name] = true
+		return name
+	}
+	c.e.seq++
+	alias := name + "#" + strconv.Itoa(c.e.seq)
+	c.aliases[alias] = name
+	return alias
+}
+
+// save tags values of a variable. Filters of the variable are only applied to its first occurrence.
+func (c *bgpCompiler) save(name, tag string, from shape.Shape) shape.Shape {
+	if f, ok := c.filters[name]; ok && tag == name {
+		from = shape.Filter{From: from, Filters: []shape.ValueFilter{f}}
+	}
+	return shape.Save{Tags: []string{tag}, From: from}
+}
+
+// node builds a shape for a term, following all unused triple patterns that reference the variable.
+func (c *bgpCompiler) node(t term) shape.Shape {
+	if !t.isVar() {
+		return lookupValues(t.Val)
+	}
+	tag := c.tag(t.Var)
+	var parts shape.Intersect
+	for i, tr := range c.triples {
+		if c.used[i] {
+			continue
+		}
+		switch {
+		case tr.S.Var == t.Var:
+			c.used[i] = true
+			parts = append(parts, c.link(tr, quad.Subject))
+		case tr.O.Var == t.Var:
+			c.used[i] = true
+			parts = append(parts, c.link(tr, quad.Object))
+		}
+	}
+	var from shape.Shape = shape.AllNodes{}
+	if len(parts) == 1 {
+		from = parts[0]
+	} else if len(parts) > 1 {
+		from = parts
+	}
+	return c.save(t.Var, tag, from)
+}
+
+// link builds a shape for nodes in direction d of quads that match a triple pattern.
+func (c *bgpCompiler) link(tr triple, d quad.Direction) shape.Shape {
+	other, ot := quad.Object, tr.O
+	if d == quad.Object {
+		other, ot = quad.Subject, tr.S
+	}
+	quads := shape.Quads{
+		{Dir: quad.Predicate, Values: c.node(tr.P)},
+		{Dir: other, Values: c.node(ot)},
+	}
+	if l := c.label(); l != nil {
+		quads = append(quads, shape.QuadFilter{Dir: quad.Label, Values: l})
+	}
+	return shape.NodesFrom{Dir: d, Quads: quads}
+}
+
+// label returns a shape for quad labels, or nil if quads in any graph match.
+func (c *bgpCompiler) label() shape.Shape {
+	if c.graph == nil {
+		if len(c.e.q.from) == 0 {
+			return nil
+		}
+		var l shape.Lookup
+		for _, v := range c.e.q.from {
+			l = append(l, lookupValues(v)...)
+		}
+		return l
+	}
+	if !c.graph.isVar() {
+		return lookupValues(c.graph.Val)
+	}
+	var from shape.Shape = shape.AllNodes{}
+	if len(c.e.q.fromNamed) != 0 {
+		var l shape.Lookup
+		for _, v := range c.e.q.fromNamed {
+			l = append(l, lookupValues(v)...)
+		}
+		from = l
+	}
+	return c.save(c.graph.Var, c.tag(c.graph.Var), from)
+}
+
+// root builds a shape for the connected component that contains a given triple pattern.
+func (c *bgpCompiler) root(i int) shape.Shape {
+	tr := c.triples[i]
+	if tr.S.isVar() {
+		return c.node(tr.S)
+	} else if tr.O.isVar() {
+		return c.node(tr.O)
+	}
+	c.used[i] = true
+	return shape.IntersectShapes(lookupValues(tr.S.Val), c.link(tr, quad.Subject))
+}
+
+func (e *engine) evalBGP(ctx context.Context, triples []triple, name *term) ([]binding, error) {
+	c := newBGPCompiler(e, triples, name)
+	rows := []binding{{}}
+	for i := range triples {
+		if c.used[i] {
+			continue
+		}
+		res, err := e.run(ctx, c.root(i))
+		if err != nil {
+			return nil, err
+		}
+		// components have no common variables, since other occurrences are aliased
+		rows = join(rows, res)
+		if len(rows) == 0 {
+			return nil, nil
+		}
+	}
+	if len(c.aliases) == 0 {
+		return rows, nil
+	}
+	out := rows[:0]
+next:
+	for _, r := range rows {
+		for alias, name := range c.aliases {
+			if !sameTerm(r[alias], r[name]) {
+				continue next
+			}
+			delete(r, alias)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// compileGroup converts a group graph pattern to a single shape, thus it's evaluated by iterators of the quad store
+// and its solutions are streamed. It returns false if parts of the pattern are only evaluated in memory: OPTIONAL,
+// joins of several elements, disconnected or cyclic patterns, and filters that don't refer to a single variable.
+//
+// Filters of enclosing groups are passed in filters. They are applied to values of their variables.
+func (e *engine) compileGroup(ctx context.Context, g *group, name *term, filters []expr) (shape.Shape, bool) {
+	if len(g.elems) != 1 {
+		return nil, false
+	}
+	filters = append(filters[:len(filters):len(filters)], g.filters...)
+	switch el := g.elems[0].(type) {
+	case *bgp:
+		return e.compileBGP(ctx, el.triples, name, filters)
+	case *group:
+		return e.compileGroup(ctx, el, name, filters)
+	case *graphPattern:
+		return e.compileGroup(ctx, el.group, &el.name, filters)
+	case *union:
+		// filters of the group apply to solutions of each branch
+		out := make(shape.Union, 0, len(el.groups))
+		for _, sub := range el.groups {
+			s, ok := e.compileGroup(ctx, sub, name, filters)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, s)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// compileBGP converts a basic graph pattern to a single shape, if the pattern is connected and has no cycles.
+func (e *engine) compileBGP(ctx context.Context, triples []triple, name *term, filters []expr) (shape.Shape, bool) {
+	if len(triples) == 0 {
+		return nil, false
+	}
+	byVar := make(map[string][]expr)
+	for _, f := range filters {
+		v, ok := filterVar(f)
+		if !ok {
+			return nil, false
+		}
+		byVar[v] = append(byVar[v], f)
+	}
+	c := newBGPCompiler(e, triples, name)
+	c.filters = make(map[string]shape.ValueFilter, len(byVar))
+	for v, exprs := range byVar {
+		c.filters[v] = newValueFilter(ctx, e, v, exprs)
+	}
+	s := c.root(0)
+	if len(c.aliases) != 0 || slices.Contains(c.used, false) {
+		return nil, false
+	}
+	for v := range byVar {
+		if !c.visited[v] {
+			// the filter fails for all solutions, since the variable is unbound
+			return nil, false
+		}
+	}
+	return s, true
+}
+
+// filterVar returns the only variable that the filter refers to. It returns false if the filter refers to
+// several variables or none, or if it has EXISTS, since it must be evaluated on the whole solution.
+func filterVar(x expr) (string, bool) {
+	var (
+		name string
+		ok   = true
+	)
+	var walk func(x expr)
+	walk = func(x expr) {
+		switch x := x.(type) {
+		case exprVar:
+			if name != "" && name != string(x) {
+				ok = false
+			}
+			name = string(x)
+		case *exprUnary:
+			walk(x.x)
+		case *exprBinary:
+			walk(x.l)
+			walk(x.r)
+		case *exprCall:
+			for _, a := range x.args {
+				walk(a)
+			}
+		case *exprIn:
+			walk(x.x)
+			for _, y := range x.list {
+				walk(y)
+			}
+		case *exprExists:
+			ok = false
+		}
+	}
+	walk(x)
+	return name, ok && name != ""
+}
+
+var _ shape.ValueFilter = (*valueFilter)(nil)
+
+// valueFilter evaluates FILTER expressions that refer to a single variable on values of the variable.
+type valueFilter struct {
+	ctx   context.Context
+	name  string
+	exprs []expr
+	// filters may run concurrently with the query, thus they use a separate engine
+	mu sync.Mutex
+	e  *engine
+}
+
+func newValueFilter(ctx context.Context, e *engine, name string, exprs []expr) *valueFilter {
+	return &valueFilter{ctx: ctx, name: name, exprs: exprs, e: newEngine(e.qs, e.q)}
+}
+
+func (f *valueFilter) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.e.testAll(f.ctx, f.exprs, binding{f.name: v})
+	})
+}
+
+// solutionIterator is an iterator over solutions of a pattern.
+type solutionIterator interface {
+	Next(ctx context.Context) bool
+	// Binding returns the current solution. It must not be modified.
+	Binding() binding
+	Err() error
+	Close() error
+}
+
+// collect reads all solutions. The iterator is not closed.
+func collect(ctx context.Context, it solutionIterator) ([]binding, error) {
+	var out []binding
+	for it.Next(ctx) {
+		out = append(out, it.Binding())
+	}
+	return out, it.Err()
+}
+
+// sliceSolutions iterates over solutions evaluated in memory.
+type sliceSolutions struct {
+	rows []binding
+	cur  binding
+}
+
+func (it *sliceSolutions) Next(ctx context.Context) bool {
+	if len(it.rows) == 0 {
+		it.cur = nil
+		return false
+	}
+	it.cur, it.rows = it.rows[0], it.rows[1:]
+	return true
+}
+
+func (it *sliceSolutions) Binding() binding { return it.cur }
+func (it *sliceSolutions) Err() error       { return nil }
+func (it *sliceSolutions) Close() error     { return nil }
+
+// shapeSolutions returns values of all tags for each path of the shape iterator.
+type shapeSolutions struct {
+	e      *engine
+	it     iterator.Scanner
+	inPath bool // the iterator is positioned on a result, thus NextPath is called first
+	cur    binding
+	err    error
+}
+
+func (it *shapeSolutions) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.inPath || !it.it.NextPath(ctx) {
+		if it.inPath = it.it.Next(ctx); !it.inPath {
+			it.cur, it.err = nil, it.it.Err()
+			return false
+		}
+	}
+	tags := make(map[string]graph.Ref)
+	if it.err = it.it.TagResults(ctx, tags); it.err != nil {
+		return false
+	}
+	b := make(binding, len(tags))
+	for k, ref := range tags {
+		v, err := it.e.nameOf(ctx, ref)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		b[k] = v
+	}
+	it.cur = b
+	return true
+}
+
+func (it *shapeSolutions) Binding() binding { return it.cur }
+func (it *shapeSolutions) Err() error       { return it.err }
+func (it *shapeSolutions) Close() error     { return it.it.Close() }
+
+// iterate optimizes a shape and returns an iterator over values of all tags.
+func (e *engine) iterate(ctx context.Context, s shape.Shape) (solutionIterator, error) {
+	s, _, err := shape.Optimize(ctx, s, e.qs)
+	if err != nil {
+		return nil, err
+	} else if shape.IsNull(s) {
+		return &sliceSolutions{}, nil
+	}
+	return &shapeSolutions{e: e, it: shape.BuildIterator(ctx, e.qs, s).Iterate(ctx)}, nil
+}
+
+// run optimizes and executes a shape, returning values of all tags.
+func (e *engine) run(ctx context.Context, s shape.Shape) ([]binding, error) {
+	it, err := e.iterate(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	return collect(ctx, it)
+}
+
+func (e *engine) nameOf(ctx context.Context, ref graph.Ref) (quad.Value, error) {
+	key := refs.ToKey(ref)
+	if v, ok := e.names[key]; ok {
+		return v, nil
+	}
+	v, err := e.qs.NameOf(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	e.names[key] = v
+	return v, nil
+}
@@ -0,0 +1,711 @@
+package sparql
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+	"github.com/aperturerobotics/cayley/quad/voc/xsd"
+)
+
+// errType is returned when expression arguments have incompatible types or when a variable is not bound.
+// Filters treat such errors as false, as defined by the spec.
+var errType = errors.New("sparql: type error")
+
+var (
+	xsdString   = quad.IRI(xsd.String).Full()
+	xsdInteger  = quad.IRI(xsd.Integer).Full()
+	xsdDecimal  = quad.IRI(xsd.Prefix + "decimal").Full()
+	xsdDouble   = quad.IRI(xsd.Double).Full()
+	xsdFloat    = quad.IRI(xsd.Float).Full()
+	xsdBoolean  = quad.IRI(xsd.Boolean).Full()
+	xsdDateTime = quad.IRI(xsd.DateTime).Full()
+	rdfLang     = quad.IRI(rdf.LangString).Full()
+)
+
+// normalize converts typed strings of known types to native values, so they can be compared.
+func normalize(v quad.Value) quad.Value {
+	ts, ok := v.(quad.TypedString)
+	if !ok {
+		return v
+	}
+	switch ts.Type.Full() {
+	case xsdString:
+		return ts.Value
+	case xsdDecimal:
+		if f, err := strconv.ParseFloat(string(ts.Value), 64); err == nil {
+			return quad.Float(f)
+		}
+	case xsdBoolean:
+		// xsd allows both forms, while quad conversion only accepts Go boolean literals
+		switch ts.Value {
+		case "1":
+			return quad.Bool(true)
+		case "0":
+			return quad.Bool(false)
+		}
+	}
+	if nv, err := ts.ParseValue(); err == nil {
+		return nv
+	}
+	return v
+}
+
+func isNumeric(v quad.Value) bool {
+	switch v.(type) {
+	case quad.Int, quad.Float:
+		return true
+	}
+	return false
+}
+
+func toFloat(v quad.Value) float64 {
+	switch v := v.(type) {
+	case quad.Int:
+		return float64(v)
+	case quad.Float:
+		return float64(v)
+	}
+	return math.NaN()
+}
+
+func isLiteral(v quad.Value) bool {
+	switch v.(type) {
+	case nil, quad.IRI, quad.BNode:
+		return false
+	}
+	return true
+}
+
+// stringArg returns a value of a simple literal or a language-tagged string.
+func stringArg(v quad.Value) (string, string, error) {
+	switch v := normalize(v).(type) {
+	case quad.String:
+		return string(v), "", nil
+	case quad.LangString:
+		return string(v.Value), v.Lang, nil
+	}
+	return "", "", errType
+}
+
+// lexical returns a lexical form of a literal, or a full IRI.
+func lexical(v quad.Value) string {
+	switch v := v.(type) {
+	case quad.IRI:
+		return string(v.Full())
+	case quad.BNode:
+		return string(v)
+	case quad.String:
+		return string(v)
+	case quad.LangString:
+		return string(v.Value)
+	case quad.TypedString:
+		return string(v.Value)
+	case quad.Int:
+		return strconv.FormatInt(int64(v), 10)
+	case quad.Float:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case quad.Bool:
+		return strconv.FormatBool(bool(v))
+	case quad.Time:
+		return time.Time(v).Format(time.RFC3339Nano)
+	}
+	return quad.StringOf(v)
+}
+
+// datatype returns a datatype IRI of a literal.
+func datatype(v quad.Value) (quad.IRI, bool) {
+	switch v := v.(type) {
+	case quad.String:
+		return xsdString, true
+	case quad.LangString:
+		return rdfLang, true
+	case quad.TypedString:
+		return v.Type.Full(), true
+	case quad.Int:
+		return xsdInteger, true
+	case quad.Float:
+		return xsdDouble, true
+	case quad.Bool:
+		return xsdBoolean, true
+	case quad.Time:
+		return xsdDateTime, true
+	}
+	return "", false
+}
+
+// sameTerm checks if two values are the same RDF term.
+func sameTerm(a, b quad.Value) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if ia, ok := a.(quad.IRI); ok {
+		ib, ok := b.(quad.IRI)
+		return ok && ia.Full() == ib.Full()
+	}
+	if isLiteral(a) && isLiteral(b) {
+		ta, _ := datatype(a)
+		tb, _ := datatype(b)
+		if ta != tb {
+			return false
+		}
+		if la, ok := a.(quad.LangString); ok {
+			return strings.EqualFold(la.Lang, b.(quad.LangString).Lang) && la.Value == b.(quad.LangString).Value
+		}
+		return lexical(a) == lexical(b)
+	}
+	return quad.StringOf(a) == quad.StringOf(b)
+}
+
+// compare compares two values by their natural order. It returns an error if values are not comparable.
+func compare(a, b quad.Value) (int, error) {
+	a, b = normalize(a), normalize(b)
+	if isNumeric(a) && isNumeric(b) {
+		if ia, ok := a.(quad.Int); ok {
+			if ib, ok := b.(quad.Int); ok {
+				return cmpOrdered(ia, ib), nil
+			}
+		}
+		fa, fb := toFloat(a), toFloat(b)
+		if math.IsNaN(fa) || math.IsNaN(fb) {
+			return 0, errType
+		}
+		return cmpOrdered(fa, fb), nil
+	}
+	switch a := a.(type) {
+	case quad.String:
+		if b, ok := b.(quad.String); ok {
+			return strings.Compare(string(a), string(b)), nil
+		}
+	case quad.LangString:
+		if b, ok := b.(quad.LangString); ok && strings.EqualFold(a.Lang, b.Lang) {
+			return strings.Compare(string(a.Value), string(b.Value)), nil
+		}
+	case quad.Time:
+		if b, ok := b.(quad.Time); ok {
+			return time.Time(a).Compare(time.Time(b)), nil
+		}
+	case quad.Bool:
+		if b, ok := b.(quad.Bool); ok {
+			return cmpOrdered(boolInt(bool(a)), boolInt(bool(b))), nil
+		}
+	}
+	return 0, errType
+}
+
+func cmpOrdered[T int | int64 | quad.Int | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return +1
+	}
+	return 0
+}
+
+func boolInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// equal implements the '=' operator.
+func equal(a, b quad.Value) (bool, error) {
+	if c, err := compare(a, b); err == nil {
+		return c == 0, nil
+	}
+	if sameTerm(a, b) {
+		return true, nil
+	}
+	if isLiteral(a) && isLiteral(b) {
+		na, nb := normalize(a), normalize(b)
+		if _, ok := na.(quad.TypedString); ok {
+			// literals of unknown types cannot be compared
+			return false, errType
+		} else if _, ok = nb.(quad.TypedString); ok {
+			return false, errType
+		}
+	}
+	return false, nil
+}
+
+// orderCompare compares values for ORDER BY. Unlike compare, any values can be ordered:
+// unbound values go first, then blank nodes, IRIs and literals.
+func orderCompare(a, b quad.Value) int {
+	rank := func(v quad.Value) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case quad.BNode:
+			return 1
+		case quad.IRI:
+			return 2
+		}
+		return 3
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return cmpOrdered(ra, rb)
+	}
+	if c, err := compare(a, b); err == nil {
+		return c
+	}
+	return strings.Compare(lexical(a), lexical(b))
+}
+
+// ebv returns an effective boolean value of v.
+func ebv(v quad.Value) (bool, error) {
+	switch v := normalize(v).(type) {
+	case quad.Bool:
+		return bool(v), nil
+	case quad.Int:
+		return v != 0, nil
+	case quad.Float:
+		return v != 0 && !math.IsNaN(float64(v)), nil
+	case quad.String:
+		return v != "", nil
+	case quad.LangString:
+		return v.Value != "", nil
+	}
+	return false, errType
+}
+
+// test evaluates a filter condition, treating errors as false.
+func (e *engine) test(ctx context.Context, x expr, b binding) (bool, error) {
+	v, err := e.eval(ctx, x, b)
+	if err == errType {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	ok, err := ebv(v)
+	if err == errType {
+		return false, nil
+	}
+	return ok, err
+}
+
+func (e *engine) eval(ctx context.Context, x expr, b binding) (quad.Value, error) {
+	switch x := x.(type) {
+	case exprVar:
+		v, ok := b[string(x)]
+		if !ok {
+			return nil, errType
+		}
+		return v, nil
+	case exprConst:
+		return x.val, nil
+	case *exprUnary:
+		v, err := e.eval(ctx, x.x, b)
+		if err != nil {
+			return nil, err
+		}
+		switch x.op {
+		case "!":
+			ok, err := ebv(v)
+			if err != nil {
+				return nil, err
+			}
+			return quad.Bool(!ok), nil
+		case "-":
+			switch v := normalize(v).(type) {
+			case quad.Int:
+				return -v, nil
+			case quad.Float:
+				return -v, nil
+			}
+			return nil, errType
+		default:
+			if v = normalize(v); !isNumeric(v) {
+				return nil, errType
+			}
+			return v, nil
+		}
+	case *exprBinary:
+		return e.evalBinary(ctx, x, b)
+	case *exprIn:
+		v, err := e.eval(ctx, x.x, b)
+		if err != nil {
+			return nil, err
+		}
+		var lerr error
+		for _, y := range x.list {
+			w, err := e.eval(ctx, y, b)
+			if err == nil {
+				var eq bool
+				eq, err = equal(v, w)
+				if err == nil && eq {
+					return quad.Bool(!x.not), nil
+				}
+			}
+			if err != nil {
+				lerr = err
+			}
+		}
+		if lerr != nil {
+			return nil, lerr
+		}
+		return quad.Bool(x.not), nil
+	case *exprExists:
+		rows, ok := e.exists[x]
+		if !ok {
+			var err error
+			rows, err = e.evalGroup(ctx, x.group, nil)
+			if err != nil {
+				return nil, err
+			}
+			e.exists[x] = rows
+		}
+		found := false
+		for _, r := range rows {
+			if compatible(b, r) {
+				found = true
+				break
+			}
+		}
+		return quad.Bool(found != x.not), nil
+	case *exprCall:
+		return e.evalCall(ctx, x, b)
+	}
+	return nil, errType
+}
+
+func (e *engine) evalBinary(ctx context.Context, x *exprBinary, b binding) (quad.Value, error) {
+	switch x.op {
+	case "||", "&&":
+		// errors are only returned if the result cannot be determined by the other argument
+		l, lerr := e.evalBool(ctx, x.l, b)
+		r, rerr := e.evalBool(ctx, x.r, b)
+		if lerr != nil && lerr != errType {
+			return nil, lerr
+		} else if rerr != nil && rerr != errType {
+			return nil, rerr
+		}
+		short := x.op == "||"
+		switch {
+		case lerr == nil && l == short, rerr == nil && r == short:
+			return quad.Bool(short), nil
+		case lerr != nil || rerr != nil:
+			return nil, errType
+		}
+		return quad.Bool(!short), nil
+	}
+	l, err := e.eval(ctx, x.l, b)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.eval(ctx, x.r, b)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "=", "!=":
+		eq, err := equal(l, r)
+		if err != nil {
+			return nil, err
+		}
+		return quad.Bool(eq == (x.op == "=")), nil
+	case "<", ">", "<=", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		switch x.op {
+		case "<":
+			ok = c < 0
+		case ">":
+			ok = c > 0
+		case "<=":
+			ok = c <= 0
+		default:
+			ok = c >= 0
+		}
+		return quad.Bool(ok), nil
+	}
+	l, r = normalize(l), normalize(r)
+	if !isNumeric(l) || !isNumeric(r) {
+		return nil, errType
+	}
+	li, lint := l.(quad.Int)
+	ri, rint := r.(quad.Int)
+	if lint && rint && x.op != "/" {
+		switch x.op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		default:
+			return li * ri, nil
+		}
+	}
+	lf, rf := toFloat(l), toFloat(r)
+	switch x.op {
+	case "+":
+		return quad.Float(lf + rf), nil
+	case "-":
+		return quad.Float(lf - rf), nil
+	case "*":
+		return quad.Float(lf * rf), nil
+	}
+	if rf == 0 && lint && rint {
+		return nil, errType
+	}
+	return quad.Float(lf / rf), nil
+}
+
+func (e *engine) evalBool(ctx context.Context, x expr, b binding) (bool, error) {
+	v, err := e.eval(ctx, x, b)
+	if err != nil {
+		return false, err
+	}
+	return ebv(v)
+}
+
+func (e *engine) evalCall(ctx context.Context, x *exprCall, b binding) (quad.Value, error) {
+	switch x.name {
+	case "BOUND":
+		_, ok := b[string(x.args[0].(exprVar))]
+		return quad.Bool(ok), nil
+	case "COALESCE":
+		for _, a := range x.args {
+			v, err := e.eval(ctx, a, b)
+			if err == nil {
+				return v, nil
+			} else if err != errType {
+				return nil, err
+			}
+		}
+		return nil, errType
+	case "IF":
+		ok, err := e.evalBool(ctx, x.args[0], b)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return e.eval(ctx, x.args[1], b)
+		}
+		return e.eval(ctx, x.args[2], b)
+	}
+	args := make([]quad.Value, 0, len(x.args))
+	for _, a := range x.args {
+		v, err := e.eval(ctx, a, b)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	switch x.name {
+	case "ISIRI", "ISURI":
+		_, ok := args[0].(quad.IRI)
+		return quad.Bool(ok), nil
+	case "ISBLANK":
+		_, ok := args[0].(quad.BNode)
+		return quad.Bool(ok), nil
+	case "ISLITERAL":
+		return quad.Bool(isLiteral(args[0])), nil
+	case "ISNUMERIC":
+		return quad.Bool(isNumeric(normalize(args[0]))), nil
+	case "STR":
+		if _, ok := args[0].(quad.BNode); ok {
+			return nil, errType
+		}
+		return quad.String(lexical(args[0])), nil
+	case "LANG":
+		if !isLiteral(args[0]) {
+			return nil, errType
+		}
+		if ls, ok := args[0].(quad.LangString); ok {
+			return quad.String(ls.Lang), nil
+		}
+		return quad.String(""), nil
+	case "DATATYPE":
+		dt, ok := datatype(args[0])
+		if !ok {
+			return nil, errType
+		}
+		return dt, nil
+	case "SAMETERM":
+		return quad.Bool(sameTerm(args[0], args[1])), nil
+	case "LANGMATCHES":
+		tag, _, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		rng, _, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if rng == "*" {
+			return quad.Bool(tag != ""), nil
+		}
+		tag, rng = strings.ToLower(tag), strings.ToLower(rng)
+		return quad.Bool(tag == rng || strings.HasPrefix(tag, rng+"-")), nil
+	case "REGEX":
+		text, _, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		pattern, _, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		flags := ""
+		if len(args) > 2 {
+			if flags, _, err = stringArg(args[2]); err != nil {
+				return nil, err
+			}
+		}
+		re, err := e.regexp(pattern, flags)
+		if err != nil {
+			return nil, err
+		}
+		return quad.Bool(re.MatchString(text)), nil
+	case "CONTAINS", "STRSTARTS", "STRENDS":
+		s, _, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sub, _, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		switch x.name {
+		case "CONTAINS":
+			return quad.Bool(strings.Contains(s, sub)), nil
+		case "STRSTARTS":
+			return quad.Bool(strings.HasPrefix(s, sub)), nil
+		}
+		return quad.Bool(strings.HasSuffix(s, sub)), nil
+	case "STRLEN":
+		s, _, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return quad.Int(utf8.RuneCountInString(s)), nil
+	case "LCASE", "UCASE":
+		s, lang, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if x.name == "LCASE" {
+			s = strings.ToLower(s)
+		} else {
+			s = strings.ToUpper(s)
+		}
+		if lang != "" {
+			return quad.LangString{Value: quad.String(s), Lang: lang}, nil
+		}
+		return quad.String(s), nil
+	case "CONCAT":
+		var sb strings.Builder
+		for _, a := range args {
+			s, _, err := stringArg(a)
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(s)
+		}
+		return quad.String(sb.String()), nil
+	}
+	return cast(quad.IRI(x.name), args[0])
+}
+
+// cast implements XSD constructor functions.
+func cast(typ quad.IRI, v quad.Value) (quad.Value, error) {
+	if _, ok := v.(quad.BNode); ok {
+		return nil, errType
+	}
+	if typ == xsdString {
+		return quad.String(lexical(v)), nil
+	}
+	if !isLiteral(v) {
+		return nil, errType
+	}
+	v = normalize(v)
+	switch typ {
+	case xsdInteger:
+		switch v := v.(type) {
+		case quad.Int:
+			return v, nil
+		case quad.Float:
+			return quad.Int(v), nil
+		case quad.Bool:
+			return quad.Int(boolInt(bool(v))), nil
+		}
+	case xsdDouble, xsdFloat:
+		switch v := v.(type) {
+		case quad.Int:
+			return quad.Float(v), nil
+		case quad.Float:
+			return v, nil
+		case quad.Bool:
+			return quad.Float(boolInt(bool(v))), nil
+		}
+	case xsdBoolean:
+		switch v := v.(type) {
+		case quad.Bool:
+			return v, nil
+		case quad.Int, quad.Float:
+			ok, _ := ebv(v)
+			return quad.Bool(ok), nil
+		}
+	case xsdDateTime:
+		if v, ok := v.(quad.Time); ok {
+			return v, nil
+		}
+	}
+	// parse a lexical form of a string
+	s, ok := v.(quad.String)
+	if !ok {
+		return nil, errType
+	}
+	if typ == xsdFloat {
+		typ = xsdDouble
+	}
+	nv := normalize(quad.TypedString{Value: s, Type: typ})
+	if _, ok := nv.(quad.TypedString); ok {
+		return nil, errType
+	}
+	return nv, nil
+}
+
+func (e *engine) regexp(pattern, flags string) (*regexp.Regexp, error) {
+	key := flags + "/" + pattern
+	if re, ok := e.regexps[key]; ok {
+		return re, nil
+	}
+	if flags != "" {
+		for _, f := range flags {
+			if !strings.ContainsRune("imsx", f) {
+				return nil, errType
+			}
+		}
+		if strings.ContainsRune(flags, 'x') {
+			// remove whitespace, as defined by XPath
+			pattern = strings.Map(func(r rune) rune {
+				if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+					return -1
+				}
+				return r
+			}, pattern)
+			flags = strings.ReplaceAll(flags, "x", "")
+		}
+		if flags != "" {
+			pattern = "(?" + flags + ")" + pattern
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errType
+	}
+	e.regexps[key] = re
+	return re, nil
+}
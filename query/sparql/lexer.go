@@ -0,0 +1,281 @@
+package sparql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF     = tokenKind(iota)
+	tokIRI     // <http://example.com/>
+	tokPName   // prefix:local
+	tokBNode   // _:label
+	tokVar     // ?name or $name
+	tokString  // "string"
+	tokLang    // @en
+	tokInteger // 1
+	tokDecimal // 1.5
+	tokDouble  // 1e5
+	tokIdent   // keywords, function names and 'a'
+	tokPunct   // operators and delimiters
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokIRI:
+		return "<" + t.text + ">"
+	case tokBNode:
+		return "_:" + t.text
+	case tokVar:
+		return "?" + t.text
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokLang:
+		return "@" + t.text
+	}
+	return strconv.Quote(t.text)
+}
+
+// is checks if the token is a given punctuation or a keyword (case-insensitive).
+func (t token) is(s string) bool {
+	switch t.kind {
+	case tokPunct:
+		return t.text == s
+	case tokIdent:
+		return strings.EqualFold(t.text, s)
+	}
+	return false
+}
+
+// ParseError is returned for syntax errors in the query.
+type ParseError struct {
+	Pos int // byte offset in the query
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("sparql: %s at offset %d", e.Msg, e.Pos)
+}
+
+// lex splits the query into tokens.
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		r, sz := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += sz
+			continue
+		case r == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		start := i
+		tok := token{pos: start}
+		switch {
+		case r == '<' && isIRIRef(s[i:]):
+			end := strings.IndexByte(s[i:], '>')
+			tok.kind, tok.text = tokIRI, s[i+1:i+end]
+			i += end + 1
+		case r == '"' || r == '\'':
+			str, n, err := lexString(s[i:])
+			if err != nil {
+				return nil, &ParseError{Pos: start, Msg: err.Error()}
+			}
+			tok.kind, tok.text = tokString, str
+			i += n
+		case r == '@':
+			i++
+			for i < len(s) && (isASCIILetter(s[i]) || isDigit(s[i]) || (s[i] == '-' && i > start+1)) {
+				i++
+			}
+			if i == start+1 {
+				return nil, &ParseError{Pos: start, Msg: "empty language tag"}
+			}
+			tok.kind, tok.text = tokLang, s[start+1:i]
+		case r == '?' || r == '$':
+			i++
+			for i < len(s) {
+				c, n := utf8.DecodeRuneInString(s[i:])
+				if !isNameRune(c) || c == '-' || c == '.' {
+					break
+				}
+				i += n
+			}
+			if i == start+1 {
+				return nil, &ParseError{Pos: start, Msg: "empty variable name"}
+			}
+			tok.kind, tok.text = tokVar, s[start+1:i]
+		case strings.HasPrefix(s[i:], "_:"):
+			i += 2
+			i += lexName(s[i:])
+			tok.kind, tok.text = tokBNode, s[start+2:i]
+		case isDigit(byte(r)) || (r == '.' && i+1 < len(s) && isDigit(s[i+1])):
+			tok.kind, i = lexNumber(s, i)
+			tok.text = s[start:i]
+		case r == ':' || r == '_' || unicode.IsLetter(r):
+			i += lexName(s[i:])
+			tok.text = s[start:i]
+			if strings.IndexByte(tok.text, ':') >= 0 {
+				tok.kind = tokPName
+			} else {
+				tok.kind = tokIdent
+			}
+		default:
+			tok.kind = tokPunct
+			for _, p := range []string{"!=", "<=", ">=", "&&", "||", "^^"} {
+				if strings.HasPrefix(s[i:], p) {
+					tok.text = p
+					break
+				}
+			}
+			if tok.text == "" {
+				if !strings.ContainsRune("{}()[].,;*/+-=<>!|^", r) {
+					return nil, &ParseError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", r)}
+				}
+				tok.text = string(r)
+			}
+			i += len(tok.text)
+		}
+		toks = append(toks, tok)
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(s)})
+	return toks, nil
+}
+
+func isDigit(c byte) bool       { return c >= '0' && c <= '9' }
+func isASCIILetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+func isNameRune(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isIRIRef checks if '<' starts an IRI reference, or if it's a comparison operator.
+func isIRIRef(s string) bool {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '>':
+			return true
+		case c <= ' ' || strings.IndexByte("<\"{}|^`\\", c) >= 0:
+			return false
+		}
+	}
+	return false
+}
+
+// lexName returns the length of a prefixed name, keyword or a blank node label.
+func lexName(s string) int {
+	i := 0
+	for i < len(s) {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if !isNameRune(r) && r != ':' && r != '%' {
+			break
+		}
+		i += n
+	}
+	// dot is allowed in names, but not at the end
+	for i > 0 && s[i-1] == '.' {
+		i--
+	}
+	return i
+}
+
+func lexNumber(s string, i int) (tokenKind, int) {
+	kind := tokInteger
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	if i+1 < len(s) && s[i] == '.' && isDigit(s[i+1]) {
+		kind = tokDecimal
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			kind = tokDouble
+			for i = j; i < len(s) && isDigit(s[i]); i++ {
+			}
+		}
+	}
+	return kind, i
+}
+
+// lexString reads a quoted string and returns its unescaped value and the number of bytes consumed.
+func lexString(s string) (string, int, error) {
+	q := s[:1]
+	if len(s) >= 3 && s[1] == s[0] && s[2] == s[0] {
+		q = s[:3]
+	}
+	var sb strings.Builder
+	for i := len(q); i < len(s); {
+		if strings.HasPrefix(s[i:], q) {
+			return sb.String(), i + len(q), nil
+		}
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			i++
+			switch e := s[i]; e {
+			case 't':
+				sb.WriteByte('\t')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case '"', '\'', '\\':
+				sb.WriteByte(e)
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if i+n >= len(s) {
+					return "", 0, fmt.Errorf("invalid escape sequence")
+				}
+				v, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape sequence")
+				}
+				sb.WriteRune(rune(v))
+				i += n
+			default:
+				return "", 0, fmt.Errorf("invalid escape sequence %q", "\\"+string(e))
+			}
+			i++
+		case len(q) == 1 && (c == '\n' || c == '\r'):
+			return "", 0, fmt.Errorf("newline in string")
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
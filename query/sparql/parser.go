@@ -0,0 +1,685 @@
+package sparql
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/voc"
+	"github.com/aperturerobotics/cayley/quad/voc/rdf"
+	"github.com/aperturerobotics/cayley/quad/voc/xsd"
+)
+
+// builtins lists supported built-in functions with their minimal and maximal number of arguments.
+var builtins = map[string][2]int{
+	"BOUND":       {1, 1},
+	"ISIRI":       {1, 1},
+	"ISURI":       {1, 1},
+	"ISBLANK":     {1, 1},
+	"ISLITERAL":   {1, 1},
+	"ISNUMERIC":   {1, 1},
+	"STR":         {1, 1},
+	"LANG":        {1, 1},
+	"DATATYPE":    {1, 1},
+	"LANGMATCHES": {2, 2},
+	"SAMETERM":    {2, 2},
+	"REGEX":       {2, 3},
+	"CONTAINS":    {2, 2},
+	"STRSTARTS":   {2, 2},
+	"STRENDS":     {2, 2},
+	"STRLEN":      {1, 1},
+	"LCASE":       {1, 1},
+	"UCASE":       {1, 1},
+	"CONCAT":      {0, -1},
+	"COALESCE":    {0, -1},
+	"IF":          {3, 3},
+}
+
+// casts lists XSD types that can be used as cast functions, for example xsd:integer(?x).
+var casts = map[quad.IRI]bool{
+	quad.IRI(xsd.String).Full():   true,
+	quad.IRI(xsd.Integer).Full():  true,
+	quad.IRI(xsd.Double).Full():   true,
+	quad.IRI(xsd.Float).Full():    true,
+	quad.IRI(xsd.Boolean).Full():  true,
+	quad.IRI(xsd.DateTime).Full(): true,
+}
+
+type parser struct {
+	toks     []token
+	pos      int
+	base     *url.URL
+	prefixes map[string]string
+	bnodes   int
+}
+
+// Parse parses a SPARQL query.
+func Parse(qu string) (*Query, error) {
+	return parse(qu, (*parser).parseQuery)
+}
+
+// ParseUpdate parses a SPARQL update request.
+func ParseUpdate(qu string) (*Update, error) {
+	return parse(qu, (*parser).parseUpdate)
+}
+
+func parse[T any](s string, fnc func(p *parser) T) (out T, err error) {
+	toks, err := lex(s)
+	if err != nil {
+		return out, err
+	}
+	p := &parser{toks: toks, prefixes: make(map[string]string)}
+	// parser functions panic with *ParseError to avoid checking errors on each step
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(*ParseError)
+			if !ok {
+				panic(r)
+			}
+			var zero T
+			out, err = zero, perr
+		}
+	}()
+	return fnc(p), nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it's a given punctuation or keyword.
+func (p *parser) accept(s string) bool {
+	if p.peek().is(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) {
+	if !p.accept(s) {
+		p.errorf("expected %q, got %v", s, p.peek())
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) {
+	panic(&ParseError{Pos: p.peek().pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) parseQuery() *Query {
+	p.parsePrologue()
+	q := &Query{limit: -1}
+	t := p.next()
+	switch {
+	case t.is("SELECT"):
+		q.Form = Select
+		if p.accept("DISTINCT") {
+			q.distinct = true
+		} else {
+			p.accept("REDUCED")
+		}
+		if !p.accept("*") {
+			for p.peek().kind == tokVar {
+				q.vars = append(q.vars, p.next().text)
+			}
+			if len(q.vars) == 0 {
+				if p.peek().is("(") {
+					p.errorf("expressions in SELECT are not supported")
+				}
+				p.errorf("expected variables or '*', got %v", p.peek())
+			}
+		}
+		p.parseDataset(q)
+		q.where = p.parseWhere()
+	case t.is("ASK"):
+		q.Form = Ask
+		p.parseDataset(q)
+		q.where = p.parseWhere()
+	case t.is("CONSTRUCT"):
+		q.Form = Construct
+		if p.peek().is("{") {
+			q.template = p.parseTemplate()
+			p.parseDataset(q)
+			q.where = p.parseWhere()
+		} else {
+			p.parseDataset(q)
+			p.expect("WHERE")
+			q.template = p.parseTemplate()
+			q.where = &group{elems: []element{&bgp{triples: q.template}}}
+		}
+	case t.is("DESCRIBE"):
+		q.Form = Describe
+		if !p.accept("*") {
+			for p.peek().kind == tokVar || p.peek().kind == tokIRI || p.peek().kind == tokPName {
+				q.describe = append(q.describe, p.parseVarOrIRI())
+			}
+			if len(q.describe) == 0 {
+				p.errorf("expected variables or IRIs, got %v", p.peek())
+			}
+		}
+		p.parseDataset(q)
+		if p.peek().is("WHERE") || p.peek().is("{") {
+			q.where = p.parseWhere()
+		} else {
+			q.where = &group{}
+		}
+	default:
+		p.pos--
+		p.errorf("expected query form, got %v", t)
+	}
+	p.parseModifiers(q)
+	if t := p.peek(); t.kind != tokEOF {
+		if t.is("VALUES") {
+			p.errorf("VALUES is not supported")
+		}
+		p.errorf("unexpected %v", t)
+	}
+	return q
+}
+
+func (p *parser) parsePrologue() {
+	for {
+		switch {
+		case p.accept("BASE"):
+			if p.peek().kind != tokIRI {
+				p.errorf("expected IRI, got %v", p.peek())
+			}
+			u, err := url.Parse(string(p.parseIRI()))
+			if err != nil {
+				p.errorf("invalid base IRI: %v", err)
+			}
+			p.base = u
+		case p.accept("PREFIX"):
+			t := p.next()
+			if t.kind != tokPName || !strings.HasSuffix(t.text, ":") || strings.Count(t.text, ":") != 1 {
+				p.pos--
+				p.errorf("expected prefix name, got %v", t)
+			}
+			if p.peek().kind != tokIRI {
+				p.errorf("expected IRI, got %v", p.peek())
+			}
+			p.prefixes[strings.TrimSuffix(t.text, ":")] = string(p.parseIRI())
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parseDataset(q *Query) {
+	for p.accept("FROM") {
+		if p.accept("NAMED") {
+			q.fromNamed = append(q.fromNamed, p.parseIRI())
+		} else {
+			q.from = append(q.from, p.parseIRI())
+		}
+	}
+}
+
+func (p *parser) parseWhere() *group {
+	p.accept("WHERE")
+	return p.parseGroup()
+}
+
+func (p *parser) parseModifiers(q *Query) {
+	if p.peek().is("GROUP") || p.peek().is("HAVING") {
+		p.errorf("%s is not supported", strings.ToUpper(p.peek().text))
+	}
+	if p.accept("ORDER") {
+		p.expect("BY")
+		for {
+			t := p.peek()
+			var c orderCond
+			switch {
+			case t.is("ASC") || t.is("DESC"):
+				p.next()
+				c.desc = t.is("DESC")
+				p.expect("(")
+				c.expr = p.parseExpr()
+				p.expect(")")
+			case t.kind == tokVar || t.is("(") || t.kind == tokIdent || t.kind == tokIRI || t.kind == tokPName:
+				if t.is("LIMIT") || t.is("OFFSET") {
+					break
+				}
+				c.expr = p.parsePrimary()
+			}
+			if c.expr == nil {
+				break
+			}
+			q.orderBy = append(q.orderBy, c)
+		}
+		if len(q.orderBy) == 0 {
+			p.errorf("expected order condition, got %v", p.peek())
+		}
+	}
+	for i := 0; i < 2; i++ {
+		switch {
+		case p.accept("LIMIT"):
+			q.limit = p.parseInt()
+		case p.accept("OFFSET"):
+			q.offset = p.parseInt()
+		}
+	}
+}
+
+func (p *parser) parseInt() int {
+	t := p.next()
+	if t.kind != tokInteger {
+		p.pos--
+		p.errorf("expected integer, got %v", t)
+	}
+	v, err := strconv.Atoi(t.text)
+	if err != nil {
+		p.pos--
+		p.errorf("invalid integer: %v", err)
+	}
+	return v
+}
+
+// parseTemplate parses triples in curly braces, as used by CONSTRUCT.
+func (p *parser) parseTemplate() []triple {
+	p.expect("{")
+	var out []triple
+	if !p.peek().is("}") {
+		out = p.parseTriplesBlock(nil)
+	}
+	p.expect("}")
+	return out
+}
+
+func (p *parser) parseGroup() *group {
+	p.expect("{")
+	g := &group{}
+	for {
+		t := p.peek()
+		switch {
+		case t.is("}"):
+			p.next()
+			return g
+		case t.is("."):
+			p.next()
+		case t.is("{"):
+			sub := p.parseGroup()
+			if !p.peek().is("UNION") {
+				g.elems = append(g.elems, sub)
+				continue
+			}
+			u := &union{groups: []*group{sub}}
+			for p.accept("UNION") {
+				u.groups = append(u.groups, p.parseGroup())
+			}
+			g.elems = append(g.elems, u)
+		case t.is("OPTIONAL"):
+			p.next()
+			g.elems = append(g.elems, &optional{group: p.parseGroup()})
+		case t.is("GRAPH"):
+			p.next()
+			name := p.parseVarOrIRI()
+			g.elems = append(g.elems, &graphPattern{name: name, group: p.parseGroup()})
+		case t.is("FILTER"):
+			p.next()
+			g.filters = append(g.filters, p.parsePrimary())
+		case t.is("SELECT"), t.is("MINUS"), t.is("BIND"), t.is("VALUES"), t.is("SERVICE"):
+			p.errorf("%s is not supported", strings.ToUpper(t.text))
+		case p.isTermStart(t):
+			// triples separated only by filters belong to the same basic graph pattern
+			if n := len(g.elems); n != 0 {
+				if b, ok := g.elems[n-1].(*bgp); ok {
+					b.triples = p.parseTriplesBlock(b.triples)
+					continue
+				}
+			}
+			g.elems = append(g.elems, &bgp{triples: p.parseTriplesBlock(nil)})
+		default:
+			p.errorf("unexpected %v", t)
+		}
+	}
+}
+
+func (p *parser) isTermStart(t token) bool {
+	switch t.kind {
+	case tokVar, tokIRI, tokPName, tokBNode, tokString, tokInteger, tokDecimal, tokDouble:
+		return true
+	case tokIdent:
+		return t.is("true") || t.is("false")
+	case tokPunct:
+		return t.is("[") || t.is("(") || t.is("-") || t.is("+")
+	}
+	return false
+}
+
+func (p *parser) parseTriplesBlock(out []triple) []triple {
+	for {
+		out = p.parseTriplesSameSubject(out)
+		if !p.peek().is(".") {
+			return out
+		}
+		p.next()
+		if !p.isTermStart(p.peek()) {
+			return out
+		}
+	}
+}
+
+func (p *parser) parseTriplesSameSubject(out []triple) []triple {
+	if p.peek().is("[") {
+		var s term
+		s, out = p.parseBlankNodeList(out)
+		if p.peek().is(".") || p.peek().is("}") {
+			return out
+		}
+		return p.parsePropertyList(s, out)
+	}
+	s := p.parseTerm()
+	return p.parsePropertyList(s, out)
+}
+
+// parseBlankNodeList parses an anonymous blank node with an optional list of properties: [ :p :o ].
+func (p *parser) parseBlankNodeList(out []triple) (term, []triple) {
+	p.expect("[")
+	p.bnodes++
+	b := term{Var: "_:" + strconv.Itoa(p.bnodes)}
+	if !p.peek().is("]") {
+		out = p.parsePropertyList(b, out)
+	}
+	p.expect("]")
+	return b, out
+}
+
+func (p *parser) parsePropertyList(s term, out []triple) []triple {
+	for {
+		var verb term
+		if p.accept("a") {
+			verb = term{Val: quad.IRI(rdf.Type).Full()}
+		} else {
+			verb = p.parseVarOrIRI()
+		}
+		for {
+			var o term
+			if p.peek().is("[") {
+				o, out = p.parseBlankNodeList(out)
+			} else {
+				o = p.parseTerm()
+			}
+			out = append(out, triple{S: s, P: verb, O: o})
+			if !p.accept(",") {
+				break
+			}
+		}
+		if !p.accept(";") {
+			return out
+		}
+		for p.accept(";") {
+		}
+		if t := p.peek(); t.is("a") || t.kind == tokVar || t.kind == tokIRI || t.kind == tokPName {
+			continue
+		}
+		return out
+	}
+}
+
+func (p *parser) parseVarOrIRI() term {
+	if t := p.peek(); t.kind == tokVar {
+		p.next()
+		return term{Var: t.text}
+	}
+	return term{Val: p.parseIRI()}
+}
+
+func (p *parser) parseIRI() quad.IRI {
+	t := p.next()
+	switch t.kind {
+	case tokIRI:
+		if p.base == nil {
+			return quad.IRI(t.text)
+		}
+		u, err := url.Parse(t.text)
+		if err != nil {
+			p.pos--
+			p.errorf("invalid IRI: %v", err)
+		}
+		return quad.IRI(p.base.ResolveReference(u).String())
+	case tokPName:
+		i := strings.IndexByte(t.text, ':')
+		pref, local := t.text[:i], t.text[i+1:]
+		if ns, ok := p.prefixes[pref]; ok {
+			return quad.IRI(ns + local)
+		}
+		// fallback to well-known prefixes
+		if full := voc.FullIRI(t.text); full != t.text {
+			return quad.IRI(full)
+		}
+		p.pos--
+		p.errorf("undefined prefix %q", pref)
+	}
+	p.pos--
+	p.errorf("expected IRI, got %v", t)
+	return ""
+}
+
+// parseTerm parses a variable, an IRI, a blank node or a literal.
+func (p *parser) parseTerm() term {
+	t := p.peek()
+	switch t.kind {
+	case tokVar:
+		p.next()
+		return term{Var: t.text}
+	case tokBNode:
+		p.next()
+		return term{Var: "_:" + t.text}
+	case tokIRI, tokPName:
+		return term{Val: p.parseIRI()}
+	}
+	if t.is("(") {
+		p.errorf("collections are not supported")
+	}
+	v := p.parseLiteral()
+	if v == nil {
+		p.errorf("expected term, got %v", t)
+	}
+	return term{Val: v}
+}
+
+// parseLiteral parses a string, a numeric or a boolean literal. It returns nil if the next token is not a literal.
+func (p *parser) parseLiteral() quad.Value {
+	t := p.peek()
+	switch t.kind {
+	case tokString:
+		p.next()
+		if l := p.peek(); l.kind == tokLang {
+			p.next()
+			return quad.LangString{Value: quad.String(t.text), Lang: l.text}
+		}
+		if p.accept("^^") {
+			typ := p.parseIRI()
+			if typ == quad.IRI(xsd.String).Full() {
+				return quad.String(t.text)
+			}
+			return quad.TypedString{Value: quad.String(t.text), Type: typ}
+		}
+		return quad.String(t.text)
+	case tokInteger, tokDecimal, tokDouble:
+		p.next()
+		return numericLiteral(t)
+	case tokIdent:
+		if t.is("true") || t.is("false") {
+			p.next()
+			return quad.TypedString{Value: quad.String(strings.ToLower(t.text)), Type: quad.IRI(xsd.Boolean).Full()}
+		}
+	case tokPunct:
+		if n := p.toks[p.pos+1]; (t.is("-") || t.is("+")) && n.pos == t.pos+1 &&
+			(n.kind == tokInteger || n.kind == tokDecimal || n.kind == tokDouble) {
+			p.pos += 2
+			if t.is("-") {
+				n.text = "-" + n.text
+			}
+			return numericLiteral(n)
+		}
+	}
+	return nil
+}
+
+func numericLiteral(t token) quad.Value {
+	typ := xsd.Integer
+	switch t.kind {
+	case tokDecimal:
+		typ = xsd.Prefix + "decimal"
+	case tokDouble:
+		typ = xsd.Double
+	}
+	return quad.TypedString{Value: quad.String(t.text), Type: quad.IRI(typ).Full()}
+}
+
+func (p *parser) parseExpr() expr {
+	l := p.parseAnd()
+	for p.accept("||") {
+		l = &exprBinary{op: "||", l: l, r: p.parseAnd()}
+	}
+	return l
+}
+
+func (p *parser) parseAnd() expr {
+	l := p.parseRelational()
+	for p.accept("&&") {
+		l = &exprBinary{op: "&&", l: l, r: p.parseRelational()}
+	}
+	return l
+}
+
+func (p *parser) parseRelational() expr {
+	l := p.parseAdditive()
+	t := p.peek()
+	switch {
+	case t.is("=") || t.is("!=") || t.is("<") || t.is(">") || t.is("<=") || t.is(">="):
+		p.next()
+		return &exprBinary{op: t.text, l: l, r: p.parseAdditive()}
+	case t.is("IN"):
+		p.next()
+		return &exprIn{x: l, list: p.parseArgs()}
+	case t.is("NOT") && p.toks[p.pos+1].is("IN"):
+		p.pos += 2
+		return &exprIn{x: l, list: p.parseArgs(), not: true}
+	}
+	return l
+}
+
+func (p *parser) parseAdditive() expr {
+	l := p.parseMultiplicative()
+	for {
+		t := p.peek()
+		if !t.is("+") && !t.is("-") {
+			return l
+		}
+		p.next()
+		l = &exprBinary{op: t.text, l: l, r: p.parseMultiplicative()}
+	}
+}
+
+func (p *parser) parseMultiplicative() expr {
+	l := p.parseUnary()
+	for {
+		t := p.peek()
+		if !t.is("*") && !t.is("/") {
+			return l
+		}
+		p.next()
+		l = &exprBinary{op: t.text, l: l, r: p.parseUnary()}
+	}
+}
+
+func (p *parser) parseUnary() expr {
+	t := p.peek()
+	if t.is("!") || t.is("-") || t.is("+") {
+		p.next()
+		return &exprUnary{op: t.text, x: p.parseUnary()}
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parseArgs() []expr {
+	p.expect("(")
+	var args []expr
+	if p.accept(")") {
+		return args
+	}
+	for {
+		args = append(args, p.parseExpr())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	return args
+}
+
+func (p *parser) parsePrimary() expr {
+	t := p.peek()
+	switch t.kind {
+	case tokVar:
+		p.next()
+		return exprVar(t.text)
+	case tokIRI, tokPName:
+		iri := p.parseIRI()
+		if !p.peek().is("(") {
+			return exprConst{val: iri}
+		}
+		if !casts[iri] {
+			p.errorf("unsupported function %v", iri)
+		}
+		args := p.parseArgs()
+		if len(args) != 1 {
+			p.errorf("cast to %v expects one argument", iri)
+		}
+		return &exprCall{name: string(iri), args: args}
+	case tokIdent:
+		switch {
+		case t.is("EXISTS"):
+			p.next()
+			return &exprExists{group: p.parseGroup()}
+		case t.is("NOT") && p.toks[p.pos+1].is("EXISTS"):
+			p.pos += 2
+			return &exprExists{group: p.parseGroup(), not: true}
+		case t.is("true") || t.is("false"):
+			return exprConst{val: p.parseLiteral()}
+		}
+		name := strings.ToUpper(t.text)
+		arity, ok := builtins[name]
+		if !ok {
+			p.errorf("unsupported function %s", t.text)
+		}
+		p.next()
+		args := p.parseArgs()
+		if len(args) < arity[0] || (arity[1] >= 0 && len(args) > arity[1]) {
+			p.pos--
+			p.errorf("wrong number of arguments for %s", name)
+		}
+		if name == "BOUND" {
+			if _, ok := args[0].(exprVar); !ok {
+				p.pos--
+				p.errorf("BOUND expects a variable")
+			}
+		}
+		return &exprCall{name: name, args: args}
+	case tokPunct:
+		if t.is("(") {
+			p.next()
+			x := p.parseExpr()
+			p.expect(")")
+			return x
+		}
+	}
+	if v := p.parseLiteral(); v != nil {
+		return exprConst{val: v}
+	}
+	p.errorf("expected expression, got %v", t)
+	return nil
+}
@@ -0,0 +1,545 @@
+package sparql
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/quad/csv"
+	"github.com/aperturerobotics/cayley/quad/jsonld"
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+// Result of a SPARQL query.
+type Result struct {
+	Form Form
+	// Vars and Bindings are set for SELECT queries. Unbound variables are not present in the map.
+	Vars     []string
+	Bindings []map[string]quad.Value
+	// Boolean is set for ASK queries.
+	Boolean bool
+	// Quads are set for CONSTRUCT and DESCRIBE queries.
+	Quads []quad.Quad
+}
+
+// Term is an RDF term encoded in SPARQL JSON results format.
+type Term struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Lang     string `json:"xml:lang,omitempty"`
+	Datatype string `json:"datatype,omitempty"`
+}
+
+// TermOf converts a value to the SPARQL JSON results format.
+func TermOf(v quad.Value) Term {
+	switch v := v.(type) {
+	case quad.IRI:
+		return Term{Type: "uri", Value: string(v.Full())}
+	case quad.BNode:
+		return Term{Type: "bnode", Value: string(v)}
+	case quad.String:
+		return Term{Type: "literal", Value: string(v)}
+	case quad.LangString:
+		return Term{Type: "literal", Value: string(v.Value), Lang: v.Lang}
+	}
+	t := Term{Type: "literal", Value: lexical(v)}
+	if dt, ok := datatype(v); ok {
+		t.Datatype = string(dt)
+	}
+	return t
+}
+
+type jsonHead struct {
+	Vars []string `json:"vars,omitempty"`
+}
+
+type jsonBindings struct {
+	Bindings []map[string]Term `json:"bindings"`
+}
+
+type jsonResults struct {
+	Head    jsonHead      `json:"head"`
+	Results *jsonBindings `json:"results,omitempty"`
+	Boolean *bool         `json:"boolean,omitempty"`
+}
+
+// MIME types of SPARQL results formats.
+const (
+	ContentTypeJSON = "application/sparql-results+json"
+	ContentTypeXML  = "application/sparql-results+xml"
+	ContentTypeCSV  = "text/csv"
+	ContentTypeTSV  = "text/tab-separated-values"
+)
+
+// ContentType returns a MIME type used by WriteJSON.
+func (r *Result) ContentType() string {
+	switch r.Form {
+	case Construct, Describe:
+		return "application/ld+json"
+	}
+	return ContentTypeJSON
+}
+
+// WriteJSON writes the result in SPARQL JSON results format. Results of CONSTRUCT and DESCRIBE are written as JSON-LD.
+func (r *Result) WriteJSON(w io.Writer) error {
+	switch r.Form {
+	case Construct, Describe:
+		jw := jsonld.NewWriter(w)
+		if _, err := jw.WriteQuads(context.Background(), r.Quads); err != nil {
+			return err
+		}
+		return jw.Close()
+	}
+	out := jsonResults{Head: jsonHead{Vars: r.Vars}}
+	if r.Form == Ask {
+		out.Boolean = &r.Boolean
+	} else {
+		out.Results = &jsonBindings{Bindings: make([]map[string]Term, 0, len(r.Bindings))}
+		for _, b := range r.Bindings {
+			out.Results.Bindings = append(out.Results.Bindings, termsOf(b))
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(out)
+}
+
+// WriteXML writes the result in SPARQL XML results format. It's not supported for CONSTRUCT and DESCRIBE.
+func (r *Result) WriteXML(w io.Writer) error {
+	if err := r.checkTabular(false); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<sparql xmlns="http://www.w3.org/2005/sparql-results#">` + "\n<head>\n")
+	for _, name := range r.Vars {
+		fmt.Fprintf(bw, "<variable name=\"%s\"/>\n", xmlEscape(name))
+	}
+	bw.WriteString("</head>\n")
+	if r.Form == Ask {
+		fmt.Fprintf(bw, "<boolean>%v</boolean>\n", r.Boolean)
+	} else {
+		bw.WriteString("<results>\n")
+		for _, b := range r.Bindings {
+			bw.WriteString("<result>")
+			for _, name := range r.Vars {
+				v, ok := b[name]
+				if !ok {
+					continue
+				}
+				fmt.Fprintf(bw, "<binding name=\"%s\">", xmlEscape(name))
+				t := TermOf(v)
+				switch {
+				case t.Type == "uri", t.Type == "bnode":
+					fmt.Fprintf(bw, "<%s>%s</%s>", t.Type, xmlEscape(t.Value), t.Type)
+				case t.Lang != "":
+					fmt.Fprintf(bw, "<literal xml:lang=\"%s\">%s</literal>", xmlEscape(t.Lang), xmlEscape(t.Value))
+				case t.Datatype != "":
+					fmt.Fprintf(bw, "<literal datatype=\"%s\">%s</literal>", xmlEscape(t.Datatype), xmlEscape(t.Value))
+				default:
+					fmt.Fprintf(bw, "<literal>%s</literal>", xmlEscape(t.Value))
+				}
+				bw.WriteString("</binding>")
+			}
+			bw.WriteString("</result>\n")
+		}
+		bw.WriteString("</results>\n")
+	}
+	bw.WriteString("</sparql>\n")
+	return bw.Flush()
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// WriteCSV writes solutions of SELECT query in SPARQL CSV results format. Only lexical forms of values are written.
+func (r *Result) WriteCSV(w io.Writer) error {
+	if err := r.checkTabular(true); err != nil {
+		return err
+	}
+	cw := csv.NewResultWriter(w, r.Vars)
+	for _, b := range r.Bindings {
+		if err := cw.WriteResult(b); err != nil {
+			return err
+		}
+	}
+	return cw.Close()
+}
+
+// WriteTSV writes solutions of SELECT query in SPARQL TSV results format. Values are encoded as in Turtle.
+func (r *Result) WriteTSV(w io.Writer) error {
+	if err := r.checkTabular(true); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for i, name := range r.Vars {
+		if i > 0 {
+			bw.WriteByte('\t')
+		}
+		bw.WriteString("?" + name)
+	}
+	bw.WriteByte('\n')
+	for _, b := range r.Bindings {
+		for i, name := range r.Vars {
+			if i > 0 {
+				bw.WriteByte('\t')
+			}
+			if v, ok := b[name]; ok {
+				bw.WriteString(tsvTerm(v))
+			}
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// tsvTerm encodes a value in Turtle syntax. Tabs and newlines are always escaped.
+func tsvTerm(v quad.Value) string {
+	switch v := v.(type) {
+	case quad.IRI:
+		return v.Full().String()
+	case quad.BNode:
+		return v.String()
+	}
+	t := TermOf(v)
+	s := quad.String(t.Value).String()
+	switch {
+	case t.Lang != "":
+		s += "@" + t.Lang
+	case t.Datatype != "":
+		s += "^^" + quad.IRI(t.Datatype).String()
+	}
+	return s
+}
+
+func (r *Result) checkTabular(solutionsOnly bool) error {
+	switch r.Form {
+	case Select:
+		return nil
+	case Ask:
+		if !solutionsOnly {
+			return nil
+		}
+	}
+	return fmt.Errorf("format is not supported for %v queries", r.Form)
+}
+
+func termsOf(b map[string]quad.Value) map[string]Term {
+	m := make(map[string]Term, len(b))
+	for k, v := range b {
+		m[k] = TermOf(v)
+	}
+	return m
+}
+
+// Execute runs the query on a quad store. All results are collected in memory.
+func (q *Query) Execute(ctx context.Context, qs graph.QuadStore) (*Result, error) {
+	e := newEngine(qs, q)
+	it, err := e.solutions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	res := &Result{Form: q.Form}
+	switch q.Form {
+	case Ask:
+		res.Boolean = it.Next(ctx)
+	case Select:
+		res.Vars = e.projection()
+		for it.Next(ctx) {
+			res.Bindings = append(res.Bindings, it.Binding())
+		}
+	case Construct:
+		c := construct(q.template)
+		for it.Next(ctx) {
+			res.Quads = c.next(res.Quads, it.Binding())
+		}
+	case Describe:
+		rows, err := collect(ctx, it)
+		if err != nil {
+			return nil, err
+		}
+		if res.Quads, err = e.describe(ctx, rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = it.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// projection returns variables of SELECT results.
+func (e *engine) projection() []string {
+	if e.q.vars != nil {
+		return e.q.vars
+	}
+	return e.q.where.vars(nil, make(map[string]bool))
+}
+
+// solutions evaluates the pattern of the query and applies solution modifiers.
+//
+// If the pattern compiles to a single shape (see compileGroup), its solutions are streamed. ORDER BY on variables
+// is then compiled to shape.Sort, and OFFSET and LIMIT to shape.Page, unless DISTINCT is set. Otherwise, solutions
+// are evaluated and ordered in memory.
+func (e *engine) solutions(ctx context.Context) (solutionIterator, error) {
+	q := e.q
+	mod := &modifiers{skip: q.offset, left: q.limit}
+	if q.Form == Ask {
+		mod.left = 1
+	} else if q.Form == Select {
+		mod.vars, mod.project = e.projection(), true
+		if q.distinct {
+			mod.seen = make(map[string]struct{})
+		}
+	}
+	if mod.left == 0 {
+		mod.src = &sliceSolutions{}
+		return mod, nil
+	}
+	s, ok := e.compileGroup(ctx, q.where, nil, nil)
+	if !ok {
+		rows, err := e.evalGroup(ctx, q.where, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = e.order(ctx, rows); err != nil {
+			return nil, err
+		}
+		mod.src = &sliceSolutions{rows: rows}
+		return mod, nil
+	}
+	keys, sorted := sortKeys(q.orderBy)
+	if sorted {
+		s = shape.Sort{From: s, By: keys}
+	}
+	if (sorted || len(q.orderBy) == 0) && mod.seen == nil && (mod.skip > 0 || mod.left > 0) {
+		// Skip counts results of the iterator rather than paths, thus it's only exact if results are sorted
+		// by tags: each of them has a single path. Otherwise, solutions are skipped after the iterator.
+		page := shape.Page{From: s}
+		if sorted {
+			page.Skip, mod.skip = int64(mod.skip), 0
+		}
+		if mod.left > 0 {
+			page.Limit = int64(mod.skip + mod.left)
+		}
+		s = page
+	}
+	src, err := e.iterate(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if !sorted && len(q.orderBy) != 0 {
+		rows, err := collect(ctx, src)
+		src.Close()
+		if err == nil {
+			err = e.order(ctx, rows)
+		}
+		if err != nil {
+			return nil, err
+		}
+		src = &sliceSolutions{rows: rows}
+	}
+	mod.src = src
+	return mod, nil
+}
+
+// sortKeys converts ORDER BY conditions to sort keys of shape.Sort. It returns false if any of the conditions
+// is not a variable.
+func sortKeys(conds []orderCond) ([]iterator.SortKey, bool) {
+	if len(conds) == 0 {
+		return nil, false
+	}
+	keys := make([]iterator.SortKey, 0, len(conds))
+	for _, c := range conds {
+		v, ok := c.expr.(exprVar)
+		if !ok {
+			return nil, false
+		}
+		keys = append(keys, iterator.SortKey{Tag: string(v), Desc: c.desc})
+	}
+	return keys, true
+}
+
+// modifiers applies projection, DISTINCT, OFFSET and LIMIT to ordered solutions.
+type modifiers struct {
+	src     solutionIterator
+	project bool
+	vars    []string
+	seen    map[string]struct{} // set for DISTINCT
+	skip    int
+	left    int // -1 if unlimited
+	cur     binding
+}
+
+func (it *modifiers) Next(ctx context.Context) bool {
+	for it.left != 0 && it.src.Next(ctx) {
+		b := it.src.Binding()
+		if it.project {
+			p := make(binding, len(it.vars))
+			for _, name := range it.vars {
+				if v, ok := b[name]; ok {
+					p[name] = v
+				}
+			}
+			b = p
+		}
+		if it.seen != nil {
+			key := hashKey(b, it.vars)
+			if _, ok := it.seen[key]; ok {
+				continue
+			}
+			it.seen[key] = struct{}{}
+		}
+		if it.skip > 0 {
+			it.skip--
+			continue
+		}
+		if it.left > 0 {
+			it.left--
+		}
+		it.cur = b
+		return true
+	}
+	it.cur = nil
+	return false
+}
+
+func (it *modifiers) Binding() binding { return it.cur }
+func (it *modifiers) Err() error       { return it.src.Err() }
+func (it *modifiers) Close() error     { return it.src.Close() }
+
+func (e *engine) order(ctx context.Context, rows []binding) error {
+	if len(e.q.orderBy) == 0 {
+		return nil
+	}
+	type row struct {
+		b    binding
+		keys []quad.Value
+	}
+	// evaluate expressions once, errors leave the value unbound
+	arr := make([]row, len(rows))
+	for i, r := range rows {
+		keys := make([]quad.Value, len(e.q.orderBy))
+		for j, c := range e.q.orderBy {
+			v, err := e.eval(ctx, c.expr, r)
+			if err != nil && err != errType {
+				return err
+			}
+			keys[j] = v
+		}
+		arr[i] = row{b: r, keys: keys}
+	}
+	sort.SliceStable(arr, func(i, j int) bool {
+		for k, c := range e.q.orderBy {
+			d := orderCompare(arr[i].keys[k], arr[j].keys[k])
+			if c.desc {
+				d = -d
+			}
+			if d != 0 {
+				return d < 0
+			}
+		}
+		return false
+	})
+	for i := range arr {
+		rows[i] = arr[i].b
+	}
+	return nil
+}
+
+// vars returns variables in the order of their appearance in the pattern. Blank nodes are not included.
+func (g *group) vars(out []string, seen map[string]bool) []string {
+	add := func(t term) {
+		if t.isVar() && !strings.HasPrefix(t.Var, "_:") && !seen[t.Var] {
+			seen[t.Var] = true
+			out = append(out, t.Var)
+		}
+	}
+	for _, el := range g.elems {
+		switch el := el.(type) {
+		case *bgp:
+			for _, tr := range el.triples {
+				add(tr.S)
+				add(tr.P)
+				add(tr.O)
+			}
+		case *group:
+			out = el.vars(out, seen)
+		case *optional:
+			out = el.group.vars(out, seen)
+		case *graphPattern:
+			add(el.name)
+			out = el.group.vars(out, seen)
+		case *union:
+			for _, sub := range el.groups {
+				out = sub.vars(out, seen)
+			}
+		}
+	}
+	return out
+}
+
+// construct returns an instantiator of the CONSTRUCT template.
+func construct(template []triple) *instantiator {
+	tmpl := make([]quadPattern, 0, len(template))
+	for _, tr := range template {
+		tmpl = append(tmpl, quadPattern{triple: tr})
+	}
+	return newInstantiator(tmpl, nil, func(i int, label string) quad.Value {
+		// blank nodes in the template are fresh for each solution
+		return quad.BNode("b" + strconv.Itoa(i) + "_" + label)
+	})
+}
+
+// describe returns all quads with described resources as a subject.
+func (e *engine) describe(ctx context.Context, rows []binding) ([]quad.Quad, error) {
+	var nodes []quad.Value
+	seen := make(map[string]bool)
+	add := func(v quad.Value) {
+		if v == nil || isLiteral(v) {
+			return
+		}
+		if key := quad.StringOf(v); !seen[key] {
+			seen[key] = true
+			nodes = append(nodes, v)
+		}
+	}
+	targets := e.q.describe
+	if targets == nil {
+		// DESCRIBE *
+		for _, name := range e.q.where.vars(nil, make(map[string]bool)) {
+			targets = append(targets, term{Var: name})
+		}
+	}
+	for _, t := range targets {
+		if !t.isVar() {
+			add(t.Val)
+			continue
+		}
+		for _, r := range rows {
+			add(r[t.Var])
+		}
+	}
+	var out []quad.Quad
+	for _, v := range nodes {
+		quads, err := findQuads(ctx, e.qs, shape.Quads{{Dir: quad.Subject, Values: lookupValues(v)}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, quads...)
+	}
+	return out, nil
+}
@@ -0,0 +1,228 @@
+// Package sparql implements a subset of SPARQL 1.1 query language.
+//
+// Supported query forms are SELECT, ASK, CONSTRUCT and DESCRIBE with basic graph patterns,
+// OPTIONAL, UNION, FILTER, GRAPH, ORDER BY, LIMIT and OFFSET.
+//
+// Patterns made of a connected basic graph pattern, UNION and GRAPH, with filters on single variables, are compiled
+// to a single query/shape tree together with ORDER BY on variables, OFFSET and LIMIT. Quad store optimizations apply
+// to them and solutions are streamed. Other patterns are evaluated by joining solutions of basic graph patterns
+// in memory. Patterns outside of GRAPH match quads in any graph, unless FROM is specified.
+//
+// Updates support INSERT DATA, DELETE DATA, DELETE WHERE, DELETE/INSERT with WITH and USING clauses,
+// CLEAR, DROP and CREATE. Graphs are mapped to quad labels, and the default graph consists of quads without a label.
+package sparql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query"
+)
+
+const Name = "sparql"
+
+func init() {
+	query.RegisterLanguage(query.Language{
+		Name: Name,
+		Session: func(qs graph.QuadStore) query.Session {
+			return NewSession(qs)
+		},
+		HTTPQuery: httpQuery,
+		HTTPError: httpError,
+	})
+}
+
+type Session struct {
+	qs graph.QuadStore
+}
+
+func NewSession(qs graph.QuadStore) *Session {
+	return &Session{qs: qs}
+}
+
+// Execute runs the query. Results of SELECT are returned as one value per solution, ASK returns a single boolean,
+// CONSTRUCT and DESCRIBE return one quad per result. Solutions are streamed, see Query.Execute for details.
+func (s *Session) Execute(ctx context.Context, qu string, opt query.Options) (query.Iterator, error) {
+	switch opt.Collation {
+	case query.Raw, query.REPL, query.JSON:
+	default:
+		return nil, &query.ErrUnsupportedCollation{Collation: opt.Collation}
+	}
+	q, err := Parse(qu)
+	if err != nil {
+		return nil, err
+	}
+	e := newEngine(s.qs, q)
+	it, err := e.solutions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &results{e: e, it: it, col: opt.Collation, left: -1}
+	if opt.Limit > 0 {
+		res.left = opt.Limit
+	}
+	if q.Form == Construct {
+		res.tmpl = construct(q.template)
+	}
+	return res, nil
+}
+
+func collateBinding(b map[string]quad.Value, col query.Collation) any {
+	switch col {
+	case query.JSON:
+		return termsOf(b)
+	case query.REPL:
+		keys := make([]string, 0, len(b))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var out strings.Builder
+		out.WriteString("****\n")
+		for _, k := range keys {
+			fmt.Fprintf(&out, "?%s : %s\n", k, b[k])
+		}
+		return out.String()
+	}
+	return b
+}
+
+// results converts solutions of the query to results in a given collation.
+type results struct {
+	e    *engine
+	it   solutionIterator
+	col  query.Collation
+	tmpl *instantiator // set for CONSTRUCT
+	left int           // -1 if unlimited
+	done bool          // all solutions were read
+	buf  []any         // pending results of the last solution
+	cur  any
+	err  error
+}
+
+func (it *results) Next(ctx context.Context) bool {
+	it.cur = nil
+	if it.left == 0 {
+		return false
+	}
+	for len(it.buf) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.err = it.fill(ctx)
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	if it.left > 0 {
+		it.left--
+	}
+	return true
+}
+
+// fill adds results of the next solution to the buffer.
+func (it *results) fill(ctx context.Context) error {
+	switch it.e.q.Form {
+	case Ask:
+		it.done = true
+		ok := it.it.Next(ctx)
+		if err := it.it.Err(); err != nil {
+			return err
+		}
+		if it.col == query.REPL {
+			it.buf = append(it.buf, fmt.Sprint(ok))
+		} else {
+			it.buf = append(it.buf, ok)
+		}
+		return nil
+	case Describe:
+		// described resources are deduplicated, thus all solutions are read at once
+		it.done = true
+		rows, err := collect(ctx, it.it)
+		if err != nil {
+			return err
+		}
+		quads, err := it.e.describe(ctx, rows)
+		if err != nil {
+			return err
+		}
+		for _, q := range quads {
+			it.buf = append(it.buf, it.collateQuad(q))
+		}
+		return nil
+	}
+	if !it.it.Next(ctx) {
+		it.done = true
+		return it.it.Err()
+	}
+	b := it.it.Binding()
+	if it.tmpl == nil {
+		it.buf = append(it.buf, collateBinding(b, it.col))
+		return nil
+	}
+	for _, q := range it.tmpl.next(nil, b) {
+		it.buf = append(it.buf, it.collateQuad(q))
+	}
+	return nil
+}
+
+func (it *results) collateQuad(q quad.Quad) any {
+	if it.col == query.REPL {
+		return q.NQuad()
+	}
+	return q
+}
+
+func (it *results) Result(ctx context.Context) (any, error) {
+	if it.cur == nil {
+		return nil, errors.New("sparql: no result")
+	}
+	return it.cur, nil
+}
+
+func (it *results) Err() error {
+	return it.err
+}
+
+func (it *results) Close() error {
+	return it.it.Close()
+}
+
+const maxQuerySize = 1024 * 1024 // 1 MB
+
+func httpError(w query.ResponseWriter, err error) {
+	data, _ := json.Marshal(err.Error())
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`{"error": `))
+	w.Write(data)
+	w.Write([]byte("}\n"))
+}
+
+// httpQuery responds with results in SPARQL JSON results format.
+func httpQuery(ctx context.Context, qs graph.QuadStore, w query.ResponseWriter, r io.Reader) {
+	data, err := io.ReadAll(io.LimitReader(r, maxQuerySize))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	q, err := Parse(string(data))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	res, err := q.Execute(ctx, qs)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if hw, ok := w.(interface{ Header() http.Header }); ok {
+		hw.Header().Set("Content-Type", res.ContentType())
+	}
+	res.WriteJSON(w)
+}
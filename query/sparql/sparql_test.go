@@ -0,0 +1,444 @@
+package sparql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/graphtest/testutil"
+	"github.com/aperturerobotics/cayley/graph/memstore"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query"
+)
+
+func makeTestStore(t testing.TB) graph.QuadStore {
+	qs := memstore.New()
+	qw := testutil.MakeWriter(t, qs, nil)
+	quads := testutil.LoadGraph(t, "../../data/testdata.nq")
+	quads = append(quads,
+		quad.Make(quad.IRI("alice"), quad.IRI("age"), quad.TypedString{Value: "30", Type: xsdInteger}, nil),
+		quad.Make(quad.IRI("bob"), quad.IRI("age"), quad.Int(25), nil),
+		quad.Make(quad.IRI("fred"), quad.IRI("name"), quad.LangString{Value: "Fred", Lang: "en"}, nil),
+		quad.Make(quad.IRI("greg"), quad.IRI("name"), quad.String("Greg"), nil),
+	)
+	err := qw.AddQuadSet(context.Background(), quads)
+	require.NoError(t, err)
+	return qs
+}
+
+// solutions formats solutions as strings, sorting them unless the order is significant.
+func solutions(res *Result, ordered bool) []string {
+	out := make([]string, 0, len(res.Bindings))
+	for _, b := range res.Bindings {
+		var parts []string
+		for _, name := range res.Vars {
+			if v, ok := b[name]; ok {
+				parts = append(parts, name+"="+quad.StringOf(v))
+			}
+		}
+		out = append(out, strings.Join(parts, " "))
+	}
+	if !ordered {
+		sort.Strings(out)
+	}
+	return out
+}
+
+var casesSelect = []struct {
+	name    string
+	query   string
+	ordered bool
+	expect  []string
+}{
+	{
+		name:   "pattern",
+		query:  `SELECT ?x WHERE { ?x <follows> <bob> }`,
+		expect: []string{"x=<alice>", "x=<charlie>", "x=<dani>"},
+	},
+	{
+		name:  "join",
+		query: `SELECT * WHERE { ?x <follows> ?y . ?y <status> "cool_person" }`,
+		expect: []string{
+			"x=<alice> y=<bob>",
+			"x=<charlie> y=<bob>",
+			"x=<charlie> y=<dani>",
+			"x=<dani> y=<bob>",
+			"x=<dani> y=<greg>",
+			"x=<fred> y=<greg>",
+		},
+	},
+	{
+		name:   "cycle",
+		query:  `SELECT ?x ?y ?z WHERE { ?x <follows> ?y . ?y <follows> ?z . ?x <follows> ?z }`,
+		expect: []string{"x=<charlie> y=<dani> z=<bob>"},
+	},
+	{
+		name:   "predicate variable",
+		query:  `SELECT ?p WHERE { <predicates> <are> ?p . <alice> ?p ?o }`,
+		expect: []string{"p=<follows>"},
+	},
+	{
+		name:   "disconnected",
+		query:  `SELECT ?x ?y WHERE { ?x <follows> <fred> . <charlie> <follows> ?y }`,
+		expect: []string{"x=<bob> y=<bob>", "x=<bob> y=<dani>", "x=<emily> y=<bob>", "x=<emily> y=<dani>"},
+	},
+	{
+		name:   "optional",
+		query:  `SELECT ?x ?s WHERE { ?x <follows> <greg> OPTIONAL { ?x <status> ?s } }`,
+		expect: []string{`x=<dani> s="cool_person"`, "x=<fred>"},
+	},
+	{
+		name:   "optional filter",
+		query:  `SELECT ?x ?a WHERE { ?x <follows> <bob> OPTIONAL { ?x <age> ?a FILTER(?a > 26) } }`,
+		expect: []string{`x=<alice> a="30"^^<http://www.w3.org/2001/XMLSchema#integer>`, "x=<charlie>", "x=<dani>"},
+	},
+	{
+		name:   "filter numbers",
+		query:  `SELECT ?x WHERE { ?x <age> ?a FILTER(?a >= 25 && ?a < 30) }`,
+		expect: []string{"x=<bob>"},
+	},
+	{
+		name:   "filter regex",
+		query:  `SELECT ?x WHERE { ?x <status> ?s FILTER regex(?s, "^SMART", "i") }`,
+		expect: []string{"x=<emily>", "x=<greg>"},
+	},
+	{
+		name:   "filter lang",
+		query:  `SELECT ?x WHERE { ?x <name> ?n FILTER(lang(?n) = "en") }`,
+		expect: []string{"x=<fred>"},
+	},
+	{
+		name:   "filter not exists",
+		query:  `SELECT ?x WHERE { ?x <follows> <bob> FILTER NOT EXISTS { ?x <status> ?s } }`,
+		expect: []string{"x=<alice>", "x=<charlie>"},
+	},
+	{
+		name:   "filter in",
+		query:  `SELECT ?x WHERE { ?x <follows> ?y FILTER(?y IN (<fred>, <dani>)) }`,
+		expect: []string{"x=<bob>", "x=<charlie>", "x=<emily>"},
+	},
+	{
+		name:   "union",
+		query:  `SELECT ?x WHERE { { ?x <follows> <fred> } UNION { ?x <follows> <greg> } }`,
+		expect: []string{"x=<bob>", "x=<dani>", "x=<emily>", "x=<fred>"},
+	},
+	{
+		name:   "graph variable",
+		query:  `SELECT ?x ?g WHERE { GRAPH ?g { ?x <status> "smart_person" } }`,
+		expect: []string{"x=<emily> g=<smart_graph>", "x=<greg> g=<smart_graph>"},
+	},
+	{
+		name:   "graph",
+		query:  `SELECT ?x WHERE { GRAPH <smart_graph> { ?x <status> ?s } }`,
+		expect: []string{"x=<emily>", "x=<greg>"},
+	},
+	{
+		name:   "from",
+		query:  `SELECT ?x FROM <smart_graph> WHERE { ?x <status> ?s }`,
+		expect: []string{"x=<emily>", "x=<greg>"},
+	},
+	{
+		name:    "order limit offset",
+		query:   `SELECT DISTINCT ?x WHERE { ?x <follows> ?y } ORDER BY DESC(?x) LIMIT 2 OFFSET 1`,
+		ordered: true,
+		expect:  []string{"x=<emily>", "x=<dani>"},
+	},
+	{
+		name:    "order typed",
+		query:   `SELECT ?x WHERE { ?x <age> ?a } ORDER BY ?a`,
+		ordered: true,
+		expect:  []string{"x=<bob>", "x=<alice>"},
+	},
+	{
+		name:    "order limit offset compiled",
+		query:   `SELECT ?x ?y WHERE { ?x <follows> ?y } ORDER BY ?x DESC(?y) LIMIT 3 OFFSET 2`,
+		ordered: true,
+		expect:  []string{"x=<charlie> y=<dani>", "x=<charlie> y=<bob>", "x=<dani> y=<greg>"},
+	},
+	{
+		name:   "union filter",
+		query:  `SELECT ?x WHERE { { ?x <follows> <fred> } UNION { ?x <follows> <greg> } FILTER(?x != <dani>) }`,
+		expect: []string{"x=<bob>", "x=<emily>", "x=<fred>"},
+	},
+	{
+		name:   "blank nodes and prefixes",
+		query:  `PREFIX : <> SELECT ?y WHERE { :charlie :follows [ :status "cool_person" ; :follows ?y ] }`,
+		expect: []string{"y=<bob>", "y=<fred>", "y=<greg>"},
+	},
+	{
+		name:   "typed literal",
+		query:  `SELECT ?x WHERE { ?x <age> 25 }`,
+		expect: []string{"x=<bob>"},
+	},
+	{
+		name:   "no results",
+		query:  `SELECT ?x WHERE { ?x <follows> <nobody> }`,
+		expect: []string{},
+	},
+}
+
+func TestSelect(t *testing.T) {
+	qs := makeTestStore(t)
+	ctx := context.Background()
+	for _, c := range casesSelect {
+		t.Run(c.name, func(t *testing.T) {
+			q, err := Parse(c.query)
+			require.NoError(t, err)
+			res, err := q.Execute(ctx, qs)
+			require.NoError(t, err)
+			require.Equal(t, c.expect, solutions(res, c.ordered))
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	qs := makeTestStore(t)
+	ctx := context.Background()
+	for qu, exp := range map[string]bool{
+		`SELECT ?x WHERE { ?x <follows> ?y . ?y <status> ?s FILTER(?s != "cool_person") }`:  true,
+		`SELECT ?x WHERE { { ?x <follows> <fred> } UNION { GRAPH ?g { ?x <status> ?s } } }`: true,
+		`SELECT ?x WHERE { ?x <follows> <fred> . <charlie> <follows> ?y }`:                  false,
+		`SELECT ?x WHERE { ?x <follows> ?y . ?y <follows> ?x }`:                             false,
+		`SELECT ?x WHERE { ?x <follows> ?y FILTER(?x != ?y) }`:                              false,
+		`SELECT ?x WHERE { ?x <follows> ?y OPTIONAL { ?y <status> ?s } }`:                   false,
+	} {
+		q, err := Parse(qu)
+		require.NoError(t, err)
+		_, ok := newEngine(qs, q).compileGroup(ctx, q.where, nil, nil)
+		require.Equal(t, exp, ok, qu)
+	}
+}
+
+func TestPages(t *testing.T) {
+	qs := makeTestStore(t)
+	ctx := context.Background()
+	q, err := Parse(`SELECT ?x ?y WHERE { ?x <follows> ?y }`)
+	require.NoError(t, err)
+	res, err := q.Execute(ctx, qs)
+	require.NoError(t, err)
+	all := solutions(res, false)
+
+	// solutions are not sorted, thus OFFSET is applied after the iterator
+	var got []string
+	for off := 0; off < len(all); off += 3 {
+		q, err := Parse(fmt.Sprintf(`SELECT ?x ?y WHERE { ?x <follows> ?y } LIMIT 3 OFFSET %d`, off))
+		require.NoError(t, err)
+		res, err := q.Execute(ctx, qs)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(res.Bindings), 3)
+		got = append(got, solutions(res, true)...)
+	}
+	sort.Strings(got)
+	require.Equal(t, all, got)
+}
+
+func TestAsk(t *testing.T) {
+	qs := makeTestStore(t)
+	ctx := context.Background()
+	for qu, exp := range map[string]bool{
+		`ASK { <alice> <follows> <bob> }`:  true,
+		`ASK { <alice> <follows> <greg> }`: false,
+	} {
+		q, err := Parse(qu)
+		require.NoError(t, err)
+		res, err := q.Execute(ctx, qs)
+		require.NoError(t, err)
+		require.Equal(t, exp, res.Boolean, qu)
+	}
+}
+
+func TestConstructDescribe(t *testing.T) {
+	qs := makeTestStore(t)
+	ctx := context.Background()
+
+	q, err := Parse(`CONSTRUCT { <fred> <followedBy> ?x } WHERE { ?x <follows> <fred> } ORDER BY ?x`)
+	require.NoError(t, err)
+	res, err := q.Execute(ctx, qs)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Quad{
+		quad.MakeIRI("fred", "followedBy", "bob", ""),
+		quad.MakeIRI("fred", "followedBy", "emily", ""),
+	}, res.Quads)
+
+	q, err = Parse(`DESCRIBE <greg>`)
+	require.NoError(t, err)
+	res, err = q.Execute(ctx, qs)
+	require.NoError(t, err)
+	var got []string
+	for _, q := range res.Quads {
+		got = append(got, q.NQuad())
+	}
+	sort.Strings(got)
+	require.Equal(t, []string{
+		`<greg> <name> "Greg" .`,
+		`<greg> <status> "cool_person" .`,
+		`<greg> <status> "smart_person" <smart_graph> .`,
+	}, got)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, qu := range []string{
+		`SELECT WHERE { ?x ?y ?z }`,
+		`SELECT ?x WHERE { ?x ?y }`,
+		`SELECT ?x WHERE { ?x foo:bar ?z }`,
+		`SELECT ?x WHERE { ?x <p> ?z } LIMIT x`,
+		`SELECT ?x WHERE { ?x <p> "unterminated }`,
+		`SELECT ?x WHERE { ?x <p> ?z FILTER(unknown(?z)) }`,
+	} {
+		_, err := Parse(qu)
+		require.Error(t, err, qu)
+		require.IsType(t, &ParseError{}, err, qu)
+	}
+}
+
+func TestSession(t *testing.T) {
+	qs := makeTestStore(t)
+	ctx := context.Background()
+	it, err := query.Execute(ctx, qs, Name, `SELECT ?x WHERE { <alice> <follows> ?x }`, query.Options{Collation: query.JSON})
+	require.NoError(t, err)
+	defer it.Close()
+	require.True(t, it.Next(ctx))
+	res, err := it.Result(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]Term{"x": {Type: "uri", Value: "bob"}}, res)
+	require.False(t, it.Next(ctx))
+	require.NoError(t, it.Err())
+}
+
+func TestHTTPQuery(t *testing.T) {
+	qs := makeTestStore(t)
+	ctx := context.Background()
+
+	w := httptest.NewRecorder()
+	httpQuery(ctx, qs, w, strings.NewReader(`SELECT ?x ?a WHERE { ?x <age> ?a } ORDER BY ?x`))
+	require.Equal(t, "application/sparql-results+json", w.Header().Get("Content-Type"))
+	var out struct {
+		Head struct {
+			Vars []string `json:"vars"`
+		} `json:"head"`
+		Results struct {
+			Bindings []map[string]Term `json:"bindings"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	require.Equal(t, []string{"x", "a"}, out.Head.Vars)
+	require.Equal(t, []map[string]Term{
+		{
+			"x": {Type: "uri", Value: "alice"},
+			"a": {Type: "literal", Value: "30", Datatype: string(xsdInteger)},
+		},
+		{
+			"x": {Type: "uri", Value: "bob"},
+			"a": {Type: "literal", Value: "25", Datatype: string(xsdInteger)},
+		},
+	}, out.Results.Bindings)
+
+	w = httptest.NewRecorder()
+	httpQuery(ctx, qs, w, strings.NewReader(`ASK { <bob> <follows> <fred> }`))
+	require.JSONEq(t, `{"head":{},"boolean":true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	httpQuery(ctx, qs, w, strings.NewReader(`SELECT`))
+	require.Equal(t, 400, w.Code)
+}
+
+func TestUpdate(t *testing.T) {
+	qs := makeTestStore(t)
+	qw := testutil.MakeWriter(t, qs, nil)
+	ctx := context.Background()
+
+	ask := func(qu string) bool {
+		q, err := Parse(qu)
+		require.NoError(t, err)
+		res, err := q.Execute(ctx, qs)
+		require.NoError(t, err)
+		return res.Boolean
+	}
+	update := func(qu string) error {
+		u, err := ParseUpdate(qu)
+		require.NoError(t, err)
+		return u.Execute(ctx, qs, qw)
+	}
+
+	require.NoError(t, update(`INSERT DATA { <alice> <follows> <fred> . GRAPH <g> { <alice> <likes> _:x . _:x <name> "X" } }`))
+	require.True(t, ask(`ASK { <alice> <follows> <fred> }`))
+	require.True(t, ask(`ASK { GRAPH <g> { <alice> <likes> ?x . ?x <name> "X" } }`))
+
+	// inserting existing quads is not an error
+	require.NoError(t, update(`INSERT DATA { <alice> <follows> <fred> }`))
+	require.NoError(t, update(`DELETE DATA { <alice> <follows> <fred> } ; DELETE DATA { <alice> <follows> <nobody> }`))
+	require.False(t, ask(`ASK { <alice> <follows> <fred> }`))
+
+	// only quads of the default graph are updated
+	require.NoError(t, update(`DELETE { ?x <status> "cool_person" } INSERT { ?x <status> "cool" } WHERE { ?x <status> "cool_person" }`))
+	require.False(t, ask(`ASK { ?x <status> "cool_person" }`))
+	require.True(t, ask(`ASK { <greg> <status> "cool" . GRAPH <smart_graph> { <greg> <status> "smart_person" } }`))
+
+	require.NoError(t, update(`WITH <smart_graph> DELETE { ?x <status> ?s } WHERE { ?x <status> "smart_person" ; <status> ?s }`))
+	require.False(t, ask(`ASK { GRAPH <smart_graph> { ?x ?p ?o } }`))
+	require.True(t, ask(`ASK { <greg> <status> "cool" }`))
+
+	// values are matched regardless of their representation
+	require.NoError(t, update(`DELETE WHERE { ?x <age> ?a }`))
+	require.False(t, ask(`ASK { ?x <age> ?a }`))
+
+	require.Error(t, update(`DROP GRAPH <nothing>`))
+	require.NoError(t, update(`DROP SILENT GRAPH <nothing>`))
+	require.NoError(t, update(`CLEAR GRAPH <g>`))
+	require.False(t, ask(`ASK { GRAPH <g> { ?s ?p ?o } }`))
+	require.NoError(t, update(`CLEAR DEFAULT`))
+	require.False(t, ask(`ASK { ?s ?p ?o }`))
+}
+
+func TestUpdateParseErrors(t *testing.T) {
+	for _, qu := range []string{
+		`INSERT DATA { ?x <p> <o> }`,
+		`DELETE DATA { _:b <p> <o> }`,
+		`DELETE { ?x <p> _:b } WHERE { ?x <p> ?o }`,
+		`INSERT { ?x <p> <o> }`,
+		`LOAD <http://example.com/data.nq>`,
+		`INSERT DATA { <s> <p> <o> } DELETE DATA { <s> <p> <o> }`,
+	} {
+		_, err := ParseUpdate(qu)
+		require.Error(t, err, qu)
+		require.IsType(t, &ParseError{}, err, qu)
+	}
+}
+
+func TestResultFormats(t *testing.T) {
+	res := &Result{
+		Form: Select,
+		Vars: []string{"x", "n"},
+		Bindings: []map[string]quad.Value{
+			{"x": quad.IRI("http://example.com/a"), "n": quad.LangString{Value: "a,\tb", Lang: "en"}},
+			{"x": quad.BNode("b1"), "n": quad.Int(5)},
+			{"x": quad.IRI("http://example.com/c")},
+		},
+	}
+	var buf strings.Builder
+	require.NoError(t, res.WriteCSV(&buf))
+	require.Equal(t, "x,n\r\nhttp://example.com/a,\"a,\tb\"\r\n_:b1,5\r\nhttp://example.com/c,\r\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, res.WriteTSV(&buf))
+	require.Equal(t, "?x\t?n\n<http://example.com/a>\t\"a,\\tb\"@en\n_:b1\t\"5\"^^<http://www.w3.org/2001/XMLSchema#integer>\n<http://example.com/c>\t\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, res.WriteXML(&buf))
+	require.Contains(t, buf.String(), `<head>`+"\n"+`<variable name="x"/>`+"\n"+`<variable name="n"/>`)
+	require.Contains(t, buf.String(), `<result><binding name="x"><uri>http://example.com/a</uri></binding><binding name="n"><literal xml:lang="en">a,&#x9;b</literal></binding></result>`)
+	require.Contains(t, buf.String(), `<binding name="x"><bnode>b1</bnode></binding>`)
+
+	res = &Result{Form: Ask, Boolean: true}
+	buf.Reset()
+	require.NoError(t, res.WriteXML(&buf))
+	require.Contains(t, buf.String(), "<boolean>true</boolean>")
+	require.Error(t, res.WriteCSV(&buf))
+}
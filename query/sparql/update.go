@@ -0,0 +1,424 @@
+package sparql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/iterator"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+func (p *parser) parseUpdate() *Update {
+	u := &Update{}
+	for {
+		p.parsePrologue()
+		if p.peek().kind == tokEOF {
+			break
+		}
+		if op := p.parseUpdateOp(); op != nil {
+			u.ops = append(u.ops, op)
+		}
+		if !p.accept(";") {
+			break
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		p.errorf("unexpected %v", t)
+	}
+	return u
+}
+
+// parseUpdateOp parses a single update operation. It returns nil for operations that have no effect.
+func (p *parser) parseUpdateOp() updateOp {
+	t := p.next()
+	switch {
+	case t.is("INSERT") && p.accept("DATA"):
+		ins := p.parseQuads()
+		p.checkTemplate(ins, "INSERT DATA", true, false)
+		return &modify{ins: ins}
+	case t.is("DELETE") && p.accept("DATA"):
+		del := p.parseQuads()
+		p.checkTemplate(del, "DELETE DATA", false, false)
+		return &modify{del: del}
+	case t.is("DELETE") && p.accept("WHERE"):
+		del := p.parseQuads()
+		p.checkTemplate(del, "DELETE WHERE", false, true)
+		return &modify{del: del, where: quadsGroup(del)}
+	case t.is("WITH") || t.is("DELETE") || t.is("INSERT"):
+		p.pos--
+		return p.parseModify()
+	case t.is("CLEAR") || t.is("DROP"):
+		op := &clearGraph{silent: p.accept("SILENT")}
+		switch {
+		case p.accept("DEFAULT"):
+			op.target = targetDefault
+		case p.accept("NAMED"):
+			op.target = targetNamed
+		case p.accept("ALL"):
+			op.target = targetAll
+		default:
+			p.expect("GRAPH")
+			op.graph = p.parseIRI()
+		}
+		return op
+	case t.is("CREATE"):
+		// graphs exist as long as they have quads, so there is nothing to create
+		p.accept("SILENT")
+		p.expect("GRAPH")
+		p.parseIRI()
+		return nil
+	case t.is("LOAD") || t.is("ADD") || t.is("MOVE") || t.is("COPY"):
+		p.pos--
+		p.errorf("%s is not supported", strings.ToUpper(t.text))
+	}
+	p.pos--
+	p.errorf("expected update operation, got %v", t)
+	return nil
+}
+
+func (p *parser) parseModify() *modify {
+	m := &modify{}
+	if p.accept("WITH") {
+		m.with = p.parseIRI()
+	}
+	found := false
+	if p.accept("DELETE") {
+		found = true
+		m.del = p.parseQuads()
+		p.checkTemplate(m.del, "DELETE", false, true)
+	}
+	if p.accept("INSERT") {
+		found = true
+		m.ins = p.parseQuads()
+	}
+	if !found {
+		p.errorf("expected DELETE or INSERT, got %v", p.peek())
+	}
+	for p.accept("USING") {
+		if p.accept("NAMED") {
+			m.usingNamed = append(m.usingNamed, p.parseIRI())
+		} else {
+			m.using = append(m.using, p.parseIRI())
+		}
+	}
+	p.expect("WHERE")
+	m.where = p.parseGroup()
+	return m
+}
+
+// parseQuads parses a quad template in curly braces: triples, optionally grouped into GRAPH blocks.
+func (p *parser) parseQuads() []quadPattern {
+	p.expect("{")
+	var out []quadPattern
+	add := func(triples []triple, g term) {
+		for _, tr := range triples {
+			out = append(out, quadPattern{triple: tr, G: g})
+		}
+	}
+	for !p.accept("}") {
+		switch {
+		case p.accept("."):
+		case p.accept("GRAPH"):
+			g := p.parseVarOrIRI()
+			add(p.parseTemplate(), g)
+		default:
+			add(p.parseTriplesBlock(nil), term{})
+		}
+	}
+	return out
+}
+
+// checkTemplate verifies that a template only has terms allowed by the operation.
+func (p *parser) checkTemplate(tmpl []quadPattern, op string, bnodes, vars bool) {
+	for _, qp := range tmpl {
+		for _, t := range []term{qp.S, qp.P, qp.O, qp.G} {
+			if !t.isVar() {
+				continue
+			}
+			if strings.HasPrefix(t.Var, "_:") {
+				if !bnodes {
+					p.errorf("blank nodes are not allowed in %s", op)
+				}
+			} else if !vars {
+				p.errorf("variables are not allowed in %s", op)
+			}
+		}
+	}
+}
+
+// quadsGroup converts a quad template to a group graph pattern.
+func quadsGroup(tmpl []quadPattern) *group {
+	g := &group{}
+	for _, qp := range tmpl {
+		dst := g
+		if !qp.G.isZero() {
+			var gp *graphPattern
+			if n := len(g.elems); n != 0 {
+				gp, _ = g.elems[n-1].(*graphPattern)
+			}
+			if gp == nil || gp.name != qp.G {
+				gp = &graphPattern{name: qp.G, group: &group{}}
+				g.elems = append(g.elems, gp)
+			}
+			dst = gp.group
+		}
+		if n := len(dst.elems); n != 0 {
+			if b, ok := dst.elems[n-1].(*bgp); ok {
+				b.triples = append(b.triples, qp.triple)
+				continue
+			}
+		}
+		dst.elems = append(dst.elems, &bgp{triples: []triple{qp.triple}})
+	}
+	return g
+}
+
+// Execute applies the update to a quad store. Operations are applied in order, each in a separate transaction.
+func (u *Update) Execute(ctx context.Context, qs graph.QuadStore, qw graph.QuadWriter) error {
+	for _, op := range u.ops {
+		var (
+			del, ins []quad.Quad
+			err      error
+		)
+		switch op := op.(type) {
+		case *modify:
+			del, ins, err = op.quads(ctx, qs)
+		case *clearGraph:
+			del, err = op.quads(ctx, qs)
+		}
+		if err != nil {
+			return err
+		}
+		if err = Modify(ctx, qs, qw, del, ins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *modify) quads(ctx context.Context, qs graph.QuadStore) (del, ins []quad.Quad, err error) {
+	rows := []binding{{}}
+	if m.where != nil {
+		q := &Query{from: m.using, fromNamed: m.usingNamed, where: m.where, limit: -1}
+		if len(q.from) == 0 && len(q.fromNamed) == 0 && m.with != nil {
+			q.from = []quad.Value{m.with}
+		}
+		rows, err = newEngine(qs, q).evalGroup(ctx, m.where, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	del = instantiate(m.del, rows, m.with, nil)
+	// inserted blank nodes are fresh for each solution
+	fresh := make(map[string]quad.BNode)
+	ins = instantiate(m.ins, rows, m.with, func(i int, label string) quad.Value {
+		key := strconv.Itoa(i) + " " + label
+		b, ok := fresh[key]
+		if !ok {
+			b = quad.RandomBlankNode()
+			fresh[key] = b
+		}
+		return b
+	})
+	return del, ins, nil
+}
+
+func (c *clearGraph) quads(ctx context.Context, qs graph.QuadStore) ([]quad.Quad, error) {
+	switch c.target {
+	case targetDefault:
+		return GraphQuads(ctx, qs, nil)
+	case targetNamed:
+		return scanQuads(ctx, qs, qs.QuadsAllIterator(ctx), func(q quad.Quad) bool {
+			return q.Label != nil
+		})
+	case targetAll:
+		return scanQuads(ctx, qs, qs.QuadsAllIterator(ctx), nil)
+	}
+	out, err := GraphQuads(ctx, qs, c.graph)
+	if err == nil && len(out) == 0 && !c.silent {
+		err = fmt.Errorf("graph %v does not exist", c.graph)
+	}
+	return out, err
+}
+
+// instantiate builds quads from a template for each solution. Patterns with unbound variables and quads
+// with invalid terms are skipped. Zero graph term is replaced with def, and blank nodes are replaced
+// with values returned by bnode.
+func instantiate(tmpl []quadPattern, rows []binding, def quad.Value, bnode func(row int, label string) quad.Value) []quad.Quad {
+	in := newInstantiator(tmpl, def, bnode)
+	var out []quad.Quad
+	for _, r := range rows {
+		out = in.next(out, r)
+	}
+	return out
+}
+
+// instantiator builds quads from a template for a stream of solutions, see instantiate.
+// Quads are only returned once.
+type instantiator struct {
+	tmpl  []quadPattern
+	def   quad.Value
+	bnode func(row int, label string) quad.Value
+	row   int
+	seen  map[string]bool
+}
+
+func newInstantiator(tmpl []quadPattern, def quad.Value, bnode func(row int, label string) quad.Value) *instantiator {
+	return &instantiator{tmpl: tmpl, def: def, bnode: bnode, seen: make(map[string]bool)}
+}
+
+// next appends quads built for the next solution to out.
+func (in *instantiator) next(out []quad.Quad, r binding) []quad.Quad {
+	i := in.row
+	in.row++
+	inst := func(t term) quad.Value {
+		if !t.isVar() {
+			return t.Val
+		} else if label, ok := strings.CutPrefix(t.Var, "_:"); ok {
+			return in.bnode(i, label)
+		}
+		return r[t.Var]
+	}
+	for _, qp := range in.tmpl {
+		s, p, o := inst(qp.S), inst(qp.P), inst(qp.O)
+		l := in.def
+		if !qp.G.isZero() {
+			l = inst(qp.G)
+			if l == nil || isLiteral(l) {
+				continue
+			}
+		}
+		if s == nil || p == nil || o == nil || isLiteral(s) {
+			continue
+		} else if _, ok := p.(quad.IRI); !ok {
+			continue
+		}
+		q := quad.Quad{Subject: s, Predicate: p, Object: o, Label: l}
+		if key := q.NQuad(); !in.seen[key] {
+			in.seen[key] = true
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// Modify removes and adds quads in a single transaction. Quads are matched to the stored ones by term equality,
+// thus stored quads are removed even if their values have a different representation. Quads that are not
+// in the store are not removed, and quads that are already in the store are not added.
+func Modify(ctx context.Context, qs graph.QuadStore, qw graph.QuadWriter, del, ins []quad.Quad) error {
+	tx := graph.NewTransaction()
+	removed := make(map[string]bool)
+	for _, q := range del {
+		stored, err := matchQuads(ctx, qs, q)
+		if err != nil {
+			return err
+		}
+		for _, sq := range stored {
+			tx.RemoveQuad(sq)
+			removed[sq.NQuad()] = true
+		}
+	}
+	for _, q := range ins {
+		stored, err := matchQuads(ctx, qs, q)
+		if err != nil {
+			return err
+		}
+		if len(stored) == 0 {
+			tx.AddQuad(q)
+			continue
+		}
+		for _, sq := range stored {
+			if removed[sq.NQuad()] {
+				// cancels the removal
+				tx.AddQuad(sq)
+			}
+		}
+	}
+	if len(tx.Deltas) == 0 {
+		return nil
+	}
+	return qw.ApplyTransaction(ctx, tx)
+}
+
+// GraphQuads returns all quads of a named graph. If g is nil, quads of the default graph are returned,
+// which are the quads without a label.
+func GraphQuads(ctx context.Context, qs graph.QuadStore, g quad.Value) ([]quad.Quad, error) {
+	r := GraphReader(ctx, qs, g)
+	defer r.Close()
+	return quad.ReadAll(ctx, r)
+}
+
+// GraphReader is like GraphQuads, but reads quads of the graph lazily.
+func GraphReader(ctx context.Context, qs graph.QuadStore, g quad.Value) quad.ReadCloser {
+	if g == nil {
+		return defaultGraphReader{graph.NewQuadStoreReader(ctx, qs)}
+	}
+	it := shape.BuildIterator(ctx, qs, shape.Quads{{Dir: quad.Label, Values: lookupValues(g)}})
+	return graph.NewResultReader(ctx, qs, it.Iterate(ctx))
+}
+
+// defaultGraphReader skips quads with a label.
+type defaultGraphReader struct {
+	quad.ReadCloser
+}
+
+func (r defaultGraphReader) ReadQuad(ctx context.Context) (quad.Quad, error) {
+	for {
+		q, err := r.ReadCloser.ReadQuad(ctx)
+		if err != nil || q.Label == nil {
+			return q, err
+		}
+	}
+}
+
+// matchQuads returns stored quads that are equal to a given one.
+func matchQuads(ctx context.Context, qs graph.QuadStore, q quad.Quad) ([]quad.Quad, error) {
+	filters := shape.Quads{
+		{Dir: quad.Subject, Values: lookupValues(q.Subject)},
+		{Dir: quad.Predicate, Values: lookupValues(q.Predicate)},
+		{Dir: quad.Object, Values: lookupValues(q.Object)},
+	}
+	if q.Label != nil {
+		filters = append(filters, shape.QuadFilter{Dir: quad.Label, Values: lookupValues(q.Label)})
+	}
+	return findQuads(ctx, qs, filters, func(sq quad.Quad) bool {
+		return sameTerm(q.Subject, sq.Subject) && sameTerm(q.Predicate, sq.Predicate) &&
+			sameTerm(q.Object, sq.Object) && sameTerm(q.Label, sq.Label)
+	})
+}
+
+// findQuads returns quads that match a shape, keeping only the ones accepted by keep, if it's set.
+func findQuads(ctx context.Context, qs graph.QuadStore, s shape.Shape, keep func(quad.Quad) bool) ([]quad.Quad, error) {
+	s, _, err := shape.Optimize(ctx, s, qs)
+	if err != nil {
+		return nil, err
+	} else if shape.IsNull(s) {
+		return nil, nil
+	}
+	return scanQuads(ctx, qs, shape.BuildIterator(ctx, qs, s), keep)
+}
+
+// scanQuads returns quads of an iterator, keeping only the ones accepted by keep, if it's set.
+func scanQuads(ctx context.Context, qs graph.QuadStore, its iterator.Shape, keep func(quad.Quad) bool) ([]quad.Quad, error) {
+	it := its.Iterate(ctx)
+	defer it.Close()
+	var out []quad.Quad
+	for it.Next(ctx) {
+		ref, err := it.Result(ctx)
+		if err != nil {
+			return nil, err
+		}
+		q, err := qs.Quad(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if keep == nil || keep(q) {
+			out = append(out, q)
+		}
+	}
+	return out, it.Err()
+}
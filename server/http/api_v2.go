@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,6 +30,8 @@ import (
 
 	"github.com/aperturerobotics/cayley/clog"
 	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/cache"
+	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/query"
 	"github.com/aperturerobotics/cayley/query/shape"
 
@@ -42,6 +45,10 @@ const (
 	prefix             = "/api/v2"
 	defaultLimit       = 100
 	defaultReplication = "single"
+
+	// open iterators of paginated queries
+	maxCursors       = 1024
+	defaultCursorTTL = time.Minute
 )
 
 // NewAPIv2 creates a new instance of APIv2 with default options
@@ -51,7 +58,8 @@ func NewAPIv2(h *graph.Handle, wrappers ...HandlerWrapper) *APIv2 {
 
 // NewBoundAPIv2 creates a new instance of APIv2 bound to a given httprouter.Router
 func NewBoundAPIv2(h *graph.Handle, r *httprouter.Router) *APIv2 {
-	api := &APIv2{h: h, wtyp: defaultReplication, wopt: nil, limit: defaultLimit, handler: r}
+	api := &APIv2{h: h, wtyp: defaultReplication, wopt: nil, limit: defaultLimit, handler: r,
+		cursors: query.NewCursors(maxCursors, defaultCursorTTL)}
 	api.registerOn(r)
 	return api
 }
@@ -59,7 +67,8 @@ func NewBoundAPIv2(h *graph.Handle, r *httprouter.Router) *APIv2 {
 // NewAPIv2Writer creates a new instance of APIv2
 func NewAPIv2Writer(h *graph.Handle, wtype string, wopts graph.Options, wrappers ...HandlerWrapper) *APIv2 {
 	r := httprouter.New()
-	api := &APIv2{h: h, wtyp: wtype, wopt: wopts, limit: defaultLimit}
+	api := &APIv2{h: h, wtyp: wtype, wopt: wopts, limit: defaultLimit,
+		cursors: query.NewCursors(maxCursors, defaultCursorTTL)}
 	api.registerOn(r)
 	var handler http.Handler = r
 	for _, wrapper := range wrappers {
@@ -81,8 +90,10 @@ type APIv2 struct {
 	wopt graph.Options
 
 	// query
-	timeout time.Duration
-	limit   int
+	timeout  time.Duration
+	limit    int
+	parallel int
+	cursors  *query.Cursors
 }
 
 // SetReadOnly sets read-only mode for the request
@@ -100,6 +111,12 @@ func (api *APIv2) SetQueryTimeout(dt time.Duration) {
 	api.timeout = dt
 }
 
+// SetQueryParallel sets a number of goroutines used by each query.
+// Queries run sequentially if it's less than two.
+func (api *APIv2) SetQueryParallel(n int) {
+	api.parallel = n
+}
+
 // SetQueryLimit sets query limit for the request
 func (api *APIv2) SetQueryLimit(n int) {
 	api.limit = n
@@ -135,11 +152,15 @@ func (api *APIv2) registerDataOn(r *httprouter.Router) {
 func (api *APIv2) registerQueryOn(r *httprouter.Router) {
 	r.POST(prefix+"/query", toHandle(api.ServeQuery))
 	r.GET(prefix+"/query", toHandle(api.ServeQuery))
+	r.GET(prefix+"/query/cache", toHandle(api.ServeQueryCache))
 }
 
 func (api *APIv2) registerOn(r *httprouter.Router) {
 	api.registerDataOn(r)
+	api.registerStoreOn(r)
+	api.registerWatchOn(r)
 	api.registerQueryOn(r)
+	api.registerSPARQLOn(r)
 }
 
 const (
@@ -460,6 +481,9 @@ func (api *APIv2) ServeFormats(w http.ResponseWriter, r *http.Request) {
 
 func (api *APIv2) queryContext(r *http.Request) (ctx context.Context, cancel func()) {
 	ctx = r.Context()
+	if api.parallel > 1 {
+		ctx = iterator.WithParallel(ctx, api.parallel)
+	}
 	if api.timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, api.timeout)
 	} else {
@@ -468,6 +492,17 @@ func (api *APIv2) queryContext(r *http.Request) (ctx context.Context, cancel fun
 	return ctx, cancel
 }
 
+// ServeQueryCache responds with hit and miss counters of the query result cache.
+func (api *APIv2) ServeQueryCache(w http.ResponseWriter, r *http.Request) {
+	c := cache.Of(api.h)
+	if c == nil {
+		jsonResponse(w, http.StatusNotFound, "query result cache is not enabled")
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(c.Metrics())
+}
+
 func defaultErrorFunc(w query.ResponseWriter, err error) {
 	data, _ := json.Marshal(err.Error())
 	w.WriteHeader(http.StatusBadRequest)
@@ -484,6 +519,18 @@ func writeResults(w io.Writer, r any) {
 	})
 }
 
+func writePage(w io.Writer, p *query.Page) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	out := map[string]any{
+		"result": p.Results,
+	}
+	if p.Next != "" {
+		out["next"] = p.Next
+	}
+	enc.Encode(out)
+}
+
 const maxQuerySize = 1024 * 1024 // 1 MB
 func readLimit(r io.Reader) ([]byte, error) {
 	lr := io.LimitReader(r, maxQuerySize).(*io.LimitedReader)
@@ -494,7 +541,10 @@ func readLimit(r io.Reader) ([]byte, error) {
 	return data, err
 }
 
-// ServeQuery executes a query received in the request and responds with the result
+// ServeQuery executes a query received in the request and responds with the result.
+//
+// If the cursor parameter is set, results are paginated: the response contains a page of results and
+// a "next" cursor, if there are more of them. An empty cursor requests the first page.
 func (api *APIv2) ServeQuery(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := api.queryContext(r)
 	defer cancel()
@@ -566,6 +616,32 @@ func (api *APIv2) ServeQuery(w http.ResponseWriter, r *http.Request) {
 			opt.Collation = query.JSONLD
 		}
 	}
+	opt.Analyze, _ = strconv.ParseBool(vals.Get("analyze"))
+	opt.Explain, _ = strconv.ParseBool(vals.Get("explain"))
+	if opt.Explain || opt.Analyze {
+		exp, err := query.Explain(ctx, ses, qu, opt)
+		if err != nil {
+			errFunc(w, err)
+			return
+		}
+		w.Header().Set(hdrContentType, contentTypeJSON)
+		writeResults(w, exp)
+		return
+	}
+	if vals.Has("cursor") {
+		page, err := api.cursors.ExecutePage(ctx, ses, qu, vals.Get("cursor"), opt)
+		if err != nil {
+			errFunc(w, err)
+			return
+		}
+		if opt.Collation == query.JSONLD {
+			w.Header().Set(hdrContentType, contentTypeJSONLD)
+		} else {
+			w.Header().Set(hdrContentType, contentTypeJSON)
+		}
+		writePage(w, page)
+		return
+	}
 	it, err := ses.Execute(ctx, qu, opt)
 	if err != nil {
 		errFunc(w, err)
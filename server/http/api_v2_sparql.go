@@ -0,0 +1,354 @@
+package cayleyhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/quad"
+	"github.com/aperturerobotics/cayley/query/sparql"
+)
+
+const (
+	sparqlPath     = "/sparql"
+	graphStorePath = "/sparql/graph"
+
+	contentTypeForm          = "application/x-www-form-urlencoded"
+	contentTypeSPARQLQuery   = "application/sparql-query"
+	contentTypeSPARQLUpdate  = "application/sparql-update"
+	contentTypeXML           = "application/xml"
+	contentTypeTextXML       = "text/xml"
+	contentTypeAnyMediaRange = "*/*"
+)
+
+// registerSPARQLOn registers SPARQL 1.1 Protocol and Graph Store Protocol endpoints.
+func (api *APIv2) registerSPARQLOn(r *httprouter.Router) {
+	r.GET(sparqlPath, toHandle(api.ServeSPARQL))
+	r.POST(sparqlPath, toHandle(api.ServeSPARQL))
+	r.GET(graphStorePath, toHandle(api.ServeGraphStore))
+	r.PUT(graphStorePath, toHandle(api.ServeGraphStore))
+	r.POST(graphStorePath, toHandle(api.ServeGraphStore))
+	r.DELETE(graphStorePath, toHandle(api.ServeGraphStore))
+}
+
+// mediaType returns the content type of the request without parameters.
+func mediaType(r *http.Request) string {
+	typ, _, _ := strings.Cut(r.Header.Get(hdrContentType), ";")
+	return strings.ToLower(strings.TrimSpace(typ))
+}
+
+// acceptByQuality returns values of the Accept header, ordered by quality.
+func acceptByQuality(r *http.Request) []string {
+	specs := ParseAccept(r.Header, hdrAccept)
+	sort.SliceStable(specs, func(i, j int) bool {
+		return specs[i].Q > specs[j].Q
+	})
+	out := make([]string, 0, len(specs))
+	for _, s := range specs {
+		if s.Q > 0 {
+			out = append(out, s.Value)
+		}
+	}
+	return out
+}
+
+// ServeSPARQL executes a SPARQL query or update according to the SPARQL 1.1 Protocol.
+//
+// Queries are accepted as a "query" parameter of GET or form-encoded POST requests, or as a body of
+// POST request with application/sparql-query content type. Updates are accepted as an "update" parameter
+// of form-encoded POST requests, or as a body with application/sparql-update content type.
+func (api *APIv2) ServeSPARQL(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		qu, upd string
+		vals    = r.URL.Query()
+	)
+	switch r.Method {
+	case http.MethodGet:
+		qu = vals.Get("query")
+		if vals.Has("update") {
+			jsonResponse(w, http.StatusBadRequest, "updates must be sent with POST")
+			return
+		}
+	default:
+		switch typ := mediaType(r); typ {
+		case contentTypeForm:
+			if err := r.ParseForm(); err != nil {
+				jsonResponse(w, http.StatusBadRequest, err)
+				return
+			}
+			vals = r.Form
+			qu, upd = vals.Get("query"), vals.Get("update")
+		case contentTypeSPARQLQuery, contentTypeSPARQLUpdate:
+			data, err := readLimit(r.Body)
+			if err != nil {
+				jsonResponse(w, http.StatusBadRequest, err)
+				return
+			}
+			if typ == contentTypeSPARQLQuery {
+				qu = string(data)
+			} else {
+				upd = string(data)
+			}
+		default:
+			jsonResponse(w, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type: %q", typ))
+			return
+		}
+	}
+	switch {
+	case qu != "" && upd != "":
+		jsonResponse(w, http.StatusBadRequest, "both query and update are specified")
+	case upd != "":
+		api.serveSPARQLUpdate(w, r, upd)
+	case qu != "":
+		api.serveSPARQLQuery(w, r, qu, vals)
+	default:
+		jsonResponse(w, http.StatusBadRequest, "query is empty")
+	}
+}
+
+func (api *APIv2) serveSPARQLQuery(w http.ResponseWriter, r *http.Request, qu string, vals url.Values) {
+	ctx, cancel := api.queryContext(r)
+	defer cancel()
+	if clog.V(1) {
+		clog.Infof("query: %s: %q", sparql.Name, qu)
+	}
+	q, err := sparql.Parse(qu)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	if def, named := vals["default-graph-uri"], vals["named-graph-uri"]; len(def) != 0 || len(named) != 0 {
+		q.SetDataset(iriValues(def), iriValues(named))
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := q.Execute(ctx, h.QuadStore)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	switch res.Form {
+	case sparql.Construct, sparql.Describe:
+		err = writeSPARQLGraph(w, r, res)
+	default:
+		err = writeSPARQLResults(w, r, res)
+	}
+	if err != nil {
+		clog.Errorf("sparql: cannot write results: %v", err)
+	}
+}
+
+func iriValues(arr []string) []quad.Value {
+	out := make([]quad.Value, 0, len(arr))
+	for _, s := range arr {
+		out = append(out, quad.IRI(s))
+	}
+	return out
+}
+
+// writeSPARQLResults writes solutions or a boolean in one of SPARQL results formats, as requested by Accept header.
+func writeSPARQLResults(w http.ResponseWriter, r *http.Request, res *sparql.Result) error {
+	typ, write := sparql.ContentTypeJSON, res.WriteJSON
+negotiate:
+	for _, v := range acceptByQuality(r) {
+		switch v {
+		case sparql.ContentTypeJSON, contentTypeJSON, contentTypeAnyMediaRange:
+			break negotiate
+		case sparql.ContentTypeXML, contentTypeXML, contentTypeTextXML:
+			typ, write = sparql.ContentTypeXML, res.WriteXML
+			break negotiate
+		case sparql.ContentTypeCSV, sparql.ContentTypeTSV:
+			if res.Form != sparql.Select {
+				// tabular formats cannot represent a boolean result
+				continue
+			}
+			typ, write = v, res.WriteCSV
+			if v == sparql.ContentTypeTSV {
+				write = res.WriteTSV
+			}
+			break negotiate
+		}
+	}
+	w.Header().Set(hdrContentType, typ)
+	return write(w)
+}
+
+// writeSPARQLGraph writes quads in a format requested by Accept header, or in JSON-LD by default.
+func writeSPARQLGraph(w http.ResponseWriter, r *http.Request, res *sparql.Result) error {
+	for _, v := range acceptByQuality(r) {
+		format := quad.FormatByMime(v)
+		if format == nil || format.Writer == nil {
+			continue
+		}
+		w.Header().Set(hdrContentType, v)
+		qw := format.Writer(w)
+		if _, err := qw.WriteQuads(r.Context(), res.Quads); err != nil {
+			qw.Close()
+			return err
+		}
+		return qw.Close()
+	}
+	w.Header().Set(hdrContentType, res.ContentType())
+	return res.WriteJSON(w)
+}
+
+func (api *APIv2) serveSPARQLUpdate(w http.ResponseWriter, r *http.Request, upd string) {
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		return
+	}
+	if clog.V(1) {
+		clog.Infof("update: %s: %q", sparql.Name, upd)
+	}
+	u, err := sparql.ParseUpdate(upd)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	if err = u.Execute(r.Context(), h.QuadStore, h.QuadWriter); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeGraphStore implements SPARQL 1.1 Graph Store HTTP Protocol. Graphs are identified by the "graph"
+// parameter and are mapped to quad labels, while the "default" parameter refers to quads without a label.
+//
+// GET streams quads of the graph without labels, PUT replaces the graph, POST adds quads to it
+// and DELETE removes all quads of the graph. Labels of quads in the request body are ignored.
+func (api *APIv2) ServeGraphStore(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vals := r.URL.Query()
+	var g quad.Value
+	if s := vals.Get("graph"); s != "" {
+		g = quad.IRI(s)
+	} else if !vals.Has("default") {
+		jsonResponse(w, http.StatusBadRequest, "either graph or default parameter must be specified")
+		return
+	}
+	if r.Method != http.MethodGet && api.ro {
+		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		return
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	if r.Method == http.MethodGet {
+		api.serveGraphRead(w, r, sparql.GraphReader(ctx, h.QuadStore, g), g != nil)
+		return
+	}
+	var old, quads []quad.Quad
+	if r.Method != http.MethodPost {
+		old, err = sparql.GraphQuads(ctx, h.QuadStore, g)
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if r.Method == http.MethodDelete {
+		if g != nil && len(old) == 0 {
+			jsonResponse(w, http.StatusNotFound, "graph does not exist")
+			return
+		}
+	} else {
+		quads, err = readGraph(r, g)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err = sparql.Modify(ctx, h.QuadStore, h.QuadWriter, old, quads); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	if r.Method == http.MethodPut && len(old) == 0 {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveGraphRead streams quads of the graph without labels. If the graph must exist, the first quad is read
+// before writing the response, to respond with 404 for an empty graph.
+func (api *APIv2) serveGraphRead(w http.ResponseWriter, r *http.Request, qr quad.ReadCloser, mustExist bool) {
+	defer qr.Close()
+	format := getFormat(r, "format", hdrAccept)
+	if format == nil || format.Writer == nil {
+		jsonResponse(w, http.StatusBadRequest, fmt.Errorf("format is not supported for reading data"))
+		return
+	}
+	ctx := r.Context()
+	first, err := qr.ReadQuad(ctx)
+	if err == io.EOF && mustExist {
+		jsonResponse(w, http.StatusNotFound, "graph does not exist")
+		return
+	} else if err != nil && err != io.EOF {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	wr := writerFrom(w, r, hdrAcceptEncoding)
+	defer wr.Close()
+	if len(format.Mime) != 0 {
+		w.Header().Set(hdrContentType, format.Mime[0])
+	}
+	qw := format.Writer(wr)
+	defer qw.Close()
+	buf := make([]quad.Quad, 1)
+	for q := first; err == nil; q, err = qr.ReadQuad(ctx) {
+		q.Label = nil
+		buf[0] = q
+		if _, err = qw.WriteQuads(ctx, buf); err != nil {
+			break
+		}
+	}
+	if err != nil && err != io.EOF {
+		// header is already written
+		clog.Errorf("read quads error: %v", err)
+	}
+}
+
+// readGraph reads quads from the request body, moving them to a given graph.
+func readGraph(r *http.Request, g quad.Value) ([]quad.Quad, error) {
+	format := getFormat(r, "", hdrContentType)
+	if format == nil || format.Reader == nil {
+		return nil, errors.New("format is not supported for reading data")
+	}
+	rd, err := readerFrom(r, hdrContentEncoding)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	qr := format.Reader(rd)
+	defer qr.Close()
+	var out []quad.Quad
+	for {
+		q, err := qr.ReadQuad(r.Context())
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+		q.Label = g
+		out = append(out, q)
+	}
+}
@@ -0,0 +1,212 @@
+package cayleyhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph"
+	httpgraph "github.com/aperturerobotics/cayley/graph/http"
+	"github.com/aperturerobotics/cayley/graph/refs"
+	"github.com/aperturerobotics/cayley/query/shape"
+)
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// registerStoreOn registers endpoints that expose a low-level quad store interface.
+// These endpoints are used by the remote quad store backend.
+func (api *APIv2) registerStoreOn(r *httprouter.Router) {
+	if !api.ro {
+		r.POST(prefix+"/deltas", toHandle(api.ServeDeltas))
+	}
+	r.GET(prefix+"/stats", toHandle(api.ServeStats))
+	r.POST(prefix+"/shape", toHandle(api.ServeShape))
+}
+
+// ServeStats responds with node and quad counts of the database.
+func (api *APIv2) ServeStats(w http.ResponseWriter, r *http.Request) {
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	exact, _ := strconv.ParseBool(r.FormValue("exact")) //nolint:gosec
+	st, err := h.QuadStore.Stats(r.Context(), exact)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(httpgraph.MakeStats(st))
+}
+
+// ServeDeltas applies a set of quad changes received in the request body.
+// If one of the changes cannot be applied, none of them are applied and
+// the response describes which change failed.
+func (api *APIv2) ServeDeltas(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		return
+	}
+	rd, err := readerFrom(r, hdrContentEncoding)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	defer rd.Close()
+	var req httpgraph.DeltasRequest
+	if err = json.NewDecoder(rd).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	deltas := make([]graph.Delta, 0, len(req.Deltas))
+	for _, d := range req.Deltas {
+		q, err := d.Quad.ToNative(ctx)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		deltas = append(deltas, graph.Delta{Quad: q, Action: d.Action})
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	err = h.QuadStore.ApplyDeltas(ctx, deltas, graph.IgnoreOpts{
+		IgnoreDup:     req.IgnoreDup,
+		IgnoreMissing: req.IgnoreMissing,
+	})
+	if de, ok := httpgraph.MakeDeltaError(deltas, err); ok {
+		w.Header().Set(hdrContentType, contentTypeJSON)
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(de)
+		return
+	} else if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(newWriteResponse(len(deltas)))
+}
+
+// ServeShape executes a serialized query shape and streams results as newline-delimited JSON.
+func (api *APIv2) ServeShape(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx, cancel := api.queryContext(r)
+	defer cancel()
+	data, err := readLimit(r.Body)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	var req httpgraph.ShapeRequest
+	if err = json.Unmarshal(data, &req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	qs := h.QuadStore
+	s, err := shape.UnmarshalJSON(ctx, req.Shape, qs)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	its := shape.BuildIterator(ctx, qs, s)
+	if optim, _, err := its.Optimize(ctx); err == nil {
+		its = optim
+	}
+	it := its.Iterate(ctx)
+	defer it.Close()
+
+	result := func(path bool) (httpgraph.ShapeResult, error) {
+		out := httpgraph.ShapeResult{Path: path}
+		ref, err := it.Result(ctx)
+		if err != nil {
+			return out, err
+		}
+		if req.Quads {
+			q, err := qs.Quad(ctx, ref)
+			if err != nil {
+				return out, err
+			}
+			wq, err := httpgraph.MakeQuad(q)
+			if err != nil {
+				return out, err
+			}
+			out.Quad = &wq
+		} else {
+			v, err := qs.NameOf(ctx, ref)
+			if err != nil {
+				return out, err
+			}
+			if out.Value, err = httpgraph.MarshalValue(v); err != nil {
+				return out, err
+			}
+		}
+		tags := make(map[string]refs.Ref)
+		if err = it.TagResults(ctx, tags); err != nil {
+			return out, err
+		}
+		for tag, ref := range tags {
+			v, err := qs.NameOf(ctx, ref)
+			if err != nil {
+				return out, err
+			} else if v == nil {
+				// tags may reference quads; only node values are sent
+				continue
+			}
+			data, err := httpgraph.MarshalValue(v)
+			if err != nil {
+				return out, err
+			}
+			if out.Tags == nil {
+				out.Tags = make(map[string][]byte, len(tags))
+			}
+			out.Tags[tag] = data
+		}
+		return out, nil
+	}
+
+	w.Header().Set(hdrContentType, contentTypeNDJSON)
+	enc := json.NewEncoder(w)
+	send := func(path bool) bool {
+		res, err := result(path)
+		if err != nil {
+			res = httpgraph.ShapeResult{Error: err.Error()}
+		}
+		if err := enc.Encode(res); err != nil {
+			// client is gone, nothing else we can do
+			clog.Errorf("shape results error: %v", err)
+			return false
+		}
+		return res.Error == ""
+	}
+	n := 0
+	limited := func() bool { return req.Limit > 0 && n >= req.Limit }
+	for !limited() && it.Next(ctx) {
+		n++
+		if !send(false) {
+			return
+		}
+		for !limited() && it.NextPath(ctx) {
+			n++
+			if !send(true) {
+				return
+			}
+		}
+	}
+	if err = it.Err(); err != nil {
+		enc.Encode(httpgraph.ShapeResult{Error: err.Error()})
+	}
+}
@@ -1,19 +1,31 @@
 package cayleyhttp
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/graph/cache"
+	"github.com/aperturerobotics/cayley/graph/iterator"
 	"github.com/aperturerobotics/cayley/graph/memstore"
 	"github.com/aperturerobotics/cayley/quad"
 	"github.com/aperturerobotics/cayley/quad/jsonld"
+	"github.com/aperturerobotics/cayley/query"
+	_ "github.com/aperturerobotics/cayley/query/gizmo"
+	_ "github.com/aperturerobotics/cayley/query/linkedql/steps"
+	"github.com/aperturerobotics/cayley/query/sparql"
 	"github.com/aperturerobotics/cayley/writer"
 	"github.com/stretchr/testify/require"
 )
@@ -35,7 +47,7 @@ func makeServerV2(t testing.TB, quads ...quad.Quad) *APIv2 {
 
 func writeQuads(ctx context.Context, q []quad.Quad, w io.Writer) error {
 	writer := jsonld.NewWriter(w)
-	reader := quad.NewReader(quads)
+	reader := quad.NewReader(q)
 	_, err := quad.Copy(ctx, writer, reader)
 	writer.Close()
 	return err
@@ -165,3 +177,368 @@ func TestV2PostNamespaceRules(t *testing.T) {
 	require.Equal(t, contentTypeJSON, rr.Header().Get(hdrContentType))
 	require.Contains(t, rules, rule)
 }
+
+func TestV2Watch(t *testing.T) {
+	h := makeHandle(t)
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	watch := func(accept, cursor string) *bufio.Reader {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+prefix+"/watch?cursor="+cursor, nil)
+		require.NoError(t, err)
+		if accept != "" {
+			req.Header.Set(hdrAccept, accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return bufio.NewReader(resp.Body)
+	}
+
+	r := watch("", "")
+	require.NoError(t, h.QuadWriter.AddQuadSet(ctx, quads))
+
+	line, err := r.ReadBytes('\n')
+	require.NoError(t, err)
+	var b watchBatch
+	require.NoError(t, json.Unmarshal(line, &b))
+	require.NotEmpty(t, b.Cursor)
+	require.Len(t, b.Deltas, len(quads))
+	for i, d := range b.Deltas {
+		require.Equal(t, "add", d.Action)
+		require.Equal(t, quads[i].String(), d.Quad.String())
+	}
+
+	// replay the first batch as server-sent events
+	r = watch(contentTypeEventStream, "0")
+	line, err = r.ReadBytes('\n')
+	require.NoError(t, err)
+	require.Equal(t, "id: "+b.Cursor+"\n", string(line))
+	line, err = r.ReadBytes('\n')
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(line, []byte("data: ")), "%q", line)
+	var b2 watchBatch
+	require.NoError(t, json.Unmarshal(line[len("data: "):], &b2))
+	require.Equal(t, b, b2)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+prefix+"/watch?cursor=x", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestV2WatchCache(t *testing.T) {
+	qs := cache.New(memstore.New(), 0)
+	wr, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	srv := httptest.NewServer(NewAPIv2(&graph.Handle{QuadStore: qs, QuadWriter: wr}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+prefix+"/watch", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, wr.AddQuadSet(ctx, quads))
+	line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+	require.NoError(t, err)
+	var b watchBatch
+	require.NoError(t, json.Unmarshal(line, &b))
+	require.Len(t, b.Deltas, len(quads))
+}
+
+func TestV2SPARQL(t *testing.T) {
+	api := makeServerV2(t, quads...)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		return rr
+	}
+	const qu = `SELECT ?x WHERE { ?x <http://example.com/likes> <http://example.com/alice> }`
+
+	req := httptest.NewRequest(http.MethodGet, sparqlPath+"?query="+url.QueryEscape(qu), nil)
+	rr := serve(req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, sparql.ContentTypeJSON, rr.Header().Get(hdrContentType))
+	require.JSONEq(t, `{"head":{"vars":["x"]},"results":{"bindings":[{"x":{"type":"uri","value":"http://example.com/bob"}}]}}`, rr.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, sparqlPath, strings.NewReader(qu))
+	req.Header.Set(hdrContentType, contentTypeSPARQLQuery)
+	req.Header.Set(hdrAccept, "application/json;q=0.5, text/csv")
+	rr = serve(req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, sparql.ContentTypeCSV, rr.Header().Get(hdrContentType))
+	require.Equal(t, "x\r\nhttp://example.com/bob\r\n", rr.Body.String())
+
+	form := url.Values{"update": {`INSERT DATA { <http://example.com/carol> <http://example.com/likes> <http://example.com/alice> }`}}
+	req = httptest.NewRequest(http.MethodPost, sparqlPath, strings.NewReader(form.Encode()))
+	req.Header.Set(hdrContentType, contentTypeForm)
+	rr = serve(req)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+	form = url.Values{"query": {qu}}
+	req = httptest.NewRequest(http.MethodPost, sparqlPath, strings.NewReader(form.Encode()))
+	req.Header.Set(hdrContentType, contentTypeForm)
+	req.Header.Set(hdrAccept, sparql.ContentTypeTSV)
+	rr = serve(req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	sort.Strings(lines)
+	require.Equal(t, []string{"<http://example.com/bob>", "<http://example.com/carol>", "?x"}, lines)
+
+	req = httptest.NewRequest(http.MethodGet, sparqlPath+"?query="+url.QueryEscape(`ASK { ?s ?p ?o }`), nil)
+	req.Header.Set(hdrAccept, sparql.ContentTypeXML)
+	rr = serve(req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Contains(t, rr.Body.String(), "<boolean>true</boolean>")
+
+	req = httptest.NewRequest(http.MethodGet, sparqlPath+"?query="+url.QueryEscape(`SELECT`), nil)
+	require.Equal(t, http.StatusBadRequest, serve(req).Code)
+
+	api.SetReadOnly(true)
+	req = httptest.NewRequest(http.MethodPost, sparqlPath, strings.NewReader(`CLEAR ALL`))
+	req.Header.Set(hdrContentType, contentTypeSPARQLUpdate)
+	require.Equal(t, http.StatusForbidden, serve(req).Code)
+}
+
+func TestV2GraphStore(t *testing.T) {
+	api := makeServerV2(t, quads...)
+	ctx := context.Background()
+
+	serve := func(method, params string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, graphStorePath+"?"+params, body)
+		req.Header.Set(hdrContentType, mime)
+		req.Header.Set(hdrAccept, mime)
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		return rr
+	}
+	read := func(params string) []quad.Quad {
+		rr := serve(http.MethodGet, params, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		got, err := quad.ReadAll(ctx, jsonld.NewReader(rr.Body))
+		require.NoError(t, err)
+		sort.Sort(quad.ByQuadString(got))
+		return got
+	}
+	const g = "http://example.com/graph"
+	params := "graph=" + url.QueryEscape(g)
+
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, params, nil).Code)
+
+	buf, err := newQuadsBuffer(ctx, quads[:1])
+	require.NoError(t, err)
+	rr := serve(http.MethodPut, params, buf)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	require.Equal(t, quads[:1], read(params))
+
+	buf, err = newQuadsBuffer(ctx, quads[1:])
+	require.NoError(t, err)
+	rr = serve(http.MethodPost, params, buf)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	exp := append([]quad.Quad{}, quads...)
+	sort.Sort(quad.ByQuadString(exp))
+	require.Equal(t, exp, read(params))
+
+	buf, err = newQuadsBuffer(ctx, quads[1:])
+	require.NoError(t, err)
+	rr = serve(http.MethodPut, params, buf)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	require.Equal(t, quads[1:], read(params))
+
+	// quads of the default graph are not affected
+	require.Equal(t, exp, read("default"))
+
+	rr = serve(http.MethodDelete, params, nil)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, params, nil).Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "", nil).Code)
+}
+
+func TestV2Explain(t *testing.T) {
+	api := makeServerV2(t, quads...)
+
+	const qu = `g.V("<http://example.com/bob>").Out("<http://example.com/likes>").All()`
+	explain := func(params string) (out struct {
+		Result query.Explanation `json:"result"`
+	}) {
+		req := httptest.NewRequest(http.MethodGet, prefix+"/query?lang=gizmo&"+params+"&qu="+url.QueryEscape(qu), nil)
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
+		return out
+	}
+
+	out := explain("explain=true")
+	require.Len(t, out.Result.Plans, 1)
+	p := out.Result.Plans[0]
+	require.NotNil(t, p.Shape)
+	require.NotNil(t, p.Optimized)
+	require.NotEmpty(t, p.Iterator.Type)
+	require.Nil(t, p.Iterator.Stats)
+	require.Zero(t, out.Result.Results)
+
+	out = explain("explain=true&analyze=true")
+	require.Len(t, out.Result.Plans, 1)
+	p = out.Result.Plans[0]
+	require.NotNil(t, p.Iterator.Stats)
+	require.Equal(t, int64(1), p.Iterator.Stats.Results)
+	require.Equal(t, 1, out.Result.Results)
+}
+
+func TestV2QueryCursor(t *testing.T) {
+	var data []quad.Quad
+	for i := 0; i < 10; i++ {
+		data = append(data, quad.MakeIRI(fmt.Sprintf("http://example.com/n%d", i), "http://example.com/likes", "http://example.com/alice", ""))
+	}
+	api := makeServerV2(t, data...)
+	api.SetQueryLimit(3)
+
+	const qu = `g.V().Has("<http://example.com/likes>").All()`
+	type page struct {
+		Result []json.RawMessage `json:"result"`
+		Next   string            `json:"next"`
+	}
+	get := func(api *APIv2, cursor string) (int, page) {
+		req := httptest.NewRequest(http.MethodGet, prefix+"/query?lang=gizmo&cursor="+url.QueryEscape(cursor)+"&qu="+url.QueryEscape(qu), nil)
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		var out page
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
+		}
+		return rr.Code, out
+	}
+
+	var (
+		all     []string
+		cursors []string
+		cursor  string
+	)
+	for {
+		code, p := get(api, cursor)
+		require.Equal(t, http.StatusOK, code)
+		for _, r := range p.Result {
+			all = append(all, string(r))
+		}
+		if p.Next == "" {
+			break
+		}
+		require.Len(t, p.Result, 3)
+		require.Equal(t, 1, api.cursors.Len(), "iterator should be kept open")
+		cursor = p.Next
+		cursors = append(cursors, cursor)
+	}
+	require.Len(t, all, 10)
+	require.Len(t, cursors, 3)
+	require.Zero(t, api.cursors.Len())
+	sorted := append([]string{}, all...)
+	sort.Strings(sorted)
+	require.Len(t, slices.Compact(sorted), 10)
+
+	// without an open iterator the query runs again and skips to the cursor
+	fresh := makeServerV2(t, data...)
+	fresh.SetQueryLimit(3)
+	code, p := get(fresh, cursors[1])
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, p.Result, 3)
+	for i, r := range p.Result {
+		require.Equal(t, all[6+i], string(r))
+	}
+
+	code, _ = get(fresh, "garbage")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestV2QueryCursorResume(t *testing.T) {
+	var data []quad.Quad
+	for i := 0; i < 10; i++ {
+		data = append(data, quad.MakeIRI(fmt.Sprintf("http://example.com/n%d", i), "http://example.com/likes", "http://example.com/alice", ""))
+	}
+	type page struct {
+		Result []json.RawMessage `json:"result"`
+		Next   string            `json:"next"`
+	}
+	get := func(lang, qu, cursor string) (int, page) {
+		// a new server for each page, thus the query can't continue on an open iterator
+		api := makeServerV2(t, data...)
+		api.SetQueryLimit(3)
+		req := httptest.NewRequest(http.MethodGet, prefix+"/query?lang="+lang+"&cursor="+url.QueryEscape(cursor)+"&qu="+url.QueryEscape(qu), nil)
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		var out page
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
+		}
+		return rr.Code, out
+	}
+
+	// sorted linkedql results are resumed at the cursor, instead of skipping results before it
+	defer func(n int64) { iterator.MaxCursorSkip = n }(iterator.MaxCursorSkip)
+	iterator.MaxCursorSkip = 1
+	const qu = `{"@context": {"@vocab": "http://cayley.io/linkedql#"}, "@type": "Order", "from": {"@type": "Match", "pattern": {}}}`
+	var (
+		all    []string
+		cursor string
+	)
+	for {
+		code, p := get("linkedql", qu, cursor)
+		require.Equal(t, http.StatusOK, code)
+		for _, r := range p.Result {
+			all = append(all, string(r))
+		}
+		if p.Next == "" {
+			break
+		}
+		cursor = p.Next
+	}
+	require.Len(t, all, 12)
+	require.True(t, slices.IsSorted(all))
+
+	// other queries can only skip up to MaxCursorSkip results
+	code, p := get("gizmo", `g.V().All()`, "")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = get("gizmo", `g.V().All()`, p.Next)
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestV2QueryCache(t *testing.T) {
+	qs := cache.New(memstore.New(quad.MakeIRI("http://example.com/bob", "http://example.com/likes", "http://example.com/alice", "")), 0)
+	wr, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	api := NewAPIv2(&graph.Handle{QuadStore: qs, QuadWriter: wr})
+
+	const qu = `g.V().Has("<http://example.com/likes>").All()`
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, prefix+"/query?lang=gizmo&qu="+url.QueryEscape(qu), nil)
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Contains(t, rr.Body.String(), "http://example.com/bob")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, prefix+"/query/cache", nil)
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var m cache.Metrics
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &m))
+	require.Equal(t, int64(2), m.Hits)
+	require.Equal(t, int64(1), m.Misses)
+
+	req = httptest.NewRequest(http.MethodGet, prefix+"/query/cache", nil)
+	rr = httptest.NewRecorder()
+	makeServerV2(t).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,128 @@
+package cayleyhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/aperturerobotics/cayley/clog"
+	"github.com/aperturerobotics/cayley/graph"
+	"github.com/aperturerobotics/cayley/quad"
+)
+
+const contentTypeEventStream = "text/event-stream"
+
+func (api *APIv2) registerWatchOn(r *httprouter.Router) {
+	r.GET(prefix+"/watch", toHandle(api.ServeWatch))
+}
+
+// watchDelta is a single change sent by the watch endpoint.
+type watchDelta struct {
+	Action string    `json:"action"`
+	Quad   quad.Quad `json:"quad"`
+}
+
+// watchBatch is a batch of changes sent by the watch endpoint.
+type watchBatch struct {
+	Cursor string       `json:"cursor"`
+	Deltas []watchDelta `json:"deltas"`
+}
+
+func newWatchBatch(b graph.DeltaBatch) watchBatch {
+	out := watchBatch{Cursor: b.Cursor, Deltas: make([]watchDelta, 0, len(b.Deltas))}
+	for _, d := range b.Deltas {
+		out.Deltas = append(out.Deltas, watchDelta{Action: d.Action.String(), Quad: d.Quad})
+	}
+	return out
+}
+
+// ServeWatch streams changes committed to the database.
+//
+// Changes are sent as newline-delimited JSON, or as server-sent events if the client accepts them.
+// Each message includes a cursor that can be passed in the "cursor" parameter to resume the stream.
+// For server-sent events, the cursor is also used as event ID, thus clients reconnect automatically.
+func (api *APIv2) ServeWatch(w http.ResponseWriter, r *http.Request) {
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	// writes go through the wrappers, thus the innermost quad store sees all changes
+	wr, ok := graph.UnwrapAll(h.QuadStore).(graph.Watcher)
+	if !ok {
+		jsonResponse(w, http.StatusNotImplemented, "database does not support watching for changes")
+		return
+	}
+	sse := false
+	if specs := ParseAccept(r.Header, hdrAccept); len(specs) != 0 {
+		sse = specs[0].Value == contentTypeEventStream
+	}
+	cursor := r.FormValue("cursor")
+	if id := r.Header.Get("Last-Event-ID"); sse && id != "" {
+		cursor = id
+	}
+	ctx := r.Context()
+	feed, err := wr.Watch(ctx, cursor)
+	if errors.Is(err, graph.ErrInvalidCursor) {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	} else if errors.Is(err, graph.ErrCursorExpired) {
+		jsonResponse(w, http.StatusGone, err)
+		return
+	} else if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer feed.Close()
+
+	if sse {
+		w.Header().Set(hdrContentType, contentTypeEventStream)
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set(hdrContentType, contentTypeNDJSON)
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+	for feed.Next(ctx) {
+		b := feed.Batch()
+		if err = writeWatchMessage(w, sse, b.Cursor, newWatchBatch(b)); err != nil {
+			// client is gone
+			return
+		}
+		flush()
+	}
+	if err = feed.Err(); err != nil && ctx.Err() == nil {
+		clog.Errorf("watch error: %v", err)
+		writeWatchMessage(w, sse, "", struct {
+			Error string `json:"error"`
+		}{Error: err.Error()})
+		flush()
+	}
+}
+
+func writeWatchMessage(w io.Writer, sse bool, id string, msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if !sse {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	if id == "" {
+		_, err = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	} else {
+		_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", id, data)
+	}
+	return err
+}
@@ -29,7 +29,8 @@ func jsonResponse(w http.ResponseWriter, code int, err any) {
 
 // HandleForRequest returns new graph.Handle for given writer name, options and request
 func HandleForRequest(h *graph.Handle, wtyp string, wopt graph.Options, r *http.Request) (*graph.Handle, error) {
-	g, ok := h.QuadStore.(httpgraph.QuadStore)
+	// wrappers such as a result cache are shared between requests, thus they are not used for per-request stores
+	g, ok := graph.UnwrapAll(h.QuadStore).(httpgraph.QuadStore)
 	if !ok {
 		return h, nil
 	}